@@ -61,6 +61,10 @@ def gen_bootstrap_conf(args):
     cmd = [BOOTSTRAP_CMD, "--logtostderr"]
 
     cmd.extend(["--admin_port", str(args.status_port)])
+    if args.status_port and args.admin_address:
+        cmd.extend(["--admin_address", args.admin_address])
+    if args.status_port and args.admin_access_log_path:
+        cmd.extend(["--admin_access_log_path", args.admin_access_log_path])
     if args.http_request_timeout_s:
         cmd.extend(
             ["--http_request_timeout_s",
@@ -123,6 +127,19 @@ environment variable or by passing "-k" flag to this script.
            --service, --version, and --rollout_strategy.
         ''')
 
+    parser.add_argument(
+        '--openapi_path',
+        default=None,
+        help='''
+        Specify a path for ESPv2 to load the OpenAPI 2.0 document of the
+        endpoint service in JSON, instead of deploying it to Service
+        Management first. It is converted into the service config the same way
+        Service Management does. Service Control is not called, so the calls
+        are not reported, and the documents requiring API keys are rejected as
+        they can not be checked. The same flags as --service_json_path are
+        ignored.
+        ''')
+
     parser.add_argument(
         '-a',
         '--backend',
@@ -168,11 +185,43 @@ environment variable or by passing "-k" flag to this script.
         It supports HTTP/1.x, HTTP/2, and gRPC connections.
         Default is {port}'''.format(port=DEFAULT_LISTENER_PORT))
 
+    parser.add_argument('--listener_address', default=None, help='''
+        The ip address to accept downstream connections on. Supports both ipv4
+        and ipv6 addresses. Use "::" for all the ipv6 and ipv4 addresses, or a
+        loopback address like "127.0.0.1" to only accept the connections from
+        the same pod. Default is 0.0.0.0.''')
+
+    parser.add_argument('--listener_uds_path', default=None, help='''
+        The path of the unix domain socket to accept downstream connections
+        on, instead of the listener port. Prefix it with '@' for an abstract
+        socket. For the sidecar deployments where the app and ESPv2 share a
+        pod, to avoid the TCP overhead.''')
+
+    parser.add_argument('--ssl_listener_port', default=None, type=int, help='''
+        The port to accept TLS downstream connections with the server
+        certificate, while the listener port keeps accepting the plaintext
+        ones. Requires --ssl_server_cert_path or --generate_self_signed_cert.
+        By default only the listener port is used, serving TLS if the server
+        certificate is set.''')
+
+    parser.add_argument('--https_redirect', action='store_true', help='''
+        Redirect the plaintext requests on the listener port to https on
+        --ssl_listener_port instead of serving them. The health checks on
+        --healthz are still served.''')
+
     parser.add_argument('-N', '--status_port', '--admin_port', default=0,
         type=int, help=''' Enable ESPv2 Envoy admin on this port. Please refer
         to https://www.envoyproxy.io/docs/envoy/latest/operations/admin.
         By default the admin port is disabled.''')
 
+    parser.add_argument('--admin_address', default=None, help='''
+        The address ESPv2 Envoy admin listens on, if enabled by --status_port.
+        Supports both ipv4 and ipv6 addresses. Default is 0.0.0.0.''')
+
+    parser.add_argument('--admin_access_log_path', default=None, help='''
+        The path to write the access log of ESPv2 Envoy admin to, if enabled
+        by --status_port. By default the access log is discarded.''')
+
     parser.add_argument('--ssl_server_cert_path', default=None, help='''
         Proxy's server cert path. When configured, ESPv2 only accepts HTTP/1.x and
         HTTP/2 secure connections on listener_port. Requires the certificate and
@@ -244,6 +293,62 @@ environment variable or by passing "-k" flag to this script.
         If the flag "--heath_check_grpc_backend" is used, ESPv2
         periodically checks the backend gRPC Health service, its result will
         be reflected when answering the health check calls.''')
+    parser.add_argument('--enable_grpc_reflection', action='store_true',
+        default=False, help='''
+        Answer the gRPC server reflection of the proxied API from the proto
+        descriptor of the service config, instead of passing it through to
+        the backend. The clients can discover the API even when the backend
+        disables the reflection.''')
+    parser.add_argument('--enable_grpc_web', default='true',
+        choices=['true', 'false'], help='''
+        Translate the gRPC-Web requests from the browsers for the gRPC
+        backends. Set it to false for pure gRPC deployments to drop the
+        gRPC-Web filter and its per-request overhead. Default: true.''')
+    parser.add_argument('--skip_transcoder_filter', action='store_true',
+        default=False, help='''
+        Drop the gRPC-JSON transcoder filter for the gRPC backends, when no
+        client calls them with HTTP/JSON.''')
+    parser.add_argument('--skip_backend_auth_filter', action='store_true',
+        default=False, help='''
+        Drop the backend auth filter. It cannot be dropped when any backend
+        rule requires JWT authentication to its backend.''')
+    parser.add_argument('--skip_jwt_authn_filter', action='store_true',
+        default=False, help='''
+        Drop the JWT authentication filter, the JWTs are not verified even if
+        the service config requires them. It cannot be dropped when
+        --log_jwt_payloads or --jwt_claim_requirements is set.''')
+    parser.add_argument('--skip_service_control_filter', action='store_true',
+        default=False, help='''
+        Drop the service control filter, the API keys are not checked and no
+        call is reported to Google Service Control.''')
+    parser.add_argument('--path_rewrite_filter', default='auto',
+        choices=['auto', 'on', 'off'], help='''
+        Control the generation of the path rewrite filter, which translates
+        the request paths for the backend rules of the service config. The
+        path matching of the former path_matcher filter is done by the
+        routes. "auto" only generates it when any backend rule requires path
+        translation, and it cannot be "off" then. Default: auto.''')
+    parser.add_argument('--response_compression', default=None, help='''
+        Comma separated algorithms, gzip or brotli, to compress the responses
+        with, e.g. the large transcoded JSON responses. The algorithm is
+        negotiated with the Accept-Encoding request header.
+        Default: not used.''')
+    parser.add_argument('--response_compression_min_content_length',
+        default=None, help='''
+        Only works when --response_compression is in use. The minimum
+        response Content-Length in bytes to compress. Default: 30.''')
+    parser.add_argument('--response_compression_content_types', default=None,
+        help='''
+        Only works when --response_compression is in use. Comma separated
+        content types of the responses to compress. By default, the common
+        text types, e.g. application/json, text/html and text/plain, are
+        compressed.''')
+    parser.add_argument('--api_metadata_path', default=None, help='''
+        Serve the API discovery metadata, i.e. the title and the documentation
+        section of the service config, at the path for the developer portals
+        and the API catalogs. For example
+        "--api_metadata_path=/.well-known/api-metadata".
+        Default: not used.''')
 
     parser.add_argument('--health_check_grpc_backend', action='store_true',
         help='''If enabled, periodically check gRPC Health service to the backend specified by the
@@ -328,6 +433,85 @@ environment variable or by passing "-k" flag to this script.
         help='''The service config rollout strategy, [fixed|managed],
         Default value: {strategy}'''.format(strategy=DEFAULT_ROLLOUT_STRATEGY),
         choices=['fixed', 'managed'])
+    parser.add_argument(
+        '--rollout_traffic_policy',
+        default=None,
+        help='''
+        With the managed rollout strategy, how the instances select among the
+        service configs of the latest rollout. "highest" serves the config with
+        the highest traffic percentage on all the instances. "percentage" serves
+        the configs on the instances in proportion to their traffic
+        percentages, selected by the hostname. The default is highest.
+        ''',
+        choices=['highest', 'percentage'])
+    parser.add_argument(
+        '--rollout_pubsub_subscription',
+        default=None,
+        help='''
+        With the managed rollout strategy, the Pub/Sub subscription notified of
+        the new rollouts, in the format of
+        projects/PROJECT/subscriptions/SUBSCRIPTION. A new rollout is applied
+        as soon as a message is received, instead of at the next rollout check.
+        Pub/Sub delivers each message to only one puller of a subscription, so
+        every instance must pull its own subscription of the topic.
+        ''')
+    parser.add_argument(
+        '--service_config_cache_path',
+        default=None,
+        help='''
+        File path to persist the last service config fetched from Service
+        Management. If the service config can not be fetched at startup, e.g.
+        during a Service Management outage, the persisted one is served instead
+        of failing to start. Mount a volume surviving the proxy restarts.
+        ''')
+    parser.add_argument(
+        '--startup_fetch_timeout',
+        default=None,
+        help='''
+        How long to keep retrying fetching the startup service config and
+        rollouts from Service Management with exponential backoff, before
+        failing to start, e.g. 2m. By default the proxy fails to start on the
+        first failed fetch.
+        ''')
+
+    parser.add_argument(
+        '--canary_fraction',
+        default=None,
+        help='''
+        With the managed rollout strategy, the fraction of the proxy instances
+        serving a new service config as canaries for the bake period. Each
+        instance is a canary with this probability, so a small deployment may
+        have no canary. The canaries roll it back and alert if it raises the
+        5xx error rate, the other instances adopt it once the bake period is
+        over only if it is still the latest rollout, so the rollout should be
+        rolled back in Service Management on the alert. It requires
+        --status_port to read the error rate stats from Envoy.
+        ''')
+    parser.add_argument(
+        '--canary_bake_period',
+        default=None,
+        help='''
+        The time the canaries serve a new service config before it is adopted
+        by the other instances, e.g. 10m. The default is 10m.
+        ''')
+    parser.add_argument(
+        '--canary_max_error_rate_increase',
+        default=None,
+        help='''
+        The canaries roll back a new service config if its 5xx error rate
+        exceeds the one of the previous config by more than this. The
+        default is 0.01.
+        ''')
+    parser.add_argument(
+        '--watchdog_fail_healthz',
+        action='store_true',
+        default=False,
+        help='''
+        Fail the health checks on --healthz while the config manager watchdog
+        finds the config manager unhealthy, e.g. its managed rollout loop has
+        stopped, so that the instance can be restarted or taken out of the
+        load balancing. It requires --healthz and --status_port.
+        ''')
 
     # Customize management service url prefix.
     parser.add_argument(
@@ -335,6 +519,30 @@ environment variable or by passing "-k" flag to this script.
         '--management',
         default=None,
         help=argparse.SUPPRESS)
+    parser.add_argument(
+        '--service_control_url',
+        default=None,
+        help='''
+        The url of the Service Control server. Set it to the self-hosted server
+        with --telemetry_backend=servicecontrol_compatible.
+        ''')
+    parser.add_argument(
+        '--service_management_failover_urls',
+        default=None,
+        help='''
+        Comma separated urls of the Service Management servers tried in order
+        when the default one fails with a transport error or a 5xx status, e.g.
+        the regional endpoints. A failed url is skipped for a minute unless all
+        of them fail.
+        ''')
+    parser.add_argument(
+        '--service_control_failover_urls',
+        default=None,
+        help='''
+        Comma separated urls of the Service Control servers failed over to in
+        order when the default one fails with a transport error or a 5xx
+        status.
+        ''')
 
     # CORS presets
     parser.add_argument(
@@ -399,6 +607,15 @@ environment variable or by passing "-k" flag to this script.
         Only works when --cors_preset is in use. Configures the CORS header
         Access-Control-Expose-Headers. Defaults to allow common response headers.
         ''')
+    parser.add_argument(
+        '--grpc_web_expose_trailers',
+        default=None,
+        help='''
+        Only works when --cors_preset is in use and the backend is gRPC.
+        Comma separated custom trailing metadata keys to expose to the gRPC-Web
+        clients. They are appended to Access-Control-Expose-Headers along with
+        grpc-status and grpc-message.
+        ''')
     parser.add_argument(
         '--cors_allow_credentials',
         action='store_true',
@@ -555,6 +772,15 @@ environment variable or by passing "-k" flag to this script.
         if the fields are available. The value must be a primitive field,
         JSON objects and arrays will not be logged.
         ''')
+
+    parser.add_argument(
+        '--log_labels',
+        default=None,
+        help='''Add custom labels to the endpoint logs reported through
+        service control, separated by comma. Example, when
+        --log_labels=environment=staging,region=us-central1, endpoint log
+        entries will have labels environment: staging and region: us-central1.
+        ''')
     parser.add_argument('--service_control_network_fail_policy',
         default='open',  choices=['open', 'close'], help='''
         Specify the policy to handle the request in case of network failures when
@@ -603,6 +829,32 @@ environment variable or by passing "-k" flag to this script.
         add padding. If this flag is true, the header will be padded.
         '''
     )
+    parser.add_argument(
+        '--jwt_payload_header',
+        default=None,
+        help='''The header to forward the JWT payload to backend in. By
+        default, it is `X-Endpoint-API-UserInfo`, following the prefix of
+        --generated_header_prefix.
+        '''
+    )
+    parser.add_argument(
+        '--jwt_allow_missing_or_failed_selectors',
+        default=None,
+        help='''Allow the requests without a JWT or with a JWT failing the
+        verification for the specified operations, multiple selectors are
+        separated by ','. The payload of a verified JWT is still forwarded to
+        the backend.
+        '''
+    )
+    parser.add_argument(
+        '--jwt_claim_requirements',
+        default=None,
+        help='''Require the claims of the verified JWT for the specified
+        operations, in the format of "selector1=CLAIM:VALUE,...;selector2=...",
+        e.g. "pkg.Service.Create=scope:shelves.write,hd:example.com". The
+        requests failing the requirements are rejected with 403.
+        '''
+    )
     parser.add_argument(
         '--http_request_timeout_s',
         default=None, type=int,
@@ -654,6 +906,86 @@ environment variable or by passing "-k" flag to this script.
         Set the retry times for service control Report request.
         Must be >= 0 and the default is 5 if not set.
         ''')
+    parser.add_argument(
+        '--telemetry_backend',
+        default=None,
+        choices=['servicecontrol', 'servicecontrol_compatible', 'noop'],
+        help='''
+        The provider of the check, quota and report calls. "servicecontrol"
+        is Google Service Control, the default. "servicecontrol_compatible" is
+        a self-hosted server compatible with the Service Control API at
+        --service_control_url, called without access token. "noop" makes no
+        check, quota and report calls at all.
+        ''')
+    parser.add_argument(
+        '--service_control_report_queue_max_size',
+        default=None,
+        help='''
+        Set the max number of service control Report requests pending in
+        memory. By default they are not limited.
+        ''')
+    parser.add_argument(
+        '--service_control_report_queue_drop_policy',
+        default=None,
+        choices=['DROP_NEWEST', 'DROP_OLDEST'],
+        help='''
+        The Report requests to drop when the report queue is full and they can
+        not be spilled to disk. The default is DROP_NEWEST.
+        ''')
+    parser.add_argument(
+        '--service_control_report_disk_spill_dir',
+        default=None,
+        help='''
+        If set, the Report requests are spilled to this directory when the
+        report queue is full, and sent once it has room again. The requests
+        spilled before a restart are sent after it. It requires
+        --service_control_report_queue_max_size.
+        ''')
+    parser.add_argument(
+        '--service_control_report_disk_spill_max_bytes',
+        default=None,
+        help='''
+        Set the max total bytes of the spilled Report requests. The default
+        is 64MiB.
+        ''')
+    parser.add_argument(
+        '--service_control_report_aggregation_entries',
+        default=None,
+        help='''
+        Set the max number of the aggregated service control Report
+        operations cached in memory. The default is 10000, 0 disables the
+        aggregation.
+        ''')
+    parser.add_argument(
+        '--service_control_report_aggregation_flush_interval_ms',
+        default=None,
+        help='''
+        Set the interval in millisecond to flush the aggregated service
+        control Report operations. The default is 1000. A longer interval
+        sends fewer Report requests at the cost of the report freshness.
+        ''')
+    parser.add_argument(
+        '--service_control_check_aggregation_entries',
+        default=None,
+        help='''
+        Set the max number of the service control Check responses cached in
+        memory. The default is 10000, 0 disables the cache.
+        ''')
+    parser.add_argument(
+        '--service_control_check_aggregation_flush_interval_ms',
+        default=None,
+        help='''
+        Set the interval in millisecond to refresh the cached service control
+        Check responses. The default is 60000.
+        ''')
+    parser.add_argument(
+        '--service_control_check_aggregation_expiration_ms',
+        default=None,
+        help='''
+        Set the time in millisecond the cached service control Check responses
+        are used for, e.g. how long a revoked API key is still accepted. The
+        default is 300000, and it must be longer than the flush interval.
+        ''')
     parser.add_argument(
         '--backend_retry_ons',
         default=None,
@@ -709,6 +1041,34 @@ environment variable or by passing "-k" flag to this script.
         https://www.envoyproxy.io/docs/envoy/latest/configuration/observability/access_log#default-format-string
         For the detailed format grammar, please refer to the following document.
         https://www.envoyproxy.io/docs/envoy/latest/configuration/observability/access_log#format-strings
+        If --access_log_json is enabled, it should be a JSON object mapping the
+        field names to the format strings.
+        '''
+    )
+    parser.add_argument(
+        '--access_log_json',
+        action='store_true',
+        default=False,
+        help='''
+        If true, the access log entries are written as JSON objects. If
+        --access_log_format is unset, the Envoy default fields are logged
+        together with the operation, whether an API key is presented and the
+        JWT issuer.
+        '''
+    )
+    parser.add_argument(
+        '--access_log_grpc_url',
+        help='''
+        The url of a gRPC Access Log Service (ALS) collector, in the format of
+        grpc://host:port, or grpcs://host:port with TLS. If set, the access log
+        entries are streamed to the collector.
+        '''
+    )
+    parser.add_argument(
+        '--access_log_grpc_log_name',
+        help='''
+        The log name of the access log entries streamed to the gRPC Access Log
+        Service collector. The default is "espv2".
         '''
     )
 
@@ -744,7 +1104,7 @@ environment variable or by passing "-k" flag to this script.
         '--tracing_incoming_context',
         default="",
         help='''
-        Comma separated incoming trace contexts (traceparent|grpc-trace-bin|x-cloud-trace-context).
+        Comma separated incoming trace contexts (traceparent|grpc-trace-bin|x-cloud-trace-context|b3).
         Note the order matters. Default is 'traceparent,x-cloud-trace-context'.
         
         See official documentation for more details:
@@ -754,7 +1114,7 @@ environment variable or by passing "-k" flag to this script.
         '--tracing_outgoing_context',
         default="",
         help='''
-        Comma separated outgoing trace contexts (traceparent|grpc-trace-bin|x-cloud-trace-context).
+        Comma separated outgoing trace contexts (traceparent|grpc-trace-bin|x-cloud-trace-context|b3).
         Note the order matters. Default is 'traceparent,x-cloud-trace-context'.
         
         See official documentation for more details:
@@ -793,7 +1153,24 @@ environment variable or by passing "-k" flag to this script.
         service management.  You can also set {creds_key} environment variable to
         the location of the service account credentials JSON file. If the option is
         omitted, the proxy contacts the metadata service to fetch an access token.
+        The ID tokens of the backend authentication are generated from the key
+        as well, so no metadata service is needed on bare metal, other clouds
+        or local machines.
         '''.format(creds_key=GOOGLE_CREDS_KEY))
+    parser.add_argument(
+        '--backend_auth_iam_service_account',
+        help='''
+        The service account to mint the ID tokens of the backend authentication
+        through the IAM Credentials generateIdToken API, instead of fetching
+        them from the metadata server. The proxy's own credentials must be
+        granted the Service Account Token Creator role on it.
+        ''')
+    parser.add_argument(
+        '--backend_auth_iam_delegates',
+        help='''
+        The comma separated delegation chain of service accounts to mint the ID
+        tokens through, with --backend_auth_iam_service_account.
+        ''')
 
     parser.add_argument(
         '--dns_resolver_addresses',
@@ -806,6 +1183,44 @@ environment variable or by passing "-k" flag to this script.
         If unset, will use the default resolver configured in /etc/resolv.conf.
         ''')
 
+    parser.add_argument(
+        '--google_api_proxy',
+        help='''
+        The HTTP proxy url, [http://]host[:port] or https://host[:port], of the
+        outbound calls to Service Management, Service Control, IAM and the JWKS
+        endpoints. Envoy tunnels its connections to them through the proxy by
+        CONNECT requests. The hosts in the NO_PROXY environment variable and
+        the metadata server bypass the proxy.
+        ''')
+
+    parser.add_argument(
+        '--compute_platform_override',
+        help='''
+        The platform reported to Google Service Control, e.g. "on-prem". By
+        default it is detected from the metadata server. Useful for hybrid or
+        on-prem deployments without the metadata server.
+        ''')
+    parser.add_argument(
+        '--compute_zone_override',
+        help='''
+        The zone reported to Google Service Control. By default it is fetched
+        from the metadata server. Cannot be used together with
+        --compute_region_override.
+        ''')
+    parser.add_argument(
+        '--compute_region_override',
+        help='''
+        The region reported to Google Service Control, for the regional
+        deployments. By default it is fetched from the metadata server. Cannot
+        be used together with --compute_zone_override.
+        ''')
+    parser.add_argument(
+        '--project_id_override',
+        help='''
+        The project id reported to Google Service Control. By default it is
+        fetched from the metadata server.
+        ''')
+
     parser.add_argument(
         '--backend_dns_lookup_family',
         default=None,
@@ -813,6 +1228,75 @@ environment variable or by passing "-k" flag to this script.
         help='''
         Define the dns lookup family for all backends. The options are "auto", "v4only" and "v6only". The default is "auto".
         ''')
+    parser.add_argument(
+        '--dns_lookup_family',
+        default=None,
+        choices=['auto', 'v4only', 'v6only'],
+        help='''
+        Define the dns lookup family for the clusters other than the backends,
+        e.g. the Google API, JWKS and metadata server clusters. The options are
+        "auto", "v4only" and "v6only". By default the Google API and JWKS
+        clusters use "v4only" and the others use "auto", set it to "v6only" or
+        "auto" to run in IPv6-only environments.
+        ''')
+    parser.add_argument(
+        '--backend_credentials',
+        default=None,
+        help='''
+        Attach a credential to the requests of the specified operations to
+        non-Google backends, instead of a Google ID token. Multiple credentials
+        are separated by ';'. A credential is comma separated fields, either a
+        static API key, e.g.
+        selector=type=api_key,header=x-api-key,key_file=/etc/keys/saas, or an
+        OAuth client credentials token fetched and refreshed by the config
+        manager, e.g.
+        selector=type=oauth2,token_url=https://example.com/token,client_id=proxy,client_secret_file=/etc/keys/secret,scopes=read write.
+        The header defaults to x-api-key and authorization respectively.
+        ''')
+    parser.add_argument(
+        '--backend_max_connections',
+        default=None,
+        help='''
+        The circuit breaker max number of connections to each backend
+        cluster. The default is the Envoy default of 1024.
+        ''')
+    parser.add_argument(
+        '--backend_max_pending_requests',
+        default=None,
+        help='''
+        The circuit breaker max number of requests waiting for a connection
+        to each backend cluster. The default is the Envoy default of 1024.
+        ''')
+    parser.add_argument(
+        '--backend_max_requests',
+        default=None,
+        help='''
+        The circuit breaker max number of concurrent requests to each backend
+        cluster. The default is the Envoy default of 1024.
+        ''')
+    parser.add_argument(
+        '--backend_max_retries',
+        default=None,
+        help='''
+        The circuit breaker max number of concurrent retries to each backend
+        cluster. The default is the Envoy default of 3.
+        ''')
+    parser.add_argument(
+        '--max_request_bytes',
+        default=None,
+        help='''
+        Reject the requests with the body larger than this number of bytes
+        with 413. The requests are buffered to be checked, so the streaming
+        gRPC methods are not limited. By default, the requests are not limited.
+        ''')
+    parser.add_argument(
+        '--operation_max_request_bytes',
+        default=None,
+        help='''
+        Override --max_request_bytes for the specified operations, 0 to not
+        limit them. Multiple limits are separated by ';', e.g.
+        "--operation_max_request_bytes=selector1=10485760;selector2=0".
+        ''')
     parser.add_argument('--enable_debug', action='store_true', default=False,
         help='''
         Enables a variety of debug features in both Config Manager and Envoy, such as:
@@ -841,7 +1325,9 @@ environment variable or by passing "-k" flag to this script.
         help='''Whether to preserve proto field names for grpc-json transcoding.
         By default protobuf will generate JSON field names using the json_name
         option, or lower camel case, in that order. Setting this flag will
-        preserve the original field names. Defaults to false''')
+        preserve the original field names. Request bodies are accepted with
+        either the JSON names or the original field names regardless of this
+        flag. Defaults to false''')
 
     parser.add_argument(
         '--transcoding_ignore_query_parameters', action=None,
@@ -868,6 +1354,14 @@ environment variable or by passing "-k" flag to this script.
         in grpc-json transcoding. This is to support HTML 2.0<https://tools.ietf.org/html/rfc1866#section-8.2.1>.
         Set this flag to true to disable this feature.
         ''')
+    parser.add_argument(
+        '--transcoding_status_overrides', default=None,
+        help='''
+        Override the HTTP statuses the gRPC error statuses of the backend are
+        transcoded to, in the format of
+        "selector1=CODE:STATUS[:RETRY_AFTER],...;selector2=...", e.g.
+        "pkg.Service.Create=ALREADY_EXISTS:409,RESOURCE_EXHAUSTED:429:30s".
+        ''')
     parser.add_argument(
         '--disallow_colon_in_wildcard_path_segment', action='store_true',
         help='''
@@ -902,8 +1396,20 @@ environment variable or by passing "-k" flag to this script.
         ===
         Backend Protocol. Overrides the protocol in --backend.
         Choices: [http1|http2|grpc].
-        Default value: http1.''',
+        Default value: http1.
+        To set the HTTP protocol of an http or https backend, use
+        --backend_http_protocol instead.''',
         choices=['http1', 'http2', 'grpc'])
+    parser.add_argument(
+        '--backend_http_protocol',
+        default=None,
+        help='''
+        The HTTP protocol of the http or https backend in --backend.
+        Choices: [http/1.1|h2|auto]. "auto" probes the backend when ESPv2
+        starts, and falls back to http/1.1 if it cannot be reached.
+        It is ignored for grpc and grpcs backends.
+        Default value: http/1.1.''',
+        choices=['http/1.1', 'h2', 'auto'])
 
     parser.add_argument('--http_port', default=None, type=int, help='''
         This flag is exactly same as --listener_port. It is added for
@@ -991,7 +1497,21 @@ def enforce_conflict_args(args):
           if args.service_json_path:
             return "Flag -R or --rollout_strategy must be fixed with --service_json_path."
 
+    if args.openapi_path:
+        if args.service_json_path:
+            return "Flag --openapi_path cannot be used together with --service_json_path."
+        if args.rollout_strategy and args.rollout_strategy != DEFAULT_ROLLOUT_STRATEGY:
+            return "Flag -R or --rollout_strategy must be fixed with --openapi_path."
+        if args.service_config_cache_path:
+            return "Flag --service_config_cache_path cannot be used together with --openapi_path."
+        if args.service:
+            return "Flag --service cannot be used together with --openapi_path."
+        if args.version:
+            return "Flag --version cannot be used together with --openapi_path."
+
     if args.service_json_path:
+        if args.service_config_cache_path:
+            return "Flag --service_config_cache_path cannot be used together with --service_json_path."
         if args.service:
             return "Flag --service cannot be used together with --service_json_path."
         if args.version:
@@ -1007,6 +1527,27 @@ def enforce_conflict_args(args):
     if not args.access_log and args.access_log_format:
         return "Flag --access_log_format has to be used together with --access_log."
 
+    if not args.access_log and args.access_log_json:
+        return "Flag --access_log_json has to be used together with --access_log."
+
+    if args.rollout_traffic_policy and args.rollout_strategy != "managed":
+        return "Flag --rollout_traffic_policy requires -R or --rollout_strategy to be managed."
+
+    if args.rollout_pubsub_subscription and args.rollout_strategy != "managed":
+        return "Flag --rollout_pubsub_subscription requires -R or --rollout_strategy to be managed."
+
+    if args.canary_fraction:
+        if args.rollout_strategy != "managed":
+            return "Flag --canary_fraction requires -R or --rollout_strategy to be managed."
+        if not args.status_port:
+            return "Flag --canary_fraction requires --status_port."
+
+    if args.watchdog_fail_healthz:
+        if not args.healthz:
+            return "Flag --watchdog_fail_healthz requires --healthz."
+        if not args.status_port:
+            return "Flag --watchdog_fail_healthz requires --status_port."
+
     if args.ssl_port and args.ssl_server_cert_path:
         return "Flag --ssl_port is going to be deprecated, please use --ssl_server_cert_path only."
     if args.tls_mutual_auth and (args.ssl_backend_client_cert_path or args.ssl_client_cert_path):
@@ -1033,11 +1574,27 @@ def enforce_conflict_args(args):
 
     if len(port_flags) > 1:
         return "Multiple port flags {} are not allowed, use only the --listener_port flag".format(",".join(port_flags))
+    elif args.listener_address and args.listener_uds_path:
+        return "Flag --listener_address cannot be used together with --listener_uds_path"
+    elif port_flags and args.listener_uds_path:
+        return "Flag --listener_uds_path cannot be used together with the port flag {}".format(port_flags[0])
     elif port_num < 1024:
         return "Port {} is a privileged port. " \
                "For security purposes, the ESPv2 container cannot bind to it. " \
                "Use any port above 1024 instead.".format(port_num)
 
+    if args.ssl_listener_port:
+        if not (args.ssl_server_cert_path or args.generate_self_signed_cert):
+            return "Flag --ssl_listener_port requires --ssl_server_cert_path or --generate_self_signed_cert."
+        if args.ssl_port or args.listener_uds_path:
+            return "Flag --ssl_listener_port cannot be used together with --ssl_port or --listener_uds_path."
+        if args.ssl_listener_port < 1024:
+            return "Port {} is a privileged port. " \
+                   "For security purposes, the ESPv2 container cannot bind to it. " \
+                   "Use any port above 1024 instead.".format(args.ssl_listener_port)
+    if args.https_redirect and not args.ssl_listener_port:
+        return "Flag --https_redirect requires --ssl_listener_port."
+
     if args.ssl_protocols and (args.ssl_minimum_protocol or args.ssl_maximum_protocol):
         return "Flag --ssl_protocols is going to be deprecated, please use --ssl_minimum_protocol and --ssl_maximum_protocol."
 
@@ -1050,6 +1607,17 @@ def enforce_conflict_args(args):
         return "Flag --dns_resolver_addresses cannot be used together with" \
                " together with --dns."
 
+    if args.backend_auth_iam_delegates and not args.backend_auth_iam_service_account:
+        return "Flag --backend_auth_iam_delegates requires the flag" \
+               " --backend_auth_iam_service_account to be used."
+
+    if args.compute_zone_override and args.compute_region_override:
+        return "Flag --compute_zone_override cannot be used together with" \
+               " --compute_region_override."
+
+    if args.compute_platform_override and args.on_serverless:
+        return "Flag --compute_platform_override cannot be used on serverless."
+
     if args.ssl_backend_client_cert_path and args.ssl_client_cert_path:
         return "Flag --ssl_client_cert_path is renamed to " \
                "--ssl_backend_client_cert_path, only use the latter flag."
@@ -1080,6 +1648,39 @@ def gen_proxy_config(args):
         "--rollout_strategy", args.rollout_strategy,
     ]
 
+    if args.rollout_traffic_policy:
+        proxy_conf.extend(["--rollout_traffic_policy", args.rollout_traffic_policy])
+
+    if args.rollout_pubsub_subscription:
+        proxy_conf.extend(["--rollout_pubsub_subscription",
+                           args.rollout_pubsub_subscription])
+
+    if args.service_config_cache_path:
+        proxy_conf.extend(["--service_config_cache_path",
+                           args.service_config_cache_path])
+
+    if args.startup_fetch_timeout:
+        proxy_conf.extend(["--startup_fetch_timeout",
+                           args.startup_fetch_timeout])
+
+    if args.canary_fraction:
+        proxy_conf.extend([
+            "--canary_fraction", args.canary_fraction,
+            "--canary_envoy_admin_url",
+            "http://127.0.0.1:{}".format(args.status_port),
+        ])
+        if args.canary_bake_period:
+            proxy_conf.extend(["--canary_bake_period", args.canary_bake_period])
+        if args.canary_max_error_rate_increase:
+            proxy_conf.extend(["--canary_max_error_rate_increase",
+                               args.canary_max_error_rate_increase])
+
+    if args.watchdog_fail_healthz:
+        proxy_conf.extend([
+            "--watchdog_envoy_admin_url",
+            "http://127.0.0.1:{}".format(args.status_port),
+        ])
+
     if "://" not in args.backend:
       proxy_conf.extend(["--backend_address", "http://" + args.backend])
     else:
@@ -1088,6 +1689,39 @@ def gen_proxy_config(args):
     if args.healthz:
       proxy_conf.extend(["--healthz", args.healthz])
 
+    if args.api_metadata_path:
+        proxy_conf.extend(["--api_metadata_path", args.api_metadata_path])
+
+    if args.enable_grpc_reflection:
+        proxy_conf.append("--enable_grpc_reflection")
+
+    if args.enable_grpc_web == 'false':
+        proxy_conf.append("--skip_grpc_web_filter")
+
+    if args.skip_transcoder_filter:
+        proxy_conf.append("--skip_transcoder_filter")
+
+    if args.skip_backend_auth_filter:
+        proxy_conf.append("--skip_backend_auth_filter")
+
+    if args.skip_jwt_authn_filter:
+        proxy_conf.append("--skip_jwt_authn_filter")
+
+    if args.skip_service_control_filter:
+        proxy_conf.append("--skip_service_control_filter")
+
+    if args.path_rewrite_filter != 'auto':
+        proxy_conf.extend(["--path_rewrite_filter", args.path_rewrite_filter])
+
+    if args.response_compression:
+        proxy_conf.extend(["--response_compression", args.response_compression])
+        if args.response_compression_min_content_length:
+            proxy_conf.extend(["--response_compression_min_content_length",
+                               args.response_compression_min_content_length])
+        if args.response_compression_content_types:
+            proxy_conf.extend(["--response_compression_content_types",
+                               args.response_compression_content_types])
+
     # The flag "--health_check_grpc_backend" can be independent of the flag "--healthz"
     # If the flag "--healthz" is not used, ESPv2 still periodically checks the gRPC backend. If its status
     # is not healthy, any requests routed to the backend will be replied with 503 right away.
@@ -1123,10 +1757,25 @@ def gen_proxy_config(args):
          proxy_conf.extend(["--jwks_fetch_retry_back_off_max_interval_ms", args.jwks_fetch_retry_back_off_max_interval_ms])
     if args.jwt_pad_forward_payload_header:
         proxy_conf.append("--jwt_pad_forward_payload_header")
+    if args.jwt_payload_header:
+        proxy_conf.extend(["--jwt_payload_header", args.jwt_payload_header])
+    if args.jwt_allow_missing_or_failed_selectors:
+        proxy_conf.extend(["--jwt_allow_missing_or_failed_selectors", args.jwt_allow_missing_or_failed_selectors])
+    if args.jwt_claim_requirements:
+        proxy_conf.extend(["--jwt_claim_requirements", args.jwt_claim_requirements])
 
     if args.management:
         proxy_conf.extend(["--service_management_url", args.management])
 
+    if args.service_control_url:
+        proxy_conf.extend(["--service_control_url", args.service_control_url])
+
+    if args.service_management_failover_urls:
+        proxy_conf.extend(["--service_management_failover_urls", args.service_management_failover_urls])
+
+    if args.service_control_failover_urls:
+        proxy_conf.extend(["--service_control_failover_urls", args.service_control_failover_urls])
+
     if args.log_request_headers:
         proxy_conf.extend(["--log_request_headers", args.log_request_headers])
 
@@ -1136,6 +1785,9 @@ def gen_proxy_config(args):
     if args.log_jwt_payloads:
         proxy_conf.extend(["--log_jwt_payloads", args.log_jwt_payloads])
 
+    if args.log_labels:
+        proxy_conf.extend(["--log_labels", args.log_labels])
+
     if args.http_port:
         proxy_conf.extend(["--listener_port", str(args.http_port)])
     if args.http2_port:
@@ -1149,6 +1801,14 @@ def gen_proxy_config(args):
     if args.ssl_port:
         proxy_conf.extend(["--ssl_server_cert_path", "/etc/nginx/ssl"])
         proxy_conf.extend(["--listener_port", str(args.ssl_port)])
+    if args.listener_address:
+        proxy_conf.extend(["--listener_address", args.listener_address])
+    if args.listener_uds_path:
+        proxy_conf.extend(["--listener_uds_path", args.listener_uds_path])
+    if args.ssl_listener_port:
+        proxy_conf.extend(["--ssl_listener_port", str(args.ssl_listener_port)])
+    if args.https_redirect:
+        proxy_conf.append("--https_redirect")
 
     if args.ssl_backend_client_cert_path:
         proxy_conf.extend(["--ssl_backend_client_cert_path", str(args.ssl_backend_client_cert_path)])
@@ -1232,6 +1892,63 @@ def gen_proxy_config(args):
             args.service_control_report_retries
         ])
 
+    if args.telemetry_backend:
+        proxy_conf.extend(["--telemetry_backend", args.telemetry_backend])
+
+    if args.service_control_report_queue_max_size:
+        proxy_conf.extend([
+            "--service_control_report_queue_max_size",
+            args.service_control_report_queue_max_size
+        ])
+
+    if args.service_control_report_queue_drop_policy:
+        proxy_conf.extend([
+            "--service_control_report_queue_drop_policy",
+            args.service_control_report_queue_drop_policy
+        ])
+
+    if args.service_control_report_disk_spill_dir:
+        proxy_conf.extend([
+            "--service_control_report_disk_spill_dir",
+            args.service_control_report_disk_spill_dir
+        ])
+
+    if args.service_control_report_disk_spill_max_bytes:
+        proxy_conf.extend([
+            "--service_control_report_disk_spill_max_bytes",
+            args.service_control_report_disk_spill_max_bytes
+        ])
+
+    if args.service_control_report_aggregation_entries:
+        proxy_conf.extend([
+            "--service_control_report_aggregation_entries",
+            args.service_control_report_aggregation_entries
+        ])
+
+    if args.service_control_report_aggregation_flush_interval_ms:
+        proxy_conf.extend([
+            "--service_control_report_aggregation_flush_interval_ms",
+            args.service_control_report_aggregation_flush_interval_ms
+        ])
+
+    if args.service_control_check_aggregation_entries:
+        proxy_conf.extend([
+            "--service_control_check_aggregation_entries",
+            args.service_control_check_aggregation_entries
+        ])
+
+    if args.service_control_check_aggregation_flush_interval_ms:
+        proxy_conf.extend([
+            "--service_control_check_aggregation_flush_interval_ms",
+            args.service_control_check_aggregation_flush_interval_ms
+        ])
+
+    if args.service_control_check_aggregation_expiration_ms:
+        proxy_conf.extend([
+            "--service_control_check_aggregation_expiration_ms",
+            args.service_control_check_aggregation_expiration_ms
+        ])
+
     if args.service_control_check_timeout_ms:
         proxy_conf.extend([
             "--service_control_check_timeout_ms",
@@ -1259,6 +1976,8 @@ def gen_proxy_config(args):
 
     if args.service_json_path:
         proxy_conf.extend(["--service_json_path", args.service_json_path])
+    if args.openapi_path:
+        proxy_conf.extend(["--openapi_path", args.openapi_path])
 
     if args.check_metadata:
         proxy_conf.append("--check_metadata")
@@ -1288,6 +2007,14 @@ def gen_proxy_config(args):
     if args.access_log_format:
         proxy_conf.extend(["--access_log_format",
                            args.access_log_format])
+    if args.access_log_json:
+        proxy_conf.append("--access_log_json")
+    if args.access_log_grpc_url:
+        proxy_conf.extend(["--access_log_grpc_url",
+                           args.access_log_grpc_url])
+    if args.access_log_grpc_log_name:
+        proxy_conf.extend(["--access_log_grpc_log_name",
+                           args.access_log_grpc_log_name])
 
     if args.disable_tracing:
         proxy_conf.append("--disable_tracing")
@@ -1329,17 +2056,67 @@ def gen_proxy_config(args):
     if args.transcoding_query_parameters_disable_unescape_plus:
         proxy_conf.append("--transcoding_query_parameters_disable_unescape_plus")
 
+    if args.transcoding_status_overrides:
+        proxy_conf.extend(["--transcoding_status_overrides",
+                           args.transcoding_status_overrides])
+
     if args.disallow_colon_in_wildcard_path_segment:
         proxy_conf.append("--disallow_colon_in_wildcard_path_segment")
 
     if args.on_serverless:
         proxy_conf.extend([
             "--compute_platform_override", SERVERLESS_PLATFORM])
+    if args.compute_platform_override:
+        proxy_conf.extend(
+            ["--compute_platform_override", args.compute_platform_override])
+    if args.compute_zone_override:
+        proxy_conf.extend(
+            ["--compute_zone_override", args.compute_zone_override])
+    if args.compute_region_override:
+        proxy_conf.extend(
+            ["--compute_region_override", args.compute_region_override])
+    if args.project_id_override:
+        proxy_conf.extend(["--project_id_override", args.project_id_override])
+
+    if args.backend_http_protocol:
+        proxy_conf.extend(
+            ["--backend_http_protocol", args.backend_http_protocol])
 
     if args.backend_dns_lookup_family:
         proxy_conf.extend(
             ["--backend_dns_lookup_family", args.backend_dns_lookup_family])
 
+    if args.dns_lookup_family:
+        proxy_conf.extend(["--dns_lookup_family", args.dns_lookup_family])
+
+    if args.backend_credentials:
+        proxy_conf.extend(["--backend_credentials", args.backend_credentials])
+
+    if args.backend_max_connections:
+        proxy_conf.extend(
+            ["--backend_max_connections", args.backend_max_connections])
+    if args.backend_max_pending_requests:
+        proxy_conf.extend(
+            ["--backend_max_pending_requests", args.backend_max_pending_requests])
+    if args.backend_max_requests:
+        proxy_conf.extend(
+            ["--backend_max_requests", args.backend_max_requests])
+    if args.backend_max_retries:
+        proxy_conf.extend(
+            ["--backend_max_retries", args.backend_max_retries])
+    if args.max_request_bytes:
+        proxy_conf.extend(["--max_request_bytes", args.max_request_bytes])
+    if args.operation_max_request_bytes:
+        proxy_conf.extend(["--operation_max_request_bytes",
+                           args.operation_max_request_bytes])
+
+    if args.backend_auth_iam_service_account:
+        proxy_conf.extend(["--backend_auth_iam_service_account",
+                           args.backend_auth_iam_service_account])
+    if args.backend_auth_iam_delegates:
+        proxy_conf.extend(["--backend_auth_iam_delegates",
+                           args.backend_auth_iam_delegates])
+
     if args.dns_resolver_addresses:
         proxy_conf.extend(
             ["--dns_resolver_addresses", args.dns_resolver_addresses])
@@ -1347,6 +2124,8 @@ def gen_proxy_config(args):
         proxy_conf.extend(
             ["--dns_resolver_addresses", args.dns]
         )
+    if args.google_api_proxy:
+        proxy_conf.extend(["--google_api_proxy", args.google_api_proxy])
 
     if args.envoy_use_remote_address:
         proxy_conf.append("--envoy_use_remote_address")
@@ -1370,6 +2149,9 @@ def gen_proxy_config(args):
         ])
         if args.cors_allow_credentials:
             proxy_conf.append("--cors_allow_credentials")
+        if args.grpc_web_expose_trailers:
+            proxy_conf.extend(["--grpc_web_expose_trailers",
+                               args.grpc_web_expose_trailers])
 
     # Set credentials file from the environment variable
     if args.service_account_key is None and GOOGLE_CREDS_KEY in os.environ:
@@ -11,14 +11,23 @@
 EXTENSIONS = {
     # All extensions explicitly referenced by config generator and our tests.
     "envoy.access_loggers.file": "//source/extensions/access_loggers/file:config",
+    "envoy.compression.brotli.compressor": "//source/extensions/compression/brotli/compressor:config",
+    "envoy.compression.gzip.compressor": "//source/extensions/compression/gzip/compressor:config",
+    "envoy.filters.http.buffer": "//source/extensions/filters/http/buffer:config",
+    "envoy.filters.http.compressor": "//source/extensions/filters/http/compressor:config",
     "envoy.filters.http.cors": "//source/extensions/filters/http/cors:config",
     "envoy.filters.http.grpc_json_transcoder": "//source/extensions/filters/http/grpc_json_transcoder:config",
     "envoy.filters.http.grpc_web": "//source/extensions/filters/http/grpc_web:config",
     "envoy.filters.http.health_check": "//source/extensions/filters/http/health_check:config",
     "envoy.filters.http.jwt_authn": "//source/extensions/filters/http/jwt_authn:config",
+    "envoy.filters.http.lua": "//source/extensions/filters/http/lua:config",
+    "envoy.filters.http.rbac": "//source/extensions/filters/http/rbac:config",
     "envoy.filters.http.router": "//source/extensions/filters/http/router:config",
     "envoy.filters.network.http_connection_manager": "//source/extensions/filters/network/http_connection_manager:config",
+    "envoy.filters.network.tcp_proxy": "//source/extensions/filters/network/tcp_proxy:config",
+    "envoy.stat_sinks.dog_statsd": "//source/extensions/stat_sinks/dog_statsd:config",
     "envoy.tracers.opencensus": "//source/extensions/tracers/opencensus:config",
+    "envoy.tracers.zipkin": "//source/extensions/tracers/zipkin:config",
 
     # Implicitly needed for TLS config.
     "envoy.transport_sockets.raw_buffer": "//source/extensions/transport_sockets/raw_buffer:config",
@@ -834,6 +834,11 @@ void FillLogEntry(const ReportRequestInfo& info, const std::string& name,
     log_entry->set_trace(TraceResourceName(info.trace_id, info.project_id));
   }
 
+  // Add the custom labels.
+  for (const auto& label : info.log_labels) {
+    (*log_entry->mutable_labels())[label.first] = label.second;
+  }
+
   // Fill in http request.
   auto* http_request = log_entry->mutable_http_request();
   http_request->set_protocol(protocol::ToString(info.frontend_protocol));
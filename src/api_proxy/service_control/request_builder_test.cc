@@ -462,6 +462,23 @@ TEST_F(RequestBuilderTest, CredentailIdIssuerAudienceTest) {
             "jwtauth:issuer=YXV0aC1pc3N1ZXI&audience=YXV0aC1hdWRpZW5jZQ");
 }
 
+TEST_F(RequestBuilderTest, ReportLogLabelsTest) {
+  ReportRequestInfo info;
+  FillOperationInfo(&info);
+  info.log_labels["environment"] = "staging";
+  info.log_labels["region"] = "us-central1";
+
+  gasv1::ReportRequest request;
+  ASSERT_TRUE(scp_.FillReportRequest(info, &request).ok());
+
+  // The custom labels are only added to the log entry.
+  ASSERT_FALSE(request.operations(0).labels().contains("environment"));
+  const gasv1::LogEntry log_entry = request.operations(0).log_entries(0);
+  ASSERT_EQ(log_entry.labels().size(), 2);
+  ASSERT_EQ(log_entry.labels().at("environment"), "staging");
+  ASSERT_EQ(log_entry.labels().at("region"), "us-central1");
+}
+
 }  // namespace
 
 }  // namespace service_control
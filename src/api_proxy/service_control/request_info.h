@@ -15,6 +15,7 @@
 #pragma once
 
 #include <chrono>
+#include <map>
 #include <memory>
 #include <string>
 
@@ -258,6 +259,9 @@ struct ReportRequestInfo : public OperationInfo {
   // The jwt payloads logged
   std::string jwt_payloads;
 
+  // The custom labels of the log entries.
+  std::map<std::string, std::string> log_labels;
+
   // The response code detail.
   std::string response_code_detail;
 
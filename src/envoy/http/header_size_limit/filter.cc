@@ -0,0 +1,73 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include "src/envoy/http/header_size_limit/filter.h"
+
+#include <string>
+
+#include "absl/strings/str_cat.h"
+#include "source/common/http/utility.h"
+#include "src/envoy/utils/rc_detail_utils.h"
+
+namespace espv2 {
+namespace envoy {
+namespace http_filters {
+namespace header_size_limit {
+
+using Envoy::Http::FilterHeadersStatus;
+using Envoy::Http::RequestHeaderMap;
+
+FilterHeadersStatus Filter::decodeHeaders(RequestHeaderMap& headers, bool) {
+  auto route = decoder_callbacks_->route();
+  if (route == nullptr || route->routeEntry() == nullptr) {
+    return FilterHeadersStatus::Continue;
+  }
+
+  const auto* per_route =
+      ::Envoy::Http::Utility::resolveMostSpecificPerFilterConfig<
+          PerRouteFilterConfig>(kFilterName, route);
+  if (per_route == nullptr) {
+    ENVOY_LOG(debug,
+              "no per-route config, the request headers are not limited");
+    return FilterHeadersStatus::Continue;
+  }
+
+  // The headers added by the preceding filters, like the backend auth token,
+  // are counted too.
+  const uint64_t size = headers.byteSize();
+  if (size > per_route->max_request_headers_bytes()) {
+    config_->stats().denied_by_oversize_headers_.inc();
+    const std::string error_msg =
+        absl::StrCat("Request headers of ", size,
+                     " bytes exceed the limit of the backend, max allowed "
+                     "size is ",
+                     per_route->max_request_headers_bytes(), " bytes.");
+    ENVOY_LOG(debug, "{}", error_msg);
+    decoder_callbacks_->sendLocalReply(
+        Envoy::Http::Code::RequestHeaderFieldsTooLarge, error_msg, nullptr,
+        absl::nullopt,
+        utils::generateRcDetails(utils::kRcDetailFilterHeaderSizeLimit,
+                                 utils::kRcDetailErrorTypeBadRequest,
+                                 utils::kRcDetailErrorOversizeHeaders));
+    return FilterHeadersStatus::StopIteration;
+  }
+
+  config_->stats().allowed_.inc();
+  return FilterHeadersStatus::Continue;
+}
+
+}  // namespace header_size_limit
+}  // namespace http_filters
+}  // namespace envoy
+}  // namespace espv2
@@ -0,0 +1,84 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#pragma once
+
+#include "api/envoy/v10/http/header_size_limit/config.pb.h"
+#include "envoy/router/router.h"
+#include "envoy/stats/scope.h"
+#include "envoy/stats/stats_macros.h"
+
+namespace espv2 {
+namespace envoy {
+namespace http_filters {
+namespace header_size_limit {
+
+// The filter name.
+constexpr const char kFilterName[] =
+    "com.google.espv2.filters.http.header_size_limit";
+
+/**
+ * All stats for the header size limit filter. @see stats_macros.h
+ */
+#define ALL_HEADER_SIZE_LIMIT_FILTER_STATS(COUNTER) \
+  COUNTER(allowed)                                  \
+  COUNTER(denied_by_oversize_headers)
+
+/**
+ * Wrapper struct for header size limit filter stats. @see stats_macros.h
+ */
+struct FilterStats {
+  ALL_HEADER_SIZE_LIMIT_FILTER_STATS(GENERATE_COUNTER_STRUCT)
+};
+
+class FilterConfig {
+ public:
+  FilterConfig(const std::string& stats_prefix, Envoy::Stats::Scope& scope)
+      : stats_(generateStats(stats_prefix, scope)) {}
+
+  FilterStats& stats() { return stats_; }
+
+ private:
+  FilterStats generateStats(const std::string& prefix,
+                            Envoy::Stats::Scope& scope) {
+    const std::string final_prefix = prefix + "header_size_limit.";
+    return {ALL_HEADER_SIZE_LIMIT_FILTER_STATS(
+        POOL_COUNTER_PREFIX(scope, final_prefix))};
+  }
+
+  FilterStats stats_;
+};
+
+using FilterConfigSharedPtr = std::shared_ptr<FilterConfig>;
+
+class PerRouteFilterConfig : public Envoy::Router::RouteSpecificFilterConfig {
+ public:
+  PerRouteFilterConfig(
+      const ::espv2::api::envoy::v10::http::header_size_limit::
+          PerRouteFilterConfig& per_route)
+      : max_request_headers_bytes_(
+            static_cast<uint64_t>(per_route.max_request_headers_kb()) * 1024) {}
+
+  uint64_t max_request_headers_bytes() const {
+    return max_request_headers_bytes_;
+  }
+
+ private:
+  const uint64_t max_request_headers_bytes_;
+};
+
+}  // namespace header_size_limit
+}  // namespace http_filters
+}  // namespace envoy
+}  // namespace espv2
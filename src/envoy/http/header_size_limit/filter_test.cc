@@ -0,0 +1,127 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include "src/envoy/http/header_size_limit/filter.h"
+
+#include "gmock/gmock.h"
+#include "gtest/gtest.h"
+#include "test/mocks/http/mocks.h"
+#include "test/mocks/router/mocks.h"
+#include "test/mocks/server/mocks.h"
+#include "test/test_common/utility.h"
+
+using ::testing::_;
+using ::testing::NiceMock;
+using ::testing::Return;
+
+namespace espv2 {
+namespace envoy {
+namespace http_filters {
+namespace header_size_limit {
+namespace {
+
+class FilterTest : public ::testing::Test {
+ protected:
+  void SetUp() override {
+    filter_config_ = std::make_shared<FilterConfig>("", scope_);
+    mock_route_ = std::make_shared<NiceMock<Envoy::Router::MockRoute>>();
+
+    filter_ = std::make_unique<Filter>(filter_config_);
+    filter_->setDecoderFilterCallbacks(mock_decoder_callbacks_);
+
+    ::espv2::api::envoy::v10::http::header_size_limit::PerRouteFilterConfig
+        per_route;
+    per_route.set_max_request_headers_kb(1);
+    per_route_config_ = std::make_shared<PerRouteFilterConfig>(per_route);
+
+    ON_CALL(mock_decoder_callbacks_, route())
+        .WillByDefault(Return(mock_route_));
+    ON_CALL(*mock_route_, mostSpecificPerFilterConfig(kFilterName))
+        .WillByDefault(Return(per_route_config_.get()));
+  }
+
+  uint64_t counterValue(const std::string& name) {
+    const Envoy::Stats::CounterSharedPtr counter =
+        Envoy::TestUtility::findCounter(scope_, name);
+    EXPECT_NE(counter, nullptr);
+    return counter == nullptr ? 0 : counter->value();
+  }
+
+  NiceMock<Envoy::Stats::MockIsolatedStatsStore> scope_;
+  std::shared_ptr<FilterConfig> filter_config_;
+  NiceMock<Envoy::Http::MockStreamDecoderFilterCallbacks>
+      mock_decoder_callbacks_;
+  std::shared_ptr<NiceMock<Envoy::Router::MockRoute>> mock_route_;
+  std::unique_ptr<Filter> filter_;
+  std::shared_ptr<PerRouteFilterConfig> per_route_config_;
+};
+
+TEST_F(FilterTest, NoRouteAllowed) {
+  Envoy::Http::TestRequestHeaderMapImpl headers{
+      {":method", "GET"},
+      {":path", "/books/1"},
+      {"x-big", std::string(2000, 'a')}};
+  EXPECT_CALL(mock_decoder_callbacks_, route()).WillOnce(Return(nullptr));
+  EXPECT_CALL(mock_decoder_callbacks_, sendLocalReply(_, _, _, _, _)).Times(0);
+
+  EXPECT_EQ(filter_->decodeHeaders(headers, false),
+            Envoy::Http::FilterHeadersStatus::Continue);
+}
+
+TEST_F(FilterTest, NoPerRouteConfigAllowed) {
+  Envoy::Http::TestRequestHeaderMapImpl headers{
+      {":method", "GET"},
+      {":path", "/books/1"},
+      {"x-big", std::string(2000, 'a')}};
+  EXPECT_CALL(*mock_route_, mostSpecificPerFilterConfig(kFilterName))
+      .WillRepeatedly(Return(nullptr));
+  EXPECT_CALL(mock_decoder_callbacks_, sendLocalReply(_, _, _, _, _)).Times(0);
+
+  EXPECT_EQ(filter_->decodeHeaders(headers, false),
+            Envoy::Http::FilterHeadersStatus::Continue);
+}
+
+TEST_F(FilterTest, HeadersWithinLimitAllowed) {
+  Envoy::Http::TestRequestHeaderMapImpl headers{{":method", "GET"},
+                                                {":path", "/books/1"}};
+  EXPECT_CALL(mock_decoder_callbacks_, sendLocalReply(_, _, _, _, _)).Times(0);
+
+  EXPECT_EQ(filter_->decodeHeaders(headers, false),
+            Envoy::Http::FilterHeadersStatus::Continue);
+  EXPECT_EQ(counterValue("header_size_limit.allowed"), 1);
+}
+
+TEST_F(FilterTest, OversizeHeadersRejected) {
+  // 10 + 13 + 1005 bytes.
+  Envoy::Http::TestRequestHeaderMapImpl headers{
+      {":method", "GET"},
+      {":path", "/books/1"},
+      {"x-big", std::string(1000, 'a')}};
+  EXPECT_CALL(mock_decoder_callbacks_,
+              sendLocalReply(
+                  Envoy::Http::Code::RequestHeaderFieldsTooLarge,
+                  "Request headers of 1028 bytes exceed the limit of the "
+                  "backend, max allowed size is 1024 bytes.",
+                  _, _, "header_size_limit_bad_request{OVERSIZE_HEADERS}"));
+
+  EXPECT_EQ(filter_->decodeHeaders(headers, false),
+            Envoy::Http::FilterHeadersStatus::StopIteration);
+  EXPECT_EQ(counterValue("header_size_limit.denied_by_oversize_headers"), 1);
+}
+
+}  // namespace
+}  // namespace header_size_limit
+}  // namespace http_filters
+}  // namespace envoy
+}  // namespace espv2
@@ -24,7 +24,9 @@ namespace envoy {
 namespace http_filters {
 namespace service_control {
 
+using ::espv2::api::envoy::v10::http::common::HttpUri;
 using ::espv2::api::envoy::v10::http::service_control::FilterConfig;
+using ::espv2::api::envoy::v10::http::service_control::ReportQueueConfig;
 using ::google::protobuf::util::OkStatus;
 using ::google::protobuf::util::Status;
 using ::google::protobuf::util::StatusCode;
@@ -91,10 +93,11 @@ api_proxy::service_control::ScResponseError failCallStatusToScResponseError(
 }
 
 // Generates CheckAggregationOptions.
-CheckAggregationOptions getCheckAggregationOptions() {
-  return CheckAggregationOptions(kCheckAggregationEntries,
-                                 kCheckAggregationFlushIntervalMs,
-                                 kCheckAggregationExpirationMs);
+CheckAggregationOptions getCheckAggregationOptions(uint32_t num_entries,
+                                                   uint32_t flush_interval_ms,
+                                                   uint32_t expiration_ms) {
+  return CheckAggregationOptions(num_entries, flush_interval_ms,
+                                 expiration_ms);
 }
 
 // Generates QuotaAggregationOptions.
@@ -104,9 +107,9 @@ QuotaAggregationOptions getQuotaAggregationOptions() {
 }
 
 // Generates ReportAggregationOptions.
-ReportAggregationOptions getReportAggregationOptions() {
-  return ReportAggregationOptions(kReportAggregationEntries,
-                                  kReportAggregationFlushIntervalMs);
+ReportAggregationOptions getReportAggregationOptions(
+    uint32_t num_entries, uint32_t flush_interval_ms) {
+  return ReportAggregationOptions(num_entries, flush_interval_ms);
 }
 
 // A timer object to wrap PeriodicTimer
@@ -174,6 +177,11 @@ void ClientCache::initHttpRequestSetting(const FilterConfig& filter_config) {
     check_retries_ = kCheckDefaultNumberOfRetries;
     quota_retries_ = kAllocateQuotaDefaultNumberOfRetries;
     report_retries_ = kReportDefaultNumberOfRetries;
+    report_aggregation_entries_ = kReportAggregationEntries;
+    report_aggregation_flush_interval_ms_ = kReportAggregationFlushIntervalMs;
+    check_aggregation_entries_ = kCheckAggregationEntries;
+    check_aggregation_flush_interval_ms_ = kCheckAggregationFlushIntervalMs;
+    check_aggregation_expiration_ms_ = kCheckAggregationExpirationMs;
     return;
   }
   const auto& sc_calling_config = filter_config.sc_calling_config();
@@ -199,6 +207,34 @@ void ClientCache::initHttpRequestSetting(const FilterConfig& filter_config) {
   report_retries_ = sc_calling_config.has_report_retries()
                         ? sc_calling_config.report_retries().value()
                         : kReportDefaultNumberOfRetries;
+
+  report_aggregation_entries_ =
+      sc_calling_config.has_report_aggregation_entries()
+          ? sc_calling_config.report_aggregation_entries().value()
+          : kReportAggregationEntries;
+  report_aggregation_flush_interval_ms_ =
+      sc_calling_config.has_report_aggregation_flush_interval_ms()
+          ? sc_calling_config.report_aggregation_flush_interval_ms().value()
+          : kReportAggregationFlushIntervalMs;
+
+  check_aggregation_entries_ =
+      sc_calling_config.has_check_aggregation_entries()
+          ? sc_calling_config.check_aggregation_entries().value()
+          : kCheckAggregationEntries;
+  check_aggregation_flush_interval_ms_ =
+      sc_calling_config.has_check_aggregation_flush_interval_ms()
+          ? sc_calling_config.check_aggregation_flush_interval_ms().value()
+          : kCheckAggregationFlushIntervalMs;
+  check_aggregation_expiration_ms_ =
+      sc_calling_config.has_check_aggregation_expiration_ms()
+          ? sc_calling_config.check_aggregation_expiration_ms().value()
+          : kCheckAggregationExpirationMs;
+
+  if (sc_calling_config.has_report_queue()) {
+    const auto& report_queue = sc_calling_config.report_queue();
+    max_pending_reports_ = report_queue.max_pending_reports();
+    report_drop_policy_ = report_queue.drop_policy();
+  }
 }
 
 void ClientCache::collectCallStatus(CallStatusStats& call_stats,
@@ -212,30 +248,44 @@ ClientCache::ClientCache(
     Envoy::Stats::Scope& scope, Envoy::Upstream::ClusterManager& cm,
     Envoy::TimeSource& time_source, Envoy::Event::Dispatcher& dispatcher,
     std::function<const std::string&()> sc_token_fn,
-    std::function<const std::string&()> quota_token_fn)
+    std::function<const std::string&()> quota_token_fn,
+    ReportSpillSharedPtr report_spill)
     : config_(config),
       filter_stats_(ServiceControlFilterStats::create(stats_prefix, scope)),
+      report_spill_(report_spill),
+      dispatcher_(dispatcher),
       time_source_(time_source) {
-  ServiceControlClientOptions options(getCheckAggregationOptions(),
-                                      getQuotaAggregationOptions(),
-                                      getReportAggregationOptions());
-
   initHttpRequestSetting(filter_config);
+  ServiceControlClientOptions options(
+      getCheckAggregationOptions(check_aggregation_entries_,
+                                 check_aggregation_flush_interval_ms_,
+                                 check_aggregation_expiration_ms_),
+      getQuotaAggregationOptions(),
+      getReportAggregationOptions(report_aggregation_entries_,
+                                  report_aggregation_flush_interval_ms_));
+
+  if (filter_config.access_token_case() == FilterConfig::kNoAccessToken) {
+    sc_token_fn = nullptr;
+    quota_token_fn = nullptr;
+  }
+  const std::vector<HttpUri> failover_uris(
+      filter_config.service_control_failover_uris().begin(),
+      filter_config.service_control_failover_uris().end());
   check_call_factory_ = std::make_unique<HttpCallFactoryImpl>(
       cm, dispatcher, filter_config.service_control_uri(),
       absl::StrCat("/", config_.service_name(), ":check"), sc_token_fn,
       check_timeout_ms_, check_retries_, time_source,
-      "Service Control remote call: Check");
+      "Service Control remote call: Check", failover_uris);
   quota_call_factory_ = std::make_unique<HttpCallFactoryImpl>(
       cm, dispatcher, filter_config.service_control_uri(),
       absl::StrCat("/", config_.service_name(), ":allocateQuota"),
       quota_token_fn, quota_timeout_ms_, quota_retries_, time_source,
-      "Service Control remote call: Allocate Quota");
+      "Service Control remote call: Allocate Quota", failover_uris);
   report_call_factory_ = std::make_unique<HttpCallFactoryImpl>(
       cm, dispatcher, filter_config.service_control_uri(),
       absl::StrCat("/", config_.service_name(), ":report"), sc_token_fn,
       report_timeout_ms_, report_retries_, time_source,
-      "Service Control remote call: Report");
+      "Service Control remote call: Report", failover_uris);
 
   // Note: Check transport is also defined per request.
   // But this must be defined, it will be called on each flush of the cache
@@ -278,19 +328,23 @@ ClientCache::ClientCache(
   options.report_transport = [this](const ReportRequest& request,
                                     ReportResponse* response,
                                     TransportDoneFunc on_done) {
-    // Don't support tracing on this transport
-    auto& null_span = Envoy::Tracing::NullSpan::instance();
-    auto* call = report_call_factory_->createHttpCall(
-        request, null_span,
-        [this, response, on_done](const Status& status,
-                                  const std::string& body) {
-          Status final_status = processScCallTransportStatus<ReportResponse>(
-              status, response, body);
-          collectCallStatus(filter_stats_.report_, final_status.code());
+    if (max_pending_reports_ > 0 &&
+        pending_reports_.size() >= max_pending_reports_) {
+      if (spillReport(request)) {
+        on_done(OkStatus());
+        return;
+      }
 
-          on_done(final_status);
-        });
-    call->call();
+      filter_stats_.filter_.report_dropped_.inc();
+      if (report_drop_policy_ == ReportQueueConfig::DROP_NEWEST) {
+        on_done(Status(StatusCode::kResourceExhausted,
+                       std::string("Report queue is full")));
+        return;
+      }
+      // The cancelled call removes itself from the queue.
+      pending_reports_.front()->cancel();
+    }
+    sendReport(request, response, on_done);
   };
 
   options.periodic_timer = [&dispatcher](int interval_ms,
@@ -302,6 +356,81 @@ ClientCache::ClientCache(
 
   client_ = ::google::service_control_client::CreateServiceControlClient(
       config_.service_name(), config_.service_config_id(), options);
+
+  // Replay the Report calls spilled by the previous runs.
+  drainSpilledReports();
+}
+
+ClientCache::~ClientCache() {
+  // Flush the cached Report calls while the report queue is still alive. The
+  // ones spilled to disk are kept for the next run.
+  client_.reset();
+}
+
+void ClientCache::sendReport(const ReportRequest& request,
+                             ReportResponse* response,
+                             TransportDoneFunc on_done) {
+  // Don't support tracing on this transport
+  auto& null_span = Envoy::Tracing::NullSpan::instance();
+  auto it = pending_reports_.insert(pending_reports_.end(), nullptr);
+  auto* call = report_call_factory_->createHttpCall(
+      request, null_span,
+      [this, it, response, on_done](const Status& status,
+                                    const std::string& body) {
+        pending_reports_.erase(it);
+        Status final_status = processScCallTransportStatus<ReportResponse>(
+            status, response, body);
+        collectCallStatus(filter_stats_.report_, final_status.code());
+
+        on_done(final_status);
+
+        // Only resume the spilled Report calls once Service Control is
+        // reachable again.
+        if (final_status.ok()) {
+          drainSpilledReports();
+        }
+      });
+  *it = call;
+  call->call();
+}
+
+bool ClientCache::spillReport(const ReportRequest& request) {
+  if (report_spill_ == nullptr || !report_spill_->spill(request)) {
+    return false;
+  }
+  filter_stats_.filter_.report_spilled_.inc();
+  return true;
+}
+
+void ClientCache::drainSpilledReports() {
+  if (report_spill_ == nullptr || loading_spilled_reports_ ||
+      pending_reports_.size() >= max_pending_reports_) {
+    return;
+  }
+
+  // The files are read on the spill thread.
+  loading_spilled_reports_ = true;
+  std::weak_ptr<bool> alive = alive_;
+  report_spill_->load(
+      max_pending_reports_ - pending_reports_.size(), dispatcher_,
+      [this, alive](std::vector<ReportRequest> requests) {
+        if (alive.expired()) {
+          return;
+        }
+        loading_spilled_reports_ = false;
+        for (const auto& request : requests) {
+          auto* response = new ReportResponse;
+          // Spill the Report call again if Service Control is still not
+          // reachable, e.g. when replayed on startup.
+          sendReport(request, response,
+                     [this, request, response](const Status& status) {
+                       delete response;
+                       if (!status.ok() && !spillReport(request)) {
+                         filter_stats_.filter_.report_dropped_.inc();
+                       }
+                     });
+        }
+      });
 }
 
 void ClientCache::collectScResponseErrorStats(ScResponseErrorType error_type) {
@@ -14,6 +14,9 @@
 
 #pragma once
 
+#include <list>
+#include <memory>
+
 #include "api/envoy/v10/http/service_control/config.pb.h"
 #include "envoy/event/dispatcher.h"
 #include "envoy/tracing/http_tracer.h"
@@ -23,6 +26,7 @@
 #include "src/api_proxy/service_control/request_info.h"
 #include "src/envoy/http/service_control/filter_stats.h"
 #include "src/envoy/http/service_control/http_call.h"
+#include "src/envoy/http/service_control/report_spill.h"
 #include "src/envoy/http/service_control/service_control_callback_func.h"
 
 namespace espv2 {
@@ -50,7 +54,8 @@ class ClientCache : public Envoy::Logger::Loggable<Envoy::Logger::Id::filter> {
       Envoy::Upstream::ClusterManager& cm, Envoy::TimeSource& time_source,
       Envoy::Event::Dispatcher& dispatcher,
       std::function<const std::string&()> sc_token_fn,
-      std::function<const std::string&()> quota_token_fn);
+      std::function<const std::string&()> quota_token_fn,
+      ReportSpillSharedPtr report_spill = nullptr);
 
   CancelFunc callCheck(
       const ::google::api::servicecontrol::v1::CheckRequest& request,
@@ -63,6 +68,8 @@ class ClientCache : public Envoy::Logger::Loggable<Envoy::Logger::Id::filter> {
   void callReport(
       const ::google::api::servicecontrol::v1::ReportRequest& request);
 
+  ~ClientCache();
+
  private:
   friend class test::ClientCacheCheckResponseTest;
   friend class test::ClientCacheCheckResponseErrorTypeTest;
@@ -95,6 +102,21 @@ class ClientCache : public Envoy::Logger::Loggable<Envoy::Logger::Id::filter> {
   void collectCallStatus(CallStatusStats& filter_stats,
                          const ::google::protobuf::util::StatusCode& code);
 
+  // Makes the Report call and tracks it in the report queue.
+  void sendReport(
+      const ::google::api::servicecontrol::v1::ReportRequest& request,
+      ::google::api::servicecontrol::v1::ReportResponse* response,
+      ::google::service_control_client::TransportDoneFunc on_done);
+
+  // Spills the Report call to disk. Returns false if the disk spill is
+  // disabled or full.
+  bool spillReport(
+      const ::google::api::servicecontrol::v1::ReportRequest& request);
+
+  // Loads the spilled Report calls the report queue has room for, and sends
+  // them once loaded.
+  void drainSpilledReports();
+
   template <class Response>
   static ::google::protobuf::util::Status processScCallTransportStatus(
       const ::google::protobuf::util::Status& status, Response* resp,
@@ -118,6 +140,33 @@ class ClientCache : public Envoy::Logger::Loggable<Envoy::Logger::Id::filter> {
   uint32_t report_retries_;
   uint32_t quota_retries_;
 
+  // the configurable report aggregation
+  uint32_t report_aggregation_entries_;
+  uint32_t report_aggregation_flush_interval_ms_;
+
+  // the configurable check cache
+  uint32_t check_aggregation_entries_;
+  uint32_t check_aggregation_flush_interval_ms_;
+  uint32_t check_aggregation_expiration_ms_;
+
+  // The bounded report queue. It is not bounded if max_pending_reports_ is 0.
+  uint32_t max_pending_reports_ = 0;
+  ::espv2::api::envoy::v10::http::service_control::ReportQueueConfig::
+      DropPolicy report_drop_policy_ = ::espv2::api::envoy::v10::http::
+          service_control::ReportQueueConfig::DROP_NEWEST;
+
+  // The pending Report calls, the oldest first.
+  std::list<HttpCall*> pending_reports_;
+
+  // The disk spill shared by the workers, nullptr if disabled.
+  ReportSpillSharedPtr report_spill_;
+  // Whether the spilled Report calls are being loaded.
+  bool loading_spilled_reports_ = false;
+  // Expires on destruction, for the spilled Report calls loaded afterwards.
+  std::shared_ptr<bool> alive_ = std::make_shared<bool>(true);
+
+  Envoy::Event::Dispatcher& dispatcher_;
+
   // Used to retrieve the current time for tracing.
   Envoy::TimeSource& time_source_;
 
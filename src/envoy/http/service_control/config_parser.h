@@ -88,6 +88,22 @@ class RequirementContext {
       metric_costs_.push_back(
           std::make_pair(metric_cost.name(), metric_cost.cost()));
     }
+
+    tier_metric_costs_.reserve(config.quota_tiers().size());
+    for (const auto& tier : config.quota_tiers()) {
+      std::vector<std::pair<std::string, int>> tier_costs;
+      tier_costs.reserve(tier.metric_costs().size());
+      for (const auto& metric_cost : tier.metric_costs()) {
+        tier_costs.push_back(
+            std::make_pair(metric_cost.name(), metric_cost.cost()));
+      }
+      tier_metric_costs_.push_back(std::move(tier_costs));
+
+      // The first tier with the consumer project is used.
+      for (const auto& project_number : tier.consumer_project_numbers()) {
+        consumer_tiers_.emplace(project_number, tier_metric_costs_.size() - 1);
+      }
+    }
   }
 
   const ::espv2::api::envoy::v10::http::service_control::Requirement& config()
@@ -101,10 +117,24 @@ class RequirementContext {
     return metric_costs_;
   }
 
+  // The metric costs of the quota tier with the consumer project, or the
+  // default metric costs if the consumer is in no tier.
+  const std::vector<std::pair<std::string, int>>& metric_costs(
+      const std::string& consumer_project_number) const {
+    const auto it = consumer_tiers_.find(consumer_project_number);
+    if (it == consumer_tiers_.end()) {
+      return metric_costs_;
+    }
+    return tier_metric_costs_[it->second];
+  }
+
  private:
   const ::espv2::api::envoy::v10::http::service_control::Requirement& config_;
   const ServiceContext& service_ctx_;
   std::vector<std::pair<std::string, int>> metric_costs_;
+  std::vector<std::vector<std::pair<std::string, int>>> tier_metric_costs_;
+  // Maps the consumer project number to its index in tier_metric_costs_.
+  absl::flat_hash_map<std::string, size_t> consumer_tiers_;
 };
 using RequirementContextPtr = std::unique_ptr<RequirementContext>;
 
@@ -16,6 +16,7 @@
 
 #include <chrono>
 
+#include "absl/strings/match.h"
 #include "envoy/http/header_map.h"
 #include "source/common/grpc/status.h"
 #include "src/envoy/http/service_control/handler.h"
@@ -26,6 +27,11 @@ namespace espv2 {
 namespace envoy {
 namespace http_filters {
 namespace service_control {
+namespace {
+
+const Envoy::Http::LowerCaseString kRetryAfterHeader{"retry-after"};
+
+}  // namespace
 
 void ServiceControlFilter::onDestroy() {
   ENVOY_LOG(debug, "Called ServiceControl Filter : {}", __func__);
@@ -116,8 +122,21 @@ void ServiceControlFilter::rejectRequest(Envoy::Http::Code code,
   stats_.filter_.denied_.inc();
   state_ = Responded;
 
-  decoder_callbacks_->sendLocalReply(code, error_msg, nullptr, absl::nullopt,
-                                     rc_detail);
+  std::function<void(Envoy::Http::ResponseHeaderMap&)> modify_headers;
+  if (quota_retry_after_secs_ > 0 &&
+      code == Envoy::Http::Code::TooManyRequests &&
+      absl::StartsWith(
+          rc_detail,
+          utils::generateRcDetails(utils::kRcDetailFilterServiceControl,
+                                   utils::kRcDetailErrorTypeScQuota))) {
+    // Tell the clients when to retry the requests rejected by quota.
+    modify_headers = [this](Envoy::Http::ResponseHeaderMap& headers) {
+      headers.setCopy(kRetryAfterHeader,
+                      std::to_string(quota_retry_after_secs_));
+    };
+  }
+  decoder_callbacks_->sendLocalReply(code, error_msg, modify_headers,
+                                     absl::nullopt, rc_detail);
   decoder_callbacks_->streamInfo().setResponseFlag(
       Envoy::StreamInfo::ResponseFlag::UnauthorizedExternalService);
 }
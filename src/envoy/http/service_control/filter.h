@@ -37,8 +37,11 @@ class ServiceControlFilter
       public Envoy::Logger::Loggable<Envoy::Logger::Id::filter> {
  public:
   ServiceControlFilter(ServiceControlFilterStats& stats,
-                       const ServiceControlHandlerFactory& factory)
-      : stats_(stats), factory_(factory) {}
+                       const ServiceControlHandlerFactory& factory,
+                       uint64_t quota_retry_after_secs)
+      : stats_(stats),
+        factory_(factory),
+        quota_retry_after_secs_(quota_retry_after_secs) {}
 
   void onDestroy() override;
 
@@ -66,6 +69,8 @@ class ServiceControlFilter
 
   ServiceControlFilterStats& stats_;
   const ServiceControlHandlerFactory& factory_;
+  // The Retry-After of the quota exhausted replies, 0 if it is not sent.
+  const uint64_t quota_retry_after_secs_;
 
   // The service control request handler
   std::unique_ptr<ServiceControlHandler> handler_;
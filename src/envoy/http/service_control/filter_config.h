@@ -46,7 +46,14 @@ class ServiceControlFilterConfig
         call_factory_(proto_config_, stats_prefix, context),
         config_parser_(*proto_config_, call_factory_),
         handler_factory_(context.api().randomGenerator(), config_parser_,
-                         context.timeSource()) {}
+                         context.timeSource()) {
+    if (proto_config.has_quota_retry_after()) {
+      // Rounded up to seconds.
+      const auto& retry_after = proto_config.quota_retry_after();
+      quota_retry_after_secs_ =
+          retry_after.seconds() + (retry_after.nanos() > 0 ? 1 : 0);
+    }
+  }
 
   const ServiceControlHandlerFactory& handler_factory() const {
     return handler_factory_;
@@ -54,12 +61,16 @@ class ServiceControlFilterConfig
 
   ServiceControlFilterStats& stats() { return filter_stats_; }
 
+  // The Retry-After of the quota exhausted replies, 0 if it is not sent.
+  uint64_t quota_retry_after_secs() const { return quota_retry_after_secs_; }
+
  private:
   ServiceControlFilterStats filter_stats_;
   FilterConfigProtoSharedPtr proto_config_;
   ServiceControlCallFactoryImpl call_factory_;
   FilterConfigParser config_parser_;
   ServiceControlHandlerFactoryImpl handler_factory_;
+  uint64_t quota_retry_after_secs_ = 0;
 };
 
 using FilterConfigSharedPtr = std::shared_ptr<ServiceControlFilterConfig>;
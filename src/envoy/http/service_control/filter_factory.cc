@@ -46,7 +46,8 @@ class FilterFactory
     return [filter_config](
                Envoy::Http::FilterChainFactoryCallbacks& callbacks) -> void {
       auto filter = std::make_shared<ServiceControlFilter>(
-          filter_config->stats(), filter_config->handler_factory());
+          filter_config->stats(), filter_config->handler_factory(),
+          filter_config->quota_retry_after_secs());
       callbacks.addStreamDecoderFilter(
           Envoy::Http::StreamDecoderFilterSharedPtr(filter));
       callbacks.addAccessLogHandler(
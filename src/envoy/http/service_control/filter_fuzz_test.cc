@@ -159,7 +159,8 @@ DEFINE_PROTO_FUZZER(
 
     // Create filter.
     ServiceControlFilter filter(filter_config.stats(),
-                                filter_config.handler_factory());
+                                filter_config.handler_factory(),
+                                filter_config.quota_retry_after_secs());
     filter.setDecoderFilterCallbacks(mock_decoder_callbacks);
 
     if (onReadyCallback != nullptr) {
@@ -44,6 +44,8 @@ namespace service_control {
 namespace {
 
 const Status kBadStatus(StatusCode::kUnauthenticated, "test");
+const Status kResourceExhaustedStatus(StatusCode::kResourceExhausted, "test");
+constexpr uint64_t kQuotaRetryAfterSecs = 30;
 
 class ServiceControlFilterTest : public ::testing::Test {
  protected:
@@ -53,8 +55,8 @@ class ServiceControlFilterTest : public ::testing::Test {
         req_headers_{{":method", "GET"}, {":path", "/bar"}} {}
 
   void SetUp() override {
-    filter_ =
-        std::make_unique<ServiceControlFilter>(stats_, mock_handler_factory_);
+    filter_ = std::make_unique<ServiceControlFilter>(
+        stats_, mock_handler_factory_, kQuotaRetryAfterSecs);
     filter_->setDecoderFilterCallbacks(mock_decoder_callbacks_);
 
     mock_handler_ = new testing::NiceMock<MockServiceControlHandler>();
@@ -159,6 +161,58 @@ TEST_F(ServiceControlFilterTest, DecodeHeadersSyncBadStatus) {
             filter_->decodeHeaders(req_headers_, true));
 }
 
+// Expects a 429 reply with the Retry-After header set by the modify_headers of
+// sendLocalReply, or without it if want_retry_after is empty.
+void expectRetryAfter(
+    testing::NiceMock<MockStreamDecoderFilterCallbacks>& callbacks,
+    absl::string_view rc_detail, absl::string_view want_retry_after) {
+  EXPECT_CALL(callbacks, sendLocalReply(Envoy::Http::Code::TooManyRequests,
+                                        "RESOURCE_EXHAUSTED:test", _, _,
+                                        rc_detail))
+      .WillOnce(Invoke(
+          [want_retry_after](
+              Envoy::Http::Code, absl::string_view,
+              std::function<void(Envoy::Http::ResponseHeaderMap&)>
+                  modify_headers,
+              const absl::optional<Envoy::Grpc::Status::GrpcStatus>,
+              absl::string_view) {
+            Envoy::Http::TestResponseHeaderMapImpl headers;
+            if (modify_headers) {
+              modify_headers(headers);
+            }
+            EXPECT_EQ(headers.get_("retry-after"), want_retry_after);
+          }));
+}
+
+TEST_F(ServiceControlFilterTest, QuotaExhaustedReplyHasRetryAfter) {
+  EXPECT_CALL(*mock_handler_, callCheck(_, _, _))
+      .WillOnce(Invoke([](Envoy::Http::RequestHeaderMap&, Envoy::Tracing::Span&,
+                          ServiceControlHandler::CheckDoneCallback& callback) {
+        callback.onCheckDone(kResourceExhaustedStatus,
+                             "service_control_quota_error{RESOURCE_EXHAUSTED}");
+      }));
+  expectRetryAfter(mock_decoder_callbacks_,
+                   "service_control_quota_error{RESOURCE_EXHAUSTED}", "30");
+
+  EXPECT_EQ(Envoy::Http::FilterHeadersStatus::StopIteration,
+            filter_->decodeHeaders(req_headers_, true));
+}
+
+TEST_F(ServiceControlFilterTest, NonQuotaTooManyRequestsHasNoRetryAfter) {
+  // A 429 rejected by the Check call is not a quota denial.
+  EXPECT_CALL(*mock_handler_, callCheck(_, _, _))
+      .WillOnce(Invoke([](Envoy::Http::RequestHeaderMap&, Envoy::Tracing::Span&,
+                          ServiceControlHandler::CheckDoneCallback& callback) {
+        callback.onCheckDone(kResourceExhaustedStatus,
+                             "service_control_check_error{RESOURCE_EXHAUSTED}");
+      }));
+  expectRetryAfter(mock_decoder_callbacks_,
+                   "service_control_check_error{RESOURCE_EXHAUSTED}", "");
+
+  EXPECT_EQ(Envoy::Http::FilterHeadersStatus::StopIteration,
+            filter_->decodeHeaders(req_headers_, true));
+}
+
 TEST_F(ServiceControlFilterTest, DecodeHeadersAsyncGoodStatus) {
   // Test: While Filter is Calling/stopped, onCheckDone calls
   // continueDecoding
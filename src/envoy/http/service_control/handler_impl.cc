@@ -18,6 +18,7 @@
 
 #include "absl/strings/match.h"
 #include "source/common/common/empty_string.h"
+#include "source/common/common/hash.h"
 #include "source/common/http/headers.h"
 #include "source/common/http/utility.h"
 #include "src/envoy/http/service_control/handler_utils.h"
@@ -57,6 +58,9 @@ const Envoy::Http::LowerCaseString kIosBundleIdHeader{
 const Envoy::Http::LowerCaseString kAndroidPackageHeader{"x-android-package"};
 const Envoy::Http::LowerCaseString kAndroidCertHeader{"x-android-cert"};
 
+// The precision of the report sampling rate.
+constexpr uint64_t kReportSamplingPrecision = 10000;
+
 constexpr char JwtPayloadIssuerPath[] = "iss";
 constexpr char JwtPayloadAudiencePath[] = "aud";
 }  // namespace
@@ -129,6 +133,8 @@ absl::string_view ServiceControlHandlerImpl::getOperationFromPerRoute(
 void ServiceControlHandlerImpl::fillFilterState(FilterState& filter_state) {
   utils::setStringFilterState(filter_state, utils::kFilterStateApiKey,
                               api_key_);
+  utils::setStringFilterState(filter_state, utils::kFilterStateApiKeyPresent,
+                              api_key_.empty() ? "false" : "true");
 
   utils::setStringFilterState(filter_state, utils::kFilterStateApiMethod,
                               require_ctx_->config().operation_name());
@@ -242,8 +248,15 @@ void ServiceControlHandlerImpl::callQuota() {
     return;
   }
 
-  ::espv2::api_proxy::service_control::QuotaRequestInfo info{
-      require_ctx_->metric_costs()};
+  // The consumer project is only known if the Check call is made.
+  const auto& metric_costs =
+      require_ctx_->metric_costs(check_response_info_.consumer_project_number);
+  if (metric_costs.empty()) {
+    check_callback_->onCheckDone(check_status_, rc_detail_);
+    return;
+  }
+
+  ::espv2::api_proxy::service_control::QuotaRequestInfo info{metric_costs};
   info.method_name = require_ctx_->config().operation_name();
   fillOperationInfo(info);
 
@@ -301,6 +314,25 @@ void ServiceControlHandlerImpl::onCheckResponse(
   callQuota();
 }
 
+bool ServiceControlHandlerImpl::isReportSampled(
+    const ::espv2::api_proxy::service_control::ReportRequestInfo& info) const {
+  if (!require_ctx_->config().has_report_sampling()) {
+    return true;
+  }
+
+  // Failed calls are always reported.
+  if (info.http_response_code >= 400 ||
+      (info.grpc_response_code.has_value() &&
+       info.grpc_response_code.value() != StatusCode::kOk)) {
+    return true;
+  }
+
+  // The uuid is random for each request.
+  const double rate = require_ctx_->config().report_sampling().success_rate();
+  return Envoy::HashUtil::xxHash64(uuid_) % kReportSamplingPrecision <
+         rate * kReportSamplingPrecision;
+}
+
 void ServiceControlHandlerImpl::callReport(
     const Envoy::Http::RequestHeaderMap* request_headers,
     const Envoy::Http::ResponseHeaderMap* response_headers,
@@ -323,6 +355,8 @@ void ServiceControlHandlerImpl::callReport(
       require_ctx_->service_ctx().config().jwt_payload_metadata_name(),
       require_ctx_->service_ctx().config().log_jwt_payloads(),
       info.jwt_payloads);
+  const auto& log_labels = require_ctx_->service_ctx().config().log_labels();
+  info.log_labels.insert(log_labels.begin(), log_labels.end());
 
   fillJwtPayload(
       stream_info_.dynamicMetadata(),
@@ -346,6 +380,11 @@ void ServiceControlHandlerImpl::callReport(
   fillLatency(stream_info_, info.latency, filter_stats_);
   fillStatus(response_headers, response_trailers, stream_info_, info);
 
+  if (!isReportSampled(info)) {
+    ENVOY_LOG(debug, "Skip report, the call is not sampled");
+    return;
+  }
+
   info.request_size = stream_info_.bytesReceived() + request_header_size_;
 
   uint64_t response_header_size = 0;
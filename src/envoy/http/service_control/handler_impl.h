@@ -80,7 +80,8 @@ class ServiceControlHandlerImpl
 
   bool isQuotaRequired() const {
     return !require_ctx_->config().skip_service_control() &&
-           !require_ctx_->config().metric_costs().empty();
+           (!require_ctx_->config().metric_costs().empty() ||
+            !require_ctx_->config().quota_tiers().empty());
   }
 
   bool isCheckRequired() const {
@@ -92,6 +93,11 @@ class ServiceControlHandlerImpl
     return !require_ctx_->config().skip_service_control();
   }
 
+  // Returns false if the successful call is not selected by report sampling.
+  bool isReportSampled(
+      const ::espv2::api_proxy::service_control::ReportRequestInfo& info)
+      const;
+
   bool hasApiKey() const { return !api_key_.empty(); }
 
   void onCheckResponse(
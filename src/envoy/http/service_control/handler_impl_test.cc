@@ -132,6 +132,25 @@ requirements {
     cost: 4
   }
 }
+requirements {
+  service_name: "echo"
+  api_name: "test_api"
+  api_version: "test_version"
+  operation_name: "get_header_key_quota_tiers"
+  api_key: {
+    allow_without_api_key: false
+    locations: {
+      header: "x-api-key"
+    }
+  }
+  quota_tiers: {
+    consumer_project_numbers: "12345"
+    metric_costs: {
+      name: "metric_name_1"
+      cost: 10
+    }
+  }
+}
 requirements {
   service_name: "echo"
   api_name: "test_api"
@@ -156,6 +175,18 @@ requirements {
       cookie: "api_key"
     }
   }
+}
+requirements {
+  service_name: "echo"
+  api_name: "test_api"
+  api_version: "test_version"
+  operation_name: "get_no_success_report"
+  api_key: {
+    allow_without_api_key: true
+  }
+  report_sampling: {
+    success_rate: 0
+  }
 })";
 
 class HandlerTest : public ::testing::Test {
@@ -629,6 +660,75 @@ TEST_F(HandlerTest, HandlerSuccessfulQuotaSync) {
   handler.callReport(&headers, &response_headers, &resp_trailer_, mock_span_);
 }
 
+TEST_F(HandlerTest, HandlerQuotaTierForConsumer) {
+  // Test: The quota tier of the consumer project is used.
+  setPerRouteOperation("get_header_key_quota_tiers");
+  TestRequestHeaderMapImpl headers{
+      {":method", "GET"}, {":path", "/echo"}, {"x-api-key", "foobar"}};
+  TestResponseHeaderMapImpl response_headers{
+      {"content-type", "application/grpc"}};
+  ServiceControlHandlerImpl handler(headers, mock_stream_info_, "test-uuid",
+                                    *cfg_parser_, test_time_, stats_);
+  CheckResponseInfo response_info;
+  response_info.consumer_project_number = "12345";
+
+  EXPECT_CALL(*mock_call_, callCheck(_, _, _))
+      .WillOnce(Invoke([&response_info](const CheckRequestInfo&,
+                                        Envoy::Tracing::Span&,
+                                        CheckDoneFunc on_done) {
+        on_done(OkStatus(), response_info);
+        return nullptr;
+      }));
+  std::vector<std::pair<std::string, int>> tier_metric_costs{
+      {"metric_name_1", 10}};
+  QuotaRequestInfo expected_quota_info{tier_metric_costs};
+  expected_quota_info.method_name = "get_header_key_quota_tiers";
+  expected_quota_info.api_key = "foobar";
+
+  QuotaResponseInfo quota_response_info;
+
+  EXPECT_CALL(*mock_call_, callQuota(MatchesQuotaInfo(expected_quota_info), _))
+      .WillOnce(Invoke([&quota_response_info](const QuotaRequestInfo&,
+                                              QuotaDoneFunc on_done) {
+        on_done(OkStatus(), quota_response_info);
+      }));
+
+  EXPECT_CALL(mock_check_done_callback_, onCheckDone(OkStatus(), ""));
+  handler.callCheck(headers, mock_span_, mock_check_done_callback_);
+
+  EXPECT_CALL(*mock_call_, callReport(_));
+  handler.callReport(&headers, &response_headers, &resp_trailer_, mock_span_);
+}
+
+TEST_F(HandlerTest, HandlerNoQuotaForConsumerWithoutTier) {
+  // Test: Quota is not called for a consumer in no tier if the operation has
+  // no default metric costs.
+  setPerRouteOperation("get_header_key_quota_tiers");
+  TestRequestHeaderMapImpl headers{
+      {":method", "GET"}, {":path", "/echo"}, {"x-api-key", "foobar"}};
+  TestResponseHeaderMapImpl response_headers{
+      {"content-type", "application/grpc"}};
+  ServiceControlHandlerImpl handler(headers, mock_stream_info_, "test-uuid",
+                                    *cfg_parser_, test_time_, stats_);
+  CheckResponseInfo response_info;
+  response_info.consumer_project_number = "67890";
+
+  EXPECT_CALL(*mock_call_, callCheck(_, _, _))
+      .WillOnce(Invoke([&response_info](const CheckRequestInfo&,
+                                        Envoy::Tracing::Span&,
+                                        CheckDoneFunc on_done) {
+        on_done(OkStatus(), response_info);
+        return nullptr;
+      }));
+  EXPECT_CALL(*mock_call_, callQuota(_, _)).Times(0);
+
+  EXPECT_CALL(mock_check_done_callback_, onCheckDone(OkStatus(), ""));
+  handler.callCheck(headers, mock_span_, mock_check_done_callback_);
+
+  EXPECT_CALL(*mock_call_, callReport(_));
+  handler.callReport(&headers, &response_headers, &resp_trailer_, mock_span_);
+}
+
 TEST_F(HandlerTest, HandlerCallQuotaWithoutCheck) {
   // Test: Quota is required but the Check is not
   setPerRouteOperation("call_quota_without_check");
@@ -726,6 +826,9 @@ TEST_F(HandlerTest, FillFilterState) {
   EXPECT_EQ(utils::getStringFilterState(*mock_stream_info_.filter_state_,
                                         utils::kFilterStateApiMethod),
             "get_header_key");
+  EXPECT_EQ(utils::getStringFilterState(*mock_stream_info_.filter_state_,
+                                        utils::kFilterStateApiKeyPresent),
+            "true");
 }
 
 TEST_F(HandlerTest, HandlerFailQuotaSync) {
@@ -1091,6 +1194,36 @@ TEST_F(HandlerTest, HandlerReportWithTrace) {
   handler.callReport(&headers, &response_headers, &resp_trailer_, mock_span_);
 }
 
+TEST_F(HandlerTest, HandlerReportSkippedBySampling) {
+  // Test: Successful calls not selected by report sampling are not reported.
+  EXPECT_CALL(mock_stream_info_, responseCode()).WillRepeatedly(Return(200));
+
+  setPerRouteOperation("get_no_success_report");
+  TestRequestHeaderMapImpl headers{{":method", "GET"}, {":path", "/echo"}};
+  TestResponseHeaderMapImpl response_headers{
+      {"content-type", "application/json"}};
+  ServiceControlHandlerImpl handler(headers, mock_stream_info_, "test-uuid",
+                                    *cfg_parser_, test_time_, stats_);
+
+  EXPECT_CALL(*mock_call_, callReport(_)).Times(0);
+  handler.callReport(&headers, &response_headers, &resp_trailer_, mock_span_);
+}
+
+TEST_F(HandlerTest, HandlerReportFailedCallWithSampling) {
+  // Test: Failed calls are always reported regardless of report sampling.
+  EXPECT_CALL(mock_stream_info_, responseCode()).WillRepeatedly(Return(503));
+
+  setPerRouteOperation("get_no_success_report");
+  TestRequestHeaderMapImpl headers{{":method", "GET"}, {":path", "/echo"}};
+  TestResponseHeaderMapImpl response_headers{
+      {"content-type", "application/json"}};
+  ServiceControlHandlerImpl handler(headers, mock_stream_info_, "test-uuid",
+                                    *cfg_parser_, test_time_, stats_);
+
+  EXPECT_CALL(*mock_call_, callReport(_));
+  handler.callReport(&headers, &response_headers, &resp_trailer_, mock_span_);
+}
+
 class HandlerReportStatusTest : public HandlerTest {
  protected:
   void runTest(unsigned int http_response_code,
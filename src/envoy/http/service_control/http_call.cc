@@ -50,8 +50,8 @@ class HttpCallImpl : public HttpCall,
                      public Envoy::Http::AsyncClient::Callbacks {
  public:
   HttpCallImpl(Envoy::Upstream::ClusterManager& cm,
-               Envoy::Event::Dispatcher& dispatcher, const HttpUri& uri,
-               const std::string& suffix_url,
+               Envoy::Event::Dispatcher& dispatcher,
+               const std::vector<HttpUri>& uris, const std::string& suffix_url,
                std::function<const std::string&()> token_fn,
                const Envoy::Protobuf::Message& body, uint32_t timeout_ms,
                uint32_t retries, Envoy::Tracing::Span& parent_span,
@@ -59,7 +59,8 @@ class HttpCallImpl : public HttpCall,
                const std::string& trace_operation_name)
       : cm_(cm),
         dispatcher_(dispatcher),
-        http_uri_(uri),
+        http_uris_(uris),
+        suffix_url_(suffix_url),
         retries_(retries),
         request_count_(0),
         timeout_ms_(timeout_ms),
@@ -68,9 +69,7 @@ class HttpCallImpl : public HttpCall,
         parent_span_(parent_span),
         time_source_(time_source),
         trace_operation_name_(trace_operation_name) {
-    uri_ = http_uri_.uri() + suffix_url;
-
-    Envoy::Http::Utility::extractHostPathFromUri(uri_, host_, path_);
+    useUri(0);
     body.SerializeToString(&str_body_);
 
     ASSERT(!on_done_);
@@ -166,6 +165,19 @@ class HttpCallImpl : public HttpCall,
     if (status_code >= 400 && status_code < 500) {
       return false;
     }
+    // Fail over on the transport errors and the server errors.
+    if ((status_code == 0 || status_code >= 500) &&
+        uri_index_ + 1 < http_uris_.size()) {
+      const std::string failed_uri = uri_;
+      useUri(uri_index_ + 1);
+      ENVOY_LOG(debug,
+                "http call [uri = {}] failed, failing over to [uri = {}]",
+                failed_uri, uri_);
+
+      reset();
+      makeOneCall();
+      return true;
+    }
     if (retries_ <= 0) {
       return false;
     }
@@ -180,10 +192,18 @@ class HttpCallImpl : public HttpCall,
     return true;
   }
 
+  // Calls the uri at the index from now on.
+  void useUri(size_t index) {
+    uri_index_ = index;
+    uri_ = http_uris_[index].uri() + suffix_url_;
+    Envoy::Http::Utility::extractHostPathFromUri(uri_, host_, path_);
+  }
+
   void makeOneCall() {
     request_count_++;
-    std::string token = token_fn_();
-    if (token.empty()) {
+    // No access token is sent if the token function is not set.
+    std::string token = token_fn_ ? token_fn_() : Envoy::EMPTY_STRING;
+    if (token_fn_ && token.empty()) {
       on_done_(Status(StatusCode::kInternal,
                       "Missing access token for service control call"),
                Envoy::EMPTY_STRING);
@@ -202,7 +222,7 @@ class HttpCallImpl : public HttpCall,
     request_span_->setTag(Envoy::Tracing::Tags::get().Component,
                           Envoy::Tracing::Tags::get().Proxy);
     request_span_->setTag(Envoy::Tracing::Tags::get().UpstreamCluster,
-                          http_uri_.cluster());
+                          http_uris_[uri_index_].cluster());
     request_span_->setTag(Envoy::Tracing::Tags::get().HttpUrl, uri_);
     request_span_->setTag(Envoy::Tracing::Tags::get().HttpMethod, "POST");
 
@@ -211,7 +231,7 @@ class HttpCallImpl : public HttpCall,
     ENVOY_LOG(debug, "http call from [uri = {}]: start", uri_);
 
     const auto thread_local_cluster =
-        cm_.getThreadLocalCluster(http_uri_.cluster());
+        cm_.getThreadLocalCluster(http_uris_[uri_index_].cluster());
     if (thread_local_cluster) {
       request_ = thread_local_cluster->httpAsyncClient().send(
           std::move(message), *this,
@@ -256,9 +276,10 @@ class HttpCallImpl : public HttpCall,
     message->body().add(str_body_.data(), str_body_.size());
     message->headers().setContentLength(message->body().length());
 
-    // assume token is not empty
-    message->headers().setInline(authorization_handle.handle(),
-                                 "Bearer " + token);
+    if (!token.empty()) {
+      message->headers().setInline(authorization_handle.handle(),
+                                   "Bearer " + token);
+    }
     message->headers().setContentType(KApplicationProto);
     return message;
   }
@@ -284,8 +305,11 @@ class HttpCallImpl : public HttpCall,
 
   // The request uri
   std::string uri_;
-  // The host of the request uri
-  const HttpUri http_uri_;
+  // The uris to call, the failover ones after the primary one
+  const std::vector<HttpUri> http_uris_;
+  // The index of the uri being called
+  size_t uri_index_;
+  const std::string suffix_url_;
   // The host of the request uri with buffer owned by uri_
   absl::string_view host_;
   // The path of the request uri with buffer owned by uri_
@@ -310,6 +334,13 @@ class HttpCallImpl : public HttpCall,
   const std::string trace_operation_name_;
 };
 
+std::vector<HttpUri> makeUris(const HttpUri& uri,
+                              const std::vector<HttpUri>& failover_uris) {
+  std::vector<HttpUri> uris{uri};
+  uris.insert(uris.end(), failover_uris.begin(), failover_uris.end());
+  return uris;
+}
+
 }  // namespace
 
 HttpCallFactoryImpl::HttpCallFactoryImpl(
@@ -317,10 +348,11 @@ HttpCallFactoryImpl::HttpCallFactoryImpl(
     const ::espv2::api::envoy::v10::http::common::HttpUri& uri,
     const std::string& suffix_url, std::function<const std::string&()> token_fn,
     uint32_t timeout_ms, uint32_t retries, Envoy::TimeSource& time_source,
-    const std::string& trace_operation_name)
+    const std::string& trace_operation_name,
+    const std::vector<HttpUri>& failover_uris)
     : cm_(cm),
       dispatcher_(dispatcher),
-      uri_(uri),
+      uris_(makeUris(uri, failover_uris)),
       suffix_url_(suffix_url),
       token_fn_(token_fn),
       timeout_ms_(timeout_ms),
@@ -334,7 +366,7 @@ HttpCall* HttpCallFactoryImpl::createHttpCall(
     HttpCall::DoneFunc on_done) {
   ENVOY_LOG(debug, "{} is created", trace_operation_name_);
   HttpCallImpl* http_call = new HttpCallImpl(
-      cm_, dispatcher_, uri_, suffix_url_, token_fn_, body, timeout_ms_,
+      cm_, dispatcher_, uris_, suffix_url_, token_fn_, body, timeout_ms_,
       retries_, parent_span, time_source_, trace_operation_name_);
   http_call->setDoneFunc([this, on_done, http_call](const Status& status,
                                                     const std::string& body) {
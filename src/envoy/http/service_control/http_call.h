@@ -14,6 +14,8 @@
 
 #pragma once
 
+#include <vector>
+
 #include "api/envoy/v10/http/common/base.pb.h"
 #include "envoy/common/pure.h"
 #include "envoy/tracing/http_tracer.h"
@@ -58,7 +60,9 @@ class HttpCallFactoryImpl : public HttpCallFactory {
       const std::string& suffix_url,
       std::function<const std::string&()> token_fn, uint32_t timeout_ms,
       uint32_t retries, Envoy::TimeSource& time_source,
-      const std::string& trace_operation_name);
+      const std::string& trace_operation_name,
+      const std::vector<::espv2::api::envoy::v10::http::common::HttpUri>&
+          failover_uris = {});
 
   HttpCall* createHttpCall(const Envoy::Protobuf::Message& body,
                            Envoy::Tracing::Span& parent_span,
@@ -74,8 +78,8 @@ class HttpCallFactoryImpl : public HttpCallFactory {
   Envoy::Upstream::ClusterManager& cm_;
   Envoy::Event::Dispatcher& dispatcher_;
 
-  // call uri address
-  const ::espv2::api::envoy::v10::http::common::HttpUri uri_;
+  // call uri addresses, the failover ones after the primary one
+  const std::vector<::espv2::api::envoy::v10::http::common::HttpUri> uris_;
   const std::string suffix_url_;
 
   // token getter
@@ -41,6 +41,7 @@ namespace {
 using ::testing::_;
 using ::testing::AtLeast;
 using ::testing::ByMove;
+using ::testing::Eq;
 using ::testing::Invoke;
 using ::testing::MockFunction;
 using ::testing::Return;
@@ -82,6 +83,8 @@ class HttpCallTest : public testing::Test {
                   Envoy::Http::CustomHeaders::get().Authorization);
               EXPECT_EQ(token_header[0]->value().getStringView(),
                         "Bearer " + fake_token_);
+              request_hosts_.push_back(
+                  std::string(message_ptr->headers().getHostValue()));
 
               // Make callback and request
               async_callbacks_.push_back(&callbacks);
@@ -152,6 +155,7 @@ class HttpCallTest : public testing::Test {
   // Keep track of all underlying http client callbacks and http requests
   std::vector<Envoy::Http::AsyncClient::Callbacks*> async_callbacks_;
   std::vector<Envoy::Http::MockAsyncClientRequest*> http_requests_;
+  std::vector<std::string> request_hosts_;
 
   // Token
   std::string fake_token_;
@@ -254,6 +258,39 @@ TEST_F(HttpCallTest, TestEmptyTokenCallFailure) {
   EXPECT_EQ(0, http_requests_.size());
 }
 
+TEST_F(HttpCallTest, TestNoTokenCallSuccess) {
+  // Without token function, the call is made without the Authorization header.
+  http_call_factory_ = std::make_unique<HttpCallFactoryImpl>(
+      cm_, dispatcher_, http_uri_, fake_suffix_url_, nullptr, timeout_ms_,
+      retries_, mock_time_source_, fake_trace_operation_name_);
+  EXPECT_CALL(http_client_, send_(_, _, _))
+      .WillOnce(Invoke([this](Envoy::Http::RequestMessagePtr& message_ptr,
+                              Envoy::Http::AsyncClient::Callbacks& callbacks,
+                              const Envoy::Http::AsyncClient::RequestOptions)
+                           -> Envoy::Http::AsyncClient::Request* {
+        EXPECT_TRUE(message_ptr->headers()
+                        .get(Envoy::Http::CustomHeaders::get().Authorization)
+                        .empty());
+
+        async_callbacks_.push_back(&callbacks);
+        auto request =
+            new NiceMock<Envoy::Http::MockAsyncClientRequest>(&http_client_);
+        http_requests_.push_back(request);
+        return request;
+      }));
+
+  auto mock_child_span = makeMockChildSpan();
+  HttpCall* call = http_call_factory_->createHttpCall(
+      fake_request_, mock_parent_span_, mock_done_fn_.AsStdFunction());
+  call->call();
+  EXPECT_EQ(1, async_callbacks_.size());
+
+  EXPECT_CALL(*mock_child_span, finishSpan()).Times(1);
+  EXPECT_CALL(mock_done_fn_, Call(OkStatus(), _)).Times(1);
+  async_callbacks_[0]->onSuccess(lastHttpRequest(),
+                                 makeResponseWithStatus(200));
+}
+
 TEST_F(HttpCallTest, TestRetryCallSuccess) {
   // Set request to retry 2 more times
   retries_ = 2;
@@ -293,6 +330,60 @@ TEST_F(HttpCallTest, TestRetryCallSuccess) {
                                  makeResponseWithStatus(200));
 }
 
+TEST_F(HttpCallTest, TestFailoverCallSuccess) {
+  HttpUri failover_uri;
+  failover_uri.set_cluster("failover_cluster");
+  failover_uri.set_uri("http://failover_host/test_path");
+  http_call_factory_ = std::make_unique<HttpCallFactoryImpl>(
+      cm_, dispatcher_, http_uri_, fake_suffix_url_, fake_token_fn_,
+      timeout_ms_, retries_, mock_time_source_, fake_trace_operation_name_,
+      std::vector<HttpUri>{failover_uri});
+  // Phase 1: Create HttpCall and send the request
+  auto mock_child_span_1 = makeMockChildSpan();
+  HttpCall* call = http_call_factory_->createHttpCall(
+      fake_request_, mock_parent_span_, mock_done_fn_.AsStdFunction());
+  call->call();
+  EXPECT_EQ(1, async_callbacks_.size());
+
+  // Phase 2: Emulate a server error, the call fails over to the failover
+  // cluster without retries.
+  EXPECT_CALL(cm_, getThreadLocalCluster(Eq("failover_cluster")))
+      .WillOnce(Return(&thread_local_cluster_));
+  EXPECT_CALL(*mock_child_span_1, finishSpan()).Times(1);
+  auto mock_child_span_2 = makeMockChildSpan();
+  async_callbacks_[0]->onSuccess(lastHttpRequest(),
+                                 makeResponseWithStatus(503));
+  EXPECT_EQ(2, async_callbacks_.size());
+  EXPECT_EQ(request_hosts_,
+            std::vector<std::string>({"test_host", "failover_host"}));
+
+  // Phase 3: Emulate successful http response from the failover cluster
+  EXPECT_CALL(*mock_child_span_2, finishSpan()).Times(1);
+  EXPECT_CALL(mock_done_fn_, Call(OkStatus(), _)).Times(1);
+  async_callbacks_[1]->onSuccess(lastHttpRequest(),
+                                 makeResponseWithStatus(200));
+}
+
+TEST_F(HttpCallTest, TestNoFailoverOnClientError) {
+  HttpUri failover_uri;
+  failover_uri.set_cluster("failover_cluster");
+  failover_uri.set_uri("http://failover_host/test_path");
+  http_call_factory_ = std::make_unique<HttpCallFactoryImpl>(
+      cm_, dispatcher_, http_uri_, fake_suffix_url_, fake_token_fn_,
+      timeout_ms_, retries_, mock_time_source_, fake_trace_operation_name_,
+      std::vector<HttpUri>{failover_uri});
+  auto mock_child_span = makeMockChildSpan();
+  HttpCall* call = http_call_factory_->createHttpCall(
+      fake_request_, mock_parent_span_, mock_done_fn_.AsStdFunction());
+  call->call();
+
+  EXPECT_CALL(*mock_child_span, finishSpan()).Times(1);
+  EXPECT_CALL(mock_done_fn_, Call(_, _)).Times(1);
+  async_callbacks_[0]->onSuccess(lastHttpRequest(),
+                                 makeResponseWithStatus(404));
+  EXPECT_EQ(1, async_callbacks_.size());
+}
+
 TEST_F(HttpCallTest, TestThreeRetriesWithLastSuccess) {
   // Set request to retry 2 more times
   retries_ = 2;
@@ -0,0 +1,212 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include "src/envoy/http/service_control/report_spill.h"
+
+#include <sys/stat.h>
+#include <unistd.h>
+
+#include <algorithm>
+#include <chrono>
+#include <cstdio>
+#include <fstream>
+
+#include "absl/strings/match.h"
+#include "absl/strings/str_cat.h"
+#include "absl/strings/str_format.h"
+#include "source/common/common/lock_guard.h"
+#include "source/common/filesystem/directory.h"
+
+namespace espv2 {
+namespace envoy {
+namespace http_filters {
+namespace service_control {
+namespace {
+
+constexpr char kReportFilePrefix[] = "report-";
+constexpr char kReportFileSuffix[] = ".pb";
+
+}  // namespace
+
+using ::google::api::servicecontrol::v1::ReportRequest;
+
+ReportSpill::ReportSpill(const std::string& dir, uint64_t max_bytes,
+                         Envoy::Thread::ThreadFactory& thread_factory,
+                         Envoy::TimeSource& time_source)
+    : dir_(dir),
+      max_bytes_(max_bytes),
+      file_prefix_(absl::StrFormat(
+          "%s%020d-%d-", kReportFilePrefix,
+          std::chrono::duration_cast<std::chrono::nanoseconds>(
+              time_source.systemTime().time_since_epoch())
+              .count(),
+          ::getpid())) {
+  post([this]() { scanDir(); });
+  thread_ = thread_factory.createThread([this]() { run(); },
+                                        Envoy::Thread::Options{"report_spill"});
+}
+
+ReportSpill::~ReportSpill() {
+  {
+    Envoy::Thread::LockGuard lock(mutex_);
+    shutdown_ = true;
+    cond_var_.notifyOne();
+  }
+  // The queued Report calls are still written.
+  thread_->join();
+}
+
+bool ReportSpill::spill(const ReportRequest& request) {
+  std::string data;
+  if (!request.SerializeToString(&data)) {
+    return false;
+  }
+
+  std::string path;
+  {
+    Envoy::Thread::LockGuard lock(mutex_);
+    if (bytes_ + data.size() > max_bytes_) {
+      return false;
+    }
+    bytes_ += data.size();
+    path = absl::StrCat(dir_, "/", file_prefix_,
+                        absl::StrFormat("%020d", file_count_++),
+                        kReportFileSuffix);
+  }
+  post([this, path, data]() { writeReport(path, data); });
+  return true;
+}
+
+void ReportSpill::load(
+    uint32_t max_reports, Envoy::Event::Dispatcher& dispatcher,
+    std::function<void(std::vector<ReportRequest>)> on_loaded) {
+  post([this, max_reports, &dispatcher, on_loaded]() {
+    std::vector<ReportRequest> requests = readReports(max_reports);
+    dispatcher.post([on_loaded, requests]() { on_loaded(requests); });
+  });
+}
+
+void ReportSpill::run() {
+  while (true) {
+    std::function<void()> job;
+    {
+      Envoy::Thread::LockGuard lock(mutex_);
+      while (jobs_.empty() && !shutdown_) {
+        cond_var_.wait(mutex_);
+      }
+      if (jobs_.empty()) {
+        return;
+      }
+      job = std::move(jobs_.front());
+      jobs_.pop_front();
+    }
+    job();
+  }
+}
+
+void ReportSpill::post(std::function<void()> job) {
+  Envoy::Thread::LockGuard lock(mutex_);
+  jobs_.push_back(std::move(job));
+  cond_var_.notifyOne();
+}
+
+void ReportSpill::scanDir() {
+  std::vector<std::string> names;
+  try {
+    Envoy::Filesystem::Directory directory(dir_);
+    for (const Envoy::Filesystem::DirectoryEntry& entry : directory) {
+      if (entry.type_ == Envoy::Filesystem::FileType::Regular &&
+          absl::StartsWith(entry.name_, kReportFilePrefix) &&
+          absl::EndsWith(entry.name_, kReportFileSuffix)) {
+        names.push_back(entry.name_);
+      }
+    }
+  } catch (const Envoy::EnvoyException& e) {
+    ENVOY_LOG(warn, "failed to list the spilled Report calls in {}: {}", dir_,
+              e.what());
+    return;
+  }
+
+  // The file names are ordered by the time they are written.
+  std::sort(names.begin(), names.end());
+  uint64_t bytes = 0;
+  for (const std::string& name : names) {
+    const std::string path = absl::StrCat(dir_, "/", name);
+    struct stat file_stat;
+    if (::stat(path.c_str(), &file_stat) != 0) {
+      continue;
+    }
+    files_.emplace_back(path, file_stat.st_size);
+    bytes += file_stat.st_size;
+  }
+  if (!files_.empty()) {
+    ENVOY_LOG(info, "found {} spilled Report calls of the previous runs in {}",
+              files_.size(), dir_);
+  }
+
+  Envoy::Thread::LockGuard lock(mutex_);
+  bytes_ += bytes;
+}
+
+void ReportSpill::writeReport(const std::string& path,
+                              const std::string& data) {
+  std::ofstream file(path, std::ios::binary | std::ios::trunc);
+  if (!file || !file.write(data.data(), data.size()) || !file.flush()) {
+    ENVOY_LOG(warn, "failed to spill the Report call to {}", path);
+    std::remove(path.c_str());
+
+    Envoy::Thread::LockGuard lock(mutex_);
+    bytes_ -= data.size();
+    return;
+  }
+  files_.emplace_back(path, data.size());
+}
+
+std::vector<ReportRequest> ReportSpill::readReports(uint32_t max_reports) {
+  std::vector<ReportRequest> requests;
+  while (requests.size() < max_reports && !files_.empty()) {
+    const auto spilled = files_.front();
+    files_.pop_front();
+    {
+      Envoy::Thread::LockGuard lock(mutex_);
+      bytes_ -= spilled.second;
+    }
+
+    // Claim the file first, as the spill of another filter config on the
+    // same directory may have found it too.
+    const std::string claimed = absl::StrCat(spilled.first, ".loading");
+    if (::rename(spilled.first.c_str(), claimed.c_str()) != 0) {
+      continue;
+    }
+    ReportRequest request;
+    bool parsed;
+    {
+      std::ifstream file(claimed, std::ios::binary);
+      parsed = file && request.ParseFromIstream(&file);
+    }
+    std::remove(claimed.c_str());
+    if (!parsed) {
+      ENVOY_LOG(warn, "failed to read the spilled Report call from {}",
+                spilled.first);
+      continue;
+    }
+    requests.push_back(std::move(request));
+  }
+  return requests;
+}
+
+}  // namespace service_control
+}  // namespace http_filters
+}  // namespace envoy
+}  // namespace espv2
@@ -0,0 +1,97 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#pragma once
+
+#include <deque>
+#include <functional>
+#include <memory>
+#include <string>
+#include <vector>
+
+#include "envoy/common/time.h"
+#include "envoy/event/dispatcher.h"
+#include "envoy/thread/thread.h"
+#include "google/api/servicecontrol/v1/service_controller.pb.h"
+#include "source/common/common/logger.h"
+#include "source/common/common/thread.h"
+
+namespace espv2 {
+namespace envoy {
+namespace http_filters {
+namespace service_control {
+
+// Spills the Report calls to a directory when the report queue is full, and
+// loads them back to be sent. The files are written and read on the spill
+// thread, not to block the workers. The files left by the previous runs are
+// loaded too, so the spilled Report calls survive a restart.
+//
+// It is shared by the report queues of all the workers.
+class ReportSpill : public Envoy::Logger::Loggable<Envoy::Logger::Id::filter> {
+ public:
+  ReportSpill(const std::string& dir, uint64_t max_bytes,
+              Envoy::Thread::ThreadFactory& thread_factory,
+              Envoy::TimeSource& time_source);
+  ~ReportSpill();
+
+  // Queues the Report call to be written. Returns false if the spilled Report
+  // calls would exceed the max bytes.
+  bool spill(const ::google::api::servicecontrol::v1::ReportRequest& request);
+
+  // Loads up to max_reports spilled Report calls, and removes their files.
+  // on_loaded is posted to the dispatcher with them, even if none is loaded.
+  void load(uint32_t max_reports, Envoy::Event::Dispatcher& dispatcher,
+            std::function<void(
+                std::vector<::google::api::servicecontrol::v1::ReportRequest>)>
+                on_loaded);
+
+ private:
+  // Runs the queued jobs on the spill thread until shut down.
+  void run();
+
+  void post(std::function<void()> job);
+
+  // The jobs run on the spill thread.
+  void scanDir();
+  void writeReport(const std::string& path, const std::string& data);
+  std::vector<::google::api::servicecontrol::v1::ReportRequest> readReports(
+      uint32_t max_reports);
+
+  const std::string dir_;
+  const uint64_t max_bytes_;
+  // Prefixes the file names, so they do not collide with the ones of the
+  // other runs, and are ordered by the time they are written.
+  const std::string file_prefix_;
+
+  Envoy::Thread::MutexBasicLockable mutex_;
+  Envoy::Thread::CondVar cond_var_;
+  std::deque<std::function<void()>> jobs_ ABSL_GUARDED_BY(mutex_);
+  bool shutdown_ ABSL_GUARDED_BY(mutex_) = false;
+  // The bytes of the spilled Report calls, including the ones being written.
+  uint64_t bytes_ ABSL_GUARDED_BY(mutex_) = 0;
+  uint64_t file_count_ ABSL_GUARDED_BY(mutex_) = 0;
+
+  // The spilled Report call files with their sizes, the oldest first. Only
+  // accessed on the spill thread.
+  std::deque<std::pair<std::string, uint64_t>> files_;
+
+  Envoy::Thread::ThreadPtr thread_;
+};
+
+using ReportSpillSharedPtr = std::shared_ptr<ReportSpill>;
+
+}  // namespace service_control
+}  // namespace http_filters
+}  // namespace envoy
+}  // namespace espv2
@@ -0,0 +1,137 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include "src/envoy/http/service_control/report_spill.h"
+
+#include <vector>
+
+#include "absl/synchronization/notification.h"
+#include "gmock/gmock.h"
+#include "google/api/servicecontrol/v1/service_controller.pb.h"
+#include "gtest/gtest.h"
+#include "test/mocks/event/mocks.h"
+#include "test/test_common/environment.h"
+#include "test/test_common/test_time.h"
+#include "test/test_common/utility.h"
+
+namespace espv2 {
+namespace envoy {
+namespace http_filters {
+namespace service_control {
+namespace {
+
+using ::google::api::servicecontrol::v1::ReportRequest;
+using ::testing::_;
+using ::testing::Invoke;
+
+class ReportSpillTest : public testing::Test {
+ protected:
+  ReportSpillTest()
+      : api_(Envoy::Api::createApiForTest()),
+        dir_(Envoy::TestEnvironment::temporaryPath("report_spill")) {
+    Envoy::TestEnvironment::createPath(dir_);
+  }
+
+  ~ReportSpillTest() override { Envoy::TestEnvironment::removePath(dir_); }
+
+  std::unique_ptr<ReportSpill> makeSpill(uint64_t max_bytes) {
+    return std::make_unique<ReportSpill>(dir_, max_bytes, api_->threadFactory(),
+                                         time_system_);
+  }
+
+  static ReportRequest makeRequest(const std::string& service_name) {
+    ReportRequest request;
+    request.set_service_name(service_name);
+    return request;
+  }
+
+  // Loads the spilled Report calls, and waits for them to be posted back.
+  std::vector<ReportRequest> load(ReportSpill& spill, uint32_t max_reports) {
+    std::vector<ReportRequest> loaded;
+    absl::Notification done;
+    EXPECT_CALL(dispatcher_, post(_))
+        .WillOnce(Invoke([](std::function<void()> cb) { cb(); }));
+    spill.load(max_reports, dispatcher_,
+               [&loaded, &done](std::vector<ReportRequest> requests) {
+                 loaded = std::move(requests);
+                 done.Notify();
+               });
+    done.WaitForNotification();
+    return loaded;
+  }
+
+  Envoy::Event::TestRealTimeSystem time_system_;
+  Envoy::Api::ApiPtr api_;
+  testing::NiceMock<Envoy::Event::MockDispatcher> dispatcher_;
+  const std::string dir_;
+};
+
+TEST_F(ReportSpillTest, LoadInSpillOrder) {
+  auto spill = makeSpill(1024);
+  EXPECT_TRUE(spill->spill(makeRequest("first")));
+  EXPECT_TRUE(spill->spill(makeRequest("second")));
+  EXPECT_TRUE(spill->spill(makeRequest("third")));
+
+  std::vector<ReportRequest> loaded = load(*spill, 2);
+  ASSERT_EQ(loaded.size(), 2);
+  EXPECT_TRUE(Envoy::TestUtility::protoEqual(loaded[0], makeRequest("first")));
+  EXPECT_TRUE(Envoy::TestUtility::protoEqual(loaded[1], makeRequest("second")));
+
+  loaded = load(*spill, 2);
+  ASSERT_EQ(loaded.size(), 1);
+  EXPECT_TRUE(Envoy::TestUtility::protoEqual(loaded[0], makeRequest("third")));
+
+  EXPECT_TRUE(load(*spill, 2).empty());
+}
+
+TEST_F(ReportSpillTest, RejectOverMaxBytes) {
+  const ReportRequest request = makeRequest("service");
+  auto spill = makeSpill(request.ByteSizeLong());
+  EXPECT_TRUE(spill->spill(request));
+  EXPECT_FALSE(spill->spill(request));
+
+  // The bytes are freed once loaded.
+  EXPECT_EQ(load(*spill, 10).size(), 1);
+  EXPECT_TRUE(spill->spill(request));
+}
+
+TEST_F(ReportSpillTest, LoadAfterRestart) {
+  {
+    auto spill = makeSpill(1024);
+    EXPECT_TRUE(spill->spill(makeRequest("first")));
+    EXPECT_TRUE(spill->spill(makeRequest("second")));
+  }
+
+  auto spill = makeSpill(1024);
+  std::vector<ReportRequest> loaded = load(*spill, 10);
+  ASSERT_EQ(loaded.size(), 2);
+  EXPECT_TRUE(Envoy::TestUtility::protoEqual(loaded[0], makeRequest("first")));
+  EXPECT_TRUE(Envoy::TestUtility::protoEqual(loaded[1], makeRequest("second")));
+}
+
+TEST_F(ReportSpillTest, PreviousRunsCountTowardsMaxBytes) {
+  const ReportRequest request = makeRequest("service");
+  { EXPECT_TRUE(makeSpill(1024)->spill(request)); }
+
+  auto spill = makeSpill(request.ByteSizeLong());
+  // Loading runs after the directory scan, so the bytes are counted by now.
+  EXPECT_EQ(load(*spill, 0).size(), 0);
+  EXPECT_FALSE(spill->spill(request));
+}
+
+}  // namespace
+}  // namespace service_control
+}  // namespace http_filters
+}  // namespace envoy
+}  // namespace espv2
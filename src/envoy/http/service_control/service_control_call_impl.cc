@@ -108,15 +108,25 @@ ServiceControlCallImpl::ServiceControlCallImpl(
     : filter_config_(*proto_config),
       token_subscriber_factory_(context),
       tls_(context.threadLocal()) {
+  // The Report calls are spilled to disk by a single spill shared by the
+  // workers.
+  ReportSpillSharedPtr report_spill;
+  const auto& report_queue = filter_config_.sc_calling_config().report_queue();
+  if (!report_queue.disk_spill_dir().empty()) {
+    report_spill = std::make_shared<ReportSpill>(
+        report_queue.disk_spill_dir(), report_queue.disk_spill_max_bytes(),
+        context.api().threadFactory(), context.timeSource());
+  }
+
   // Pass shared_ptr of proto_config to the function capture so that
   // it will not be released when the function is called.
   tls_.set([proto_config, &config, stats_prefix, &scope = context.scope(),
             &cm = context.clusterManager(),
-            &time_source =
-                context.timeSource()](Envoy::Event::Dispatcher& dispatcher) {
-    return std::make_shared<ThreadLocalCache>(config, *proto_config,
-                                              stats_prefix, scope, cm,
-                                              time_source, dispatcher);
+            &time_source = context.timeSource(),
+            report_spill](Envoy::Event::Dispatcher& dispatcher) {
+    return std::make_shared<ThreadLocalCache>(
+        config, *proto_config, stats_prefix, scope, cm, time_source,
+        dispatcher, report_spill);
   });
 
   switch (filter_config_.access_token_case()) {
@@ -126,6 +136,8 @@ ServiceControlCallImpl::ServiceControlCallImpl(
     case FilterConfig::kIamToken:
       createIamTokenSub();
       break;
+    case FilterConfig::kNoAccessToken:
+      break;
     default:
       NOT_REACHED_GCOVR_EXCL_LINE;
   }
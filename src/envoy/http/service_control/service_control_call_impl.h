@@ -46,11 +46,12 @@ class ThreadLocalCache : public Envoy::ThreadLocal::ThreadLocalObject {
           filter_config,
       const std::string& stats_prefix, Envoy::Stats::Scope& scope,
       Envoy::Upstream::ClusterManager& cm, Envoy::TimeSource& time_source,
-      Envoy::Event::Dispatcher& dispatcher)
+      Envoy::Event::Dispatcher& dispatcher, ReportSpillSharedPtr report_spill)
       : client_cache_(
             config, filter_config, stats_prefix, scope, cm, time_source,
             dispatcher, [this]() -> const std::string& { return sc_token(); },
-            [this]() -> const std::string& { return quota_token(); }) {}
+            [this]() -> const std::string& { return quota_token(); },
+            report_spill) {}
 
   void set_sc_token(TokenSharedPtr sc_token) { sc_token_ = sc_token; }
   const std::string& sc_token() const {
@@ -26,6 +26,8 @@ constexpr char kFilterStateApiKey[] =
     "com.google.espv2.filters.http.service_control.api_key";
 constexpr char kFilterStateApiMethod[] =
     "com.google.espv2.filters.http.service_control.api_method";
+constexpr char kFilterStateApiKeyPresent[] =
+    "com.google.espv2.filters.http.service_control.api_key_present";
 
 // Sets a read only string value in the filter state.
 void setStringFilterState(Envoy::StreamInfo::FilterState& filter_state,
@@ -25,6 +25,7 @@ namespace utils {
 const char kRcDetailFilterServiceControl[] = "service_control";
 const char kRcDetailFilterBackendAuth[] = "backend_auth";
 const char kRcDetailFilterPathRewrite[] = "path_rewrite";
+const char kRcDetailFilterHeaderSizeLimit[] = "header_size_limit";
 
 // The error types
 //
@@ -47,6 +48,7 @@ const char kRcDetailErrorMissingMethod[] = "MISSING_METHOD";
 const char kRcDetailErrorMissingPath[] = "MISSING_PATH";
 const char kRcDetailErrorOversizePath[] = "OVERSIZE_PATH";
 const char kRcDetailErrorFragmentIdentifier[] = "PATH_WITH_FRAGMENT_IDENTIFIER";
+const char kRcDetailErrorOversizeHeaders[] = "OVERSIZE_HEADERS";
 
 // Generate a string for response code details in format of
 // `filter_name`_`error_type`_{`error_detail`}.
@@ -29,7 +29,7 @@ func CreateAdmin(opts options.CommonOptions) *bootstrappb.Admin {
 	}
 
 	return &bootstrappb.Admin{
-		AccessLogPath: "/dev/null",
+		AccessLogPath: opts.AdminAccessLogPath,
 		Address: &corepb.Address{
 			Address: &corepb.Address_SocketAddress{
 				SocketAddress: &corepb.SocketAddress{
@@ -26,9 +26,11 @@ import (
 
 func TestCreateAdmin(t *testing.T) {
 	testData := []struct {
-		desc      string
-		adminPort int
-		want      *bootstrappb.Admin
+		desc               string
+		adminPort          int
+		adminAddress       string
+		adminAccessLogPath string
+		want               *bootstrappb.Admin
 	}{
 		{
 			desc:      "Admin interface is disabled",
@@ -52,12 +54,37 @@ func TestCreateAdmin(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc:               "Admin interface is enabled, created with the address and access log",
+			adminPort:          8081,
+			adminAddress:       "127.0.0.1",
+			adminAccessLogPath: "/var/log/envoy_admin.log",
+			want: &bootstrappb.Admin{
+				AccessLogPath: "/var/log/envoy_admin.log",
+				Address: &corepb.Address{
+					Address: &corepb.Address_SocketAddress{
+						SocketAddress: &corepb.SocketAddress{
+							Address: "127.0.0.1",
+							PortSpecifier: &corepb.SocketAddress_PortValue{
+								PortValue: 8081,
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 
 	for _, tc := range testData {
 
 		opts := options.DefaultCommonOptions()
 		opts.AdminPort = tc.adminPort
+		if tc.adminAddress != "" {
+			opts.AdminAddress = tc.adminAddress
+		}
+		if tc.adminAccessLogPath != "" {
+			opts.AdminAccessLogPath = tc.adminAccessLogPath
+		}
 
 		got := CreateAdmin(opts)
 
@@ -34,7 +34,19 @@ func CreateBootstrapConfig(opts options.AdsBootstrapperOptions) (string, error)
 	// Parse ADS connect timeout
 	connectTimeoutProto := ptypes.DurationProto(opts.AdsConnectTimeout)
 
-	bt := &bootstrappb.Bootstrap{
+	// Both protocols are served by config manager, updates are pushed on the
+	// ADS stream as soon as a new snapshot is set.
+	apiType := corepb.ApiConfigSource_GRPC
+	if opts.AdsDeltaXds {
+		apiType = corepb.ApiConfigSource_DELTA_GRPC
+	}
+
+	statsSinks, err := bt.CreateStatsSinks(opts.CommonOptions)
+	if err != nil {
+		return "", err
+	}
+
+	bootstrap := &bootstrappb.Bootstrap{
 		// Node info
 		Node: bt.CreateNode(opts.CommonOptions),
 
@@ -44,6 +56,12 @@ func CreateBootstrapConfig(opts options.AdsBootstrapperOptions) (string, error)
 		// layer runtime
 		LayeredRuntime: bt.CreateLayeredRuntime(),
 
+		// stats sinks
+		StatsSinks: statsSinks,
+
+		// stats config
+		StatsConfig: bt.CreateStatsConfig(opts.CommonOptions),
+
 		// Dynamic resource
 		DynamicResources: &bootstrappb.Bootstrap_DynamicResources{
 			LdsConfig: &corepb.ConfigSource{
@@ -59,7 +77,7 @@ func CreateBootstrapConfig(opts options.AdsBootstrapperOptions) (string, error)
 				ResourceApiVersion: apiVersion,
 			},
 			AdsConfig: &corepb.ApiConfigSource{
-				ApiType:             corepb.ApiConfigSource_GRPC,
+				ApiType:             apiType,
 				TransportApiVersion: apiVersion,
 				GrpcServices: []*corepb.GrpcService{{
 					TargetSpecifier: &corepb.GrpcService_EnvoyGrpc_{
@@ -88,7 +106,9 @@ func CreateBootstrapConfig(opts options.AdsBootstrapperOptions) (string, error)
 		},
 	}
 
-	jsonStr, err := util.ProtoToJson(bt)
+	bt.AddLocalCluster(bootstrap, opts.CommonOptions)
+
+	jsonStr, err := util.ProtoToJson(bootstrap)
 	if err != nil {
 		return "", fmt.Errorf("failed to MarshalToString, error: %v", err)
 	}
@@ -25,6 +25,7 @@ import (
 
 var (
 	AdsConnectTimeout = flag.Duration("ads_connect_timeout", 10*time.Second, "ads connect timeout in seconds")
+	AdsDeltaXds       = flag.Bool("ads_delta_xds", false, "use the incremental (delta) xDS protocol to receive the listeners and clusters from config manager")
 )
 
 func DefaultBootstrapperOptionsFromFlags() options.AdsBootstrapperOptions {
@@ -32,6 +33,7 @@ func DefaultBootstrapperOptionsFromFlags() options.AdsBootstrapperOptions {
 	opts := options.AdsBootstrapperOptions{
 		CommonOptions:     common_option,
 		AdsConnectTimeout: *AdsConnectTimeout,
+		AdsDeltaXds:       *AdsDeltaXds,
 	}
 
 	glog.Infof("ADS Bootstrapper options: %+v", opts)
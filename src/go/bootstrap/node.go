@@ -18,14 +18,52 @@ import (
 	"fmt"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 
+	bootstrappb "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
+	clusterpb "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 )
 
 // CreateBootstrapConfig outputs Node struct for bootstrap config
 func CreateNode(opts options.CommonOptions) *corepb.Node {
-	return &corepb.Node{
+	node := &corepb.Node{
 		Id:      opts.Node,
 		Cluster: fmt.Sprintf("%s_cluster", opts.Node),
 	}
+	if opts.NodeRegion != "" || opts.NodeZone != "" {
+		node.Locality = &corepb.Locality{
+			Region: opts.NodeRegion,
+			Zone:   opts.NodeZone,
+		}
+	}
+	return node
+}
+
+// AddLocalCluster adds the cluster of this proxy in its zone as the local
+// cluster, required by the zone aware load balancing of the backends. Nothing
+// is added if the zone is unknown.
+func AddLocalCluster(bt *bootstrappb.Bootstrap, opts options.CommonOptions) {
+	if opts.NodeZone == "" {
+		return
+	}
+
+	// Envoy only uses the locality of the local cluster, and never connects to
+	// it.
+	loadAssignment := util.CreateLoadAssignment("127.0.0.1", uint32(opts.AdminPort))
+	loadAssignment.ClusterName = util.LocalProxyClusterName
+	loadAssignment.Endpoints[0].Locality = CreateNode(opts).GetLocality()
+	if bt.StaticResources == nil {
+		bt.StaticResources = &bootstrappb.Bootstrap_StaticResources{}
+	}
+	bt.StaticResources.Clusters = append(bt.StaticResources.Clusters, &clusterpb.Cluster{
+		Name: util.LocalProxyClusterName,
+		ClusterDiscoveryType: &clusterpb.Cluster_Type{
+			Type: clusterpb.Cluster_STATIC,
+		},
+		LoadAssignment: loadAssignment,
+	})
+	bt.ClusterManager = &bootstrappb.ClusterManager{
+		LocalClusterName: util.LocalProxyClusterName,
+	}
 }
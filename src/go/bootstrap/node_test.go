@@ -0,0 +1,105 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/proto"
+
+	bootstrappb "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
+	clusterpb "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+)
+
+func TestCreateNode(t *testing.T) {
+	testData := []struct {
+		desc       string
+		nodeRegion string
+		nodeZone   string
+		want       *corepb.Node
+	}{
+		{
+			desc: "Node without locality",
+			want: &corepb.Node{
+				Id:      "ESPv2",
+				Cluster: "ESPv2_cluster",
+			},
+		},
+		{
+			desc:       "Node with region and zone",
+			nodeRegion: "us-central1",
+			nodeZone:   "us-central1-a",
+			want: &corepb.Node{
+				Id:      "ESPv2",
+				Cluster: "ESPv2_cluster",
+				Locality: &corepb.Locality{
+					Region: "us-central1",
+					Zone:   "us-central1-a",
+				},
+			},
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultCommonOptions()
+		opts.NodeRegion = tc.nodeRegion
+		opts.NodeZone = tc.nodeZone
+
+		got := CreateNode(opts)
+
+		if !proto.Equal(got, tc.want) {
+			t.Errorf("Test (%s): failed, got: %v, want: %v", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestAddLocalCluster(t *testing.T) {
+	opts := options.DefaultCommonOptions()
+	bt := &bootstrappb.Bootstrap{}
+	AddLocalCluster(bt, opts)
+	if bt.StaticResources != nil || bt.ClusterManager != nil {
+		t.Errorf("got local cluster without the node zone: %v", bt)
+	}
+
+	opts.NodeZone = "us-central1-a"
+	AddLocalCluster(bt, opts)
+	loadAssignment := util.CreateLoadAssignment("127.0.0.1", 8001)
+	loadAssignment.ClusterName = "local-proxy-cluster"
+	loadAssignment.Endpoints[0].Locality = &corepb.Locality{
+		Zone: "us-central1-a",
+	}
+	want := &bootstrappb.Bootstrap{
+		StaticResources: &bootstrappb.Bootstrap_StaticResources{
+			Clusters: []*clusterpb.Cluster{
+				{
+					Name: "local-proxy-cluster",
+					ClusterDiscoveryType: &clusterpb.Cluster_Type{
+						Type: clusterpb.Cluster_STATIC,
+					},
+					LoadAssignment: loadAssignment,
+				},
+			},
+		},
+		ClusterManager: &bootstrappb.ClusterManager{
+			LocalClusterName: "local-proxy-cluster",
+		},
+	}
+	if !proto.Equal(bt, want) {
+		t.Errorf("got bootstrap: %v, want: %v", bt, want)
+	}
+}
@@ -36,10 +36,24 @@ func ServiceToBootstrapConfig(serviceConfig *confpb.Service, id string, opts opt
 		LayeredRuntime: bootstrap.CreateLayeredRuntime(),
 	}
 
+	statsSinks, err := bootstrap.CreateStatsSinks(opts.CommonOptions)
+	if err != nil {
+		return nil, err
+	}
+	bt.StatsSinks = statsSinks
+	bt.StatsConfig = bootstrap.CreateStatsConfig(opts.CommonOptions)
+
 	serviceInfo, err := sc.NewServiceInfoFromServiceConfig(serviceConfig, id, opts)
 	if err != nil {
 		return nil, fmt.Errorf("fail to initialize ServiceInfo, %s", err)
 	}
+	// The routes of the static bootstrap are never regenerated when the daily
+	// windows open or close.
+	for operation, method := range serviceInfo.Methods {
+		if method.FeatureGate != nil && len(method.FeatureGate.Windows) > 0 {
+			return nil, fmt.Errorf("the daily windows of x-google-feature-gate of operation (%v) are only supported by the config manager", operation)
+		}
+	}
 
 	clusters, err := gen.MakeClusters(serviceInfo)
 	if err != nil {
@@ -54,5 +68,6 @@ func ServiceToBootstrapConfig(serviceConfig *confpb.Service, id string, opts opt
 		Listeners: listeners,
 		Clusters:  clusters,
 	}
+	bootstrap.AddLocalCluster(bt, opts.CommonOptions)
 	return bt, nil
 }
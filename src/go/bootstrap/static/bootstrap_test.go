@@ -20,6 +20,7 @@ import (
 	"io/ioutil"
 	"testing"
 
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configmanager/flags"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
@@ -176,3 +177,22 @@ func bootstrapToJson(protoMsg *bootstrappb.Bootstrap) (string, error) {
 	outputString, err := json.Marshal(jsonObject)
 	return string(outputString), err
 }
+
+func TestServiceToBootstrapConfigFeatureGateWindows(t *testing.T) {
+	serviceConfig, err := configinfo.ServiceConfigFromOpenAPI([]byte(`{
+  "swagger": "2.0",
+  "info": {"title": "Echo", "version": "1.0.0"},
+  "host": "echo.endpoints",
+  "paths": {"/echo": {"post": {"operationId": "echo", "x-google-feature-gate": {"windows": ["09:00-17:00"]}}}}
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.DisableTracing = true
+
+	wantError := "the daily windows of x-google-feature-gate of operation (1.echo_endpoints.Echo) are only supported by the config manager"
+	if _, err := ServiceToBootstrapConfig(serviceConfig, FakeConfigID, opts); err == nil || err.Error() != wantError {
+		t.Errorf("got error: %v, want error: %v", err, wantError)
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fixture turns the service configs of real deployments into the
+// static bootstrap test fixtures under examples/testdata/fixtures.
+package fixture
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/bootstrap/static"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	anypb "github.com/golang/protobuf/ptypes/any"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	smpb "google.golang.org/genproto/googleapis/api/servicemanagement/v1"
+)
+
+const (
+	// The files of a fixture directory.
+	ServiceConfigFile = "service_config_generated.json"
+	EnvoyConfigFile   = "envoy_config.json"
+	OptionsFile       = "fixture.json"
+
+	// The identifiers of the sanitized service configs.
+	SanitizedServiceName = "fixture.endpoints.sanitized-project.cloud.goog"
+	SanitizedProjectId   = "sanitized-project"
+	SanitizedConfigId    = "2021-01-01r0"
+	sanitizedBackendHost = "backend-%d.example.com"
+)
+
+// Options are the config generator options of a fixture which can not be
+// derived from the service config.
+type Options struct {
+	BackendAddress string `json:"backend_address"`
+}
+
+// ConfigGeneratorOptions returns the options the golden Envoy config of a
+// fixture is generated with.
+func (o Options) ConfigGeneratorOptions() options.ConfigGeneratorOptions {
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.AdminPort = 0
+	opts.BackendAddress = o.BackendAddress
+	opts.DisableTracing = true
+	// The fixtures are generated with the jwks_uri resolved, keep the tests
+	// hermetic.
+	opts.DisableOidcDiscovery = true
+	return opts
+}
+
+// Sanitize returns a copy of the service config with the identifiers of the
+// deployment replaced and the parts not used by the config generator removed.
+func Sanitize(serviceConfig *confpb.Service) (*confpb.Service, error) {
+	s := proto.Clone(serviceConfig).(*confpb.Service)
+	s.Id = SanitizedConfigId
+	s.Title = ""
+	s.Documentation = nil
+
+	// Only the proto descriptors in the source files are used for transcoding,
+	// the OpenAPI specs and the protos may reveal more than the config.
+	if s.SourceInfo != nil {
+		var sourceFiles []*anypb.Any
+		for _, sourceFile := range s.SourceInfo.SourceFiles {
+			configFile := &smpb.ConfigFile{}
+			if err := ptypes.UnmarshalAny(sourceFile, configFile); err != nil {
+				return nil, fmt.Errorf("fail to unmarshal source file: %v", err)
+			}
+			if configFile.FileType != smpb.ConfigFile_FILE_DESCRIPTOR_SET_PROTO {
+				continue
+			}
+			configFile.FilePath = "api_descriptor.pb"
+			a, err := ptypes.MarshalAny(configFile)
+			if err != nil {
+				return nil, fmt.Errorf("fail to marshal source file: %v", err)
+			}
+			sourceFiles = append(sourceFiles, a)
+		}
+		s.SourceInfo.SourceFiles = sourceFiles
+	}
+
+	marshaler := &jsonpb.Marshaler{AnyResolver: util.Resolver}
+	configJson, err := marshaler.MarshalToString(s)
+	if err != nil {
+		return nil, fmt.Errorf("fail to marshal service config: %v", err)
+	}
+	var jsonObject interface{}
+	if err := json.Unmarshal([]byte(configJson), &jsonObject); err != nil {
+		return nil, fmt.Errorf("fail to unmarshal service config: %v", err)
+	}
+	sanitizedJson, err := json.Marshal(replaceIdentifiers(jsonObject, identifierReplacements(serviceConfig)))
+	if err != nil {
+		return nil, fmt.Errorf("fail to marshal service config: %v", err)
+	}
+
+	sanitized := &confpb.Service{}
+	unmarshaler := &jsonpb.Unmarshaler{AnyResolver: util.Resolver}
+	if err := unmarshaler.Unmarshal(bytes.NewReader(sanitizedJson), sanitized); err != nil {
+		return nil, fmt.Errorf("fail to unmarshal sanitized service config: %v", err)
+	}
+	return sanitized, nil
+}
+
+type replacement struct {
+	from, to string
+}
+
+// identifierReplacements returns the replacements of the service name, the
+// producer project and the backend hosts, longest first so the service name
+// is replaced before the project it contains.
+func identifierReplacements(s *confpb.Service) []replacement {
+	var replacements []replacement
+	if s.Name != "" {
+		replacements = append(replacements, replacement{s.Name, SanitizedServiceName})
+	}
+	if s.ProducerProjectId != "" {
+		replacements = append(replacements, replacement{s.ProducerProjectId, SanitizedProjectId})
+	}
+
+	hosts := make(map[string]bool)
+	for _, rule := range s.GetBackend().GetRules() {
+		if rule.Address == "" {
+			continue
+		}
+		_, hostname, _, _, err := util.ParseURI(rule.Address)
+		if err != nil || hostname == "" || hosts[hostname] {
+			continue
+		}
+		hosts[hostname] = true
+	}
+	var sortedHosts []string
+	for host := range hosts {
+		sortedHosts = append(sortedHosts, host)
+	}
+	sort.Strings(sortedHosts)
+	for i, host := range sortedHosts {
+		replacements = append(replacements, replacement{host, fmt.Sprintf(sanitizedBackendHost, i)})
+	}
+
+	sort.SliceStable(replacements, func(i, j int) bool {
+		return len(replacements[i].from) > len(replacements[j].from)
+	})
+	return replacements
+}
+
+// replaceIdentifiers replaces the identifiers in the string values of the
+// JSON object. The keys are kept, and so are the source file contents, which
+// are binary. An identifier is only replaced as a whole, e.g. the project
+// acme is replaced in gateway@acme.iam.gserviceaccount.com but not in
+// acme-prod or 1.acme_bookstore.Get.
+func replaceIdentifiers(v interface{}, replacements []replacement) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if key == "fileContents" {
+				continue
+			}
+			v[key] = replaceIdentifiers(value, replacements)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = replaceIdentifiers(value, replacements)
+		}
+	case string:
+		for _, r := range replacements {
+			v = replaceIdentifier(v, r)
+		}
+		return v
+	}
+	return v
+}
+
+// replaceIdentifier replaces the occurrences of the identifier which are not
+// part of a longer name, i.e. not adjacent to a letter, a digit or '-', '_'.
+func replaceIdentifier(s string, r replacement) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, r.from)
+		if i < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		end := i + len(r.from)
+		if (i == 0 || !isNameChar(s[i-1])) && (end == len(s) || !isNameChar(s[end])) {
+			b.WriteString(s[:i])
+			b.WriteString(r.to)
+		} else {
+			b.WriteString(s[:end])
+		}
+		s = s[end:]
+	}
+}
+
+func isNameChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_'
+}
+
+// Write sanitizes the service config and writes it to the fixture directory,
+// along with the options and the golden Envoy config generated from them.
+func Write(dir string, serviceConfig *confpb.Service, opts Options) error {
+	sanitized, err := Sanitize(serviceConfig)
+	if err != nil {
+		return err
+	}
+
+	bt, err := static.ServiceToBootstrapConfig(sanitized, SanitizedConfigId, opts.ConfigGeneratorOptions())
+	if err != nil {
+		return fmt.Errorf("fail to generate the envoy config: %v", err)
+	}
+
+	marshaler := &jsonpb.Marshaler{AnyResolver: util.Resolver}
+	files := make(map[string][]byte)
+	if files[ServiceConfigFile], err = formatProto(marshaler, sanitized); err != nil {
+		return err
+	}
+	if files[EnvoyConfigFile], err = formatProto(marshaler, bt); err != nil {
+		return err
+	}
+	if files[OptionsFile], err = formatJson(opts); err != nil {
+		return err
+	}
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			return fmt.Errorf("fail to write %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// Read reads the sanitized service config and the options of a fixture
+// directory.
+func Read(dir string) (*confpb.Service, Options, error) {
+	var opts Options
+	optsBytes, err := ioutil.ReadFile(filepath.Join(dir, OptionsFile))
+	if err != nil {
+		return nil, opts, err
+	}
+	if err := json.Unmarshal(optsBytes, &opts); err != nil {
+		return nil, opts, fmt.Errorf("fail to unmarshal %s: %v", OptionsFile, err)
+	}
+
+	configBytes, err := ioutil.ReadFile(filepath.Join(dir, ServiceConfigFile))
+	if err != nil {
+		return nil, opts, err
+	}
+	serviceConfig := &confpb.Service{}
+	unmarshaler := &jsonpb.Unmarshaler{AnyResolver: util.Resolver}
+	if err := unmarshaler.Unmarshal(bytes.NewBuffer(configBytes), serviceConfig); err != nil {
+		return nil, opts, fmt.Errorf("fail to unmarshal %s: %v", ServiceConfigFile, err)
+	}
+	return serviceConfig, opts, nil
+}
+
+// formatProto formats the proto the same way as scripts/format-examples.sh,
+// indented with the keys sorted.
+func formatProto(marshaler *jsonpb.Marshaler, msg proto.Message) ([]byte, error) {
+	msgJson, err := marshaler.MarshalToString(msg)
+	if err != nil {
+		return nil, fmt.Errorf("fail to marshal %T: %v", msg, err)
+	}
+	var jsonObject interface{}
+	if err := json.Unmarshal([]byte(msgJson), &jsonObject); err != nil {
+		return nil, err
+	}
+	return formatJson(jsonObject)
+}
+
+func formatJson(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
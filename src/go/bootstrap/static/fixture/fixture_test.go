@@ -0,0 +1,319 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fixture
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/bootstrap/static"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/GoogleCloudPlatform/esp-v2/tests/env/platform"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	descpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	anypb "github.com/golang/protobuf/ptypes/any"
+	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	smpb "google.golang.org/genproto/googleapis/api/servicemanagement/v1"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func fakeDescriptor(t *testing.T) []byte {
+	descriptor, err := proto.Marshal(&descpb.FileDescriptorSet{
+		File: []*descpb.FileDescriptorProto{
+			{
+				Name: proto.String("bookstore.proto"),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return descriptor
+}
+
+func fakeServiceConfig(t *testing.T) *confpb.Service {
+	descriptor, err := ptypes.MarshalAny(&smpb.ConfigFile{
+		FilePath:     "bookstore.pb",
+		FileContents: fakeDescriptor(t),
+		FileType:     smpb.ConfigFile_FILE_DESCRIPTOR_SET_PROTO,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	openapi, err := ptypes.MarshalAny(&smpb.ConfigFile{
+		FilePath:     "openapi.yaml",
+		FileContents: []byte("swagger: 2.0"),
+		FileType:     smpb.ConfigFile_OPEN_API_YAML,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &confpb.Service{
+		Name:              "bookstore.endpoints.acme-prod.cloud.goog",
+		Id:                "2021-06-01r3",
+		Title:             "Acme Bookstore",
+		ProducerProjectId: "acme-prod",
+		Documentation: &confpb.Documentation{
+			Summary: "Internal bookstore of Acme",
+		},
+		Apis: []*apipb.Api{
+			{
+				Name: "endpoints.examples.bookstore.Bookstore",
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/shelves",
+					},
+				},
+			},
+		},
+		Backend: &confpb.Backend{
+			Rules: []*confpb.BackendRule{
+				{
+					Selector:        "endpoints.examples.bookstore.Bookstore.ListShelves",
+					Address:         "https://shelves-abc123-uc.a.run.app/v1",
+					PathTranslation: confpb.BackendRule_APPEND_PATH_TO_ADDRESS,
+				},
+			},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "acme_sa",
+					Issuer:  "gateway@acme-prod.iam.gserviceaccount.com",
+					JwksUri: "https://www.googleapis.com/service_accounts/v1/jwk/gateway@acme-prod.iam.gserviceaccount.com",
+				},
+			},
+		},
+		Control: &confpb.Control{
+			Environment: "servicecontrol.googleapis.com",
+		},
+		SourceInfo: &confpb.SourceInfo{
+			SourceFiles: []*anypb.Any{descriptor, openapi},
+		},
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	descriptor, err := ptypes.MarshalAny(&smpb.ConfigFile{
+		FilePath:     "api_descriptor.pb",
+		FileContents: fakeDescriptor(t),
+		FileType:     smpb.ConfigFile_FILE_DESCRIPTOR_SET_PROTO,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &confpb.Service{
+		Name:              SanitizedServiceName,
+		Id:                SanitizedConfigId,
+		ProducerProjectId: SanitizedProjectId,
+		Apis: []*apipb.Api{
+			{
+				Name: "endpoints.examples.bookstore.Bookstore",
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/shelves",
+					},
+				},
+			},
+		},
+		Backend: &confpb.Backend{
+			Rules: []*confpb.BackendRule{
+				{
+					Selector:        "endpoints.examples.bookstore.Bookstore.ListShelves",
+					Address:         "https://backend-0.example.com/v1",
+					PathTranslation: confpb.BackendRule_APPEND_PATH_TO_ADDRESS,
+				},
+			},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "acme_sa",
+					Issuer:  "gateway@sanitized-project.iam.gserviceaccount.com",
+					JwksUri: "https://www.googleapis.com/service_accounts/v1/jwk/gateway@sanitized-project.iam.gserviceaccount.com",
+				},
+			},
+		},
+		Control: &confpb.Control{
+			Environment: "servicecontrol.googleapis.com",
+		},
+		SourceInfo: &confpb.SourceInfo{
+			SourceFiles: []*anypb.Any{descriptor},
+		},
+	}
+
+	serviceConfig := fakeServiceConfig(t)
+	got, err := Sanitize(serviceConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("got sanitized service config: %v, want: %v", got, want)
+	}
+	if serviceConfig.Name != "bookstore.endpoints.acme-prod.cloud.goog" {
+		t.Errorf("the original service config is modified: %v", serviceConfig)
+	}
+}
+
+func TestReplaceIdentifier(t *testing.T) {
+	testCases := []struct {
+		in   string
+		from string
+		want string
+	}{
+		{
+			in:   "acme",
+			from: "acme",
+			want: "sanitized",
+		},
+		{
+			in:   "gateway@acme.iam.gserviceaccount.com",
+			from: "acme",
+			want: "gateway@sanitized.iam.gserviceaccount.com",
+		},
+		{
+			in:   "projects/acme/acme-prod/acme",
+			from: "acme",
+			want: "projects/sanitized/acme-prod/sanitized",
+		},
+		{
+			in:   "1.acme_bookstore.Get",
+			from: "acme",
+			want: "1.acme_bookstore.Get",
+		},
+		{
+			in:   "superacme",
+			from: "acme",
+			want: "superacme",
+		},
+	}
+
+	for _, tc := range testCases {
+		if got := replaceIdentifier(tc.in, replacement{tc.from, "sanitized"}); got != tc.want {
+			t.Errorf("replaceIdentifier(%q, %q): got %q, want %q", tc.in, tc.from, got, tc.want)
+		}
+	}
+}
+
+func TestSanitizeKeepsKeys(t *testing.T) {
+	serviceConfig := fakeServiceConfig(t)
+	// The project id is also a key of the service config JSON.
+	serviceConfig.ProducerProjectId = "selector"
+
+	got, err := Sanitize(serviceConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ProducerProjectId != SanitizedProjectId {
+		t.Errorf("got producer project id: %s, want: %s", got.ProducerProjectId, SanitizedProjectId)
+	}
+	if gotSelector := got.GetHttp().GetRules()[0].GetSelector(); gotSelector != "endpoints.examples.bookstore.Bookstore.ListShelves" {
+		t.Errorf("got http rule selector: %s, want it unchanged", gotSelector)
+	}
+}
+
+func TestWriteAndRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := Options{
+		BackendAddress: "grpc://127.0.0.1:8082",
+	}
+	if err := Write(dir, fakeServiceConfig(t), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	gotConfig, gotOpts, err := Read(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotOpts != opts {
+		t.Errorf("got options: %v, want: %v", gotOpts, opts)
+	}
+	if gotConfig.Name != SanitizedServiceName {
+		t.Errorf("got service name: %s, want: %s", gotConfig.Name, SanitizedServiceName)
+	}
+	checkFixture(t, dir)
+}
+
+// TestFixtures checks the envoy config generated for each fixture still
+// matches its golden envoy config.
+func TestFixtures(t *testing.T) {
+	dirs, err := filepath.Glob(filepath.Join(platform.GetFilePath(platform.FixturesFolder), "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) == 0 {
+		t.Fatalf("no fixture found in %s", platform.GetFilePath(platform.FixturesFolder))
+	}
+	for _, dir := range dirs {
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			checkFixture(t, dir)
+		})
+	}
+}
+
+func checkFixture(t *testing.T, dir string) {
+	serviceConfig, opts, err := Read(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bt, err := static.ServiceToBootstrapConfig(serviceConfig, SanitizedConfigId, opts.ConfigGeneratorOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := formatProto(&jsonpb.Marshaler{AnyResolver: util.Resolver}, bt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := ioutil.ReadFile(filepath.Join(dir, EnvoyConfigFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := util.JsonEqual(string(want), string(got)); err != nil {
+		t.Errorf("the envoy config of fixture %s changed, regenerate it if expected: %v", dir, err)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The fixture generator fetches the service config of a real deployment and
+// writes it as a static bootstrap test fixture, e.g.
+//
+//	go run ./src/go/bootstrap/static/fixture/main \
+//	  --service=SERVICE --access_token="$(gcloud auth print-access-token)" \
+//	  --backend_address=grpc://127.0.0.1:8082 \
+//	  examples/testdata/fixtures/NAME
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/bootstrap/static/fixture"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/tokengenerator"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/glog"
+
+	sc "github.com/GoogleCloudPlatform/esp-v2/src/go/serviceconfig"
+)
+
+var (
+	service              = flag.String("service", "", "the name of the service to fetch the config of.")
+	serviceConfigId      = flag.String("service_config_id", "", "the id of the config to fetch, the latest rollout if not set.")
+	serviceManagementURL = flag.String("service_management_url", "https://servicemanagement.googleapis.com", "url of service management server.")
+	serviceAccountKey    = flag.String("service_account_key", "", "the service account key JSON file to fetch the config with.")
+	accessToken          = flag.String("access_token", "", "the access token to fetch the config with if --service_account_key is not set, e.g. from gcloud auth print-access-token.")
+	backendAddress       = flag.String("backend_address", "http://127.0.0.1:8082", "the backend address of the deployment to generate the envoy config for.")
+)
+
+func main() {
+	flag.Parse()
+	outDir := flag.Arg(0)
+	if outDir == "" {
+		glog.Exitf("Please specify the fixture directory to write to")
+	}
+	if *service == "" {
+		glog.Exitf("Flag --service is required")
+	}
+	if *serviceAccountKey == "" && *accessToken == "" {
+		glog.Exitf("Either flag --service_account_key or --access_token is required")
+	}
+
+	getAccessToken := func() (string, time.Duration, error) {
+		if *serviceAccountKey != "" {
+			return tokengenerator.GenerateAccessTokenFromFile(*serviceAccountKey)
+		}
+		return *accessToken, time.Hour, nil
+	}
+	fetcher := sc.NewServiceConfigFetcher(&http.Client{Timeout: 30 * time.Second}, *serviceManagementURL, *service, getAccessToken)
+
+	configId := *serviceConfigId
+	if configId == "" {
+		var err error
+		if configId, err = fetcher.LoadConfigIdFromRollouts(); err != nil {
+			glog.Exitf("failed to load the config id from the rollouts, error: %v", err)
+		}
+	}
+	serviceConfig, err := fetcher.FetchConfig(configId)
+	if err != nil {
+		glog.Exitf("failed to fetch the service config, error: %v", err)
+	}
+
+	// The fixtures are tested without OpenID Connect Discovery.
+	for _, provider := range serviceConfig.GetAuthentication().GetProviders() {
+		if provider.JwksUri != "" {
+			continue
+		}
+		if provider.JwksUri, err = util.ResolveJwksUriUsingOpenID(provider.Issuer, "", 0); err != nil {
+			glog.Exitf("failed to resolve the jwks_uri of provider %s, error: %v", provider.Id, err)
+		}
+	}
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		glog.Exitf("failed to create %v, error: %v", outDir, err)
+	}
+	if err := fixture.Write(outDir, serviceConfig, fixture.Options{BackendAddress: *backendAddress}); err != nil {
+		glog.Exitf("failed to write the fixture to %v, error: %v", outDir, err)
+	}
+	glog.Infof("Wrote the fixture of service %s config %s to %s", *service, configId, outDir)
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package static
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/GoogleCloudPlatform/esp-v2/tests/env/platform"
+)
+
+// FuzzServiceToBootstrapConfig feeds arbitrary service configs into the config
+// generation pipeline. The generation may reject a config, but it must never
+// panic or produce an Envoy config that fails the proto validation.
+//
+// The seed corpus is built from the service configs of the examples, run it with:
+//
+//	go test ./src/go/bootstrap/static -run=^$ -fuzz=FuzzServiceToBootstrapConfig
+func FuzzServiceToBootstrapConfig(f *testing.F) {
+	for _, file := range []platform.RuntimeFile{
+		platform.ScServiceConfig,
+		platform.AuthServiceConfig,
+		platform.DrServiceConfig,
+		platform.RmServiceConfig,
+		platform.GrpcEchoServiceConfig,
+		platform.SbServiceConfig,
+	} {
+		config, err := ioutil.ReadFile(platform.GetFilePath(file))
+		if err != nil {
+			f.Fatalf("ReadFile failed, got %v", err)
+		}
+		f.Add(config)
+	}
+
+	f.Fuzz(func(t *testing.T, config []byte) {
+		serviceConfig, err := util.UnmarshalServiceConfig(bytes.NewReader(config))
+		if err != nil {
+			return
+		}
+
+		// Avoid external calls to the metadata server and the OpenID providers.
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.DisableTracing = true
+		opts.DisableOidcDiscovery = true
+
+		bootstrap, err := ServiceToBootstrapConfig(serviceConfig, FakeConfigID, opts)
+		if err != nil {
+			return
+		}
+		if err := bootstrap.Validate(); err != nil {
+			t.Errorf("generated an invalid Envoy config: %v", err)
+		}
+	})
+}
@@ -0,0 +1,43 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+
+	metricspb "github.com/envoyproxy/go-control-plane/envoy/config/metrics/v3"
+)
+
+// CreateStatsConfig outputs the stats config for bootstrap config.
+//
+// With --enable_operation_stats, the config generator adds a virtual cluster
+// per operation, and their stats are tagged by the operation name.
+func CreateStatsConfig(opts options.CommonOptions) *metricspb.StatsConfig {
+	if !opts.EnableOperationStats {
+		return nil
+	}
+
+	return &metricspb.StatsConfig{
+		StatsTags: []*metricspb.TagSpecifier{
+			{
+				TagName: util.OperationStatsTag,
+				TagValue: &metricspb.TagSpecifier_Regex{
+					Regex: util.OperationStatsTagRegex,
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+)
+
+func TestCreateStatsConfig(t *testing.T) {
+	opts := options.DefaultCommonOptions()
+	if got := CreateStatsConfig(opts); got != nil {
+		t.Errorf("want no stats config by default, got: %v", got)
+	}
+
+	opts.EnableOperationStats = true
+	got := CreateStatsConfig(opts)
+	if err := got.Validate(); err != nil {
+		t.Fatalf("got invalid stats config: %v", err)
+	}
+
+	// The tag is extracted from the stats of the generated virtual clusters.
+	statName := "vhost.backend.vcluster." + util.OperationStatName("1.echo_api_endpoints_cloudesf_testing_cloud_goog.Echo") + ".upstream_rq_200"
+	match := regexp.MustCompile(got.GetStatsTags()[0].GetRegex()).FindStringSubmatch(statName)
+	if match == nil {
+		t.Fatalf("stats tag regex does not match stat name %s", statName)
+	}
+	if want := "1_echo_api_endpoints_cloudesf_testing_cloud_goog_Echo"; match[2] != want {
+		t.Errorf("got operation tag value: %s, want: %s", match[2], want)
+	}
+}
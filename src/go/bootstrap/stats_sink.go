@@ -0,0 +1,108 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+
+	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	metricspb "github.com/envoyproxy/go-control-plane/envoy/config/metrics/v3"
+)
+
+const (
+	StatsdSinkType    = "statsd"
+	DogStatsdSinkType = "dogstatsd"
+)
+
+// CreateStatsSinks outputs the stats sinks for bootstrap config, so that
+// Envoy flushes its stats to a statsd or dogstatsd server over UDP.
+func CreateStatsSinks(opts options.CommonOptions) ([]*metricspb.StatsSink, error) {
+	if opts.StatsSinkAddress == "" {
+		return nil, nil
+	}
+
+	address, err := createStatsSinkAddress(opts.StatsSinkAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	var name string
+	var sink *any.Any
+	switch opts.StatsSinkType {
+	case StatsdSinkType:
+		name = "envoy.stat_sinks.statsd"
+		sink, err = ptypes.MarshalAny(&metricspb.StatsdSink{
+			StatsdSpecifier: &metricspb.StatsdSink_Address{
+				Address: address,
+			},
+			Prefix: opts.StatsSinkPrefix,
+		})
+	case DogStatsdSinkType:
+		name = "envoy.stat_sinks.dog_statsd"
+		sink, err = ptypes.MarshalAny(&metricspb.DogStatsdSink{
+			DogStatsdSpecifier: &metricspb.DogStatsdSink_Address{
+				Address: address,
+			},
+			Prefix: opts.StatsSinkPrefix,
+		})
+	default:
+		return nil, fmt.Errorf(`invalid stats_sink_type %q, must be either "statsd" or "dogstatsd"`, opts.StatsSinkType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return []*metricspb.StatsSink{
+		{
+			Name: name,
+			ConfigType: &metricspb.StatsSink_TypedConfig{
+				TypedConfig: sink,
+			},
+		},
+	}, nil
+}
+
+func createStatsSinkAddress(hostPort string) (*corepb.Address, error) {
+	host, portStr, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stats_sink_address %s, should be in IP:port format: %v", hostPort, err)
+	}
+	// Envoy does not resolve the hostnames of the UDP stats sinks.
+	if net.ParseIP(host) == nil {
+		return nil, fmt.Errorf("invalid stats_sink_address %s, the host must be an IP address", hostPort)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil || port == 0 {
+		return nil, fmt.Errorf("invalid stats_sink_address %s, the port must be in range [1, 65535]", hostPort)
+	}
+
+	return &corepb.Address{
+		Address: &corepb.Address_SocketAddress{
+			SocketAddress: &corepb.SocketAddress{
+				Protocol: corepb.SocketAddress_UDP,
+				Address:  host,
+				PortSpecifier: &corepb.SocketAddress_PortValue{
+					PortValue: uint32(port),
+				},
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+
+	bootstrappb "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
+)
+
+func TestCreateStatsSinks(t *testing.T) {
+	testData := []struct {
+		desc      string
+		sinkType  string
+		address   string
+		prefix    string
+		want      string
+		wantError string
+	}{
+		{
+			desc: "Stats sink is disabled",
+			want: `{}`,
+		},
+		{
+			desc:     "Statsd sink",
+			sinkType: "statsd",
+			address:  "127.0.0.1:8125",
+			prefix:   "espv2",
+			want: `{
+  "statsSinks": [
+    {
+      "name": "envoy.stat_sinks.statsd",
+      "typedConfig": {
+        "@type": "type.googleapis.com/envoy.config.metrics.v3.StatsdSink",
+        "address": {
+          "socketAddress": {
+            "address": "127.0.0.1",
+            "portValue": 8125,
+            "protocol": "UDP"
+          }
+        },
+        "prefix": "espv2"
+      }
+    }
+  ]
+}`,
+		},
+		{
+			desc:     "Dogstatsd sink with an IPv6 address",
+			sinkType: "dogstatsd",
+			address:  "[::1]:8125",
+			want: `{
+  "statsSinks": [
+    {
+      "name": "envoy.stat_sinks.dog_statsd",
+      "typedConfig": {
+        "@type": "type.googleapis.com/envoy.config.metrics.v3.DogStatsdSink",
+        "address": {
+          "socketAddress": {
+            "address": "::1",
+            "portValue": 8125,
+            "protocol": "UDP"
+          }
+        }
+      }
+    }
+  ]
+}`,
+		},
+		{
+			desc:      "Unknown sink type",
+			sinkType:  "prometheus",
+			address:   "127.0.0.1:8125",
+			wantError: `invalid stats_sink_type "prometheus", must be either "statsd" or "dogstatsd"`,
+		},
+		{
+			desc:      "Address without port",
+			sinkType:  "statsd",
+			address:   "127.0.0.1",
+			wantError: "invalid stats_sink_address 127.0.0.1, should be in IP:port format: address 127.0.0.1: missing port in address",
+		},
+		{
+			desc:      "Hostname is not supported",
+			sinkType:  "statsd",
+			address:   "statsd.local:8125",
+			wantError: "invalid stats_sink_address statsd.local:8125, the host must be an IP address",
+		},
+		{
+			desc:      "Invalid port",
+			sinkType:  "statsd",
+			address:   "127.0.0.1:0",
+			wantError: "invalid stats_sink_address 127.0.0.1:0, the port must be in range [1, 65535]",
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultCommonOptions()
+		opts.StatsSinkType = tc.sinkType
+		opts.StatsSinkAddress = tc.address
+		opts.StatsSinkPrefix = tc.prefix
+
+		sinks, err := CreateStatsSinks(opts)
+		if err != nil {
+			if err.Error() != tc.wantError {
+				t.Errorf("Test (%s): got error: %v, want error: %s", tc.desc, err, tc.wantError)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test (%s): got no error, want error: %s", tc.desc, tc.wantError)
+			continue
+		}
+
+		got, err := util.ProtoToJson(&bootstrappb.Bootstrap{StatsSinks: sinks})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := util.JsonEqual(tc.want, got); err != nil {
+			t.Errorf("Test (%s): failed, %v", tc.desc, err)
+		}
+	}
+}
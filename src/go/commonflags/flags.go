@@ -27,24 +27,34 @@ var (
 	// Any flags in this file are used by both the ADS Bootstrapper (startup) and Config Generation via the static bootstrapper or config manager.
 	// These flags are kept in sync with options.CommonOptions.
 	// When adding or changing default values, update options.DefaultCommonOptions.
-	AdminAddress               = flag.String("admin_address", "0.0.0.0", "Address that envoy should serve the admin page on. Supports both ipv4 and ipv6 addresses.")
-	AdsNamedPipe               = flag.String("ads_named_pipe", "@espv2-ads-cluster", "Unix domain socket to use internally for xDs between config manager and envoy.")
-	DisableTracing             = flag.Bool("disable_tracing", false, `Disable stackdriver tracing`)
-	AdminPort                  = flag.Int("admin_port", 8001, "Enables envoy's admin interface on this port if it is not 0. Not recommended for production use-cases, as the admin port is unauthenticated.")
-	HttpRequestTimeoutS        = flag.Int("http_request_timeout_s", 30, `Set the timeout in second for all requests. Must be > 0 and the default is 30 seconds if not set.`)
-	Node                       = flag.String("node", "ESPv2", "envoy node id")
-	NonGCP                     = flag.Bool("non_gcp", false, `By default, the proxy tries to talk to GCP metadata server to get VM location in the first few requests. Setting this flag to true to skip this step`)
-	GeneratedHeaderPrefix      = flag.String("generated_header_prefix", "X-Endpoint-", "Set the header prefix for the generated headers. By default, it is `X-Endpoint-`")
-	TracingProjectId           = flag.String("tracing_project_id", "", "The Google project id required for Stack driver tracing. If not set, will automatically use fetch it from GCP Metadata server")
-	TracingStackdriverAddress  = flag.String("tracing_stackdriver_address", "", "By default, the Stackdriver exporter will connect to production Stackdriver. If this is non-empty, it will connect to this address. It must be in the gRPC format and implement the cloud trace v2 RPCs.")
+	AdminAddress              = flag.String("admin_address", "0.0.0.0", "Address that envoy should serve the admin page on. Supports both ipv4 and ipv6 addresses.")
+	AdminAccessLogPath        = flag.String("admin_access_log_path", "/dev/null", "The path to write the access log of envoy's admin interface to. The access log is discarded by default.")
+	AdsNamedPipe              = flag.String("ads_named_pipe", "@espv2-ads-cluster", "Unix domain socket to use internally for xDs between config manager and envoy.")
+	DisableTracing            = flag.Bool("disable_tracing", false, `Disable stackdriver tracing`)
+	AdminPort                 = flag.Int("admin_port", 8001, "Enables envoy's admin interface on this port if it is not 0. Not recommended for production use-cases, as the admin port is unauthenticated.")
+	HttpRequestTimeoutS       = flag.Int("http_request_timeout_s", 30, `Set the timeout in second for all requests. Must be > 0 and the default is 30 seconds if not set.`)
+	Node                      = flag.String("node", "ESPv2", "envoy node id")
+	NodeRegion                = flag.String("node_region", "", "The region of this proxy, reported as the envoy node locality.")
+	NodeZone                  = flag.String("node_zone", "", "The zone of this proxy, reported as the envoy node locality. Required for zone aware load balancing of the backends.")
+	NonGCP                    = flag.Bool("non_gcp", false, `By default, the proxy tries to talk to GCP metadata server to get VM location in the first few requests. Setting this flag to true to skip this step`)
+	GeneratedHeaderPrefix     = flag.String("generated_header_prefix", "X-Endpoint-", "Set the header prefix for the generated headers. By default, it is `X-Endpoint-`")
+	TracingProjectId          = flag.String("tracing_project_id", "", "The Google project id required for Stack driver tracing. If not set, will automatically use fetch it from GCP Metadata server")
+	TracingStackdriverAddress = flag.String("tracing_stackdriver_address", "", "By default, the Stackdriver exporter will connect to production Stackdriver. If this is non-empty, it will connect to this address. It must be in the gRPC format and implement the cloud trace v2 RPCs.")
+	TracingZipkinCollectorUrl = flag.String("tracing_zipkin_collector_url", "", `If set, spans are exported to the Zipkin collector at this url instead of Stackdriver, e.g. http://zipkin:9411/api/v2/spans.
+	There is no native OTLP exporter, OpenTelemetry collectors can receive the spans with the Zipkin receiver instead. The tracing project id is not required, and the spans are propagated with the B3 headers.`)
 	TracingSamplingRate        = flag.Float64("tracing_sample_rate", 0.001, "tracing sampling rate from 0.0 to 1.0")
-	TracingIncomingContext     = flag.String("tracing_incoming_context", "traceparent,x-cloud-trace-context", "comma separated incoming trace contexts (traceparent|grpc-trace-bin|x-cloud-trace-context)")
-	TracingOutgoingContext     = flag.String("tracing_outgoing_context", "traceparent,x-cloud-trace-context", "comma separated outgoing trace contexts (traceparent|grpc-trace-bin|x-cloud-trace-context)")
+	TracingIncomingContext     = flag.String("tracing_incoming_context", "traceparent,x-cloud-trace-context", "comma separated incoming trace contexts (traceparent|grpc-trace-bin|x-cloud-trace-context|b3)")
+	TracingOutgoingContext     = flag.String("tracing_outgoing_context", "traceparent,x-cloud-trace-context", "comma separated outgoing trace contexts (traceparent|grpc-trace-bin|x-cloud-trace-context|b3)")
 	TracingMaxNumAttributes    = flag.Int64("tracing_max_num_attributes", 32, "Sets the maximum number of attributes that each span can contain. Defaults to the maximum allowed by Stackdriver. In practice, the number of attributes published will be much less.")
 	TracingMaxNumAnnotations   = flag.Int64("tracing_max_num_annotations", 32, "Sets the maximum number of annotations that each span can contain. Defaults to the maximum allowed by Stackdriver. In practice, the number of annotations published will be much less.")
 	TracingMaxNumMessageEvents = flag.Int64("tracing_max_num_message_events", 128, "Sets the maximum number of message events that each span can contain. Defaults to the maximum allowed by Stackdriver. In practice, the number of message events published will be much less.")
 	TracingMaxNumLinks         = flag.Int64("tracing_max_num_links", 128, "Sets the maximum number of links that each span can contain. Defaults to the maximum allowed by Stackdriver. In practice, the number of links published will be much less.")
 
+	EnableOperationStats = flag.Bool("enable_operation_stats", false, `Enable the request counts and latencies broken down by the operation, in the stats with the "operation" tag.`)
+	StatsSinkType        = flag.String("stats_sink_type", "statsd", `The type of the stats sink configured by --stats_sink_address, must be either "statsd" or "dogstatsd".`)
+	StatsSinkAddress     = flag.String("stats_sink_address", "", `If set, Envoy flushes its stats over UDP to the statsd or dogstatsd server at this IP:port address, e.g. 127.0.0.1:8125.`)
+	StatsSinkPrefix      = flag.String("stats_sink_prefix", "", `The prefix of the stats flushed to the stats sink. If not set, the sink uses its default prefix "envoy".`)
+
 	//Suspected Envoy has listener initialization bug: if a http filter needs to use
 	//a cluster with DSN lookup for initialization, e.g. fetching a remote access
 	//token, the cluster is not ready so the whole listener is destroyed. ADS will
@@ -55,6 +65,9 @@ var (
 	MetadataURL = flag.String("metadata_url", "http://169.254.169.254", "url of metadata server")
 	IamURL      = flag.String("iam_url", "https://iamcredentials.googleapis.com", "url of iam server")
 
+	GoogleApiProxy = flag.String("google_api_proxy", "", `The HTTP proxy url, [http://]host[:port] or https://host[:port], used for the outbound calls to Service Management, Service Control, IAM and JWKS endpoints.
+		The config manager calls them through the proxy, and Envoy tunnels its Service Control, IAM and JWKS connections through the proxy by CONNECT requests.
+		If not set, the config manager honors the HTTPS_PROXY and HTTP_PROXY environment variables. Hosts listed in the NO_PROXY environment variable and the metadata server always bypass the proxy.`)
 	ServiceControlIamServiceAccount = flag.String("service_control_iam_service_account", "", "The service account used to fetch access token for the Service Control from Google Cloud IAM")
 	ServiceControlIamDelegates      = flag.String("service_control_iam_delegates", "", "The sequence of service accounts in a delegation chain used to fetch access token for the Service Control from Google Cloud IAM. The multiple delegates should be separated by \",\" and the flag only applies when ServiceControlIamServiceAccount is not empty.")
 
@@ -68,14 +81,18 @@ func DefaultCommonOptionsFromFlags() options.CommonOptions {
 	opts := options.CommonOptions{
 		AdminAddress:                       *AdminAddress,
 		AdminPort:                          *AdminPort,
+		AdminAccessLogPath:                 *AdminAccessLogPath,
 		AdsNamedPipe:                       *AdsNamedPipe,
 		DisableTracing:                     *DisableTracing,
 		HttpRequestTimeout:                 time.Duration(*HttpRequestTimeoutS) * time.Second,
 		Node:                               *Node,
+		NodeRegion:                         *NodeRegion,
+		NodeZone:                           *NodeZone,
 		NonGCP:                             *NonGCP,
 		GeneratedHeaderPrefix:              *GeneratedHeaderPrefix,
 		TracingProjectId:                   *TracingProjectId,
 		TracingStackdriverAddress:          *TracingStackdriverAddress,
+		TracingZipkinCollectorUrl:          *TracingZipkinCollectorUrl,
 		TracingSamplingRate:                *TracingSamplingRate,
 		TracingIncomingContext:             *TracingIncomingContext,
 		TracingOutgoingContext:             *TracingOutgoingContext,
@@ -83,8 +100,13 @@ func DefaultCommonOptionsFromFlags() options.CommonOptions {
 		TracingMaxNumAnnotations:           *TracingMaxNumAnnotations,
 		TracingMaxNumMessageEvents:         *TracingMaxNumMessageEvents,
 		TracingMaxNumLinks:                 *TracingMaxNumLinks,
+		EnableOperationStats:               *EnableOperationStats,
+		StatsSinkType:                      *StatsSinkType,
+		StatsSinkAddress:                   *StatsSinkAddress,
+		StatsSinkPrefix:                    *StatsSinkPrefix,
 		MetadataURL:                        *MetadataURL,
 		IamURL:                             *IamURL,
+		GoogleApiProxy:                     *GoogleApiProxy,
 		DisallowColonInWildcardPathSegment: *DisallowColonInWildcardPathSegment,
 	}
 	if *BackendAuthIamServiceAccount != "" {
@@ -16,8 +16,15 @@ package configgenerator
 
 import (
 	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configgenerator/filterconfig"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 	"github.com/golang/glog"
@@ -27,6 +34,9 @@ import (
 	sc "github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
 	clusterpb "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpointpb "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	httppb "github.com/envoyproxy/go-control-plane/envoy/extensions/upstreams/http/v3"
+	anypb "github.com/golang/protobuf/ptypes/any"
 )
 
 // MakeClusters provides dynamic cluster settings for Envoy
@@ -69,16 +79,14 @@ func MakeClusters(serviceInfo *sc.ServiceInfo) ([]*clusterpb.Cluster, error) {
 		clusters = append(clusters, iamCluster)
 	}
 
-	// Note: makeServiceControlCluster should be called before makeListener
+	// Note: makeServiceControlClusters should be called before makeListener
 	// as makeServiceControlFilter is using m.serviceControlURI assigned by
-	// makeServiceControlCluster
-	scCluster, err := makeServiceControlCluster(serviceInfo)
+	// makeServiceControlClusters
+	scClusters, err := makeServiceControlClusters(serviceInfo)
 	if err != nil {
 		return nil, err
 	}
-	if scCluster != nil {
-		clusters = append(clusters, scCluster)
-	}
+	clusters = append(clusters, scClusters...)
 
 	brClusters, err := makeRemoteBackendClusters(serviceInfo)
 	if err != nil {
@@ -88,6 +96,42 @@ func MakeClusters(serviceInfo *sc.ServiceInfo) ([]*clusterpb.Cluster, error) {
 		clusters = append(clusters, brClusters...)
 	}
 
+	opClusters, err := makeOperationBackendClusters(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	if opClusters != nil {
+		clusters = append(clusters, opClusters...)
+	}
+
+	hostClusters, err := makeHostBackendClusters(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	if hostClusters != nil {
+		clusters = append(clusters, hostClusters...)
+	}
+
+	zipkinCluster, err := makeZipkinCollectorCluster(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	if zipkinCluster != nil {
+		clusters = append(clusters, zipkinCluster)
+	}
+
+	alsCluster, err := makeAccessLogServiceCluster(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	if alsCluster != nil {
+		clusters = append(clusters, alsCluster)
+	}
+
+	if serviceInfo.Options.EnableGrpcReflection {
+		clusters = append(clusters, makeGrpcReflectionCluster(serviceInfo))
+	}
+
 	providerClusters, err := makeJwtProviderClusters(serviceInfo)
 	if err != nil {
 		return nil, err
@@ -97,6 +141,11 @@ func MakeClusters(serviceInfo *sc.ServiceInfo) ([]*clusterpb.Cluster, error) {
 		clusters = append(clusters, providerClusters...)
 	}
 
+	clusters, err = tunnelThroughGoogleApiProxy(serviceInfo, clusters)
+	if err != nil {
+		return nil, err
+	}
+
 	if serviceInfo.Options.DnsResolverAddresses != "" {
 		if err = addDnsResolversToClusters(serviceInfo.Options.DnsResolverAddresses, clusters); err != nil {
 			return nil, fmt.Errorf("fail to add dns resovlers to clusters : %v", err)
@@ -120,17 +169,199 @@ func addDnsResolversToClusters(dnsResolverAddresses string, clusters []*clusterp
 	return nil
 }
 
+// proxyTunnel tunnels the connections to a cluster endpoint through the
+// --google_api_proxy. The endpoint connects to the unix domain socket pipe,
+// whose listener sends a CONNECT request of authority to the proxy.
+type proxyTunnel struct {
+	name      string
+	pipe      string
+	authority string
+}
+
+// makeProxyTunnels returns the tunnels of the Service Control, IAM and JWKS
+// cluster endpoints through --google_api_proxy, if set, as the config manager
+// does. Envoy clusters cannot use a forward proxy, so each endpoint connects to
+// a unix domain socket listener instead, which tunnels the connection through
+// the proxy by a CONNECT request. The hosts in NO_PROXY are not tunneled.
+//
+// Both MakeClusters and MakeListeners call it, so neither depends on the other
+// running first.
+func makeProxyTunnels(serviceInfo *sc.ServiceInfo) ([]*proxyTunnel, error) {
+	proxyURL := serviceInfo.Options.GoogleApiProxy
+	if proxyURL == "" {
+		return nil, nil
+	}
+
+	clusters, err := makeServiceControlClusters(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	iamCluster, err := makeIamCluster(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	if iamCluster != nil {
+		clusters = append(clusters, iamCluster)
+	}
+	providerClusters, err := makeJwtProviderClusters(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	clusters = append(clusters, providerClusters...)
+
+	var tunnels []*proxyTunnel
+	for _, c := range clusters {
+		scheme := "http"
+		if c.TransportSocket != nil {
+			scheme = "https"
+		}
+
+		var tunneled, direct bool
+		for _, localityEndpoints := range c.GetLoadAssignment().GetEndpoints() {
+			for _, lbEndpoint := range localityEndpoints.GetLbEndpoints() {
+				authority := endpointAuthority(lbEndpoint)
+				proxy, err := util.ProxyForHost(proxyURL, scheme, authority)
+				if err != nil {
+					return nil, fmt.Errorf("fail to select the proxy of %s for cluster %s: %v", authority, c.Name, err)
+				}
+				if proxy == nil {
+					direct = true
+					continue
+				}
+				tunneled = true
+				tunnels = append(tunnels, &proxyTunnel{
+					name:      util.ProxyTunnelListenerName(c.Name, authority),
+					pipe:      util.ProxyTunnelPipe(c.Name, authority),
+					authority: authority,
+				})
+			}
+		}
+		if tunneled && direct {
+			return nil, fmt.Errorf("cluster %s has both the hosts in NO_PROXY and the hosts tunneled through flag --google_api_proxy", c.Name)
+		}
+	}
+	return tunnels, nil
+}
+
+// tunnelThroughGoogleApiProxy makes the cluster endpoints tunneled by
+// makeProxyTunnels connect to their unix domain sockets, and adds the cluster
+// of the proxy.
+func tunnelThroughGoogleApiProxy(serviceInfo *sc.ServiceInfo, clusters []*clusterpb.Cluster) ([]*clusterpb.Cluster, error) {
+	tunnels, err := makeProxyTunnels(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	if len(tunnels) == 0 {
+		return clusters, nil
+	}
+	pipes := make(map[string]string, len(tunnels))
+	for _, tunnel := range tunnels {
+		pipes[tunnel.name] = tunnel.pipe
+	}
+
+	for _, c := range clusters {
+		var tunneled bool
+		for _, localityEndpoints := range c.GetLoadAssignment().GetEndpoints() {
+			for _, lbEndpoint := range localityEndpoints.GetLbEndpoints() {
+				pipe, ok := pipes[util.ProxyTunnelListenerName(c.Name, endpointAuthority(lbEndpoint))]
+				if !ok {
+					continue
+				}
+				tunneled = true
+				lbEndpoint.GetEndpoint().Address = &corepb.Address{
+					Address: &corepb.Address_Pipe{
+						Pipe: &corepb.Pipe{
+							Path: pipe,
+						},
+					},
+				}
+			}
+		}
+		if tunneled {
+			// The unix domain sockets are not resolved by DNS.
+			c.ClusterDiscoveryType = &clusterpb.Cluster_Type{Type: clusterpb.Cluster_STATIC}
+		}
+	}
+
+	proxyCluster, err := makeGoogleApiProxyCluster(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	return append(clusters, proxyCluster), nil
+}
+
+// endpointAuthority returns the host:port of the socket address of an
+// endpoint.
+func endpointAuthority(lbEndpoint *endpointpb.LbEndpoint) string {
+	address := lbEndpoint.GetEndpoint().GetAddress().GetSocketAddress()
+	return net.JoinHostPort(address.GetAddress(), strconv.Itoa(int(address.GetPortValue())))
+}
+
+// makeGoogleApiProxyCluster makes the cluster of the --google_api_proxy, in
+// the format of [http://]host[:port] or https://host[:port].
+func makeGoogleApiProxyCluster(serviceInfo *sc.ServiceInfo) (*clusterpb.Cluster, error) {
+	proxyURL := serviceInfo.Options.GoogleApiProxy
+	if !strings.Contains(proxyURL, "://") {
+		// The proxy url defaults to http as HTTP_PROXY does.
+		proxyURL = "http://" + proxyURL
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid flag --google_api_proxy %q: %v", serviceInfo.Options.GoogleApiProxy, err)
+	}
+	if u.User != nil {
+		// Envoy would have to send the credentials in the config, which is
+		// exposed by the admin interfaces.
+		return nil, fmt.Errorf("flag --google_api_proxy must not have the user credentials")
+	}
+	scheme, hostname, port, _, err := util.ParseURI(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid flag --google_api_proxy %q: %v", serviceInfo.Options.GoogleApiProxy, err)
+	}
+	family, err := dnsLookupFamily(serviceInfo.Options, clusterpb.Cluster_V4_ONLY)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &clusterpb.Cluster{
+		Name:                 util.GoogleApiProxyClusterName,
+		LbPolicy:             clusterpb.Cluster_ROUND_ROBIN,
+		ConnectTimeout:       ptypes.DurationProto(serviceInfo.Options.ClusterConnectTimeout),
+		DnsLookupFamily:      family,
+		ClusterDiscoveryType: &clusterpb.Cluster_Type{Type: clusterpb.Cluster_LOGICAL_DNS},
+		LoadAssignment:       util.CreateLoadAssignment(hostname, port),
+	}
+	switch scheme {
+	case "http":
+	case "https":
+		transportSocket, err := util.CreateUpstreamTransportSocket(hostname, serviceInfo.Options.SslSidestreamClientRootCertsPath, "", nil, "")
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling tls context to transport_socket config for cluster %s, err=%v",
+				c.Name, err)
+		}
+		c.TransportSocket = transportSocket
+	default:
+		return nil, fmt.Errorf("flag --google_api_proxy must be an http or https url, got %q", serviceInfo.Options.GoogleApiProxy)
+	}
+	return c, nil
+}
+
 func makeMetadataCluster(serviceInfo *sc.ServiceInfo) (*clusterpb.Cluster, error) {
 	scheme, hostname, port, _, err := util.ParseURI(serviceInfo.Options.MetadataURL)
 	if err != nil {
 		return nil, fmt.Errorf("fail to parse metadata cluster URI: %v", err)
 	}
+	family, err := dnsLookupFamily(serviceInfo.Options, clusterpb.Cluster_AUTO)
+	if err != nil {
+		return nil, err
+	}
 
 	connectTimeoutProto := ptypes.DurationProto(serviceInfo.Options.ClusterConnectTimeout)
 	c := &clusterpb.Cluster{
-		Name:           util.MetadataServerClusterName,
-		LbPolicy:       clusterpb.Cluster_ROUND_ROBIN,
-		ConnectTimeout: connectTimeoutProto,
+		Name:            util.MetadataServerClusterName,
+		LbPolicy:        clusterpb.Cluster_ROUND_ROBIN,
+		DnsLookupFamily: family,
+		ConnectTimeout:  connectTimeoutProto,
 		ClusterDiscoveryType: &clusterpb.Cluster_Type{
 			Type: clusterpb.Cluster_STRICT_DNS,
 		},
@@ -161,6 +392,21 @@ func makeTokenAgentCluster(serviceInfo *sc.ServiceInfo) *clusterpb.Cluster {
 	}
 }
 
+// makeGrpcReflectionCluster points to the gRPC reflection server of the
+// config manager.
+func makeGrpcReflectionCluster(serviceInfo *sc.ServiceInfo) *clusterpb.Cluster {
+	return &clusterpb.Cluster{
+		Name:           util.GrpcReflectionClusterName,
+		LbPolicy:       clusterpb.Cluster_ROUND_ROBIN,
+		ConnectTimeout: ptypes.DurationProto(serviceInfo.Options.ClusterConnectTimeout),
+		ClusterDiscoveryType: &clusterpb.Cluster_Type{
+			Type: clusterpb.Cluster_STATIC,
+		},
+		LoadAssignment:                util.CreateLoadAssignment(util.LoopbackIPv4Addr, uint32(serviceInfo.Options.GrpcReflectionPort)),
+		TypedExtensionProtocolOptions: util.CreateUpstreamProtocolOptions(),
+	}
+}
+
 func makeIamCluster(serviceInfo *sc.ServiceInfo) (*clusterpb.Cluster, error) {
 	if serviceInfo.Options.ServiceControlCredentials == nil && serviceInfo.Options.BackendAuthCredentials == nil {
 		return nil, nil
@@ -169,12 +415,16 @@ func makeIamCluster(serviceInfo *sc.ServiceInfo) (*clusterpb.Cluster, error) {
 	if err != nil {
 		return nil, fmt.Errorf("fail to parse IAM cluster URI: %v", err)
 	}
+	family, err := dnsLookupFamily(serviceInfo.Options, clusterpb.Cluster_V4_ONLY)
+	if err != nil {
+		return nil, err
+	}
 
 	connectTimeoutProto := ptypes.DurationProto(serviceInfo.Options.ClusterConnectTimeout)
 	c := &clusterpb.Cluster{
 		Name:            util.IamServerClusterName,
 		LbPolicy:        clusterpb.Cluster_ROUND_ROBIN,
-		DnsLookupFamily: clusterpb.Cluster_V4_ONLY,
+		DnsLookupFamily: family,
 		ConnectTimeout:  connectTimeoutProto,
 		ClusterDiscoveryType: &clusterpb.Cluster_Type{
 			Type: clusterpb.Cluster_STRICT_DNS,
@@ -194,10 +444,90 @@ func makeIamCluster(serviceInfo *sc.ServiceInfo) (*clusterpb.Cluster, error) {
 	return c, nil
 }
 
+func makeZipkinCollectorCluster(serviceInfo *sc.ServiceInfo) (*clusterpb.Cluster, error) {
+	if serviceInfo.Options.DisableTracing || serviceInfo.Options.TracingZipkinCollectorUrl == "" {
+		return nil, nil
+	}
+	scheme, hostname, port, _, err := util.ParseURI(serviceInfo.Options.TracingZipkinCollectorUrl)
+	if err != nil {
+		return nil, fmt.Errorf("fail to parse zipkin collector cluster URI: %v", err)
+	}
+	family, err := dnsLookupFamily(serviceInfo.Options, clusterpb.Cluster_AUTO)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &clusterpb.Cluster{
+		Name:            util.ZipkinCollectorClusterName,
+		LbPolicy:        clusterpb.Cluster_ROUND_ROBIN,
+		DnsLookupFamily: family,
+		ConnectTimeout:  ptypes.DurationProto(serviceInfo.Options.ClusterConnectTimeout),
+		ClusterDiscoveryType: &clusterpb.Cluster_Type{
+			Type: clusterpb.Cluster_STRICT_DNS,
+		},
+		LoadAssignment: util.CreateLoadAssignment(hostname, port),
+	}
+
+	if scheme == "https" {
+		transportSocket, err := util.CreateUpstreamTransportSocket(hostname, serviceInfo.Options.SslSidestreamClientRootCertsPath, "", nil, "")
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling tls context to transport_socket config for cluster %s, err=%v",
+				c.Name, err)
+		}
+		c.TransportSocket = transportSocket
+	}
+
+	return c, nil
+}
+
+func makeAccessLogServiceCluster(serviceInfo *sc.ServiceInfo) (*clusterpb.Cluster, error) {
+	if serviceInfo.Options.AccessLogGrpcUrl == "" {
+		return nil, nil
+	}
+	scheme, hostname, port, _, err := util.ParseURI(serviceInfo.Options.AccessLogGrpcUrl)
+	if err != nil {
+		return nil, fmt.Errorf("fail to parse access log service cluster URI: %v", err)
+	}
+	if scheme != "grpc" && scheme != "grpcs" {
+		return nil, fmt.Errorf("invalid access log service cluster URI scheme %q, must be either grpc or grpcs", scheme)
+	}
+	family, err := dnsLookupFamily(serviceInfo.Options, clusterpb.Cluster_AUTO)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &clusterpb.Cluster{
+		Name:            util.AccessLogServiceClusterName,
+		LbPolicy:        clusterpb.Cluster_ROUND_ROBIN,
+		DnsLookupFamily: family,
+		ConnectTimeout:  ptypes.DurationProto(serviceInfo.Options.ClusterConnectTimeout),
+		ClusterDiscoveryType: &clusterpb.Cluster_Type{
+			Type: clusterpb.Cluster_STRICT_DNS,
+		},
+		LoadAssignment:                util.CreateLoadAssignment(hostname, port),
+		TypedExtensionProtocolOptions: util.CreateUpstreamProtocolOptions(),
+	}
+
+	if scheme == "grpcs" {
+		transportSocket, err := util.CreateUpstreamTransportSocket(hostname, serviceInfo.Options.SslSidestreamClientRootCertsPath, "", []string{"h2"}, "")
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling tls context to transport_socket config for cluster %s, err=%v",
+				c.Name, err)
+		}
+		c.TransportSocket = transportSocket
+	}
+
+	return c, nil
+}
+
 func makeJwtProviderClusters(serviceInfo *sc.ServiceInfo) ([]*clusterpb.Cluster, error) {
 	var providerClusters []*clusterpb.Cluster
 	authn := serviceInfo.ServiceConfig().GetAuthentication()
 	generatedClusters := map[string]bool{}
+	family, err := dnsLookupFamily(serviceInfo.Options, clusterpb.Cluster_V4_ONLY)
+	if err != nil {
+		return nil, err
+	}
 
 	for _, provider := range authn.GetProviders() {
 		jwksUri := provider.GetJwksUri()
@@ -223,8 +553,8 @@ func makeJwtProviderClusters(serviceInfo *sc.ServiceInfo) ([]*clusterpb.Cluster,
 			Name:           clusterName,
 			LbPolicy:       clusterpb.Cluster_ROUND_ROBIN,
 			ConnectTimeout: connectTimeoutProto,
-			// Note: It may not be V4.
-			DnsLookupFamily:      clusterpb.Cluster_V4_ONLY,
+			// Note: It may not be V4, set --dns_lookup_family otherwise.
+			DnsLookupFamily:      family,
 			ClusterDiscoveryType: &clusterpb.Cluster_Type{Type: clusterpb.Cluster_LOGICAL_DNS},
 			LoadAssignment:       util.CreateLoadAssignment(hostname, port),
 		}
@@ -258,7 +588,11 @@ func makeBackendCluster(opt *options.ConfigGeneratorOptions, brc *sc.BackendRout
 		if isHttp2 {
 			alpnProtocols = []string{"h2"}
 		}
-		transportSocket, err := util.CreateUpstreamTransportSocket(brc.Hostname, opt.SslBackendClientRootCertsPath, opt.SslBackendClientCertPath, alpnProtocols, opt.SslBackendClientCipherSuites)
+		sni := brc.Hostname
+		if brc.Sni != "" {
+			sni = brc.Sni
+		}
+		transportSocket, err := util.CreateUpstreamTransportSocket(sni, opt.SslBackendClientRootCertsPath, opt.SslBackendClientCertPath, alpnProtocols, opt.SslBackendClientCipherSuites)
 		if err != nil {
 			return nil, fmt.Errorf("error marshaling tls context to transport_socket config for cluster %s, err=%v",
 				brc.ClusterName, err)
@@ -268,19 +602,175 @@ func makeBackendCluster(opt *options.ConfigGeneratorOptions, brc *sc.BackendRout
 
 	if isHttp2 {
 		c.TypedExtensionProtocolOptions = util.CreateUpstreamProtocolOptions()
+	} else if brc.EnableTrailers {
+		protocolOptions, err := makeBackendProtocolOptions(brc)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling http protocol options for cluster %s, err=%v", brc.ClusterName, err)
+		}
+		c.TypedExtensionProtocolOptions = protocolOptions
+	}
+
+	circuitBreakers, err := makeBackendCircuitBreakers(opt, brc)
+	if err != nil {
+		return nil, err
+	}
+	c.CircuitBreakers = circuitBreakers
+
+	if c.DnsLookupFamily, err = parseDnsLookupFamily(opt.BackendDnsLookupFamily); err != nil {
+		return nil, err
+	}
+
+	if len(brc.LocalityEndpoints) > 0 {
+		c.ClusterDiscoveryType = &clusterpb.Cluster_Type{Type: clusterpb.Cluster_STRICT_DNS}
+		c.LoadAssignment = makeLocalityLoadAssignment(brc, opt.NodeRegion)
+		if c.CommonLbConfig, err = makeLocalityLbConfig(opt); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// makeLocalityLoadAssignment groups the endpoints of the backend by their
+// zones, weighted by the number of endpoints.
+func makeLocalityLoadAssignment(brc *sc.BackendRoutingCluster, region string) *endpointpb.ClusterLoadAssignment {
+	loadAssignment := &endpointpb.ClusterLoadAssignment{
+		ClusterName: brc.ClusterName,
+	}
+	localities := make(map[string]*endpointpb.LocalityLbEndpoints)
+	for _, endpoint := range brc.LocalityEndpoints {
+		locality, ok := localities[endpoint.Zone]
+		if !ok {
+			locality = &endpointpb.LocalityLbEndpoints{
+				Locality: &corepb.Locality{
+					Region: region,
+					Zone:   endpoint.Zone,
+				},
+				LoadBalancingWeight: &wrappers.UInt32Value{},
+			}
+			localities[endpoint.Zone] = locality
+			loadAssignment.Endpoints = append(loadAssignment.Endpoints, locality)
+		}
+		locality.LbEndpoints = append(locality.LbEndpoints, util.CreateLoadAssignment(endpoint.Hostname, endpoint.Port).Endpoints[0].LbEndpoints...)
+		locality.LoadBalancingWeight.Value++
+	}
+	return loadAssignment
+}
+
+// makeLocalityLbConfig makes the locality aware load balancing of
+// --backend_locality_lb.
+func makeLocalityLbConfig(opt *options.ConfigGeneratorOptions) (*clusterpb.Cluster_CommonLbConfig, error) {
+	switch opt.BackendLocalityLb {
+	case "":
+		return nil, nil
+	case "zone_aware":
+		if opt.NodeZone == "" {
+			return nil, fmt.Errorf("zone_aware backend_locality_lb requires the node zone, set it with --node_zone")
+		}
+		return &clusterpb.Cluster_CommonLbConfig{
+			LocalityConfigSpecifier: &clusterpb.Cluster_CommonLbConfig_ZoneAwareLbConfig_{
+				ZoneAwareLbConfig: &clusterpb.Cluster_CommonLbConfig_ZoneAwareLbConfig{
+					// The endpoints are listed explicitly, so there are usually
+					// fewer than the Envoy default of 6.
+					MinClusterSize: &wrappers.UInt64Value{Value: 1},
+				},
+			},
+		}, nil
+	case "locality_weighted":
+		return &clusterpb.Cluster_CommonLbConfig{
+			LocalityConfigSpecifier: &clusterpb.Cluster_CommonLbConfig_LocalityWeightedLbConfig_{
+				LocalityWeightedLbConfig: &clusterpb.Cluster_CommonLbConfig_LocalityWeightedLbConfig{},
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("Invalid BackendLocalityLb: %s; Only zone_aware or locality_weighted are valid.", opt.BackendLocalityLb)
 	}
+}
 
-	switch opt.BackendDnsLookupFamily {
+func parseDnsLookupFamily(family string) (clusterpb.Cluster_DnsLookupFamily, error) {
+	switch family {
 	case "auto":
-		c.DnsLookupFamily = clusterpb.Cluster_AUTO
+		return clusterpb.Cluster_AUTO, nil
 	case "v4only":
-		c.DnsLookupFamily = clusterpb.Cluster_V4_ONLY
+		return clusterpb.Cluster_V4_ONLY, nil
 	case "v6only":
-		c.DnsLookupFamily = clusterpb.Cluster_V6_ONLY
+		return clusterpb.Cluster_V6_ONLY, nil
 	default:
-		return nil, fmt.Errorf("Invalid DnsLookupFamily: %s; Only auto, v4only or v6only are valid.", opt.BackendDnsLookupFamily)
+		return clusterpb.Cluster_AUTO, fmt.Errorf("Invalid DnsLookupFamily: %s; Only auto, v4only or v6only are valid.", family)
 	}
-	return c, nil
+}
+
+// dnsLookupFamily returns the dns lookup family of the clusters other than
+// the backends, defaultFamily if --dns_lookup_family is not set.
+func dnsLookupFamily(opts options.ConfigGeneratorOptions, defaultFamily clusterpb.Cluster_DnsLookupFamily) (clusterpb.Cluster_DnsLookupFamily, error) {
+	if opts.DnsLookupFamily == "" {
+		return defaultFamily, nil
+	}
+	return parseDnsLookupFamily(opts.DnsLookupFamily)
+}
+
+// makeBackendCircuitBreakers creates the circuit breaker thresholds of the
+// backend cluster, so a slow backend can not exhaust the proxy resources.
+// The operation max concurrency overrides the max requests.
+func makeBackendCircuitBreakers(opt *options.ConfigGeneratorOptions, brc *sc.BackendRoutingCluster) (*clusterpb.CircuitBreakers, error) {
+	thresholds := &clusterpb.CircuitBreakers_Thresholds{}
+	var err error
+	if thresholds.MaxConnections, err = makeCircuitBreakerThreshold("backend_max_connections", opt.BackendMaxConnections); err != nil {
+		return nil, err
+	}
+	if thresholds.MaxPendingRequests, err = makeCircuitBreakerThreshold("backend_max_pending_requests", opt.BackendMaxPendingRequests); err != nil {
+		return nil, err
+	}
+	if thresholds.MaxRequests, err = makeCircuitBreakerThreshold("backend_max_requests", opt.BackendMaxRequests); err != nil {
+		return nil, err
+	}
+	if thresholds.MaxRetries, err = makeCircuitBreakerThreshold("backend_max_retries", opt.BackendMaxRetries); err != nil {
+		return nil, err
+	}
+	if brc.MaxRequests > 0 {
+		thresholds.MaxRequests = &wrappers.UInt32Value{Value: brc.MaxRequests}
+	}
+
+	if thresholds.MaxConnections == nil && thresholds.MaxPendingRequests == nil && thresholds.MaxRequests == nil && thresholds.MaxRetries == nil {
+		return nil, nil
+	}
+	return &clusterpb.CircuitBreakers{
+		Thresholds: []*clusterpb.CircuitBreakers_Thresholds{thresholds},
+	}, nil
+}
+
+// makeCircuitBreakerThreshold returns nil for 0 to use the Envoy default.
+func makeCircuitBreakerThreshold(flagName string, value int) (*wrappers.UInt32Value, error) {
+	if value < 0 || int64(value) > math.MaxUint32 {
+		return nil, fmt.Errorf("invalid %s: %v, should be in [0, %v]", flagName, value, uint32(math.MaxUint32))
+	}
+	if value == 0 {
+		return nil, nil
+	}
+	return &wrappers.UInt32Value{Value: uint32(value)}, nil
+}
+
+// makeBackendProtocolOptions creates the http protocol options of the HTTP/1
+// backend, with the trailers forwarded.
+func makeBackendProtocolOptions(brc *sc.BackendRoutingCluster) (map[string]*anypb.Any, error) {
+	o := &httppb.HttpProtocolOptions{
+		UpstreamProtocolOptions: &httppb.HttpProtocolOptions_ExplicitHttpConfig_{
+			ExplicitHttpConfig: &httppb.HttpProtocolOptions_ExplicitHttpConfig{
+				ProtocolConfig: &httppb.HttpProtocolOptions_ExplicitHttpConfig_HttpProtocolOptions{
+					HttpProtocolOptions: &corepb.Http1ProtocolOptions{
+						EnableTrailers: brc.EnableTrailers,
+					},
+				},
+			},
+		},
+	}
+
+	a, err := ptypes.MarshalAny(o)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]*anypb.Any{
+		util.UpstreamProtocolOptions: a,
+	}, nil
 }
 
 func makeLocalBackendCluster(serviceInfo *sc.ServiceInfo) (*clusterpb.Cluster, error) {
@@ -311,7 +801,15 @@ func makeLocalBackendCluster(serviceInfo *sc.ServiceInfo) (*clusterpb.Cluster, e
 	return c, nil
 }
 
-func makeServiceControlCluster(serviceInfo *sc.ServiceInfo) (*clusterpb.Cluster, error) {
+func makeServiceControlClusters(serviceInfo *sc.ServiceInfo) ([]*clusterpb.Cluster, error) {
+	backend, err := filterconfig.GetTelemetryBackend(serviceInfo.Options)
+	if err != nil {
+		return nil, err
+	}
+	if !backend.RequiresServiceControlFilter {
+		return nil, nil
+	}
+
 	uri := serviceControlURL(serviceInfo, serviceInfo.Options)
 	if uri == "" {
 		return nil, nil
@@ -329,14 +827,59 @@ func makeServiceControlCluster(serviceInfo *sc.ServiceInfo) (*clusterpb.Cluster,
 	if path != "" {
 		return nil, fmt.Errorf("error parsing service control URI: should not have path part: %s, %s", uri, path)
 	}
+	serviceInfo.ServiceControlURI = scheme + "://" + hostname + "/v1/services"
+	c, err := makeServiceControlCluster(serviceInfo, util.ServiceControlClusterName, scheme, hostname, port)
+	if err != nil {
+		return nil, err
+	}
+	clusters := []*clusterpb.Cluster{c}
+
+	// Each failover server has its own cluster, so it is called with its own
+	// SNI and authority.
+	serviceInfo.ServiceControlFailoverURIs = nil
+	if serviceInfo.Options.ServiceControlFailoverURLs == "" {
+		return clusters, nil
+	}
+	for i, failoverUri := range strings.Split(serviceInfo.Options.ServiceControlFailoverURLs, ",") {
+		scheme, hostname, port, path, err := util.ParseURI(failoverUri)
+		if err != nil {
+			return nil, err
+		}
+		if path != "" {
+			return nil, fmt.Errorf("error parsing service control failover URI: should not have path part: %s, %s", failoverUri, path)
+		}
+		serviceInfo.ServiceControlFailoverURIs = append(serviceInfo.ServiceControlFailoverURIs, scheme+"://"+hostname+"/v1/services")
+		c, err := makeServiceControlCluster(serviceInfo, util.ServiceControlFailoverClusterName(i), scheme, hostname, port)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, c)
+	}
+
+	// The failing servers are ejected, so the calls fail over to the next one
+	// without waiting for them.
+	for _, c := range clusters {
+		c.OutlierDetection = &clusterpb.OutlierDetection{
+			ConsecutiveGatewayFailure:          &wrappers.UInt32Value{Value: 3},
+			EnforcingConsecutiveGatewayFailure: &wrappers.UInt32Value{Value: 100},
+			MaxEjectionPercent:                 &wrappers.UInt32Value{Value: 100},
+		}
+	}
+	return clusters, nil
+}
+
+func makeServiceControlCluster(serviceInfo *sc.ServiceInfo, name, scheme, hostname string, port uint32) (*clusterpb.Cluster, error) {
+	family, err := dnsLookupFamily(serviceInfo.Options, clusterpb.Cluster_V4_ONLY)
+	if err != nil {
+		return nil, err
+	}
 
 	connectTimeoutProto := ptypes.DurationProto(5 * time.Second)
-	serviceInfo.ServiceControlURI = scheme + "://" + hostname + "/v1/services"
 	c := &clusterpb.Cluster{
-		Name:                 util.ServiceControlClusterName,
+		Name:                 name,
 		LbPolicy:             clusterpb.Cluster_ROUND_ROBIN,
 		ConnectTimeout:       connectTimeoutProto,
-		DnsLookupFamily:      clusterpb.Cluster_V4_ONLY,
+		DnsLookupFamily:      family,
 		ClusterDiscoveryType: &clusterpb.Cluster_Type{clusterpb.Cluster_LOGICAL_DNS},
 		LoadAssignment:       util.CreateLoadAssignment(hostname, port),
 	}
@@ -375,3 +918,36 @@ func makeRemoteBackendClusters(serviceInfo *sc.ServiceInfo) ([]*clusterpb.Cluste
 	}
 	return brClusters, nil
 }
+
+func makeOperationBackendClusters(serviceInfo *sc.ServiceInfo) ([]*clusterpb.Cluster, error) {
+	var opClusters []*clusterpb.Cluster
+
+	for _, v := range serviceInfo.OperationBackendClusters {
+		c, err := makeBackendCluster(&serviceInfo.Options, v)
+		if err != nil {
+			return nil, err
+		}
+
+		opClusters = append(opClusters, c)
+	}
+	return opClusters, nil
+}
+
+func makeHostBackendClusters(serviceInfo *sc.ServiceInfo) ([]*clusterpb.Cluster, error) {
+	var hosts []string
+	for host := range serviceInfo.HostBackendClusters {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	var hostClusters []*clusterpb.Cluster
+	for _, host := range hosts {
+		c, err := makeBackendCluster(&serviceInfo.Options, serviceInfo.HostBackendClusters[host])
+		if err != nil {
+			return nil, err
+		}
+
+		hostClusters = append(hostClusters, c)
+	}
+	return hostClusters, nil
+}
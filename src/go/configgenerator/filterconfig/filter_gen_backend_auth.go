@@ -80,12 +80,22 @@ var baFilterGenFunc = func(serviceInfo *ci.ServiceInfo) (*hcmpb.HttpFilter, []*c
 					Cluster: util.IamServerClusterName,
 					Timeout: ptypes.DurationProto(serviceInfo.Options.HttpRequestTimeout),
 				},
-				// Currently only support fetching access token from instance metadata
-				// server, not by service account file.
+				// The access token calling IAM is fetched from the metadata server, or
+				// from the token agent if the service account key is set.
 				AccessToken:         serviceInfo.AccessToken,
 				ServiceAccountEmail: serviceInfo.Options.BackendAuthCredentials.ServiceAccountEmail,
 				Delegates:           serviceInfo.Options.BackendAuthCredentials.Delegates,
 			}}
+	} else if serviceInfo.Options.ServiceAccountKey != "" {
+		// The token agent serves the ID tokens generated from the service
+		// account key the same way as the metadata server.
+		backendAuthConfig.IdTokenInfo = &bapb.FilterConfig_ImdsToken{
+			ImdsToken: &commonpb.HttpUri{
+				Uri:     fmt.Sprintf("http://%s:%v%s", util.LoopbackIPv4Addr, serviceInfo.Options.TokenAgentPort, util.TokenAgentIdentityTokenPath),
+				Cluster: util.TokenAgentClusterName,
+				Timeout: ptypes.DurationProto(serviceInfo.Options.HttpRequestTimeout),
+			},
+		}
 	} else {
 		backendAuthConfig.IdTokenInfo = &bapb.FilterConfig_ImdsToken{
 			ImdsToken: &commonpb.HttpUri{
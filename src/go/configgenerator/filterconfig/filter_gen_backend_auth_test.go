@@ -33,6 +33,7 @@ func TestBackendAuthFilter(t *testing.T) {
 	testdata := []struct {
 		desc                  string
 		iamServiceAccount     string
+		serviceAccountKey     string
 		fakeServiceConfig     *confpb.Service
 		delegates             []string
 		depErrorBehavior      string
@@ -224,6 +225,107 @@ func TestBackendAuthFilter(t *testing.T) {
       "jwtAudienceList":["bar.com"]
    }
 }
+`,
+		},
+		{
+			desc:              "Success, call iam with the access token of the service account key",
+			iamServiceAccount: "service-account@google.com",
+			serviceAccountKey: "/etc/creds/sa.json",
+			depErrorBehavior:  commonpb.DependencyErrorBehavior_BLOCK_INIT_ON_ANY_ERROR.String(),
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: "testapipb",
+						Methods: []*apipb.Method{
+							{
+								Name: "bar",
+							},
+						},
+					},
+				},
+				Backend: &confpb.Backend{
+					Rules: []*confpb.BackendRule{
+						{
+							Selector:        "testapipb.bar",
+							Address:         "https://testapipb.com/foo",
+							PathTranslation: confpb.BackendRule_CONSTANT_ADDRESS,
+							Authentication: &confpb.BackendRule_JwtAudience{
+								JwtAudience: "bar.com",
+							},
+						},
+					},
+				},
+			},
+			wantBackendAuthFilter: `
+{
+   "name":"com.google.espv2.filters.http.backend_auth",
+   "typedConfig":{
+      "@type":"type.googleapis.com/espv2.api.envoy.v10.http.backend_auth.FilterConfig",
+      "depErrorBehavior":"BLOCK_INIT_ON_ANY_ERROR",
+      "iamToken":{
+         "accessToken":{
+            "remoteToken":{
+               "cluster":"token-agent-cluster",
+               "timeout":"30s",
+               "uri":"http://127.0.0.1:8791/local/access_token"
+            }
+         },
+         "iamUri":{
+            "cluster":"iam-cluster",
+            "timeout":"30s",
+            "uri":"https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/service-account@google.com:generateIdToken"
+         },
+         "serviceAccountEmail":"service-account@google.com"
+      },
+      "jwtAudienceList":["bar.com"]
+   }
+}
+`,
+		},
+		{
+			desc:              "Success, fetch ID tokens from the token agent when service account key is set",
+			serviceAccountKey: "/etc/creds/sa.json",
+			depErrorBehavior:  commonpb.DependencyErrorBehavior_BLOCK_INIT_ON_ANY_ERROR.String(),
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: "testapipb",
+						Methods: []*apipb.Method{
+							{
+								Name: "bar",
+							},
+						},
+					},
+				},
+				Backend: &confpb.Backend{
+					Rules: []*confpb.BackendRule{
+						{
+							Selector:        "testapipb.bar",
+							Address:         "https://testapipb.com/foo",
+							PathTranslation: confpb.BackendRule_CONSTANT_ADDRESS,
+							Authentication: &confpb.BackendRule_JwtAudience{
+								JwtAudience: "bar.com",
+							},
+						},
+					},
+				},
+			},
+			wantBackendAuthFilter: `
+{
+   "name":"com.google.espv2.filters.http.backend_auth",
+   "typedConfig":{
+      "@type":"type.googleapis.com/espv2.api.envoy.v10.http.backend_auth.FilterConfig",
+      "depErrorBehavior":"BLOCK_INIT_ON_ANY_ERROR",
+      "imdsToken":{
+          "cluster":"token-agent-cluster",
+          "timeout":"30s",
+          "uri":"http://127.0.0.1:8791/local/identity"
+      },
+      "jwtAudienceList":["bar.com"]
+   }
+}
 `,
 		},
 		{
@@ -263,6 +365,7 @@ func TestBackendAuthFilter(t *testing.T) {
 			opts := options.DefaultConfigGeneratorOptions()
 			opts.BackendAddress = "grpc://127.0.0.1:80"
 			opts.DependencyErrorBehavior = tc.depErrorBehavior
+			opts.ServiceAccountKey = tc.serviceAccountKey
 			if tc.iamServiceAccount != "" {
 				opts.BackendAuthCredentials = &options.IAMCredentialsOptions{
 					ServiceAccountEmail: tc.iamServiceAccount,
@@ -0,0 +1,84 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filterconfig
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/httppattern"
+	"github.com/golang/protobuf/ptypes"
+
+	ci "github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	bufferpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/buffer/v3"
+	hcmpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	anypb "github.com/golang/protobuf/ptypes/any"
+	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
+)
+
+var bufferPerRouteFilterConfigGen = func(method *ci.MethodInfo, httpRule *httppattern.Pattern) (*anypb.Any, error) {
+	perRoute := &bufferpb.BufferPerRoute{}
+	if method.MaxRequestBytes == 0 {
+		perRoute.Override = &bufferpb.BufferPerRoute_Disabled{
+			Disabled: true,
+		}
+	} else {
+		perRoute.Override = &bufferpb.BufferPerRoute_Buffer{
+			Buffer: &bufferpb.Buffer{
+				MaxRequestBytes: &wrapperspb.UInt32Value{Value: method.MaxRequestBytes},
+			},
+		}
+	}
+	perRouteAny, err := ptypes.MarshalAny(perRoute)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling buffer per-route config to Any: %v", err)
+	}
+	return perRouteAny, nil
+}
+
+// The Buffer filter rejects the requests with the body larger than the max
+// request bytes of their methods with 413. Every method route has its own
+// limit, or disables the filter if not limited.
+var bufferFilterGenFunc = func(sc *ci.ServiceInfo) (*hcmpb.HttpFilter, []*ci.MethodInfo, error) {
+	var maxRequestBytes uint32
+	var perRouteConfigRequiredMethods []*ci.MethodInfo
+	for _, operation := range sc.Operations {
+		method := sc.Methods[operation]
+		perRouteConfigRequiredMethods = append(perRouteConfigRequiredMethods, method)
+		if method.MaxRequestBytes > maxRequestBytes {
+			maxRequestBytes = method.MaxRequestBytes
+		}
+	}
+	if maxRequestBytes == 0 {
+		return nil, nil, nil
+	}
+
+	// The routes without methods, e.g. the catch-all not found route, use the
+	// filter config. It is --max_request_bytes if set, otherwise the largest
+	// limit of the operations.
+	if sc.Options.MaxRequestBytes > 0 {
+		maxRequestBytes = uint32(sc.Options.MaxRequestBytes)
+	}
+	filterConfig, err := ptypes.MarshalAny(&bufferpb.Buffer{
+		MaxRequestBytes: &wrapperspb.UInt32Value{Value: maxRequestBytes},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &hcmpb.HttpFilter{
+		Name:       util.Buffer,
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: filterConfig},
+	}, perRouteConfigRequiredMethods, nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filterconfig
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/jsonpb"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestBufferFilter(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc                     string
+		maxRequestBytes          int
+		operationMaxRequestBytes string
+		wantFilter               string
+		wantPerRoute             map[string]string
+	}{
+		{
+			desc: "No request limits",
+		},
+		{
+			desc:                     "No request limits with the overrides",
+			operationMaxRequestBytes: testApiName + ".CreateShelf=0",
+		},
+		{
+			desc:                     "Limit of an operation overriding max request bytes",
+			maxRequestBytes:          1024,
+			operationMaxRequestBytes: testApiName + ".CreateShelf=0",
+			wantFilter: `{
+  "name": "envoy.filters.http.buffer",
+  "typedConfig": {
+    "@type": "type.googleapis.com/envoy.extensions.filters.http.buffer.v3.Buffer",
+    "maxRequestBytes": 1024
+  }
+}`,
+			wantPerRoute: map[string]string{
+				testApiName + ".ListShelves": `{
+  "@type": "type.googleapis.com/envoy.extensions.filters.http.buffer.v3.BufferPerRoute",
+  "buffer": {
+    "maxRequestBytes": 1024
+  }
+}`,
+				testApiName + ".CreateShelf": `{
+  "@type": "type.googleapis.com/envoy.extensions.filters.http.buffer.v3.BufferPerRoute",
+  "disabled": true
+}`,
+			},
+		},
+		{
+			desc:                     "Limit of an operation only",
+			operationMaxRequestBytes: testApiName + ".CreateShelf=2048",
+			wantFilter: `{
+  "name": "envoy.filters.http.buffer",
+  "typedConfig": {
+    "@type": "type.googleapis.com/envoy.extensions.filters.http.buffer.v3.Buffer",
+    "maxRequestBytes": 2048
+  }
+}`,
+			wantPerRoute: map[string]string{
+				testApiName + ".ListShelves": `{
+  "@type": "type.googleapis.com/envoy.extensions.filters.http.buffer.v3.BufferPerRoute",
+  "disabled": true
+}`,
+				testApiName + ".CreateShelf": `{
+  "@type": "type.googleapis.com/envoy.extensions.filters.http.buffer.v3.BufferPerRoute",
+  "buffer": {
+    "maxRequestBytes": 2048
+  }
+}`,
+			},
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.MaxRequestBytes = tc.maxRequestBytes
+			opts.OperationMaxRequestBytes = tc.operationMaxRequestBytes
+			fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filter, methods, err := bufferFilterGenFunc(fakeServiceInfo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.wantFilter == "" {
+				if filter != nil || len(methods) != 0 {
+					t.Fatalf("got filter: %v for methods: %v, want no filter", filter, methods)
+				}
+				return
+			}
+
+			marshaler := &jsonpb.Marshaler{}
+			gotFilter, err := marshaler.MarshalToString(filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := util.JsonEqual(tc.wantFilter, gotFilter); err != nil {
+				t.Errorf("bufferFilterGenFunc failed, %v", err)
+			}
+
+			if len(methods) != len(tc.wantPerRoute) {
+				t.Fatalf("got %d methods with per-route config, want %d", len(methods), len(tc.wantPerRoute))
+			}
+			for _, method := range methods {
+				perRoute, err := bufferPerRouteFilterConfigGen(method, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gotPerRoute, err := marshaler.MarshalToString(perRoute)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := util.JsonEqual(tc.wantPerRoute[method.Operation()], gotPerRoute); err != nil {
+					t.Errorf("bufferPerRouteFilterConfigGen of %s failed, %v", method.Operation(), err)
+				}
+			}
+		})
+	}
+}
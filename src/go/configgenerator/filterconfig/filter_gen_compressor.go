@@ -0,0 +1,111 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filterconfig
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	brotlipb "github.com/envoyproxy/go-control-plane/envoy/extensions/compression/brotli/compressor/v3"
+	gzippb "github.com/envoyproxy/go-control-plane/envoy/extensions/compression/gzip/compressor/v3"
+	compressorpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/compressor/v3"
+	hcmpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
+)
+
+// parseCompressionAlgorithms parses the comma separated response compression
+// algorithms, each is either gzip or brotli.
+func parseCompressionAlgorithms(spec string) ([]string, error) {
+	var algorithms []string
+	seen := make(map[string]bool)
+	for _, algorithm := range strings.Split(spec, ",") {
+		algorithm = strings.TrimSpace(algorithm)
+		if algorithm == "" {
+			continue
+		}
+		if algorithm != "gzip" && algorithm != "brotli" {
+			return nil, fmt.Errorf("invalid response compression algorithm: %s, should be one of gzip or brotli", algorithm)
+		}
+		if seen[algorithm] {
+			return nil, fmt.Errorf("duplicated response compression algorithm: %s", algorithm)
+		}
+		seen[algorithm] = true
+		algorithms = append(algorithms, algorithm)
+	}
+	return algorithms, nil
+}
+
+// compressorFilterName returns the name of the compressor filter of the
+// algorithm. Each filter needs a distinct name, Envoy finds the compressor
+// extension by the type of the filter config.
+func compressorFilterName(algorithm string) string {
+	return fmt.Sprintf("%s.%s", util.Compressor, algorithm)
+}
+
+// makeCompressorFilter makes the compressor filter compressing the responses
+// with the algorithm. Each algorithm has its own filter, and Envoy picks the
+// one accepted by the client.
+func makeCompressorFilter(algorithm string, opts options.ConfigGeneratorOptions) (*hcmpb.HttpFilter, error) {
+	var libraryName string
+	var library proto.Message
+	switch algorithm {
+	case "gzip":
+		libraryName, library = util.GzipCompressor, &gzippb.Gzip{}
+	case "brotli":
+		libraryName, library = util.BrotliCompressor, &brotlipb.Brotli{}
+	default:
+		return nil, fmt.Errorf("invalid response compression algorithm: %s, should be one of gzip or brotli", algorithm)
+	}
+	libraryConfig, err := ptypes.MarshalAny(library)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling %s compressor library config to Any: %v", algorithm, err)
+	}
+
+	commonConfig := &compressorpb.Compressor_CommonDirectionConfig{}
+	if opts.ResponseCompressionMinContentLength >= 0 {
+		commonConfig.MinContentLength = &wrapperspb.UInt32Value{
+			Value: uint32(opts.ResponseCompressionMinContentLength),
+		}
+	}
+	for _, contentType := range strings.Split(opts.ResponseCompressionContentTypes, ",") {
+		if contentType = strings.TrimSpace(contentType); contentType != "" {
+			commonConfig.ContentType = append(commonConfig.ContentType, contentType)
+		}
+	}
+
+	compressor := &compressorpb.Compressor{
+		CompressorLibrary: &corepb.TypedExtensionConfig{
+			Name:        libraryName,
+			TypedConfig: libraryConfig,
+		},
+		ResponseDirectionConfig: &compressorpb.Compressor_ResponseDirectionConfig{
+			CommonConfig: commonConfig,
+		},
+	}
+	filterConfig, err := ptypes.MarshalAny(compressor)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling compressor filter config to Any: %v", err)
+	}
+	return &hcmpb.HttpFilter{
+		Name:       compressorFilterName(algorithm),
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: filterConfig},
+	}, nil
+}
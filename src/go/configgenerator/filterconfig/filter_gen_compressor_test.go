@@ -0,0 +1,189 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filterconfig
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/jsonpb"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestCompressorFilter(t *testing.T) {
+	testdata := []struct {
+		desc                string
+		responseCompression string
+		minContentLength    int
+		contentTypes        string
+		wantFilters         []string
+		wantError           string
+	}{
+		{
+			desc:             "No compressor filter without response compression",
+			minContentLength: -1,
+		},
+		{
+			desc:                "Generate compressor filters in order",
+			responseCompression: "brotli, gzip",
+			minContentLength:    -1,
+			wantFilters: []string{
+				`{
+  "name": "envoy.filters.http.compressor.brotli",
+  "typedConfig": {
+    "@type": "type.googleapis.com/envoy.extensions.filters.http.compressor.v3.Compressor",
+    "compressorLibrary": {
+      "name": "envoy.compression.brotli.compressor",
+      "typedConfig": {
+        "@type": "type.googleapis.com/envoy.extensions.compression.brotli.compressor.v3.Brotli"
+      }
+    },
+    "responseDirectionConfig": {
+      "commonConfig": {}
+    }
+  }
+}`,
+				`{
+  "name": "envoy.filters.http.compressor.gzip",
+  "typedConfig": {
+    "@type": "type.googleapis.com/envoy.extensions.filters.http.compressor.v3.Compressor",
+    "compressorLibrary": {
+      "name": "envoy.compression.gzip.compressor",
+      "typedConfig": {
+        "@type": "type.googleapis.com/envoy.extensions.compression.gzip.compressor.v3.Gzip"
+      }
+    },
+    "responseDirectionConfig": {
+      "commonConfig": {}
+    }
+  }
+}`,
+			},
+		},
+		{
+			desc:                "Generate compressor filter with min content length and content types",
+			responseCompression: "gzip",
+			minContentLength:    1024,
+			contentTypes:        "application/json, text/plain",
+			wantFilters: []string{
+				`{
+  "name": "envoy.filters.http.compressor.gzip",
+  "typedConfig": {
+    "@type": "type.googleapis.com/envoy.extensions.filters.http.compressor.v3.Compressor",
+    "compressorLibrary": {
+      "name": "envoy.compression.gzip.compressor",
+      "typedConfig": {
+        "@type": "type.googleapis.com/envoy.extensions.compression.gzip.compressor.v3.Gzip"
+      }
+    },
+    "responseDirectionConfig": {
+      "commonConfig": {
+        "contentType": [
+          "application/json",
+          "text/plain"
+        ],
+        "minContentLength": 1024
+      }
+    }
+  }
+}`,
+			},
+		},
+		{
+			desc:                "Invalid algorithm",
+			responseCompression: "deflate",
+			minContentLength:    -1,
+			wantError:           "invalid response compression algorithm: deflate, should be one of gzip or brotli",
+		},
+		{
+			desc:                "Duplicated algorithms",
+			responseCompression: "gzip,gzip",
+			minContentLength:    -1,
+			wantError:           "duplicated response compression algorithm: gzip",
+		},
+	}
+
+	for _, tc := range testdata {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeServiceConfig := &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+						Methods: []*apipb.Method{
+							{
+								Name: "ListShelves",
+							},
+						},
+					},
+				},
+			}
+
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.ResponseCompression = tc.responseCompression
+			opts.ResponseCompressionMinContentLength = tc.minContentLength
+			opts.ResponseCompressionContentTypes = tc.contentTypes
+			fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filterGenerators, err := MakeFilterGenerators(fakeServiceInfo)
+			if err != nil {
+				if tc.wantError == "" || err.Error() != tc.wantError {
+					t.Fatalf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("want error: %v, got no error", tc.wantError)
+			}
+
+			var gotFilters []string
+			marshaler := &jsonpb.Marshaler{}
+			for _, filterGenerator := range filterGenerators {
+				if !strings.HasPrefix(filterGenerator.FilterName, util.Compressor+".") {
+					continue
+				}
+				filter, _, err := filterGenerator.FilterGenFunc(fakeServiceInfo)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if filter.GetName() != filterGenerator.FilterName {
+					t.Errorf("got filter name: %s, want the generator name: %s", filter.GetName(), filterGenerator.FilterName)
+				}
+				gotFilter, err := marshaler.MarshalToString(filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gotFilters = append(gotFilters, gotFilter)
+			}
+
+			if len(gotFilters) != len(tc.wantFilters) {
+				t.Fatalf("got %d compressor filters, want %d", len(gotFilters), len(tc.wantFilters))
+			}
+			for i := range gotFilters {
+				if err := util.JsonEqual(tc.wantFilters[i], gotFilters[i]); err != nil {
+					t.Errorf("makeCompressorFilter failed,\n%v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filterconfig
+
+import (
+	"fmt"
+
+	ci "github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	hslpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/v10/http/header_size_limit"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/httppattern"
+	hcmpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/golang/protobuf/ptypes"
+	anypb "github.com/golang/protobuf/ptypes/any"
+)
+
+var hslPerRouteFilterConfigGen = func(method *ci.MethodInfo, httpRule *httppattern.Pattern) (*anypb.Any, error) {
+	if method.BackendInfo == nil || method.BackendInfo.MaxRequestHeadersKb == 0 {
+		return nil, nil
+	}
+
+	hslAny, err := ptypes.MarshalAny(&hslpb.PerRouteFilterConfig{
+		MaxRequestHeadersKb: method.BackendInfo.MaxRequestHeadersKb,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling header_size_limit per-route config to Any: %v", err)
+	}
+	return hslAny, nil
+}
+
+// The filter is only generated when any backend limits its request headers.
+var hslFilterGenFunc = func(sc *ci.ServiceInfo) (*hcmpb.HttpFilter, []*ci.MethodInfo, error) {
+	var perRouteConfigRequiredMethods []*ci.MethodInfo
+	for _, operation := range sc.Operations {
+		method := sc.Methods[operation]
+		if method.BackendInfo != nil && method.BackendInfo.MaxRequestHeadersKb > 0 {
+			perRouteConfigRequiredMethods = append(perRouteConfigRequiredMethods, method)
+		}
+	}
+	if len(perRouteConfigRequiredMethods) == 0 {
+		return nil, nil, nil
+	}
+	return &hcmpb.HttpFilter{
+		Name: util.HeaderSizeLimit,
+	}, perRouteConfigRequiredMethods, nil
+}
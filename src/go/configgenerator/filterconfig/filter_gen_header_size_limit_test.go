@@ -0,0 +1,111 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filterconfig
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	hslpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/v10/http/header_size_limit"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestHeaderSizeLimitFilter(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+		Backend: &confpb.Backend{
+			Rules: []*confpb.BackendRule{
+				{
+					Selector: testApiName + ".CreateShelf",
+					Address:  "https://remote.example.com:443",
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc                       string
+		backendMaxRequestHeadersKb string
+		wantOperation              string
+	}{
+		{
+			desc: "No limits",
+		},
+		{
+			desc:                       "Limit of the remote backend",
+			backendMaxRequestHeadersKb: "remote.example.com:443=16",
+			wantOperation:              testApiName + ".CreateShelf",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.BackendAddress = "http://127.0.0.1:80"
+			opts.BackendMaxRequestHeadersKb = tc.backendMaxRequestHeadersKb
+			fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filter, methods, err := hslFilterGenFunc(fakeServiceInfo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.wantOperation == "" {
+				if filter != nil || len(methods) != 0 {
+					t.Fatalf("got filter: %v for methods: %v, want no filter", filter, methods)
+				}
+				return
+			}
+			if len(methods) != 1 || methods[0].Operation() != tc.wantOperation {
+				t.Fatalf("got methods: %v, want only %s", methods, tc.wantOperation)
+			}
+
+			perRoute, err := hslPerRouteFilterConfigGen(methods[0], nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotPerRoute := &hslpb.PerRouteFilterConfig{}
+			if err := ptypes.UnmarshalAny(perRoute, gotPerRoute); err != nil {
+				t.Fatal(err)
+			}
+			wantPerRoute := &hslpb.PerRouteFilterConfig{
+				MaxRequestHeadersKb: 16,
+			}
+			if !proto.Equal(gotPerRoute, wantPerRoute) {
+				t.Errorf("got per-route config: %v, want: %v", gotPerRoute, wantPerRoute)
+			}
+		})
+	}
+}
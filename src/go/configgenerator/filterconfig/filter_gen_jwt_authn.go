@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/httppattern"
 	"github.com/golang/glog"
@@ -36,9 +37,15 @@ import (
 )
 
 var jaPerRouteFilterConfigGen = func(method *ci.MethodInfo, httpRule *httppattern.Pattern) (*anypb.Any, error) {
+	return MakeJwtPerRouteConfig(method.Operation())
+}
+
+// MakeJwtPerRouteConfig makes the jwt_authn per-route config to verify the JWT
+// requirement of the name.
+func MakeJwtPerRouteConfig(requirementName string) (*anypb.Any, error) {
 	jwtPerRoute := &jwtpb.PerRouteConfig{
 		RequirementSpecifier: &jwtpb.PerRouteConfig_RequirementName{
-			RequirementName: method.Operation(),
+			RequirementName: requirementName,
 		},
 	}
 	jwt, err := ptypes.MarshalAny(jwtPerRoute)
@@ -101,7 +108,7 @@ var jaFilterGenFunc = func(serviceInfo *ci.ServiceInfo) (*hcmpb.HttpFilter, []*c
 			},
 			FromHeaders:             fromHeaders,
 			FromParams:              fromParams,
-			ForwardPayloadHeader:    serviceInfo.Options.GeneratedHeaderPrefix + util.JwtAuthnForwardPayloadHeaderSuffix,
+			ForwardPayloadHeader:    jwtPayloadHeader(serviceInfo.Options),
 			Forward:                 true,
 			PadForwardPayloadHeader: serviceInfo.Options.JwtPadForwardPayloadHeader,
 		}
@@ -122,6 +129,12 @@ var jaFilterGenFunc = func(serviceInfo *ci.ServiceInfo) (*hcmpb.HttpFilter, []*c
 		// the JWT Payload will be send to metadata by envoy and it will be used by service control filter
 		// for logging and setting credential_id
 		jp.PayloadInMetadata = util.JwtPayloadMetadataName
+		if serviceInfo.AdditionalJwtProviders[provider.GetId()] {
+			// The JWT required together with the JWT of the caller is forwarded
+			// in its own header, and not reported as the caller.
+			jp.ForwardPayloadHeader = fmt.Sprintf("%s-%s", jwtPayloadHeader(serviceInfo.Options), provider.GetId())
+			jp.PayloadInMetadata = ""
+		}
 		providers[provider.GetId()] = jp
 	}
 
@@ -131,8 +144,61 @@ var jaFilterGenFunc = func(serviceInfo *ci.ServiceInfo) (*hcmpb.HttpFilter, []*c
 
 	requirements := make(map[string]*jwtpb.JwtRequirement)
 	for _, rule := range auth.GetRules() {
-		if len(rule.GetRequirements()) > 0 {
-			requirements[rule.GetSelector()] = makeJwtRequirement(rule.GetRequirements(), rule.GetAllowWithoutCredential())
+		if len(rule.GetRequirements()) == 0 {
+			continue
+		}
+		allowFailed := false
+		if method, ok := serviceInfo.Methods[rule.GetSelector()]; ok {
+			allowFailed = method.AllowMissingOrFailedJwt
+		}
+		require := makeJwtRequirement(rule.GetRequirements(), rule.GetAllowWithoutCredential() || allowFailed, allowFailed)
+
+		// All the rules of an operation are required.
+		requires, ok := requirements[rule.GetSelector()]
+		switch {
+		case !ok:
+			requirements[rule.GetSelector()] = require
+		case requires.GetRequiresAll() != nil:
+			requires.GetRequiresAll().Requirements = append(requires.GetRequiresAll().GetRequirements(), require)
+		default:
+			requirements[rule.GetSelector()] = &jwtpb.JwtRequirement{
+				RequiresType: &jwtpb.JwtRequirement_RequiresAll{
+					RequiresAll: &jwtpb.JwtRequirementAndList{
+						Requirements: []*jwtpb.JwtRequirement{requires, require},
+					},
+				},
+			}
+		}
+	}
+	// The JWT of the caller is overridden on a hostname, and the JWTs required
+	// together with it are still required.
+	for host, hostRequirements := range serviceInfo.HostAuthRequirements {
+		for selector, hostRequirement := range hostRequirements {
+			allowFailed := false
+			if method, ok := serviceInfo.Methods[selector]; ok {
+				allowFailed = method.AllowMissingOrFailedJwt
+			}
+			var requires []*jwtpb.JwtRequirement
+			if len(hostRequirement) > 0 {
+				requires = append(requires, makeJwtRequirement(hostRequirement, allowFailed, allowFailed))
+			}
+			for _, rule := range serviceInfo.AdditionalAuthRules[selector] {
+				requires = append(requires, makeJwtRequirement(rule.GetRequirements(), rule.GetAllowWithoutCredential() || allowFailed, allowFailed))
+			}
+
+			switch len(requires) {
+			case 0:
+			case 1:
+				requirements[util.HostJwtRequirementName(selector, host)] = requires[0]
+			default:
+				requirements[util.HostJwtRequirementName(selector, host)] = &jwtpb.JwtRequirement{
+					RequiresType: &jwtpb.JwtRequirement_RequiresAll{
+						RequiresAll: &jwtpb.JwtRequirementAndList{
+							Requirements: requires,
+						},
+					},
+				}
+			}
 		}
 	}
 
@@ -156,6 +222,15 @@ var jaFilterGenFunc = func(serviceInfo *ci.ServiceInfo) (*hcmpb.HttpFilter, []*c
 	return jwtAuthnFilter, perRouteConfigRequiredMethods, nil
 }
 
+// jwtPayloadHeader returns the header to forward the verified JWT payload to the
+// backend in.
+func jwtPayloadHeader(opts options.ConfigGeneratorOptions) string {
+	if opts.JwtPayloadHeader != "" {
+		return opts.JwtPayloadHeader
+	}
+	return opts.GeneratedHeaderPrefix + util.JwtAuthnForwardPayloadHeaderSuffix
+}
+
 func defaultJwtLocations() ([]*jwtpb.JwtHeader, []string, error) {
 	return []*jwtpb.JwtHeader{
 			{
@@ -196,7 +271,10 @@ func processJwtLocations(provider *confpb.AuthProvider) ([]*jwtpb.JwtHeader, []s
 	return jwtHeaders, jwtParams, nil
 }
 
-func makeJwtRequirement(requirements []*confpb.AuthRequirement, allow_missing bool) *jwtpb.JwtRequirement {
+// makeJwtRequirement makes the requirement to verify any of the requirements.
+// With allowMissing, the requests without a JWT are also allowed, and so are
+// the ones with a JWT failing the verification with allowFailed.
+func makeJwtRequirement(requirements []*confpb.AuthRequirement, allowMissing, allowFailed bool) *jwtpb.JwtRequirement {
 	// By default, if there are multi requirements, treat it as RequireAny.
 	requires := &jwtpb.JwtRequirement{
 		RequiresType: &jwtpb.JwtRequirement_RequiresAny{
@@ -228,18 +306,23 @@ func makeJwtRequirement(requirements []*confpb.AuthRequirement, allow_missing bo
 				},
 			}
 		}
-		if len(requirements) == 1 && !allow_missing {
+		if len(requirements) == 1 && !allowMissing {
 			requires = require
 		} else {
 			requires.GetRequiresAny().Requirements = append(requires.GetRequiresAny().GetRequirements(), require)
 		}
 	}
-	if allow_missing {
+	if allowMissing {
 		require := &jwtpb.JwtRequirement{
 			RequiresType: &jwtpb.JwtRequirement_AllowMissing{
 				AllowMissing: &emptypb.Empty{},
 			},
 		}
+		if allowFailed {
+			require.RequiresType = &jwtpb.JwtRequirement_AllowMissingOrFailed{
+				AllowMissingOrFailed: &emptypb.Empty{},
+			}
+		}
 		requires.GetRequiresAny().Requirements = append(requires.GetRequiresAny().GetRequirements(), require)
 	}
 
@@ -29,10 +29,13 @@ import (
 
 func TestJwtAuthnFilter(t *testing.T) {
 	testData := []struct {
-		desc                  string
-		fakeServiceConfig     *confpb.Service
-		disableJwksAsyncFetch bool
-		wantJwtAuthnFilter    string
+		desc                             string
+		fakeServiceConfig                *confpb.Service
+		disableJwksAsyncFetch            bool
+		hostAuthRequirements             map[string]map[string][]*confpb.AuthRequirement
+		jwtPayloadHeader                 string
+		jwtAllowMissingOrFailedSelectors string
+		wantJwtAuthnFilter               string
 	}{
 		{
 			desc: "Success. Generate jwt authn filter with default jwt locations",
@@ -114,6 +117,202 @@ func TestJwtAuthnFilter(t *testing.T) {
         }
     }
 }
+`,
+		},
+		{
+			desc: "Success. Generate jwt authn filter with custom jwt payload header",
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: "testapi",
+						Methods: []*apipb.Method{
+							{
+								Name: "foo",
+							},
+						},
+					},
+				},
+				SourceInfo: &confpb.SourceInfo{
+					SourceFiles: []*anypb.Any{content},
+				},
+				Authentication: &confpb.Authentication{
+					Providers: []*confpb.AuthProvider{
+						{
+							Id:      "auth_provider",
+							Issuer:  "issuer-0",
+							JwksUri: "https://fake-jwks.com?key=value",
+						},
+					},
+					Rules: []*confpb.AuthenticationRule{
+						{
+							Selector: "testapi.foo",
+							Requirements: []*confpb.AuthRequirement{
+								{
+									ProviderId: "auth_provider",
+								},
+							},
+						},
+					},
+				},
+			},
+			jwtPayloadHeader: "X-Jwt-Payload",
+			wantJwtAuthnFilter: `{
+    "name": "envoy.filters.http.jwt_authn",
+    "typedConfig": {
+        "@type": "type.googleapis.com/envoy.extensions.filters.http.jwt_authn.v3.JwtAuthentication",
+        "providers": {
+            "auth_provider": {
+                "audiences": [
+                    "https://bookstore.endpoints.project123.cloud.goog"
+                ],
+                "forward": true,
+                "forwardPayloadHeader": "X-Jwt-Payload",
+                "fromHeaders": [
+                    {
+                        "name": "Authorization",
+                        "valuePrefix": "Bearer "
+                    },
+                    {
+                        "name": "X-Goog-Iap-Jwt-Assertion"
+                    }
+                ],
+                "fromParams": [
+                    "access_token"
+                ],
+                "issuer": "issuer-0",
+                "payloadInMetadata": "jwt_payloads",
+                "remoteJwks": {
+                    "cacheDuration": "300s",
+                    "httpUri": {
+                        "cluster": "jwt-provider-cluster-fake-jwks.com:443",
+                        "timeout": "30s",
+                        "uri": "https://fake-jwks.com?key=value"
+                    },
+                    "asyncFetch": {}
+                }
+            }
+        },
+        "requirementMap": {
+            "testapi.foo": {
+                "providerName": "auth_provider"
+            }
+        }
+    }
+}
+`,
+		},
+		{
+			desc: "Success. Generate jwt authn filter with the requirements overridden by host allowing missing or failed jwt",
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: "testapi",
+						Methods: []*apipb.Method{
+							{
+								Name: "foo",
+							},
+						},
+					},
+				},
+				SourceInfo: &confpb.SourceInfo{
+					SourceFiles: []*anypb.Any{content},
+				},
+				Authentication: &confpb.Authentication{
+					Providers: []*confpb.AuthProvider{
+						{
+							Id:      "auth_provider",
+							Issuer:  "issuer-0",
+							JwksUri: "https://fake-jwks.com?key=value",
+						},
+					},
+					Rules: []*confpb.AuthenticationRule{
+						{
+							Selector: "testapi.foo",
+							Requirements: []*confpb.AuthRequirement{
+								{
+									ProviderId: "auth_provider",
+								},
+							},
+						},
+					},
+				},
+			},
+			hostAuthRequirements: map[string]map[string][]*confpb.AuthRequirement{
+				"partner.example.com": {
+					"testapi.foo": {
+						{
+							ProviderId: "auth_provider",
+						},
+					},
+				},
+			},
+			jwtAllowMissingOrFailedSelectors: "testapi.foo",
+			wantJwtAuthnFilter: `{
+    "name": "envoy.filters.http.jwt_authn",
+    "typedConfig": {
+        "@type": "type.googleapis.com/envoy.extensions.filters.http.jwt_authn.v3.JwtAuthentication",
+        "providers": {
+            "auth_provider": {
+                "audiences": [
+                    "https://bookstore.endpoints.project123.cloud.goog"
+                ],
+                "forward": true,
+                "forwardPayloadHeader": "X-Endpoint-API-UserInfo",
+                "fromHeaders": [
+                    {
+                        "name": "Authorization",
+                        "valuePrefix": "Bearer "
+                    },
+                    {
+                        "name": "X-Goog-Iap-Jwt-Assertion"
+                    }
+                ],
+                "fromParams": [
+                    "access_token"
+                ],
+                "issuer": "issuer-0",
+                "payloadInMetadata": "jwt_payloads",
+                "remoteJwks": {
+                    "cacheDuration": "300s",
+                    "httpUri": {
+                        "cluster": "jwt-provider-cluster-fake-jwks.com:443",
+                        "timeout": "30s",
+                        "uri": "https://fake-jwks.com?key=value"
+                    },
+                    "asyncFetch": {}
+                }
+            }
+        },
+        "requirementMap": {
+            "testapi.foo": {
+                "requiresAny": {
+                    "requirements": [
+                        {
+                            "providerName": "auth_provider"
+                        },
+                        {
+                            "allowMissingOrFailed": {}
+                        }
+                    ]
+                }
+            },
+            "testapi.foo@partner.example.com": {
+                "requiresAny": {
+                    "requirements": [
+                        {
+                            "providerName": "auth_provider"
+                        },
+                        {
+                            "allowMissingOrFailed": {}
+                        }
+                    ]
+                }
+            }
+        }
+    }
+}
 `,
 		},
 		{
@@ -297,6 +496,242 @@ func TestJwtAuthnFilter(t *testing.T) {
             }
         }
     }
+}`,
+		},
+		{
+			desc: "Success. Generate jwt authn filter allowing missing or failed jwt",
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: "testapi",
+						Methods: []*apipb.Method{
+							{
+								Name: "foo",
+							},
+						},
+					},
+				},
+				Authentication: &confpb.Authentication{
+					Providers: []*confpb.AuthProvider{
+						{
+							Id:      "auth_provider",
+							Issuer:  "issuer-0",
+							JwksUri: "https://fake-jwks.com",
+						},
+					},
+					Rules: []*confpb.AuthenticationRule{
+						{
+							Selector: "testapi.foo",
+							Requirements: []*confpb.AuthRequirement{
+								{
+									ProviderId: "auth_provider",
+								},
+							},
+						},
+					},
+				},
+			},
+			jwtAllowMissingOrFailedSelectors: "testapi.foo",
+			wantJwtAuthnFilter: `{
+    "name": "envoy.filters.http.jwt_authn",
+    "typedConfig": {
+        "@type": "type.googleapis.com/envoy.extensions.filters.http.jwt_authn.v3.JwtAuthentication",
+        "providers": {
+            "auth_provider": {
+                "audiences": [
+                    "https://bookstore.endpoints.project123.cloud.goog"
+                ],
+                "forward": true,
+                "forwardPayloadHeader": "X-Endpoint-API-UserInfo",
+                "fromHeaders": [
+                    {
+                        "name": "Authorization",
+                        "valuePrefix": "Bearer "
+                    },
+                    {
+                        "name": "X-Goog-Iap-Jwt-Assertion"
+                    }
+                ],
+                "fromParams": [
+                    "access_token"
+                ],
+                "issuer": "issuer-0",
+                "payloadInMetadata": "jwt_payloads",
+                "remoteJwks": {
+                    "cacheDuration": "300s",
+                    "httpUri": {
+                        "cluster": "jwt-provider-cluster-fake-jwks.com:443",
+                        "timeout": "30s",
+                        "uri": "https://fake-jwks.com"
+                    },
+                    "asyncFetch": {}
+                }
+            }
+        },
+        "requirementMap": {
+            "testapi.foo": {
+                "requiresAny": {
+                    "requirements": [
+                        {
+                            "providerName": "auth_provider"
+                        },
+                        {
+                            "allowMissingOrFailed": {}
+                        }
+                    ]
+                }
+            }
+        }
+    }
+}`,
+		},
+		{
+			desc: "Success. Generate jwt authn filter requiring all the rules of an operation",
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: "testapi",
+						Methods: []*apipb.Method{
+							{
+								Name: "foo",
+							},
+						},
+					},
+				},
+				Authentication: &confpb.Authentication{
+					Providers: []*confpb.AuthProvider{
+						{
+							Id:      "auth_provider",
+							Issuer:  "issuer-0",
+							JwksUri: "https://fake-jwks.com",
+						},
+						{
+							Id:      "service_provider",
+							Issuer:  "issuer-1",
+							JwksUri: "https://fake-jwks.com",
+							JwtLocations: []*confpb.JwtLocation{
+								{
+									In: &confpb.JwtLocation_Header{
+										Header: "X-Service-Authorization",
+									},
+								},
+							},
+						},
+					},
+					Rules: []*confpb.AuthenticationRule{
+						{
+							Selector: "testapi.foo",
+							Requirements: []*confpb.AuthRequirement{
+								{
+									ProviderId: "auth_provider",
+								},
+							},
+						},
+						{
+							Selector: "testapi.foo",
+							Requirements: []*confpb.AuthRequirement{
+								{
+									ProviderId: "service_provider",
+									Audiences:  "service-audience",
+								},
+							},
+						},
+					},
+				},
+			},
+			hostAuthRequirements: map[string]map[string][]*confpb.AuthRequirement{
+				"public.example.com": {
+					"testapi.foo": {},
+				},
+			},
+			wantJwtAuthnFilter: `{
+    "name": "envoy.filters.http.jwt_authn",
+    "typedConfig": {
+        "@type": "type.googleapis.com/envoy.extensions.filters.http.jwt_authn.v3.JwtAuthentication",
+        "providers": {
+            "auth_provider": {
+                "audiences": [
+                    "https://bookstore.endpoints.project123.cloud.goog"
+                ],
+                "forward": true,
+                "forwardPayloadHeader": "X-Endpoint-API-UserInfo",
+                "fromHeaders": [
+                    {
+                        "name": "Authorization",
+                        "valuePrefix": "Bearer "
+                    },
+                    {
+                        "name": "X-Goog-Iap-Jwt-Assertion"
+                    }
+                ],
+                "fromParams": [
+                    "access_token"
+                ],
+                "issuer": "issuer-0",
+                "payloadInMetadata": "jwt_payloads",
+                "remoteJwks": {
+                    "cacheDuration": "300s",
+                    "httpUri": {
+                        "cluster": "jwt-provider-cluster-fake-jwks.com:443",
+                        "timeout": "30s",
+                        "uri": "https://fake-jwks.com"
+                    },
+                    "asyncFetch": {}
+                }
+            },
+            "service_provider": {
+                "audiences": [
+                    "https://bookstore.endpoints.project123.cloud.goog"
+                ],
+                "forward": true,
+                "forwardPayloadHeader": "X-Endpoint-API-UserInfo-service_provider",
+                "fromHeaders": [
+                    {
+                        "name": "X-Service-Authorization"
+                    }
+                ],
+                "issuer": "issuer-1",
+                "remoteJwks": {
+                    "cacheDuration": "300s",
+                    "httpUri": {
+                        "cluster": "jwt-provider-cluster-fake-jwks.com:443",
+                        "timeout": "30s",
+                        "uri": "https://fake-jwks.com"
+                    },
+                    "asyncFetch": {}
+                }
+            }
+        },
+        "requirementMap": {
+            "testapi.foo": {
+                "requiresAll": {
+                    "requirements": [
+                        {
+                            "providerName": "auth_provider"
+                        },
+                        {
+                            "providerAndAudiences": {
+                                "providerName": "service_provider",
+                                "audiences": [
+                                    "service-audience"
+                                ]
+                            }
+                        }
+                    ]
+                }
+            },
+            "testapi.foo@public.example.com": {
+                "providerAndAudiences": {
+                    "providerName": "service_provider",
+                    "audiences": [
+                        "service-audience"
+                    ]
+                }
+            }
+        }
+    }
 }`,
 		},
 	}
@@ -305,10 +740,13 @@ func TestJwtAuthnFilter(t *testing.T) {
 		opts := options.DefaultConfigGeneratorOptions()
 		opts.BackendAddress = "grpc://127.0.0.0:80"
 		opts.DisableJwksAsyncFetch = tc.disableJwksAsyncFetch
+		opts.JwtPayloadHeader = tc.jwtPayloadHeader
+		opts.JwtAllowMissingOrFailedSelectors = tc.jwtAllowMissingOrFailedSelectors
 		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(tc.fakeServiceConfig, testConfigID, opts)
 		if err != nil {
 			t.Fatal(err)
 		}
+		fakeServiceInfo.HostAuthRequirements = tc.hostAuthRequirements
 
 		marshaler := &jsonpb.Marshaler{}
 		gotProto, _, _ := jaFilterGenFunc(fakeServiceInfo)
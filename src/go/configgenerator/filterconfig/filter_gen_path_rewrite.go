@@ -42,7 +42,7 @@ var prPerRouteFilterConfigGen = func(method *ci.MethodInfo, httpRule *httppatter
 
 var prFilterGenFunc = func(sc *ci.ServiceInfo) (*hcmpb.HttpFilter, []*ci.MethodInfo, error) {
 	perRouteConfigRequiredMethods, needed := needPathRewrite(sc)
-	if !needed {
+	if !needed && sc.Options.PathRewriteFilter != "on" {
 		return nil, nil, nil
 	}
 	return &hcmpb.HttpFilter{
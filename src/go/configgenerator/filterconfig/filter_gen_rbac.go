@@ -0,0 +1,165 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filterconfig
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/httppattern"
+	hcmpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/golang/protobuf/ptypes"
+	anypb "github.com/golang/protobuf/ptypes/any"
+
+	ci "github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	rbacconfigpb "github.com/envoyproxy/go-control-plane/envoy/config/rbac/v3"
+	rbacpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/rbac/v3"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+)
+
+var rbacPerRouteFilterConfigGen = func(method *ci.MethodInfo, httpRule *httppattern.Pattern) (*anypb.Any, error) {
+	perRoute := &rbacpb.RBACPerRoute{
+		Rbac: &rbacpb.RBAC{
+			Rules: &rbacconfigpb.RBAC{
+				Action: rbacconfigpb.RBAC_ALLOW,
+				Policies: map[string]*rbacconfigpb.Policy{
+					method.Operation(): {
+						Permissions: []*rbacconfigpb.Permission{
+							{
+								Rule: &rbacconfigpb.Permission_Any{
+									Any: true,
+								},
+							},
+						},
+						Principals: []*rbacconfigpb.Principal{
+							makeClaimsPrincipal(method.ClaimRequirements),
+						},
+					},
+				},
+			},
+		},
+	}
+	perRouteAny, err := ptypes.MarshalAny(perRoute)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling rbac per-route config to Any: %v", err)
+	}
+	return perRouteAny, nil
+}
+
+// The RBAC filter enforces the JWT claim requirements, so it must be after the
+// jwt_authn filter putting the verified JWT payloads into the metadata. Only
+// the routes of the methods with the requirements have policies.
+var rbacFilterGenFunc = func(sc *ci.ServiceInfo) (*hcmpb.HttpFilter, []*ci.MethodInfo, error) {
+	var perRouteConfigRequiredMethods []*ci.MethodInfo
+	for _, operation := range sc.Operations {
+		if method := sc.Methods[operation]; len(method.ClaimRequirements) > 0 {
+			perRouteConfigRequiredMethods = append(perRouteConfigRequiredMethods, method)
+		}
+	}
+	if len(perRouteConfigRequiredMethods) == 0 {
+		return nil, nil, nil
+	}
+
+	filterConfig, err := ptypes.MarshalAny(&rbacpb.RBAC{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &hcmpb.HttpFilter{
+		Name:       util.RBAC,
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: filterConfig},
+	}, perRouteConfigRequiredMethods, nil
+}
+
+// makeClaimsPrincipal makes the principal having all the claims.
+func makeClaimsPrincipal(requirements []*ci.ClaimRequirement) *rbacconfigpb.Principal {
+	var ids []*rbacconfigpb.Principal
+	for _, requirement := range requirements {
+		ids = append(ids, &rbacconfigpb.Principal{
+			Identifier: &rbacconfigpb.Principal_OrIds{
+				OrIds: &rbacconfigpb.Principal_Set{
+					Ids: []*rbacconfigpb.Principal{
+						makeClaimPrincipal(requirement.Claim, &matcher.ValueMatcher{
+							MatchPattern: &matcher.ValueMatcher_StringMatch{
+								StringMatch: &matcher.StringMatcher{
+									MatchPattern: &matcher.StringMatcher_SafeRegex{
+										SafeRegex: &matcher.RegexMatcher{
+											EngineType: &matcher.RegexMatcher_GoogleRe2{
+												GoogleRe2: &matcher.RegexMatcher_GoogleRE2{},
+											},
+											Regex: fmt.Sprintf("(.* )?%s( .*)?", regexp.QuoteMeta(requirement.Value)),
+										},
+									},
+								},
+							},
+						}),
+						makeClaimPrincipal(requirement.Claim, &matcher.ValueMatcher{
+							MatchPattern: &matcher.ValueMatcher_ListMatch{
+								ListMatch: &matcher.ListMatcher{
+									MatchPattern: &matcher.ListMatcher_OneOf{
+										OneOf: &matcher.ValueMatcher{
+											MatchPattern: &matcher.ValueMatcher_StringMatch{
+												StringMatch: &matcher.StringMatcher{
+													MatchPattern: &matcher.StringMatcher_Exact{
+														Exact: requirement.Value,
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						}),
+					},
+				},
+			},
+		})
+	}
+	if len(ids) == 1 {
+		return ids[0]
+	}
+	return &rbacconfigpb.Principal{
+		Identifier: &rbacconfigpb.Principal_AndIds{
+			AndIds: &rbacconfigpb.Principal_Set{
+				Ids: ids,
+			},
+		},
+	}
+}
+
+// makeClaimPrincipal matches the claim in the JWT payload the jwt_authn filter
+// puts into the metadata.
+func makeClaimPrincipal(claim string, value *matcher.ValueMatcher) *rbacconfigpb.Principal {
+	return &rbacconfigpb.Principal{
+		Identifier: &rbacconfigpb.Principal_Metadata{
+			Metadata: &matcher.MetadataMatcher{
+				Filter: util.JwtAuthn,
+				Path: []*matcher.MetadataMatcher_PathSegment{
+					{
+						Segment: &matcher.MetadataMatcher_PathSegment_Key{
+							Key: util.JwtPayloadMetadataName,
+						},
+					},
+					{
+						Segment: &matcher.MetadataMatcher_PathSegment_Key{
+							Key: claim,
+						},
+					},
+				},
+				Value: value,
+			},
+		},
+	}
+}
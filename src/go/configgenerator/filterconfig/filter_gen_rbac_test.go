@@ -0,0 +1,187 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filterconfig
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/jsonpb"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestRbacFilter(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "auth_provider",
+					Issuer:  "issuer-0",
+					JwksUri: "https://fake-jwks.com",
+				},
+			},
+			Rules: []*confpb.AuthenticationRule{
+				{
+					Selector: testApiName + ".CreateShelf",
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "auth_provider",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc              string
+		claimRequirements string
+		wantPerRoute      string
+	}{
+		{
+			desc: "No claim requirements",
+		},
+		{
+			desc:              "Claim requirement of an operation",
+			claimRequirements: testApiName + ".CreateShelf=scope:shelves.write",
+			wantPerRoute: `{
+  "@type": "type.googleapis.com/envoy.extensions.filters.http.rbac.v3.RBACPerRoute",
+  "rbac": {
+    "rules": {
+      "policies": {
+        "endpoints.examples.bookstore.Bookstore.CreateShelf": {
+          "permissions": [
+            {
+              "any": true
+            }
+          ],
+          "principals": [
+            {
+              "orIds": {
+                "ids": [
+                  {
+                    "metadata": {
+                      "filter": "envoy.filters.http.jwt_authn",
+                      "path": [
+                        {
+                          "key": "jwt_payloads"
+                        },
+                        {
+                          "key": "scope"
+                        }
+                      ],
+                      "value": {
+                        "stringMatch": {
+                          "safeRegex": {
+                            "googleRe2": {},
+                            "regex": "(.* )?shelves\\.write( .*)?"
+                          }
+                        }
+                      }
+                    }
+                  },
+                  {
+                    "metadata": {
+                      "filter": "envoy.filters.http.jwt_authn",
+                      "path": [
+                        {
+                          "key": "jwt_payloads"
+                        },
+                        {
+                          "key": "scope"
+                        }
+                      ],
+                      "value": {
+                        "listMatch": {
+                          "oneOf": {
+                            "stringMatch": {
+                              "exact": "shelves.write"
+                            }
+                          }
+                        }
+                      }
+                    }
+                  }
+                ]
+              }
+            }
+          ]
+        }
+      }
+    }
+  }
+}`,
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.BackendAddress = "grpc://127.0.0.1:80"
+			opts.JwtClaimRequirements = tc.claimRequirements
+			fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filter, methods, err := rbacFilterGenFunc(fakeServiceInfo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.wantPerRoute == "" {
+				if filter != nil || len(methods) != 0 {
+					t.Fatalf("got filter: %v for methods: %v, want no filter", filter, methods)
+				}
+				return
+			}
+			if filter.GetName() != util.RBAC {
+				t.Errorf("got filter: %v, want filter: %v", filter.GetName(), util.RBAC)
+			}
+			if len(methods) != 1 || methods[0].Operation() != testApiName+".CreateShelf" {
+				t.Fatalf("got methods: %v, want only %s.CreateShelf", methods, testApiName)
+			}
+
+			perRoute, err := rbacPerRouteFilterConfigGen(methods[0], nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotPerRoute, err := (&jsonpb.Marshaler{}).MarshalToString(perRoute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := util.JsonEqual(tc.wantPerRoute, gotPerRoute); err != nil {
+				t.Errorf("rbacPerRouteFilterConfigGen failed, %v", err)
+			}
+		})
+	}
+}
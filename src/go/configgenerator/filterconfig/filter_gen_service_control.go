@@ -16,6 +16,7 @@ package filterconfig
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	ci "github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
@@ -25,12 +26,20 @@ import (
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/httppattern"
 	hcmpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 	anypb "github.com/golang/protobuf/ptypes/any"
 	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
 	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
 )
 
+const (
+	// The check aggregation defaults of the service control filter, used when
+	// the flags are not set.
+	defaultCheckAggregationFlushIntervalMs = 60000
+	defaultCheckAggregationExpirationMs    = 300000
+)
+
 var scPerRouteFilterConfigGen = func(method *ci.MethodInfo, httpRule *httppattern.Pattern) (*anypb.Any, error) {
 	scPerRoute := &scpb.PerRouteFilterConfig{
 		OperationName: method.Operation(),
@@ -84,13 +93,24 @@ var scFilterGenFunc = func(serviceInfo *ci.ServiceInfo) (*hcmpb.HttpFilter, []*c
 			service.LogJwtPayloads[i] = strings.TrimSpace(service.LogJwtPayloads[i])
 		}
 	}
+	if serviceInfo.Options.LogLabels != "" {
+		logLabels, err := parseLogLabels(serviceInfo.Options.LogLabels)
+		if err != nil {
+			return nil, nil, err
+		}
+		service.LogLabels = logLabels
+	}
 	if serviceInfo.Options.MinStreamReportIntervalMs != 0 {
 		service.MinStreamReportIntervalMs = serviceInfo.Options.MinStreamReportIntervalMs
 	}
 	service.JwtPayloadMetadataName = util.JwtPayloadMetadataName
+	scCallingConfig, err := makeServiceControlCallingConfig(serviceInfo.Options)
+	if err != nil {
+		return nil, nil, err
+	}
 	filterConfig := &scpb.FilterConfig{
 		Services:        []*scpb.Service{service},
-		ScCallingConfig: makeServiceControlCallingConfig(serviceInfo.Options),
+		ScCallingConfig: scCallingConfig,
 		ServiceControlUri: &commonpb.HttpUri{
 			Uri:     serviceInfo.ServiceControlURI,
 			Cluster: util.ServiceControlClusterName,
@@ -98,37 +118,25 @@ var scFilterGenFunc = func(serviceInfo *ci.ServiceInfo) (*hcmpb.HttpFilter, []*c
 		},
 		GeneratedHeaderPrefix: serviceInfo.Options.GeneratedHeaderPrefix,
 	}
-
-	if serviceInfo.Options.ServiceControlCredentials != nil {
-		// Use access token fetched from Google Cloud IAM Server to talk to Service Controller
-		filterConfig.AccessToken = &scpb.FilterConfig_IamToken{
-			IamToken: &commonpb.IamTokenInfo{
-				IamUri: &commonpb.HttpUri{
-					Uri:     fmt.Sprintf("%s%s", serviceInfo.Options.IamURL, util.IamAccessTokenPath(serviceInfo.Options.ServiceControlCredentials.ServiceAccountEmail)),
-					Cluster: util.IamServerClusterName,
-					Timeout: ptypes.DurationProto(serviceInfo.Options.HttpRequestTimeout),
-				},
-				ServiceAccountEmail: serviceInfo.Options.ServiceControlCredentials.ServiceAccountEmail,
-				Delegates:           serviceInfo.Options.ServiceControlCredentials.Delegates,
-				AccessToken:         serviceInfo.AccessToken,
-			},
-		}
-	} else {
-		filterConfig.AccessToken = &scpb.FilterConfig_ImdsToken{
-			ImdsToken: serviceInfo.AccessToken.GetRemoteToken(),
-		}
-
+	for i, uri := range serviceInfo.ServiceControlFailoverURIs {
+		filterConfig.ServiceControlFailoverUris = append(filterConfig.ServiceControlFailoverUris, &commonpb.HttpUri{
+			Uri:     uri,
+			Cluster: util.ServiceControlFailoverClusterName(i),
+			Timeout: ptypes.DurationProto(serviceInfo.Options.HttpRequestTimeout),
+		})
 	}
 
-	if serviceInfo.GcpAttributes != nil {
-		filterConfig.GcpAttributes = serviceInfo.GcpAttributes
+	backend, err := GetTelemetryBackend(serviceInfo.Options)
+	if err != nil {
+		return nil, nil, err
 	}
-	if serviceInfo.Options.ComputePlatformOverride != "" {
-		if filterConfig.GcpAttributes == nil {
-			filterConfig.GcpAttributes = &scpb.GcpAttributes{}
-		}
-		filterConfig.GcpAttributes.Platform = serviceInfo.Options.ComputePlatformOverride
+	backend.SetAccessToken(serviceInfo, filterConfig)
+
+	gcpAttributes, err := makeGcpAttributes(serviceInfo)
+	if err != nil {
+		return nil, nil, err
 	}
+	filterConfig.GcpAttributes = gcpAttributes
 
 	var perRouteConfigRequiredMethods []*ci.MethodInfo
 	for _, operation := range serviceInfo.Operations {
@@ -140,6 +148,8 @@ var scFilterGenFunc = func(serviceInfo *ci.ServiceInfo) (*hcmpb.HttpFilter, []*c
 			ApiVersion:         method.ApiVersion,
 			SkipServiceControl: method.SkipServiceControl,
 			MetricCosts:        method.MetricCosts,
+			QuotaTiers:         method.QuotaTiers,
+			ReportSampling:     method.ReportSampling,
 		}
 
 		// For these OPTIONS methods, auth should be disabled and AllowWithoutApiKey
@@ -167,6 +177,10 @@ var scFilterGenFunc = func(serviceInfo *ci.ServiceInfo) (*hcmpb.HttpFilter, []*c
 	}
 	filterConfig.DepErrorBehavior = depErrorBehaviorEnum
 
+	if serviceInfo.Options.QuotaRetryAfter > 0 {
+		filterConfig.QuotaRetryAfter = ptypes.DurationProto(serviceInfo.Options.QuotaRetryAfter)
+	}
+
 	scs, err := ptypes.MarshalAny(filterConfig)
 	if err != nil {
 		return nil, nil, err
@@ -178,7 +192,45 @@ var scFilterGenFunc = func(serviceInfo *ci.ServiceInfo) (*hcmpb.HttpFilter, []*c
 	return filter, perRouteConfigRequiredMethods, nil
 }
 
-func makeServiceControlCallingConfig(opts options.ConfigGeneratorOptions) *scpb.ServiceControlCallingConfig {
+// makeGcpAttributes returns the gcp attributes fetched from the metadata
+// server, with the overrides of the flags applied. The overrides allow the
+// proxies not running on GCP to report meaningful values.
+func makeGcpAttributes(serviceInfo *ci.ServiceInfo) (*scpb.GcpAttributes, error) {
+	opts := serviceInfo.Options
+	if opts.ComputeZoneOverride != "" && opts.ComputeRegionOverride != "" {
+		return nil, fmt.Errorf("flags --compute_zone_override and --compute_region_override cannot be both set")
+	}
+
+	var attrs *scpb.GcpAttributes
+	if serviceInfo.GcpAttributes != nil {
+		// Copy it, the fetched attributes are shared by the generated configs.
+		attrs = proto.Clone(serviceInfo.GcpAttributes).(*scpb.GcpAttributes)
+	}
+	if opts.ComputePlatformOverride == "" && opts.ComputeZoneOverride == "" &&
+		opts.ComputeRegionOverride == "" && opts.ProjectIdOverride == "" {
+		return attrs, nil
+	}
+
+	if attrs == nil {
+		attrs = &scpb.GcpAttributes{}
+	}
+	if opts.ComputePlatformOverride != "" {
+		attrs.Platform = opts.ComputePlatformOverride
+	}
+	// The zone field holds the region for the regional platforms.
+	if opts.ComputeZoneOverride != "" {
+		attrs.Zone = opts.ComputeZoneOverride
+	}
+	if opts.ComputeRegionOverride != "" {
+		attrs.Zone = opts.ComputeRegionOverride
+	}
+	if opts.ProjectIdOverride != "" {
+		attrs.ProjectId = opts.ProjectIdOverride
+	}
+	return attrs, nil
+}
+
+func makeServiceControlCallingConfig(opts options.ConfigGeneratorOptions) (*scpb.ServiceControlCallingConfig, error) {
 	setting := &scpb.ServiceControlCallingConfig{}
 	setting.NetworkFailOpen = &wrapperspb.BoolValue{Value: opts.ServiceControlNetworkFailOpen}
 
@@ -201,7 +253,97 @@ func makeServiceControlCallingConfig(opts options.ConfigGeneratorOptions) *scpb.
 	if opts.ScReportRetries > -1 {
 		setting.ReportRetries = &wrapperspb.UInt32Value{Value: uint32(opts.ScReportRetries)}
 	}
-	return setting
+
+	if opts.ScReportAggregationEntries > -1 {
+		setting.ReportAggregationEntries = &wrapperspb.UInt32Value{Value: uint32(opts.ScReportAggregationEntries)}
+	}
+	if opts.ScReportAggregationFlushIntervalMs > 0 {
+		setting.ReportAggregationFlushIntervalMs = &wrapperspb.UInt32Value{Value: uint32(opts.ScReportAggregationFlushIntervalMs)}
+	}
+
+	// Either may be left to the filter default, e.g. a flush interval longer
+	// than the default expiration.
+	flushIntervalMs := opts.ScCheckAggregationFlushIntervalMs
+	if flushIntervalMs <= 0 {
+		flushIntervalMs = defaultCheckAggregationFlushIntervalMs
+	}
+	expirationMs := opts.ScCheckAggregationExpirationMs
+	if expirationMs <= 0 {
+		expirationMs = defaultCheckAggregationExpirationMs
+	}
+	if expirationMs <= flushIntervalMs {
+		return nil, fmt.Errorf("check aggregation expiration (%vms) must be longer than the flush interval (%vms)", expirationMs, flushIntervalMs)
+	}
+	if opts.ScCheckAggregationEntries > -1 {
+		setting.CheckAggregationEntries = &wrapperspb.UInt32Value{Value: uint32(opts.ScCheckAggregationEntries)}
+	}
+	if opts.ScCheckAggregationFlushIntervalMs > 0 {
+		setting.CheckAggregationFlushIntervalMs = &wrapperspb.UInt32Value{Value: uint32(opts.ScCheckAggregationFlushIntervalMs)}
+	}
+	if opts.ScCheckAggregationExpirationMs > 0 {
+		setting.CheckAggregationExpirationMs = &wrapperspb.UInt32Value{Value: uint32(opts.ScCheckAggregationExpirationMs)}
+	}
+
+	reportQueue, err := makeReportQueueConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	setting.ReportQueue = reportQueue
+	return setting, nil
+}
+
+func makeReportQueueConfig(opts options.ConfigGeneratorOptions) (*scpb.ReportQueueConfig, error) {
+	if opts.ScReportQueueMaxSize <= 0 {
+		if opts.ScReportDiskSpillDir != "" {
+			return nil, fmt.Errorf("report disk spill directory (%v) requires a report queue max size", opts.ScReportDiskSpillDir)
+		}
+		return nil, nil
+	}
+
+	dropPolicy, ok := scpb.ReportQueueConfig_DropPolicy_value[opts.ScReportQueueDropPolicy]
+	if !ok {
+		keys := make([]string, 0, len(scpb.ReportQueueConfig_DropPolicy_value))
+		for k := range scpb.ReportQueueConfig_DropPolicy_value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("unknown value for report queue drop policy (%v), accepted values are: %+q", opts.ScReportQueueDropPolicy, keys)
+	}
+
+	reportQueue := &scpb.ReportQueueConfig{
+		MaxPendingReports: uint32(opts.ScReportQueueMaxSize),
+		DropPolicy:        scpb.ReportQueueConfig_DropPolicy(dropPolicy),
+	}
+	if opts.ScReportDiskSpillDir != "" {
+		if opts.ScReportDiskSpillMaxBytes == 0 {
+			return nil, fmt.Errorf("report disk spill directory (%v) requires the max bytes to be > 0", opts.ScReportDiskSpillDir)
+		}
+		reportQueue.DiskSpillDir = opts.ScReportDiskSpillDir
+		reportQueue.DiskSpillMaxBytes = opts.ScReportDiskSpillMaxBytes
+	}
+	return reportQueue, nil
+}
+
+// parseLogLabels parses the comma separated custom log labels, each in the
+// format of KEY=VALUE, e.g. "environment=staging,region=us-central1".
+func parseLogLabels(spec string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid log label %q, should be in KEY=VALUE format", item)
+		}
+		key := strings.TrimSpace(parts[0])
+		if _, ok := labels[key]; ok {
+			return nil, fmt.Errorf("duplicated log label %q", key)
+		}
+		labels[key] = strings.TrimSpace(parts[1])
+	}
+	return labels, nil
 }
 
 func copyServiceConfigForReportMetrics(src *confpb.Service) *confpb.Service {
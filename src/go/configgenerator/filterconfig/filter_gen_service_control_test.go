@@ -15,12 +15,17 @@
 package filterconfig
 
 import (
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	scpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/v10/http/service_control"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
 
 	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
 	apipb "google.golang.org/genproto/protobuf/api"
@@ -47,6 +52,11 @@ func TestServiceControl(t *testing.T) {
 		desc                            string
 		serviceControlCredentials       *options.IAMCredentialsOptions
 		serviceAccountKey               string
+		reportSuccessSamplingRates      string
+		quotaTiers                      []*scpb.QuotaTier
+		telemetryBackend                string
+		serviceControlURL               string
+		quotaRetryAfter                 time.Duration
 		wantPartialServiceControlFilter string
 	}{
 		{
@@ -95,6 +105,66 @@ func TestServiceControl(t *testing.T) {
       "uri": "http://127.0.0.1:8791/local/access_token"
     },`,
 		},
+		{
+			desc:              "no access token for the service control compatible backend",
+			telemetryBackend:  "servicecontrol_compatible",
+			serviceControlURL: "http://servicecontrol.internal:8080",
+			wantPartialServiceControlFilter: `
+    "noAccessToken": {},`,
+		},
+		{
+			desc:                       "report sampling for the operation",
+			reportSuccessSamplingRates: "endpoints.examples.bookstore.Bookstore.ListShelves=0.01",
+			wantPartialServiceControlFilter: `
+    "requirements": [
+      {
+        "apiName": "endpoints.examples.bookstore.Bookstore",
+        "operationName": "endpoints.examples.bookstore.Bookstore.ListShelves",
+        "reportSampling": {
+          "successRate": 0.01
+        },
+        "serviceName": "bookstore.endpoints.project123.cloud.goog"
+      }
+    ],`,
+		},
+		{
+			desc: "quota tiers for the operation",
+			quotaTiers: []*scpb.QuotaTier{
+				{
+					ConsumerProjectNumbers: []string{"123"},
+					MetricCosts: []*scpb.MetricCost{
+						{
+							Name: "read-requests",
+							Cost: 10,
+						},
+					},
+				},
+			},
+			wantPartialServiceControlFilter: `
+    "requirements": [
+      {
+        "apiName": "endpoints.examples.bookstore.Bookstore",
+        "operationName": "endpoints.examples.bookstore.Bookstore.ListShelves",
+        "quotaTiers": [
+          {
+            "consumerProjectNumbers": ["123"],
+            "metricCosts": [
+              {
+                "cost": "10",
+                "name": "read-requests"
+              }
+            ]
+          }
+        ],
+        "serviceName": "bookstore.endpoints.project123.cloud.goog"
+      }
+    ],`,
+		},
+		{
+			desc:                            "retry after for the quota denials",
+			quotaRetryAfter:                 1500 * time.Millisecond,
+			wantPartialServiceControlFilter: `"quotaRetryAfter": "1.500s",`,
+		},
 	}
 	for _, tc := range testData {
 		t.Run(tc.desc, func(t *testing.T) {
@@ -102,11 +172,20 @@ func TestServiceControl(t *testing.T) {
 			opts := options.DefaultConfigGeneratorOptions()
 			opts.ServiceControlCredentials = tc.serviceControlCredentials
 			opts.ServiceAccountKey = tc.serviceAccountKey
+			opts.ReportSuccessSamplingRates = tc.reportSuccessSamplingRates
+			opts.QuotaRetryAfter = tc.quotaRetryAfter
+			if tc.telemetryBackend != "" {
+				opts.TelemetryBackend = tc.telemetryBackend
+			}
+			if tc.serviceControlURL != "" {
+				opts.ServiceControlURL = tc.serviceControlURL
+			}
 
 			fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
 			if err != nil {
 				t.Error(err)
 			}
+			fakeServiceInfo.Methods[testApiName+".ListShelves"].QuotaTiers = tc.quotaTiers
 
 			marshaler := &jsonpb.Marshaler{}
 			filter, _, err := scFilterGenFunc(fakeServiceInfo)
@@ -125,3 +204,416 @@ func TestServiceControl(t *testing.T) {
 		})
 	}
 }
+
+func TestMakeGcpAttributes(t *testing.T) {
+	testData := []struct {
+		desc                    string
+		fetchedGcpAttributes    *scpb.GcpAttributes
+		computePlatformOverride string
+		computeZoneOverride     string
+		computeRegionOverride   string
+		projectIdOverride       string
+		wantGcpAttributes       *scpb.GcpAttributes
+		wantError               string
+	}{
+		{
+			desc: "no gcp attributes without metadata server or overrides",
+		},
+		{
+			desc: "fetched gcp attributes without overrides",
+			fetchedGcpAttributes: &scpb.GcpAttributes{
+				ProjectId: "project-a",
+				Zone:      "us-west1-a",
+				Platform:  util.GCE,
+			},
+			wantGcpAttributes: &scpb.GcpAttributes{
+				ProjectId: "project-a",
+				Zone:      "us-west1-a",
+				Platform:  util.GCE,
+			},
+		},
+		{
+			desc:                    "overrides without metadata server",
+			computePlatformOverride: "on-prem",
+			computeZoneOverride:     "datacenter-1a",
+			projectIdOverride:       "project-b",
+			wantGcpAttributes: &scpb.GcpAttributes{
+				ProjectId: "project-b",
+				Zone:      "datacenter-1a",
+				Platform:  "on-prem",
+			},
+		},
+		{
+			desc: "region override replaces the fetched zone",
+			fetchedGcpAttributes: &scpb.GcpAttributes{
+				ProjectId: "project-a",
+				Zone:      "us-west1-a",
+				Platform:  util.GCE,
+			},
+			computeRegionOverride: "us-west1",
+			wantGcpAttributes: &scpb.GcpAttributes{
+				ProjectId: "project-a",
+				Zone:      "us-west1",
+				Platform:  util.GCE,
+			},
+		},
+		{
+			desc:                  "zone and region overrides are exclusive",
+			computeZoneOverride:   "datacenter-1a",
+			computeRegionOverride: "datacenter-1",
+			wantError:             "flags --compute_zone_override and --compute_region_override cannot be both set",
+		},
+	}
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.ComputePlatformOverride = tc.computePlatformOverride
+			opts.ComputeZoneOverride = tc.computeZoneOverride
+			opts.ComputeRegionOverride = tc.computeRegionOverride
+			opts.ProjectIdOverride = tc.projectIdOverride
+			serviceInfo := &configinfo.ServiceInfo{
+				Options:       opts,
+				GcpAttributes: tc.fetchedGcpAttributes,
+			}
+			var fetched *scpb.GcpAttributes
+			if tc.fetchedGcpAttributes != nil {
+				fetched = proto.Clone(tc.fetchedGcpAttributes).(*scpb.GcpAttributes)
+			}
+
+			got, err := makeGcpAttributes(serviceInfo)
+			if err != nil {
+				if tc.wantError == "" || err.Error() != tc.wantError {
+					t.Fatalf("makeGcpAttributes got error %v, want %q", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("makeGcpAttributes got no error, want %q", tc.wantError)
+			}
+			if !proto.Equal(got, tc.wantGcpAttributes) {
+				t.Errorf("makeGcpAttributes got %v, want %v", got, tc.wantGcpAttributes)
+			}
+			if !proto.Equal(serviceInfo.GcpAttributes, fetched) {
+				t.Errorf("makeGcpAttributes modified the fetched gcp attributes to %v", serviceInfo.GcpAttributes)
+			}
+		})
+	}
+}
+
+func TestMakeReportQueueConfig(t *testing.T) {
+	testData := []struct {
+		desc            string
+		maxSize         int
+		dropPolicy      string
+		diskSpillDir    string
+		diskSpillMax    uint64
+		wantReportQueue string
+		wantError       string
+	}{
+		{
+			desc: "report queue is not bounded by default",
+		},
+		{
+			desc:            "bounded report queue dropping the oldest reports",
+			maxSize:         100,
+			dropPolicy:      "DROP_OLDEST",
+			wantReportQueue: `{"dropPolicy":"DROP_OLDEST","maxPendingReports":100}`,
+		},
+		{
+			desc:            "bounded report queue with disk spill",
+			maxSize:         100,
+			diskSpillDir:    "/var/spool/espv2",
+			diskSpillMax:    1024,
+			wantReportQueue: `{"diskSpillDir":"/var/spool/espv2","diskSpillMaxBytes":"1024","maxPendingReports":100}`,
+		},
+		{
+			desc:         "disk spill without report queue",
+			diskSpillDir: "/var/spool/espv2",
+			wantError:    "report disk spill directory (/var/spool/espv2) requires a report queue max size",
+		},
+		{
+			desc:         "disk spill without max bytes",
+			maxSize:      100,
+			diskSpillDir: "/var/spool/espv2",
+			wantError:    "report disk spill directory (/var/spool/espv2) requires the max bytes to be > 0",
+		},
+		{
+			desc:       "unknown drop policy",
+			maxSize:    100,
+			dropPolicy: "DROP_RANDOM",
+			wantError:  `unknown value for report queue drop policy (DROP_RANDOM), accepted values are: ["DROP_NEWEST" "DROP_OLDEST"]`,
+		},
+	}
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.ScReportQueueMaxSize = tc.maxSize
+			if tc.dropPolicy != "" {
+				opts.ScReportQueueDropPolicy = tc.dropPolicy
+			}
+			opts.ScReportDiskSpillDir = tc.diskSpillDir
+			opts.ScReportDiskSpillMaxBytes = tc.diskSpillMax
+
+			got, err := makeServiceControlCallingConfig(opts)
+			if tc.wantError != "" {
+				if err == nil || err.Error() != tc.wantError {
+					t.Fatalf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.wantReportQueue == "" {
+				if got.GetReportQueue() != nil {
+					t.Errorf("got report queue: %v, want none", got.GetReportQueue())
+				}
+				return
+			}
+			marshaler := &jsonpb.Marshaler{}
+			gotReportQueue, err := marshaler.MarshalToString(got.GetReportQueue())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := util.JsonEqual(tc.wantReportQueue, gotReportQueue); err != nil {
+				t.Errorf("makeServiceControlCallingConfig failed,\n%v", err)
+			}
+		})
+	}
+}
+
+func TestMakeReportAggregationConfig(t *testing.T) {
+	testData := []struct {
+		desc                string
+		entries             int
+		flushIntervalMs     int
+		wantEntries         *wrapperspb.UInt32Value
+		wantFlushIntervalMs *wrapperspb.UInt32Value
+	}{
+		{
+			desc:    "filter defaults are used if not set",
+			entries: -1,
+		},
+		{
+			desc:        "aggregation disabled",
+			entries:     0,
+			wantEntries: &wrapperspb.UInt32Value{Value: 0},
+		},
+		{
+			desc:                "larger aggregation flushed less often",
+			entries:             50000,
+			flushIntervalMs:     5000,
+			wantEntries:         &wrapperspb.UInt32Value{Value: 50000},
+			wantFlushIntervalMs: &wrapperspb.UInt32Value{Value: 5000},
+		},
+	}
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.ScReportAggregationEntries = tc.entries
+			opts.ScReportAggregationFlushIntervalMs = tc.flushIntervalMs
+
+			got, err := makeServiceControlCallingConfig(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(got.GetReportAggregationEntries(), tc.wantEntries) {
+				t.Errorf("got report aggregation entries: %v, want: %v", got.GetReportAggregationEntries(), tc.wantEntries)
+			}
+			if !proto.Equal(got.GetReportAggregationFlushIntervalMs(), tc.wantFlushIntervalMs) {
+				t.Errorf("got report aggregation flush interval: %v, want: %v", got.GetReportAggregationFlushIntervalMs(), tc.wantFlushIntervalMs)
+			}
+		})
+	}
+}
+
+func TestMakeCheckAggregationConfig(t *testing.T) {
+	testData := []struct {
+		desc                string
+		entries             int
+		flushIntervalMs     int
+		expirationMs        int
+		wantEntries         *wrapperspb.UInt32Value
+		wantFlushIntervalMs *wrapperspb.UInt32Value
+		wantExpirationMs    *wrapperspb.UInt32Value
+		wantError           string
+	}{
+		{
+			desc:    "filter defaults are used if not set",
+			entries: -1,
+		},
+		{
+			desc:        "check cache disabled",
+			entries:     0,
+			wantEntries: &wrapperspb.UInt32Value{Value: 0},
+		},
+		{
+			desc:                "shorter expiration for API key revocation",
+			entries:             -1,
+			flushIntervalMs:     10000,
+			expirationMs:        30000,
+			wantFlushIntervalMs: &wrapperspb.UInt32Value{Value: 10000},
+			wantExpirationMs:    &wrapperspb.UInt32Value{Value: 30000},
+		},
+		{
+			desc:            "expiration not longer than the flush interval",
+			entries:         -1,
+			flushIntervalMs: 10000,
+			expirationMs:    10000,
+			wantError:       "check aggregation expiration (10000ms) must be longer than the flush interval (10000ms)",
+		},
+		{
+			desc:            "flush interval not shorter than the default expiration",
+			entries:         -1,
+			flushIntervalMs: 300000,
+			wantError:       "check aggregation expiration (300000ms) must be longer than the flush interval (300000ms)",
+		},
+		{
+			desc:         "expiration not longer than the default flush interval",
+			entries:      -1,
+			expirationMs: 30000,
+			wantError:    "check aggregation expiration (30000ms) must be longer than the flush interval (60000ms)",
+		},
+	}
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.ScCheckAggregationEntries = tc.entries
+			opts.ScCheckAggregationFlushIntervalMs = tc.flushIntervalMs
+			opts.ScCheckAggregationExpirationMs = tc.expirationMs
+
+			got, err := makeServiceControlCallingConfig(opts)
+			if tc.wantError != "" {
+				if err == nil || err.Error() != tc.wantError {
+					t.Fatalf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(got.GetCheckAggregationEntries(), tc.wantEntries) {
+				t.Errorf("got check aggregation entries: %v, want: %v", got.GetCheckAggregationEntries(), tc.wantEntries)
+			}
+			if !proto.Equal(got.GetCheckAggregationFlushIntervalMs(), tc.wantFlushIntervalMs) {
+				t.Errorf("got check aggregation flush interval: %v, want: %v", got.GetCheckAggregationFlushIntervalMs(), tc.wantFlushIntervalMs)
+			}
+			if !proto.Equal(got.GetCheckAggregationExpirationMs(), tc.wantExpirationMs) {
+				t.Errorf("got check aggregation expiration: %v, want: %v", got.GetCheckAggregationExpirationMs(), tc.wantExpirationMs)
+			}
+		})
+	}
+}
+
+func TestParseLogLabels(t *testing.T) {
+	testData := []struct {
+		desc       string
+		spec       string
+		wantLabels map[string]string
+		wantError  string
+	}{
+		{
+			desc: "multiple labels",
+			spec: "environment=staging, region=us-central1",
+			wantLabels: map[string]string{
+				"environment": "staging",
+				"region":      "us-central1",
+			},
+		},
+		{
+			desc: "empty value",
+			spec: "environment=",
+			wantLabels: map[string]string{
+				"environment": "",
+			},
+		},
+		{
+			desc:      "missing value",
+			spec:      "environment",
+			wantError: `invalid log label "environment", should be in KEY=VALUE format`,
+		},
+		{
+			desc:      "duplicated labels",
+			spec:      "region=us-central1,region=us-west1",
+			wantError: `duplicated log label "region"`,
+		},
+	}
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := parseLogLabels(tc.spec)
+			if tc.wantError != "" {
+				if err == nil || err.Error() != tc.wantError {
+					t.Fatalf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.wantLabels) {
+				t.Errorf("got log labels: %v, want: %v", got, tc.wantLabels)
+			}
+		})
+	}
+}
+
+func TestGetTelemetryBackend(t *testing.T) {
+	testData := []struct {
+		desc                 string
+		telemetryBackend     string
+		serviceControlURL    string
+		wantFilterAndCluster bool
+		wantError            string
+	}{
+		{
+			desc:                 "google service control by default",
+			wantFilterAndCluster: true,
+		},
+		{
+			desc:                 "service control compatible backend",
+			telemetryBackend:     "servicecontrol_compatible",
+			serviceControlURL:    "http://servicecontrol.internal:8080",
+			wantFilterAndCluster: true,
+		},
+		{
+			desc:             "service control compatible backend requires the self-hosted server",
+			telemetryBackend: "servicecontrol_compatible",
+			wantError:        "telemetry backend servicecontrol_compatible requires the service control URL to be the self-hosted server, got https://servicecontrol.googleapis.com",
+		},
+		{
+			desc:             "noop backend",
+			telemetryBackend: "noop",
+		},
+		{
+			desc:             "unknown backend",
+			telemetryBackend: "stackdriver",
+			wantError:        `unknown telemetry backend (stackdriver), accepted values are: ["noop" "servicecontrol" "servicecontrol_compatible"]`,
+		},
+	}
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			if tc.telemetryBackend != "" {
+				opts.TelemetryBackend = tc.telemetryBackend
+			}
+			if tc.serviceControlURL != "" {
+				opts.ServiceControlURL = tc.serviceControlURL
+			}
+
+			backend, err := GetTelemetryBackend(opts)
+			if tc.wantError != "" {
+				if err == nil || err.Error() != tc.wantError {
+					t.Fatalf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if backend.RequiresServiceControlFilter != tc.wantFilterAndCluster {
+				t.Errorf("got RequiresServiceControlFilter: %v, want: %v", backend.RequiresServiceControlFilter, tc.wantFilterAndCluster)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filterconfig
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/httppattern"
+	hcmpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/golang/protobuf/ptypes"
+	anypb "github.com/golang/protobuf/ptypes/any"
+
+	ci "github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	luapb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/lua/v3"
+)
+
+// The routes without status overrides keep the transcoded statuses.
+const noopStatusOverrideLua = `function envoy_on_response(response_handle) end
+`
+
+// The transcoder converts the gRPC error statuses to the JSON google.rpc.Status
+// bodies, so the overrides are looked up by the "code" in the body.
+const statusOverrideLuaTemplate = `local overrides = {
+%s}
+
+function envoy_on_response(response_handle)
+  local headers = response_handle:headers()
+  local content_type = headers:get("content-type")
+  if tonumber(headers:get(":status")) < 400 or content_type == nil or string.find(content_type, "application/json", 1, true) ~= 1 then
+    return
+  end
+  local body = response_handle:body()
+  if body == nil then
+    return
+  end
+  local code = string.match(body:getBytes(0, body:length()), '"code"%%s*:%%s*(%%d+)')
+  local override = overrides[tonumber(code)]
+  if override == nil then
+    return
+  end
+  headers:replace(":status", override.status)
+  if override.retry_after ~= nil then
+    headers:replace("retry-after", override.retry_after)
+  end
+end
+`
+
+var soPerRouteFilterConfigGen = func(method *ci.MethodInfo, httpRule *httppattern.Pattern) (*anypb.Any, error) {
+	perRoute := &luapb.LuaPerRoute{
+		Override: &luapb.LuaPerRoute_SourceCode{
+			SourceCode: &corepb.DataSource{
+				Specifier: &corepb.DataSource_InlineString{
+					InlineString: makeStatusOverrideLua(method.StatusOverrides),
+				},
+			},
+		},
+	}
+	perRouteAny, err := ptypes.MarshalAny(perRoute)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling lua per-route config to Any: %v", err)
+	}
+	return perRouteAny, nil
+}
+
+var soFilterGenFunc = func(sc *ci.ServiceInfo) (*hcmpb.HttpFilter, []*ci.MethodInfo, error) {
+	var perRouteConfigRequiredMethods []*ci.MethodInfo
+	for _, operation := range sc.Operations {
+		if method := sc.Methods[operation]; len(method.StatusOverrides) > 0 {
+			perRouteConfigRequiredMethods = append(perRouteConfigRequiredMethods, method)
+		}
+	}
+	if len(perRouteConfigRequiredMethods) == 0 {
+		return nil, nil, nil
+	}
+
+	filterConfig, err := ptypes.MarshalAny(&luapb.Lua{
+		InlineCode: noopStatusOverrideLua,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &hcmpb.HttpFilter{
+		Name:       util.Lua,
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: filterConfig},
+	}, perRouteConfigRequiredMethods, nil
+}
+
+// makeStatusOverrideLua generates the Lua script rewriting the status of the
+// transcoded responses of a method.
+func makeStatusOverrideLua(overrides []*ci.StatusOverride) string {
+	sorted := append([]*ci.StatusOverride{}, overrides...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].GrpcCode < sorted[j].GrpcCode })
+
+	var entries strings.Builder
+	for _, o := range sorted {
+		if o.RetryAfter > 0 {
+			fmt.Fprintf(&entries, "  [%d] = {status = \"%d\", retry_after = \"%d\"},\n", o.GrpcCode, o.HttpStatus, int(math.Ceil(o.RetryAfter.Seconds())))
+		} else {
+			fmt.Fprintf(&entries, "  [%d] = {status = \"%d\"},\n", o.GrpcCode, o.HttpStatus)
+		}
+	}
+	return fmt.Sprintf(statusOverrideLuaTemplate, entries.String())
+}
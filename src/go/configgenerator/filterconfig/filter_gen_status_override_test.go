@@ -0,0 +1,106 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filterconfig
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/golang/protobuf/ptypes"
+
+	luapb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/lua/v3"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestStatusOverrideFilter(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc           string
+		statusOverride string
+		wantFilter     bool
+		wantScript     string
+	}{
+		{
+			desc: "No status overrides",
+		},
+		{
+			desc:           "Status overrides of an operation",
+			statusOverride: testApiName + ".CreateShelf=RESOURCE_EXHAUSTED:429:1500ms,ALREADY_EXISTS:409",
+			wantFilter:     true,
+			wantScript: `local overrides = {
+  [6] = {status = "409"},
+  [8] = {status = "429", retry_after = "2"},
+}
+`,
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.BackendAddress = "grpc://127.0.0.1:80"
+			opts.TranscodingStatusOverrides = tc.statusOverride
+			fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filter, methods, err := soFilterGenFunc(fakeServiceInfo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tc.wantFilter {
+				if filter != nil || len(methods) != 0 {
+					t.Fatalf("got filter: %v for methods: %v, want no filter", filter, methods)
+				}
+				return
+			}
+			if len(methods) != 1 || methods[0].Operation() != testApiName+".CreateShelf" {
+				t.Fatalf("got methods: %v, want only %s.CreateShelf", methods, testApiName)
+			}
+
+			perRoute, err := soPerRouteFilterConfigGen(methods[0], nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotPerRoute := &luapb.LuaPerRoute{}
+			if err := ptypes.UnmarshalAny(perRoute, gotPerRoute); err != nil {
+				t.Fatal(err)
+			}
+			if gotScript := gotPerRoute.GetSourceCode().GetInlineString(); !strings.HasPrefix(gotScript, tc.wantScript) {
+				t.Errorf("got script: %s, want script starting with: %s", gotScript, tc.wantScript)
+			}
+		})
+	}
+}
@@ -27,6 +27,7 @@ import (
 	commonpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/v10/http/common"
 
 	routepb "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	corspb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/cors/v3"
 	transcoderpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/grpc_json_transcoder/v3"
 	hcpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/health_check/v3"
 	routerpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/router/v3"
@@ -62,14 +63,19 @@ type FilterGenFunc func(sc *ci.ServiceInfo) (*hcmpb.HttpFilter, []*ci.MethodInfo
 
 // MakeFilterGenerators provide of a slice of FilterGenerator in sequence.
 func MakeFilterGenerators(serviceInfo *ci.ServiceInfo) ([]*FilterGenerator, error) {
+	if err := validateFilterToggles(serviceInfo); err != nil {
+		return nil, err
+	}
+
 	filterGenerators := []*FilterGenerator{}
 
 	if serviceInfo.Options.CorsPreset == "basic" || serviceInfo.Options.CorsPreset == "cors_with_regex" {
 		filterGenerators = append(filterGenerators, &FilterGenerator{
 			FilterName: util.CORS,
 			FilterGenFunc: func(sc *ci.ServiceInfo) (*hcmpb.HttpFilter, []*ci.MethodInfo, error) {
-				corsFilter := &hcmpb.HttpFilter{
-					Name: util.CORS,
+				corsFilter, err := makeCorsFilter()
+				if err != nil {
+					return nil, nil, err
 				}
 				return corsFilter, nil, nil
 			},
@@ -91,6 +97,26 @@ func MakeFilterGenerators(serviceInfo *ci.ServiceInfo) ([]*FilterGenerator, erro
 		})
 	}
 
+	// Add Compressor filters if needed. They must be before gRPC Transcoder
+	// filter so they compress the responses after they are transcoded.
+	algorithms, err := parseCompressionAlgorithms(serviceInfo.Options.ResponseCompression)
+	if err != nil {
+		return nil, err
+	}
+	for _, algorithm := range algorithms {
+		algorithm := algorithm
+		filterGenerators = append(filterGenerators, &FilterGenerator{
+			FilterName: compressorFilterName(algorithm),
+			FilterGenFunc: func(sc *ci.ServiceInfo) (*hcmpb.HttpFilter, []*ci.MethodInfo, error) {
+				filter, err := makeCompressorFilter(algorithm, serviceInfo.Options)
+				if err != nil {
+					return nil, nil, err
+				}
+				return filter, nil, nil
+			},
+		})
+	}
+
 	// Add JWT Authn filter if needed.
 	if !serviceInfo.Options.SkipJwtAuthnFilter {
 		// TODO(b/176432170): Handle errors here, prevent startup.
@@ -101,8 +127,22 @@ func MakeFilterGenerators(serviceInfo *ci.ServiceInfo) ([]*FilterGenerator, erro
 		})
 	}
 
+	// Add RBAC filter to enforce the JWT claim requirements if needed. It must
+	// be behind JWT Authn filter.
+	if serviceInfo.Options.JwtClaimRequirements != "" {
+		filterGenerators = append(filterGenerators, &FilterGenerator{
+			FilterName:            util.RBAC,
+			FilterGenFunc:         rbacFilterGenFunc,
+			PerRouteConfigGenFunc: rbacPerRouteFilterConfigGen,
+		})
+	}
+
 	// Add Service Control filter if needed.
-	if !serviceInfo.Options.SkipServiceControlFilter {
+	backend, err := GetTelemetryBackend(serviceInfo.Options)
+	if err != nil {
+		return nil, err
+	}
+	if !serviceInfo.Options.SkipServiceControlFilter && backend.RequiresServiceControlFilter {
 		filterGenerators = append(filterGenerators, &FilterGenerator{
 			FilterName:            util.ServiceControl,
 			FilterGenFunc:         scFilterGenFunc,
@@ -110,44 +150,90 @@ func MakeFilterGenerators(serviceInfo *ci.ServiceInfo) ([]*FilterGenerator, erro
 		})
 	}
 
+	// Add Buffer filter to limit the request body size if needed. It is behind
+	// Service Control filter so the rejected requests are not buffered.
+	if serviceInfo.Options.MaxRequestBytes != 0 || serviceInfo.Options.OperationMaxRequestBytes != "" {
+		filterGenerators = append(filterGenerators, &FilterGenerator{
+			FilterName:            util.Buffer,
+			FilterGenFunc:         bufferFilterGenFunc,
+			PerRouteConfigGenFunc: bufferPerRouteFilterConfigGen,
+		})
+	}
+
 	// Add gRPC Transcoder filter and gRPCWeb filter configs for gRPC backend.
 	if serviceInfo.GrpcSupportRequired {
+		// status override filter should be before grpc transcoder filter so it
+		// encodes the responses after they are transcoded.
+		if serviceInfo.Options.TranscodingStatusOverrides != "" && !serviceInfo.Options.SkipTranscoderFilter {
+			filterGenerators = append(filterGenerators, &FilterGenerator{
+				FilterName:            util.Lua,
+				FilterGenFunc:         soFilterGenFunc,
+				PerRouteConfigGenFunc: soPerRouteFilterConfigGen,
+			})
+		}
+
 		// grpc-web filter should be before grpc transcoder filter.
 		// It converts content-type application/grpc-web to application/grpc and
 		// grpc transcoder will bypass requests with application/grpc content type.
 		// Otherwise grpc transcoder will try to transcode a grpc-web request which
 		// will fail.
+		if !serviceInfo.Options.SkipGrpcWebFilter {
+			filterGenerators = append(filterGenerators, &FilterGenerator{
+				FilterName: util.GRPCWeb,
+				FilterGenFunc: func(sc *ci.ServiceInfo) (*hcmpb.HttpFilter, []*ci.MethodInfo, error) {
+					return &hcmpb.HttpFilter{
+						Name: util.GRPCWeb,
+					}, nil, nil
+				},
+			})
+		}
+
+		if !serviceInfo.Options.SkipTranscoderFilter {
+			filterGenerators = append(filterGenerators, &FilterGenerator{
+				FilterName: util.GRPCJSONTranscoder,
+				FilterGenFunc: func(sc *ci.ServiceInfo) (*hcmpb.HttpFilter, []*ci.MethodInfo, error) {
+					filter, err := makeTranscoderFilter(serviceInfo)
+					if err != nil {
+						return nil, nil, err
+					}
+					return filter, nil, nil
+				},
+			})
+		}
+	}
+
+	if !serviceInfo.Options.SkipBackendAuthFilter {
 		filterGenerators = append(filterGenerators, &FilterGenerator{
-			FilterName: util.GRPCWeb,
-			FilterGenFunc: func(sc *ci.ServiceInfo) (*hcmpb.HttpFilter, []*ci.MethodInfo, error) {
-				return &hcmpb.HttpFilter{
-					Name: util.GRPCWeb,
-				}, nil, nil
-			},
+			FilterName:            util.BackendAuth,
+			FilterGenFunc:         baFilterGenFunc,
+			PerRouteConfigGenFunc: baPerRouteFilterConfigGen,
 		})
+	}
 
+	// Add Path Rewrite filter unless it is forced off.
+	switch serviceInfo.Options.PathRewriteFilter {
+	case "auto", "on":
 		filterGenerators = append(filterGenerators, &FilterGenerator{
-			FilterName: util.GRPCJSONTranscoder,
-			FilterGenFunc: func(sc *ci.ServiceInfo) (*hcmpb.HttpFilter, []*ci.MethodInfo, error) {
-				filter, err := makeTranscoderFilter(serviceInfo)
-				if err != nil {
-					return nil, nil, err
-				}
-				return filter, nil, nil
-			},
+			FilterName:            util.PathRewrite,
+			FilterGenFunc:         prFilterGenFunc,
+			PerRouteConfigGenFunc: prPerRouteFilterConfigGen,
 		})
+	case "off":
+		// The backends would receive the paths untranslated.
+		if methods, needed := needPathRewrite(serviceInfo); needed {
+			return nil, fmt.Errorf("path_rewrite_filter is off, but the backend rule of operation %s requires path translation", methods[0].Operation())
+		}
+		glog.Infof("path rewrite filter is disabled by flag")
+	default:
+		return nil, fmt.Errorf("invalid path_rewrite_filter: %s, should be one of auto, on or off", serviceInfo.Options.PathRewriteFilter)
 	}
 
+	// Add HeaderSizeLimit filter after the filters adding the request headers,
+	// like the backend auth token, so they are counted in the limits.
 	filterGenerators = append(filterGenerators, &FilterGenerator{
-		FilterName:            util.BackendAuth,
-		FilterGenFunc:         baFilterGenFunc,
-		PerRouteConfigGenFunc: baPerRouteFilterConfigGen,
-	})
-
-	filterGenerators = append(filterGenerators, &FilterGenerator{
-		FilterName:            util.PathRewrite,
-		FilterGenFunc:         prFilterGenFunc,
-		PerRouteConfigGenFunc: prPerRouteFilterConfigGen,
+		FilterName:            util.HeaderSizeLimit,
+		FilterGenFunc:         hslFilterGenFunc,
+		PerRouteConfigGenFunc: hslPerRouteFilterConfigGen,
 	})
 
 	if serviceInfo.Options.EnableGrpcForHttp1 {
@@ -174,6 +260,28 @@ func MakeFilterGenerators(serviceInfo *ci.ServiceInfo) ([]*FilterGenerator, erro
 	return filterGenerators, nil
 }
 
+// validateFilterToggles checks the skipped filters are not required by other
+// filters or by the service config.
+func validateFilterToggles(serviceInfo *ci.ServiceInfo) error {
+	opts := serviceInfo.Options
+	if opts.SkipJwtAuthnFilter && !opts.SkipServiceControlFilter && opts.LogJwtPayloads != "" {
+		return fmt.Errorf("jwt_authn filter cannot be skipped when log_jwt_payloads is set, service_control filter reads the JWT payloads from it")
+	}
+	if opts.SkipJwtAuthnFilter && opts.JwtClaimRequirements != "" {
+		return fmt.Errorf("jwt_authn filter cannot be skipped when jwt_claim_requirements is set, rbac filter reads the JWT payloads from it")
+	}
+
+	if opts.SkipBackendAuthFilter {
+		for _, operation := range serviceInfo.Operations {
+			method := serviceInfo.Methods[operation]
+			if method.BackendInfo != nil && method.BackendInfo.JwtAudience != "" {
+				return fmt.Errorf("backend_auth filter cannot be skipped, operation %s requires JWT authentication to its backend", operation)
+			}
+		}
+	}
+	return nil
+}
+
 func updateProtoDescriptor(service *confpb.Service, apiNames []string, descriptorBytes []byte) ([]byte, error) {
 	// To support specifying custom http rules in service config.
 	// Envoy grpc_json_transcoder only uses the http.rules in the proto descriptor
@@ -327,6 +435,21 @@ func makeHealthCheckFilter(serviceInfo *ci.ServiceInfo) (*hcmpb.HttpFilter, erro
 	}, nil
 }
 
+// makeCorsFilter makes the filter enforcing the CORS policy of the virtual
+// host, and responding to the preflight requests without calling the backend.
+// The CORS requests are passed through to the backend without the filter, for
+// the services with allow_cors to handle them.
+func makeCorsFilter() (*hcmpb.HttpFilter, error) {
+	cors, err := ptypes.MarshalAny(&corspb.Cors{})
+	if err != nil {
+		return nil, err
+	}
+	return &hcmpb.HttpFilter{
+		Name:       util.CORS,
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: cors},
+	}, nil
+}
+
 func makeRouterFilter(opts options.ConfigGeneratorOptions) *hcmpb.HttpFilter {
 	router, _ := ptypes.MarshalAny(&routerpb.Router{
 		SuppressEnvoyHeaders: opts.SuppressEnvoyHeaders,
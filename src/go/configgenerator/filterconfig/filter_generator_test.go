@@ -17,6 +17,7 @@ package filterconfig
 import (
 	"encoding/base64"
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
@@ -26,7 +27,9 @@ import (
 	descpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
 	"github.com/golang/protobuf/ptypes"
 
+	hcmpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 	anypb "github.com/golang/protobuf/ptypes/any"
+	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
 	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
 	smpb "google.golang.org/genproto/googleapis/api/servicemanagement/v1"
 	apipb "google.golang.org/genproto/protobuf/api"
@@ -240,6 +243,54 @@ func TestTranscoderFilter(t *testing.T) {
          "%s"
       ]
    }
+}
+      `, fakeProtoDescriptor, testApiName),
+		},
+		{
+			desc: "Success. Generate transcoder filter with all the services of multiple apis",
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+						Methods: []*apipb.Method{
+							{
+								Name: "foo",
+							},
+						},
+					},
+					{
+						Name: "endpoints.examples.bookstore.v2.Bookstore",
+						Methods: []*apipb.Method{
+							{
+								Name: "bar",
+							},
+						},
+					},
+				},
+				SourceInfo: &confpb.SourceInfo{
+					SourceFiles: []*anypb.Any{content},
+				},
+			},
+			wantTranscoderFilter: fmt.Sprintf(`
+{
+   "name":"envoy.filters.http.grpc_json_transcoder",
+   "typedConfig":{
+      "@type":"type.googleapis.com/envoy.extensions.filters.http.grpc_json_transcoder.v3.GrpcJsonTranscoder",
+      "autoMapping":true,
+      "convertGrpcStatus":true,
+      "queryParamUnescapePlus":true,
+      "ignoredQueryParameters":[
+         "api_key",
+         "key"
+      ],
+      "printOptions":{},
+      "protoDescriptorBin":"%s",
+      "services":[
+         "%s",
+         "endpoints.examples.bookstore.v2.Bookstore"
+      ]
+   }
 }
       `, fakeProtoDescriptor, testApiName),
 		},
@@ -407,3 +458,346 @@ func TestHealthCheckFilter(t *testing.T) {
 		}
 	}
 }
+
+func TestCorsFilter(t *testing.T) {
+	testdata := []struct {
+		desc           string
+		corsPreset     string
+		allowCors      bool
+		wantCorsFilter string
+	}{
+		{
+			desc: "No cors filter without cors preset",
+		},
+		{
+			desc:      "No cors filter for the backend handling cors with allow_cors",
+			allowCors: true,
+		},
+		{
+			desc:       "Generate cors filter for basic preset",
+			corsPreset: "basic",
+			wantCorsFilter: `{
+        "name": "envoy.filters.http.cors",
+        "typedConfig": {
+          "@type":"type.googleapis.com/envoy.extensions.filters.http.cors.v3.Cors"
+        }
+      }`,
+		},
+		{
+			desc:       "Generate cors filter for cors_with_regex preset",
+			corsPreset: "cors_with_regex",
+			wantCorsFilter: `{
+        "name": "envoy.filters.http.cors",
+        "typedConfig": {
+          "@type":"type.googleapis.com/envoy.extensions.filters.http.cors.v3.Cors"
+        }
+      }`,
+		},
+	}
+
+	for _, tc := range testdata {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeServiceConfig := &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+						Methods: []*apipb.Method{
+							{
+								Name: "ListShelves",
+							},
+						},
+					},
+				},
+				Endpoints: []*confpb.Endpoint{
+					{
+						Name:      testProjectName,
+						AllowCors: tc.allowCors,
+					},
+				},
+			}
+
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.CorsPreset = tc.corsPreset
+			opts.CorsAllowOrigin = "*"
+			opts.CorsAllowOriginRegex = ".*"
+			fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filterGenerators, err := MakeFilterGenerators(fakeServiceInfo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var filter *hcmpb.HttpFilter
+			for _, filterGenerator := range filterGenerators {
+				if filterGenerator.FilterName != util.CORS {
+					continue
+				}
+				if filter, _, err = filterGenerator.FilterGenFunc(fakeServiceInfo); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if tc.wantCorsFilter == "" {
+				if filter != nil {
+					t.Errorf("got cors filter: %v, want none", filter)
+				}
+				return
+			}
+			if filter == nil {
+				t.Fatal("got no cors filter")
+			}
+
+			marshaler := &jsonpb.Marshaler{}
+			gotFilter, err := marshaler.MarshalToString(filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := util.JsonEqual(tc.wantCorsFilter, gotFilter); err != nil {
+				t.Errorf("makeCorsFilter failed,\n%v", err)
+			}
+		})
+	}
+}
+
+func TestPathRewriteFilter(t *testing.T) {
+	testdata := []struct {
+		desc              string
+		pathTranslation   bool
+		pathRewriteFilter string
+		wantFilter        bool
+		wantError         string
+	}{
+		{
+			desc:              "auto, generated when path translation is needed",
+			pathTranslation:   true,
+			pathRewriteFilter: "auto",
+			wantFilter:        true,
+		},
+		{
+			desc:              "auto, skipped when path translation is not needed",
+			pathRewriteFilter: "auto",
+		},
+		{
+			desc:              "on, generated even if path translation is not needed",
+			pathRewriteFilter: "on",
+			wantFilter:        true,
+		},
+		{
+			desc:              "off, skipped when path translation is not needed",
+			pathRewriteFilter: "off",
+		},
+		{
+			desc:              "off, rejected when path translation is needed",
+			pathTranslation:   true,
+			pathRewriteFilter: "off",
+			wantError:         fmt.Sprintf("path_rewrite_filter is off, but the backend rule of operation %s.ListShelves requires path translation", testApiName),
+		},
+		{
+			desc:              "invalid value",
+			pathRewriteFilter: "enabled",
+			wantError:         "invalid path_rewrite_filter: enabled, should be one of auto, on or off",
+		},
+	}
+
+	for _, tc := range testdata {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeServiceConfig := &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+						Methods: []*apipb.Method{
+							{
+								Name: "ListShelves",
+							},
+						},
+					},
+				},
+				Http: &annotationspb.Http{
+					Rules: []*annotationspb.HttpRule{
+						{
+							Selector: fmt.Sprintf("%s.ListShelves", testApiName),
+							Pattern: &annotationspb.HttpRule_Get{
+								Get: "/shelves",
+							},
+						},
+					},
+				},
+			}
+			if tc.pathTranslation {
+				fakeServiceConfig.Backend = &confpb.Backend{
+					Rules: []*confpb.BackendRule{
+						{
+							Selector:        fmt.Sprintf("%s.ListShelves", testApiName),
+							Address:         "https://mybackend.com/api",
+							PathTranslation: confpb.BackendRule_APPEND_PATH_TO_ADDRESS,
+						},
+					},
+				}
+			}
+
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.PathRewriteFilter = tc.pathRewriteFilter
+			fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filterGenerators, err := MakeFilterGenerators(fakeServiceInfo)
+			if err != nil {
+				if tc.wantError == "" || err.Error() != tc.wantError {
+					t.Fatalf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("want error: %v, got no error", tc.wantError)
+			}
+
+			gotFilter := false
+			for _, filterGenerator := range filterGenerators {
+				if filterGenerator.FilterName != util.PathRewrite {
+					continue
+				}
+				filter, _, err := filterGenerator.FilterGenFunc(fakeServiceInfo)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gotFilter = filter != nil
+			}
+
+			if gotFilter != tc.wantFilter {
+				t.Errorf("got path rewrite filter: %v, want: %v", gotFilter, tc.wantFilter)
+			}
+		})
+	}
+}
+
+func TestFilterToggles(t *testing.T) {
+	testdata := []struct {
+		desc                     string
+		backendAddress           string
+		jwtAudience              string
+		skipBackendAuthFilter    bool
+		skipGrpcWebFilter        bool
+		skipTranscoderFilter     bool
+		skipJwtAuthnFilter       bool
+		skipServiceControlFilter bool
+		telemetryBackend         string
+		logJwtPayloads           string
+		wantFilters              []string
+		wantError                string
+	}{
+		{
+			desc:           "no filters are skipped for gRPC backend",
+			backendAddress: "grpc://127.0.0.1:80",
+			wantFilters:    []string{util.JwtAuthn, util.ServiceControl, util.GRPCWeb, util.GRPCJSONTranscoder, util.BackendAuth, util.PathRewrite, util.HeaderSizeLimit, util.GrpcMetadataScrubber, util.Router},
+		},
+		{
+			desc:                 "skip grpc web and transcoder filters",
+			backendAddress:       "grpc://127.0.0.1:80",
+			skipGrpcWebFilter:    true,
+			skipTranscoderFilter: true,
+			wantFilters:          []string{util.JwtAuthn, util.ServiceControl, util.BackendAuth, util.PathRewrite, util.HeaderSizeLimit, util.GrpcMetadataScrubber, util.Router},
+		},
+		{
+			desc:                     "skip all optional filters",
+			backendAddress:           "grpc://127.0.0.1:80",
+			skipBackendAuthFilter:    true,
+			skipGrpcWebFilter:        true,
+			skipTranscoderFilter:     true,
+			skipJwtAuthnFilter:       true,
+			skipServiceControlFilter: true,
+			wantFilters:              []string{util.PathRewrite, util.HeaderSizeLimit, util.GrpcMetadataScrubber, util.Router},
+		},
+		{
+			desc:             "no service control filter for the noop telemetry backend",
+			backendAddress:   "grpc://127.0.0.1:80",
+			telemetryBackend: "noop",
+			wantFilters:      []string{util.JwtAuthn, util.GRPCWeb, util.GRPCJSONTranscoder, util.BackendAuth, util.PathRewrite, util.HeaderSizeLimit, util.GrpcMetadataScrubber, util.Router},
+		},
+		{
+			desc:                  "backend auth filter cannot be skipped if required by backend rule",
+			backendAddress:        "http://127.0.0.1:80",
+			jwtAudience:           "mybackend.com",
+			skipBackendAuthFilter: true,
+			wantError:             "backend_auth filter cannot be skipped, operation endpoints.examples.bookstore.Bookstore.ListShelves requires JWT authentication to its backend",
+		},
+		{
+			desc:               "jwt authn filter cannot be skipped if jwt payloads are logged",
+			backendAddress:     "http://127.0.0.1:80",
+			skipJwtAuthnFilter: true,
+			logJwtPayloads:     "sub",
+			wantError:          "jwt_authn filter cannot be skipped when log_jwt_payloads is set, service_control filter reads the JWT payloads from it",
+		},
+	}
+
+	for _, tc := range testdata {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeServiceConfig := &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+						Methods: []*apipb.Method{
+							{
+								Name: "ListShelves",
+							},
+						},
+					},
+				},
+			}
+			if tc.jwtAudience != "" {
+				fakeServiceConfig.Backend = &confpb.Backend{
+					Rules: []*confpb.BackendRule{
+						{
+							Selector: fmt.Sprintf("%s.ListShelves", testApiName),
+							Address:  "https://mybackend.com",
+							Authentication: &confpb.BackendRule_JwtAudience{
+								JwtAudience: tc.jwtAudience,
+							},
+						},
+					},
+				}
+			}
+
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.BackendAddress = tc.backendAddress
+			opts.SkipBackendAuthFilter = tc.skipBackendAuthFilter
+			opts.SkipGrpcWebFilter = tc.skipGrpcWebFilter
+			opts.SkipTranscoderFilter = tc.skipTranscoderFilter
+			opts.SkipJwtAuthnFilter = tc.skipJwtAuthnFilter
+			opts.SkipServiceControlFilter = tc.skipServiceControlFilter
+			opts.LogJwtPayloads = tc.logJwtPayloads
+			if tc.telemetryBackend != "" {
+				opts.TelemetryBackend = tc.telemetryBackend
+			}
+			fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filterGenerators, err := MakeFilterGenerators(fakeServiceInfo)
+			if err != nil {
+				if tc.wantError == "" || err.Error() != tc.wantError {
+					t.Fatalf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("want error: %v, got no error", tc.wantError)
+			}
+
+			var gotFilters []string
+			for _, filterGenerator := range filterGenerators {
+				gotFilters = append(gotFilters, filterGenerator.FilterName)
+			}
+			if !reflect.DeepEqual(gotFilters, tc.wantFilters) {
+				t.Errorf("got filters: %v, want: %v", gotFilters, tc.wantFilters)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filterconfig
+
+import (
+	"fmt"
+	"sort"
+
+	ci "github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	commonpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/v10/http/common"
+	scpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/v10/http/service_control"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/ptypes"
+)
+
+const (
+	// The Google Service Control.
+	ServiceControlTelemetryBackend = "servicecontrol"
+	// A self-hosted server compatible with the Google Service Control API.
+	ServiceControlCompatibleTelemetryBackend = "servicecontrol_compatible"
+	// No check, quota and report calls are made.
+	NoopTelemetryBackend = "noop"
+
+	googleServiceControlHostname = "servicecontrol.googleapis.com"
+)
+
+// TelemetryBackend is the provider of the check, quota and report calls made
+// by the service control filter.
+type TelemetryBackend struct {
+	// Whether the service control filter and its cluster are generated.
+	RequiresServiceControlFilter bool
+
+	// Validate checks the options required by the backend, can be nil.
+	Validate func(opts options.ConfigGeneratorOptions) error
+
+	// SetAccessToken sets how the service control filter authenticates its
+	// calls to the backend.
+	SetAccessToken func(serviceInfo *ci.ServiceInfo, filterConfig *scpb.FilterConfig)
+}
+
+var telemetryBackends = map[string]*TelemetryBackend{
+	ServiceControlTelemetryBackend: {
+		RequiresServiceControlFilter: true,
+		SetAccessToken:               setGoogleAccessToken,
+	},
+	ServiceControlCompatibleTelemetryBackend: {
+		RequiresServiceControlFilter: true,
+		Validate: func(opts options.ConfigGeneratorOptions) error {
+			_, hostname, _, _, err := util.ParseURI(opts.ServiceControlURL)
+			if err != nil {
+				return fmt.Errorf("error parsing service control URL (%v): %v", opts.ServiceControlURL, err)
+			}
+			if hostname == googleServiceControlHostname {
+				return fmt.Errorf("telemetry backend %s requires the service control URL to be the self-hosted server, got %v", ServiceControlCompatibleTelemetryBackend, opts.ServiceControlURL)
+			}
+			return nil
+		},
+		SetAccessToken: func(serviceInfo *ci.ServiceInfo, filterConfig *scpb.FilterConfig) {
+			filterConfig.AccessToken = &scpb.FilterConfig_NoAccessToken{
+				NoAccessToken: &scpb.NoAccessToken{},
+			}
+		},
+	},
+	NoopTelemetryBackend: {
+		RequiresServiceControlFilter: false,
+	},
+}
+
+// GetTelemetryBackend returns the telemetry backend selected in the options.
+func GetTelemetryBackend(opts options.ConfigGeneratorOptions) (*TelemetryBackend, error) {
+	backend, ok := telemetryBackends[opts.TelemetryBackend]
+	if !ok {
+		keys := make([]string, 0, len(telemetryBackends))
+		for k := range telemetryBackends {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("unknown telemetry backend (%v), accepted values are: %+q", opts.TelemetryBackend, keys)
+	}
+
+	if backend.Validate != nil {
+		if err := backend.Validate(opts); err != nil {
+			return nil, err
+		}
+	}
+	return backend, nil
+}
+
+func setGoogleAccessToken(serviceInfo *ci.ServiceInfo, filterConfig *scpb.FilterConfig) {
+	if serviceInfo.Options.ServiceControlCredentials != nil {
+		// Use access token fetched from Google Cloud IAM Server to talk to Service Controller
+		filterConfig.AccessToken = &scpb.FilterConfig_IamToken{
+			IamToken: &commonpb.IamTokenInfo{
+				IamUri: &commonpb.HttpUri{
+					Uri:     fmt.Sprintf("%s%s", serviceInfo.Options.IamURL, util.IamAccessTokenPath(serviceInfo.Options.ServiceControlCredentials.ServiceAccountEmail)),
+					Cluster: util.IamServerClusterName,
+					Timeout: ptypes.DurationProto(serviceInfo.Options.HttpRequestTimeout),
+				},
+				ServiceAccountEmail: serviceInfo.Options.ServiceControlCredentials.ServiceAccountEmail,
+				Delegates:           serviceInfo.Options.ServiceControlCredentials.Delegates,
+				AccessToken:         serviceInfo.AccessToken,
+			},
+		}
+		return
+	}
+
+	filterConfig.AccessToken = &scpb.FilterConfig_ImdsToken{
+		ImdsToken: serviceInfo.AccessToken.GetRemoteToken(),
+	}
+}
@@ -16,12 +16,15 @@ package configgenerator
 
 import (
 	"fmt"
+	"net"
+	"net/http"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configgenerator/filterconfig"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/tracing"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 
 	sc "github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
@@ -31,7 +34,11 @@ import (
 	listenerpb "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
 	routepb "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	facpb "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/file/v3"
+	alspb "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/grpc/v3"
+	routerpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/router/v3"
 	hcmpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	tcppb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"
+	"github.com/golang/protobuf/jsonpb"
 	structpb "github.com/golang/protobuf/ptypes/struct"
 	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
 )
@@ -47,7 +54,211 @@ func MakeListeners(serviceInfo *sc.ServiceInfo) ([]*listenerpb.Listener, error)
 	if err != nil {
 		return nil, err
 	}
-	return []*listenerpb.Listener{listener}, nil
+	listeners := []*listenerpb.Listener{listener}
+	if serviceInfo.Options.SslListenerPort != 0 {
+		if listeners, err = makeDualListeners(serviceInfo, listener, filterGenerators); err != nil {
+			return nil, err
+		}
+	}
+
+	tunnelListeners, err := makeProxyTunnelListeners(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	return append(listeners, tunnelListeners...), nil
+}
+
+// makeProxyTunnelListeners makes the listeners of the tunnels through the
+// --google_api_proxy. Each listens on the unix domain
+// socket of a cluster endpoint and sends a CONNECT request of the endpoint to
+// the proxy.
+func makeProxyTunnelListeners(serviceInfo *sc.ServiceInfo) ([]*listenerpb.Listener, error) {
+	tunnels, err := makeProxyTunnels(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	var listeners []*listenerpb.Listener
+	for _, tunnel := range tunnels {
+		tcpProxy, err := ptypes.MarshalAny(&tcppb.TcpProxy{
+			StatPrefix: tunnel.name,
+			ClusterSpecifier: &tcppb.TcpProxy_Cluster{
+				Cluster: util.GoogleApiProxyClusterName,
+			},
+			TunnelingConfig: &tcppb.TcpProxy_TunnelingConfig{
+				Hostname: tunnel.authority,
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling tcp proxy config of listener %s: %v", tunnel.name, err)
+		}
+		listeners = append(listeners, &listenerpb.Listener{
+			Name: tunnel.name,
+			Address: &corepb.Address{
+				Address: &corepb.Address_Pipe{
+					Pipe: &corepb.Pipe{
+						Path: tunnel.pipe,
+					},
+				},
+			},
+			FilterChains: []*listenerpb.FilterChain{
+				{
+					Filters: []*listenerpb.Filter{
+						{
+							Name:       util.TcpProxy,
+							ConfigType: &listenerpb.Filter_TypedConfig{TypedConfig: tcpProxy},
+						},
+					},
+				},
+			},
+		})
+	}
+	return listeners, nil
+}
+
+// makeDualListeners splits the listener serving TLS into a plaintext listener
+// on the listener port and a TLS one on the ssl listener port. The plaintext
+// listener serves the same requests, or redirects them to https.
+func makeDualListeners(serviceInfo *sc.ServiceInfo, listener *listenerpb.Listener, filterGenerators []*filterconfig.FilterGenerator) ([]*listenerpb.Listener, error) {
+	opts := &serviceInfo.Options
+	if opts.SslServerCertPath == "" {
+		return nil, fmt.Errorf("flag --ssl_listener_port requires flag --ssl_server_cert_path")
+	}
+	if opts.ListenerUdsPath != "" {
+		return nil, fmt.Errorf("flag --ssl_listener_port cannot be used with flag --listener_uds_path")
+	}
+	if opts.SslListenerPort == opts.ListenerPort {
+		return nil, fmt.Errorf("flag --ssl_listener_port must be different from flag --listener_port")
+	}
+
+	sslListener := listener
+	sslListener.Name = util.IngressSslListenerName
+	sslListener.Address.GetSocketAddress().PortSpecifier = &corepb.SocketAddress_PortValue{
+		PortValue: uint32(opts.SslListenerPort),
+	}
+
+	var plaintextListener *listenerpb.Listener
+	if opts.HttpsRedirect {
+		redirectListener, err := makeHttpsRedirectListener(serviceInfo, filterGenerators)
+		if err != nil {
+			return nil, err
+		}
+		plaintextListener = redirectListener
+	} else {
+		plaintextListener = proto.Clone(sslListener).(*listenerpb.Listener)
+		for _, filterChain := range plaintextListener.FilterChains {
+			filterChain.TransportSocket = nil
+		}
+	}
+	plaintextListener.Name = util.IngressListenerName
+	plaintextListener.Address.GetSocketAddress().PortSpecifier = &corepb.SocketAddress_PortValue{
+		PortValue: uint32(opts.ListenerPort),
+	}
+	return []*listenerpb.Listener{plaintextListener, sslListener}, nil
+}
+
+// makeHttpsRedirectListener makes the listener redirecting all the requests to
+// the https scheme on the ssl listener port, except the health checks which
+// are still answered on the plaintext port.
+func makeHttpsRedirectListener(serviceInfo *sc.ServiceInfo, filterGenerators []*filterconfig.FilterGenerator) (*listenerpb.Listener, error) {
+	opts := &serviceInfo.Options
+	redirect := &routepb.RedirectAction{
+		SchemeRewriteSpecifier: &routepb.RedirectAction_HttpsRedirect{
+			HttpsRedirect: true,
+		},
+	}
+	// The port is dropped from the redirect url if it is the default one.
+	if opts.SslListenerPort != 443 {
+		redirect.PortRedirect = uint32(opts.SslListenerPort)
+	}
+	routes := []*routepb.Route{
+		{
+			Match: &routepb.RouteMatch{
+				PathSpecifier: &routepb.RouteMatch_Prefix{
+					Prefix: "/",
+				},
+			},
+			Action: &routepb.Route_Redirect{
+				Redirect: redirect,
+			},
+		},
+	}
+
+	var httpFilters []*hcmpb.HttpFilter
+	for _, filterGenerator := range filterGenerators {
+		if filterGenerator.FilterName != util.HealthCheck {
+			continue
+		}
+		hcFilter, _, err := filterGenerator.FilterGenFunc(serviceInfo)
+		if err != nil {
+			return nil, err
+		}
+		httpFilters = append(httpFilters, hcFilter)
+
+		// The health check filter answers the health checks before routing, the
+		// route only keeps them from being redirected.
+		routes = append([]*routepb.Route{
+			{
+				Match: &routepb.RouteMatch{
+					PathSpecifier: &routepb.RouteMatch_Path{
+						Path: opts.Healthz,
+					},
+				},
+				Action: &routepb.Route_DirectResponse{
+					DirectResponse: &routepb.DirectResponseAction{
+						Status: http.StatusOK,
+					},
+				},
+			},
+		}, routes...)
+	}
+
+	route := &routepb.RouteConfiguration{
+		Name: httpsRedirectRouteName,
+		VirtualHosts: []*routepb.VirtualHost{
+			{
+				Name:    virtualHostName,
+				Domains: []string{"*"},
+				Routes:  routes,
+			},
+		},
+	}
+
+	httpConMgr, err := makeHttpConMgr(opts, route)
+	if err != nil {
+		return nil, fmt.Errorf("makeHttpConnectionManager got err: %s", err)
+	}
+	router, err := ptypes.MarshalAny(&routerpb.Router{
+		SuppressEnvoyHeaders: opts.SuppressEnvoyHeaders,
+	})
+	if err != nil {
+		return nil, err
+	}
+	httpConMgr.HttpFilters = append(httpFilters, &hcmpb.HttpFilter{
+		Name:       util.Router,
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: router},
+	})
+	httpFilterConfig, err := ptypes.MarshalAny(httpConMgr)
+	if err != nil {
+		return nil, err
+	}
+
+	address, err := makeListenerAddress(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &listenerpb.Listener{
+		Address: address,
+		FilterChains: []*listenerpb.FilterChain{
+			{
+				Filters: []*listenerpb.Filter{
+					{
+						Name:       util.HTTPConnectionManager,
+						ConfigType: &listenerpb.Filter_TypedConfig{TypedConfig: httpFilterConfig},
+					},
+				},
+			},
+		},
+	}, nil
 }
 
 // AddPerRouteConfigGenToMethods adds the filterGenerator functions to all the methods in place.
@@ -66,8 +277,8 @@ func AddPerRouteConfigGenToMethods(methods []*sc.MethodInfo, filterGen *filterco
 }
 
 // GetFilterConfigAndAddPerRouteConfigGen does two things
-//   * Return all http filter configs in a list
-//   * In place add the perRouteConfigGen function to all methods defined in serviceInfo
+//   - Return all http filter configs in a list
+//   - In place add the perRouteConfigGen function to all methods defined in serviceInfo
 func GetFilterConfigAndAddPerRouteConfigGen(serviceInfo *sc.ServiceInfo, filterGenerators []*filterconfig.FilterGenerator) ([]*hcmpb.HttpFilter, error) {
 	httpFilters := []*hcmpb.HttpFilter{}
 
@@ -108,7 +319,7 @@ func MakeListener(serviceInfo *sc.ServiceInfo, filterGenerators []*filterconfig.
 		return nil, fmt.Errorf("makeHttpConnectionManager got err: %s", err)
 	}
 
-	jsonStr, _ := util.ProtoToJson(httpConMgr)
+	jsonStr, _ := util.ProtoToJson(RedactHttpConMgrBackendCredentials(httpConMgr, serviceInfo.BackendCredentialValues))
 	glog.Infof("adding Http Connection Manager config: %v", jsonStr)
 	httpConMgr.HttpFilters = httpFilters
 
@@ -127,13 +338,29 @@ func MakeListener(serviceInfo *sc.ServiceInfo, filterGenerators []*filterconfig.
 		},
 	}
 
-	if serviceInfo.Options.SslServerCertPath != "" {
+	if serviceInfo.Options.SslServerCertPath != "" && serviceInfo.Options.SslServerCertSds {
+		// The certificate is served by the config manager over ADS, so it
+		// can be rotated without restarting Envoy.
+		transportSocket, err := util.CreateDownstreamSdsTransportSocket(
+			util.ServerCertSecretName,
+			serviceInfo.Options.SslServerRootCertPath,
+			serviceInfo.Options.SslMinimumProtocol,
+			serviceInfo.Options.SslMaximumProtocol,
+			serviceInfo.Options.SslServerCipherSuites,
+			serviceInfo.Options.SslServerRequireClientCert,
+		)
+		if err != nil {
+			return nil, err
+		}
+		filterChain.TransportSocket = transportSocket
+	} else if serviceInfo.Options.SslServerCertPath != "" {
 		transportSocket, err := util.CreateDownstreamTransportSocket(
 			serviceInfo.Options.SslServerCertPath,
 			serviceInfo.Options.SslServerRootCertPath,
 			serviceInfo.Options.SslMinimumProtocol,
 			serviceInfo.Options.SslMaximumProtocol,
 			serviceInfo.Options.SslServerCipherSuites,
+			serviceInfo.Options.SslServerRequireClientCert,
 		)
 		if err != nil {
 			return nil, err
@@ -141,18 +368,13 @@ func MakeListener(serviceInfo *sc.ServiceInfo, filterGenerators []*filterconfig.
 		filterChain.TransportSocket = transportSocket
 	}
 
+	address, err := makeListenerAddress(&serviceInfo.Options)
+	if err != nil {
+		return nil, err
+	}
 	listener := &listenerpb.Listener{
-		Name: util.IngressListenerName,
-		Address: &corepb.Address{
-			Address: &corepb.Address_SocketAddress{
-				SocketAddress: &corepb.SocketAddress{
-					Address: serviceInfo.Options.ListenerAddress,
-					PortSpecifier: &corepb.SocketAddress_PortValue{
-						PortValue: uint32(serviceInfo.Options.ListenerPort),
-					},
-				},
-			},
-		},
+		Name:         util.IngressListenerName,
+		Address:      address,
 		FilterChains: []*listenerpb.FilterChain{filterChain},
 	}
 
@@ -165,6 +387,97 @@ func MakeListener(serviceInfo *sc.ServiceInfo, filterGenerators []*filterconfig.
 	return listener, nil
 }
 
+// makeListenerAddress returns the address to accept downstream connections
+// on, the unix domain socket takes precedence over the tcp port.
+func makeListenerAddress(opts *options.ConfigGeneratorOptions) (*corepb.Address, error) {
+	if opts.ListenerUdsPath != "" {
+		return &corepb.Address{
+			Address: &corepb.Address_Pipe{
+				Pipe: &corepb.Pipe{
+					Path: opts.ListenerUdsPath,
+				},
+			},
+		}, nil
+	}
+
+	ip := net.ParseIP(opts.ListenerAddress)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid listener address %q, should be an ipv4 or ipv6 address", opts.ListenerAddress)
+	}
+	return &corepb.Address{
+		Address: &corepb.Address_SocketAddress{
+			SocketAddress: &corepb.SocketAddress{
+				Address: opts.ListenerAddress,
+				PortSpecifier: &corepb.SocketAddress_PortValue{
+					PortValue: uint32(opts.ListenerPort),
+				},
+				// Listening on all the ipv6 addresses also accepts the ipv4
+				// connections.
+				Ipv4Compat: ip.Equal(net.IPv6unspecified),
+			},
+		},
+	}, nil
+}
+
+// The access log fields written in the JSON mode if no format is specified.
+// Besides the Envoy default fields, it includes the operation, whether an API
+// key is presented and the JWT issuer.
+var defaultJsonAccessLogFormat = map[string]string{
+	"start_time":            "%START_TIME%",
+	"method":                "%REQ(:METHOD)%",
+	"path":                  "%REQ(X-ENVOY-ORIGINAL-PATH?:PATH)%",
+	"protocol":              "%PROTOCOL%",
+	"response_code":         "%RESPONSE_CODE%",
+	"response_flags":        "%RESPONSE_FLAGS%",
+	"response_code_details": "%RESPONSE_CODE_DETAILS%",
+	"bytes_received":        "%BYTES_RECEIVED%",
+	"bytes_sent":            "%BYTES_SENT%",
+	"duration":              "%DURATION%",
+	"upstream_service_time": "%RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)%",
+	"x_forwarded_for":       "%REQ(X-FORWARDED-FOR)%",
+	"user_agent":            "%REQ(USER-AGENT)%",
+	"request_id":            "%REQ(X-REQUEST-ID)%",
+	"authority":             "%REQ(:AUTHORITY)%",
+	"upstream_host":         "%UPSTREAM_HOST%",
+	"operation":             "%ROUTE_NAME%",
+	"api_key_present":       fmt.Sprintf("%%FILTER_STATE(%s:PLAIN)%%", util.FilterStateApiKeyPresent),
+	"jwt_issuer":            fmt.Sprintf("%%DYNAMIC_METADATA(%s:%s:iss)%%", util.JwtAuthn, util.JwtPayloadMetadataName),
+}
+
+// makeAccessLogFormat returns the format of the file access log, or nil to use
+// the Envoy default text format.
+func makeAccessLogFormat(opts *options.ConfigGeneratorOptions) (*corepb.SubstitutionFormatString, error) {
+	if !opts.AccessLogJson {
+		if opts.AccessLogFormat == "" {
+			return nil, nil
+		}
+		return &corepb.SubstitutionFormatString{
+			Format: &corepb.SubstitutionFormatString_TextFormat{
+				TextFormat: opts.AccessLogFormat,
+			},
+		}, nil
+	}
+
+	jsonFormat := &structpb.Struct{
+		Fields: make(map[string]*structpb.Value),
+	}
+	if opts.AccessLogFormat == "" {
+		for field, format := range defaultJsonAccessLogFormat {
+			jsonFormat.Fields[field] = &structpb.Value{
+				Kind: &structpb.Value_StringValue{StringValue: format},
+			}
+		}
+	} else if err := jsonpb.UnmarshalString(opts.AccessLogFormat, jsonFormat); err != nil {
+		return nil, fmt.Errorf("invalid access_log_format %q, should be a JSON object when access_log_json is enabled: %v", opts.AccessLogFormat, err)
+	}
+
+	return &corepb.SubstitutionFormatString{
+		Format: &corepb.SubstitutionFormatString_JsonFormat{
+			JsonFormat: jsonFormat,
+		},
+	}, nil
+}
+
 func makeHttpConMgr(opts *options.ConfigGeneratorOptions, route *routepb.RouteConfiguration) (*hcmpb.HttpConnectionManager, error) {
 	httpConMgr := &hcmpb.HttpConnectionManager{
 		UpgradeConfigs: []*hcmpb.HttpConnectionManager_UpgradeConfig{
@@ -219,27 +532,57 @@ func makeHttpConMgr(opts *options.ConfigGeneratorOptions, route *routepb.RouteCo
 			Path: opts.AccessLog,
 		}
 
-		if opts.AccessLogFormat != "" {
+		logFormat, err := makeAccessLogFormat(opts)
+		if err != nil {
+			return nil, err
+		}
+		if logFormat != nil {
 			fileAccessLog.AccessLogFormat = &facpb.FileAccessLog_LogFormat{
-				LogFormat: &corepb.SubstitutionFormatString{
-					Format: &corepb.SubstitutionFormatString_TextFormat{
-						TextFormat: opts.AccessLogFormat,
-					},
-				},
+				LogFormat: logFormat,
 			}
 		}
 
 		serialized, _ := ptypes.MarshalAny(fileAccessLog)
 
-		httpConMgr.AccessLog = []*acpb.AccessLog{
-			{
-				Name:   util.AccessFileLogger,
-				Filter: nil,
-				ConfigType: &acpb.AccessLog_TypedConfig{
-					TypedConfig: serialized,
+		httpConMgr.AccessLog = append(httpConMgr.AccessLog, &acpb.AccessLog{
+			Name:   util.AccessFileLogger,
+			Filter: nil,
+			ConfigType: &acpb.AccessLog_TypedConfig{
+				TypedConfig: serialized,
+			},
+		})
+	}
+
+	if opts.AccessLogGrpcUrl != "" {
+		grpcAccessLog := &alspb.HttpGrpcAccessLogConfig{
+			CommonConfig: &alspb.CommonGrpcAccessLogConfig{
+				LogName: opts.AccessLogGrpcLogName,
+				GrpcService: &corepb.GrpcService{
+					TargetSpecifier: &corepb.GrpcService_EnvoyGrpc_{
+						EnvoyGrpc: &corepb.GrpcService_EnvoyGrpc{
+							ClusterName: util.AccessLogServiceClusterName,
+						},
+					},
+				},
+				TransportApiVersion: corepb.ApiVersion_V3,
+				FilterStateObjectsToLog: []string{
+					util.FilterStateApiMethod,
+					util.FilterStateApiKeyPresent,
 				},
 			},
 		}
+
+		serialized, err := ptypes.MarshalAny(grpcAccessLog)
+		if err != nil {
+			return nil, err
+		}
+
+		httpConMgr.AccessLog = append(httpConMgr.AccessLog, &acpb.AccessLog{
+			Name: util.AccessHttpGrpcLogger,
+			ConfigType: &acpb.AccessLog_TypedConfig{
+				TypedConfig: serialized,
+			},
+		})
 	}
 
 	if !opts.DisableTracing {
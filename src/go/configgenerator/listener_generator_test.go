@@ -13,14 +13,18 @@
 package configgenerator
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
 
 	routepb "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	hcmpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
 	apipb "google.golang.org/genproto/protobuf/api"
 )
@@ -29,6 +33,7 @@ func TestMakeListeners(t *testing.T) {
 	testdata := []struct {
 		desc              string
 		sslServerCertPath string
+		sslServerCertSds  bool
 		fakeServiceConfig *confpb.Service
 		wantListeners     []string
 	}{
@@ -155,6 +160,132 @@ func TestMakeListeners(t *testing.T) {
   "name": "ingress_listener",
   "perConnectionBufferLimitBytes": 1024
 }
+`,
+			},
+		},
+		{
+			desc:              "Success, deliver the server certificate via SDS",
+			sslServerCertPath: "/etc/endpoints/ssl",
+			sslServerCertSds:  true,
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: "endpoints.examples.bookstore.Bookstore",
+						Methods: []*apipb.Method{
+							{
+								Name: "CreateShelf",
+							},
+						},
+					},
+				},
+			},
+			wantListeners: []string{`
+{
+  "address": {
+    "socketAddress": {
+      "address": "0.0.0.0",
+      "portValue": 8080
+    }
+  },
+  "filterChains": [
+    {
+      "filters": [
+        {
+          "name": "envoy.filters.network.http_connection_manager",
+          "typedConfig": {
+            "@type": "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager",
+            "commonHttpProtocolOptions": {},
+            "httpFilters": [
+              {
+                "name": "com.google.espv2.filters.http.grpc_metadata_scrubber"
+              },
+              {
+                "name": "envoy.filters.http.router",
+                "typedConfig": {
+                  "@type": "type.googleapis.com/envoy.extensions.filters.http.router.v3.Router",
+                  "suppressEnvoyHeaders": true
+                }
+              }
+            ],
+            "httpProtocolOptions": {
+              "enableTrailers": true
+            },
+            "localReplyConfig": {
+              "bodyFormat": {
+                "jsonFormat": {
+                  "code": "%RESPONSE_CODE%",
+                  "message": "%LOCAL_REPLY_BODY%"
+                }
+              }
+            },
+            "mergeSlashes": true,
+            "normalizePath": true,
+            "pathWithEscapedSlashesAction": "KEEP_UNCHANGED",
+            "routeConfig": {
+              "name": "local_route",
+              "virtualHosts": [
+                {
+                  "domains": [
+                    "*"
+                  ],
+                  "name": "backend",
+                  "routes": [
+                    {
+                      "decorator": {
+                        "operation": "ingress UnknownOperationName"
+                      },
+                      "directResponse": {
+                        "body": {
+                          "inlineString": "The current request is not defined by this API."
+                        },
+                        "status": 404
+                      },
+                      "match": {
+                        "prefix": "/"
+                      }
+                    }
+                  ]
+                }
+              ]
+            },
+            "statPrefix": "ingress_http",
+            "upgradeConfigs": [
+              {
+                "upgradeType": "websocket"
+              }
+            ],
+            "useRemoteAddress": false,
+            "xffNumTrustedHops": 2
+          }
+        }
+      ],
+      "transportSocket": {
+        "name": "envoy.transport_sockets.tls",
+        "typedConfig": {
+          "@type": "type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.DownstreamTlsContext",
+          "commonTlsContext": {
+            "alpnProtocols": [
+              "h2",
+              "http/1.1"
+            ],
+            "tlsCertificateSdsSecretConfigs": [
+              {
+                "name": "server_cert",
+                "sdsConfig": {
+                  "ads": {},
+                  "resourceApiVersion": "V3"
+                }
+              }
+            ]
+          }
+        }
+      }
+    }
+  ],
+  "name": "ingress_listener",
+  "perConnectionBufferLimitBytes": 1024
+}
 `,
 			},
 		},
@@ -163,6 +294,7 @@ func TestMakeListeners(t *testing.T) {
 	for i, tc := range testdata {
 		opts := options.DefaultConfigGeneratorOptions()
 		opts.SslServerCertPath = tc.sslServerCertPath
+		opts.SslServerCertSds = tc.sslServerCertSds
 		opts.UnderscoresInHeaders = true
 		opts.DisableTracing = true
 		opts.ConnectionBufferLimitBytes = 1024
@@ -194,6 +326,255 @@ func TestMakeListeners(t *testing.T) {
 	}
 }
 
+func TestMakeDualListeners(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "Echo",
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc              string
+		sslServerCertPath string
+		sslListenerPort   int
+		httpsRedirect     bool
+		healthz           string
+		wantPorts         []uint32
+		wantRedirect      *routepb.RedirectAction
+		wantHealthz       string
+		wantError         string
+	}{
+		{
+			desc:              "plaintext and tls listeners serve the same requests",
+			sslServerCertPath: "/etc/endpoint/ssl",
+			sslListenerPort:   8443,
+			wantPorts:         []uint32{8080, 8443},
+		},
+		{
+			desc:              "plaintext listener redirects to https",
+			sslServerCertPath: "/etc/endpoint/ssl",
+			sslListenerPort:   8443,
+			httpsRedirect:     true,
+			wantPorts:         []uint32{8080, 8443},
+			wantRedirect: &routepb.RedirectAction{
+				SchemeRewriteSpecifier: &routepb.RedirectAction_HttpsRedirect{
+					HttpsRedirect: true,
+				},
+				PortRedirect: 8443,
+			},
+		},
+		{
+			desc:              "health checks are not redirected",
+			sslServerCertPath: "/etc/endpoint/ssl",
+			sslListenerPort:   8443,
+			httpsRedirect:     true,
+			healthz:           "healthz",
+			wantPorts:         []uint32{8080, 8443},
+			wantRedirect: &routepb.RedirectAction{
+				SchemeRewriteSpecifier: &routepb.RedirectAction_HttpsRedirect{
+					HttpsRedirect: true,
+				},
+				PortRedirect: 8443,
+			},
+			wantHealthz: "/healthz",
+		},
+		{
+			desc:              "default https port is not in the redirect url",
+			sslServerCertPath: "/etc/endpoint/ssl",
+			sslListenerPort:   443,
+			httpsRedirect:     true,
+			wantPorts:         []uint32{8080, 443},
+			wantRedirect: &routepb.RedirectAction{
+				SchemeRewriteSpecifier: &routepb.RedirectAction_HttpsRedirect{
+					HttpsRedirect: true,
+				},
+			},
+		},
+		{
+			desc:            "no server certificate",
+			sslListenerPort: 8443,
+			wantError:       "flag --ssl_listener_port requires flag --ssl_server_cert_path",
+		},
+		{
+			desc:              "same port as the listener port",
+			sslServerCertPath: "/etc/endpoint/ssl",
+			sslListenerPort:   8080,
+			wantError:         "flag --ssl_listener_port must be different from flag --listener_port",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.SslServerCertPath = tc.sslServerCertPath
+			opts.SslListenerPort = tc.sslListenerPort
+			opts.HttpsRedirect = tc.httpsRedirect
+			opts.Healthz = tc.healthz
+			opts.DisableTracing = true
+			fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			listeners, err := MakeListeners(fakeServiceInfo)
+			if tc.wantError != "" {
+				if err == nil || err.Error() != tc.wantError {
+					t.Fatalf("MakeListeners got error %v, want %q", err, tc.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantNames := []string{util.IngressListenerName, util.IngressSslListenerName}
+			if len(listeners) != len(wantNames) {
+				t.Fatalf("got %d listeners, want %d", len(listeners), len(wantNames))
+			}
+			for i, listener := range listeners {
+				if listener.GetName() != wantNames[i] {
+					t.Errorf("listener %d: got name %q, want %q", i, listener.GetName(), wantNames[i])
+				}
+				if got := listener.GetAddress().GetSocketAddress().GetPortValue(); got != tc.wantPorts[i] {
+					t.Errorf("listener %s: got port %d, want %d", listener.GetName(), got, tc.wantPorts[i])
+				}
+				gotTls := listener.GetFilterChains()[0].GetTransportSocket() != nil
+				if wantTls := listener.GetName() == util.IngressSslListenerName; gotTls != wantTls {
+					t.Errorf("listener %s: got tls %v, want %v", listener.GetName(), gotTls, wantTls)
+				}
+			}
+
+			httpConMgr := &hcmpb.HttpConnectionManager{}
+			if err := ptypes.UnmarshalAny(listeners[0].GetFilterChains()[0].GetFilters()[0].GetTypedConfig(), httpConMgr); err != nil {
+				t.Fatal(err)
+			}
+			routes := httpConMgr.GetRouteConfig().GetVirtualHosts()[0].GetRoutes()
+			gotRedirect := routes[len(routes)-1].GetRedirect()
+			if !proto.Equal(gotRedirect, tc.wantRedirect) {
+				t.Errorf("got plaintext redirect %v, want %v", gotRedirect, tc.wantRedirect)
+			}
+			if tc.wantRedirect == nil {
+				return
+			}
+
+			var gotHealthz string
+			if len(routes) > 1 {
+				gotHealthz = routes[0].GetMatch().GetPath()
+			}
+			if gotHealthz != tc.wantHealthz {
+				t.Errorf("got plaintext healthz route %q, want %q", gotHealthz, tc.wantHealthz)
+			}
+			gotHealthCheck := httpConMgr.GetHttpFilters()[0].GetName() == util.HealthCheck
+			if wantHealthCheck := tc.wantHealthz != ""; gotHealthCheck != wantHealthCheck {
+				t.Errorf("got plaintext health check filter %v, want %v", gotHealthCheck, wantHealthCheck)
+			}
+		})
+	}
+}
+
+func TestMakeListenerAddress(t *testing.T) {
+	testData := []struct {
+		desc            string
+		listenerAddress string
+		listenerUdsPath string
+		wantAddress     string
+		wantError       string
+	}{
+		{
+			desc: "tcp port by default",
+			wantAddress: `{
+  "socketAddress": {
+    "address": "0.0.0.0",
+    "portValue": 8080
+  }
+}`,
+		},
+		{
+			desc:            "loopback only",
+			listenerAddress: "127.0.0.1",
+			wantAddress: `{
+  "socketAddress": {
+    "address": "127.0.0.1",
+    "portValue": 8080
+  }
+}`,
+		},
+		{
+			desc:            "all the ipv6 addresses also accept ipv4",
+			listenerAddress: "::",
+			wantAddress: `{
+  "socketAddress": {
+    "address": "::",
+    "portValue": 8080,
+    "ipv4Compat": true
+  }
+}`,
+		},
+		{
+			desc:            "ipv6 loopback only",
+			listenerAddress: "::1",
+			wantAddress: `{
+  "socketAddress": {
+    "address": "::1",
+    "portValue": 8080
+  }
+}`,
+		},
+		{
+			desc:            "invalid address",
+			listenerAddress: "localhost",
+			wantError:       `invalid listener address "localhost", should be an ipv4 or ipv6 address`,
+		},
+		{
+			desc:            "unix domain socket",
+			listenerUdsPath: "/var/run/espv2/listener.sock",
+			wantAddress: `{
+  "pipe": {
+    "path": "/var/run/espv2/listener.sock"
+  }
+}`,
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			if tc.listenerAddress != "" {
+				opts.ListenerAddress = tc.listenerAddress
+			}
+			opts.ListenerUdsPath = tc.listenerUdsPath
+
+			address, err := makeListenerAddress(&opts)
+			if tc.wantError != "" {
+				if err == nil || err.Error() != tc.wantError {
+					t.Fatalf("makeListenerAddress got error %v, want %q", err, tc.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			marshaler := &jsonpb.Marshaler{}
+			gotAddress, err := marshaler.MarshalToString(address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := util.JsonEqual(tc.wantAddress, gotAddress); err != nil {
+				t.Errorf("makeListenerAddress failed, \n %v", err)
+			}
+		})
+	}
+}
+
 func TestMakeHttpConMgr(t *testing.T) {
 	testdata := []struct {
 		desc            string
@@ -277,6 +658,180 @@ func TestMakeHttpConMgr(t *testing.T) {
 				}
 				`,
 		},
+		{
+			desc: "Generate HttpConMgr when accessLog is in JSON with the default format",
+			opts: options.ConfigGeneratorOptions{
+				AccessLog:     "/foo",
+				AccessLogJson: true,
+				CommonOptions: options.CommonOptions{
+					DisableTracing: true,
+				},
+			},
+			wantHttpConnMgr: `
+				{
+					"accessLog": [
+						{
+							"name": "envoy.access_loggers.file",
+							"typedConfig": {
+								"@type": "type.googleapis.com/envoy.extensions.access_loggers.file.v3.FileAccessLog",
+								"path": "/foo",
+								"logFormat": {
+									"jsonFormat": {
+										"api_key_present": "%FILTER_STATE(com.google.espv2.filters.http.service_control.api_key_present:PLAIN)%",
+										"authority": "%REQ(:AUTHORITY)%",
+										"bytes_received": "%BYTES_RECEIVED%",
+										"bytes_sent": "%BYTES_SENT%",
+										"duration": "%DURATION%",
+										"jwt_issuer": "%DYNAMIC_METADATA(envoy.filters.http.jwt_authn:jwt_payloads:iss)%",
+										"method": "%REQ(:METHOD)%",
+										"operation": "%ROUTE_NAME%",
+										"path": "%REQ(X-ENVOY-ORIGINAL-PATH?:PATH)%",
+										"protocol": "%PROTOCOL%",
+										"request_id": "%REQ(X-REQUEST-ID)%",
+										"response_code": "%RESPONSE_CODE%",
+										"response_code_details": "%RESPONSE_CODE_DETAILS%",
+										"response_flags": "%RESPONSE_FLAGS%",
+										"start_time": "%START_TIME%",
+										"upstream_host": "%UPSTREAM_HOST%",
+										"upstream_service_time": "%RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)%",
+										"user_agent": "%REQ(USER-AGENT)%",
+										"x_forwarded_for": "%REQ(X-FORWARDED-FOR)%"
+									}
+								}
+							}
+						}
+					],
+					"commonHttpProtocolOptions": {
+						"headersWithUnderscoresAction": "REJECT_REQUEST"
+					},
+					"localReplyConfig": {
+						"bodyFormat": {
+							"jsonFormat": {
+								"code": "%RESPONSE_CODE%",
+								"message": "%LOCAL_REPLY_BODY%"
+							}
+						}
+					},
+					"normalizePath": false,
+					"pathWithEscapedSlashesAction": "KEEP_UNCHANGED",
+					"routeConfig": {},
+					"statPrefix": "ingress_http",
+					"upgradeConfigs": [
+						{
+							"upgradeType": "websocket"
+						}
+					],
+					"useRemoteAddress": false
+				}
+				`,
+		},
+		{
+			desc: "Generate HttpConMgr when accessLog is in JSON with a custom format",
+			opts: options.ConfigGeneratorOptions{
+				AccessLog:       "/foo",
+				AccessLogFormat: `{"operation": "%ROUTE_NAME%", "code": "%RESPONSE_CODE%"}`,
+				AccessLogJson:   true,
+				CommonOptions: options.CommonOptions{
+					DisableTracing: true,
+				},
+			},
+			wantHttpConnMgr: `
+				{
+					"accessLog": [
+						{
+							"name": "envoy.access_loggers.file",
+							"typedConfig": {
+								"@type": "type.googleapis.com/envoy.extensions.access_loggers.file.v3.FileAccessLog",
+								"path": "/foo",
+								"logFormat": {
+									"jsonFormat": {
+										"code": "%RESPONSE_CODE%",
+										"operation": "%ROUTE_NAME%"
+									}
+								}
+							}
+						}
+					],
+					"commonHttpProtocolOptions": {
+						"headersWithUnderscoresAction": "REJECT_REQUEST"
+					},
+					"localReplyConfig": {
+						"bodyFormat": {
+							"jsonFormat": {
+								"code": "%RESPONSE_CODE%",
+								"message": "%LOCAL_REPLY_BODY%"
+							}
+						}
+					},
+					"normalizePath": false,
+					"pathWithEscapedSlashesAction": "KEEP_UNCHANGED",
+					"routeConfig": {},
+					"statPrefix": "ingress_http",
+					"upgradeConfigs": [
+						{
+							"upgradeType": "websocket"
+						}
+					],
+					"useRemoteAddress": false
+				}
+				`,
+		},
+		{
+			desc: "Generate HttpConMgr when gRPC access log service is defined",
+			opts: options.ConfigGeneratorOptions{
+				AccessLogGrpcUrl:     "grpc://als:9001",
+				AccessLogGrpcLogName: "espv2",
+				CommonOptions: options.CommonOptions{
+					DisableTracing: true,
+				},
+			},
+			wantHttpConnMgr: `
+				{
+					"accessLog": [
+						{
+							"name": "envoy.access_loggers.http_grpc",
+							"typedConfig": {
+								"@type": "type.googleapis.com/envoy.extensions.access_loggers.grpc.v3.HttpGrpcAccessLogConfig",
+								"commonConfig": {
+									"filterStateObjectsToLog": [
+										"com.google.espv2.filters.http.service_control.api_method",
+										"com.google.espv2.filters.http.service_control.api_key_present"
+									],
+									"grpcService": {
+										"envoyGrpc": {
+											"clusterName": "access-log-service-cluster"
+										}
+									},
+									"logName": "espv2",
+									"transportApiVersion": "V3"
+								}
+							}
+						}
+					],
+					"commonHttpProtocolOptions": {
+						"headersWithUnderscoresAction": "REJECT_REQUEST"
+					},
+					"localReplyConfig": {
+						"bodyFormat": {
+							"jsonFormat": {
+								"code": "%RESPONSE_CODE%",
+								"message": "%LOCAL_REPLY_BODY%"
+							}
+						}
+					},
+					"normalizePath": false,
+					"pathWithEscapedSlashesAction": "KEEP_UNCHANGED",
+					"routeConfig": {},
+					"statPrefix": "ingress_http",
+					"upgradeConfigs": [
+						{
+							"upgradeType": "websocket"
+						}
+					],
+					"useRemoteAddress": false
+				}
+				`,
+		},
 		{
 			desc: "Generate HttpConMgr when tracing is enabled",
 			opts: options.ConfigGeneratorOptions{
@@ -413,3 +968,20 @@ func TestMakeHttpConMgr(t *testing.T) {
 		}
 	}
 }
+
+func TestMakeHttpConMgrInvalidAccessLogFormat(t *testing.T) {
+	opts := options.ConfigGeneratorOptions{
+		AccessLog:       "/foo",
+		AccessLogFormat: "%START_TIME%",
+		AccessLogJson:   true,
+		CommonOptions: options.CommonOptions{
+			DisableTracing: true,
+		},
+	}
+
+	_, err := makeHttpConMgr(&opts, &routepb.RouteConfiguration{})
+	wantError := `invalid access_log_format "%START_TIME%", should be a JSON object when access_log_json is enabled`
+	if err == nil || !strings.Contains(err.Error(), wantError) {
+		t.Errorf("got error: %v, want error: %s", err, wantError)
+	}
+}
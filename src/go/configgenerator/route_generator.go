@@ -16,33 +16,50 @@ package configgenerator
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configgenerator/filterconfig"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/httppattern"
 	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	routepb "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	hcmpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+	typepb "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	"github.com/golang/glog"
 	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 	anypb "github.com/golang/protobuf/ptypes/any"
+	structpb "github.com/golang/protobuf/ptypes/struct"
 	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
 )
 
 const (
-	routeName       = "local_route"
-	virtualHostName = "backend"
+	routeName              = "local_route"
+	httpsRedirectRouteName = "https_redirect_route"
+	virtualHostName        = "backend"
+
+	// RedactedBackendCredential replaces the values of the backend credentials
+	// in the route configs that are logged or dumped.
+	RedactedBackendCredential = "REDACTED"
 )
 
+// The virtual host names are in the stat names, and only have the characters
+// matched by util.OperationStatsTagRegex.
+var invalidVirtualHostNameCharRegex = regexp.MustCompile(`[^\w-]`)
+
 func makeRouteConfig(serviceInfo *configinfo.ServiceInfo) (*routepb.RouteConfiguration, error) {
 	var virtualHosts []*routepb.VirtualHost
 	host := routepb.VirtualHost{
 		Name:    virtualHostName,
-		Domains: []string{"*"},
+		Domains: makeDomains(serviceInfo.Options.Domains),
 	}
 
 	// The router will use the first matched route, so the order of routes is important.
@@ -60,6 +77,24 @@ func makeRouteConfig(serviceInfo *configinfo.ServiceInfo) (*routepb.RouteConfigu
 	}
 	host.Routes = backendRoutes
 
+	if serviceInfo.Options.ApiMetadataPath != "" {
+		apiMetadataRoute, err := makeApiMetadataRoute(serviceInfo)
+		if err != nil {
+			return nil, err
+		}
+		// Not shadowed by the wildcard backend routes.
+		host.Routes = append([]*routepb.Route{apiMetadataRoute}, host.Routes...)
+	}
+
+	if serviceInfo.Options.EnableGrpcReflection {
+		// Not passed through to the backend.
+		host.Routes = append([]*routepb.Route{makeGrpcReflectionRoute()}, host.Routes...)
+	}
+
+	if serviceInfo.Options.EnableOperationStats {
+		host.VirtualClusters = makeOperationVirtualClusters(backendRoutes)
+	}
+
 	cors, corsRoutes, err := makeRouteCors(serviceInfo)
 	if err != nil {
 		return nil, err
@@ -78,6 +113,11 @@ func makeRouteConfig(serviceInfo *configinfo.ServiceInfo) (*routepb.RouteConfigu
 
 	host.Routes = append(host.Routes, makeCatchAllNotFoundRoute())
 
+	hostVirtualHosts, err := makeHostVirtualHosts(serviceInfo, &host)
+	if err != nil {
+		return nil, err
+	}
+	virtualHosts = append(virtualHosts, hostVirtualHosts...)
 	virtualHosts = append(virtualHosts, &host)
 
 	requestHeaders, err := makeRequestHeadersToAdd(serviceInfo)
@@ -96,6 +136,106 @@ func makeRouteConfig(serviceInfo *configinfo.ServiceInfo) (*routepb.RouteConfigu
 	}, nil
 }
 
+// makeDomains returns the domains of the default virtual host, all the domains
+// if not specified.
+func makeDomains(domains string) []string {
+	var l []string
+	seen := make(map[string]bool)
+	for _, domain := range strings.Split(domains, ",") {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain == "" || seen[domain] {
+			continue
+		}
+		seen[domain] = true
+		l = append(l, domainWithPorts(domain)...)
+	}
+	if len(l) == 0 {
+		return []string{"*"}
+	}
+	return l
+}
+
+// domainWithPorts also matches the requests with a port in the host header,
+// except for the wildcard domains, as Envoy only supports a wildcard either at
+// the start or at the end of a domain.
+func domainWithPorts(domain string) []string {
+	if strings.HasPrefix(domain, "*") {
+		return []string{domain}
+	}
+	return []string{domain, domain + ":*"}
+}
+
+// makeHostVirtualHosts makes a virtual host for each hostname with the
+// overridden auth requirements or its own backend. It is a copy of the default
+// virtual host, with the jwt_authn per-route configs of the overridden
+// operations replaced, the RBAC per-route configs of the JWT claim
+// requirements removed where no JWT of the caller is required, and the local
+// backend cluster replaced by the host one.
+func makeHostVirtualHosts(serviceInfo *configinfo.ServiceInfo, defaultHost *routepb.VirtualHost) ([]*routepb.VirtualHost, error) {
+	var hosts []string
+	for host := range serviceInfo.HostAuthRequirements {
+		hosts = append(hosts, host)
+	}
+	for host := range serviceInfo.HostBackendClusters {
+		if _, ok := serviceInfo.HostAuthRequirements[host]; !ok {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+
+	// Envoy rejects the route config with a domain in multiple virtual hosts.
+	defaultDomains := make(map[string]bool)
+	for _, domain := range defaultHost.GetDomains() {
+		defaultDomains[domain] = true
+	}
+
+	var virtualHosts []*routepb.VirtualHost
+	for _, host := range hosts {
+		if defaultDomains[host] {
+			return nil, fmt.Errorf("domain %s has its own virtual host for --host_backends or x-google-host-security, it cannot also be in --domains", host)
+		}
+		vh := proto.Clone(defaultHost).(*routepb.VirtualHost)
+		vh.Name = fmt.Sprintf("%s_%s", virtualHostName, invalidVirtualHostNameCharRegex.ReplaceAllString(host, "_"))
+		vh.Domains = domainWithPorts(host)
+
+		if backendCluster, ok := serviceInfo.HostBackendClusters[host]; ok {
+			for _, r := range vh.Routes {
+				if r.GetRoute().GetCluster() == serviceInfo.LocalBackendClusterName() {
+					r.GetRoute().ClusterSpecifier = &routepb.RouteAction_Cluster{
+						Cluster: backendCluster.ClusterName,
+					}
+				}
+			}
+		}
+
+		for _, r := range vh.Routes {
+			requirements, ok := serviceInfo.HostAuthRequirements[host][r.GetName()]
+			if !ok || r.GetRoute() == nil {
+				continue
+			}
+
+			delete(r.TypedPerFilterConfig, util.JwtAuthn)
+			if len(requirements) == 0 {
+				// The JWT claim requirements are of the JWT of the caller.
+				delete(r.TypedPerFilterConfig, util.RBAC)
+				if len(serviceInfo.AdditionalAuthRules[r.GetName()]) == 0 {
+					continue
+				}
+			}
+			jwtPerRoute, err := filterconfig.MakeJwtPerRouteConfig(util.HostJwtRequirementName(r.GetName(), host))
+			if err != nil {
+				return nil, err
+			}
+			if r.TypedPerFilterConfig == nil {
+				r.TypedPerFilterConfig = make(map[string]*anypb.Any)
+			}
+			r.TypedPerFilterConfig[util.JwtAuthn] = jwtPerRoute
+		}
+		virtualHosts = append(virtualHosts, vh)
+	}
+	return virtualHosts, nil
+}
+
 func makeHeaders(headers string, a bool) ([]*corepb.HeaderValueOption, error) {
 	var l []*corepb.HeaderValueOption
 	for _, h := range strings.Split(headers, ";") {
@@ -152,6 +292,46 @@ func makeResponseHeadersToAdd(serviceInfo *configinfo.ServiceInfo) ([]*corepb.He
 	return l, nil
 }
 
+// The gRPC status trailers always exposed to the gRPC-Web clients along with
+// --grpc_web_expose_trailers.
+var grpcWebStatusTrailers = []string{"grpc-status", "grpc-message"}
+
+var grpcMetadataKeyRegexp = regexp.MustCompile(`^[0-9a-z_.-]+$`)
+
+// makeCorsExposeHeaders appends the trailers of --grpc_web_expose_trailers to
+// --cors_expose_headers, so the browsers let the gRPC-Web clients read them.
+func makeCorsExposeHeaders(serviceInfo *configinfo.ServiceInfo) (string, error) {
+	exposeHeaders := serviceInfo.Options.CorsExposeHeaders
+	if serviceInfo.Options.GrpcWebExposeTrailers == "" || !serviceInfo.GrpcSupportRequired || serviceInfo.Options.SkipGrpcWebFilter {
+		return exposeHeaders, nil
+	}
+
+	exposed := make(map[string]bool)
+	var headers []string
+	if exposeHeaders != "" {
+		for _, header := range strings.Split(exposeHeaders, ",") {
+			exposed[strings.ToLower(strings.TrimSpace(header))] = true
+		}
+		headers = append(headers, exposeHeaders)
+	}
+
+	trailers := append([]string{}, grpcWebStatusTrailers...)
+	for _, trailer := range strings.Split(serviceInfo.Options.GrpcWebExposeTrailers, ",") {
+		trailer = strings.ToLower(strings.TrimSpace(trailer))
+		if !grpcMetadataKeyRegexp.MatchString(trailer) || strings.HasPrefix(trailer, "grpc-") {
+			return "", fmt.Errorf("invalid grpc_web_expose_trailers: %q is not a valid custom gRPC metadata key", trailer)
+		}
+		trailers = append(trailers, trailer)
+	}
+	for _, trailer := range trailers {
+		if !exposed[trailer] {
+			exposed[trailer] = true
+			headers = append(headers, trailer)
+		}
+	}
+	return strings.Join(headers, ","), nil
+}
+
 func makeRouteCors(serviceInfo *configinfo.ServiceInfo) (*routepb.CorsPolicy, []*routepb.Route, error) {
 	var cors *routepb.CorsPolicy
 	originMatcher := &routepb.HeaderMatcher{
@@ -222,7 +402,11 @@ func makeRouteCors(serviceInfo *configinfo.ServiceInfo) (*routepb.CorsPolicy, []
 	cors.MaxAge = strconv.Itoa(int(serviceInfo.Options.CorsMaxAge.Seconds()))
 	cors.AllowMethods = serviceInfo.Options.CorsAllowMethods
 	cors.AllowHeaders = serviceInfo.Options.CorsAllowHeaders
-	cors.ExposeHeaders = serviceInfo.Options.CorsExposeHeaders
+	exposeHeaders, err := makeCorsExposeHeaders(serviceInfo)
+	if err != nil {
+		return nil, nil, err
+	}
+	cors.ExposeHeaders = exposeHeaders
 	cors.AllowCredentials = &wrapperspb.BoolValue{Value: serviceInfo.Options.CorsAllowCredentials}
 
 	// In order apply Envoy cors policy, need to have a catch-all route to match
@@ -357,6 +541,13 @@ func MakeRouteTable(serviceInfo *configinfo.ServiceInfo) ([]*routepb.Route, []*r
 		}
 
 		for _, routeMatcher := range routeMatchers {
+			if method.InMaintenance {
+				// Without the per-route filter configs, the requests skip the JWT
+				// authentication, the service control check and the backend auth.
+				backendRoutes = append(backendRoutes, makeMaintenanceRoute(routeMatcher, method, serviceInfo.Options.MaintenanceRetryAfter))
+				continue
+			}
+
 			r := makeRoute(routeMatcher, method)
 
 			r.TypedPerFilterConfig, err = makePerRouteFilterConfig(operation, method, httpRule)
@@ -364,6 +555,15 @@ func MakeRouteTable(serviceInfo *configinfo.ServiceInfo) ([]*routepb.Route, []*r
 				return nil, nil, fmt.Errorf("fail to make per-route filter config for operation (%v): %v", operation, err)
 			}
 
+			if method.BackendInfo.HedgeThreshold > 0 && httpRule.HttpMethod == util.GET {
+				// The hedged request is sent when the per try timeout is reached,
+				// and the first response of the two is used.
+				r.GetRoute().RetryPolicy.PerTryTimeout = ptypes.DurationProto(method.BackendInfo.HedgeThreshold)
+				r.GetRoute().HedgePolicy = &routepb.HedgePolicy{
+					HedgeOnPerTryTimeout: true,
+				}
+			}
+
 			if method.BackendInfo.Hostname != "" {
 				// For routing to remote backends.
 				r.GetRoute().HostRewriteSpecifier = &routepb.RouteAction_HostRewriteLiteral{
@@ -396,19 +596,144 @@ func MakeRouteTable(serviceInfo *configinfo.ServiceInfo) ([]*routepb.Route, []*r
 				}
 			}
 
-			backendRoutes = append(backendRoutes, r)
+			if serviceInfo.Options.EnableRouteMetadata {
+				r.Metadata = makeRouteMetadata(operation, httpRule)
+			}
+
+			if method.FeatureGate != nil {
+				// The requests not let through fall to the feature gate route.
+				// The fraction is set even if all or none of the requests are let
+				// through, so the runtime key can always override it.
+				r.Match = proto.Clone(routeMatcher).(*routepb.RouteMatch)
+				r.Match.RuntimeFraction = &corepb.RuntimeFractionalPercent{
+					DefaultValue: &typepb.FractionalPercent{
+						Numerator:   method.FeatureGate.OpenPercent(time.Now()),
+						Denominator: typepb.FractionalPercent_HUNDRED,
+					},
+					RuntimeKey: util.FeatureGateRuntimeKey(operation),
+				}
+				backendRoutes = append(backendRoutes, r, makeFeatureGateRoute(routeMatcher, method))
+			} else {
+				backendRoutes = append(backendRoutes, r)
+			}
 
 			jsonStr, err := util.ProtoToJson(r)
 			if err != nil {
 				return nil, nil, err
 			}
 			glog.Infof("adding route: %v", jsonStr)
+
+			// Added after the route is logged, to keep the credential out of
+			// the logs.
+			if method.BackendCredential != nil {
+				value, ok := serviceInfo.BackendCredentialValues[method.BackendCredential.Id]
+				if !ok {
+					return nil, nil, fmt.Errorf("backend credential for operation (%v) is not resolved, it is only supported by the config manager", operation)
+				}
+				r.RequestHeadersToAdd = append(r.RequestHeadersToAdd, &corepb.HeaderValueOption{
+					Header: &corepb.HeaderValue{
+						Key:   method.BackendCredential.Header,
+						Value: value,
+					},
+					Append: &wrapperspb.BoolValue{
+						Value: false,
+					},
+				})
+			}
 		}
 	}
 
 	return backendRoutes, methodNotAllowedRoutes, nil
 }
 
+// RedactBackendCredentials returns a copy of the route config with the values
+// of the backend credentials replaced, so it can be logged or dumped. The
+// route config is returned as is if it has no credentials.
+func RedactBackendCredentials(route *routepb.RouteConfiguration, credentialValues map[string]string) *routepb.RouteConfiguration {
+	if route == nil || len(credentialValues) == 0 {
+		return route
+	}
+	secrets := make(map[string]bool)
+	for _, value := range credentialValues {
+		secrets[value] = true
+	}
+
+	redacted := proto.Clone(route).(*routepb.RouteConfiguration)
+	redactHeaders := func(headers []*corepb.HeaderValueOption) {
+		for _, header := range headers {
+			if secrets[header.GetHeader().GetValue()] {
+				header.Header.Value = RedactedBackendCredential
+			}
+		}
+	}
+	for _, vh := range redacted.GetVirtualHosts() {
+		redactHeaders(vh.GetRequestHeadersToAdd())
+		for _, r := range vh.GetRoutes() {
+			redactHeaders(r.GetRequestHeadersToAdd())
+		}
+	}
+	return redacted
+}
+
+// RedactHttpConMgrBackendCredentials returns a copy of the http connection
+// manager with the backend credentials of its route config redacted.
+func RedactHttpConMgrBackendCredentials(httpConMgr *hcmpb.HttpConnectionManager, credentialValues map[string]string) *hcmpb.HttpConnectionManager {
+	if httpConMgr.GetRouteConfig() == nil || len(credentialValues) == 0 {
+		return httpConMgr
+	}
+	redacted := proto.Clone(httpConMgr).(*hcmpb.HttpConnectionManager)
+	redacted.RouteSpecifier = &hcmpb.HttpConnectionManager_RouteConfig{
+		RouteConfig: RedactBackendCredentials(httpConMgr.GetRouteConfig(), credentialValues),
+	}
+	return redacted
+}
+
+// makeOperationVirtualClusters creates a virtual cluster for each backend
+// route, named by the operation of the route. Envoy collects the request
+// counts and latencies of each virtual cluster, so the stats can be broken
+// down by the operation.
+//
+// Unlike the route matcher, the virtual cluster matches the :path header that
+// includes the query parameters.
+func makeOperationVirtualClusters(backendRoutes []*routepb.Route) []*routepb.VirtualCluster {
+	var virtualClusters []*routepb.VirtualCluster
+	for i, r := range backendRoutes {
+		// The feature gate route shares the virtual cluster of the gated route.
+		if i > 0 && backendRoutes[i-1].GetMatch().GetRuntimeFraction() != nil && backendRoutes[i-1].GetName() == r.GetName() {
+			continue
+		}
+
+		var pathRegex string
+		switch {
+		case r.GetMatch().GetPath() != "":
+			pathRegex = "^" + regexp.QuoteMeta(r.GetMatch().GetPath()) + `(\?.*)?$`
+		case r.GetMatch().GetSafeRegex() != nil:
+			pathRegex = strings.TrimSuffix(r.GetMatch().GetSafeRegex().GetRegex(), "$") + `(\?.*)?$`
+		default:
+			continue
+		}
+
+		headers := []*routepb.HeaderMatcher{
+			{
+				Name: ":path",
+				HeaderMatchSpecifier: &routepb.HeaderMatcher_SafeRegexMatch{
+					SafeRegexMatch: &matcher.RegexMatcher{
+						EngineType: &matcher.RegexMatcher_GoogleRe2{
+							GoogleRe2: &matcher.RegexMatcher_GoogleRE2{},
+						},
+						Regex: pathRegex,
+					},
+				},
+			},
+		}
+		virtualClusters = append(virtualClusters, &routepb.VirtualCluster{
+			Name:    util.OperationStatName(r.GetName()),
+			Headers: append(headers, r.GetMatch().GetHeaders()...),
+		})
+	}
+	return virtualClusters
+}
+
 func makeRoute(routeMatcher *routepb.RouteMatch, method *configinfo.MethodInfo) *routepb.Route {
 	retryPolicy := &routepb.RetryPolicy{
 		RetryOn: method.BackendInfo.RetryOns,
@@ -443,6 +768,77 @@ func makeRoute(routeMatcher *routepb.RouteMatch, method *configinfo.MethodInfo)
 	}
 }
 
+// makeMaintenanceRoute rejects the requests of an operation in maintenance mode
+// with 503, telling the clients when to retry.
+func makeMaintenanceRoute(routeMatcher *routepb.RouteMatch, method *configinfo.MethodInfo, retryAfter time.Duration) *routepb.Route {
+	r := &routepb.Route{
+		Name:  method.Operation(),
+		Match: routeMatcher,
+		Action: &routepb.Route_DirectResponse{
+			DirectResponse: &routepb.DirectResponseAction{
+				Status: http.StatusServiceUnavailable,
+				Body: &corepb.DataSource{
+					Specifier: &corepb.DataSource_InlineString{
+						InlineString: "The current request is not available, the API is under maintenance.",
+					},
+				},
+			},
+		},
+		Decorator: &routepb.Decorator{
+			Operation: fmt.Sprintf("%s %s", util.SpanNamePrefix, method.ShortName),
+		},
+	}
+	if retryAfter > 0 {
+		r.ResponseHeadersToAdd = []*corepb.HeaderValueOption{
+			{
+				Header: &corepb.HeaderValue{
+					Key:   "Retry-After",
+					Value: strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))),
+				},
+			},
+		}
+	}
+	return r
+}
+
+// makeFeatureGateRoute rejects the requests of an operation not let through
+// its feature gate, as if the operation is not launched yet.
+func makeFeatureGateRoute(routeMatcher *routepb.RouteMatch, method *configinfo.MethodInfo) *routepb.Route {
+	return &routepb.Route{
+		Name:  method.Operation(),
+		Match: routeMatcher,
+		Action: &routepb.Route_DirectResponse{
+			DirectResponse: &routepb.DirectResponseAction{
+				Status: uint32(method.FeatureGate.Status),
+				Body: &corepb.DataSource{
+					Specifier: &corepb.DataSource_InlineString{
+						InlineString: "The current request is not available yet.",
+					},
+				},
+			},
+		},
+		Decorator: &routepb.Decorator{
+			Operation: fmt.Sprintf("%s %s", util.SpanNamePrefix, method.ShortName),
+		},
+	}
+}
+
+// makeRouteMetadata describes the API method a route is generated from, so
+// mis-routed requests can be traced back to the matched selector.
+func makeRouteMetadata(operation string, httpRule *httppattern.Pattern) *corepb.Metadata {
+	return &corepb.Metadata{
+		FilterMetadata: map[string]*structpb.Struct{
+			util.RouteMetadataNamespace: {
+				Fields: map[string]*structpb.Value{
+					"selector":     {Kind: &structpb.Value_StringValue{StringValue: operation}},
+					"uri_template": {Kind: &structpb.Value_StringValue{StringValue: httpRule.UriTemplate.Origin}},
+					"http_method":  {Kind: &structpb.Value_StringValue{StringValue: httpRule.HttpMethod}},
+				},
+			},
+		},
+	}
+}
+
 func makeMethodNotAllowedRoute(methodNotAllowedRouteMatcher *routepb.RouteMatch, uriTemplateInSc string) *routepb.Route {
 	spanName := util.MaybeTruncateSpanName(fmt.Sprintf("%s UnknownHttpMethodForPath_%s", util.SpanNamePrefix, uriTemplateInSc))
 
@@ -463,6 +859,86 @@ func makeMethodNotAllowedRoute(methodNotAllowedRouteMatcher *routepb.RouteMatch,
 		},
 	}
 }
+
+// makeApiMetadataRoute serves the API discovery metadata of the service
+// config directly from the proxy.
+func makeApiMetadataRoute(serviceInfo *configinfo.ServiceInfo) (*routepb.Route, error) {
+	path := serviceInfo.Options.ApiMetadataPath
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("invalid api metadata path: %v, should start with '/'", path)
+	}
+	metadata, err := serviceInfo.MakeApiMetadataJson()
+	if err != nil {
+		return nil, fmt.Errorf("fail to make the api metadata: %v", err)
+	}
+
+	return &routepb.Route{
+		Match: &routepb.RouteMatch{
+			PathSpecifier: &routepb.RouteMatch_Path{
+				Path: path,
+			},
+			Headers: []*routepb.HeaderMatcher{
+				{
+					Name: ":method",
+					HeaderMatchSpecifier: &routepb.HeaderMatcher_StringMatch{
+						StringMatch: &matcher.StringMatcher{
+							MatchPattern: &matcher.StringMatcher_Exact{
+								Exact: util.GET,
+							},
+						},
+					},
+				},
+			},
+		},
+		Action: &routepb.Route_DirectResponse{
+			DirectResponse: &routepb.DirectResponseAction{
+				Status: http.StatusOK,
+				Body: &corepb.DataSource{
+					Specifier: &corepb.DataSource_InlineString{
+						InlineString: string(metadata),
+					},
+				},
+			},
+		},
+		ResponseHeadersToAdd: []*corepb.HeaderValueOption{
+			{
+				Header: &corepb.HeaderValue{
+					Key:   "content-type",
+					Value: "application/json",
+				},
+				Append: &wrapperspb.BoolValue{Value: false},
+			},
+		},
+		Decorator: &routepb.Decorator{
+			Operation: fmt.Sprintf("%s ApiMetadata", util.SpanNamePrefix),
+		},
+	}, nil
+}
+
+// makeGrpcReflectionRoute routes the gRPC server reflection to the config
+// manager, which answers it from the service config descriptors.
+func makeGrpcReflectionRoute() *routepb.Route {
+	return &routepb.Route{
+		Match: &routepb.RouteMatch{
+			PathSpecifier: &routepb.RouteMatch_Prefix{
+				Prefix: "/grpc.reflection.v1alpha.ServerReflection/",
+			},
+		},
+		Action: &routepb.Route_Route{
+			Route: &routepb.RouteAction{
+				ClusterSpecifier: &routepb.RouteAction_Cluster{
+					Cluster: util.GrpcReflectionClusterName,
+				},
+				// The reflection is a bidirectional stream.
+				Timeout: ptypes.DurationProto(0),
+			},
+		},
+		Decorator: &routepb.Decorator{
+			Operation: fmt.Sprintf("%s GrpcReflection", util.SpanNamePrefix),
+		},
+	}
+}
+
 func makeCatchAllNotFoundRoute() *routepb.Route {
 	return &routepb.Route{
 		Match: &routepb.RouteMatch{
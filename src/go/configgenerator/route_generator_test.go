@@ -20,14 +20,17 @@ import (
 	"testing"
 	"time"
 
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configgenerator/filterconfig"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
 
 	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	routepb "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	jwtpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/jwt_authn/v3"
 	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
 	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
 	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
@@ -40,6 +43,8 @@ func TestMakeRouteConfig(t *testing.T) {
 		desc                               string
 		enableStrictTransportSecurity      bool
 		enableOperationNameHeader          bool
+		enableRouteMetadata                bool
+		operationHedgingThreshold          string
 		disallowColonInWildcardPathSegment bool
 		fakeServiceConfig                  *confpb.Service
 		wantedError                        string
@@ -2639,51 +2644,9 @@ func TestMakeRouteConfig(t *testing.T) {
 }
 `,
 		},
-	}
-
-	for _, tc := range testData {
-		t.Run(tc.desc, func(t *testing.T) {
-			opts := options.DefaultConfigGeneratorOptions()
-			opts.EnableHSTS = tc.enableStrictTransportSecurity
-			opts.EnableOperationNameHeader = tc.enableOperationNameHeader
-			opts.DisallowColonInWildcardPathSegment = tc.disallowColonInWildcardPathSegment
-			fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(tc.fakeServiceConfig, testConfigID, opts)
-			if err != nil {
-				t.Fatal(err)
-			}
-
-			gotRoute, err := makeRouteConfig(fakeServiceInfo)
-			if tc.wantedError != "" {
-				if err == nil || !strings.Contains(err.Error(), tc.wantedError) {
-					t.Fatalf("expected err: %v, got: %v", tc.wantedError, err)
-				}
-				return
-			} else if err != nil {
-				t.Fatalf("expected err: %v, got: %v", tc.wantedError, err)
-			}
-
-			marshaler := &jsonpb.Marshaler{}
-			gotConfig, err := marshaler.MarshalToString(gotRoute)
-			if err != nil {
-				t.Fatal(err)
-			}
-
-			if err := util.JsonEqual(tc.wantRouteConfig, gotConfig); err != nil {
-				t.Errorf("makeRouteConfig failed, \n %v", err)
-			}
-		})
-	}
-}
-
-func TestMakeFallbackRoute(t *testing.T) {
-	testData := []struct {
-		desc              string
-		fakeServiceConfig *confpb.Service
-		params            []string
-		wantRouteConfig   string
-	}{
 		{
-			desc: "generate 404/405 fallback routes for exact path",
+			desc:                "Enable route metadata",
+			enableRouteMetadata: true,
 			fakeServiceConfig: &confpb.Service{
 				Name: testProjectName,
 				Apis: []*apipb.Api{
@@ -2691,29 +2654,21 @@ func TestMakeFallbackRoute(t *testing.T) {
 						Name: testApiName,
 						Methods: []*apipb.Method{
 							{
-								Name: "Echo_Get",
-							},
-							{
-								Name: "Echo_Post",
+								Name: "Echo",
 							},
 						},
 					},
 				},
-				Http: &annotationspb.Http{Rules: []*annotationspb.HttpRule{
-					{
-						Selector: fmt.Sprintf("%s.Echo_Get", testApiName),
-						Pattern: &annotationspb.HttpRule_Get{
-							Get: "/echo",
-						},
-					},
-					{
-						Selector: fmt.Sprintf("%s.Echo_Post", testApiName),
-						Pattern: &annotationspb.HttpRule_Post{
-							Post: "/echo",
+				Http: &annotationspb.Http{
+					Rules: []*annotationspb.HttpRule{
+						{
+							Selector: fmt.Sprintf("%s.Echo", testApiName),
+							Pattern: &annotationspb.HttpRule_Get{
+								Get: "/echo",
+							},
 						},
 					},
 				},
-				},
 			},
 			wantRouteConfig: `
 {
@@ -2727,7 +2682,7 @@ func TestMakeFallbackRoute(t *testing.T) {
       "routes": [
         {
           "decorator": {
-            "operation": "ingress Echo_Get"
+            "operation": "ingress Echo"
           },
           "match": {
             "headers": [
@@ -2738,31 +2693,16 @@ func TestMakeFallbackRoute(t *testing.T) {
             ],
             "path": "/echo"
           },
-          "name": "endpoints.examples.bookstore.Bookstore.Echo_Get",
-          "route": {
-            "cluster": "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
-            "idleTimeout": "300s",
-            "retryPolicy": {
-              "numRetries": 1,
-              "retryOn": "reset,connect-failure,refused-stream"
-            },
-            "timeout": "15s"
-          }
-        },
-        {
-          "decorator": {
-            "operation": "ingress Echo_Get"
-          },
-          "match": {
-            "headers": [
-              {
-                "stringMatch":{"exact":"GET"},
-                "name": ":method"
+          "metadata": {
+            "filterMetadata": {
+              "com.google.espv2.route": {
+                "http_method": "GET",
+                "selector": "endpoints.examples.bookstore.Bookstore.Echo",
+                "uri_template": "/echo"
               }
-            ],
-            "path": "/echo/"
+            }
           },
-          "name": "endpoints.examples.bookstore.Bookstore.Echo_Get",
+          "name": "endpoints.examples.bookstore.Bookstore.Echo",
           "route": {
             "cluster": "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
             "idleTimeout": "300s",
@@ -2775,42 +2715,27 @@ func TestMakeFallbackRoute(t *testing.T) {
         },
         {
           "decorator": {
-            "operation": "ingress Echo_Post"
+            "operation": "ingress Echo"
           },
           "match": {
             "headers": [
               {
-                "stringMatch":{"exact":"POST"},
+                "stringMatch":{"exact":"GET"},
                 "name": ":method"
               }
             ],
-            "path": "/echo"
-          },
-          "name": "endpoints.examples.bookstore.Bookstore.Echo_Post",
-          "route": {
-            "cluster": "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
-            "idleTimeout": "300s",
-            "retryPolicy": {
-              "numRetries": 1,
-              "retryOn": "reset,connect-failure,refused-stream"
-            },
-            "timeout": "15s"
-          }
-        },
-        {
-          "decorator": {
-            "operation": "ingress Echo_Post"
+            "path": "/echo/"
           },
-          "match": {
-            "headers": [
-              {
-                "stringMatch":{"exact":"POST"},
-                "name": ":method"
+          "metadata": {
+            "filterMetadata": {
+              "com.google.espv2.route": {
+                "http_method": "GET",
+                "selector": "endpoints.examples.bookstore.Bookstore.Echo",
+                "uri_template": "/echo"
               }
-            ],
-            "path": "/echo/"
+            }
           },
-          "name": "endpoints.examples.bookstore.Bookstore.Echo_Post",
+          "name": "endpoints.examples.bookstore.Bookstore.Echo",
           "route": {
             "cluster": "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
             "idleTimeout": "300s",
@@ -2866,10 +2791,12 @@ func TestMakeFallbackRoute(t *testing.T) {
       ]
     }
   ]
-}`,
+}
+`,
 		},
 		{
-			desc: "generate 404/405 fallback routes for regex",
+			desc:                      "Hedge the GET routes of the operation",
+			operationHedgingThreshold: "endpoints.examples.bookstore.Bookstore.Echo=200ms",
 			fakeServiceConfig: &confpb.Service{
 				Name: testProjectName,
 				Apis: []*apipb.Api{
@@ -2877,29 +2804,21 @@ func TestMakeFallbackRoute(t *testing.T) {
 						Name: testApiName,
 						Methods: []*apipb.Method{
 							{
-								Name: "Echo_Get",
-							},
-							{
-								Name: "Echo_Post",
+								Name: "Echo",
 							},
 						},
 					},
 				},
-				Http: &annotationspb.Http{Rules: []*annotationspb.HttpRule{
-					{
-						Selector: fmt.Sprintf("%s.Echo_Get", testApiName),
-						Pattern: &annotationspb.HttpRule_Get{
-							Get: "/echo/{id}",
-						},
-					},
-					{
-						Selector: fmt.Sprintf("%s.Echo_Post", testApiName),
-						Pattern: &annotationspb.HttpRule_Post{
-							Post: "/echo/{id}",
+				Http: &annotationspb.Http{
+					Rules: []*annotationspb.HttpRule{
+						{
+							Selector: fmt.Sprintf("%s.Echo", testApiName),
+							Pattern: &annotationspb.HttpRule_Get{
+								Get: "/echo",
+							},
 						},
 					},
 				},
-				},
 			},
 			wantRouteConfig: `
 {
@@ -2913,7 +2832,7 @@ func TestMakeFallbackRoute(t *testing.T) {
       "routes": [
         {
           "decorator": {
-            "operation": "ingress Echo_Get"
+            "operation": "ingress Echo"
           },
           "match": {
             "headers": [
@@ -2922,17 +2841,18 @@ func TestMakeFallbackRoute(t *testing.T) {
                 "name": ":method"
               }
             ],
-            "safeRegex": {
-              "googleRe2": {},
-              "regex": "^/echo/[^\\/]+\\/?$"
-            }
+            "path": "/echo"
           },
-          "name": "endpoints.examples.bookstore.Bookstore.Echo_Get",
+          "name": "endpoints.examples.bookstore.Bookstore.Echo",
           "route": {
             "cluster": "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
+            "hedgePolicy": {
+              "hedgeOnPerTryTimeout": true
+            },
             "idleTimeout": "300s",
             "retryPolicy": {
               "numRetries": 1,
+              "perTryTimeout": "0.200s",
               "retryOn": "reset,connect-failure,refused-stream"
             },
             "timeout": "15s"
@@ -2940,26 +2860,27 @@ func TestMakeFallbackRoute(t *testing.T) {
         },
         {
           "decorator": {
-            "operation": "ingress Echo_Post"
+            "operation": "ingress Echo"
           },
           "match": {
             "headers": [
               {
-                "stringMatch":{"exact":"POST"},
+                "stringMatch":{"exact":"GET"},
                 "name": ":method"
               }
             ],
-            "safeRegex": {
-              "googleRe2": {},
-              "regex": "^/echo/[^\\/]+\\/?$"
-            }
+            "path": "/echo/"
           },
-          "name": "endpoints.examples.bookstore.Bookstore.Echo_Post",
+          "name": "endpoints.examples.bookstore.Bookstore.Echo",
           "route": {
             "cluster": "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
+            "hedgePolicy": {
+              "hedgeOnPerTryTimeout": true
+            },
             "idleTimeout": "300s",
             "retryPolicy": {
               "numRetries": 1,
+              "perTryTimeout": "0.200s",
               "retryOn": "reset,connect-failure,refused-stream"
             },
             "timeout": "15s"
@@ -2967,19 +2888,30 @@ func TestMakeFallbackRoute(t *testing.T) {
         },
         {
           "decorator": {
-            "operation": "ingress UnknownHttpMethodForPath_/echo/{id}"
+            "operation": "ingress UnknownHttpMethodForPath_/echo"
           },
           "directResponse": {
             "body": {
-              "inlineString": "The current request is matched to the defined url template \"/echo/{id}\" but its http method is not allowed"
+              "inlineString": "The current request is matched to the defined url template \"/echo\" but its http method is not allowed"
             },
             "status": 405
           },
           "match": {
-            "safeRegex": {
-              "googleRe2": {},
-              "regex": "^/echo/[^\\/]+\\/?$"
-            }
+            "path": "/echo"
+          }
+        },
+        {
+          "decorator": {
+            "operation": "ingress UnknownHttpMethodForPath_/echo"
+          },
+          "directResponse": {
+            "body": {
+              "inlineString": "The current request is matched to the defined url template \"/echo\" but its http method is not allowed"
+            },
+            "status": 405
+          },
+          "match": {
+            "path": "/echo/"
           }
         },
         {
@@ -3002,8 +2934,53 @@ func TestMakeFallbackRoute(t *testing.T) {
 }
 `,
 		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.EnableHSTS = tc.enableStrictTransportSecurity
+			opts.EnableOperationNameHeader = tc.enableOperationNameHeader
+			opts.EnableRouteMetadata = tc.enableRouteMetadata
+			opts.OperationHedgingThreshold = tc.operationHedgingThreshold
+			opts.DisallowColonInWildcardPathSegment = tc.disallowColonInWildcardPathSegment
+			fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(tc.fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gotRoute, err := makeRouteConfig(fakeServiceInfo)
+			if tc.wantedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantedError) {
+					t.Fatalf("expected err: %v, got: %v", tc.wantedError, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("expected err: %v, got: %v", tc.wantedError, err)
+			}
+
+			marshaler := &jsonpb.Marshaler{}
+			gotConfig, err := marshaler.MarshalToString(gotRoute)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := util.JsonEqual(tc.wantRouteConfig, gotConfig); err != nil {
+				t.Errorf("makeRouteConfig failed, \n %v", err)
+			}
+		})
+	}
+}
+
+func TestMakeFallbackRoute(t *testing.T) {
+	testData := []struct {
+		desc              string
+		fakeServiceConfig *confpb.Service
+		params            []string
+		wantRouteConfig   string
+	}{
 		{
-			desc: "ensure the order of backend routes, 405 routes, cors default allow_origin=* routes, and 404 route",
+			desc: "generate 404/405 fallback routes for exact path",
 			fakeServiceConfig: &confpb.Service{
 				Name: testProjectName,
 				Apis: []*apipb.Api{
@@ -3035,22 +3012,11 @@ func TestMakeFallbackRoute(t *testing.T) {
 				},
 				},
 			},
-			params: []string{"basic", "*", "", "GET,POST,PUT,OPTIONS", "", "", "2m"},
 			wantRouteConfig: `
 {
   "name": "local_route",
   "virtualHosts": [
     {
-      "cors": {
-        "allowCredentials": false,
-        "allowMethods": "GET,POST,PUT,OPTIONS",
-        "allowOriginStringMatch": [
-          {
-            "exact": "*"
-          }
-        ],
-        "maxAge": "120"
-      },
       "domains": [
         "*"
       ],
@@ -3154,75 +3120,163 @@ func TestMakeFallbackRoute(t *testing.T) {
         },
         {
           "decorator": {
-            "operation": "ingress"
+            "operation": "ingress UnknownHttpMethodForPath_/echo"
+          },
+          "directResponse": {
+            "body": {
+              "inlineString": "The current request is matched to the defined url template \"/echo\" but its http method is not allowed"
+            },
+            "status": 405
           },
           "match": {
-            "headers": [
-              {
-                "stringMatch":{"exact":"OPTIONS"},
-                "name": ":method"
-              },
-              {
-                "name": "origin",
-                "presentMatch": true
-              },
-              {
-                "name": "access-control-request-method",
-                "presentMatch": true
-              }
-            ],
-            "prefix": "/"
+            "path": "/echo"
+          }
+        },
+        {
+          "decorator": {
+            "operation": "ingress UnknownHttpMethodForPath_/echo"
           },
-          "route": {
-            "cluster": "backend-cluster-bookstore.endpoints.project123.cloud.goog_local"
+          "directResponse": {
+            "body": {
+              "inlineString": "The current request is matched to the defined url template \"/echo\" but its http method is not allowed"
+            },
+            "status": 405
+          },
+          "match": {
+            "path": "/echo/"
           }
         },
         {
           "decorator": {
-            "operation": "ingress"
+            "operation": "ingress UnknownOperationName"
           },
           "directResponse": {
             "body": {
-              "inlineString": "The CORS preflight request is missing one (or more) of the following required headers [Origin, Access-Control-Request-Method] or has an unmatched Origin header."
+              "inlineString": "The current request is not defined by this API."
             },
-            "status": 400
+            "status": 404
+          },
+          "match": {
+            "prefix": "/"
+          }
+        }
+      ]
+    }
+  ]
+}`,
+		},
+		{
+			desc: "generate 404/405 fallback routes for regex",
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+						Methods: []*apipb.Method{
+							{
+								Name: "Echo_Get",
+							},
+							{
+								Name: "Echo_Post",
+							},
+						},
+					},
+				},
+				Http: &annotationspb.Http{Rules: []*annotationspb.HttpRule{
+					{
+						Selector: fmt.Sprintf("%s.Echo_Get", testApiName),
+						Pattern: &annotationspb.HttpRule_Get{
+							Get: "/echo/{id}",
+						},
+					},
+					{
+						Selector: fmt.Sprintf("%s.Echo_Post", testApiName),
+						Pattern: &annotationspb.HttpRule_Post{
+							Post: "/echo/{id}",
+						},
+					},
+				},
+				},
+			},
+			wantRouteConfig: `
+{
+  "name": "local_route",
+  "virtualHosts": [
+    {
+      "domains": [
+        "*"
+      ],
+      "name": "backend",
+      "routes": [
+        {
+          "decorator": {
+            "operation": "ingress Echo_Get"
           },
           "match": {
             "headers": [
               {
-                "stringMatch":{"exact":"OPTIONS"},
+                "stringMatch":{"exact":"GET"},
                 "name": ":method"
               }
             ],
-            "prefix": "/"
+            "safeRegex": {
+              "googleRe2": {},
+              "regex": "^/echo/[^\\/]+\\/?$"
+            }
+          },
+          "name": "endpoints.examples.bookstore.Bookstore.Echo_Get",
+          "route": {
+            "cluster": "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
+            "idleTimeout": "300s",
+            "retryPolicy": {
+              "numRetries": 1,
+              "retryOn": "reset,connect-failure,refused-stream"
+            },
+            "timeout": "15s"
           }
         },
         {
           "decorator": {
-            "operation": "ingress UnknownHttpMethodForPath_/echo"
-          },
-          "directResponse": {
-            "body": {
-              "inlineString": "The current request is matched to the defined url template \"/echo\" but its http method is not allowed"
-            },
-            "status": 405
+            "operation": "ingress Echo_Post"
           },
           "match": {
-            "path": "/echo"
+            "headers": [
+              {
+                "stringMatch":{"exact":"POST"},
+                "name": ":method"
+              }
+            ],
+            "safeRegex": {
+              "googleRe2": {},
+              "regex": "^/echo/[^\\/]+\\/?$"
+            }
+          },
+          "name": "endpoints.examples.bookstore.Bookstore.Echo_Post",
+          "route": {
+            "cluster": "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
+            "idleTimeout": "300s",
+            "retryPolicy": {
+              "numRetries": 1,
+              "retryOn": "reset,connect-failure,refused-stream"
+            },
+            "timeout": "15s"
           }
         },
         {
           "decorator": {
-            "operation": "ingress UnknownHttpMethodForPath_/echo"
+            "operation": "ingress UnknownHttpMethodForPath_/echo/{id}"
           },
           "directResponse": {
             "body": {
-              "inlineString": "The current request is matched to the defined url template \"/echo\" but its http method is not allowed"
+              "inlineString": "The current request is matched to the defined url template \"/echo/{id}\" but its http method is not allowed"
             },
             "status": 405
           },
           "match": {
-            "path": "/echo/"
+            "safeRegex": {
+              "googleRe2": {},
+              "regex": "^/echo/[^\\/]+\\/?$"
+            }
           }
         },
         {
@@ -3242,10 +3296,11 @@ func TestMakeFallbackRoute(t *testing.T) {
       ]
     }
   ]
-}`,
+}
+`,
 		},
 		{
-			desc: "ensure the order of backend routes, 405 routes, cors exact origin routes, and 404 route",
+			desc: "ensure the order of backend routes, 405 routes, cors default allow_origin=* routes, and 404 route",
 			fakeServiceConfig: &confpb.Service{
 				Name: testProjectName,
 				Apis: []*apipb.Api{
@@ -3277,7 +3332,7 @@ func TestMakeFallbackRoute(t *testing.T) {
 				},
 				},
 			},
-			params: []string{"basic", "http://example.com", "", "GET,POST,PUT,OPTIONS", "", "", "2m"},
+			params: []string{"basic", "*", "", "GET,POST,PUT,OPTIONS", "", "", "2m"},
 			wantRouteConfig: `
 {
   "name": "local_route",
@@ -3288,7 +3343,7 @@ func TestMakeFallbackRoute(t *testing.T) {
         "allowMethods": "GET,POST,PUT,OPTIONS",
         "allowOriginStringMatch": [
           {
-            "exact": "http://example.com"
+            "exact": "*"
           }
         ],
         "maxAge": "120"
@@ -3406,7 +3461,7 @@ func TestMakeFallbackRoute(t *testing.T) {
               },
               {
                 "name": "origin",
-                "stringMatch":{"exact":"http://example.com"}
+                "presentMatch": true
               },
               {
                 "name": "access-control-request-method",
@@ -3487,7 +3542,7 @@ func TestMakeFallbackRoute(t *testing.T) {
 }`,
 		},
 		{
-			desc: "ensure the order of backend routes, 405 routes, cors regex origin routes, and 404 route",
+			desc: "ensure the order of backend routes, 405 routes, cors exact origin routes, and 404 route",
 			fakeServiceConfig: &confpb.Service{
 				Name: testProjectName,
 				Apis: []*apipb.Api{
@@ -3519,7 +3574,7 @@ func TestMakeFallbackRoute(t *testing.T) {
 				},
 				},
 			},
-			params: []string{"cors_with_regex", "", ".*", "GET,POST,PUT,OPTIONS", "", "", "2m"},
+			params: []string{"basic", "http://example.com", "", "GET,POST,PUT,OPTIONS", "", "", "2m"},
 			wantRouteConfig: `
 {
   "name": "local_route",
@@ -3530,10 +3585,7 @@ func TestMakeFallbackRoute(t *testing.T) {
         "allowMethods": "GET,POST,PUT,OPTIONS",
         "allowOriginStringMatch": [
           {
-            "safeRegex": {
-              "googleRe2": {},
-              "regex": ".*"
-            }
+            "exact": "http://example.com"
           }
         ],
         "maxAge": "120"
@@ -3651,10 +3703,7 @@ func TestMakeFallbackRoute(t *testing.T) {
               },
               {
                 "name": "origin",
-                "safeRegexMatch": {
-                  "googleRe2": {},
-                  "regex": ".*"
-                }
+                "stringMatch":{"exact":"http://example.com"}
               },
               {
                 "name": "access-control-request-method",
@@ -3735,7 +3784,7 @@ func TestMakeFallbackRoute(t *testing.T) {
 }`,
 		},
 		{
-			desc: "span name length check",
+			desc: "ensure the order of backend routes, 405 routes, cors regex origin routes, and 404 route",
 			fakeServiceConfig: &confpb.Service{
 				Name: testProjectName,
 				Apis: []*apipb.Api{
@@ -3743,35 +3792,49 @@ func TestMakeFallbackRoute(t *testing.T) {
 						Name: testApiName,
 						Methods: []*apipb.Method{
 							{
-								Name: "Long_Get",
+								Name: "Echo_Get",
 							},
 							{
-								Name: "Short_Get",
+								Name: "Echo_Post",
 							},
 						},
 					},
 				},
 				Http: &annotationspb.Http{Rules: []*annotationspb.HttpRule{
 					{
-						Selector: fmt.Sprintf("%s.Long_Get", testApiName),
+						Selector: fmt.Sprintf("%s.Echo_Get", testApiName),
 						Pattern: &annotationspb.HttpRule_Get{
-							Get: "/this-is-super-long-uri-template/this-is-super-long-uri-template/this-is-super-long-uri-template/this-is-super-long-uri-template",
+							Get: "/echo",
 						},
 					},
 					{
-						Selector: fmt.Sprintf("%s.Short_Get", testApiName),
-						Pattern: &annotationspb.HttpRule_Get{
-							Get: "/this-is-short-uri-template",
+						Selector: fmt.Sprintf("%s.Echo_Post", testApiName),
+						Pattern: &annotationspb.HttpRule_Post{
+							Post: "/echo",
 						},
 					},
 				},
 				},
 			},
+			params: []string{"cors_with_regex", "", ".*", "GET,POST,PUT,OPTIONS", "", "", "2m"},
 			wantRouteConfig: `
 {
   "name": "local_route",
   "virtualHosts": [
     {
+      "cors": {
+        "allowCredentials": false,
+        "allowMethods": "GET,POST,PUT,OPTIONS",
+        "allowOriginStringMatch": [
+          {
+            "safeRegex": {
+              "googleRe2": {},
+              "regex": ".*"
+            }
+          }
+        ],
+        "maxAge": "120"
+      },
       "domains": [
         "*"
       ],
@@ -3779,7 +3842,7 @@ func TestMakeFallbackRoute(t *testing.T) {
       "routes": [
         {
           "decorator": {
-            "operation": "ingress Short_Get"
+            "operation": "ingress Echo_Get"
           },
           "match": {
             "headers": [
@@ -3788,9 +3851,9 @@ func TestMakeFallbackRoute(t *testing.T) {
                 "name": ":method"
               }
             ],
-            "path": "/this-is-short-uri-template"
+            "path": "/echo"
           },
-          "name": "endpoints.examples.bookstore.Bookstore.Short_Get",
+          "name": "endpoints.examples.bookstore.Bookstore.Echo_Get",
           "route": {
             "cluster": "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
             "idleTimeout": "300s",
@@ -3803,7 +3866,7 @@ func TestMakeFallbackRoute(t *testing.T) {
         },
         {
           "decorator": {
-            "operation": "ingress Short_Get"
+            "operation": "ingress Echo_Get"
           },
           "match": {
             "headers": [
@@ -3812,9 +3875,9 @@ func TestMakeFallbackRoute(t *testing.T) {
                 "name": ":method"
               }
             ],
-            "path": "/this-is-short-uri-template/"
+            "path": "/echo/"
           },
-          "name": "endpoints.examples.bookstore.Bookstore.Short_Get",
+          "name": "endpoints.examples.bookstore.Bookstore.Echo_Get",
           "route": {
             "cluster": "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
             "idleTimeout": "300s",
@@ -3827,18 +3890,18 @@ func TestMakeFallbackRoute(t *testing.T) {
         },
         {
           "decorator": {
-            "operation": "ingress Long_Get"
+            "operation": "ingress Echo_Post"
           },
           "match": {
             "headers": [
               {
-                "stringMatch":{"exact":"GET"},
+                "stringMatch":{"exact":"POST"},
                 "name": ":method"
               }
             ],
-            "path": "/this-is-super-long-uri-template/this-is-super-long-uri-template/this-is-super-long-uri-template/this-is-super-long-uri-template"
+            "path": "/echo"
           },
-          "name": "endpoints.examples.bookstore.Bookstore.Long_Get",
+          "name": "endpoints.examples.bookstore.Bookstore.Echo_Post",
           "route": {
             "cluster": "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
             "idleTimeout": "300s",
@@ -3851,18 +3914,18 @@ func TestMakeFallbackRoute(t *testing.T) {
         },
         {
           "decorator": {
-            "operation": "ingress Long_Get"
+            "operation": "ingress Echo_Post"
           },
           "match": {
             "headers": [
               {
-                "stringMatch":{"exact":"GET"},
+                "stringMatch":{"exact":"POST"},
                 "name": ":method"
               }
             ],
-            "path": "/this-is-super-long-uri-template/this-is-super-long-uri-template/this-is-super-long-uri-template/this-is-super-long-uri-template/"
+            "path": "/echo/"
           },
-          "name": "endpoints.examples.bookstore.Bookstore.Long_Get",
+          "name": "endpoints.examples.bookstore.Bookstore.Echo_Post",
           "route": {
             "cluster": "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
             "idleTimeout": "300s",
@@ -3875,25 +3938,259 @@ func TestMakeFallbackRoute(t *testing.T) {
         },
         {
           "decorator": {
-            "operation": "ingress UnknownHttpMethodForPath_/this-is-short-uri-template"
-          },
-          "directResponse": {
-            "body": {
-              "inlineString": "The current request is matched to the defined url template \"/this-is-short-uri-template\" but its http method is not allowed"
-            },
-            "status": 405
+            "operation": "ingress"
           },
           "match": {
-            "path": "/this-is-short-uri-template"
-          }
-        },
-        {
-          "decorator": {
-            "operation": "ingress UnknownHttpMethodForPath_/this-is-short-uri-template"
-          },
-          "directResponse": {
-            "body": {
-              "inlineString": "The current request is matched to the defined url template \"/this-is-short-uri-template\" but its http method is not allowed"
+            "headers": [
+              {
+                "stringMatch":{"exact":"OPTIONS"},
+                "name": ":method"
+              },
+              {
+                "name": "origin",
+                "safeRegexMatch": {
+                  "googleRe2": {},
+                  "regex": ".*"
+                }
+              },
+              {
+                "name": "access-control-request-method",
+                "presentMatch": true
+              }
+            ],
+            "prefix": "/"
+          },
+          "route": {
+            "cluster": "backend-cluster-bookstore.endpoints.project123.cloud.goog_local"
+          }
+        },
+        {
+          "decorator": {
+            "operation": "ingress"
+          },
+          "directResponse": {
+            "body": {
+              "inlineString": "The CORS preflight request is missing one (or more) of the following required headers [Origin, Access-Control-Request-Method] or has an unmatched Origin header."
+            },
+            "status": 400
+          },
+          "match": {
+            "headers": [
+              {
+                "stringMatch":{"exact":"OPTIONS"},
+                "name": ":method"
+              }
+            ],
+            "prefix": "/"
+          }
+        },
+        {
+          "decorator": {
+            "operation": "ingress UnknownHttpMethodForPath_/echo"
+          },
+          "directResponse": {
+            "body": {
+              "inlineString": "The current request is matched to the defined url template \"/echo\" but its http method is not allowed"
+            },
+            "status": 405
+          },
+          "match": {
+            "path": "/echo"
+          }
+        },
+        {
+          "decorator": {
+            "operation": "ingress UnknownHttpMethodForPath_/echo"
+          },
+          "directResponse": {
+            "body": {
+              "inlineString": "The current request is matched to the defined url template \"/echo\" but its http method is not allowed"
+            },
+            "status": 405
+          },
+          "match": {
+            "path": "/echo/"
+          }
+        },
+        {
+          "decorator": {
+            "operation": "ingress UnknownOperationName"
+          },
+          "directResponse": {
+            "body": {
+              "inlineString": "The current request is not defined by this API."
+            },
+            "status": 404
+          },
+          "match": {
+            "prefix": "/"
+          }
+        }
+      ]
+    }
+  ]
+}`,
+		},
+		{
+			desc: "span name length check",
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+						Methods: []*apipb.Method{
+							{
+								Name: "Long_Get",
+							},
+							{
+								Name: "Short_Get",
+							},
+						},
+					},
+				},
+				Http: &annotationspb.Http{Rules: []*annotationspb.HttpRule{
+					{
+						Selector: fmt.Sprintf("%s.Long_Get", testApiName),
+						Pattern: &annotationspb.HttpRule_Get{
+							Get: "/this-is-super-long-uri-template/this-is-super-long-uri-template/this-is-super-long-uri-template/this-is-super-long-uri-template",
+						},
+					},
+					{
+						Selector: fmt.Sprintf("%s.Short_Get", testApiName),
+						Pattern: &annotationspb.HttpRule_Get{
+							Get: "/this-is-short-uri-template",
+						},
+					},
+				},
+				},
+			},
+			wantRouteConfig: `
+{
+  "name": "local_route",
+  "virtualHosts": [
+    {
+      "domains": [
+        "*"
+      ],
+      "name": "backend",
+      "routes": [
+        {
+          "decorator": {
+            "operation": "ingress Short_Get"
+          },
+          "match": {
+            "headers": [
+              {
+                "stringMatch":{"exact":"GET"},
+                "name": ":method"
+              }
+            ],
+            "path": "/this-is-short-uri-template"
+          },
+          "name": "endpoints.examples.bookstore.Bookstore.Short_Get",
+          "route": {
+            "cluster": "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
+            "idleTimeout": "300s",
+            "retryPolicy": {
+              "numRetries": 1,
+              "retryOn": "reset,connect-failure,refused-stream"
+            },
+            "timeout": "15s"
+          }
+        },
+        {
+          "decorator": {
+            "operation": "ingress Short_Get"
+          },
+          "match": {
+            "headers": [
+              {
+                "stringMatch":{"exact":"GET"},
+                "name": ":method"
+              }
+            ],
+            "path": "/this-is-short-uri-template/"
+          },
+          "name": "endpoints.examples.bookstore.Bookstore.Short_Get",
+          "route": {
+            "cluster": "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
+            "idleTimeout": "300s",
+            "retryPolicy": {
+              "numRetries": 1,
+              "retryOn": "reset,connect-failure,refused-stream"
+            },
+            "timeout": "15s"
+          }
+        },
+        {
+          "decorator": {
+            "operation": "ingress Long_Get"
+          },
+          "match": {
+            "headers": [
+              {
+                "stringMatch":{"exact":"GET"},
+                "name": ":method"
+              }
+            ],
+            "path": "/this-is-super-long-uri-template/this-is-super-long-uri-template/this-is-super-long-uri-template/this-is-super-long-uri-template"
+          },
+          "name": "endpoints.examples.bookstore.Bookstore.Long_Get",
+          "route": {
+            "cluster": "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
+            "idleTimeout": "300s",
+            "retryPolicy": {
+              "numRetries": 1,
+              "retryOn": "reset,connect-failure,refused-stream"
+            },
+            "timeout": "15s"
+          }
+        },
+        {
+          "decorator": {
+            "operation": "ingress Long_Get"
+          },
+          "match": {
+            "headers": [
+              {
+                "stringMatch":{"exact":"GET"},
+                "name": ":method"
+              }
+            ],
+            "path": "/this-is-super-long-uri-template/this-is-super-long-uri-template/this-is-super-long-uri-template/this-is-super-long-uri-template/"
+          },
+          "name": "endpoints.examples.bookstore.Bookstore.Long_Get",
+          "route": {
+            "cluster": "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
+            "idleTimeout": "300s",
+            "retryPolicy": {
+              "numRetries": 1,
+              "retryOn": "reset,connect-failure,refused-stream"
+            },
+            "timeout": "15s"
+          }
+        },
+        {
+          "decorator": {
+            "operation": "ingress UnknownHttpMethodForPath_/this-is-short-uri-template"
+          },
+          "directResponse": {
+            "body": {
+              "inlineString": "The current request is matched to the defined url template \"/this-is-short-uri-template\" but its http method is not allowed"
+            },
+            "status": 405
+          },
+          "match": {
+            "path": "/this-is-short-uri-template"
+          }
+        },
+        {
+          "decorator": {
+            "operation": "ingress UnknownHttpMethodForPath_/this-is-short-uri-template"
+          },
+          "directResponse": {
+            "body": {
+              "inlineString": "The current request is matched to the defined url template \"/this-is-short-uri-template\" but its http method is not allowed"
             },
             "status": 405
           },
@@ -4125,14 +4422,87 @@ func TestMakeRouteConfigForCors(t *testing.T) {
 	}
 }
 
-func TestHeadersToAdd(t *testing.T) {
+func TestMakeCorsExposeHeaders(t *testing.T) {
 	testData := []struct {
 		desc                  string
-		addRequestHeaders     string
-		appendRequestHeaders  string
-		addResponseHeaders    string
-		appendResponseHeaders string
-		wantedError           string
+		corsExposeHeaders     string
+		grpcWebExposeTrailers string
+		grpcSupportRequired   bool
+		skipGrpcWebFilter     bool
+		wantExposeHeaders     string
+		wantError             string
+	}{
+		{
+			desc:              "No trailers to expose",
+			corsExposeHeaders: "Content-Length",
+			wantExposeHeaders: "Content-Length",
+		},
+		{
+			desc:                  "Trailers are exposed to gRPC-Web clients",
+			corsExposeHeaders:     "Content-Length,Grpc-Status",
+			grpcWebExposeTrailers: " X-Request-Cost ,x-quota-remaining,x-request-cost",
+			grpcSupportRequired:   true,
+			wantExposeHeaders:     "Content-Length,Grpc-Status,grpc-message,x-request-cost,x-quota-remaining",
+		},
+		{
+			desc:                  "Trailers are not exposed for HTTP backends",
+			grpcWebExposeTrailers: "x-request-cost",
+		},
+		{
+			desc:                  "Trailers are not exposed without the gRPC-Web filter",
+			grpcWebExposeTrailers: "x-request-cost",
+			grpcSupportRequired:   true,
+			skipGrpcWebFilter:     true,
+		},
+		{
+			desc:                  "Invalid metadata key",
+			grpcWebExposeTrailers: "x request cost",
+			grpcSupportRequired:   true,
+			wantError:             `invalid grpc_web_expose_trailers: "x request cost" is not a valid custom gRPC metadata key`,
+		},
+		{
+			desc:                  "Reserved metadata key",
+			grpcWebExposeTrailers: "grpc-timeout",
+			grpcSupportRequired:   true,
+			wantError:             `invalid grpc_web_expose_trailers: "grpc-timeout" is not a valid custom gRPC metadata key`,
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.CorsExposeHeaders = tc.corsExposeHeaders
+			opts.GrpcWebExposeTrailers = tc.grpcWebExposeTrailers
+			opts.SkipGrpcWebFilter = tc.skipGrpcWebFilter
+
+			got, err := makeCorsExposeHeaders(&configinfo.ServiceInfo{
+				Options:             opts,
+				GrpcSupportRequired: tc.grpcSupportRequired,
+			})
+			if err != nil {
+				if err.Error() != tc.wantError {
+					t.Fatalf("got error: %v, want error: %s", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("got no error, want error: %s", tc.wantError)
+			}
+			if got != tc.wantExposeHeaders {
+				t.Errorf("got expose headers: %s, want: %s", got, tc.wantExposeHeaders)
+			}
+		})
+	}
+}
+
+func TestHeadersToAdd(t *testing.T) {
+	testData := []struct {
+		desc                  string
+		addRequestHeaders     string
+		appendRequestHeaders  string
+		addResponseHeaders    string
+		appendResponseHeaders string
+		wantedError           string
 		wantedRequestHeaders  []*corepb.HeaderValueOption
 		wantedResponseHeaders []*corepb.HeaderValueOption
 	}{
@@ -4278,3 +4648,943 @@ func getOverSizeRegexForTest() string {
 	}
 	return overSizeRegex
 }
+
+func TestMakeOperationVirtualClusters(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "Echo",
+					},
+					{
+						Name: "GetShelf",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: fmt.Sprintf("%s.Echo", testApiName),
+					Pattern: &annotationspb.HttpRule_Post{
+						Post: "/echo",
+					},
+				},
+				{
+					Selector: fmt.Sprintf("%s.GetShelf", testApiName),
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/shelves/{shelf}",
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc                 string
+		enableOperationStats bool
+		wantVirtualClusters  string
+	}{
+		{
+			desc:                "Operation stats are disabled",
+			wantVirtualClusters: `{}`,
+		},
+		{
+			desc:                 "Operation stats are enabled",
+			enableOperationStats: true,
+			wantVirtualClusters: `
+{
+  "virtualClusters": [
+    {
+      "headers": [
+        {
+          "name": ":path",
+          "safeRegexMatch": {
+            "googleRe2": {},
+            "regex": "^/echo(\\?.*)?$"
+          }
+        },
+        {
+          "name": ":method",
+          "stringMatch": {
+            "exact": "POST"
+          }
+        }
+      ],
+      "name": "endpoints_examples_bookstore_Bookstore_Echo"
+    },
+    {
+      "headers": [
+        {
+          "name": ":path",
+          "safeRegexMatch": {
+            "googleRe2": {},
+            "regex": "^/echo/(\\?.*)?$"
+          }
+        },
+        {
+          "name": ":method",
+          "stringMatch": {
+            "exact": "POST"
+          }
+        }
+      ],
+      "name": "endpoints_examples_bookstore_Bookstore_Echo"
+    },
+    {
+      "headers": [
+        {
+          "name": ":path",
+          "safeRegexMatch": {
+            "googleRe2": {},
+            "regex": "^/shelves/[^\\/]+\\/?(\\?.*)?$"
+          }
+        },
+        {
+          "name": ":method",
+          "stringMatch": {
+            "exact": "GET"
+          }
+        }
+      ],
+      "name": "endpoints_examples_bookstore_Bookstore_GetShelf"
+    }
+  ]
+}`,
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.EnableOperationStats = tc.enableOperationStats
+			fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gotRoute, err := makeRouteConfig(fakeServiceInfo)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			marshaler := &jsonpb.Marshaler{}
+			gotConfig, err := marshaler.MarshalToString(&routepb.VirtualHost{
+				VirtualClusters: gotRoute.GetVirtualHosts()[0].GetVirtualClusters(),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := util.JsonEqual(tc.wantVirtualClusters, gotConfig); err != nil {
+				t.Errorf("makeRouteConfig failed, \n %v", err)
+			}
+		})
+	}
+}
+
+func TestMakeMaintenanceRoutes(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "Echo",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: fmt.Sprintf("%s.Echo", testApiName),
+					Pattern: &annotationspb.HttpRule_Post{
+						Post: "/echo",
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc       string
+		retryAfter time.Duration
+		wantRoute  string
+	}{
+		{
+			desc:       "Maintenance with Retry-After",
+			retryAfter: 90 * time.Second,
+			wantRoute: `
+{
+  "decorator": {
+    "operation": "ingress Echo"
+  },
+  "directResponse": {
+    "body": {
+      "inlineString": "The current request is not available, the API is under maintenance."
+    },
+    "status": 503
+  },
+  "match": {
+    "headers": [
+      {
+        "name": ":method",
+        "stringMatch": {
+          "exact": "POST"
+        }
+      }
+    ],
+    "path": "/echo"
+  },
+  "name": "endpoints.examples.bookstore.Bookstore.Echo",
+  "responseHeadersToAdd": [
+    {
+      "header": {
+        "key": "Retry-After",
+        "value": "90"
+      }
+    }
+  ]
+}`,
+		},
+		{
+			desc: "Maintenance without Retry-After",
+			wantRoute: `
+{
+  "decorator": {
+    "operation": "ingress Echo"
+  },
+  "directResponse": {
+    "body": {
+      "inlineString": "The current request is not available, the API is under maintenance."
+    },
+    "status": 503
+  },
+  "match": {
+    "headers": [
+      {
+        "name": ":method",
+        "stringMatch": {
+          "exact": "POST"
+        }
+      }
+    ],
+    "path": "/echo"
+  },
+  "name": "endpoints.examples.bookstore.Bookstore.Echo"
+}`,
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.MaintenanceSelectors = "*"
+			opts.MaintenanceRetryAfter = tc.retryAfter
+			fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			backendRoutes, _, err := MakeRouteTable(fakeServiceInfo)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			marshaler := &jsonpb.Marshaler{}
+			gotRoute, err := marshaler.MarshalToString(backendRoutes[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := util.JsonEqual(tc.wantRoute, gotRoute); err != nil {
+				t.Errorf("MakeRouteTable failed, \n %v", err)
+			}
+		})
+	}
+}
+
+func TestMakeFeatureGateRoutes(t *testing.T) {
+	testData := []struct {
+		desc           string
+		featureGate    string
+		wantMatches    []string
+		wantGateStatus uint32
+	}{
+		{
+			desc:        "Percentage of the requests let through",
+			featureGate: `{"percent": 10}`,
+			wantMatches: []string{`
+{
+  "headers": [
+    {
+      "name": ":method",
+      "stringMatch": {
+        "exact": "POST"
+      }
+    }
+  ],
+  "path": "/echo",
+  "runtimeFraction": {
+    "defaultValue": {
+      "numerator": 10
+    },
+    "runtimeKey": "espv2.feature_gates.1.echo_endpoints.Echo"
+  }
+}`, `
+{
+  "headers": [
+    {
+      "name": ":method",
+      "stringMatch": {
+        "exact": "POST"
+      }
+    }
+  ],
+  "path": "/echo"
+}`,
+			},
+			wantGateStatus: 404,
+		},
+		{
+			desc:        "Closed gate rejects all the requests unless overridden by the runtime key",
+			featureGate: `{"percent": 0, "status": 503}`,
+			wantMatches: []string{`
+{
+  "headers": [
+    {
+      "name": ":method",
+      "stringMatch": {
+        "exact": "POST"
+      }
+    }
+  ],
+  "path": "/echo",
+  "runtimeFraction": {
+    "defaultValue": {},
+    "runtimeKey": "espv2.feature_gates.1.echo_endpoints.Echo"
+  }
+}`, `
+{
+  "headers": [
+    {
+      "name": ":method",
+      "stringMatch": {
+        "exact": "POST"
+      }
+    }
+  ],
+  "path": "/echo"
+}`,
+			},
+			wantGateStatus: 503,
+		},
+		{
+			desc:        "Open gate lets all the requests through unless overridden by the runtime key",
+			featureGate: `{"windows": ["00:00-12:00", "12:00-00:00"]}`,
+			wantMatches: []string{`
+{
+  "headers": [
+    {
+      "name": ":method",
+      "stringMatch": {
+        "exact": "POST"
+      }
+    }
+  ],
+  "path": "/echo",
+  "runtimeFraction": {
+    "defaultValue": {
+      "numerator": 100
+    },
+    "runtimeKey": "espv2.feature_gates.1.echo_endpoints.Echo"
+  }
+}`, `
+{
+  "headers": [
+    {
+      "name": ":method",
+      "stringMatch": {
+        "exact": "POST"
+      }
+    }
+  ],
+  "path": "/echo"
+}`,
+			},
+			wantGateStatus: 404,
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeServiceConfig, err := configinfo.ServiceConfigFromOpenAPI([]byte(`{
+  "swagger": "2.0",
+  "info": {"title": "Echo", "version": "1.0.0"},
+  "host": "echo.endpoints",
+  "paths": {"/echo": {"post": {"operationId": "echo", "x-google-feature-gate": ` + tc.featureGate + `}}}
+}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := options.DefaultConfigGeneratorOptions()
+			fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			backendRoutes, _, err := MakeRouteTable(fakeServiceInfo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The routes of the exact path, followed by the ones of the path with
+			// the trailing slash.
+			if len(backendRoutes) != 2*len(tc.wantMatches) {
+				t.Fatalf("got %d routes, want: %d", len(backendRoutes), 2*len(tc.wantMatches))
+			}
+			backendRoutes = backendRoutes[:len(tc.wantMatches)]
+
+			marshaler := &jsonpb.Marshaler{}
+			for i, r := range backendRoutes {
+				gotMatch, err := marshaler.MarshalToString(r.GetMatch())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := util.JsonEqual(tc.wantMatches[i], gotMatch); err != nil {
+					t.Errorf("MakeRouteTable route %d failed, \n %v", i, err)
+				}
+			}
+
+			gotGateStatus := backendRoutes[len(backendRoutes)-1].GetDirectResponse().GetStatus()
+			if gotGateStatus != tc.wantGateStatus {
+				t.Errorf("got feature gate status: %v, want: %v", gotGateStatus, tc.wantGateStatus)
+			}
+		})
+	}
+}
+
+func TestMakeApiMetadataRoute(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name:  testProjectName,
+		Title: "Bookstore",
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+			},
+		},
+		Documentation: &confpb.Documentation{
+			Summary:              "A simple bookstore API.",
+			DocumentationRootUrl: "https://bookstore.example.com/docs",
+		},
+	}
+
+	testData := []struct {
+		desc            string
+		apiMetadataPath string
+		wantRoute       string
+		wantError       string
+	}{
+		{
+			desc:            "Metadata served at the well-known path",
+			apiMetadataPath: "/.well-known/api-metadata",
+			wantRoute: `
+{
+  "decorator": {
+    "operation": "ingress ApiMetadata"
+  },
+  "directResponse": {
+    "body": {
+      "inlineString": "{\"name\":\"bookstore.endpoints.project123.cloud.goog\",\"title\":\"Bookstore\",\"config_id\":\"2019-03-02r0\",\"apis\":[\"endpoints.examples.bookstore.Bookstore\"],\"summary\":\"A simple bookstore API.\",\"documentation_root_url\":\"https://bookstore.example.com/docs\"}"
+    },
+    "status": 200
+  },
+  "match": {
+    "headers": [
+      {
+        "name": ":method",
+        "stringMatch": {
+          "exact": "GET"
+        }
+      }
+    ],
+    "path": "/.well-known/api-metadata"
+  },
+  "responseHeadersToAdd": [
+    {
+      "append": false,
+      "header": {
+        "key": "content-type",
+        "value": "application/json"
+      }
+    }
+  ]
+}`,
+		},
+		{
+			desc:            "Relative path is rejected",
+			apiMetadataPath: "api-metadata",
+			wantError:       "invalid api metadata path: api-metadata, should start with '/'",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.ApiMetadataPath = tc.apiMetadataPath
+			fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			route, err := makeApiMetadataRoute(fakeServiceInfo)
+			if tc.wantError != "" {
+				if err == nil || err.Error() != tc.wantError {
+					t.Fatalf("got error: %v, want: %v", err, tc.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			marshaler := &jsonpb.Marshaler{}
+			gotRoute, err := marshaler.MarshalToString(route)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := util.JsonEqual(tc.wantRoute, gotRoute); err != nil {
+				t.Errorf("makeApiMetadataRoute failed, \n %v", err)
+			}
+		})
+	}
+}
+
+func TestMakeHostAuthVirtualHosts(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "Echo",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: fmt.Sprintf("%s.Echo", testApiName),
+					Pattern: &annotationspb.HttpRule_Post{
+						Post: "/echo",
+					},
+				},
+			},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "public_auth",
+					Issuer:  "https://public.example.com",
+					JwksUri: "https://public.example.com/jwks",
+				},
+				{
+					Id:      "partner_auth",
+					Issuer:  "https://partner.example.com",
+					JwksUri: "https://partner.example.com/jwks",
+				},
+			},
+			Rules: []*confpb.AuthenticationRule{
+				{
+					Selector: fmt.Sprintf("%s.Echo", testApiName),
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "public_auth",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.SkipServiceControlFilter = true
+	opts.JwtClaimRequirements = fmt.Sprintf("%s.Echo=scope:echo", testApiName)
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeServiceInfo.HostAuthRequirements = map[string]map[string][]*confpb.AuthRequirement{
+		"partner.example.com": {
+			fmt.Sprintf("%s.Echo", testApiName): {
+				{
+					ProviderId: "partner_auth",
+				},
+			},
+		},
+		"public.example.com": {
+			fmt.Sprintf("%s.Echo", testApiName): {},
+		},
+	}
+	filterGenerators, err := filterconfig.MakeFilterGenerators(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetFilterConfigAndAddPerRouteConfigGen(fakeServiceInfo, filterGenerators); err != nil {
+		t.Fatal(err)
+	}
+
+	gotRoute, err := makeRouteConfig(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantVirtualHosts := []struct {
+		name                string
+		domains             []string
+		wantRequirementName string
+		wantClaims          bool
+	}{
+		{
+			name:                "backend_partner_example_com",
+			domains:             []string{"partner.example.com", "partner.example.com:*"},
+			wantRequirementName: fmt.Sprintf("%s.Echo@partner.example.com", testApiName),
+			wantClaims:          true,
+		},
+		{
+			// No JWT claims to check without the JWT.
+			name:    "backend_public_example_com",
+			domains: []string{"public.example.com", "public.example.com:*"},
+		},
+		{
+			name:                "backend",
+			domains:             []string{"*"},
+			wantRequirementName: fmt.Sprintf("%s.Echo", testApiName),
+			wantClaims:          true,
+		},
+	}
+	if len(gotRoute.GetVirtualHosts()) != len(wantVirtualHosts) {
+		t.Fatalf("got %d virtual hosts, want %d", len(gotRoute.GetVirtualHosts()), len(wantVirtualHosts))
+	}
+	for i, want := range wantVirtualHosts {
+		vh := gotRoute.GetVirtualHosts()[i]
+		if vh.GetName() != want.name || strings.Join(vh.GetDomains(), ",") != strings.Join(want.domains, ",") {
+			t.Errorf("got virtual host %s with domains %v, want %s with domains %v", vh.GetName(), vh.GetDomains(), want.name, want.domains)
+		}
+
+		var gotRequirementName string
+		if jwtConfig := vh.GetRoutes()[0].GetTypedPerFilterConfig()[util.JwtAuthn]; jwtConfig != nil {
+			jwtPerRoute := &jwtpb.PerRouteConfig{}
+			if err := ptypes.UnmarshalAny(jwtConfig, jwtPerRoute); err != nil {
+				t.Fatal(err)
+			}
+			gotRequirementName = jwtPerRoute.GetRequirementName()
+		}
+		if gotRequirementName != want.wantRequirementName {
+			t.Errorf("virtual host %s: got jwt requirement name: %q, want: %q", vh.GetName(), gotRequirementName, want.wantRequirementName)
+		}
+		if _, gotClaims := vh.GetRoutes()[0].GetTypedPerFilterConfig()[util.RBAC]; gotClaims != want.wantClaims {
+			t.Errorf("virtual host %s: got rbac per-route config: %v, want: %v", vh.GetName(), gotClaims, want.wantClaims)
+		}
+	}
+}
+
+func TestMakeRouteTableBackendRuleDeadlines(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "Echo",
+					},
+					{
+						Name: "Ping",
+					},
+					{
+						Name:              "Watch",
+						RequestStreaming:  true,
+						ResponseStreaming: true,
+					},
+				},
+			},
+		},
+		Backend: &confpb.Backend{
+			Rules: []*confpb.BackendRule{
+				{
+					Selector: fmt.Sprintf("%s.Echo", testApiName),
+					Deadline: 600,
+				},
+				{
+					Selector: fmt.Sprintf("%s.Watch", testApiName),
+					Deadline: 30,
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		operation       string
+		wantTimeout     time.Duration
+		wantIdleTimeout time.Duration
+	}{
+		{
+			// The deadline overrides the default one, the idle timeout is offset
+			// to let the deadline hit first.
+			operation:       fmt.Sprintf("%s.Echo", testApiName),
+			wantTimeout:     600 * time.Second,
+			wantIdleTimeout: 601 * time.Second,
+		},
+		{
+			operation:       fmt.Sprintf("%s.Ping", testApiName),
+			wantTimeout:     util.DefaultResponseDeadline,
+			wantIdleTimeout: util.DefaultIdleTimeout,
+		},
+		{
+			// The deadline of a streaming method is its idle timeout instead.
+			operation:       fmt.Sprintf("%s.Watch", testApiName),
+			wantTimeout:     0,
+			wantIdleTimeout: 30 * time.Second,
+		},
+	}
+
+	// The grpc backend gets the routes of all the methods.
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendAddress = "grpc://127.0.0.1:80"
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backendRoutes, _, err := MakeRouteTable(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.operation, func(t *testing.T) {
+			var found bool
+			for _, r := range backendRoutes {
+				if r.GetName() != tc.operation {
+					continue
+				}
+				found = true
+				if got := r.GetRoute().GetTimeout().AsDuration(); got != tc.wantTimeout {
+					t.Errorf("route %s got timeout: %v, want: %v", r.GetMatch(), got, tc.wantTimeout)
+				}
+				if got := r.GetRoute().GetIdleTimeout().AsDuration(); got != tc.wantIdleTimeout {
+					t.Errorf("route %s got idle timeout: %v, want: %v", r.GetMatch(), got, tc.wantIdleTimeout)
+				}
+			}
+			if !found {
+				t.Errorf("no route of operation %s", tc.operation)
+			}
+		})
+	}
+}
+
+func TestMakeRouteTableBackendCredentials(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "Echo",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: fmt.Sprintf("%s.Echo", testApiName),
+					Pattern: &annotationspb.HttpRule_Post{
+						Post: "/echo",
+					},
+				},
+			},
+		},
+	}
+
+	credential := "type=api_key,header=x-backend-key,key_file=/etc/key"
+	testData := []struct {
+		desc             string
+		credentialValues map[string]string
+		wantHeader       *corepb.HeaderValueOption
+		wantError        string
+	}{
+		{
+			desc: "Credential resolved by the config manager",
+			credentialValues: map[string]string{
+				credential: "backend-key",
+			},
+			wantHeader: &corepb.HeaderValueOption{
+				Header: &corepb.HeaderValue{
+					Key:   "x-backend-key",
+					Value: "backend-key",
+				},
+				Append: &wrapperspb.BoolValue{
+					Value: false,
+				},
+			},
+		},
+		{
+			desc:      "Credential not resolved",
+			wantError: fmt.Sprintf("backend credential for operation (%s.Echo) is not resolved, it is only supported by the config manager", testApiName),
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.BackendCredentials = fmt.Sprintf("%s.Echo=%s", testApiName, credential)
+			fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fakeServiceInfo.BackendCredentialValues = tc.credentialValues
+
+			backendRoutes, _, err := MakeRouteTable(fakeServiceInfo)
+			if tc.wantError != "" {
+				if err == nil || err.Error() != tc.wantError {
+					t.Fatalf("got error: %v, want error: %s", err, tc.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var found bool
+			for _, header := range backendRoutes[0].GetRequestHeadersToAdd() {
+				if proto.Equal(header, tc.wantHeader) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("got request headers: %v, want header: %v", backendRoutes[0].GetRequestHeadersToAdd(), tc.wantHeader)
+			}
+		})
+	}
+}
+
+func TestMakeHostBackendVirtualHosts(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "Echo",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: fmt.Sprintf("%s.Echo", testApiName),
+					Pattern: &annotationspb.HttpRule_Post{
+						Post: "/echo",
+					},
+				},
+			},
+		},
+	}
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendAddress = "http://127.0.0.1:8082"
+	opts.Domains = "api.example.com, *.Example.net, api.example.com"
+	opts.HostBackends = "partner.example.com=http://127.0.0.1:8083"
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotRoute, err := makeRouteConfig(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantVirtualHosts := []struct {
+		name        string
+		domains     []string
+		wantCluster string
+	}{
+		{
+			name:        "backend_partner_example_com",
+			domains:     []string{"partner.example.com", "partner.example.com:*"},
+			wantCluster: "backend-cluster-bookstore.endpoints.project123.cloud.goog_local_partner.example.com",
+		},
+		{
+			name:        "backend",
+			domains:     []string{"api.example.com", "api.example.com:*", "*.example.net"},
+			wantCluster: "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
+		},
+	}
+	if len(gotRoute.GetVirtualHosts()) != len(wantVirtualHosts) {
+		t.Fatalf("got %d virtual hosts, want %d", len(gotRoute.GetVirtualHosts()), len(wantVirtualHosts))
+	}
+	for i, want := range wantVirtualHosts {
+		vh := gotRoute.GetVirtualHosts()[i]
+		if vh.GetName() != want.name || strings.Join(vh.GetDomains(), ",") != strings.Join(want.domains, ",") {
+			t.Errorf("got virtual host %s with domains %v, want %s with domains %v", vh.GetName(), vh.GetDomains(), want.name, want.domains)
+		}
+		if got := vh.GetRoutes()[0].GetRoute().GetCluster(); got != want.wantCluster {
+			t.Errorf("virtual host %s: got cluster %q, want %q", vh.GetName(), got, want.wantCluster)
+		}
+	}
+
+	clusters, err := MakeClusters(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotHostCluster bool
+	for _, c := range clusters {
+		if c.GetName() == wantVirtualHosts[0].wantCluster {
+			gotHostCluster = true
+		}
+	}
+	if !gotHostCluster {
+		t.Errorf("cluster %q is not generated", wantVirtualHosts[0].wantCluster)
+	}
+}
+
+func TestMakeHostVirtualHostsWithDomains(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "Echo",
+					},
+				},
+			},
+		},
+	}
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendAddress = "http://127.0.0.1:8082"
+	opts.Domains = "api.example.com,partner.example.com"
+	opts.HostBackends = "partner.example.com=http://127.0.0.1:8083"
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantError := "domain partner.example.com has its own virtual host for --host_backends or x-google-host-security, it cannot also be in --domains"
+	if _, err := makeRouteConfig(fakeServiceInfo); err == nil || err.Error() != wantError {
+		t.Errorf("got error: %v, want error: %s", err, wantError)
+	}
+}
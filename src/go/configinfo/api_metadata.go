@@ -0,0 +1,80 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"encoding/json"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+)
+
+// ApiMetadata is the discovery metadata of the service, pulled by the
+// developer portals and the API catalogs from the running proxy.
+type ApiMetadata struct {
+	Name                 string             `json:"name"`
+	Title                string             `json:"title"`
+	ConfigId             string             `json:"config_id"`
+	Apis                 []string           `json:"apis,omitempty"`
+	Summary              string             `json:"summary,omitempty"`
+	Overview             string             `json:"overview,omitempty"`
+	DocumentationRootUrl string             `json:"documentation_root_url,omitempty"`
+	ServiceRootUrl       string             `json:"service_root_url,omitempty"`
+	Pages                []*ApiMetadataPage `json:"pages,omitempty"`
+}
+
+// ApiMetadataPage is a documentation page, the page contents are left out.
+type ApiMetadataPage struct {
+	Name     string             `json:"name"`
+	Subpages []*ApiMetadataPage `json:"subpages,omitempty"`
+}
+
+// MakeApiMetadata renders the title and the documentation section of the
+// service config as the discovery metadata.
+func (s *ServiceInfo) MakeApiMetadata() *ApiMetadata {
+	doc := s.serviceConfig.GetDocumentation()
+	metadata := &ApiMetadata{
+		Name:                 s.Name,
+		Title:                s.serviceConfig.GetTitle(),
+		ConfigId:             s.ConfigID,
+		Summary:              doc.GetSummary(),
+		Overview:             doc.GetOverview(),
+		DocumentationRootUrl: doc.GetDocumentationRootUrl(),
+		ServiceRootUrl:       doc.GetServiceRootUrl(),
+		Pages:                makeApiMetadataPages(doc.GetPages()),
+	}
+	if metadata.Title == "" {
+		metadata.Title = s.Name
+	}
+	for _, api := range s.serviceConfig.GetApis() {
+		metadata.Apis = append(metadata.Apis, api.GetName())
+	}
+	return metadata
+}
+
+// MakeApiMetadataJson renders MakeApiMetadata in JSON.
+func (s *ServiceInfo) MakeApiMetadataJson() ([]byte, error) {
+	return json.Marshal(s.MakeApiMetadata())
+}
+
+func makeApiMetadataPages(pages []*confpb.Page) []*ApiMetadataPage {
+	var metadataPages []*ApiMetadataPage
+	for _, page := range pages {
+		metadataPages = append(metadataPages, &ApiMetadataPage{
+			Name:     page.GetName(),
+			Subpages: makeApiMetadataPages(page.GetSubpages()),
+		})
+	}
+	return metadataPages
+}
@@ -0,0 +1,128 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestMakeApiMetadataJson(t *testing.T) {
+	testData := []struct {
+		desc              string
+		fakeServiceConfig *confpb.Service
+		wantMetadata      string
+	}{
+		{
+			desc: "Documentation section with nested pages",
+			fakeServiceConfig: &confpb.Service{
+				Name:  "bookstore.endpoints.project123.cloud.goog",
+				Title: "Bookstore",
+				Apis: []*apipb.Api{
+					{
+						Name: "endpoints.examples.bookstore.Bookstore",
+					},
+					{
+						Name: "endpoints.examples.bookstore.Library",
+					},
+				},
+				Documentation: &confpb.Documentation{
+					Summary:              "A simple bookstore API.",
+					Overview:             "Manages the shelves and the books.",
+					DocumentationRootUrl: "https://bookstore.example.com/docs",
+					ServiceRootUrl:       "https://bookstore.example.com",
+					Pages: []*confpb.Page{
+						{
+							Name:    "Tutorial",
+							Content: "(== include tutorial.md ==)",
+							Subpages: []*confpb.Page{
+								{
+									Name: "Java",
+								},
+							},
+						},
+					},
+				},
+			},
+			wantMetadata: `
+{
+  "name": "bookstore.endpoints.project123.cloud.goog",
+  "title": "Bookstore",
+  "config_id": "2019-03-02r0",
+  "apis": [
+    "endpoints.examples.bookstore.Bookstore",
+    "endpoints.examples.bookstore.Library"
+  ],
+  "summary": "A simple bookstore API.",
+  "overview": "Manages the shelves and the books.",
+  "documentation_root_url": "https://bookstore.example.com/docs",
+  "service_root_url": "https://bookstore.example.com",
+  "pages": [
+    {
+      "name": "Tutorial",
+      "subpages": [
+        {
+          "name": "Java"
+        }
+      ]
+    }
+  ]
+}`,
+		},
+		{
+			desc: "No documentation section",
+			fakeServiceConfig: &confpb.Service{
+				Name: "bookstore.endpoints.project123.cloud.goog",
+				Apis: []*apipb.Api{
+					{
+						Name: "endpoints.examples.bookstore.Bookstore",
+					},
+				},
+			},
+			wantMetadata: `
+{
+  "name": "bookstore.endpoints.project123.cloud.goog",
+  "title": "bookstore.endpoints.project123.cloud.goog",
+  "config_id": "2019-03-02r0",
+  "apis": [
+    "endpoints.examples.bookstore.Bookstore"
+  ]
+}`,
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			s, err := NewServiceInfoFromServiceConfig(tc.fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := s.MakeApiMetadataJson()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := util.JsonEqual(tc.wantMetadata, string(got)); err != nil {
+				t.Errorf("MakeApiMetadataJson failed, \n %v", err)
+			}
+		})
+	}
+}
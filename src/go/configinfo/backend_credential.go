@@ -0,0 +1,149 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+const (
+	ApiKeyBackendCredential = "api_key"
+	OAuth2BackendCredential = "oauth2"
+)
+
+// BackendCredential is the credential the proxy attaches to the requests to a
+// non-Google backend, instead of a Google ID token.
+type BackendCredential struct {
+	// The credential as specified, identifies the credentials shared by the
+	// operations.
+	Id string
+	// One of api_key and oauth2.
+	Type string
+	// The request header carrying the credential.
+	Header string
+
+	// The file of the static API key.
+	KeyFile string
+
+	// The OAuth client credentials grant, the client secret is read from the
+	// file.
+	TokenUrl         string
+	ClientId         string
+	ClientSecretFile string
+	Scopes           []string
+}
+
+// parseBackendCredential parses the comma separated KEY=VALUE fields of a
+// credential, e.g. "type=api_key,header=x-api-key,key_file=/etc/key" or
+// "type=oauth2,token_url=https://example.com/token,client_id=proxy,client_secret_file=/etc/secret,scopes=read write".
+func parseBackendCredential(spec string) (*BackendCredential, error) {
+	c := &BackendCredential{
+		Id: strings.TrimSpace(spec),
+	}
+	for _, field := range strings.Split(spec, ",") {
+		keyValue := strings.SplitN(field, "=", 2)
+		if len(keyValue) != 2 {
+			return nil, fmt.Errorf("invalid field %q, should be in KEY=VALUE format", field)
+		}
+		value := strings.TrimSpace(keyValue[1])
+		switch key := strings.TrimSpace(keyValue[0]); key {
+		case "type":
+			c.Type = value
+		case "header":
+			c.Header = strings.ToLower(value)
+		case "key_file":
+			c.KeyFile = value
+		case "token_url":
+			c.TokenUrl = value
+		case "client_id":
+			c.ClientId = value
+		case "client_secret_file":
+			c.ClientSecretFile = value
+		case "scopes":
+			c.Scopes = strings.Fields(value)
+		default:
+			return nil, fmt.Errorf("unknown field %q", key)
+		}
+	}
+
+	switch c.Type {
+	case ApiKeyBackendCredential:
+		if c.KeyFile == "" {
+			return nil, fmt.Errorf("api_key credential requires key_file")
+		}
+		if c.TokenUrl != "" || c.ClientId != "" || c.ClientSecretFile != "" || len(c.Scopes) > 0 {
+			return nil, fmt.Errorf("api_key credential only takes header and key_file")
+		}
+		if c.Header == "" {
+			c.Header = "x-api-key"
+		}
+	case OAuth2BackendCredential:
+		if c.TokenUrl == "" || c.ClientId == "" || c.ClientSecretFile == "" {
+			return nil, fmt.Errorf("oauth2 credential requires token_url, client_id and client_secret_file")
+		}
+		if u, err := url.Parse(c.TokenUrl); err != nil || u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("invalid token_url %q, should be an https url", c.TokenUrl)
+		}
+		if c.KeyFile != "" {
+			return nil, fmt.Errorf("oauth2 credential does not take key_file")
+		}
+		if c.Header == "" {
+			c.Header = "authorization"
+		}
+	default:
+		return nil, fmt.Errorf(`invalid credential type %q, should be either "api_key" or "oauth2"`, c.Type)
+	}
+	if !httpguts.ValidHeaderFieldName(c.Header) {
+		return nil, fmt.Errorf("invalid credential header %q", c.Header)
+	}
+	return c, nil
+}
+
+// ParseBackendCredentials parses the credentials of --backend_credentials by
+// their ids, regardless of the operations they are attached to.
+func ParseBackendCredentials(spec string) (map[string]*BackendCredential, error) {
+	credentials := make(map[string]*BackendCredential)
+	for _, selectorCredential := range strings.Split(spec, ";") {
+		if selectorCredential == "" {
+			continue
+		}
+		selectorAndCredential := strings.SplitN(selectorCredential, "=", 2)
+		if len(selectorAndCredential) != 2 {
+			return nil, fmt.Errorf("invalid backend credential: %v, should be in selector=credential format", selectorCredential)
+		}
+		credential, err := parseBackendCredential(selectorAndCredential[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid backend credential for operation (%v): %v", strings.TrimSpace(selectorAndCredential[0]), err)
+		}
+		credentials[credential.Id] = credential
+	}
+	return credentials, nil
+}
+
+// BackendCredentials returns the backend credentials of the operations by
+// their ids.
+func (s *ServiceInfo) BackendCredentials() map[string]*BackendCredential {
+	credentials := make(map[string]*BackendCredential)
+	for _, operation := range s.Operations {
+		if c := s.Methods[operation].BackendCredential; c != nil {
+			credentials[c.Id] = c
+		}
+	}
+	return credentials
+}
@@ -0,0 +1,223 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestParseBackendCredential(t *testing.T) {
+	testData := []struct {
+		desc           string
+		spec           string
+		wantCredential *BackendCredential
+		wantError      string
+	}{
+		{
+			desc: "API key with the default header",
+			spec: "type=api_key,key_file=/etc/key",
+			wantCredential: &BackendCredential{
+				Id:      "type=api_key,key_file=/etc/key",
+				Type:    ApiKeyBackendCredential,
+				Header:  "x-api-key",
+				KeyFile: "/etc/key",
+			},
+		},
+		{
+			desc: "API key with a custom header",
+			spec: "type=api_key, header=X-Backend-Key, key_file=/etc/key",
+			wantCredential: &BackendCredential{
+				Id:      "type=api_key, header=X-Backend-Key, key_file=/etc/key",
+				Type:    ApiKeyBackendCredential,
+				Header:  "x-backend-key",
+				KeyFile: "/etc/key",
+			},
+		},
+		{
+			desc: "OAuth client credentials with scopes",
+			spec: "type=oauth2,token_url=https://auth.example.com/token,client_id=proxy,client_secret_file=/etc/secret,scopes=read write",
+			wantCredential: &BackendCredential{
+				Id:               "type=oauth2,token_url=https://auth.example.com/token,client_id=proxy,client_secret_file=/etc/secret,scopes=read write",
+				Type:             OAuth2BackendCredential,
+				Header:           "authorization",
+				TokenUrl:         "https://auth.example.com/token",
+				ClientId:         "proxy",
+				ClientSecretFile: "/etc/secret",
+				Scopes:           []string{"read", "write"},
+			},
+		},
+		{
+			desc:      "API key without the key file",
+			spec:      "type=api_key,header=x-api-key",
+			wantError: "api_key credential requires key_file",
+		},
+		{
+			desc:      "API key with OAuth fields",
+			spec:      "type=api_key,key_file=/etc/key,client_id=proxy",
+			wantError: "api_key credential only takes header and key_file",
+		},
+		{
+			desc:      "OAuth without the client secret",
+			spec:      "type=oauth2,token_url=https://auth.example.com/token,client_id=proxy",
+			wantError: "oauth2 credential requires token_url, client_id and client_secret_file",
+		},
+		{
+			desc:      "OAuth token url not in https",
+			spec:      "type=oauth2,token_url=http://auth.example.com/token,client_id=proxy,client_secret_file=/etc/secret",
+			wantError: `invalid token_url "http://auth.example.com/token", should be an https url`,
+		},
+		{
+			desc:      "Unknown type",
+			spec:      "type=basic,key_file=/etc/key",
+			wantError: `invalid credential type "basic", should be either "api_key" or "oauth2"`,
+		},
+		{
+			desc:      "Unknown field",
+			spec:      "type=api_key,key=abc",
+			wantError: `unknown field "key"`,
+		},
+		{
+			desc:      "Invalid field",
+			spec:      "type=api_key,key_file",
+			wantError: `invalid field "key_file", should be in KEY=VALUE format`,
+		},
+		{
+			desc:      "Invalid header",
+			spec:      "type=api_key,header=x api key,key_file=/etc/key",
+			wantError: `invalid credential header "x api key"`,
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := parseBackendCredential(tc.spec)
+			if err != nil {
+				if err.Error() != tc.wantError {
+					t.Fatalf("got error: %v, want error: %s", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("got no error, want error: %s", tc.wantError)
+			}
+			if !reflect.DeepEqual(got, tc.wantCredential) {
+				t.Errorf("got credential: %+v, want: %+v", got, tc.wantCredential)
+			}
+		})
+	}
+}
+
+func TestProcessBackendCredentials(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+		Backend: &confpb.Backend{
+			Rules: []*confpb.BackendRule{
+				{
+					Selector: testApiName + ".ListShelves",
+					Address:  "https://backend.example.com/shelves",
+					Authentication: &confpb.BackendRule_DisableAuth{
+						DisableAuth: true,
+					},
+				},
+				{
+					Selector: testApiName + ".CreateShelf",
+					Address:  "https://backend.example.com/shelves",
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc            string
+		flag            string
+		wantCredentials map[string]string
+		wantError       string
+	}{
+		{
+			desc: "OAuth token of an operation without the backend auth",
+			flag: testApiName + ".ListShelves=type=oauth2,token_url=https://auth.example.com/token,client_id=proxy,client_secret_file=/etc/secret;",
+			wantCredentials: map[string]string{
+				testApiName + ".ListShelves": "authorization",
+			},
+		},
+		{
+			desc: "API key of an operation with the backend auth",
+			flag: testApiName + ".CreateShelf=type=api_key,key_file=/etc/key",
+			wantCredentials: map[string]string{
+				testApiName + ".CreateShelf": "x-api-key",
+			},
+		},
+		{
+			desc:      "OAuth token conflicting with the backend auth",
+			flag:      testApiName + ".CreateShelf=type=oauth2,token_url=https://auth.example.com/token,client_id=proxy,client_secret_file=/etc/secret",
+			wantError: "backend credential for operation (" + testApiName + ".CreateShelf) conflicts with the backend auth, disable it with disable_auth in the backend rule",
+		},
+		{
+			desc:      "Missing selector",
+			flag:      "type",
+			wantError: "invalid backend credential: type, should be in selector=credential format",
+		},
+		{
+			desc:      "Invalid credential",
+			flag:      testApiName + ".ListShelves=type=api_key",
+			wantError: "invalid backend credential for operation (" + testApiName + ".ListShelves): api_key credential requires key_file",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.BackendCredentials = tc.flag
+			serviceInfo, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				if err.Error() != tc.wantError {
+					t.Fatalf("got error: %v, want error: %s", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("got no error, want error: %s", tc.wantError)
+			}
+			gotCredentials := make(map[string]string)
+			for operation, method := range serviceInfo.Methods {
+				if method.BackendCredential != nil {
+					gotCredentials[operation] = method.BackendCredential.Header
+				}
+			}
+			if !reflect.DeepEqual(gotCredentials, tc.wantCredentials) {
+				t.Errorf("got credential headers: %v, want: %v", gotCredentials, tc.wantCredentials)
+			}
+		})
+	}
+}
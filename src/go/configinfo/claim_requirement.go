@@ -0,0 +1,55 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ClaimRequirement requires a top-level claim of the verified JWT payload to
+// have the value. A string claim has it when it equals the value or has it as
+// one of the space separated words, e.g. the "scope" claim, and a list claim
+// when the value is one of the items.
+type ClaimRequirement struct {
+	Claim string
+	Value string
+}
+
+// parseClaimRequirements parses the comma separated claim requirements of an
+// operation, each in the format of CLAIM:VALUE, e.g.
+// "scope:shelves.write,hd:example.com". All of them are required.
+func parseClaimRequirements(spec string) ([]*ClaimRequirement, error) {
+	var requirements []*ClaimRequirement
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		// The values may have ':', e.g. the issuer URLs.
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("invalid claim requirement %q, should be in CLAIM:VALUE format", item)
+		}
+		requirements = append(requirements, &ClaimRequirement{
+			Claim: strings.TrimSpace(parts[0]),
+			Value: strings.TrimSpace(parts[1]),
+		})
+	}
+	if len(requirements) == 0 {
+		return nil, fmt.Errorf("empty claim requirements")
+	}
+	return requirements, nil
+}
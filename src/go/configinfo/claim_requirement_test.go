@@ -0,0 +1,173 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestParseClaimRequirements(t *testing.T) {
+	testData := []struct {
+		desc             string
+		spec             string
+		wantRequirements []*ClaimRequirement
+		wantError        string
+	}{
+		{
+			desc: "Multiple claims",
+			spec: "scope:shelves.write, iss:https://accounts.example.com",
+			wantRequirements: []*ClaimRequirement{
+				{
+					Claim: "scope",
+					Value: "shelves.write",
+				},
+				{
+					Claim: "iss",
+					Value: "https://accounts.example.com",
+				},
+			},
+		},
+		{
+			desc:      "Missing value",
+			spec:      "scope:",
+			wantError: `invalid claim requirement "scope:", should be in CLAIM:VALUE format`,
+		},
+		{
+			desc:      "Empty",
+			spec:      " , ",
+			wantError: "empty claim requirements",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := parseClaimRequirements(tc.spec)
+			if err != nil {
+				if err.Error() != tc.wantError {
+					t.Fatalf("got error: %v, want error: %s", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("got no error, want error: %s", tc.wantError)
+			}
+			if !reflect.DeepEqual(got, tc.wantRequirements) {
+				t.Errorf("got requirements: %+v, want: %+v", got, tc.wantRequirements)
+			}
+		})
+	}
+}
+
+func TestProcessClaimRequirements(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "auth_provider",
+					Issuer:  "issuer-0",
+					JwksUri: "https://fake-jwks.com",
+				},
+			},
+			Rules: []*confpb.AuthenticationRule{
+				{
+					Selector: testApiName + ".CreateShelf",
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "auth_provider",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc             string
+		flag             string
+		wantRequirements map[string][]*ClaimRequirement
+		wantError        string
+	}{
+		{
+			desc: "Claim requirements of an operation",
+			flag: testApiName + ".CreateShelf=scope:shelves.write;",
+			wantRequirements: map[string][]*ClaimRequirement{
+				testApiName + ".CreateShelf": {
+					{
+						Claim: "scope",
+						Value: "shelves.write",
+					},
+				},
+			},
+		},
+		{
+			desc:      "Missing selector",
+			flag:      "scope:shelves.write",
+			wantError: "invalid jwt claim requirements: scope:shelves.write, should be in selector=requirements format",
+		},
+		{
+			desc:      "Operation without JWT",
+			flag:      testApiName + ".ListShelves=scope:shelves.read",
+			wantError: "invalid jwt claim requirements for operation (" + testApiName + ".ListShelves): the operation does not require a JWT",
+		},
+		{
+			desc:      "Invalid requirements",
+			flag:      testApiName + ".CreateShelf=scope",
+			wantError: `invalid jwt claim requirements for operation (` + testApiName + `.CreateShelf): invalid claim requirement "scope", should be in CLAIM:VALUE format`,
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.DisableOidcDiscovery = true
+			opts.JwtClaimRequirements = tc.flag
+			serviceInfo, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				if err.Error() != tc.wantError {
+					t.Fatalf("got error: %v, want error: %s", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("got no error, want error: %s", tc.wantError)
+			}
+			for operation, method := range serviceInfo.Methods {
+				if !reflect.DeepEqual(method.ClaimRequirements, tc.wantRequirements[operation]) {
+					t.Errorf("got requirements of %s: %+v, want: %+v", operation, method.ClaimRequirements, tc.wantRequirements[operation])
+				}
+			}
+		})
+	}
+}
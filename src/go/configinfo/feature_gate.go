@@ -0,0 +1,142 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// FeatureGate stages the public launch of an operation. The requests not let
+// through the gate are rejected by the proxy.
+type FeatureGate struct {
+	// The percentage of the requests routed to the backend while the gate is
+	// open.
+	Percent uint32
+	// The daily windows in UTC the gate is open in, always open if empty.
+	Windows []DailyWindow
+	// The status of the requests not let through, either 404 or 503.
+	Status int
+}
+
+// DailyWindow is the time of day from Start to End, both since midnight UTC.
+// The window wraps around midnight if End is before Start.
+type DailyWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+func (w DailyWindow) contains(timeOfDay time.Duration) bool {
+	if w.Start <= w.End {
+		return timeOfDay >= w.Start && timeOfDay < w.End
+	}
+	return timeOfDay >= w.Start || timeOfDay < w.End
+}
+
+// OpenPercent returns the percentage of the requests let through at the time.
+func (g *FeatureGate) OpenPercent(now time.Time) uint32 {
+	if len(g.Windows) == 0 {
+		return g.Percent
+	}
+	timeOfDay := timeOfDay(now)
+	for _, w := range g.Windows {
+		if w.contains(timeOfDay) {
+			return g.Percent
+		}
+	}
+	return 0
+}
+
+// NextChange returns the next time a window of the gate opens or closes, or
+// false if the gate has no windows.
+func (g *FeatureGate) NextChange(now time.Time) (time.Time, bool) {
+	if len(g.Windows) == 0 {
+		return time.Time{}, false
+	}
+	timeOfDay := timeOfDay(now)
+	next := day
+	for _, w := range g.Windows {
+		for _, boundary := range []time.Duration{w.Start, w.End} {
+			wait := (boundary - timeOfDay + day) % day
+			if wait == 0 {
+				wait = day
+			}
+			if wait < next {
+				next = wait
+			}
+		}
+	}
+	return now.Add(next), true
+}
+
+func timeOfDay(t time.Time) time.Duration {
+	t = t.UTC()
+	return t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC))
+}
+
+// makeFeatureGate makes the gate of the x-google-feature-gate extension.
+func makeFeatureGate(ext *OpenAPIFeatureGate) (*FeatureGate, error) {
+	gate := &FeatureGate{
+		Percent: 100,
+		Status:  http.StatusNotFound,
+	}
+	if ext.Percent != nil {
+		if *ext.Percent > 100 {
+			return nil, fmt.Errorf("invalid percent %v, should be in [0, 100]", *ext.Percent)
+		}
+		gate.Percent = *ext.Percent
+	}
+	for _, item := range ext.Windows {
+		window, err := parseDailyWindow(item)
+		if err != nil {
+			return nil, err
+		}
+		gate.Windows = append(gate.Windows, window)
+	}
+	if ext.Status != 0 {
+		if ext.Status != http.StatusNotFound && ext.Status != http.StatusServiceUnavailable {
+			return nil, fmt.Errorf("invalid status %v, should be either 404 or 503", ext.Status)
+		}
+		gate.Status = ext.Status
+	}
+	if ext.Percent == nil && len(gate.Windows) == 0 {
+		return nil, fmt.Errorf("empty feature gate, should have a percent or daily windows")
+	}
+	return gate, nil
+}
+
+// parseDailyWindow parses a window in the format of HH:MM-HH:MM.
+func parseDailyWindow(s string) (DailyWindow, error) {
+	times := strings.Split(s, "-")
+	if len(times) != 2 {
+		return DailyWindow{}, fmt.Errorf("invalid daily window %q, should be in HH:MM-HH:MM format", s)
+	}
+	var window DailyWindow
+	for i, boundary := range []*time.Duration{&window.Start, &window.End} {
+		t, err := time.Parse("15:04", strings.TrimSpace(times[i]))
+		if err != nil {
+			return DailyWindow{}, fmt.Errorf("invalid daily window %q, should be in HH:MM-HH:MM format", s)
+		}
+		*boundary = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	if window.Start == window.End {
+		return DailyWindow{}, fmt.Errorf("invalid daily window %q, the start and the end are the same", s)
+	}
+	return window, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFeatureGate(t *testing.T) {
+	gate := &FeatureGate{
+		Percent: 25,
+		Windows: []DailyWindow{
+			{Start: 9 * time.Hour, End: 17 * time.Hour},
+			{Start: 22 * time.Hour, End: 2 * time.Hour},
+		},
+	}
+
+	testData := []struct {
+		desc            string
+		now             time.Time
+		wantOpenPercent uint32
+		wantNextChange  time.Time
+	}{
+		{
+			desc:            "Closed before the first window",
+			now:             time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC),
+			wantOpenPercent: 0,
+			wantNextChange:  time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			desc:            "Open at the start of a window",
+			now:             time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC),
+			wantOpenPercent: 25,
+			wantNextChange:  time.Date(2021, 6, 1, 17, 0, 0, 0, time.UTC),
+		},
+		{
+			desc:            "Open in the window wrapping around midnight",
+			now:             time.Date(2021, 6, 2, 1, 0, 0, 0, time.UTC),
+			wantOpenPercent: 25,
+			wantNextChange:  time.Date(2021, 6, 2, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			desc:            "The windows are in UTC",
+			now:             time.Date(2021, 6, 1, 15, 0, 0, 0, time.FixedZone("UTC-8", -8*3600)),
+			wantOpenPercent: 25,
+			wantNextChange:  time.Date(2021, 6, 2, 2, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := gate.OpenPercent(tc.now); got != tc.wantOpenPercent {
+				t.Errorf("got open percent: %v, want: %v", got, tc.wantOpenPercent)
+			}
+			got, ok := gate.NextChange(tc.now)
+			if !ok || !got.Equal(tc.wantNextChange) {
+				t.Errorf("got next change: %v, want: %v", got, tc.wantNextChange)
+			}
+		})
+	}
+
+	if _, ok := (&FeatureGate{Percent: 10}).NextChange(time.Now()); ok {
+		t.Errorf("gate without windows should never change")
+	}
+}
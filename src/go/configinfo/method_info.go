@@ -38,8 +38,28 @@ type MethodInfo struct {
 	RequireAuth        bool
 	ApiKeyLocations    []*scpb.ApiKeyLocation
 	MetricCosts        []*scpb.MetricCost
+	QuotaTiers         []*scpb.QuotaTier
+	ReportSampling     *scpb.ReportSampling
+	// The requests without a JWT or with a JWT failing the verification are
+	// also allowed.
+	AllowMissingOrFailedJwt bool
 	// All non-unary gRPC methods are considered streaming.
 	IsStreaming bool
+	// The method returns a google.longrunning.Operation.
+	IsLongRunning bool
+	// The requests are rejected with 503 for planned backend downtime.
+	InMaintenance bool
+	// The launch of the method is staged, nil if not gated.
+	FeatureGate *FeatureGate
+	// The HTTP statuses overriding the transcoded gRPC statuses.
+	StatusOverrides []*StatusOverride
+	// The claims of the verified JWT required to call the method.
+	ClaimRequirements []*ClaimRequirement
+	// The credential attached to the requests to a non-Google backend, nil if
+	// not set.
+	BackendCredential *BackendCredential
+	// The max bytes of the request body, 0 if not limited.
+	MaxRequestBytes uint32
 
 	// The request type name (not the entire type URL).
 	RequestTypeName string
@@ -75,6 +95,14 @@ type backendInfo struct {
 	RetryNum             uint
 	RetriableStatusCodes []uint32
 	PerTryTimeout        time.Duration
+
+	// Send a hedged request if the backend does not respond within the
+	// threshold. Only applies to the GET routes.
+	HedgeThreshold time.Duration
+
+	// The maximum size in KiB of the request headers forwarded to the
+	// backend, 0 means no limit.
+	MaxRequestHeadersKb uint32
 }
 
 type SnakeToJsonSegments = map[string]string
@@ -0,0 +1,361 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	scpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/v10/http/service_control"
+)
+
+// OpenAPIDoc is the OpenAPI 2.0 document describing the API surface served by
+// the proxy, with the Google Cloud Endpoints extensions for the JWT providers.
+type OpenAPIDoc struct {
+	Swagger             string                                  `json:"swagger"`
+	Info                OpenAPIInfo                             `json:"info"`
+	Host                string                                  `json:"host,omitempty"`
+	Paths               map[string]map[string]*OpenAPIOperation `json:"paths"`
+	SecurityDefinitions map[string]*OpenAPISecurityScheme       `json:"securityDefinitions,omitempty"`
+
+	// Only read from the OpenAPI documents the service configs are converted
+	// from, see ServiceConfigFromOpenAPI.
+	Security  []map[string][]string `json:"security,omitempty"`
+	Backend   *OpenAPIBackend       `json:"x-google-backend,omitempty"`
+	Allow     string                `json:"x-google-allow,omitempty"`
+	Endpoints []*OpenAPIEndpoint    `json:"x-google-endpoints,omitempty"`
+}
+
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenAPIOperation struct {
+	OperationId string                      `json:"operationId"`
+	Security    []map[string][]string       `json:"security,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+
+	Parameters []*OpenAPIParameter `json:"parameters,omitempty"`
+	Backend    *OpenAPIBackend     `json:"x-google-backend,omitempty"`
+	// The x-google-host-security extension, the security requirements of the
+	// operation for the requests to each hostname, see
+	// ServiceInfo.HostAuthRequirements.
+	HostSecurity map[string][]map[string][]string `json:"x-google-host-security,omitempty"`
+	// The x-google-feature-gate extension, see MethodInfo.FeatureGate.
+	FeatureGate *OpenAPIFeatureGate `json:"x-google-feature-gate,omitempty"`
+	// The x-google-quota-tiers extension, see MethodInfo.QuotaTiers.
+	QuotaTiers []*OpenAPIQuotaTier `json:"x-google-quota-tiers,omitempty"`
+}
+
+// OpenAPIFeatureGate is the x-google-feature-gate extension, staging the
+// launch of an operation, e.g.
+//
+//	"x-google-feature-gate": {"percent": 25, "windows": ["09:00-17:00"]}
+//
+// The operation is open in the daily UTC windows, always if none is set, for
+// the percentage of its requests, 100 if not set. The other requests are
+// rejected with the status, either 404 (the default) or 503. The percentage
+// can be overridden by the Envoy runtime key of util.FeatureGateRuntimeKey.
+type OpenAPIFeatureGate struct {
+	Percent *uint32  `json:"percent,omitempty"`
+	Windows []string `json:"windows,omitempty"`
+	Status  int      `json:"status,omitempty"`
+}
+
+// OpenAPIQuotaTier is an entry of the x-google-quota-tiers extension, charging
+// the consumer projects in the tier with its own metric costs, e.g.
+//
+//	"x-google-quota-tiers": [{"consumerProjectNumbers": ["123456"], "metricCosts": {"paid-requests": 1}}]
+//
+// The metric costs are in the format of the x-google-quota extension. The
+// tiers with different quota limits charge different metrics, each with its
+// own limit in the service config.
+type OpenAPIQuotaTier struct {
+	ConsumerProjectNumbers []string         `json:"consumerProjectNumbers"`
+	MetricCosts            map[string]int64 `json:"metricCosts"`
+}
+
+type OpenAPIParameter struct {
+	Name string `json:"name"`
+	In   string `json:"in"`
+}
+
+// OpenAPIBackend is the x-google-backend extension.
+type OpenAPIBackend struct {
+	Address         string          `json:"address,omitempty"`
+	JwtAudience     string          `json:"jwt_audience,omitempty"`
+	DisableAuth     bool            `json:"disable_auth,omitempty"`
+	PathTranslation string          `json:"path_translation,omitempty"`
+	Protocol        string          `json:"protocol,omitempty"`
+	Deadline        OpenAPIDeadline `json:"deadline,omitempty"`
+}
+
+// OpenAPIDeadline is the deadline in seconds, either as a number or a string.
+type OpenAPIDeadline float64
+
+func (d *OpenAPIDeadline) UnmarshalJSON(b []byte) error {
+	var f float64
+	if err := json.Unmarshal(b, &f); err == nil {
+		*d = OpenAPIDeadline(f)
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(b, &str); err != nil {
+		return fmt.Errorf("deadline should be a number of seconds: %v", err)
+	}
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return fmt.Errorf("invalid deadline %q: %v", str, err)
+	}
+	*d = OpenAPIDeadline(f)
+	return nil
+}
+
+// OpenAPIEndpoint is an entry of the x-google-endpoints extension.
+type OpenAPIEndpoint struct {
+	Name      string `json:"name"`
+	AllowCors bool   `json:"allowCors,omitempty"`
+}
+
+type OpenAPIResponse struct {
+	Description string `json:"description"`
+}
+
+type OpenAPISecurityScheme struct {
+	Type string `json:"type"`
+	// For the API keys.
+	Name string `json:"name,omitempty"`
+	In   string `json:"in,omitempty"`
+	// For the JWT providers.
+	Flow         string               `json:"flow,omitempty"`
+	Issuer       string               `json:"x-google-issuer,omitempty"`
+	JwksUri      string               `json:"x-google-jwks_uri,omitempty"`
+	Audiences    string               `json:"x-google-audiences,omitempty"`
+	JwtLocations []OpenAPIJwtLocation `json:"x-google-jwt-locations,omitempty"`
+}
+
+// OpenAPIJwtLocation is an entry of the x-google-jwt-locations extension, one
+// of the header and the query is set.
+type OpenAPIJwtLocation struct {
+	Header      string `json:"header,omitempty"`
+	Query       string `json:"query,omitempty"`
+	ValuePrefix string `json:"value_prefix,omitempty"`
+}
+
+var (
+	// The methods that can be described by an OpenAPI 2.0 path item.
+	openAPIHttpMethods = map[string]bool{
+		"get":     true,
+		"put":     true,
+		"post":    true,
+		"delete":  true,
+		"options": true,
+		"head":    true,
+		"patch":   true,
+	}
+
+	// The single segment variable bindings are rendered as the OpenAPI path
+	// parameters, e.g. {shelf=*} as {shelf}.
+	singleSegmentVariableRegex = regexp.MustCompile(`\{([^}=]+)=\*\}`)
+
+	defaultApiKeyLocations = []*scpb.ApiKeyLocation{
+		{Key: &scpb.ApiKeyLocation_Query{Query: "key"}},
+		{Key: &scpb.ApiKeyLocation_Query{Query: "api_key"}},
+		{Key: &scpb.ApiKeyLocation_Header{Header: "x-api-key"}},
+	}
+)
+
+// MakeOpenAPIDoc renders the http rules, the auth requirements and the API key
+// requirements enforced by the proxy as an OpenAPI document.
+//
+// The methods generated by the proxy, e.g. the CORS preflight methods, are not
+// included.
+func (s *ServiceInfo) MakeOpenAPIDoc() *OpenAPIDoc {
+	doc := &OpenAPIDoc{
+		Swagger: "2.0",
+		Info: OpenAPIInfo{
+			Title:   s.serviceConfig.GetTitle(),
+			Version: s.ConfigID,
+		},
+		Host:                s.Name,
+		Paths:               make(map[string]map[string]*OpenAPIOperation),
+		SecurityDefinitions: make(map[string]*OpenAPISecurityScheme),
+	}
+	if doc.Info.Title == "" {
+		doc.Info.Title = s.Name
+	}
+
+	for _, provider := range s.serviceConfig.GetAuthentication().GetProviders() {
+		doc.SecurityDefinitions[provider.GetId()] = &OpenAPISecurityScheme{
+			Type:      "oauth2",
+			Flow:      "implicit",
+			Issuer:    provider.GetIssuer(),
+			JwksUri:   provider.GetJwksUri(),
+			Audiences: provider.GetAudiences(),
+		}
+	}
+	// Any of the providers of a rule is accepted, and all the rules of an
+	// operation are required, so each alternative has a provider of every rule.
+	jwtRequirements := make(map[string][][]string)
+	for _, rule := range s.serviceConfig.GetAuthentication().GetRules() {
+		if len(rule.GetRequirements()) == 0 {
+			continue
+		}
+		alternatives, ok := jwtRequirements[rule.GetSelector()]
+		if !ok {
+			alternatives = [][]string{nil}
+		}
+		var combined [][]string
+		for _, alternative := range alternatives {
+			for _, requirement := range rule.GetRequirements() {
+				providers := append(append([]string{}, alternative...), requirement.GetProviderId())
+				combined = append(combined, providers)
+			}
+		}
+		jwtRequirements[rule.GetSelector()] = combined
+	}
+
+	operations := make([]string, 0, len(s.Methods))
+	for operation := range s.Methods {
+		operations = append(operations, operation)
+	}
+	sort.Strings(operations)
+
+	for _, operation := range operations {
+		method := s.Methods[operation]
+		if method.IsGenerated {
+			continue
+		}
+
+		var providers [][]string
+		if method.RequireAuth {
+			providers = jwtRequirements[operation]
+		}
+		var apiKeys []string
+		if !method.AllowUnregisteredCalls && !method.SkipServiceControl {
+			apiKeys = doc.addApiKeyDefinitions(method.ApiKeyLocations)
+		}
+		security := makeOpenAPISecurity(providers, apiKeys)
+
+		var bindings int
+		for _, httpRule := range method.HttpRule {
+			httpMethod := strings.ToLower(httpRule.HttpMethod)
+			if !openAPIHttpMethods[httpMethod] {
+				continue
+			}
+
+			// The operation ids must be unique, the additional bindings are suffixed.
+			operationId := operation
+			if bindings > 0 {
+				operationId = fmt.Sprintf("%s_%d", operation, bindings)
+			}
+			bindings++
+
+			path := singleSegmentVariableRegex.ReplaceAllString(httpRule.UriTemplate.String(), "{$1}")
+			if doc.Paths[path] == nil {
+				doc.Paths[path] = make(map[string]*OpenAPIOperation)
+			}
+			doc.Paths[path][httpMethod] = &OpenAPIOperation{
+				OperationId: operationId,
+				Security:    security,
+				Responses: map[string]*OpenAPIResponse{
+					"default": {
+						Description: "Response from the backend.",
+					},
+				},
+			}
+		}
+	}
+
+	return doc
+}
+
+// MakeOpenAPIJson renders MakeOpenAPIDoc in JSON.
+func (s *ServiceInfo) MakeOpenAPIJson() ([]byte, error) {
+	return json.MarshalIndent(s.MakeOpenAPIDoc(), "", "  ")
+}
+
+// addApiKeyDefinitions adds the security definitions of the API key locations,
+// and returns their names.
+func (doc *OpenAPIDoc) addApiKeyDefinitions(locations []*scpb.ApiKeyLocation) []string {
+	if len(locations) == 0 {
+		locations = defaultApiKeyLocations
+	}
+
+	var names []string
+	for _, location := range locations {
+		scheme := &OpenAPISecurityScheme{
+			Type: "apiKey",
+		}
+		switch location.GetKey().(type) {
+		case *scpb.ApiKeyLocation_Query:
+			scheme.Name = location.GetQuery()
+			scheme.In = "query"
+		case *scpb.ApiKeyLocation_Header:
+			scheme.Name = location.GetHeader()
+			scheme.In = "header"
+		default:
+			// OpenAPI 2.0 can not describe the API keys in cookies.
+			continue
+		}
+
+		name := fmt.Sprintf("api_key_%s_%s", scheme.In, scheme.Name)
+		doc.SecurityDefinitions[name] = scheme
+		names = append(names, name)
+	}
+	return names
+}
+
+// makeOpenAPISecurity combines the JWT providers and the API keys. Any of the
+// alternative sets of providers is accepted, and the API key in any of its
+// locations is required together with it.
+func makeOpenAPISecurity(providers [][]string, apiKeys []string) []map[string][]string {
+	var security []map[string][]string
+	switch {
+	case len(providers) == 0:
+		for _, apiKey := range apiKeys {
+			security = append(security, map[string][]string{apiKey: {}})
+		}
+	case len(apiKeys) == 0:
+		for _, alternative := range providers {
+			security = append(security, makeOpenAPISecurityRequirement(alternative, ""))
+		}
+	default:
+		for _, alternative := range providers {
+			for _, apiKey := range apiKeys {
+				security = append(security, makeOpenAPISecurityRequirement(alternative, apiKey))
+			}
+		}
+	}
+	return security
+}
+
+// makeOpenAPISecurityRequirement requires all the providers, and the API key
+// if not empty.
+func makeOpenAPISecurityRequirement(providers []string, apiKey string) map[string][]string {
+	requirement := make(map[string][]string)
+	for _, provider := range providers {
+		requirement[provider] = []string{}
+	}
+	if apiKey != "" {
+		requirement[apiKey] = []string{}
+	}
+	return requirement
+}
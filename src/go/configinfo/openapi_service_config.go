@@ -0,0 +1,514 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/ptypes"
+
+	anypb "github.com/golang/protobuf/ptypes/any"
+	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	smpb "google.golang.org/genproto/googleapis/api/servicemanagement/v1"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+const (
+	// The x-google-allow value which routes the calls not matching any
+	// operation to the backend.
+	openAPIAllowAll = "all"
+)
+
+var (
+	// The order of the operations of a path item in the converted service
+	// config.
+	openAPIHttpMethodOrder = []string{"get", "put", "post", "delete", "options", "head", "patch"}
+
+	// The methods of the calls not matching any operation, routed with
+	// x-google-allow: all.
+	openAPIUnrecognizedHttpMethods = []string{"Get", "Delete", "Patch", "Post", "Put"}
+
+	invalidNameCharRegex  = regexp.MustCompile(`[^A-Za-z0-9_]`)
+	openAPIPathParamRegex = regexp.MustCompile(`\{([^}]+)\}`)
+)
+
+// ServiceConfigFromOpenAPI converts the OpenAPI 2.0 document in JSON into the
+// service config Service Management generates from it, so the API can be
+// served without being deployed to Service Management first.
+//
+// Only the parts used by the proxy are converted: the http rules, the JWT
+// providers and requirements, the API key requirements, and the backend rules
+// of x-google-backend. The service config has no Service Control environment,
+// as the service is not managed by Service Management. The document itself is
+// the source file of the service config, as in the ones of Service
+// Management, for the extensions read by the proxy, e.g.
+// x-google-host-security.
+func ServiceConfigFromOpenAPI(content []byte) (*confpb.Service, error) {
+	var doc OpenAPIDoc
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("fail to unmarshal the OpenAPI document: %v", err)
+	}
+	if doc.Swagger != "2.0" {
+		return nil, fmt.Errorf("only OpenAPI 2.0 is supported, got swagger version %q", doc.Swagger)
+	}
+	if doc.Host == "" {
+		return nil, fmt.Errorf("host of the OpenAPI document is empty, it is required as the service name")
+	}
+
+	sourceFile, err := ptypes.MarshalAny(&smpb.ConfigFile{
+		FilePath:     "openapi.json",
+		FileContents: content,
+		FileType:     smpb.ConfigFile_OPEN_API_JSON,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fail to marshal the OpenAPI document to Any: %v", err)
+	}
+
+	api := &apipb.Api{
+		Name:    openAPIApiName(&doc),
+		Version: doc.Info.Version,
+	}
+	serviceConfig := &confpb.Service{
+		Name:             doc.Host,
+		Id:               doc.Info.Version,
+		Title:            doc.Info.Title,
+		Apis:             []*apipb.Api{api},
+		Http:             &annotationspb.Http{},
+		Authentication:   &confpb.Authentication{},
+		Usage:            &confpb.Usage{},
+		Backend:          &confpb.Backend{},
+		SystemParameters: &confpb.SystemParameters{},
+		Endpoints: []*confpb.Endpoint{
+			{
+				Name: doc.Host,
+			},
+		},
+		SourceInfo: &confpb.SourceInfo{
+			SourceFiles: []*anypb.Any{sourceFile},
+		},
+	}
+	for _, endpoint := range doc.Endpoints {
+		if endpoint.Name == doc.Host {
+			serviceConfig.Endpoints[0].AllowCors = endpoint.AllowCors
+		}
+	}
+
+	var providerIds []string
+	for id, scheme := range doc.SecurityDefinitions {
+		if scheme.Type == "oauth2" && scheme.Issuer != "" {
+			providerIds = append(providerIds, id)
+		}
+	}
+	sort.Strings(providerIds)
+	for _, id := range providerIds {
+		scheme := doc.SecurityDefinitions[id]
+		jwtLocations, err := convertJwtLocations(scheme.JwtLocations)
+		if err != nil {
+			return nil, fmt.Errorf("security definition %s: %v", id, err)
+		}
+		serviceConfig.Authentication.Providers = append(serviceConfig.Authentication.Providers, &confpb.AuthProvider{
+			Id:           id,
+			Issuer:       scheme.Issuer,
+			JwksUri:      scheme.JwksUri,
+			Audiences:    scheme.Audiences,
+			JwtLocations: jwtLocations,
+		})
+	}
+
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	methodNames := make(map[string]string)
+	for _, path := range paths {
+		for _, httpMethod := range openAPIHttpMethodOrder {
+			operation := doc.Paths[path][httpMethod]
+			if operation == nil {
+				continue
+			}
+			if operation.OperationId == "" {
+				return nil, fmt.Errorf("operation %s %s has no operationId", strings.ToUpper(httpMethod), path)
+			}
+			name := openAPIMethodName(operation.OperationId)
+			if prev, ok := methodNames[name]; ok {
+				return nil, fmt.Errorf("operationId %s conflicts with %s", operation.OperationId, prev)
+			}
+			methodNames[name] = operation.OperationId
+
+			selector := fmt.Sprintf("%s.%s", api.Name, name)
+			api.Methods = append(api.Methods, &apipb.Method{
+				Name:            name,
+				RequestTypeUrl:  util.TypeUrlPrefix + "google.protobuf.Empty",
+				ResponseTypeUrl: util.TypeUrlPrefix + "google.protobuf.Value",
+			})
+
+			httpRule := makeOpenAPIHttpRule(selector, httpMethod, openAPIPathParamRegex.ReplaceAllStringFunc(path, snakeCase))
+			for _, parameter := range operation.Parameters {
+				if parameter.In == "body" {
+					httpRule.Body = parameter.Name
+				}
+			}
+			serviceConfig.Http.Rules = append(serviceConfig.Http.Rules, httpRule)
+
+			security := operation.Security
+			if security == nil {
+				security = doc.Security
+			}
+			if err := addOpenAPISecurity(serviceConfig, selector, security, doc.SecurityDefinitions); err != nil {
+				return nil, fmt.Errorf("operation %s: %v", operation.OperationId, err)
+			}
+
+			// The addresses of the operations are constant by default, and the
+			// top-level address is appended with the paths.
+			backend, defaultPathTranslation := operation.Backend, confpb.BackendRule_CONSTANT_ADDRESS
+			if backend == nil {
+				backend, defaultPathTranslation = doc.Backend, confpb.BackendRule_APPEND_PATH_TO_ADDRESS
+			}
+			backendRule, err := makeOpenAPIBackendRule(selector, backend, defaultPathTranslation)
+			if err != nil {
+				return nil, fmt.Errorf("operation %s: %v", operation.OperationId, err)
+			}
+			serviceConfig.Backend.Rules = append(serviceConfig.Backend.Rules, backendRule)
+		}
+	}
+
+	switch doc.Allow {
+	case "":
+	case openAPIAllowAll:
+		for _, httpMethod := range openAPIUnrecognizedHttpMethods {
+			name := fmt.Sprintf("Google_Autogenerated_Unrecognized_%s_Method_Call", httpMethod)
+			selector := fmt.Sprintf("%s.%s", api.Name, name)
+			api.Methods = append(api.Methods, &apipb.Method{
+				Name:            name,
+				RequestTypeUrl:  util.TypeUrlPrefix + "google.protobuf.Empty",
+				ResponseTypeUrl: util.TypeUrlPrefix + "google.protobuf.Empty",
+			})
+			serviceConfig.Http.Rules = append(serviceConfig.Http.Rules, makeOpenAPIHttpRule(selector, strings.ToLower(httpMethod), "/**"))
+			serviceConfig.Usage.Rules = append(serviceConfig.Usage.Rules, &confpb.UsageRule{
+				Selector:               selector,
+				AllowUnregisteredCalls: true,
+			})
+			backendRule, err := makeOpenAPIBackendRule(selector, doc.Backend, confpb.BackendRule_APPEND_PATH_TO_ADDRESS)
+			if err != nil {
+				return nil, err
+			}
+			serviceConfig.Backend.Rules = append(serviceConfig.Backend.Rules, backendRule)
+		}
+	default:
+		return nil, fmt.Errorf("invalid x-google-allow %q, only %q is supported", doc.Allow, openAPIAllowAll)
+	}
+
+	return serviceConfig, nil
+}
+
+func makeOpenAPIHttpRule(selector, httpMethod, path string) *annotationspb.HttpRule {
+	httpRule := &annotationspb.HttpRule{
+		Selector: selector,
+	}
+	switch httpMethod {
+	case "get":
+		httpRule.Pattern = &annotationspb.HttpRule_Get{Get: path}
+	case "put":
+		httpRule.Pattern = &annotationspb.HttpRule_Put{Put: path}
+	case "post":
+		httpRule.Pattern = &annotationspb.HttpRule_Post{Post: path}
+	case "delete":
+		httpRule.Pattern = &annotationspb.HttpRule_Delete{Delete: path}
+	case "patch":
+		httpRule.Pattern = &annotationspb.HttpRule_Patch{Patch: path}
+	default:
+		httpRule.Pattern = &annotationspb.HttpRule_Custom{
+			Custom: &annotationspb.CustomHttpPattern{
+				Kind: strings.ToUpper(httpMethod),
+				Path: path,
+			},
+		}
+	}
+	return httpRule
+}
+
+// addOpenAPISecurity adds the JWT requirements and the API key requirement of
+// the operation. Any of the security requirements is accepted, and an empty
+// one allows the requests without credentials.
+//
+// The service config requires the JWT, of any of the providers, and the API
+// key independently of each other, so the requirements are only converted if
+// they accept the same requests. e.g. [{jwt}, {api_key}] is rejected, as
+// requiring either a JWT or an API key can not be expressed.
+func addOpenAPISecurity(serviceConfig *confpb.Service, selector string, security []map[string][]string, definitions map[string]*OpenAPISecurityScheme) error {
+	authRule := &confpb.AuthenticationRule{
+		Selector: selector,
+	}
+	apiKeyParameters := &confpb.SystemParameterRule{
+		Selector: selector,
+	}
+	if len(security) == 0 {
+		security = []map[string][]string{{}}
+	}
+
+	// The JWT provider and whether the API key is required, of each
+	// requirement.
+	type alternative struct {
+		providerId string
+		apiKey     bool
+	}
+	var alternatives []alternative
+	providerIds := []string{""}
+	added := make(map[string]bool)
+	for _, requirement := range security {
+		names := make([]string, 0, len(requirement))
+		for name := range requirement {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var alt alternative
+		for _, name := range names {
+			scheme, ok := definitions[name]
+			if !ok {
+				return fmt.Errorf("security requirement %s is not in securityDefinitions", name)
+			}
+
+			switch {
+			case scheme.Type == "apiKey":
+				alt.apiKey = true
+				if added[name] {
+					continue
+				}
+				added[name] = true
+				// The API key in the key query parameter is the default.
+				if scheme.In == "query" && scheme.Name == "key" {
+					continue
+				}
+				parameter := &confpb.SystemParameter{
+					Name: util.ApiKeyParameterName,
+				}
+				switch scheme.In {
+				case "query":
+					parameter.UrlQueryParameter = scheme.Name
+				case "header":
+					parameter.HttpHeader = scheme.Name
+				default:
+					return fmt.Errorf("API key %s in %q is not supported, should be in either query or header", name, scheme.In)
+				}
+				apiKeyParameters.Parameters = append(apiKeyParameters.Parameters, parameter)
+			case scheme.Type == "oauth2" && scheme.Issuer != "":
+				if alt.providerId != "" {
+					return fmt.Errorf("security requirement of both %s and %s is not supported, only one JWT can be required", alt.providerId, name)
+				}
+				alt.providerId = name
+				if added[name] {
+					continue
+				}
+				added[name] = true
+				providerIds = append(providerIds, name)
+				authRule.Requirements = append(authRule.Requirements, &confpb.AuthRequirement{
+					ProviderId: name,
+					Audiences:  scheme.Audiences,
+				})
+			default:
+				return fmt.Errorf("security definition %s of type %s is not supported, should be either an apiKey or an oauth2 with x-google-issuer", name, scheme.Type)
+			}
+		}
+		alternatives = append(alternatives, alt)
+	}
+
+	requireJwt, requireApiKey := true, true
+	for _, alt := range alternatives {
+		requireJwt = requireJwt && alt.providerId != ""
+		requireApiKey = requireApiKey && alt.apiKey
+	}
+	// Check the requests with or without a JWT of each provider, and with or
+	// without an API key.
+	for _, providerId := range providerIds {
+		for _, apiKey := range []bool{false, true} {
+			want := false
+			for _, alt := range alternatives {
+				if (alt.providerId == "" || alt.providerId == providerId) && (!alt.apiKey || apiKey) {
+					want = true
+					break
+				}
+			}
+			got := (!requireJwt || providerId != "") && (!requireApiKey || apiKey)
+			if got != want {
+				return fmt.Errorf("security requirements %v are not supported, the JWT and the API key can only be required independently of each other", security)
+			}
+		}
+	}
+
+	if len(authRule.Requirements) > 0 {
+		authRule.AllowWithoutCredential = !requireJwt
+		serviceConfig.Authentication.Rules = append(serviceConfig.Authentication.Rules, authRule)
+	}
+	if len(apiKeyParameters.Parameters) > 0 {
+		serviceConfig.SystemParameters.Rules = append(serviceConfig.SystemParameters.Rules, apiKeyParameters)
+	}
+	serviceConfig.Usage.Rules = append(serviceConfig.Usage.Rules, &confpb.UsageRule{
+		Selector:               selector,
+		AllowUnregisteredCalls: !requireApiKey,
+	})
+	return nil
+}
+
+// makeOpenAPIBackendRule converts the x-google-backend of the operation.
+// Without the address, the calls are routed to the --backend of the proxy,
+// e.g. the sidecar backend.
+func makeOpenAPIBackendRule(selector string, backend *OpenAPIBackend, defaultPathTranslation confpb.BackendRule_PathTranslation) (*confpb.BackendRule, error) {
+	rule := &confpb.BackendRule{
+		Selector: selector,
+	}
+	if backend == nil {
+		return rule, nil
+	}
+	if backend.Deadline < 0 {
+		return nil, fmt.Errorf("x-google-backend deadline %v is negative", backend.Deadline)
+	}
+	rule.Deadline = float64(backend.Deadline)
+	rule.Protocol = backend.Protocol
+
+	if backend.Address == "" {
+		if backend.JwtAudience != "" || backend.PathTranslation != "" {
+			return nil, fmt.Errorf("x-google-backend jwt_audience and path_translation require the address")
+		}
+		rule.Authentication = &confpb.BackendRule_DisableAuth{DisableAuth: true}
+		return rule, nil
+	}
+	rule.Address = backend.Address
+
+	rule.PathTranslation = defaultPathTranslation
+	if backend.PathTranslation != "" {
+		value, ok := confpb.BackendRule_PathTranslation_value[backend.PathTranslation]
+		if !ok || value == int32(confpb.BackendRule_PATH_TRANSLATION_UNSPECIFIED) {
+			return nil, fmt.Errorf("invalid x-google-backend path_translation %q, should be either APPEND_PATH_TO_ADDRESS or CONSTANT_ADDRESS", backend.PathTranslation)
+		}
+		rule.PathTranslation = confpb.BackendRule_PathTranslation(value)
+	}
+
+	switch {
+	case backend.DisableAuth && backend.JwtAudience != "":
+		return nil, fmt.Errorf("x-google-backend jwt_audience cannot be set with disable_auth")
+	case backend.DisableAuth:
+		rule.Authentication = &confpb.BackendRule_DisableAuth{DisableAuth: true}
+	case backend.JwtAudience != "":
+		rule.Authentication = &confpb.BackendRule_JwtAudience{JwtAudience: backend.JwtAudience}
+	default:
+		// The ID tokens are minted for the address by default.
+		rule.Authentication = &confpb.BackendRule_JwtAudience{JwtAudience: backend.Address}
+	}
+	return rule, nil
+}
+
+// openAPIOperations returns the operations of the OpenAPI documents the
+// service config is generated from, keyed by their selectors, for the
+// extensions having no counterpart in the service config. Only the documents
+// in JSON are read.
+func openAPIOperations(serviceConfig *confpb.Service) (map[string]*OpenAPIOperation, error) {
+	operations := make(map[string]*OpenAPIOperation)
+	for _, sourceFile := range serviceConfig.GetSourceInfo().GetSourceFiles() {
+		configFile := &smpb.ConfigFile{}
+		if err := ptypes.UnmarshalAny(sourceFile, configFile); err != nil || configFile.GetFileType() != smpb.ConfigFile_OPEN_API_JSON {
+			continue
+		}
+
+		var doc OpenAPIDoc
+		if err := json.Unmarshal(configFile.GetFileContents(), &doc); err != nil {
+			return nil, fmt.Errorf("fail to unmarshal the OpenAPI document %s: %v", configFile.GetFilePath(), err)
+		}
+		apiName := openAPIApiName(&doc)
+		for _, pathItem := range doc.Paths {
+			for httpMethod, operation := range pathItem {
+				if !openAPIHttpMethods[httpMethod] || operation == nil || operation.OperationId == "" {
+					continue
+				}
+				operations[fmt.Sprintf("%s.%s", apiName, openAPIMethodName(operation.OperationId))] = operation
+			}
+		}
+	}
+	return operations, nil
+}
+
+// openAPIApiName returns the name of the API of the document, the prefix of
+// the selectors of its operations, e.g. 1.bookstore_example_com.
+func openAPIApiName(doc *OpenAPIDoc) string {
+	return fmt.Sprintf("%s.%s", openAPIMajorVersion(doc.Info.Version), invalidNameCharRegex.ReplaceAllString(doc.Host, "_"))
+}
+
+// openAPIMajorVersion returns the major version prefixing the API name, e.g.
+// 1 of 1.0.0.
+func openAPIMajorVersion(version string) string {
+	major := strings.TrimPrefix(strings.SplitN(version, ".", 2)[0], "v")
+	if major == "" {
+		return "1"
+	}
+	return major
+}
+
+// openAPIMethodName returns the method name of the operation id, e.g.
+// ListShelves of listShelves.
+func openAPIMethodName(operationId string) string {
+	name := []rune(invalidNameCharRegex.ReplaceAllString(operationId, "_"))
+	name[0] = unicode.ToUpper(name[0])
+	return string(name)
+}
+
+// snakeCase converts the path parameters to snake case, e.g. {shelf_id} of
+// {shelfId}, as the fields of the requests are.
+func snakeCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 && s[i-1] != '{' && s[i-1] != '_' {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// convertJwtLocations converts the x-google-jwt-locations extension of a
+// security definition.
+func convertJwtLocations(locations []OpenAPIJwtLocation) ([]*confpb.JwtLocation, error) {
+	var jwtLocations []*confpb.JwtLocation
+	for _, location := range locations {
+		jwtLocation := &confpb.JwtLocation{
+			ValuePrefix: location.ValuePrefix,
+		}
+		switch {
+		case location.Header != "" && location.Query == "":
+			jwtLocation.In = &confpb.JwtLocation_Header{
+				Header: location.Header,
+			}
+		case location.Query != "" && location.Header == "":
+			jwtLocation.In = &confpb.JwtLocation_Query{
+				Query: location.Query,
+			}
+		default:
+			return nil, fmt.Errorf("x-google-jwt-locations must set one of header and query, got %+v", location)
+		}
+		jwtLocations = append(jwtLocations, jwtLocation)
+	}
+	return jwtLocations, nil
+}
@@ -0,0 +1,564 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	smpb "google.golang.org/genproto/googleapis/api/servicemanagement/v1"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+// convertedParts returns the parts of the service config converted from the
+// OpenAPI documents, with the rules sorted.
+func convertedParts(serviceConfig *confpb.Service) *confpb.Service {
+	s := &confpb.Service{
+		Name:           serviceConfig.GetName(),
+		Http:           proto.Clone(serviceConfig.GetHttp()).(*annotationspb.Http),
+		Authentication: proto.Clone(serviceConfig.GetAuthentication()).(*confpb.Authentication),
+		Usage:          proto.Clone(serviceConfig.GetUsage()).(*confpb.Usage),
+		Backend:        proto.Clone(serviceConfig.GetBackend()).(*confpb.Backend),
+	}
+	for _, api := range serviceConfig.GetApis() {
+		converted := &apipb.Api{
+			Name:    api.GetName(),
+			Version: api.GetVersion(),
+		}
+		for _, method := range api.GetMethods() {
+			converted.Methods = append(converted.Methods, &apipb.Method{
+				Name: method.GetName(),
+			})
+		}
+		sort.Slice(converted.Methods, func(i, j int) bool { return converted.Methods[i].Name < converted.Methods[j].Name })
+		s.Apis = append(s.Apis, converted)
+	}
+	for _, endpoint := range serviceConfig.GetEndpoints() {
+		s.Endpoints = append(s.Endpoints, &confpb.Endpoint{
+			Name:      endpoint.GetName(),
+			AllowCors: endpoint.GetAllowCors(),
+		})
+	}
+
+	// The rules without requirements generated by Service Management have no
+	// effect.
+	var authRules []*confpb.AuthenticationRule
+	for _, rule := range s.Authentication.Rules {
+		if len(rule.Requirements) > 0 {
+			authRules = append(authRules, rule)
+		}
+	}
+	s.Authentication.Rules = authRules
+
+	sort.Slice(s.Http.Rules, func(i, j int) bool { return s.Http.Rules[i].Selector < s.Http.Rules[j].Selector })
+	sort.Slice(s.Authentication.Rules, func(i, j int) bool { return s.Authentication.Rules[i].Selector < s.Authentication.Rules[j].Selector })
+	sort.Slice(s.Usage.Rules, func(i, j int) bool { return s.Usage.Rules[i].Selector < s.Usage.Rules[j].Selector })
+	sort.Slice(s.Backend.Rules, func(i, j int) bool { return s.Backend.Rules[i].Selector < s.Backend.Rules[j].Selector })
+	return s
+}
+
+func TestServiceConfigFromOpenAPIExamples(t *testing.T) {
+	// The examples are deployed to Service Management, and come with the
+	// service configs generated by it.
+	testData := []struct {
+		example string
+		// The JWT providers without jwks_uri require the OpenID Connect
+		// Discovery to be served.
+		oidcDiscoveryRequired bool
+	}{
+		{
+			example:               "auth",
+			oidcDiscoveryRequired: true,
+		},
+		{
+			example: "dynamic_routing",
+		},
+		{
+			example: "service_control",
+		},
+		{
+			example: "testdata/route_match",
+		},
+		{
+			example: "testdata/sidecar_backend",
+		},
+	}
+	for _, tc := range testData {
+		t.Run(tc.example, func(t *testing.T) {
+			dir := filepath.Join("../../../examples", tc.example)
+			openAPI, err := ioutil.ReadFile(filepath.Join(dir, "openapi_swagger.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			generated, err := ioutil.ReadFile(filepath.Join(dir, "service_config_generated.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := util.UnmarshalServiceConfig(bytes.NewReader(generated))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ServiceConfigFromOpenAPI(openAPI)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(convertedParts(want), convertedParts(got), protocmp.Transform()); diff != "" {
+				t.Errorf("ServiceConfigFromOpenAPI diff (-want +got):\n%s", diff)
+			}
+
+			if tc.oidcDiscoveryRequired {
+				return
+			}
+			// The converted service config is served as is.
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.DisableOidcDiscovery = true
+			if _, err := NewServiceInfoFromServiceConfig(got, got.GetId(), opts); err != nil {
+				t.Errorf("fail to serve the converted service config: %v", err)
+			}
+		})
+	}
+}
+
+func TestServiceConfigFromOpenAPI(t *testing.T) {
+	testData := []struct {
+		desc              string
+		openAPI           string
+		wantServiceConfig *confpb.Service
+		wantError         string
+	}{
+		{
+			desc: "api keys in custom locations",
+			openAPI: `{
+  "swagger": "2.0",
+  "info": {"title": "Bookstore", "version": "2.1.0"},
+  "host": "bookstore.example.com",
+  "securityDefinitions": {
+    "api_key_header": {"type": "apiKey", "name": "x-api-key", "in": "header"},
+    "api_key_query": {"type": "apiKey", "name": "key", "in": "query"}
+  },
+  "security": [{"api_key_header": []}, {"api_key_query": []}],
+  "paths": {
+    "/shelves/{shelfId}": {
+      "get": {"operationId": "getShelf"},
+      "options": {"operationId": "corsShelf", "security": []}
+    }
+  }
+}`,
+			wantServiceConfig: &confpb.Service{
+				Name:  "bookstore.example.com",
+				Id:    "2.1.0",
+				Title: "Bookstore",
+				Apis: []*apipb.Api{
+					{
+						Name:    "2.bookstore_example_com",
+						Version: "2.1.0",
+						Methods: []*apipb.Method{
+							{
+								Name:            "GetShelf",
+								RequestTypeUrl:  "type.googleapis.com/google.protobuf.Empty",
+								ResponseTypeUrl: "type.googleapis.com/google.protobuf.Value",
+							},
+							{
+								Name:            "CorsShelf",
+								RequestTypeUrl:  "type.googleapis.com/google.protobuf.Empty",
+								ResponseTypeUrl: "type.googleapis.com/google.protobuf.Value",
+							},
+						},
+					},
+				},
+				Http: &annotationspb.Http{
+					Rules: []*annotationspb.HttpRule{
+						{
+							Selector: "2.bookstore_example_com.GetShelf",
+							Pattern:  &annotationspb.HttpRule_Get{Get: "/shelves/{shelf_id}"},
+						},
+						{
+							Selector: "2.bookstore_example_com.CorsShelf",
+							Pattern: &annotationspb.HttpRule_Custom{
+								Custom: &annotationspb.CustomHttpPattern{
+									Kind: "OPTIONS",
+									Path: "/shelves/{shelf_id}",
+								},
+							},
+						},
+					},
+				},
+				Authentication: &confpb.Authentication{},
+				Usage: &confpb.Usage{
+					Rules: []*confpb.UsageRule{
+						{
+							Selector: "2.bookstore_example_com.GetShelf",
+						},
+						{
+							Selector:               "2.bookstore_example_com.CorsShelf",
+							AllowUnregisteredCalls: true,
+						},
+					},
+				},
+				Backend: &confpb.Backend{
+					Rules: []*confpb.BackendRule{
+						{
+							Selector: "2.bookstore_example_com.GetShelf",
+						},
+						{
+							Selector: "2.bookstore_example_com.CorsShelf",
+						},
+					},
+				},
+				SystemParameters: &confpb.SystemParameters{
+					Rules: []*confpb.SystemParameterRule{
+						{
+							Selector: "2.bookstore_example_com.GetShelf",
+							Parameters: []*confpb.SystemParameter{
+								{
+									Name:       "api_key",
+									HttpHeader: "x-api-key",
+								},
+							},
+						},
+					},
+				},
+				Endpoints: []*confpb.Endpoint{
+					{
+						Name: "bookstore.example.com",
+					},
+				},
+			},
+		},
+		{
+			desc: "jwt in custom locations",
+			openAPI: `{
+  "swagger": "2.0",
+  "info": {"title": "Bookstore", "version": "2.1.0"},
+  "host": "bookstore.example.com",
+  "securityDefinitions": {
+    "auth0": {
+      "type": "oauth2",
+      "flow": "implicit",
+      "authorizationUrl": "",
+      "x-google-issuer": "https://auth0.example.com",
+      "x-google-jwks_uri": "https://auth0.example.com/.well-known/jwks.json",
+      "x-google-jwt-locations": [
+        {"header": "x-jwt", "value_prefix": "Bearer "},
+        {"query": "jwt"}
+      ]
+    }
+  },
+  "paths": {}
+}`,
+			wantServiceConfig: &confpb.Service{
+				Name:  "bookstore.example.com",
+				Id:    "2.1.0",
+				Title: "Bookstore",
+				Apis: []*apipb.Api{
+					{
+						Name:    "2.bookstore_example_com",
+						Version: "2.1.0",
+					},
+				},
+				Http: &annotationspb.Http{},
+				Authentication: &confpb.Authentication{
+					Providers: []*confpb.AuthProvider{
+						{
+							Id:      "auth0",
+							Issuer:  "https://auth0.example.com",
+							JwksUri: "https://auth0.example.com/.well-known/jwks.json",
+							JwtLocations: []*confpb.JwtLocation{
+								{
+									In:          &confpb.JwtLocation_Header{Header: "x-jwt"},
+									ValuePrefix: "Bearer ",
+								},
+								{
+									In: &confpb.JwtLocation_Query{Query: "jwt"},
+								},
+							},
+						},
+					},
+				},
+				Usage:            &confpb.Usage{},
+				Backend:          &confpb.Backend{},
+				SystemParameters: &confpb.SystemParameters{},
+				Endpoints: []*confpb.Endpoint{
+					{
+						Name: "bookstore.example.com",
+					},
+				},
+			},
+		},
+		{
+			desc: "optional jwt",
+			openAPI: `{
+  "swagger": "2.0",
+  "info": {"title": "Bookstore", "version": "2.1.0"},
+  "host": "bookstore.example.com",
+  "securityDefinitions": {
+    "auth0": {"type": "oauth2", "flow": "implicit", "x-google-issuer": "https://auth0.example.com"}
+  },
+  "paths": {
+    "/shelves": {
+      "get": {"operationId": "listShelves", "security": [{"auth0": []}, {}]}
+    }
+  }
+}`,
+			wantServiceConfig: &confpb.Service{
+				Name:  "bookstore.example.com",
+				Id:    "2.1.0",
+				Title: "Bookstore",
+				Apis: []*apipb.Api{
+					{
+						Name:    "2.bookstore_example_com",
+						Version: "2.1.0",
+						Methods: []*apipb.Method{
+							{
+								Name:            "ListShelves",
+								RequestTypeUrl:  "type.googleapis.com/google.protobuf.Empty",
+								ResponseTypeUrl: "type.googleapis.com/google.protobuf.Value",
+							},
+						},
+					},
+				},
+				Http: &annotationspb.Http{
+					Rules: []*annotationspb.HttpRule{
+						{
+							Selector: "2.bookstore_example_com.ListShelves",
+							Pattern:  &annotationspb.HttpRule_Get{Get: "/shelves"},
+						},
+					},
+				},
+				Authentication: &confpb.Authentication{
+					Providers: []*confpb.AuthProvider{
+						{
+							Id:     "auth0",
+							Issuer: "https://auth0.example.com",
+						},
+					},
+					Rules: []*confpb.AuthenticationRule{
+						{
+							Selector:               "2.bookstore_example_com.ListShelves",
+							AllowWithoutCredential: true,
+							Requirements: []*confpb.AuthRequirement{
+								{
+									ProviderId: "auth0",
+								},
+							},
+						},
+					},
+				},
+				Usage: &confpb.Usage{
+					Rules: []*confpb.UsageRule{
+						{
+							Selector:               "2.bookstore_example_com.ListShelves",
+							AllowUnregisteredCalls: true,
+						},
+					},
+				},
+				Backend: &confpb.Backend{
+					Rules: []*confpb.BackendRule{
+						{
+							Selector: "2.bookstore_example_com.ListShelves",
+						},
+					},
+				},
+				SystemParameters: &confpb.SystemParameters{},
+				Endpoints: []*confpb.Endpoint{
+					{
+						Name: "bookstore.example.com",
+					},
+				},
+			},
+		},
+		{
+			desc:      "jwt location with both header and query",
+			openAPI:   `{"swagger": "2.0", "host": "bookstore.example.com", "securityDefinitions": {"auth0": {"type": "oauth2", "x-google-issuer": "https://auth0.example.com", "x-google-jwt-locations": [{"header": "x-jwt", "query": "jwt"}]}}, "paths": {}}`,
+			wantError: "security definition auth0: x-google-jwt-locations must set one of header and query",
+		},
+		{
+			desc:      "not OpenAPI 2.0",
+			openAPI:   `{"openapi": "3.0.0", "info": {"version": "1.0.0"}, "paths": {}}`,
+			wantError: `only OpenAPI 2.0 is supported, got swagger version ""`,
+		},
+		{
+			desc:      "no host",
+			openAPI:   `{"swagger": "2.0", "info": {"version": "1.0.0"}, "paths": {}}`,
+			wantError: "host of the OpenAPI document is empty",
+		},
+		{
+			desc:      "no operation id",
+			openAPI:   `{"swagger": "2.0", "host": "bookstore.example.com", "paths": {"/shelves": {"get": {}}}}`,
+			wantError: "operation GET /shelves has no operationId",
+		},
+		{
+			desc:      "conflicting operation ids",
+			openAPI:   `{"swagger": "2.0", "host": "bookstore.example.com", "paths": {"/shelves": {"get": {"operationId": "listShelves"}}, "/v2/shelves": {"get": {"operationId": "ListShelves"}}}}`,
+			wantError: "operationId ListShelves conflicts with listShelves",
+		},
+		{
+			desc:      "undefined security requirement",
+			openAPI:   `{"swagger": "2.0", "host": "bookstore.example.com", "paths": {"/shelves": {"get": {"operationId": "listShelves", "security": [{"firebase": []}]}}}}`,
+			wantError: "operation listShelves: security requirement firebase is not in securityDefinitions",
+		},
+		{
+			desc:      "invalid path translation",
+			openAPI:   `{"swagger": "2.0", "host": "bookstore.example.com", "paths": {"/shelves": {"get": {"operationId": "listShelves", "x-google-backend": {"address": "https://backend.example.com", "path_translation": "APPEND"}}}}}`,
+			wantError: `operation listShelves: invalid x-google-backend path_translation "APPEND"`,
+		},
+		{
+			desc:      "jwt audience with disable auth",
+			openAPI:   `{"swagger": "2.0", "host": "bookstore.example.com", "paths": {"/shelves": {"get": {"operationId": "listShelves", "x-google-backend": {"address": "https://backend.example.com", "jwt_audience": "aud", "disable_auth": true}}}}}`,
+			wantError: "operation listShelves: x-google-backend jwt_audience cannot be set with disable_auth",
+		},
+		{
+			desc:      "invalid deadline",
+			openAPI:   `{"swagger": "2.0", "host": "bookstore.example.com", "x-google-backend": {"deadline": "soon"}, "paths": {}}`,
+			wantError: `invalid deadline "soon"`,
+		},
+	}
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := ServiceConfigFromOpenAPI([]byte(tc.openAPI))
+			if tc.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+					t.Fatalf("ServiceConfigFromOpenAPI got error %v, want %q", err, tc.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The document is the source file of the service config.
+			sourceFiles := got.GetSourceInfo().GetSourceFiles()
+			configFile := &smpb.ConfigFile{}
+			if len(sourceFiles) != 1 || ptypes.UnmarshalAny(sourceFiles[0], configFile) != nil {
+				t.Fatalf("got source files %v, want the OpenAPI document", sourceFiles)
+			}
+			if configFile.GetFileType() != smpb.ConfigFile_OPEN_API_JSON || string(configFile.GetFileContents()) != tc.openAPI {
+				t.Errorf("got source file %v, want the OpenAPI document in JSON", configFile)
+			}
+			if diff := cmp.Diff(tc.wantServiceConfig, got, protocmp.Transform(), protocmp.IgnoreFields(&confpb.Service{}, "source_info")); diff != "" {
+				t.Errorf("ServiceConfigFromOpenAPI diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAddOpenAPISecurity(t *testing.T) {
+	definitions := map[string]*OpenAPISecurityScheme{
+		"api_key":  {Type: "apiKey", Name: "key", In: "query"},
+		"auth0":    {Type: "oauth2", Issuer: "https://auth0.example.com"},
+		"firebase": {Type: "oauth2", Issuer: "https://securetoken.google.com/project"},
+	}
+	testData := []struct {
+		desc                       string
+		security                   []map[string][]string
+		wantProviderIds            []string
+		wantAllowWithoutCredential bool
+		wantAllowUnregisteredCalls bool
+		wantError                  string
+	}{
+		{
+			desc:                       "no security",
+			wantAllowUnregisteredCalls: true,
+		},
+		{
+			desc:                       "optional api key",
+			security:                   []map[string][]string{{}, {"api_key": {}}},
+			wantAllowUnregisteredCalls: true,
+		},
+		{
+			desc:                       "jwt of any provider",
+			security:                   []map[string][]string{{"auth0": {}}, {"firebase": {}}},
+			wantProviderIds:            []string{"auth0", "firebase"},
+			wantAllowUnregisteredCalls: true,
+		},
+		{
+			desc:            "both jwt and api key",
+			security:        []map[string][]string{{"auth0": {}, "api_key": {}}},
+			wantProviderIds: []string{"auth0"},
+		},
+		{
+			desc:                       "optional jwt with api key",
+			security:                   []map[string][]string{{"auth0": {}, "api_key": {}}, {"api_key": {}}},
+			wantProviderIds:            []string{"auth0"},
+			wantAllowWithoutCredential: true,
+		},
+		{
+			desc:      "either jwt or api key",
+			security:  []map[string][]string{{"auth0": {}}, {"api_key": {}}},
+			wantError: "the JWT and the API key can only be required independently of each other",
+		},
+		{
+			desc:      "api key with one of the jwts",
+			security:  []map[string][]string{{"auth0": {}, "api_key": {}}, {"firebase": {}}},
+			wantError: "the JWT and the API key can only be required independently of each other",
+		},
+		{
+			desc:      "jwts of two providers",
+			security:  []map[string][]string{{"auth0": {}, "firebase": {}}},
+			wantError: "security requirement of both auth0 and firebase is not supported, only one JWT can be required",
+		},
+	}
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			serviceConfig := &confpb.Service{
+				Authentication:   &confpb.Authentication{},
+				Usage:            &confpb.Usage{},
+				SystemParameters: &confpb.SystemParameters{},
+			}
+			err := addOpenAPISecurity(serviceConfig, "bookstore.ListShelves", tc.security, definitions)
+			if tc.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+					t.Fatalf("addOpenAPISecurity got error %v, want %q", err, tc.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var gotProviderIds []string
+			gotAllowWithoutCredential := false
+			for _, rule := range serviceConfig.Authentication.Rules {
+				gotAllowWithoutCredential = rule.AllowWithoutCredential
+				for _, requirement := range rule.Requirements {
+					gotProviderIds = append(gotProviderIds, requirement.ProviderId)
+				}
+			}
+			if !reflect.DeepEqual(gotProviderIds, tc.wantProviderIds) {
+				t.Errorf("got providers: %v, want: %v", gotProviderIds, tc.wantProviderIds)
+			}
+			if gotAllowWithoutCredential != tc.wantAllowWithoutCredential {
+				t.Errorf("got allow without credential: %v, want: %v", gotAllowWithoutCredential, tc.wantAllowWithoutCredential)
+			}
+			if got := serviceConfig.Usage.Rules[0].AllowUnregisteredCalls; got != tc.wantAllowUnregisteredCalls {
+				t.Errorf("got allow unregistered calls: %v, want: %v", got, tc.wantAllowUnregisteredCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,452 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+
+	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestMakeOpenAPIJson(t *testing.T) {
+	testData := []struct {
+		desc              string
+		fakeServiceConfig *confpb.Service
+		wantOpenAPI       string
+	}{
+		{
+			desc: "API keys and JWT requirements",
+			fakeServiceConfig: &confpb.Service{
+				Name:  "bookstore.endpoints.project123.cloud.goog",
+				Title: "Bookstore",
+				Apis: []*apipb.Api{
+					{
+						Name: "endpoints.examples.bookstore.Bookstore",
+						Methods: []*apipb.Method{
+							{
+								Name: "ListShelves",
+							},
+							{
+								Name: "GetShelf",
+							},
+							{
+								Name: "DeleteShelf",
+							},
+						},
+					},
+				},
+				Http: &annotationspb.Http{
+					Rules: []*annotationspb.HttpRule{
+						{
+							Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+							Pattern: &annotationspb.HttpRule_Get{
+								Get: "/v1/shelves",
+							},
+						},
+						{
+							Selector: "endpoints.examples.bookstore.Bookstore.GetShelf",
+							Pattern: &annotationspb.HttpRule_Get{
+								Get: "/v1/shelves/{shelf}",
+							},
+						},
+						{
+							Selector: "endpoints.examples.bookstore.Bookstore.DeleteShelf",
+							Pattern: &annotationspb.HttpRule_Delete{
+								Delete: "/v1/{name=shelves/*}",
+							},
+						},
+					},
+				},
+				Authentication: &confpb.Authentication{
+					Providers: []*confpb.AuthProvider{
+						{
+							Id:        "auth0",
+							Issuer:    "https://auth0.example.com",
+							JwksUri:   "https://auth0.example.com/.well-known/jwks.json",
+							Audiences: "bookstore",
+						},
+					},
+					Rules: []*confpb.AuthenticationRule{
+						{
+							Selector: "endpoints.examples.bookstore.Bookstore.GetShelf",
+							Requirements: []*confpb.AuthRequirement{
+								{
+									ProviderId: "auth0",
+								},
+							},
+						},
+						{
+							Selector: "endpoints.examples.bookstore.Bookstore.DeleteShelf",
+							Requirements: []*confpb.AuthRequirement{
+								{
+									ProviderId: "auth0",
+								},
+							},
+						},
+					},
+				},
+				Usage: &confpb.Usage{
+					Rules: []*confpb.UsageRule{
+						{
+							Selector:               "endpoints.examples.bookstore.Bookstore.ListShelves",
+							AllowUnregisteredCalls: true,
+						},
+						{
+							Selector:               "endpoints.examples.bookstore.Bookstore.GetShelf",
+							AllowUnregisteredCalls: true,
+						},
+					},
+				},
+				SystemParameters: &confpb.SystemParameters{
+					Rules: []*confpb.SystemParameterRule{
+						{
+							Selector: "endpoints.examples.bookstore.Bookstore.DeleteShelf",
+							Parameters: []*confpb.SystemParameter{
+								{
+									Name:       "api_key",
+									HttpHeader: "x-shelf-key",
+								},
+							},
+						},
+					},
+				},
+			},
+			wantOpenAPI: `
+{
+  "swagger": "2.0",
+  "info": {
+    "title": "Bookstore",
+    "version": "2019-03-02r0"
+  },
+  "host": "bookstore.endpoints.project123.cloud.goog",
+  "paths": {
+    "/v1/shelves": {
+      "get": {
+        "operationId": "endpoints.examples.bookstore.Bookstore.ListShelves",
+        "responses": {
+          "default": {
+            "description": "Response from the backend."
+          }
+        }
+      }
+    },
+    "/v1/shelves/{shelf}": {
+      "get": {
+        "operationId": "endpoints.examples.bookstore.Bookstore.GetShelf",
+        "security": [
+          {
+            "auth0": []
+          }
+        ],
+        "responses": {
+          "default": {
+            "description": "Response from the backend."
+          }
+        }
+      }
+    },
+    "/v1/{name=shelves/*}": {
+      "delete": {
+        "operationId": "endpoints.examples.bookstore.Bookstore.DeleteShelf",
+        "security": [
+          {
+            "api_key_header_x-shelf-key": [],
+            "auth0": []
+          }
+        ],
+        "responses": {
+          "default": {
+            "description": "Response from the backend."
+          }
+        }
+      }
+    }
+  },
+  "securityDefinitions": {
+    "api_key_header_x-shelf-key": {
+      "type": "apiKey",
+      "name": "x-shelf-key",
+      "in": "header"
+    },
+    "auth0": {
+      "type": "oauth2",
+      "flow": "implicit",
+      "x-google-issuer": "https://auth0.example.com",
+      "x-google-jwks_uri": "https://auth0.example.com/.well-known/jwks.json",
+      "x-google-audiences": "bookstore"
+    }
+  }
+}`,
+		},
+		{
+			desc: "Default API key locations",
+			fakeServiceConfig: &confpb.Service{
+				Name: "bookstore.endpoints.project123.cloud.goog",
+				Apis: []*apipb.Api{
+					{
+						Name: "endpoints.examples.bookstore.Bookstore",
+						Methods: []*apipb.Method{
+							{
+								Name: "ListShelves",
+							},
+						},
+					},
+				},
+				Http: &annotationspb.Http{
+					Rules: []*annotationspb.HttpRule{
+						{
+							Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+							Pattern: &annotationspb.HttpRule_Get{
+								Get: "/v1/shelves",
+							},
+							AdditionalBindings: []*annotationspb.HttpRule{
+								{
+									Pattern: &annotationspb.HttpRule_Get{
+										Get: "/v2/shelves",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			wantOpenAPI: `
+{
+  "swagger": "2.0",
+  "info": {
+    "title": "bookstore.endpoints.project123.cloud.goog",
+    "version": "2019-03-02r0"
+  },
+  "host": "bookstore.endpoints.project123.cloud.goog",
+  "paths": {
+    "/v1/shelves": {
+      "get": {
+        "operationId": "endpoints.examples.bookstore.Bookstore.ListShelves",
+        "security": [
+          {
+            "api_key_query_key": []
+          },
+          {
+            "api_key_query_api_key": []
+          },
+          {
+            "api_key_header_x-api-key": []
+          }
+        ],
+        "responses": {
+          "default": {
+            "description": "Response from the backend."
+          }
+        }
+      }
+    },
+    "/v2/shelves": {
+      "get": {
+        "operationId": "endpoints.examples.bookstore.Bookstore.ListShelves_1",
+        "security": [
+          {
+            "api_key_query_key": []
+          },
+          {
+            "api_key_query_api_key": []
+          },
+          {
+            "api_key_header_x-api-key": []
+          }
+        ],
+        "responses": {
+          "default": {
+            "description": "Response from the backend."
+          }
+        }
+      }
+    }
+  },
+  "securityDefinitions": {
+    "api_key_header_x-api-key": {
+      "type": "apiKey",
+      "name": "x-api-key",
+      "in": "header"
+    },
+    "api_key_query_api_key": {
+      "type": "apiKey",
+      "name": "api_key",
+      "in": "query"
+    },
+    "api_key_query_key": {
+      "type": "apiKey",
+      "name": "key",
+      "in": "query"
+    }
+  }
+}`,
+		},
+		{
+			desc: "All the authentication rules of an operation",
+			fakeServiceConfig: &confpb.Service{
+				Name: "bookstore.endpoints.project123.cloud.goog",
+				Apis: []*apipb.Api{
+					{
+						Name: "endpoints.examples.bookstore.Bookstore",
+						Methods: []*apipb.Method{
+							{
+								Name: "GetShelf",
+							},
+						},
+					},
+				},
+				Http: &annotationspb.Http{
+					Rules: []*annotationspb.HttpRule{
+						{
+							Selector: "endpoints.examples.bookstore.Bookstore.GetShelf",
+							Pattern: &annotationspb.HttpRule_Get{
+								Get: "/v1/shelves/{shelf}",
+							},
+						},
+					},
+				},
+				Authentication: &confpb.Authentication{
+					Providers: []*confpb.AuthProvider{
+						{
+							Id:      "auth0",
+							Issuer:  "https://auth0.example.com",
+							JwksUri: "https://auth0.example.com/.well-known/jwks.json",
+						},
+						{
+							Id:      "firebase",
+							Issuer:  "https://securetoken.google.com/project123",
+							JwksUri: "https://www.googleapis.com/service_accounts/v1/metadata/x509/securetoken@system.gserviceaccount.com",
+						},
+						{
+							Id:      "service",
+							Issuer:  "https://service.example.com",
+							JwksUri: "https://service.example.com/jwks.json",
+							JwtLocations: []*confpb.JwtLocation{
+								{
+									In: &confpb.JwtLocation_Header{
+										Header: "X-Service-Authorization",
+									},
+								},
+							},
+						},
+					},
+					Rules: []*confpb.AuthenticationRule{
+						{
+							Selector: "endpoints.examples.bookstore.Bookstore.GetShelf",
+							Requirements: []*confpb.AuthRequirement{
+								{
+									ProviderId: "auth0",
+								},
+								{
+									ProviderId: "firebase",
+								},
+							},
+						},
+						{
+							Selector: "endpoints.examples.bookstore.Bookstore.GetShelf",
+							Requirements: []*confpb.AuthRequirement{
+								{
+									ProviderId: "service",
+								},
+							},
+						},
+					},
+				},
+				Usage: &confpb.Usage{
+					Rules: []*confpb.UsageRule{
+						{
+							Selector:               "endpoints.examples.bookstore.Bookstore.GetShelf",
+							AllowUnregisteredCalls: true,
+						},
+					},
+				},
+			},
+			wantOpenAPI: `
+{
+  "swagger": "2.0",
+  "info": {
+    "title": "bookstore.endpoints.project123.cloud.goog",
+    "version": "2019-03-02r0"
+  },
+  "host": "bookstore.endpoints.project123.cloud.goog",
+  "paths": {
+    "/v1/shelves/{shelf}": {
+      "get": {
+        "operationId": "endpoints.examples.bookstore.Bookstore.GetShelf",
+        "security": [
+          {
+            "auth0": [],
+            "service": []
+          },
+          {
+            "firebase": [],
+            "service": []
+          }
+        ],
+        "responses": {
+          "default": {
+            "description": "Response from the backend."
+          }
+        }
+      }
+    }
+  },
+  "securityDefinitions": {
+    "auth0": {
+      "type": "oauth2",
+      "flow": "implicit",
+      "x-google-issuer": "https://auth0.example.com",
+      "x-google-jwks_uri": "https://auth0.example.com/.well-known/jwks.json"
+    },
+    "firebase": {
+      "type": "oauth2",
+      "flow": "implicit",
+      "x-google-issuer": "https://securetoken.google.com/project123",
+      "x-google-jwks_uri": "https://www.googleapis.com/service_accounts/v1/metadata/x509/securetoken@system.gserviceaccount.com"
+    },
+    "service": {
+      "type": "oauth2",
+      "flow": "implicit",
+      "x-google-issuer": "https://service.example.com",
+      "x-google-jwks_uri": "https://service.example.com/jwks.json"
+    }
+  }
+}`,
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			s, err := NewServiceInfoFromServiceConfig(tc.fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := s.MakeOpenAPIJson()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := util.JsonEqual(tc.wantOpenAPI, string(got)); err != nil {
+				t.Errorf("MakeOpenAPIJson failed, \n %v", err)
+			}
+		})
+	}
+}
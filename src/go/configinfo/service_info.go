@@ -17,14 +17,19 @@ package configinfo
 import (
 	"fmt"
 	"math"
+	"net"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/httppattern"
 	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 
 	commonpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/v10/http/common"
@@ -59,7 +64,13 @@ type ServiceInfo struct {
 
 	AllowCors         bool
 	ServiceControlURI string
-	GcpAttributes     *scpb.GcpAttributes
+	// The service control uris failed over to in order, each called through
+	// the cluster of util.ServiceControlFailoverClusterName by its index.
+	ServiceControlFailoverURIs []string
+	GcpAttributes              *scpb.GcpAttributes
+	// The header values of the backend credentials by their ids, resolved by
+	// the config manager.
+	BackendCredentialValues map[string]string
 	// Keep a pointer to original service config. Should always process rules
 	// inside ServiceInfo.
 	serviceConfig *confpb.Service
@@ -70,6 +81,22 @@ type ServiceInfo struct {
 	GrpcSupportRequired   bool
 	LocalBackendCluster   *BackendRoutingCluster
 	RemoteBackendClusters []*BackendRoutingCluster
+	// Dedicated clusters for the operations with a maximum concurrency limit.
+	OperationBackendClusters []*BackendRoutingCluster
+
+	// The auth requirements of the JWT of the caller overridden for the
+	// requests to a hostname, keyed by the hostname and then the selector. An
+	// empty requirement list means no JWT of the caller is required.
+	HostAuthRequirements map[string]map[string][]*confpb.AuthRequirement
+	// The JWT providers only required together with the JWT of the caller, by
+	// the second or later authentication rules of an operation.
+	AdditionalJwtProviders map[string]bool
+	// The second or later authentication rules of the operations keyed by the
+	// selector, required on every hostname.
+	AdditionalAuthRules map[string][]*confpb.AuthenticationRule
+	// The clusters of the backends serving the requests to a hostname instead
+	// of the local backend, keyed by the hostname.
+	HostBackendClusters map[string]*BackendRoutingCluster
 }
 
 type BackendRoutingCluster struct {
@@ -78,6 +105,22 @@ type BackendRoutingCluster struct {
 	Port        uint32
 	UseTLS      bool
 	Protocol    util.BackendProtocol
+	// The SNI for the TLS connection, the Hostname is used if empty.
+	Sni string
+	// The maximum number of concurrent requests to the cluster, 0 means no limit.
+	MaxRequests uint32
+	// Whether to forward the trailers, only applies to HTTP/1 backends.
+	EnableTrailers bool
+	// The endpoints of the backend in their zones, used instead of resolving
+	// the Hostname.
+	LocalityEndpoints []*LocalityEndpoint
+}
+
+// LocalityEndpoint is an endpoint of a backend in a zone.
+type LocalityEndpoint struct {
+	Zone     string
+	Hostname string
+	Port     uint32
 }
 
 // NewServiceInfoFromServiceConfig returns an instance of ServiceInfo.
@@ -85,7 +128,7 @@ func NewServiceInfoFromServiceConfig(serviceConfig *confpb.Service, id string, o
 	if serviceConfig == nil {
 		return nil, fmt.Errorf("unexpected empty service config")
 	}
-	if len(serviceConfig.GetApis()) == 0 {
+	if len(serviceConfig.GetApis()) == 0 && !opts.PassthroughForEmptyConfig {
 		return nil, fmt.Errorf("service config must have one api at least")
 	}
 
@@ -121,15 +164,24 @@ func NewServiceInfoFromServiceConfig(serviceConfig *confpb.Service, id string, o
 	if err := serviceInfo.processQuota(); err != nil {
 		return nil, err
 	}
+	if err := serviceInfo.processReportSampling(); err != nil {
+		return nil, err
+	}
 	if err := serviceInfo.processBackendRule(); err != nil {
 		return nil, err
 	}
 	if err := serviceInfo.processHttpRule(); err != nil {
 		return nil, err
 	}
+	if err := serviceInfo.processPassthrough(); err != nil {
+		return nil, err
+	}
 	if err := serviceInfo.processUsageRule(); err != nil {
 		return nil, err
 	}
+	if err := serviceInfo.processQuotaTiers(); err != nil {
+		return nil, err
+	}
 
 	serviceInfo.processAccessToken()
 	if err := serviceInfo.processTypes(); err != nil {
@@ -154,9 +206,52 @@ func NewServiceInfoFromServiceConfig(serviceConfig *confpb.Service, id string, o
 	if err := serviceInfo.processAllBackends(); err != nil {
 		return nil, err
 	}
+	if err := serviceInfo.processBackendHttpProtocolOptions(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processBackendLocalityEndpoints(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processHostBackends(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processOperationMaxConcurrency(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processOperationHedging(); err != nil {
+		return nil, err
+	}
+	serviceInfo.processLongRunningOperations()
 	if err := serviceInfo.processAuthRequirement(); err != nil {
 		return nil, err
 	}
+	if err := serviceInfo.processJwtAllowMissingOrFailed(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processHostAuthRequirements(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processJwtConjunctions(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processMaintenance(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processFeatureGates(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processStatusOverrides(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processClaimRequirements(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processMaxRequestBytes(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processBackendCredentials(); err != nil {
+		return nil, err
+	}
 
 	return serviceInfo, nil
 }
@@ -168,8 +263,15 @@ func (s *ServiceInfo) buildLocalBackend() error {
 		return fmt.Errorf("error parsing local backend uri: %v", err)
 	}
 
-	// For local backend, user cannot configure http protocol explicitly.
-	protocol, tls, err := util.ParseBackendProtocol(scheme, "")
+	// The "auto" protocol is resolved by the config manager by probing the
+	// backend, fall back to the default if it was not probed.
+	httpProtocol := s.Options.BackendHttpProtocol
+	if httpProtocol == util.AutoBackendHttpProtocol {
+		glog.Warningf("backend protocol %q is not resolved, use the default protocol", httpProtocol)
+		httpProtocol = ""
+	}
+
+	protocol, tls, err := util.ParseBackendProtocol(scheme, httpProtocol)
 	if err != nil {
 		return fmt.Errorf("error parsing local backend protocol: %v", err)
 	}
@@ -184,8 +286,13 @@ func (s *ServiceInfo) buildLocalBackend() error {
 		s.GrpcSupportRequired = true
 	}
 
+	if s.Options.BackendTlsSni != "" && !tls {
+		return fmt.Errorf("invalid flag --backend_tls_sni, backend address must use https or grpcs scheme.")
+	}
+
 	s.LocalBackendCluster = &BackendRoutingCluster{
 		UseTLS:      tls,
+		Sni:         s.Options.BackendTlsSni,
 		Protocol:    protocol,
 		ClusterName: s.LocalBackendClusterName(),
 		Hostname:    hostname,
@@ -200,32 +307,88 @@ func (s *ServiceInfo) ServiceConfig() *confpb.Service {
 }
 
 func (s *ServiceInfo) processEmptyJwksUriByOpenID() error {
-	authn := s.serviceConfig.GetAuthentication()
-	for _, provider := range authn.GetProviders() {
-		jwksUri := provider.GetJwksUri()
+	discovered := false
+	for _, provider := range s.serviceConfig.GetAuthentication().GetProviders() {
+		if provider.GetJwksUri() == "" {
+			discovered = true
+		}
+	}
+	if !discovered {
+		return nil
+	}
+	// The discovered jwks_uri are set on a copy, as the service config of the
+	// caller may be persisted and applied again, e.g. by Revert.
+	s.serviceConfig = proto.Clone(s.serviceConfig).(*confpb.Service)
 
+	var providers []*confpb.AuthProvider
+	for _, provider := range s.serviceConfig.GetAuthentication().GetProviders() {
 		// Note: When jwksUri is empty, proxy will try to find jwksUri using the
 		// OpenID Connect Discovery protocol.
-		if jwksUri == "" {
-			if s.Options.DisableOidcDiscovery {
-				return fmt.Errorf("error processing authentication provider (%v): "+
-					"jwks_uri is empty, but OpenID Connect Discovery is disabled via startup option. "+
-					"Consider specifying the jwks_uri in the provider config", provider.Id)
-			}
+		if provider.GetJwksUri() != "" {
+			continue
+		}
+		if s.Options.DisableOidcDiscovery {
+			return fmt.Errorf("error processing authentication provider (%v): "+
+				"jwks_uri is empty, but OpenID Connect Discovery is disabled via startup option. "+
+				"Consider specifying the jwks_uri in the provider config", provider.Id)
+		}
+		glog.Infof("jwks_uri is empty for provider (%v), using OpenID Connect Discovery protocol", provider.Id)
+		providers = append(providers, provider)
+	}
 
-			glog.Infof("jwks_uri is empty for provider (%v), using OpenID Connect Discovery protocol", provider.Id)
-			jwksUriByOpenID, err := util.ResolveJwksUriUsingOpenID(provider.GetIssuer())
-			if err != nil {
-				return fmt.Errorf("error processing authentication provider (%v): failed OpenID Connect Discovery protocol: %v", provider.Id, err)
-			} else {
-				jwksUri = jwksUriByOpenID
-			}
-			provider.JwksUri = jwksUri
+	// Discover the issuers concurrently, so an unreachable one does not delay
+	// the others.
+	errs := make([]error, len(providers))
+	var wg sync.WaitGroup
+	for i, provider := range providers {
+		wg.Add(1)
+		go func(i int, provider *confpb.AuthProvider) {
+			defer wg.Done()
+			provider.JwksUri, errs[i] = s.resolveJwksUriUsingOpenID(provider.GetIssuer())
+		}(i, provider)
+	}
+	wg.Wait()
+
+	for i, provider := range providers {
+		if errs[i] == nil {
+			continue
 		}
+		if s.Options.OidcDiscoveryFallbackJwksPath == "" {
+			return fmt.Errorf("error processing authentication provider (%v): failed OpenID Connect Discovery protocol: %v", provider.Id, errs[i])
+		}
+		provider.JwksUri = oidcFallbackJwksUri(provider.GetIssuer(), s.Options.OidcDiscoveryFallbackJwksPath)
+		glog.Warningf("failed OpenID Connect Discovery protocol for provider (%v), fall back to jwks_uri %v: %v", provider.Id, provider.JwksUri, errs[i])
 	}
 	return nil
 }
 
+// The initial back off of retrying the OpenID Connect Discovery, a variable so
+// the unit tests do not wait for it.
+var oidcDiscoveryRetryBackOff = 200 * time.Millisecond
+
+// resolveJwksUriUsingOpenID discovers the jwks_uri of the issuer, retrying the
+// failed calls with exponential back off.
+func (s *ServiceInfo) resolveJwksUriUsingOpenID(issuer string) (string, error) {
+	backOff := oidcDiscoveryRetryBackOff
+	for attempt := 0; ; attempt++ {
+		jwksUri, err := util.ResolveJwksUriUsingOpenID(issuer, s.Options.GoogleApiProxy, s.Options.OidcDiscoveryTimeout)
+		if err == nil || attempt >= s.Options.OidcDiscoveryNumRetries {
+			return jwksUri, err
+		}
+		glog.Warningf("failed OpenID Connect Discovery of issuer (%v), retry in %v: %v", issuer, backOff, err)
+		time.Sleep(backOff)
+		backOff *= 2
+	}
+}
+
+// oidcFallbackJwksUri returns the jwks_uri at the path under the issuer.
+func oidcFallbackJwksUri(issuer, path string) string {
+	if !strings.HasPrefix(issuer, "http") {
+		issuer = fmt.Sprintf("https://%s", issuer)
+	}
+	return strings.TrimSuffix(issuer, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
 func (s *ServiceInfo) processApis() error {
 	for _, api := range s.serviceConfig.GetApis() {
 		if !s.isAPIAllowed(api.GetName()) {
@@ -254,6 +417,10 @@ func (s *ServiceInfo) processApis() error {
 			} else {
 				glog.Warningf("For operation (%v), request type name (%v) is in an unexpected format", selector, method.RequestTypeUrl)
 			}
+
+			if method.ResponseTypeUrl == util.TypeUrlPrefix+util.LongRunningOperationTypeName {
+				mi.IsLongRunning = true
+			}
 		}
 	}
 	return nil
@@ -348,6 +515,115 @@ func (s *ServiceInfo) processQuota() error {
 	return nil
 }
 
+// Charge the consumer projects in the tiers of the x-google-quota-tiers
+// extension with the metric costs of their tiers, e.g. to enforce free and paid
+// tiers. The consumer project is returned by the Check call, which is only made
+// if the operation requires an API key.
+func (s *ServiceInfo) processQuotaTiers() error {
+	operations, err := openAPIOperations(s.serviceConfig)
+	if err != nil {
+		return fmt.Errorf("error processing x-google-quota-tiers: %v", err)
+	}
+
+	// The costs of the metrics without quota limits are not enforced.
+	limitedMetrics := make(map[string]bool)
+	for _, limit := range s.serviceConfig.GetQuota().GetLimits() {
+		limitedMetrics[limit.GetMetric()] = true
+	}
+
+	for selector, operation := range operations {
+		if len(operation.QuotaTiers) == 0 || !s.isAPIAllowed(selector) {
+			continue
+		}
+		method, err := s.getMethod(selector)
+		if err != nil {
+			return fmt.Errorf("error processing x-google-quota-tiers of operation (%v): %v", operation.OperationId, err)
+		}
+		if method.AllowUnregisteredCalls || method.SkipServiceControl {
+			return fmt.Errorf("error processing x-google-quota-tiers of operation (%v): the consumer project is only known by the Check call, the operation should require an API key", selector)
+		}
+		if method.QuotaTiers, err = makeQuotaTiers(operation.QuotaTiers, limitedMetrics); err != nil {
+			return fmt.Errorf("error processing x-google-quota-tiers of operation (%v): %v", selector, err)
+		}
+	}
+
+	return nil
+}
+
+func makeQuotaTiers(exts []*OpenAPIQuotaTier, limitedMetrics map[string]bool) ([]*scpb.QuotaTier, error) {
+	var tiers []*scpb.QuotaTier
+	tieredProjects := make(map[string]bool)
+	for _, ext := range exts {
+		if len(ext.ConsumerProjectNumbers) == 0 || len(ext.MetricCosts) == 0 {
+			return nil, fmt.Errorf("quota tier should have both consumer project numbers and metric costs")
+		}
+
+		tier := &scpb.QuotaTier{}
+		for _, project := range ext.ConsumerProjectNumbers {
+			if _, err := strconv.ParseUint(project, 10, 64); err != nil {
+				return nil, fmt.Errorf("consumer project number %q should be a number", project)
+			}
+			if tieredProjects[project] {
+				return nil, fmt.Errorf("consumer project number %v is in multiple quota tiers", project)
+			}
+			tieredProjects[project] = true
+			tier.ConsumerProjectNumbers = append(tier.ConsumerProjectNumbers, project)
+		}
+
+		names := make([]string, 0, len(ext.MetricCosts))
+		for name := range ext.MetricCosts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !limitedMetrics[name] {
+				return nil, fmt.Errorf("metric (%v) has no quota limit in the service config", name)
+			}
+			if ext.MetricCosts[name] < 0 {
+				return nil, fmt.Errorf("cost %v of metric (%v) should be non-negative", ext.MetricCosts[name], name)
+			}
+			tier.MetricCosts = append(tier.MetricCosts, &scpb.MetricCost{
+				Name: name,
+				Cost: ext.MetricCosts[name],
+			})
+		}
+		tiers = append(tiers, tier)
+	}
+	return tiers, nil
+}
+
+func (s *ServiceInfo) processReportSampling() error {
+	if s.Options.ReportSuccessSamplingRates == "" {
+		return nil
+	}
+
+	for _, sampling := range strings.Split(s.Options.ReportSuccessSamplingRates, ";") {
+		if sampling == "" {
+			continue
+		}
+		selectorAndRate := strings.Split(sampling, "=")
+		if len(selectorAndRate) != 2 {
+			return fmt.Errorf("invalid report success sampling rate: %v, should be in selector=rate format", sampling)
+		}
+
+		selector := strings.TrimSpace(selectorAndRate[0])
+		rate, err := strconv.ParseFloat(strings.TrimSpace(selectorAndRate[1]), 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return fmt.Errorf("invalid report success sampling rate for operation (%v): %v, should be between 0 and 1", selector, selectorAndRate[1])
+		}
+
+		mi, err := s.getMethod(selector)
+		if err != nil {
+			return fmt.Errorf("error processing report success sampling rate: %v", err)
+		}
+		mi.ReportSampling = &scpb.ReportSampling{
+			SuccessRate: rate,
+		}
+	}
+
+	return nil
+}
+
 func (s *ServiceInfo) processEndpoints() {
 	for _, endpoint := range s.ServiceConfig().GetEndpoints() {
 		if endpoint.GetName() == s.ServiceConfig().GetName() && endpoint.GetAllowCors() {
@@ -518,8 +794,43 @@ func (s *ServiceInfo) addOptionMethod(originalMethod *MethodInfo, httpRule *http
 	return nil
 }
 
+// For the service config without any apis, add a generated method to pass all
+// the requests through to the local backend, so they are still reported to
+// service control. A config with apis but no http rules is a gRPC service, its
+// methods are routed by their gRPC paths, not by a catch-all.
+func (s *ServiceInfo) processPassthrough() error {
+	if !s.Options.PassthroughForEmptyConfig {
+		return nil
+	}
+	if len(s.ServiceConfig().GetApis()) > 0 {
+		return nil
+	}
+
+	methodName := fmt.Sprintf("%s.%s_Passthrough", util.EspOperation, util.AutogeneratedOperationPrefix)
+	method, err := s.getOrCreateMethod(methodName)
+	if err != nil {
+		return fmt.Errorf("error creating auto-generated passthrough http rule for operation (%v): %v", methodName, err)
+	}
+
+	uriTemplate, err := httppattern.ParseUriTemplate("/**")
+	if err != nil {
+		return fmt.Errorf("error parsing auto-generated passthrough http rule for operation (%v): %v", methodName, err)
+	}
+	method.HttpRule = append(method.HttpRule, &httppattern.Pattern{
+		UriTemplate: uriTemplate,
+		HttpMethod:  httppattern.HttpMethodWildCard,
+	})
+	method.IsGenerated = true
+
+	glog.Infof("service config has no apis, pass all requests through to the local backend")
+	return nil
+}
+
 func (s *ServiceInfo) processBackendRule() error {
+	// Map of remote backend address and protocol to the cluster name, the
+	// rules with the same address but different protocols use separate clusters.
 	backendRoutingClustersMap := make(map[string]string)
+	backendAddressProtocols := make(map[string]util.BackendProtocol)
 
 	for _, r := range s.ServiceConfig().Backend.GetRules() {
 		if !s.isAPIAllowed(r.GetSelector()) {
@@ -539,17 +850,25 @@ func (s *ServiceInfo) processBackendRule() error {
 			}
 			address := fmt.Sprintf("%v:%v", hostname, port)
 
-			if _, exist := backendRoutingClustersMap[address]; !exist {
+			protocol, tls, err := util.ParseBackendProtocol(scheme, r.Protocol)
+			if err != nil {
+				return fmt.Errorf("error parsing remote backend rule's protocol for operation (%v), %v", r.Selector, err)
+			}
+			clusterKey := fmt.Sprintf("%v/%v", address, protocol)
+
+			if _, exist := backendRoutingClustersMap[clusterKey]; !exist {
 				// Create cluster for the remote backend.
-				protocol, tls, err := util.ParseBackendProtocol(scheme, r.Protocol)
-				if err != nil {
-					return fmt.Errorf("error parsing remote backend rule's protocol for operation (%v), %v", r.Selector, err)
-				}
 				if protocol == util.GRPC {
 					s.GrpcSupportRequired = true
 				}
 
 				backendClusterName := util.BackendClusterName(address)
+				if firstProtocol, exist := backendAddressProtocols[address]; exist && firstProtocol != protocol {
+					backendClusterName = util.BackendClusterName(fmt.Sprintf("%v_%v", address, protocol))
+				} else {
+					backendAddressProtocols[address] = protocol
+				}
+
 				s.RemoteBackendClusters = append(s.RemoteBackendClusters,
 					&BackendRoutingCluster{
 						ClusterName: backendClusterName,
@@ -558,10 +877,10 @@ func (s *ServiceInfo) processBackendRule() error {
 						Hostname:    hostname,
 						Port:        port,
 					})
-				backendRoutingClustersMap[address] = backendClusterName
+				backendRoutingClustersMap[clusterKey] = backendClusterName
 			}
 
-			backendClusterName := backendRoutingClustersMap[address]
+			backendClusterName := backendRoutingClustersMap[clusterKey]
 			if err := s.addBackendInfoToMethod(r, scheme, hostname, path, backendClusterName, port); err != nil {
 				return fmt.Errorf("error processing remote backend rule for operation (%v), %v", r.Selector, err)
 			}
@@ -691,6 +1010,534 @@ func (s *ServiceInfo) processAllBackends() error {
 	return nil
 }
 
+// Apply the per-backend HTTP protocol options to the backend clusters, and the
+// request header limits to the methods routed to them. The backends are
+// specified by their host:port addresses, which may be served by a cluster per
+// protocol.
+func (s *ServiceInfo) processBackendHttpProtocolOptions() error {
+	for _, limit := range strings.Split(s.Options.BackendMaxRequestHeadersKb, ";") {
+		if limit == "" {
+			continue
+		}
+		sep := strings.LastIndex(limit, "=")
+		if sep == -1 {
+			return fmt.Errorf("invalid backend max request headers kb: %v, should be in address=value format", limit)
+		}
+
+		address := strings.TrimSpace(limit[:sep])
+		maxRequestHeadersKb, err := strconv.ParseUint(strings.TrimSpace(limit[sep+1:]), 10, 32)
+		if err != nil || maxRequestHeadersKb == 0 {
+			return fmt.Errorf("invalid backend max request headers kb for backend (%v): %v, should be a positive integer", address, limit[sep+1:])
+		}
+
+		clusters := s.getBackendRoutingClustersByAddress(address)
+		if len(clusters) == 0 {
+			return fmt.Errorf("error processing backend max request headers kb: backend (%v) not found", address)
+		}
+		for _, cluster := range clusters {
+			for _, method := range s.Methods {
+				if method.BackendInfo != nil && method.BackendInfo.ClusterName == cluster.ClusterName {
+					method.BackendInfo.MaxRequestHeadersKb = uint32(maxRequestHeadersKb)
+				}
+			}
+		}
+	}
+
+	for _, address := range strings.Split(s.Options.BackendEnableTrailers, ",") {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
+		}
+
+		clusters := s.getBackendRoutingClustersByAddress(address)
+		if len(clusters) == 0 {
+			return fmt.Errorf("error processing backend enable trailers: backend (%v) not found", address)
+		}
+		for _, cluster := range clusters {
+			cluster.EnableTrailers = true
+		}
+	}
+
+	return nil
+}
+
+// Serve the backends by their endpoints in the zones, for the locality aware
+// load balancing. The backends are specified by their host:port addresses.
+func (s *ServiceInfo) processBackendLocalityEndpoints() error {
+	for _, backendEndpoints := range strings.Split(s.Options.BackendLocalityEndpoints, ";") {
+		if backendEndpoints == "" {
+			continue
+		}
+		sep := strings.Index(backendEndpoints, "=")
+		if sep == -1 {
+			return fmt.Errorf("invalid backend locality endpoints: %v, should be in address=zone/endpoint_address format", backendEndpoints)
+		}
+		address := strings.TrimSpace(backendEndpoints[:sep])
+
+		var endpoints []*LocalityEndpoint
+		for _, endpoint := range strings.Split(backendEndpoints[sep+1:], ",") {
+			endpoint = strings.TrimSpace(endpoint)
+			if endpoint == "" {
+				continue
+			}
+			zoneAndAddress := strings.SplitN(endpoint, "/", 2)
+			if len(zoneAndAddress) != 2 || zoneAndAddress[0] == "" {
+				return fmt.Errorf("invalid locality endpoint of backend (%v): %v, should be in zone/endpoint_address format", address, endpoint)
+			}
+			hostname, port, err := net.SplitHostPort(zoneAndAddress[1])
+			if err != nil {
+				return fmt.Errorf("invalid locality endpoint of backend (%v): %v, %v", address, endpoint, err)
+			}
+			portValue, err := strconv.ParseUint(port, 10, 16)
+			if err != nil || hostname == "" {
+				return fmt.Errorf("invalid locality endpoint of backend (%v): %v, should be in zone/endpoint_host:port format", address, endpoint)
+			}
+			endpoints = append(endpoints, &LocalityEndpoint{
+				Zone:     zoneAndAddress[0],
+				Hostname: hostname,
+				Port:     uint32(portValue),
+			})
+		}
+		if len(endpoints) == 0 {
+			return fmt.Errorf("invalid backend locality endpoints: %v, no endpoints of backend (%v)", backendEndpoints, address)
+		}
+
+		clusters := s.getBackendRoutingClustersByAddress(address)
+		if len(clusters) == 0 {
+			return fmt.Errorf("error processing backend locality endpoints: backend (%v) not found", address)
+		}
+		for _, cluster := range clusters {
+			cluster.LocalityEndpoints = endpoints
+		}
+	}
+
+	// The hostname of a backend is resolved to a single endpoint without
+	// locality, the locality aware load balancing takes no effect on it.
+	if s.Options.BackendLocalityLb != "" && s.Options.BackendLocalityEndpoints == "" {
+		return fmt.Errorf("backend_locality_lb requires the backend endpoints in their zones, set them with --backend_locality_endpoints")
+	}
+	return nil
+}
+
+// Route the requests to the specified hostnames to their own backends. The
+// backends replace the local backend only, with the same protocol options.
+func (s *ServiceInfo) processHostBackends() error {
+	if s.Options.HostBackends == "" {
+		return nil
+	}
+
+	// The http backends use the same http protocol as the local backend.
+	httpProtocol := ""
+	if s.LocalBackendCluster.Protocol == util.HTTP2 {
+		httpProtocol = "h2"
+	}
+
+	s.HostBackendClusters = make(map[string]*BackendRoutingCluster)
+	for _, hostBackend := range strings.Split(s.Options.HostBackends, ";") {
+		if hostBackend == "" {
+			continue
+		}
+		sep := strings.Index(hostBackend, "=")
+		if sep == -1 {
+			return fmt.Errorf("invalid host backend: %v, should be in host=backend_address format", hostBackend)
+		}
+		host := strings.ToLower(strings.TrimSpace(hostBackend[:sep]))
+		address := strings.TrimSpace(hostBackend[sep+1:])
+		if host == "" || address == "" {
+			return fmt.Errorf("invalid host backend: %v, should be in host=backend_address format", hostBackend)
+		}
+		if _, ok := s.HostBackendClusters[host]; ok {
+			return fmt.Errorf("duplicate host backends for host (%v)", host)
+		}
+
+		scheme, hostname, port, _, err := util.ParseURI(address)
+		if err != nil {
+			return fmt.Errorf("error parsing backend uri of host (%v): %v", host, err)
+		}
+		protocol, tls, err := util.ParseBackendProtocol(scheme, httpProtocol)
+		if err != nil {
+			return fmt.Errorf("error parsing backend protocol of host (%v): %v", host, err)
+		}
+		if protocol != s.LocalBackendCluster.Protocol {
+			return fmt.Errorf("backend of host (%v) must use the same protocol as the local backend", host)
+		}
+
+		cluster := *s.LocalBackendCluster
+		cluster.ClusterName = util.BackendClusterName(fmt.Sprintf("%s_local_%s", s.Name, host))
+		cluster.Hostname = hostname
+		cluster.Port = port
+		cluster.UseTLS = tls
+		cluster.Sni = ""
+		cluster.LocalityEndpoints = nil
+		s.HostBackendClusters[host] = &cluster
+	}
+	return nil
+}
+
+// Route the operations with a maximum concurrency limit to their own clusters,
+// so the limit is enforced by the cluster circuit breaker without affecting
+// other operations sharing the same backend.
+func (s *ServiceInfo) processOperationMaxConcurrency() error {
+	if s.Options.OperationMaxConcurrency == "" {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	for _, limit := range strings.Split(s.Options.OperationMaxConcurrency, ";") {
+		if limit == "" {
+			continue
+		}
+		selectorAndValue := strings.Split(limit, "=")
+		if len(selectorAndValue) != 2 {
+			return fmt.Errorf("invalid operation max concurrency: %v, should be in selector=value format", limit)
+		}
+
+		selector := strings.TrimSpace(selectorAndValue[0])
+		// Each limit makes a cluster named after the selector.
+		if seen[selector] {
+			return fmt.Errorf("duplicate operation max concurrency for operation (%v)", selector)
+		}
+		seen[selector] = true
+		maxRequests, err := strconv.ParseUint(strings.TrimSpace(selectorAndValue[1]), 10, 32)
+		if err != nil || maxRequests == 0 {
+			return fmt.Errorf("invalid operation max concurrency for operation (%v): %v, should be a positive integer", selector, selectorAndValue[1])
+		}
+
+		method, err := s.getMethod(selector)
+		if err != nil {
+			return fmt.Errorf("error processing operation max concurrency: %v", err)
+		}
+
+		backendCluster := s.getBackendRoutingCluster(method.BackendInfo.ClusterName)
+		if backendCluster == nil {
+			return fmt.Errorf("error processing operation max concurrency for operation (%v): backend cluster (%v) not found", selector, method.BackendInfo.ClusterName)
+		}
+
+		operationCluster := *backendCluster
+		operationCluster.ClusterName = util.OperationBackendClusterName(backendCluster.ClusterName, selector)
+		operationCluster.MaxRequests = uint32(maxRequests)
+		s.OperationBackendClusters = append(s.OperationBackendClusters, &operationCluster)
+
+		// BackendInfo may be shared with the auto-generated methods, copy it
+		// to only reroute this operation.
+		backendInfo := *method.BackendInfo
+		backendInfo.ClusterName = operationCluster.ClusterName
+		method.BackendInfo = &backendInfo
+	}
+
+	return nil
+}
+
+// Hedge the idempotent routes of the operations with a hedging threshold: if the
+// backend does not respond within the threshold, another request is sent and
+// the first response is used.
+func (s *ServiceInfo) processOperationHedging() error {
+	if s.Options.OperationHedgingThreshold == "" {
+		return nil
+	}
+
+	for _, threshold := range strings.Split(s.Options.OperationHedgingThreshold, ";") {
+		if threshold == "" {
+			continue
+		}
+		selectorAndValue := strings.Split(threshold, "=")
+		if len(selectorAndValue) != 2 {
+			return fmt.Errorf("invalid operation hedging threshold: %v, should be in selector=value format", threshold)
+		}
+
+		selector := strings.TrimSpace(selectorAndValue[0])
+		hedgeThreshold, err := time.ParseDuration(strings.TrimSpace(selectorAndValue[1]))
+		if err != nil || hedgeThreshold <= 0 {
+			return fmt.Errorf("invalid operation hedging threshold for operation (%v): %v, should be a positive duration", selector, selectorAndValue[1])
+		}
+
+		method, err := s.getMethod(selector)
+		if err != nil {
+			return fmt.Errorf("error processing operation hedging threshold: %v", err)
+		}
+
+		isIdempotent := false
+		for _, httpRule := range method.HttpRule {
+			if httpRule.HttpMethod == util.GET {
+				isIdempotent = true
+				break
+			}
+		}
+		if !isIdempotent {
+			return fmt.Errorf("error processing operation hedging threshold for operation (%v): only methods with GET http rules can be hedged", selector)
+		}
+		if method.BackendInfo.RetryNum == 0 {
+			return fmt.Errorf("error processing operation hedging threshold for operation (%v): hedged requests count as retries, backend_retry_num must be positive", selector)
+		}
+
+		// BackendInfo may be shared with other methods, copy it to only hedge
+		// this operation.
+		backendInfo := *method.BackendInfo
+		backendInfo.HedgeThreshold = hedgeThreshold
+		method.BackendInfo = &backendInfo
+	}
+
+	return nil
+}
+
+// Put the operations into maintenance mode, their requests are rejected by the
+// proxy directly. The methods generated by ESPv2 are not affected by '*'.
+func (s *ServiceInfo) processMaintenance() error {
+	if s.Options.MaintenanceSelectors == "" {
+		return nil
+	}
+
+	for _, selector := range strings.Split(s.Options.MaintenanceSelectors, ",") {
+		selector = strings.TrimSpace(selector)
+		switch selector {
+		case "":
+			continue
+		case "*":
+			for _, method := range s.Methods {
+				if !method.IsGenerated {
+					method.InMaintenance = true
+				}
+			}
+		default:
+			method, err := s.getMethod(selector)
+			if err != nil {
+				return fmt.Errorf("error processing maintenance selectors: %v", err)
+			}
+			method.InMaintenance = true
+		}
+	}
+
+	return nil
+}
+
+// Stage the launch of the operations by the x-google-feature-gate extension,
+// their requests not let through are rejected by the proxy.
+func (s *ServiceInfo) processFeatureGates() error {
+	operations, err := openAPIOperations(s.serviceConfig)
+	if err != nil {
+		return fmt.Errorf("error processing x-google-feature-gate: %v", err)
+	}
+
+	for selector, operation := range operations {
+		if operation.FeatureGate == nil || !s.isAPIAllowed(selector) {
+			continue
+		}
+		method, err := s.getMethod(selector)
+		if err != nil {
+			return fmt.Errorf("error processing x-google-feature-gate of operation (%v): %v", operation.OperationId, err)
+		}
+		if method.FeatureGate, err = makeFeatureGate(operation.FeatureGate); err != nil {
+			return fmt.Errorf("error processing x-google-feature-gate of operation (%v): %v", selector, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *ServiceInfo) processStatusOverrides() error {
+	if s.Options.TranscodingStatusOverrides == "" {
+		return nil
+	}
+
+	for _, selectorOverrides := range strings.Split(s.Options.TranscodingStatusOverrides, ";") {
+		if selectorOverrides == "" {
+			continue
+		}
+		selectorAndOverrides := strings.SplitN(selectorOverrides, "=", 2)
+		if len(selectorAndOverrides) != 2 {
+			return fmt.Errorf("invalid transcoding status overrides: %v, should be in selector=overrides format", selectorOverrides)
+		}
+
+		selector := strings.TrimSpace(selectorAndOverrides[0])
+		method, err := s.getMethod(selector)
+		if err != nil {
+			return fmt.Errorf("error processing transcoding status overrides: %v", err)
+		}
+		if method.StatusOverrides, err = parseStatusOverrides(selectorAndOverrides[1]); err != nil {
+			return fmt.Errorf("invalid transcoding status overrides for operation (%v): %v", selector, err)
+		}
+	}
+
+	return nil
+}
+
+// Limit the request body size of the operations by --max_request_bytes, and
+// the overrides of the specified operations. The streaming operations are not
+// limited, since the whole request body has to be buffered.
+func (s *ServiceInfo) processMaxRequestBytes() error {
+	if s.Options.MaxRequestBytes < 0 || s.Options.MaxRequestBytes > math.MaxUint32 {
+		return fmt.Errorf("invalid max request bytes: %v, should be between 0 and %v", s.Options.MaxRequestBytes, uint32(math.MaxUint32))
+	}
+	for _, operation := range s.Operations {
+		if method := s.Methods[operation]; !method.IsStreaming {
+			method.MaxRequestBytes = uint32(s.Options.MaxRequestBytes)
+		}
+	}
+
+	for _, limit := range strings.Split(s.Options.OperationMaxRequestBytes, ";") {
+		if limit == "" {
+			continue
+		}
+		selectorAndValue := strings.Split(limit, "=")
+		if len(selectorAndValue) != 2 {
+			return fmt.Errorf("invalid operation max request bytes: %v, should be in selector=value format", limit)
+		}
+
+		selector := strings.TrimSpace(selectorAndValue[0])
+		maxRequestBytes, err := strconv.ParseUint(strings.TrimSpace(selectorAndValue[1]), 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid operation max request bytes for operation (%v): %v, should be a non-negative integer", selector, selectorAndValue[1])
+		}
+
+		method, err := s.getMethod(selector)
+		if err != nil {
+			return fmt.Errorf("error processing operation max request bytes: %v", err)
+		}
+		if method.IsStreaming && maxRequestBytes > 0 {
+			return fmt.Errorf("invalid operation max request bytes for operation (%v): the streaming operation cannot be limited", selector)
+		}
+		method.MaxRequestBytes = uint32(maxRequestBytes)
+	}
+
+	return nil
+}
+
+// Authorize the requests to the specified operations by the claims of the
+// verified JWT, beyond requiring a valid JWT.
+func (s *ServiceInfo) processClaimRequirements() error {
+	if s.Options.JwtClaimRequirements == "" {
+		return nil
+	}
+
+	for _, selectorRequirements := range strings.Split(s.Options.JwtClaimRequirements, ";") {
+		if selectorRequirements == "" {
+			continue
+		}
+		selectorAndRequirements := strings.SplitN(selectorRequirements, "=", 2)
+		if len(selectorAndRequirements) != 2 {
+			return fmt.Errorf("invalid jwt claim requirements: %v, should be in selector=requirements format", selectorRequirements)
+		}
+
+		selector := strings.TrimSpace(selectorAndRequirements[0])
+		method, err := s.getMethod(selector)
+		if err != nil {
+			return fmt.Errorf("error processing jwt claim requirements: %v", err)
+		}
+		if !method.RequireAuth {
+			return fmt.Errorf("invalid jwt claim requirements for operation (%v): the operation does not require a JWT", selector)
+		}
+		if method.ClaimRequirements, err = parseClaimRequirements(selectorAndRequirements[1]); err != nil {
+			return fmt.Errorf("invalid jwt claim requirements for operation (%v): %v", selector, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *ServiceInfo) processBackendCredentials() error {
+	if s.Options.BackendCredentials == "" {
+		return nil
+	}
+
+	for _, selectorCredential := range strings.Split(s.Options.BackendCredentials, ";") {
+		if selectorCredential == "" {
+			continue
+		}
+		selectorAndCredential := strings.SplitN(selectorCredential, "=", 2)
+		if len(selectorAndCredential) != 2 {
+			return fmt.Errorf("invalid backend credential: %v, should be in selector=credential format", selectorCredential)
+		}
+
+		selector := strings.TrimSpace(selectorAndCredential[0])
+		method, err := s.getMethod(selector)
+		if err != nil {
+			return fmt.Errorf("error processing backend credentials: %v", err)
+		}
+		credential, err := parseBackendCredential(selectorAndCredential[1])
+		if err != nil {
+			return fmt.Errorf("invalid backend credential for operation (%v): %v", selector, err)
+		}
+		// The Google ID token of the backend auth is sent in the authorization
+		// header as well.
+		if method.BackendInfo != nil && method.BackendInfo.JwtAudience != "" && credential.Header == "authorization" {
+			return fmt.Errorf("backend credential for operation (%v) conflicts with the backend auth, disable it with disable_auth in the backend rule", selector)
+		}
+		method.BackendCredential = credential
+	}
+
+	return nil
+}
+
+// Relax the deadline of the long-running operation polling method, and let it
+// inherit the API key settings of the methods returning the operations.
+func (s *ServiceInfo) processLongRunningOperations() {
+	pollingMethod := s.Methods[util.LongRunningGetOperation]
+	if pollingMethod == nil {
+		return
+	}
+
+	var lroMethods []*MethodInfo
+	for _, operation := range s.Operations {
+		if method := s.Methods[operation]; method.IsLongRunning && method != pollingMethod {
+			lroMethods = append(lroMethods, method)
+		}
+	}
+	if len(lroMethods) == 0 {
+		return
+	}
+
+	if s.Options.LroPollingDeadline > 0 {
+		// BackendInfo may be shared with the auto-generated methods, copy it
+		// to only relax the polling method.
+		backendInfo := *pollingMethod.BackendInfo
+		backendInfo.Deadline = s.Options.LroPollingDeadline
+		backendInfo.IdleTimeout = calculateStreamIdleTimeout(s.Options.LroPollingDeadline, s.Options)
+		pollingMethod.BackendInfo = &backendInfo
+	}
+
+	if s.Options.LroPollingInheritApiKey {
+		allowUnregisteredCalls := true
+		apiKeyLocations := lroMethods[0].ApiKeyLocations
+		for _, method := range lroMethods {
+			allowUnregisteredCalls = allowUnregisteredCalls && method.AllowUnregisteredCalls
+			if !reflect.DeepEqual(method.ApiKeyLocations, apiKeyLocations) {
+				glog.Warningf("Skip inheriting API key locations for %q because the long-running methods have different ones.", util.LongRunningGetOperation)
+				apiKeyLocations = nil
+				break
+			}
+		}
+
+		if allowUnregisteredCalls {
+			pollingMethod.AllowUnregisteredCalls = true
+		}
+		if pollingMethod.ApiKeyLocations == nil {
+			pollingMethod.ApiKeyLocations = apiKeyLocations
+		}
+	}
+}
+
+func (s *ServiceInfo) getBackendRoutingCluster(clusterName string) *BackendRoutingCluster {
+	if s.LocalBackendCluster.ClusterName == clusterName {
+		return s.LocalBackendCluster
+	}
+	for _, cluster := range s.RemoteBackendClusters {
+		if cluster.ClusterName == clusterName {
+			return cluster
+		}
+	}
+	return nil
+}
+
+func (s *ServiceInfo) getBackendRoutingClustersByAddress(address string) []*BackendRoutingCluster {
+	var clusters []*BackendRoutingCluster
+	for _, cluster := range append([]*BackendRoutingCluster{s.LocalBackendCluster}, s.RemoteBackendClusters...) {
+		if net.JoinHostPort(cluster.Hostname, strconv.Itoa(int(cluster.Port))) == address {
+			clusters = append(clusters, cluster)
+		}
+	}
+	return clusters
+}
+
 func (s *ServiceInfo) processLocalBackendOperations() error {
 
 	// For methods that are not associated with any backend rules, create one
@@ -943,6 +1790,179 @@ func (s *ServiceInfo) processAuthRequirement() error {
 	return nil
 }
 
+// Allow the requests to the operations without a JWT or with a JWT failing the
+// verification, e.g. for the operations serving both anonymous and
+// authenticated users.
+func (s *ServiceInfo) processJwtAllowMissingOrFailed() error {
+	if s.Options.JwtAllowMissingOrFailedSelectors == "" {
+		return nil
+	}
+
+	for _, selector := range strings.Split(s.Options.JwtAllowMissingOrFailedSelectors, ",") {
+		selector = strings.TrimSpace(selector)
+		if selector == "" {
+			continue
+		}
+		method, err := s.getMethod(selector)
+		if err != nil {
+			return fmt.Errorf("error processing jwt allow missing or failed selectors: %v", err)
+		}
+		if !method.RequireAuth {
+			return fmt.Errorf("invalid jwt allow missing or failed selector (%v): the operation does not require a JWT", selector)
+		}
+		method.AllowMissingOrFailedJwt = true
+	}
+	return nil
+}
+
+// Override the auth requirements of the operations for the requests to the
+// hostnames of their x-google-host-security extensions, e.g. to trust
+// different JWT providers on the public and the partner hostnames. Any of the
+// security requirements of a hostname is accepted, each with a JWT provider,
+// and an empty list requires no JWT.
+func (s *ServiceInfo) processHostAuthRequirements() error {
+	operations, err := openAPIOperations(s.serviceConfig)
+	if err != nil {
+		return fmt.Errorf("error processing x-google-host-security: %v", err)
+	}
+
+	providers := make(map[string]bool)
+	for _, provider := range s.serviceConfig.GetAuthentication().GetProviders() {
+		providers[provider.GetId()] = true
+	}
+
+	for selector, operation := range operations {
+		if len(operation.HostSecurity) == 0 || !s.isAPIAllowed(selector) {
+			continue
+		}
+		if _, err := s.getMethod(selector); err != nil {
+			return fmt.Errorf("error processing x-google-host-security of operation (%v): %v", operation.OperationId, err)
+		}
+
+		for host, security := range operation.HostSecurity {
+			host = strings.ToLower(host)
+			requirements := []*confpb.AuthRequirement{}
+			for _, requirement := range security {
+				if len(requirement) != 1 {
+					return fmt.Errorf("error processing x-google-host-security of operation (%v) for host (%v): security requirement %v should have exactly one JWT provider", selector, host, requirement)
+				}
+				for providerId := range requirement {
+					if !providers[providerId] {
+						return fmt.Errorf("error processing x-google-host-security of operation (%v) for host (%v): provider (%v) was not defined in the authentication providers", selector, host, providerId)
+					}
+					requirements = append(requirements, &confpb.AuthRequirement{
+						ProviderId: providerId,
+					})
+				}
+			}
+
+			if s.HostAuthRequirements == nil {
+				s.HostAuthRequirements = make(map[string]map[string][]*confpb.AuthRequirement)
+			}
+			if s.HostAuthRequirements[host] == nil {
+				s.HostAuthRequirements[host] = make(map[string][]*confpb.AuthRequirement)
+			}
+			s.HostAuthRequirements[host][selector] = requirements
+		}
+	}
+	return nil
+}
+
+// All the authentication rules of an operation are required, e.g. a rule for
+// the JWT of the end user and another for the JWT of the calling service. The
+// JWTs required together must be in distinct locations, and the payload of the
+// JWT of the first rule is the one forwarded and reported as the caller.
+func (s *ServiceInfo) processJwtConjunctions() error {
+	providers := make(map[string]*confpb.AuthProvider)
+	for _, provider := range s.serviceConfig.GetAuthentication().GetProviders() {
+		providers[provider.GetId()] = provider
+	}
+
+	var selectors []string
+	rules := make(map[string][]*confpb.AuthenticationRule)
+	for _, rule := range s.serviceConfig.GetAuthentication().GetRules() {
+		if len(rule.GetRequirements()) == 0 || !s.isAPIAllowed(rule.GetSelector()) {
+			continue
+		}
+		if rules[rule.GetSelector()] == nil {
+			selectors = append(selectors, rule.GetSelector())
+		}
+		rules[rule.GetSelector()] = append(rules[rule.GetSelector()], rule)
+	}
+
+	callerProviders := make(map[string]string)
+	for _, selector := range selectors {
+		for _, requirement := range rules[selector][0].GetRequirements() {
+			callerProviders[requirement.GetProviderId()] = selector
+		}
+
+		locations := make(map[string]string)
+		for _, rule := range rules[selector] {
+			ruleLocations := make(map[string]string)
+			for _, requirement := range rule.GetRequirements() {
+				for _, location := range jwtLocationNames(providers[requirement.GetProviderId()]) {
+					if providerId, ok := locations[location]; ok {
+						return fmt.Errorf("error processing authentication rules for operation (%v): providers (%v) and (%v) are required together but both read the JWT from %v, set distinct jwt_locations for them", selector, providerId, requirement.GetProviderId(), location)
+					}
+					ruleLocations[location] = requirement.GetProviderId()
+				}
+			}
+			for location, providerId := range ruleLocations {
+				locations[location] = providerId
+			}
+		}
+	}
+	for _, hostRequirements := range s.HostAuthRequirements {
+		for selector, requirements := range hostRequirements {
+			for _, requirement := range requirements {
+				callerProviders[requirement.GetProviderId()] = selector
+			}
+		}
+	}
+
+	for _, selector := range selectors {
+		for _, rule := range rules[selector][1:] {
+			for _, requirement := range rule.GetRequirements() {
+				if callerSelector, ok := callerProviders[requirement.GetProviderId()]; ok {
+					return fmt.Errorf("error processing authentication rules for operation (%v): provider (%v) is required together with the JWT of the caller, and cannot be the JWT of the caller of operation (%v)", selector, requirement.GetProviderId(), callerSelector)
+				}
+				if s.AdditionalJwtProviders == nil {
+					s.AdditionalJwtProviders = make(map[string]bool)
+				}
+				s.AdditionalJwtProviders[requirement.GetProviderId()] = true
+			}
+			if s.AdditionalAuthRules == nil {
+				s.AdditionalAuthRules = make(map[string][]*confpb.AuthenticationRule)
+			}
+			s.AdditionalAuthRules[selector] = append(s.AdditionalAuthRules[selector], rule)
+		}
+	}
+	return nil
+}
+
+// jwtLocationNames returns the headers and the query parameters the JWT of the
+// provider is read from.
+func jwtLocationNames(provider *confpb.AuthProvider) []string {
+	if len(provider.GetJwtLocations()) == 0 {
+		return []string{
+			fmt.Sprintf("header %v", strings.ToLower(util.DefaultJwtHeaderNameAuthorization)),
+			fmt.Sprintf("header %v", strings.ToLower(util.DefaultJwtHeaderNameXGoogleIapJwtAssertion)),
+			fmt.Sprintf("query parameter %v", util.DefaultJwtQueryParamAccessToken),
+		}
+	}
+
+	var names []string
+	for _, jwtLocation := range provider.GetJwtLocations() {
+		switch jwtLocation.In.(type) {
+		case *confpb.JwtLocation_Header:
+			names = append(names, fmt.Sprintf("header %v", strings.ToLower(jwtLocation.GetHeader())))
+		case *confpb.JwtLocation_Query:
+			names = append(names, fmt.Sprintf("query parameter %v", jwtLocation.GetQuery()))
+		}
+	}
+	return names
+}
+
 func (s *ServiceInfo) isAPIAllowed(str string) bool {
 	// TODO(b/184393425): API discovery is not supported yet.
 	if strings.HasPrefix(str, "google.discovery") {
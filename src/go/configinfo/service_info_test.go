@@ -22,6 +22,7 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -2238,8 +2239,7 @@ func TestProcessBackendRuleForProtocol(t *testing.T) {
 			},
 		},
 		{
-			// This case is not supported in practice, but we shouldn't break ordering if a user does it.
-			desc: "When multiple backend rules with the same address have different protocols, only first one is used",
+			desc: "When multiple backend rules with the same address have different protocols, separate clusters are used",
 			fakeServiceConfig: &confpb.Service{
 				Apis: []*apipb.Api{
 					{
@@ -2270,7 +2270,43 @@ func TestProcessBackendRuleForProtocol(t *testing.T) {
 				},
 			},
 			wantedClusterProtocols: map[string]util.BackendProtocol{
-				"backend-cluster-abc.com:443": util.HTTP1,
+				"backend-cluster-abc.com:443":       util.HTTP1,
+				"backend-cluster-abc.com:443_http2": util.HTTP2,
+			},
+		},
+		{
+			desc: "Backend rules with the same address and protocol share the cluster",
+			fakeServiceConfig: &confpb.Service{
+				Apis: []*apipb.Api{
+					{
+						Name: "api.test",
+						Methods: []*apipb.Method{
+							{
+								Name: "1",
+							},
+							{
+								Name: "2",
+							},
+						},
+					},
+				},
+				Backend: &confpb.Backend{
+					Rules: []*confpb.BackendRule{
+						{
+							Address:  "http://abc.com/api/",
+							Selector: "api.test.1",
+							Protocol: "h2",
+						},
+						{
+							Address:  "http://abc.com/api/",
+							Selector: "api.test.2",
+							Protocol: "h2",
+						},
+					},
+				},
+			},
+			wantedClusterProtocols: map[string]util.BackendProtocol{
+				"backend-cluster-abc.com:80": util.HTTP2,
 			},
 		},
 	}
@@ -2285,6 +2321,9 @@ func TestProcessBackendRuleForProtocol(t *testing.T) {
 				return
 			}
 
+			if len(s.RemoteBackendClusters) != len(tc.wantedClusterProtocols) {
+				t.Errorf("Test Desc(%s): got %d backend routing clusters, want %d", tc.desc, len(s.RemoteBackendClusters), len(tc.wantedClusterProtocols))
+			}
 			for _, gotBackendRoutingCluster := range s.RemoteBackendClusters {
 				gotProtocol := gotBackendRoutingCluster.Protocol
 				wantProtocol, ok := tc.wantedClusterProtocols[gotBackendRoutingCluster.ClusterName]
@@ -2388,6 +2427,21 @@ func TestProcessBackendRuleForClusterName(t *testing.T) {
 			Address:     "grpcs://127.0.0.1:8080/api/",
 			ClusterName: "backend-cluster-127.0.0.1:8080",
 		},
+		{
+			desc:        "Uppercase domain name",
+			Address:     "HTTPS://ABC.com/api/",
+			ClusterName: "backend-cluster-abc.com:443",
+		},
+		{
+			desc:        "Internationalized domain name",
+			Address:     "https://bücher.com/api/",
+			ClusterName: "backend-cluster-xn--bcher-kva.com:443",
+		},
+		{
+			desc:        "Domain name with empty port",
+			Address:     "grpc://abc.com:/api/",
+			ClusterName: "backend-cluster-abc.com:80",
+		},
 	}
 
 	for _, tc := range testData {
@@ -2962,179 +3016,1840 @@ func TestBackendAddressOverride(t *testing.T) {
 	}
 }
 
-func TestProcessQuota(t *testing.T) {
+func TestProcessOperationMaxConcurrency(t *testing.T) {
 	testData := []struct {
-		desc              string
-		fakeServiceConfig *confpb.Service
-		wantMethods       map[string]*MethodInfo
-		wantError         string
+		desc                    string
+		operationMaxConcurrency string
+		// Map of selector to the expected backend cluster.
+		wantedMethodBackendCluster map[string]string
+		wantOperationClusters      []*BackendRoutingCluster
+		wantError                  string
 	}{
 		{
-			desc: "Succeed, simple case",
-			fakeServiceConfig: &confpb.Service{
+			desc: "No limits, all operations use the shared backend clusters",
+			wantedMethodBackendCluster: map[string]string{
+				"abc.com.a": "backend-cluster-abc.com:80",
+				"abc.com.b": "backend-cluster-echo.endpoints_local",
+			},
+		},
+		{
+			desc:                    "Limits for both remote and local backend operations",
+			operationMaxConcurrency: "abc.com.a=10;abc.com.b=100",
+			wantedMethodBackendCluster: map[string]string{
+				"abc.com.a": "backend-cluster-abc.com:80_abc.com.a",
+				"abc.com.b": "backend-cluster-echo.endpoints_local_abc.com.b",
+			},
+			wantOperationClusters: []*BackendRoutingCluster{
+				{
+					ClusterName: "backend-cluster-abc.com:80_abc.com.a",
+					Hostname:    "abc.com",
+					Port:        80,
+					Protocol:    util.GRPC,
+					MaxRequests: 10,
+				},
+				{
+					ClusterName: "backend-cluster-echo.endpoints_local_abc.com.b",
+					Hostname:    "127.0.0.1",
+					Port:        8082,
+					Protocol:    util.HTTP1,
+					MaxRequests: 100,
+				},
+			},
+		},
+		{
+			desc:                    "Wrong format",
+			operationMaxConcurrency: "abc.com.a:10",
+			wantError:               "invalid operation max concurrency: abc.com.a:10, should be in selector=value format",
+		},
+		{
+			desc:                    "Non-positive limit",
+			operationMaxConcurrency: "abc.com.a=0",
+			wantError:               "invalid operation max concurrency for operation (abc.com.a): 0, should be a positive integer",
+		},
+		{
+			desc:                    "Duplicate selector",
+			operationMaxConcurrency: "abc.com.a=10;abc.com.b=20;abc.com.a=30",
+			wantError:               "duplicate operation max concurrency for operation (abc.com.a)",
+		},
+		{
+			desc:                    "Unknown selector",
+			operationMaxConcurrency: "abc.com.c=10",
+			wantError:               "error processing operation max concurrency: selector (abc.com.c) was not defined in the API",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeServiceConfig := &confpb.Service{
+				Name: "echo.endpoints",
 				Apis: []*apipb.Api{
 					{
-						Name: testApiName,
+						Name: "abc.com",
 						Methods: []*apipb.Method{
 							{
-								Name: "ListShelves",
+								Name: "a",
+							},
+							{
+								Name: "b",
 							},
 						},
 					},
 				},
-				Quota: &confpb.Quota{
-					MetricRules: []*confpb.MetricRule{
+				Backend: &confpb.Backend{
+					Rules: []*confpb.BackendRule{
 						{
-							Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
-							MetricCosts: map[string]int64{
-								"metric_a": 2,
-								"metric_b": 1,
-							},
+							Address:  "grpc://abc.com/a/",
+							Selector: "abc.com.a",
 						},
 					},
 				},
+			}
+
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.OperationMaxConcurrency = tc.operationMaxConcurrency
+			s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+
+			if err != nil {
+				if tc.wantError == "" || err.Error() != tc.wantError {
+					t.Errorf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("want error: %v, got no error", tc.wantError)
+			}
+
+			for operation, mi := range s.Methods {
+				gotBackendCluster := mi.BackendInfo.ClusterName
+				wantBackendCluster := tc.wantedMethodBackendCluster[operation]
+
+				if gotBackendCluster != wantBackendCluster {
+					t.Errorf("Backend cluster name not expected, got: %v, want: %v", gotBackendCluster, wantBackendCluster)
+				}
+			}
+
+			if !reflect.DeepEqual(s.OperationBackendClusters, tc.wantOperationClusters) {
+				t.Errorf("OperationBackendClusters not expected, got: %+v, want: %+v", s.OperationBackendClusters, tc.wantOperationClusters)
+			}
+		})
+	}
+}
+
+func TestProcessBackendHttpProtocolOptions(t *testing.T) {
+	testData := []struct {
+		desc                       string
+		backendMaxRequestHeadersKb string
+		backendEnableTrailers      string
+		wantMaxRequestHeadersKb    map[string]uint32
+		wantLocalCluster           *BackendRoutingCluster
+		wantRemoteClusters         []*BackendRoutingCluster
+		wantError                  string
+	}{
+		{
+			desc: "No limits",
+			wantMaxRequestHeadersKb: map[string]uint32{
+				"abc.com.a": 0,
+				"abc.com.b": 0,
+				"abc.com.c": 0,
+			},
+			wantLocalCluster: &BackendRoutingCluster{
+				ClusterName: "backend-cluster-echo.endpoints_local",
+				Hostname:    "127.0.0.1",
+				Port:        8082,
+				Protocol:    util.HTTP1,
+			},
+			wantRemoteClusters: []*BackendRoutingCluster{
+				{
+					ClusterName: "backend-cluster-abc.com:80",
+					Hostname:    "abc.com",
+					Port:        80,
+					Protocol:    util.GRPC,
+				},
+				{
+					ClusterName: "backend-cluster-abc.com:80_http1",
+					Hostname:    "abc.com",
+					Port:        80,
+					Protocol:    util.HTTP1,
+				},
 			},
-			wantMethods: map[string]*MethodInfo{
-				fmt.Sprintf("%s.%s", testApiName, "ListShelves"): &MethodInfo{
-					ShortName: "ListShelves",
-					ApiName:   testApiName,
-					HttpRule: []*httppattern.Pattern{
-						{
-							UriTemplate: parseUriTemplate(fmt.Sprintf("/%s/%s", testApiName, "ListShelves")),
-							HttpMethod:  util.POST,
-						},
-					},
-					MetricCosts: []*scpb.MetricCost{
-						{
-							Name: "metric_a",
-							Cost: 2,
-						},
-						{
-							Name: "metric_b",
-							Cost: 1,
-						},
-					},
+		},
+		{
+			desc:                       "Limits for both remote and local backends",
+			backendMaxRequestHeadersKb: "abc.com:80=32; 127.0.0.1:8082=16",
+			backendEnableTrailers:      "127.0.0.1:8082, abc.com:80",
+			wantMaxRequestHeadersKb: map[string]uint32{
+				"abc.com.a": 32,
+				"abc.com.b": 16,
+				// The limit applies to all the protocol clusters of the backend.
+				"abc.com.c": 32,
+			},
+			wantLocalCluster: &BackendRoutingCluster{
+				ClusterName:    "backend-cluster-echo.endpoints_local",
+				Hostname:       "127.0.0.1",
+				Port:           8082,
+				Protocol:       util.HTTP1,
+				EnableTrailers: true,
+			},
+			wantRemoteClusters: []*BackendRoutingCluster{
+				{
+					ClusterName:    "backend-cluster-abc.com:80",
+					Hostname:       "abc.com",
+					Port:           80,
+					Protocol:       util.GRPC,
+					EnableTrailers: true,
+				},
+				{
+					ClusterName:    "backend-cluster-abc.com:80_http1",
+					Hostname:       "abc.com",
+					Port:           80,
+					Protocol:       util.HTTP1,
+					EnableTrailers: true,
 				},
 			},
 		},
 		{
-			desc: "Succeed, two metric cost items",
-			fakeServiceConfig: &confpb.Service{
+			desc:                       "Wrong format",
+			backendMaxRequestHeadersKb: "abc.com:80",
+			wantError:                  "invalid backend max request headers kb: abc.com:80, should be in address=value format",
+		},
+		{
+			desc:                       "Non-positive limit",
+			backendMaxRequestHeadersKb: "abc.com:80=0",
+			wantError:                  "invalid backend max request headers kb for backend (abc.com:80): 0, should be a positive integer",
+		},
+		{
+			desc:                       "Unknown backend for max request headers kb",
+			backendMaxRequestHeadersKb: "abc.com:443=32",
+			wantError:                  "error processing backend max request headers kb: backend (abc.com:443) not found",
+		},
+		{
+			desc:                  "Unknown backend for trailers",
+			backendEnableTrailers: "127.0.0.1:8080",
+			wantError:             "error processing backend enable trailers: backend (127.0.0.1:8080) not found",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeServiceConfig := &confpb.Service{
+				Name: "echo.endpoints",
 				Apis: []*apipb.Api{
 					{
-						Name: testApiName,
+						Name: "abc.com",
 						Methods: []*apipb.Method{
 							{
-								Name: "ListShelves",
+								Name: "a",
 							},
-						},
-					},
-				},
-				Quota: &confpb.Quota{
-					MetricRules: []*confpb.MetricRule{
-						{
-							Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
-							MetricCosts: map[string]int64{
-								"metric_c": 2,
-								"metric_a": 3,
+							{
+								Name: "b",
+							},
+							{
+								Name: "c",
 							},
 						},
 					},
 				},
-			},
-			wantMethods: map[string]*MethodInfo{
-				fmt.Sprintf("%s.%s", testApiName, "ListShelves"): &MethodInfo{
-					ShortName: "ListShelves",
-					ApiName:   testApiName,
-					HttpRule: []*httppattern.Pattern{
-						{
-							UriTemplate: parseUriTemplate(fmt.Sprintf("/%s/%s", testApiName, "ListShelves")),
-							HttpMethod:  util.POST,
-						},
-					},
-					MetricCosts: []*scpb.MetricCost{
-						{
-							Name: "metric_a",
-							Cost: 3,
-						},
+				Backend: &confpb.Backend{
+					Rules: []*confpb.BackendRule{
 						{
-							Name: "metric_c",
-							Cost: 2,
+							Address:  "grpc://abc.com/a/",
+							Selector: "abc.com.a",
 						},
-					},
-				},
-			},
-		},
-		{
-			desc: "Typo in operation name does not crash",
-			fakeServiceConfig: &confpb.Service{
-				Apis: []*apipb.Api{
-					{
-						Name: testApiName,
-					},
-				},
-				Quota: &confpb.Quota{
-					MetricRules: []*confpb.MetricRule{
 						{
-							Selector: "endpoints.examples.bookstore.Bookstore.BadOperationName",
-							MetricCosts: map[string]int64{
-								"metric_a": 2,
-								"metric_b": 1,
-							},
+							Address:  "http://abc.com/c/",
+							Selector: "abc.com.c",
 						},
 					},
 				},
-			},
-			wantError: "error processing quota metric rule: selector (endpoints.examples.bookstore.Bookstore.BadOperationName) was not defined in the API",
-		},
-	}
+			}
 
-	for _, tc := range testData {
-		t.Run(tc.desc, func(t *testing.T) {
 			opts := options.DefaultConfigGeneratorOptions()
-			opts.BackendAddress = "grpc://127.0.0.1:80"
-			serviceInfo, err := NewServiceInfoFromServiceConfig(tc.fakeServiceConfig, testConfigID, opts)
+			opts.BackendMaxRequestHeadersKb = tc.backendMaxRequestHeadersKb
+			opts.BackendEnableTrailers = tc.backendEnableTrailers
+			s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
 
 			if err != nil {
-				if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
-					t.Fatalf("error mismatch, \ngot : %s, \nwant: %s", err.Error(), tc.wantError)
+				if tc.wantError == "" || err.Error() != tc.wantError {
+					t.Errorf("got error: %v, want error: %v", err, tc.wantError)
 				}
 				return
 			}
+			if tc.wantError != "" {
+				t.Fatalf("want error: %v, got no error", tc.wantError)
+			}
 
-			for key, gotMethod := range serviceInfo.Methods {
-				wantMethod := tc.wantMethods[key]
-
-				// We're not testing backend info here.
-				gotMethod.BackendInfo = nil
-
-				sort.Slice(gotMethod.MetricCosts, func(i, j int) bool { return gotMethod.MetricCosts[i].Name < gotMethod.MetricCosts[j].Name })
-				if eq := cmp.Equal(gotMethod, wantMethod, cmp.Comparer(proto.Equal)); !eq {
-					t.Errorf("Method mismatch \ngot : %+v,\nwant: %+v", gotMethod, wantMethod)
+			for operation, want := range tc.wantMaxRequestHeadersKb {
+				if got := s.Methods[operation].BackendInfo.MaxRequestHeadersKb; got != want {
+					t.Errorf("MaxRequestHeadersKb of %v not expected, got: %v, want: %v", operation, got, want)
 				}
 			}
+			if !reflect.DeepEqual(s.LocalBackendCluster, tc.wantLocalCluster) {
+				t.Errorf("LocalBackendCluster not expected, got: %+v, want: %+v", s.LocalBackendCluster, tc.wantLocalCluster)
+			}
+			if !reflect.DeepEqual(s.RemoteBackendClusters, tc.wantRemoteClusters) {
+				t.Errorf("RemoteBackendClusters not expected, got: %+v, want: %+v", s.RemoteBackendClusters, tc.wantRemoteClusters)
+			}
 		})
 	}
 }
 
-func TestProcessEmptyJwksUriByOpenID(t *testing.T) {
-	r := mux.NewRouter()
-	jwksUriEntry, _ := json.Marshal(map[string]string{"jwks_uri": "this-is-jwksUri"})
-	r.Path(util.OpenIDDiscoveryCfgURLSuffix).Methods("GET").Handler(
-		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Write(jwksUriEntry)
-		}))
-	openIDServer := httptest.NewServer(r)
-
+func TestProcessBackendLocalityEndpoints(t *testing.T) {
 	testData := []struct {
-		desc                 string
-		fakeServiceConfig    *confpb.Service
-		disableOidcDiscovery bool
-		wantedJwksUri        string
-		wantErr              bool
+		desc                     string
+		backendLocalityLb        string
+		backendLocalityEndpoints string
+		wantLocalityEndpoints    []*LocalityEndpoint
+		wantError                string
 	}{
 		{
-			desc: "Success, empty JWKS URI, so it's acquired using OpenID Connect Discovery.",
+			desc: "No locality endpoints",
+		},
+		{
+			desc:                     "Locality endpoints of the remote backend",
+			backendLocalityLb:        "zone_aware",
+			backendLocalityEndpoints: "abc.com:80=us-central1-a/10.0.0.2:8080, us-central1-b/backend-b.internal:8080",
+			wantLocalityEndpoints: []*LocalityEndpoint{
+				{
+					Zone:     "us-central1-a",
+					Hostname: "10.0.0.2",
+					Port:     8080,
+				},
+				{
+					Zone:     "us-central1-b",
+					Hostname: "backend-b.internal",
+					Port:     8080,
+				},
+			},
+		},
+		{
+			desc:                     "Endpoint without zone",
+			backendLocalityEndpoints: "abc.com:80=10.0.0.2:8080",
+			wantError:                "invalid locality endpoint of backend (abc.com:80): 10.0.0.2:8080, should be in zone/endpoint_address format",
+		},
+		{
+			desc:                     "Endpoint without port",
+			backendLocalityEndpoints: "abc.com:80=us-central1-a/10.0.0.2",
+			wantError:                "invalid locality endpoint of backend (abc.com:80): us-central1-a/10.0.0.2, address 10.0.0.2: missing port in address",
+		},
+		{
+			desc:                     "Unknown backend",
+			backendLocalityEndpoints: "abc.com:443=us-central1-a/10.0.0.2:8080",
+			wantError:                "error processing backend locality endpoints: backend (abc.com:443) not found",
+		},
+		{
+			desc:              "Locality aware load balancing without locality endpoints",
+			backendLocalityLb: "locality_weighted",
+			wantError:         "backend_locality_lb requires the backend endpoints in their zones, set them with --backend_locality_endpoints",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeServiceConfig := &confpb.Service{
+				Name: "echo.endpoints",
+				Apis: []*apipb.Api{
+					{
+						Name: "abc.com",
+						Methods: []*apipb.Method{
+							{
+								Name: "a",
+							},
+						},
+					},
+				},
+				Backend: &confpb.Backend{
+					Rules: []*confpb.BackendRule{
+						{
+							Address:  "grpc://abc.com/a/",
+							Selector: "abc.com.a",
+						},
+					},
+				},
+			}
+
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.BackendLocalityLb = tc.backendLocalityLb
+			opts.BackendLocalityEndpoints = tc.backendLocalityEndpoints
+			s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				if tc.wantError == "" || err.Error() != tc.wantError {
+					t.Errorf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("want error: %v, got no error", tc.wantError)
+			}
+
+			if len(s.LocalBackendCluster.LocalityEndpoints) != 0 {
+				t.Errorf("got locality endpoints of the local backend: %+v", s.LocalBackendCluster.LocalityEndpoints)
+			}
+			if got := s.RemoteBackendClusters[0].LocalityEndpoints; !reflect.DeepEqual(got, tc.wantLocalityEndpoints) {
+				t.Errorf("locality endpoints not expected, got: %+v, want: %+v", got, tc.wantLocalityEndpoints)
+			}
+		})
+	}
+}
+
+func TestProcessOperationHedging(t *testing.T) {
+	testData := []struct {
+		desc                      string
+		operationHedgingThreshold string
+		backendRetryNum           uint
+		wantHedgeThresholds       map[string]time.Duration
+		wantError                 string
+	}{
+		{
+			desc: "No hedging by default",
+		},
+		{
+			desc:                      "Hedging for a GET operation",
+			operationHedgingThreshold: "abc.com.a=200ms",
+			backendRetryNum:           1,
+			wantHedgeThresholds: map[string]time.Duration{
+				"abc.com.a": 200 * time.Millisecond,
+			},
+		},
+		{
+			desc:                      "Wrong format",
+			operationHedgingThreshold: "abc.com.a:200ms",
+			backendRetryNum:           1,
+			wantError:                 "invalid operation hedging threshold: abc.com.a:200ms, should be in selector=value format",
+		},
+		{
+			desc:                      "Non-positive threshold",
+			operationHedgingThreshold: "abc.com.a=0s",
+			backendRetryNum:           1,
+			wantError:                 "invalid operation hedging threshold for operation (abc.com.a): 0s, should be a positive duration",
+		},
+		{
+			desc:                      "Non-idempotent operation",
+			operationHedgingThreshold: "abc.com.b=200ms",
+			backendRetryNum:           1,
+			wantError:                 "error processing operation hedging threshold for operation (abc.com.b): only methods with GET http rules can be hedged",
+		},
+		{
+			desc:                      "Retries are disabled",
+			operationHedgingThreshold: "abc.com.a=200ms",
+			wantError:                 "error processing operation hedging threshold for operation (abc.com.a): hedged requests count as retries, backend_retry_num must be positive",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeServiceConfig := &confpb.Service{
+				Name: "echo.endpoints",
+				Apis: []*apipb.Api{
+					{
+						Name: "abc.com",
+						Methods: []*apipb.Method{
+							{
+								Name: "a",
+							},
+							{
+								Name: "b",
+							},
+						},
+					},
+				},
+				Http: &annotationspb.Http{
+					Rules: []*annotationspb.HttpRule{
+						{
+							Selector: "abc.com.a",
+							Pattern: &annotationspb.HttpRule_Get{
+								Get: "/a",
+							},
+						},
+						{
+							Selector: "abc.com.b",
+							Pattern: &annotationspb.HttpRule_Post{
+								Post: "/b",
+							},
+						},
+					},
+				},
+			}
+
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.OperationHedgingThreshold = tc.operationHedgingThreshold
+			opts.BackendRetryNum = tc.backendRetryNum
+			s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+
+			if err != nil {
+				if tc.wantError == "" || err.Error() != tc.wantError {
+					t.Errorf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("want error: %v, got no error", tc.wantError)
+			}
+
+			for operation, mi := range s.Methods {
+				if got, want := mi.BackendInfo.HedgeThreshold, tc.wantHedgeThresholds[operation]; got != want {
+					t.Errorf("hedge threshold for operation %v not expected, got: %v, want: %v", operation, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessMaintenance(t *testing.T) {
+	testData := []struct {
+		desc                 string
+		maintenanceSelectors string
+		wantInMaintenance    []string
+		wantError            string
+	}{
+		{
+			desc: "No maintenance by default",
+		},
+		{
+			desc:                 "Maintenance for an operation",
+			maintenanceSelectors: "abc.com.a",
+			wantInMaintenance:    []string{"abc.com.a"},
+		},
+		{
+			desc:                 "Maintenance for the whole service",
+			maintenanceSelectors: "*",
+			wantInMaintenance:    []string{"abc.com.a", "abc.com.b"},
+		},
+		{
+			desc:                 "Unknown selector",
+			maintenanceSelectors: "abc.com.a, abc.com.c",
+			wantError:            "error processing maintenance selectors: selector (abc.com.c) was not defined in the API",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeServiceConfig := &confpb.Service{
+				Name: "echo.endpoints",
+				Apis: []*apipb.Api{
+					{
+						Name: "abc.com",
+						Methods: []*apipb.Method{
+							{
+								Name: "a",
+							},
+							{
+								Name: "b",
+							},
+						},
+					},
+				},
+			}
+
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.MaintenanceSelectors = tc.maintenanceSelectors
+			s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+
+			if err != nil {
+				if tc.wantError == "" || err.Error() != tc.wantError {
+					t.Errorf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("want error: %v, got no error", tc.wantError)
+			}
+
+			var gotInMaintenance []string
+			for operation, mi := range s.Methods {
+				if mi.InMaintenance {
+					gotInMaintenance = append(gotInMaintenance, operation)
+				}
+			}
+			sort.Strings(gotInMaintenance)
+			if !reflect.DeepEqual(gotInMaintenance, tc.wantInMaintenance) {
+				t.Errorf("operations in maintenance not expected, got: %v, want: %v", gotInMaintenance, tc.wantInMaintenance)
+			}
+		})
+	}
+}
+
+func TestProcessJwtAllowMissingOrFailed(t *testing.T) {
+	testData := []struct {
+		desc                             string
+		jwtAllowMissingOrFailedSelectors string
+		wantAllowMissingOrFailed         []string
+		wantError                        string
+	}{
+		{
+			desc: "JWT required by default",
+		},
+		{
+			desc:                             "Missing or failed JWT allowed for an operation",
+			jwtAllowMissingOrFailedSelectors: "abc.com.a",
+			wantAllowMissingOrFailed:         []string{"abc.com.a"},
+		},
+		{
+			desc:                             "Operation without JWT",
+			jwtAllowMissingOrFailedSelectors: "abc.com.a,abc.com.b",
+			wantError:                        "invalid jwt allow missing or failed selector (abc.com.b): the operation does not require a JWT",
+		},
+		{
+			desc:                             "Unknown selector",
+			jwtAllowMissingOrFailedSelectors: "abc.com.c",
+			wantError:                        "error processing jwt allow missing or failed selectors: selector (abc.com.c) was not defined in the API",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeServiceConfig := &confpb.Service{
+				Name: "echo.endpoints",
+				Apis: []*apipb.Api{
+					{
+						Name: "abc.com",
+						Methods: []*apipb.Method{
+							{
+								Name: "a",
+							},
+							{
+								Name: "b",
+							},
+						},
+					},
+				},
+				Authentication: &confpb.Authentication{
+					Providers: []*confpb.AuthProvider{
+						{
+							Id:      "end_user",
+							Issuer:  "issuer-0",
+							JwksUri: "https://fake-jwks.com",
+						},
+					},
+					Rules: []*confpb.AuthenticationRule{
+						{
+							Selector: "abc.com.a",
+							Requirements: []*confpb.AuthRequirement{
+								{
+									ProviderId: "end_user",
+								},
+							},
+						},
+					},
+				},
+			}
+
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.JwtAllowMissingOrFailedSelectors = tc.jwtAllowMissingOrFailedSelectors
+			s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				if tc.wantError == "" || err.Error() != tc.wantError {
+					t.Errorf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("want error: %v, got no error", tc.wantError)
+			}
+
+			var gotAllowMissingOrFailed []string
+			for operation, mi := range s.Methods {
+				if mi.AllowMissingOrFailedJwt {
+					gotAllowMissingOrFailed = append(gotAllowMissingOrFailed, operation)
+				}
+			}
+			sort.Strings(gotAllowMissingOrFailed)
+			if !reflect.DeepEqual(gotAllowMissingOrFailed, tc.wantAllowMissingOrFailed) {
+				t.Errorf("operations allowing missing or failed JWTs not expected, got: %v, want: %v", gotAllowMissingOrFailed, tc.wantAllowMissingOrFailed)
+			}
+		})
+	}
+}
+
+func TestProcessJwtConjunctions(t *testing.T) {
+	endUserRule := &confpb.AuthenticationRule{
+		Selector: "abc.com.a",
+		Requirements: []*confpb.AuthRequirement{
+			{
+				ProviderId: "end_user",
+			},
+		},
+	}
+	testData := []struct {
+		desc                       string
+		rules                      []*confpb.AuthenticationRule
+		wantAdditionalJwtProviders map[string]bool
+		wantError                  string
+	}{
+		{
+			desc: "Any of the providers of a rule",
+			rules: []*confpb.AuthenticationRule{
+				{
+					Selector: "abc.com.a",
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "end_user",
+						},
+						{
+							ProviderId: "partner",
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "All the rules of an operation",
+			rules: []*confpb.AuthenticationRule{
+				endUserRule,
+				{
+					Selector: "abc.com.a",
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "service",
+						},
+					},
+				},
+			},
+			wantAdditionalJwtProviders: map[string]bool{
+				"service": true,
+			},
+		},
+		{
+			desc: "Providers required together read the same JWT location",
+			rules: []*confpb.AuthenticationRule{
+				endUserRule,
+				{
+					Selector: "abc.com.a",
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "service",
+						},
+						{
+							ProviderId: "partner",
+						},
+					},
+				},
+			},
+			wantError: "error processing authentication rules for operation (abc.com.a): providers (end_user) and (partner) are required together but both read the JWT from header authorization, set distinct jwt_locations for them",
+		},
+		{
+			desc: "Provider required together with the caller is the caller of another operation",
+			rules: []*confpb.AuthenticationRule{
+				endUserRule,
+				{
+					Selector: "abc.com.a",
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "service",
+						},
+					},
+				},
+				{
+					Selector: "abc.com.b",
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "service",
+						},
+					},
+				},
+			},
+			wantError: "error processing authentication rules for operation (abc.com.a): provider (service) is required together with the JWT of the caller, and cannot be the JWT of the caller of operation (abc.com.b)",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeServiceConfig := &confpb.Service{
+				Name: "echo.endpoints",
+				Apis: []*apipb.Api{
+					{
+						Name: "abc.com",
+						Methods: []*apipb.Method{
+							{
+								Name: "a",
+							},
+							{
+								Name: "b",
+							},
+						},
+					},
+				},
+				Authentication: &confpb.Authentication{
+					Providers: []*confpb.AuthProvider{
+						{
+							Id:      "end_user",
+							Issuer:  "issuer-0",
+							JwksUri: "https://fake-jwks.com",
+						},
+						{
+							Id:      "service",
+							Issuer:  "issuer-1",
+							JwksUri: "https://fake-jwks.com",
+							JwtLocations: []*confpb.JwtLocation{
+								{
+									In: &confpb.JwtLocation_Header{
+										Header: "X-Service-Authorization",
+									},
+								},
+							},
+						},
+						{
+							Id:      "partner",
+							Issuer:  "issuer-2",
+							JwksUri: "https://fake-jwks.com",
+						},
+					},
+					Rules: tc.rules,
+				},
+			}
+
+			s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, options.DefaultConfigGeneratorOptions())
+			if err != nil {
+				if tc.wantError == "" || err.Error() != tc.wantError {
+					t.Errorf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("want error: %v, got no error", tc.wantError)
+			}
+
+			if !reflect.DeepEqual(s.AdditionalJwtProviders, tc.wantAdditionalJwtProviders) {
+				t.Errorf("additional JWT providers not expected, got: %v, want: %v", s.AdditionalJwtProviders, tc.wantAdditionalJwtProviders)
+			}
+		})
+	}
+}
+
+func TestProcessMaxRequestBytes(t *testing.T) {
+	testData := []struct {
+		desc                     string
+		maxRequestBytes          int
+		operationMaxRequestBytes string
+		wantMaxRequestBytes      map[string]uint32
+		wantError                string
+	}{
+		{
+			desc: "No limits by default",
+			wantMaxRequestBytes: map[string]uint32{
+				"abc.com.a": 0,
+				"abc.com.b": 0,
+			},
+		},
+		{
+			desc:            "Streaming operations are not limited",
+			maxRequestBytes: 1024,
+			wantMaxRequestBytes: map[string]uint32{
+				"abc.com.a": 1024,
+				"abc.com.b": 0,
+			},
+		},
+		{
+			desc:                     "Override the limit of an operation",
+			maxRequestBytes:          1024,
+			operationMaxRequestBytes: "abc.com.a=0",
+			wantMaxRequestBytes: map[string]uint32{
+				"abc.com.a": 0,
+				"abc.com.b": 0,
+			},
+		},
+		{
+			desc:                     "Limit an operation only",
+			operationMaxRequestBytes: "abc.com.a=2048",
+			wantMaxRequestBytes: map[string]uint32{
+				"abc.com.a": 2048,
+				"abc.com.b": 0,
+			},
+		},
+		{
+			desc:            "Negative limit",
+			maxRequestBytes: -1,
+			wantError:       "invalid max request bytes: -1, should be between 0 and 4294967295",
+		},
+		{
+			desc:                     "Wrong format",
+			operationMaxRequestBytes: "abc.com.a:10",
+			wantError:                "invalid operation max request bytes: abc.com.a:10, should be in selector=value format",
+		},
+		{
+			desc:                     "Invalid limit",
+			operationMaxRequestBytes: "abc.com.a=-1",
+			wantError:                "invalid operation max request bytes for operation (abc.com.a): -1, should be a non-negative integer",
+		},
+		{
+			desc:                     "Limit a streaming operation",
+			operationMaxRequestBytes: "abc.com.b=10",
+			wantError:                "invalid operation max request bytes for operation (abc.com.b): the streaming operation cannot be limited",
+		},
+		{
+			desc:                     "Unknown selector",
+			operationMaxRequestBytes: "abc.com.c=10",
+			wantError:                "error processing operation max request bytes: selector (abc.com.c) was not defined in the API",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeServiceConfig := &confpb.Service{
+				Name: "echo.endpoints",
+				Apis: []*apipb.Api{
+					{
+						Name: "abc.com",
+						Methods: []*apipb.Method{
+							{
+								Name: "a",
+							},
+							{
+								Name:             "b",
+								RequestStreaming: true,
+							},
+						},
+					},
+				},
+			}
+
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.MaxRequestBytes = tc.maxRequestBytes
+			opts.OperationMaxRequestBytes = tc.operationMaxRequestBytes
+			s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+
+			if err != nil {
+				if tc.wantError == "" || err.Error() != tc.wantError {
+					t.Errorf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("want error: %v, got no error", tc.wantError)
+			}
+
+			for operation, wantMaxRequestBytes := range tc.wantMaxRequestBytes {
+				if got := s.Methods[operation].MaxRequestBytes; got != wantMaxRequestBytes {
+					t.Errorf("got max request bytes of %s: %v, want: %v", operation, got, wantMaxRequestBytes)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessFeatureGates(t *testing.T) {
+	testData := []struct {
+		desc             string
+		featureGate      string
+		removeMethod     bool
+		wantFeatureGates map[string]*FeatureGate
+		wantError        string
+	}{
+		{
+			desc: "No feature gates by default",
+		},
+		{
+			desc:        "Percentage and daily window gate",
+			featureGate: `{"percent": 50, "windows": ["22:00-06:00", "09:00-17:00"], "status": 503}`,
+			wantFeatureGates: map[string]*FeatureGate{
+				"1.echo_endpoints.Echo": {
+					Percent: 50,
+					Windows: []DailyWindow{
+						{Start: 22 * time.Hour, End: 6 * time.Hour},
+						{Start: 9 * time.Hour, End: 17 * time.Hour},
+					},
+					Status: 503,
+				},
+			},
+		},
+		{
+			desc:        "Daily window gate lets all the requests through when open",
+			featureGate: `{"windows": ["09:30-17:00"]}`,
+			wantFeatureGates: map[string]*FeatureGate{
+				"1.echo_endpoints.Echo": {
+					Percent: 100,
+					Windows: []DailyWindow{
+						{Start: 9*time.Hour + 30*time.Minute, End: 17 * time.Hour},
+					},
+					Status: 404,
+				},
+			},
+		},
+		{
+			desc:        "Closed gate",
+			featureGate: `{"percent": 0}`,
+			wantFeatureGates: map[string]*FeatureGate{
+				"1.echo_endpoints.Echo": {
+					Percent: 0,
+					Status:  404,
+				},
+			},
+		},
+		{
+			desc:         "Unknown selector",
+			featureGate:  `{"percent": 10}`,
+			removeMethod: true,
+			wantError:    "error processing x-google-feature-gate of operation (echo): selector (1.echo_endpoints.Echo) was not defined in the API",
+		},
+		{
+			desc:        "Empty gate",
+			featureGate: `{}`,
+			wantError:   "error processing x-google-feature-gate of operation (1.echo_endpoints.Echo): empty feature gate, should have a percent or daily windows",
+		},
+		{
+			desc:        "Invalid percent",
+			featureGate: `{"percent": 120}`,
+			wantError:   "error processing x-google-feature-gate of operation (1.echo_endpoints.Echo): invalid percent 120, should be in [0, 100]",
+		},
+		{
+			desc:        "Invalid daily window",
+			featureGate: `{"windows": ["9am-5pm"]}`,
+			wantError:   `error processing x-google-feature-gate of operation (1.echo_endpoints.Echo): invalid daily window "9am-5pm", should be in HH:MM-HH:MM format`,
+		},
+		{
+			desc:        "Invalid status",
+			featureGate: `{"percent": 10, "status": 403}`,
+			wantError:   "error processing x-google-feature-gate of operation (1.echo_endpoints.Echo): invalid status 403, should be either 404 or 503",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			featureGate := ""
+			if tc.featureGate != "" {
+				featureGate = `, "x-google-feature-gate": ` + tc.featureGate
+			}
+			fakeServiceConfig, err := ServiceConfigFromOpenAPI([]byte(`{
+  "swagger": "2.0",
+  "info": {"title": "Echo", "version": "1.0.0"},
+  "host": "echo.endpoints",
+  "paths": {"/echo": {"post": {"operationId": "echo"` + featureGate + `}}}
+}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.removeMethod {
+				fakeServiceConfig.Apis[0].Methods = nil
+				fakeServiceConfig.Http.Rules = nil
+				fakeServiceConfig.Usage.Rules = nil
+				fakeServiceConfig.Backend.Rules = nil
+			}
+
+			opts := options.DefaultConfigGeneratorOptions()
+			s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+
+			if err != nil {
+				if tc.wantError == "" || err.Error() != tc.wantError {
+					t.Errorf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("want error: %v, got no error", tc.wantError)
+			}
+
+			gotFeatureGates := make(map[string]*FeatureGate)
+			for operation, mi := range s.Methods {
+				if mi.FeatureGate != nil {
+					gotFeatureGates[operation] = mi.FeatureGate
+				}
+			}
+			if len(gotFeatureGates) == 0 && len(tc.wantFeatureGates) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(gotFeatureGates, tc.wantFeatureGates) {
+				t.Errorf("feature gates not expected, got: %v, want: %v", gotFeatureGates, tc.wantFeatureGates)
+			}
+		})
+	}
+}
+
+func TestProcessHostBackends(t *testing.T) {
+	testData := []struct {
+		desc                    string
+		backendAddress          string
+		hostBackends            string
+		wantHostBackendClusters map[string]*BackendRoutingCluster
+		wantError               string
+	}{
+		{
+			desc: "No host backends by default",
+		},
+		{
+			desc:         "Host backends with the local backend options",
+			hostBackends: "Partner.example.com=https://partner-backend:8443; internal.example.com=http://127.0.0.1:8083",
+			wantHostBackendClusters: map[string]*BackendRoutingCluster{
+				"partner.example.com": {
+					ClusterName: "backend-cluster-echo.endpoints_local_partner.example.com",
+					Hostname:    "partner-backend",
+					Port:        8443,
+					UseTLS:      true,
+					Protocol:    util.HTTP1,
+				},
+				"internal.example.com": {
+					ClusterName: "backend-cluster-echo.endpoints_local_internal.example.com",
+					Hostname:    "127.0.0.1",
+					Port:        8083,
+					Protocol:    util.HTTP1,
+				},
+			},
+		},
+		{
+			desc:         "Wrong format",
+			hostBackends: "partner.example.com",
+			wantError:    "invalid host backend: partner.example.com, should be in host=backend_address format",
+		},
+		{
+			desc:         "Duplicate hosts",
+			hostBackends: "partner.example.com=http://127.0.0.1:8083;partner.example.com=http://127.0.0.1:8084",
+			wantError:    "duplicate host backends for host (partner.example.com)",
+		},
+		{
+			desc:         "Different protocol from the local backend",
+			hostBackends: "partner.example.com=grpc://127.0.0.1:8083",
+			wantError:    "backend of host (partner.example.com) must use the same protocol as the local backend",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeServiceConfig := &confpb.Service{
+				Name: "echo.endpoints",
+				Apis: []*apipb.Api{
+					{
+						Name: "abc.com",
+						Methods: []*apipb.Method{
+							{
+								Name: "a",
+							},
+						},
+					},
+				},
+			}
+
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.BackendAddress = "http://127.0.0.1:8082"
+			opts.HostBackends = tc.hostBackends
+			s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+
+			if err != nil {
+				if tc.wantError == "" || err.Error() != tc.wantError {
+					t.Errorf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("want error: %v, got no error", tc.wantError)
+			}
+
+			if !reflect.DeepEqual(s.HostBackendClusters, tc.wantHostBackendClusters) {
+				t.Errorf("got host backend clusters: %v, want: %v", s.HostBackendClusters, tc.wantHostBackendClusters)
+			}
+		})
+	}
+}
+
+func TestProcessHostAuthRequirements(t *testing.T) {
+	testData := []struct {
+		desc                     string
+		hostSecurity             string
+		removeMethod             bool
+		wantHostAuthRequirements map[string]map[string][]*confpb.AuthRequirement
+		wantError                string
+	}{
+		{
+			desc: "No host auth requirements by default",
+		},
+		{
+			desc:         "Different requirements for the partner and the public hostnames",
+			hostSecurity: `{"Partner.example.com": [{"partner_auth": []}, {"public_auth": []}], "public.example.com": []}`,
+			wantHostAuthRequirements: map[string]map[string][]*confpb.AuthRequirement{
+				"partner.example.com": {
+					"1.echo_endpoints.Echo": {
+						{
+							ProviderId: "partner_auth",
+						},
+						{
+							ProviderId: "public_auth",
+						},
+					},
+				},
+				"public.example.com": {
+					"1.echo_endpoints.Echo": {},
+				},
+			},
+		},
+		{
+			desc:         "Multiple providers in a security requirement",
+			hostSecurity: `{"partner.example.com": [{"partner_auth": [], "public_auth": []}]}`,
+			wantError:    "error processing x-google-host-security of operation (1.echo_endpoints.Echo) for host (partner.example.com): security requirement map[partner_auth:[] public_auth:[]] should have exactly one JWT provider",
+		},
+		{
+			desc:         "Unknown selector",
+			hostSecurity: `{"partner.example.com": [{"partner_auth": []}]}`,
+			removeMethod: true,
+			wantError:    "error processing x-google-host-security of operation (echo): selector (1.echo_endpoints.Echo) was not defined in the API",
+		},
+		{
+			desc:         "Unknown provider",
+			hostSecurity: `{"partner.example.com": [{"unknown_auth": []}]}`,
+			wantError:    "error processing x-google-host-security of operation (1.echo_endpoints.Echo) for host (partner.example.com): provider (unknown_auth) was not defined in the authentication providers",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			hostSecurity := ""
+			if tc.hostSecurity != "" {
+				hostSecurity = `, "x-google-host-security": ` + tc.hostSecurity
+			}
+			fakeServiceConfig, err := ServiceConfigFromOpenAPI([]byte(`{
+  "swagger": "2.0",
+  "info": {"title": "Echo", "version": "1.0.0"},
+  "host": "echo.endpoints",
+  "securityDefinitions": {
+    "partner_auth": {"type": "oauth2", "flow": "implicit", "x-google-issuer": "partner", "x-google-jwks_uri": "https://partner.example.com/jwks"},
+    "public_auth": {"type": "oauth2", "flow": "implicit", "x-google-issuer": "public", "x-google-jwks_uri": "https://public.example.com/jwks"}
+  },
+  "paths": {"/echo": {"post": {"operationId": "echo", "security": [{"public_auth": []}]` + hostSecurity + `}}}
+}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.removeMethod {
+				fakeServiceConfig.Apis[0].Methods = nil
+				fakeServiceConfig.Http.Rules = nil
+				fakeServiceConfig.Authentication.Rules = nil
+				fakeServiceConfig.Usage.Rules = nil
+				fakeServiceConfig.Backend.Rules = nil
+			}
+
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.DisableOidcDiscovery = true
+			s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+
+			if err != nil {
+				if tc.wantError == "" || err.Error() != tc.wantError {
+					t.Errorf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("want error: %v, got no error", tc.wantError)
+			}
+
+			if len(s.HostAuthRequirements) != len(tc.wantHostAuthRequirements) {
+				t.Fatalf("got host auth requirements: %v, want: %v", s.HostAuthRequirements, tc.wantHostAuthRequirements)
+			}
+			for host, wantRequirements := range tc.wantHostAuthRequirements {
+				for selector, want := range wantRequirements {
+					got, ok := s.HostAuthRequirements[host][selector]
+					if !ok || len(got) != len(want) {
+						t.Fatalf("got requirements for %v@%v: %v, want: %v", selector, host, got, want)
+					}
+					for i := range want {
+						if !proto.Equal(got[i], want[i]) {
+							t.Errorf("got requirement for %v@%v: %v, want: %v", selector, host, got[i], want[i])
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestProcessQuotaTiers(t *testing.T) {
+	testData := []struct {
+		desc           string
+		quotaTiers     string
+		security       string
+		wantQuotaTiers []*scpb.QuotaTier
+		wantError      string
+	}{
+		{
+			desc: "No quota tiers by default",
+		},
+		{
+			desc:       "Multiple tiers for an operation",
+			quotaTiers: `[{"consumerProjectNumbers": ["123", "456"], "metricCosts": {"paid-requests": 10, "free-requests": 0}}, {"consumerProjectNumbers": ["789"], "metricCosts": {"paid-requests": 1}}]`,
+			wantQuotaTiers: []*scpb.QuotaTier{
+				{
+					ConsumerProjectNumbers: []string{"123", "456"},
+					MetricCosts: []*scpb.MetricCost{
+						{
+							Name: "free-requests",
+							Cost: 0,
+						},
+						{
+							Name: "paid-requests",
+							Cost: 10,
+						},
+					},
+				},
+				{
+					ConsumerProjectNumbers: []string{"789"},
+					MetricCosts: []*scpb.MetricCost{
+						{
+							Name: "paid-requests",
+							Cost: 1,
+						},
+					},
+				},
+			},
+		},
+		{
+			desc:       "API key not required",
+			quotaTiers: `[{"consumerProjectNumbers": ["123"], "metricCosts": {"paid-requests": 1}}]`,
+			security:   `[]`,
+			wantError:  "error processing x-google-quota-tiers of operation (1.echo_endpoints.Echo): the consumer project is only known by the Check call, the operation should require an API key",
+		},
+		{
+			desc:       "No metric costs",
+			quotaTiers: `[{"consumerProjectNumbers": ["123"]}]`,
+			wantError:  "error processing x-google-quota-tiers of operation (1.echo_endpoints.Echo): quota tier should have both consumer project numbers and metric costs",
+		},
+		{
+			desc:       "Invalid project number",
+			quotaTiers: `[{"consumerProjectNumbers": ["project-1"], "metricCosts": {"paid-requests": 1}}]`,
+			wantError:  `error processing x-google-quota-tiers of operation (1.echo_endpoints.Echo): consumer project number "project-1" should be a number`,
+		},
+		{
+			desc:       "Project in multiple tiers",
+			quotaTiers: `[{"consumerProjectNumbers": ["123"], "metricCosts": {"paid-requests": 1}}, {"consumerProjectNumbers": ["123"], "metricCosts": {"free-requests": 1}}]`,
+			wantError:  "error processing x-google-quota-tiers of operation (1.echo_endpoints.Echo): consumer project number 123 is in multiple quota tiers",
+		},
+		{
+			desc:       "Metric without quota limit",
+			quotaTiers: `[{"consumerProjectNumbers": ["123"], "metricCosts": {"read-requests": 1}}]`,
+			wantError:  "error processing x-google-quota-tiers of operation (1.echo_endpoints.Echo): metric (read-requests) has no quota limit in the service config",
+		},
+		{
+			desc:       "Negative metric cost",
+			quotaTiers: `[{"consumerProjectNumbers": ["123"], "metricCosts": {"paid-requests": -1}}]`,
+			wantError:  "error processing x-google-quota-tiers of operation (1.echo_endpoints.Echo): cost -1 of metric (paid-requests) should be non-negative",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			quotaTiers := ""
+			if tc.quotaTiers != "" {
+				quotaTiers = `, "x-google-quota-tiers": ` + tc.quotaTiers
+			}
+			security := `[{"api_key": []}]`
+			if tc.security != "" {
+				security = tc.security
+			}
+			fakeServiceConfig, err := ServiceConfigFromOpenAPI([]byte(`{
+  "swagger": "2.0",
+  "info": {"title": "Echo", "version": "1.0.0"},
+  "host": "echo.endpoints",
+  "securityDefinitions": {"api_key": {"type": "apiKey", "name": "key", "in": "query"}},
+  "paths": {"/echo": {"post": {"operationId": "echo", "security": ` + security + quotaTiers + `}}}
+}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fakeServiceConfig.Quota = &confpb.Quota{
+				Limits: []*confpb.QuotaLimit{
+					{
+						Name:   "free-requests-limit",
+						Metric: "free-requests",
+					},
+					{
+						Name:   "paid-requests-limit",
+						Metric: "paid-requests",
+					},
+				},
+			}
+
+			opts := options.DefaultConfigGeneratorOptions()
+			s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+
+			if err != nil {
+				if tc.wantError == "" || err.Error() != tc.wantError {
+					t.Errorf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("want error: %v, got no error", tc.wantError)
+			}
+
+			gotQuotaTiers := s.Methods["1.echo_endpoints.Echo"].QuotaTiers
+			if len(gotQuotaTiers) != len(tc.wantQuotaTiers) {
+				t.Fatalf("QuotaTiers not expected, got: %v, want: %v", gotQuotaTiers, tc.wantQuotaTiers)
+			}
+			for i := range tc.wantQuotaTiers {
+				if !proto.Equal(gotQuotaTiers[i], tc.wantQuotaTiers[i]) {
+					t.Errorf("QuotaTiers not expected, got: %v, want: %v", gotQuotaTiers, tc.wantQuotaTiers)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessReportSampling(t *testing.T) {
+	testData := []struct {
+		desc                       string
+		reportSuccessSamplingRates string
+		wantReportSampling         map[string]*scpb.ReportSampling
+		wantError                  string
+	}{
+		{
+			desc: "No sampling by default",
+		},
+		{
+			desc:                       "Sampling for multiple operations",
+			reportSuccessSamplingRates: "abc.com.a=0.01; abc.com.b=1",
+			wantReportSampling: map[string]*scpb.ReportSampling{
+				"abc.com.a": {
+					SuccessRate: 0.01,
+				},
+				"abc.com.b": {
+					SuccessRate: 1,
+				},
+			},
+		},
+		{
+			desc:                       "Wrong format",
+			reportSuccessSamplingRates: "abc.com.a:0.01",
+			wantError:                  "invalid report success sampling rate: abc.com.a:0.01, should be in selector=rate format",
+		},
+		{
+			desc:                       "Rate out of range",
+			reportSuccessSamplingRates: "abc.com.a=1.5",
+			wantError:                  "invalid report success sampling rate for operation (abc.com.a): 1.5, should be between 0 and 1",
+		},
+		{
+			desc:                       "Unknown selector",
+			reportSuccessSamplingRates: "abc.com.c=0.5",
+			wantError:                  "error processing report success sampling rate: selector (abc.com.c) was not defined in the API",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeServiceConfig := &confpb.Service{
+				Name: "echo.endpoints",
+				Apis: []*apipb.Api{
+					{
+						Name: "abc.com",
+						Methods: []*apipb.Method{
+							{
+								Name: "a",
+							},
+							{
+								Name: "b",
+							},
+						},
+					},
+				},
+			}
+
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.ReportSuccessSamplingRates = tc.reportSuccessSamplingRates
+			s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+
+			if err != nil {
+				if tc.wantError == "" || err.Error() != tc.wantError {
+					t.Errorf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("want error: %v, got no error", tc.wantError)
+			}
+
+			for operation, mi := range s.Methods {
+				if !proto.Equal(mi.ReportSampling, tc.wantReportSampling[operation]) {
+					t.Errorf("ReportSampling of %v not expected, got: %v, want: %v", operation, mi.ReportSampling, tc.wantReportSampling[operation])
+				}
+			}
+		})
+	}
+}
+
+func TestProcessLongRunningOperations(t *testing.T) {
+	testData := []struct {
+		desc                         string
+		lroPollingDeadline           time.Duration
+		lroPollingInheritApiKey      bool
+		lroResponseTypeUrl           string
+		wantPollingDeadline          time.Duration
+		wantPollingAllowUnregistered bool
+	}{
+		{
+			desc:                "Not changed by default",
+			lroResponseTypeUrl:  "type.googleapis.com/google.longrunning.Operation",
+			wantPollingDeadline: util.DefaultResponseDeadline,
+		},
+		{
+			desc:                         "Relaxed deadline and inherited api key settings",
+			lroPollingDeadline:           5 * time.Minute,
+			lroPollingInheritApiKey:      true,
+			lroResponseTypeUrl:           "type.googleapis.com/google.longrunning.Operation",
+			wantPollingDeadline:          5 * time.Minute,
+			wantPollingAllowUnregistered: true,
+		},
+		{
+			desc:                    "Not changed without long-running methods",
+			lroPollingDeadline:      5 * time.Minute,
+			lroPollingInheritApiKey: true,
+			lroResponseTypeUrl:      "type.googleapis.com/abc.com.Response",
+			wantPollingDeadline:     util.DefaultResponseDeadline,
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeServiceConfig := &confpb.Service{
+				Name: "echo.endpoints",
+				Apis: []*apipb.Api{
+					{
+						Name: "abc.com",
+						Methods: []*apipb.Method{
+							{
+								Name:            "CreateFoo",
+								ResponseTypeUrl: tc.lroResponseTypeUrl,
+							},
+						},
+					},
+					{
+						Name: "google.longrunning.Operations",
+						Methods: []*apipb.Method{
+							{
+								Name:            "GetOperation",
+								ResponseTypeUrl: "type.googleapis.com/google.longrunning.Operation",
+							},
+						},
+					},
+				},
+				Usage: &confpb.Usage{
+					Rules: []*confpb.UsageRule{
+						{
+							Selector:               "abc.com.CreateFoo",
+							AllowUnregisteredCalls: true,
+						},
+					},
+				},
+			}
+
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.LroPollingDeadline = tc.lroPollingDeadline
+			opts.LroPollingInheritApiKey = tc.lroPollingInheritApiKey
+			s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				t.Fatalf("error not expected, got: %v", err)
+			}
+
+			pollingMethod := s.Methods["google.longrunning.Operations.GetOperation"]
+			if pollingMethod.BackendInfo.Deadline != tc.wantPollingDeadline {
+				t.Errorf("polling deadline not expected, got: %v, want: %v", pollingMethod.BackendInfo.Deadline, tc.wantPollingDeadline)
+			}
+			if pollingMethod.AllowUnregisteredCalls != tc.wantPollingAllowUnregistered {
+				t.Errorf("polling AllowUnregisteredCalls not expected, got: %v, want: %v", pollingMethod.AllowUnregisteredCalls, tc.wantPollingAllowUnregistered)
+			}
+
+			// The methods returning the long-running operations keep their deadline.
+			if tc.lroPollingDeadline > 0 && s.Methods["abc.com.CreateFoo"].BackendInfo.Deadline != util.DefaultResponseDeadline {
+				t.Errorf("deadline of other methods should not be changed, got: %v", s.Methods["abc.com.CreateFoo"].BackendInfo.Deadline)
+			}
+		})
+	}
+}
+
+func TestProcessPassthrough(t *testing.T) {
+	testData := []struct {
+		desc                      string
+		fakeServiceConfig         *confpb.Service
+		passthroughForEmptyConfig bool
+		wantPassthrough           bool
+		wantError                 string
+	}{
+		{
+			desc: "Failed for service config without apis",
+			fakeServiceConfig: &confpb.Service{
+				Name: "echo.endpoints",
+			},
+			wantError: "service config must have one api at least",
+		},
+		{
+			desc: "Passthrough for service config without apis",
+			fakeServiceConfig: &confpb.Service{
+				Name: "echo.endpoints",
+			},
+			passthroughForEmptyConfig: true,
+			wantPassthrough:           true,
+		},
+		{
+			desc: "No passthrough for gRPC service config without http rules",
+			fakeServiceConfig: &confpb.Service{
+				Name: "echo.endpoints",
+				Apis: []*apipb.Api{
+					{
+						Name: "abc.com",
+						Methods: []*apipb.Method{
+							{
+								Name: "a",
+							},
+						},
+					},
+				},
+			},
+			passthroughForEmptyConfig: true,
+		},
+		{
+			desc: "No passthrough for service config with http rules",
+			fakeServiceConfig: &confpb.Service{
+				Name: "echo.endpoints",
+				Apis: []*apipb.Api{
+					{
+						Name: "abc.com",
+						Methods: []*apipb.Method{
+							{
+								Name: "a",
+							},
+						},
+					},
+				},
+				Http: &annotationspb.Http{
+					Rules: []*annotationspb.HttpRule{
+						{
+							Selector: "abc.com.a",
+							Pattern: &annotationspb.HttpRule_Get{
+								Get: "/a",
+							},
+						},
+					},
+				},
+			},
+			passthroughForEmptyConfig: true,
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.PassthroughForEmptyConfig = tc.passthroughForEmptyConfig
+			s, err := NewServiceInfoFromServiceConfig(tc.fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				if tc.wantError == "" || err.Error() != tc.wantError {
+					t.Errorf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("want error: %v, got no error", tc.wantError)
+			}
+
+			method := s.Methods["espv2_deployment.ESPv2_Autogenerated_Passthrough"]
+			if gotPassthrough := method != nil; gotPassthrough != tc.wantPassthrough {
+				t.Fatalf("got passthrough method: %v, want: %v", gotPassthrough, tc.wantPassthrough)
+			}
+			if method == nil {
+				return
+			}
+
+			wantHttpRule := []*httppattern.Pattern{
+				{
+					UriTemplate: &httppattern.UriTemplate{
+						Origin: "/**",
+						Segments: []string{
+							"**",
+						},
+					},
+					HttpMethod: "*",
+				},
+			}
+			if !reflect.DeepEqual(method.HttpRule, wantHttpRule) {
+				t.Errorf("passthrough http rule not expected, got: %v, want: %v", method.HttpRule, wantHttpRule)
+			}
+			if method.BackendInfo.ClusterName != s.LocalBackendCluster.ClusterName {
+				t.Errorf("passthrough method should route to the local backend, got: %v", method.BackendInfo.ClusterName)
+			}
+		})
+	}
+}
+
+func TestProcessQuota(t *testing.T) {
+	testData := []struct {
+		desc              string
+		fakeServiceConfig *confpb.Service
+		wantMethods       map[string]*MethodInfo
+		wantError         string
+	}{
+		{
+			desc: "Succeed, simple case",
+			fakeServiceConfig: &confpb.Service{
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+						Methods: []*apipb.Method{
+							{
+								Name: "ListShelves",
+							},
+						},
+					},
+				},
+				Quota: &confpb.Quota{
+					MetricRules: []*confpb.MetricRule{
+						{
+							Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+							MetricCosts: map[string]int64{
+								"metric_a": 2,
+								"metric_b": 1,
+							},
+						},
+					},
+				},
+			},
+			wantMethods: map[string]*MethodInfo{
+				fmt.Sprintf("%s.%s", testApiName, "ListShelves"): &MethodInfo{
+					ShortName: "ListShelves",
+					ApiName:   testApiName,
+					HttpRule: []*httppattern.Pattern{
+						{
+							UriTemplate: parseUriTemplate(fmt.Sprintf("/%s/%s", testApiName, "ListShelves")),
+							HttpMethod:  util.POST,
+						},
+					},
+					MetricCosts: []*scpb.MetricCost{
+						{
+							Name: "metric_a",
+							Cost: 2,
+						},
+						{
+							Name: "metric_b",
+							Cost: 1,
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "Succeed, two metric cost items",
+			fakeServiceConfig: &confpb.Service{
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+						Methods: []*apipb.Method{
+							{
+								Name: "ListShelves",
+							},
+						},
+					},
+				},
+				Quota: &confpb.Quota{
+					MetricRules: []*confpb.MetricRule{
+						{
+							Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+							MetricCosts: map[string]int64{
+								"metric_c": 2,
+								"metric_a": 3,
+							},
+						},
+					},
+				},
+			},
+			wantMethods: map[string]*MethodInfo{
+				fmt.Sprintf("%s.%s", testApiName, "ListShelves"): &MethodInfo{
+					ShortName: "ListShelves",
+					ApiName:   testApiName,
+					HttpRule: []*httppattern.Pattern{
+						{
+							UriTemplate: parseUriTemplate(fmt.Sprintf("/%s/%s", testApiName, "ListShelves")),
+							HttpMethod:  util.POST,
+						},
+					},
+					MetricCosts: []*scpb.MetricCost{
+						{
+							Name: "metric_a",
+							Cost: 3,
+						},
+						{
+							Name: "metric_c",
+							Cost: 2,
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "Typo in operation name does not crash",
+			fakeServiceConfig: &confpb.Service{
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+					},
+				},
+				Quota: &confpb.Quota{
+					MetricRules: []*confpb.MetricRule{
+						{
+							Selector: "endpoints.examples.bookstore.Bookstore.BadOperationName",
+							MetricCosts: map[string]int64{
+								"metric_a": 2,
+								"metric_b": 1,
+							},
+						},
+					},
+				},
+			},
+			wantError: "error processing quota metric rule: selector (endpoints.examples.bookstore.Bookstore.BadOperationName) was not defined in the API",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.BackendAddress = "grpc://127.0.0.1:80"
+			serviceInfo, err := NewServiceInfoFromServiceConfig(tc.fakeServiceConfig, testConfigID, opts)
+
+			if err != nil {
+				if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+					t.Fatalf("error mismatch, \ngot : %s, \nwant: %s", err.Error(), tc.wantError)
+				}
+				return
+			}
+
+			for key, gotMethod := range serviceInfo.Methods {
+				wantMethod := tc.wantMethods[key]
+
+				// We're not testing backend info here.
+				gotMethod.BackendInfo = nil
+
+				sort.Slice(gotMethod.MetricCosts, func(i, j int) bool { return gotMethod.MetricCosts[i].Name < gotMethod.MetricCosts[j].Name })
+				if eq := cmp.Equal(gotMethod, wantMethod, cmp.Comparer(proto.Equal)); !eq {
+					t.Errorf("Method mismatch \ngot : %+v,\nwant: %+v", gotMethod, wantMethod)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessEmptyJwksUriByOpenID(t *testing.T) {
+	r := mux.NewRouter()
+	jwksUriEntry, _ := json.Marshal(map[string]string{"jwks_uri": "this-is-jwksUri"})
+	r.Path(util.OpenIDDiscoveryCfgURLSuffix).Methods("GET").Handler(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(jwksUriEntry)
+		}))
+	openIDServer := httptest.NewServer(r)
+
+	// Fails the first discovery call of each test case.
+	var flakyCalls int32
+	flakyOpenIDServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&flakyCalls, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(jwksUriEntry)
+	}))
+
+	origBackOff := oidcDiscoveryRetryBackOff
+	oidcDiscoveryRetryBackOff = time.Millisecond
+	defer func() { oidcDiscoveryRetryBackOff = origBackOff }()
+
+	testData := []struct {
+		desc                          string
+		fakeServiceConfig             *confpb.Service
+		disableOidcDiscovery          bool
+		oidcDiscoveryNumRetries       int
+		oidcDiscoveryFallbackJwksPath string
+		wantedJwksUri                 string
+		wantErr                       bool
+	}{
+		{
+			desc: "Success, empty JWKS URI, so it's acquired using OpenID Connect Discovery.",
 			fakeServiceConfig: &confpb.Service{
 				Apis: []*apipb.Api{
 					{
@@ -3191,11 +4906,72 @@ func TestProcessEmptyJwksUriByOpenID(t *testing.T) {
 			disableOidcDiscovery: true,
 			wantErr:              true,
 		},
+		{
+			desc: "Success, OpenID Connect Discovery succeeds after retry.",
+			fakeServiceConfig: &confpb.Service{
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+					},
+				},
+				Authentication: &confpb.Authentication{
+					Providers: []*confpb.AuthProvider{
+						{
+							Id:     "auth_provider",
+							Issuer: flakyOpenIDServer.URL,
+						},
+					},
+				},
+			},
+			oidcDiscoveryNumRetries: 1,
+			wantedJwksUri:           "this-is-jwksUri",
+		},
+		{
+			desc: "Fail, OpenID Connect Discovery is not retried.",
+			fakeServiceConfig: &confpb.Service{
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+					},
+				},
+				Authentication: &confpb.Authentication{
+					Providers: []*confpb.AuthProvider{
+						{
+							Id:     "auth_provider",
+							Issuer: flakyOpenIDServer.URL,
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			desc: "Success, OpenID Connect Discovery failed and fall back to the jwks path under the issuer.",
+			fakeServiceConfig: &confpb.Service{
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+					},
+				},
+				Authentication: &confpb.Authentication{
+					Providers: []*confpb.AuthProvider{
+						{
+							Id:     "auth_provider",
+							Issuer: "aaaaa.bbbbbb.ccccc/inaccessible_uri/",
+						},
+					},
+				},
+			},
+			oidcDiscoveryFallbackJwksPath: "/.well-known/jwks.json",
+			wantedJwksUri:                 "https://aaaaa.bbbbbb.ccccc/inaccessible_uri/.well-known/jwks.json",
+		},
 	}
 
 	for i, tc := range testData {
 		opts := options.DefaultConfigGeneratorOptions()
 		opts.DisableOidcDiscovery = tc.disableOidcDiscovery
+		opts.OidcDiscoveryNumRetries = tc.oidcDiscoveryNumRetries
+		opts.OidcDiscoveryFallbackJwksPath = tc.oidcDiscoveryFallbackJwksPath
 		serviceInfo, err := NewServiceInfoFromServiceConfig(tc.fakeServiceConfig, testConfigID, opts)
 
 		if tc.wantErr {
@@ -3207,6 +4983,11 @@ func TestProcessEmptyJwksUriByOpenID(t *testing.T) {
 		} else if jwksUri := serviceInfo.serviceConfig.Authentication.Providers[0].JwksUri; jwksUri != tc.wantedJwksUri {
 			t.Errorf("Test Desc(%d): %s, process jwksUri got: %v, want: %v", i, tc.desc, jwksUri, tc.wantedJwksUri)
 		}
+
+		// The service config of the caller is left as is.
+		if jwksUri := tc.fakeServiceConfig.Authentication.Providers[0].JwksUri; jwksUri != "" {
+			t.Errorf("Test Desc(%d): %s, got jwksUri %v set on the service config of the caller, want it unchanged", i, tc.desc, jwksUri)
+		}
 	}
 }
 
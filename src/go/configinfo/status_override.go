@@ -0,0 +1,80 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+)
+
+// StatusOverride overrides the HTTP status a gRPC status of the backend is
+// transcoded to.
+type StatusOverride struct {
+	GrpcCode   code.Code
+	HttpStatus uint32
+	// The "Retry-After" header of the response, not set if 0.
+	RetryAfter time.Duration
+}
+
+// parseStatusOverrides parses the comma separated overrides of an operation,
+// each in the format of CODE:STATUS[:RETRY_AFTER], e.g.
+// "RESOURCE_EXHAUSTED:429:30s,FAILED_PRECONDITION:409".
+func parseStatusOverrides(spec string) ([]*StatusOverride, error) {
+	var overrides []*StatusOverride
+	seen := make(map[code.Code]bool)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		if len(parts) != 2 && len(parts) != 3 {
+			return nil, fmt.Errorf("invalid status override %q, should be in CODE:STATUS[:RETRY_AFTER] format", item)
+		}
+
+		grpcCode, ok := code.Code_value[strings.TrimSpace(parts[0])]
+		if !ok || code.Code(grpcCode) == code.Code_OK {
+			return nil, fmt.Errorf("invalid gRPC status code %q in status override %q", parts[0], item)
+		}
+		if seen[code.Code(grpcCode)] {
+			return nil, fmt.Errorf("gRPC status code %s is overridden more than once", parts[0])
+		}
+		seen[code.Code(grpcCode)] = true
+
+		status, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 32)
+		if err != nil || status < 400 || status >= 600 {
+			return nil, fmt.Errorf("invalid http status %q in status override %q, should be in [400, 600)", parts[1], item)
+		}
+
+		override := &StatusOverride{
+			GrpcCode:   code.Code(grpcCode),
+			HttpStatus: uint32(status),
+		}
+		if len(parts) == 3 {
+			if override.RetryAfter, err = time.ParseDuration(strings.TrimSpace(parts[2])); err != nil || override.RetryAfter <= 0 {
+				return nil, fmt.Errorf("invalid retry after %q in status override %q, should be a positive duration", parts[2], item)
+			}
+		}
+		overrides = append(overrides, override)
+	}
+	if len(overrides) == 0 {
+		return nil, fmt.Errorf("empty status overrides")
+	}
+	return overrides, nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestParseStatusOverrides(t *testing.T) {
+	testData := []struct {
+		desc          string
+		spec          string
+		wantOverrides []*StatusOverride
+		wantError     string
+	}{
+		{
+			desc: "Overrides with and without retry after",
+			spec: "RESOURCE_EXHAUSTED:429:30s, FAILED_PRECONDITION:409",
+			wantOverrides: []*StatusOverride{
+				{
+					GrpcCode:   code.Code_RESOURCE_EXHAUSTED,
+					HttpStatus: 429,
+					RetryAfter: 30 * time.Second,
+				},
+				{
+					GrpcCode:   code.Code_FAILED_PRECONDITION,
+					HttpStatus: 409,
+				},
+			},
+		},
+		{
+			desc:      "Unknown gRPC code",
+			spec:      "EXHAUSTED:429",
+			wantError: `invalid gRPC status code "EXHAUSTED" in status override "EXHAUSTED:429"`,
+		},
+		{
+			desc:      "OK can not be overridden",
+			spec:      "OK:400",
+			wantError: `invalid gRPC status code "OK" in status override "OK:400"`,
+		},
+		{
+			desc:      "Duplicated gRPC code",
+			spec:      "NOT_FOUND:404,NOT_FOUND:410",
+			wantError: "gRPC status code NOT_FOUND is overridden more than once",
+		},
+		{
+			desc:      "Not an error status",
+			spec:      "NOT_FOUND:200",
+			wantError: `invalid http status "200" in status override "NOT_FOUND:200", should be in [400, 600)`,
+		},
+		{
+			desc:      "Invalid retry after",
+			spec:      "UNAVAILABLE:503:-1s",
+			wantError: `invalid retry after "-1s" in status override "UNAVAILABLE:503:-1s", should be a positive duration`,
+		},
+		{
+			desc:      "Invalid format",
+			spec:      "UNAVAILABLE",
+			wantError: `invalid status override "UNAVAILABLE", should be in CODE:STATUS[:RETRY_AFTER] format`,
+		},
+		{
+			desc:      "Empty overrides",
+			spec:      " , ",
+			wantError: "empty status overrides",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := parseStatusOverrides(tc.spec)
+			if err != nil {
+				if err.Error() != tc.wantError {
+					t.Fatalf("got error: %v, want error: %s", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("got no error, want error: %s", tc.wantError)
+			}
+			if !reflect.DeepEqual(got, tc.wantOverrides) {
+				t.Errorf("got overrides: %+v, want: %+v", got, tc.wantOverrides)
+			}
+		})
+	}
+}
+
+func TestProcessStatusOverrides(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc          string
+		flag          string
+		wantOverrides map[string][]*StatusOverride
+		wantError     string
+	}{
+		{
+			desc: "Overrides of an operation",
+			flag: testApiName + ".CreateShelf=ALREADY_EXISTS:409;",
+			wantOverrides: map[string][]*StatusOverride{
+				testApiName + ".CreateShelf": {
+					{
+						GrpcCode:   code.Code_ALREADY_EXISTS,
+						HttpStatus: 409,
+					},
+				},
+			},
+		},
+		{
+			desc:      "Missing selector",
+			flag:      "ALREADY_EXISTS:409",
+			wantError: "invalid transcoding status overrides: ALREADY_EXISTS:409, should be in selector=overrides format",
+		},
+		{
+			desc:      "Invalid overrides",
+			flag:      testApiName + ".CreateShelf=ALREADY_EXISTS",
+			wantError: `invalid transcoding status overrides for operation (` + testApiName + `.CreateShelf): invalid status override "ALREADY_EXISTS", should be in CODE:STATUS[:RETRY_AFTER] format`,
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.TranscodingStatusOverrides = tc.flag
+			serviceInfo, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				if err.Error() != tc.wantError {
+					t.Fatalf("got error: %v, want error: %s", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("got no error, want error: %s", tc.wantError)
+			}
+			for operation, method := range serviceInfo.Methods {
+				if !reflect.DeepEqual(method.StatusOverrides, tc.wantOverrides[operation]) {
+					t.Errorf("got overrides of %s: %+v, want: %+v", operation, method.StatusOverrides, tc.wantOverrides[operation])
+				}
+			}
+		})
+	}
+}
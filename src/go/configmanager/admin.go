@@ -0,0 +1,180 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/mux"
+)
+
+var (
+	AdminPort = flag.Int("config_manager_admin_port", 0, `the port of the config manager admin interface, which only listens on the loopback address.
+					0 disables the admin interface.`)
+)
+
+// AdminHandler creates the handler of the config manager admin interface.
+//
+// POST /revert swaps back to the previously served service config.
+// GET /openapi renders the API surface of the served service config as an
+// OpenAPI document.
+// GET, PUT and DELETE /maintenance read, replace and clear the operations in
+// maintenance mode, e.g. PUT {"selectors": "*", "retry_after": "10m"}.
+// GET /canary reports the latest canary analysis of the managed rollout.
+// GET /adoption reports the config versions sent to and ACKed by each
+// connected Envoy.
+// GET /configz dumps the listeners, clusters and http filters currently served
+// to Envoy, along with the service config id and rollout id.
+// GET /dryrun?config_id=ID diffs the config generated for the service config,
+// the latest rollout by default, against the served config without publishing
+// it.
+func (m *ConfigManager) AdminHandler() http.Handler {
+	r := mux.NewRouter()
+
+	r.Path("/revert").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		configId, err := m.Revert()
+		if err != nil {
+			glog.Errorf("admin revert had error: %v", err)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		_, _ = w.Write([]byte(fmt.Sprintf(`{"config_id": "%s"}`, configId)))
+	})
+
+	r.Path("/openapi").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc, err := m.openAPIJson()
+		if err != nil {
+			glog.Errorf("admin openapi had error: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(doc)
+	})
+
+	r.Path("/maintenance").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		selectors, retryAfter := m.Maintenance()
+		writeMaintenanceMode(w, selectors, retryAfter)
+	})
+
+	r.Path("/maintenance").Methods("PUT").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, retryAfter := m.Maintenance()
+		var mode maintenanceMode
+		if err := json.NewDecoder(r.Body).Decode(&mode); err != nil {
+			http.Error(w, fmt.Sprintf("invalid maintenance mode: %v", err), http.StatusBadRequest)
+			return
+		}
+		if mode.RetryAfter != "" {
+			var err error
+			if retryAfter, err = time.ParseDuration(mode.RetryAfter); err != nil || retryAfter < 0 {
+				http.Error(w, fmt.Sprintf("invalid maintenance retry_after: %v, should be a non-negative duration", mode.RetryAfter), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := m.SetMaintenance(mode.Selectors, retryAfter); err != nil {
+			glog.Errorf("admin maintenance had error: %v", err)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		writeMaintenanceMode(w, mode.Selectors, retryAfter)
+	})
+
+	r.Path("/maintenance").Methods("DELETE").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, retryAfter := m.Maintenance()
+		if err := m.SetMaintenance("", retryAfter); err != nil {
+			glog.Errorf("admin maintenance had error: %v", err)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		writeMaintenanceMode(w, "", retryAfter)
+	})
+
+	r.Path("/canary").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := m.latestCanaryStatus()
+		if status == nil {
+			http.Error(w, "no canary analysis yet", http.StatusNotFound)
+			return
+		}
+		body, _ := json.Marshal(status)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	})
+
+	r.Path("/adoption").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adoptions := m.Adoptions()
+		if adoptions == nil {
+			adoptions = []*Adoption{}
+		}
+		body, _ := json.Marshal(adoptions)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	})
+
+	r.Path("/configz").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := m.configzJson()
+		if err != nil {
+			glog.Errorf("admin configz had error: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	})
+
+	r.Path("/dryrun").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report, err := m.DryRun(r.URL.Query().Get("config_id"))
+		if err != nil {
+			glog.Errorf("admin dryrun had error: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		body, _ := json.MarshalIndent(report, "", "  ")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	})
+
+	return r
+}
+
+// maintenanceMode is the body of the /maintenance admin operations.
+type maintenanceMode struct {
+	Selectors  string `json:"selectors"`
+	RetryAfter string `json:"retry_after,omitempty"`
+}
+
+func writeMaintenanceMode(w http.ResponseWriter, selectors string, retryAfter time.Duration) {
+	body, _ := json.Marshal(maintenanceMode{
+		Selectors:  selectors,
+		RetryAfter: retryAfter.String(),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+func (m *ConfigManager) openAPIJson() ([]byte, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.serviceInfo == nil {
+		return nil, fmt.Errorf("no service config is served yet")
+	}
+	return m.serviceInfo.MakeOpenAPIJson()
+}
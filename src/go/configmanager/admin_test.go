@@ -0,0 +1,219 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+)
+
+func TestAdminHandlerRevert(t *testing.T) {
+	m := newRevertTestConfigManager()
+	s := httptest.NewServer(m.AdminHandler())
+	defer s.Close()
+
+	resp, err := http.Post(s.URL+"/revert", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("got status code: %v, want: %v", resp.StatusCode, http.StatusConflict)
+	}
+
+	for _, configId := range []string{"2021-01-01r0", "2021-01-02r0"} {
+		if err := m.applyServiceConfig(revertTestServiceConfig(configId)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resp, err = http.Post(s.URL+"/revert", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got status code: %v, want: %v", resp.StatusCode, http.StatusOK)
+	}
+	if got := m.curConfigId(); got != "2021-01-01r0" {
+		t.Errorf("got current config id: %s, want: 2021-01-01r0", got)
+	}
+}
+
+func TestAdminHandlerOpenAPI(t *testing.T) {
+	m := newRevertTestConfigManager()
+	s := httptest.NewServer(m.AdminHandler())
+	defer s.Close()
+
+	resp, err := http.Get(s.URL + "/openapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("got status code: %v, want: %v", resp.StatusCode, http.StatusInternalServerError)
+	}
+
+	if err := m.applyServiceConfig(revertTestServiceConfig("2021-01-01r0")); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Get(s.URL + "/openapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got status code: %v, want: %v", resp.StatusCode, http.StatusOK)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"version": "2021-01-01r0"`; !strings.Contains(string(body), want) {
+		t.Errorf("got OpenAPI document: %s, want it to contain: %s", body, want)
+	}
+}
+
+func TestAdminHandlerMaintenance(t *testing.T) {
+	m := newRevertTestConfigManager()
+	s := httptest.NewServer(m.AdminHandler())
+	defer s.Close()
+
+	if err := m.applyServiceConfig(maintenanceTestServiceConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc           string
+		method         string
+		body           string
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			desc:           "Read the default maintenance mode",
+			method:         "GET",
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"selectors":"","retry_after":"5m0s"}`,
+		},
+		{
+			desc:           "Put the whole service into maintenance mode",
+			method:         "PUT",
+			body:           `{"selectors": "*", "retry_after": "10m"}`,
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"selectors":"*","retry_after":"10m0s"}`,
+		},
+		{
+			desc:           "Invalid retry_after",
+			method:         "PUT",
+			body:           `{"selectors": "*", "retry_after": "soon"}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			desc:           "Unknown selector",
+			method:         "PUT",
+			body:           `{"selectors": "endpoints.examples.bookstore.Bookstore.Unknown"}`,
+			wantStatusCode: http.StatusConflict,
+		},
+		{
+			desc:           "Clear the maintenance mode",
+			method:         "DELETE",
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"selectors":"","retry_after":"10m0s"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, s.URL+"/maintenance", strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.wantStatusCode {
+				t.Errorf("got status code: %v, want: %v", resp.StatusCode, tc.wantStatusCode)
+			}
+			if tc.wantBody == "" {
+				return
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tc.wantBody {
+				t.Errorf("got body: %s, want: %s", body, tc.wantBody)
+			}
+		})
+	}
+}
+
+func TestAdminHandlerConfigz(t *testing.T) {
+	m := newRevertTestConfigManager()
+	m.serviceName = "bookstore.endpoints.project123.cloud.goog"
+	s := httptest.NewServer(m.AdminHandler())
+	defer s.Close()
+
+	resp, err := http.Get(s.URL + "/configz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("got status code: %v, want: %v", resp.StatusCode, http.StatusInternalServerError)
+	}
+
+	if err := m.applyServiceConfig(revertTestServiceConfig("2021-01-01r0")); err != nil {
+		t.Fatal(err)
+	}
+	m.curRolloutId = "2021-01-01r0-rollout"
+	resp, err = http.Get(s.URL + "/configz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status code: %v, want: %v", resp.StatusCode, http.StatusOK)
+	}
+
+	var got configz
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ServiceName != m.serviceName || got.ServiceConfigId != "2021-01-01r0" || got.RolloutId != "2021-01-01r0-rollout" {
+		t.Errorf("got service %s, config id %s, rollout id %s, want: %s, 2021-01-01r0, 2021-01-01r0-rollout",
+			got.ServiceName, got.ServiceConfigId, got.RolloutId, m.serviceName)
+	}
+	if got.Versions[resource.ClusterType] != "2021-01-01r0" {
+		t.Errorf("got versions: %v, want cluster version: 2021-01-01r0", got.Versions)
+	}
+	if len(got.Listeners) == 0 || len(got.Clusters) == 0 {
+		t.Errorf("got %d listeners and %d clusters, want both served", len(got.Listeners), len(got.Clusters))
+	}
+	httpFilters := got.HttpFilters[util.IngressListenerName]
+	if len(httpFilters) == 0 || !strings.Contains(string(httpFilters[len(httpFilters)-1]), util.Router) {
+		t.Errorf("got http filters: %s, want the router filter last", httpFilters)
+	}
+}
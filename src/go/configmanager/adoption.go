@@ -0,0 +1,275 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	discoverypb "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	xds "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+)
+
+// Adoption is how far an Envoy connected to the config manager is behind the
+// published snapshot for a resource type.
+type Adoption struct {
+	Node             string `json:"node"`
+	TypeUrl          string `json:"type_url"`
+	PublishedVersion string `json:"published_version"`
+	SentVersion      string `json:"sent_version"`
+	AckedVersion     string `json:"acked_version"`
+	// The time since the sent version is waiting for the ACK, 0 if ACKed.
+	Lag string `json:"lag"`
+	// The error of the latest NACK of the sent version.
+	NackError string `json:"nack_error,omitempty"`
+
+	lag time.Duration
+}
+
+// adoptionTracker tracks the versions sent to and ACKed by the Envoys on each
+// xDS stream.
+type adoptionTracker struct {
+	mutex   sync.Mutex
+	streams map[streamKey]*streamAdoption
+}
+
+// streamKey identifies an xDS stream. The state of the world and the delta
+// streams are numbered separately.
+type streamKey struct {
+	id    int64
+	delta bool
+}
+
+type streamAdoption struct {
+	node  string
+	types map[string]*typeAdoption
+}
+
+type typeAdoption struct {
+	sentVersion  string
+	sentNonce    string
+	sentTime     time.Time
+	ackedVersion string
+	nackError    string
+}
+
+func newAdoptionTracker() *adoptionTracker {
+	return &adoptionTracker{
+		streams: make(map[streamKey]*streamAdoption),
+	}
+}
+
+// XdsCallbacks returns the callbacks of the xDS server tracking the adoption
+// of the snapshots by the Envoys.
+func (m *ConfigManager) XdsCallbacks() xds.Callbacks {
+	t := m.adoption
+	return xds.CallbackFuncs{
+		StreamOpenFunc: func(_ context.Context, id int64, _ string) error {
+			t.openStream(streamKey{id: id})
+			return nil
+		},
+		StreamClosedFunc: func(id int64) {
+			t.closeStream(streamKey{id: id})
+		},
+		StreamRequestFunc: func(id int64, req *discoverypb.DiscoveryRequest) error {
+			if t.onRequest(id, req) && req.GetTypeUrl() == rsrc.ListenerType {
+				m.saveAckedServiceConfig()
+			}
+			return nil
+		},
+		StreamResponseFunc: func(_ context.Context, id int64, _ *discoverypb.DiscoveryRequest, resp *discoverypb.DiscoveryResponse) {
+			t.onResponse(id, resp, time.Now())
+		},
+		// The Envoys bootstrapped with --ads_delta_xds use the delta streams.
+		DeltaStreamOpenFunc: func(_ context.Context, id int64, _ string) error {
+			t.openStream(streamKey{id: id, delta: true})
+			return nil
+		},
+		DeltaStreamClosedFunc: func(id int64) {
+			t.closeStream(streamKey{id: id, delta: true})
+		},
+		StreamDeltaRequestFunc: func(id int64, req *discoverypb.DeltaDiscoveryRequest) error {
+			if t.onDeltaRequest(id, req) && req.GetTypeUrl() == rsrc.ListenerType {
+				m.saveAckedServiceConfig()
+			}
+			return nil
+		},
+		StreamDeltaResponseFunc: func(id int64, _ *discoverypb.DeltaDiscoveryRequest, resp *discoverypb.DeltaDiscoveryResponse) {
+			t.onDeltaResponse(id, resp, time.Now())
+		},
+	}
+}
+
+func (t *adoptionTracker) openStream(key streamKey) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.streams[key] = &streamAdoption{
+		types: make(map[string]*typeAdoption),
+	}
+}
+
+func (t *adoptionTracker) closeStream(key streamKey) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.streams, key)
+}
+
+// onRequest records the ACK or NACK of the request, and returns whether it is
+// an ACK.
+func (t *adoptionTracker) onRequest(id int64, req *discoverypb.DiscoveryRequest) bool {
+	return t.onAckOrNack(streamKey{id: id}, req.GetNode(), req.GetTypeUrl(), req.GetResponseNonce(), req.GetErrorDetail())
+}
+
+// onDeltaRequest is onRequest of a delta stream.
+func (t *adoptionTracker) onDeltaRequest(id int64, req *discoverypb.DeltaDiscoveryRequest) bool {
+	return t.onAckOrNack(streamKey{id: id, delta: true}, req.GetNode(), req.GetTypeUrl(), req.GetResponseNonce(), req.GetErrorDetail())
+}
+
+// onAckOrNack records the ACK or NACK of the response with the nonce. The
+// delta requests have no version, so the ACKed version is always the one sent
+// with the nonce.
+func (t *adoptionTracker) onAckOrNack(key streamKey, node *corepb.Node, typeUrl, nonce string, errorDetail *statuspb.Status) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	s := t.streams[key]
+	if s == nil {
+		return false
+	}
+	// Only the first request on the stream is required to have the node.
+	if node.GetId() != "" {
+		s.node = node.GetId()
+	}
+
+	a := s.types[typeUrl]
+	if a == nil || nonce == "" || nonce != a.sentNonce {
+		return false
+	}
+	if errorDetail != nil {
+		a.nackError = errorDetail.GetMessage()
+		glog.Warningf("Envoy %s rejected %s version %s: %s", s.node, typeUrl, a.sentVersion, a.nackError)
+		return false
+	}
+	a.ackedVersion = a.sentVersion
+	a.nackError = ""
+	return true
+}
+
+// acked returns whether any Envoy has ACKed a version of the resource type
+// generated from the service config. The versions are the config id, with a
+// suffix if the snapshot is updated for the same config.
+func (t *adoptionTracker) acked(typeUrl, configId string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, s := range t.streams {
+		if a := s.types[typeUrl]; a != nil {
+			if a.ackedVersion == configId || strings.HasPrefix(a.ackedVersion, configId+"-") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (t *adoptionTracker) onResponse(id int64, resp *discoverypb.DiscoveryResponse, now time.Time) {
+	t.onSent(streamKey{id: id}, resp.GetTypeUrl(), resp.GetVersionInfo(), resp.GetNonce(), now)
+}
+
+// onDeltaResponse is onResponse of a delta stream, whose system version is the
+// version of the snapshot.
+func (t *adoptionTracker) onDeltaResponse(id int64, resp *discoverypb.DeltaDiscoveryResponse, now time.Time) {
+	t.onSent(streamKey{id: id, delta: true}, resp.GetTypeUrl(), resp.GetSystemVersionInfo(), resp.GetNonce(), now)
+}
+
+func (t *adoptionTracker) onSent(key streamKey, typeUrl, version, nonce string, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	s := t.streams[key]
+	if s == nil {
+		return
+	}
+
+	a := s.types[typeUrl]
+	if a == nil {
+		a = &typeAdoption{}
+		s.types[typeUrl] = a
+	}
+	// The lag is counted from the first time the version is sent.
+	if version != a.sentVersion {
+		a.sentVersion = version
+		a.sentTime = now
+		a.nackError = ""
+	}
+	a.sentNonce = nonce
+}
+
+// adoptions returns the adoptions of all the connected Envoys, sorted by
+// node and type.
+func (t *adoptionTracker) adoptions(now time.Time, publishedVersion func(typeUrl string) string) []*Adoption {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var adoptions []*Adoption
+	for _, s := range t.streams {
+		for typeUrl, a := range s.types {
+			adoption := &Adoption{
+				Node:             s.node,
+				TypeUrl:          typeUrl,
+				PublishedVersion: publishedVersion(typeUrl),
+				SentVersion:      a.sentVersion,
+				AckedVersion:     a.ackedVersion,
+				NackError:        a.nackError,
+			}
+			if a.ackedVersion != a.sentVersion {
+				adoption.lag = now.Sub(a.sentTime)
+			}
+			adoption.Lag = adoption.lag.String()
+			adoptions = append(adoptions, adoption)
+		}
+	}
+	sort.Slice(adoptions, func(i, j int) bool {
+		if adoptions[i].Node != adoptions[j].Node {
+			return adoptions[i].Node < adoptions[j].Node
+		}
+		return adoptions[i].TypeUrl < adoptions[j].TypeUrl
+	})
+	return adoptions
+}
+
+// Adoptions reports how far each connected Envoy is behind the published
+// snapshot.
+func (m *ConfigManager) Adoptions() []*Adoption {
+	return m.adoptions(time.Now())
+}
+
+func (m *ConfigManager) adoptions(now time.Time) []*Adoption {
+	if m.adoption == nil {
+		return nil
+	}
+	snapshot, err := m.cache.GetSnapshot(m.envoyConfigOptions.Node)
+	return m.adoption.adoptions(now, func(typeUrl string) string {
+		if err != nil {
+			return ""
+		}
+		return snapshot.GetVersion(typeUrl)
+	})
+}
@@ -0,0 +1,166 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+
+	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	discoverypb "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+)
+
+func TestAdoptions(t *testing.T) {
+	m := &ConfigManager{
+		adoption: newAdoptionTracker(),
+	}
+	m.envoyConfigOptions.Node = "api_proxy"
+	m.cache = cache.NewSnapshotCache(true, m, m)
+	snapshot, err := cache.NewSnapshot("2021-01-01r1", map[rsrc.Type][]types.Resource{
+		rsrc.ClusterType:  nil,
+		rsrc.ListenerType: nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.cache.SetSnapshot(context.Background(), "api_proxy", snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := m.adoption
+	tracker.openStream(streamKey{id: 1})
+	tracker.onRequest(1, &discoverypb.DiscoveryRequest{
+		Node:    &corepb.Node{Id: "api_proxy"},
+		TypeUrl: rsrc.ClusterType,
+	})
+	tracker.onRequest(1, &discoverypb.DiscoveryRequest{
+		TypeUrl: rsrc.ListenerType,
+	})
+
+	// The clusters are ACKed, the listeners are rejected.
+	tracker.onResponse(1, &discoverypb.DiscoveryResponse{
+		TypeUrl:     rsrc.ClusterType,
+		VersionInfo: "2021-01-01r1",
+		Nonce:       "1",
+	}, start)
+	tracker.onResponse(1, &discoverypb.DiscoveryResponse{
+		TypeUrl:     rsrc.ListenerType,
+		VersionInfo: "2021-01-01r1",
+		Nonce:       "2",
+	}, start)
+	tracker.onRequest(1, &discoverypb.DiscoveryRequest{
+		TypeUrl:       rsrc.ClusterType,
+		VersionInfo:   "2021-01-01r1",
+		ResponseNonce: "1",
+	})
+	tracker.onRequest(1, &discoverypb.DiscoveryRequest{
+		TypeUrl:       rsrc.ListenerType,
+		ResponseNonce: "2",
+		ErrorDetail:   &statuspb.Status{Message: "invalid listener"},
+	})
+
+	// A stale ACK of an earlier response is ignored.
+	tracker.onRequest(1, &discoverypb.DiscoveryRequest{
+		TypeUrl:       rsrc.ListenerType,
+		VersionInfo:   "2021-01-01r1",
+		ResponseNonce: "0",
+	})
+
+	want := []*Adoption{
+		{
+			Node:             "api_proxy",
+			TypeUrl:          rsrc.ClusterType,
+			PublishedVersion: "2021-01-01r1",
+			SentVersion:      "2021-01-01r1",
+			AckedVersion:     "2021-01-01r1",
+			Lag:              "0s",
+		},
+		{
+			Node:             "api_proxy",
+			TypeUrl:          rsrc.ListenerType,
+			PublishedVersion: "2021-01-01r1",
+			SentVersion:      "2021-01-01r1",
+			Lag:              "2m0s",
+			NackError:        "invalid listener",
+			lag:              2 * time.Minute,
+		},
+	}
+	if got := m.adoptions(start.Add(2 * time.Minute)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got adoptions: %+v, want: %+v", got, want)
+	}
+
+	setFlag(t, "check_rollout_interval", "1m")
+	setFlag(t, "watchdog_max_goroutines", "0")
+	setFlag(t, "watchdog_max_adoption_lag", "1m")
+	err = m.checkHealth(start.Add(2 * time.Minute))
+	if wantError := "Envoy api_proxy has not ACKed type.googleapis.com/envoy.config.listener.v3.Listener version 2021-01-01r1 for 2m0s"; err == nil || !strings.Contains(err.Error(), wantError) {
+		t.Errorf("got health error: %v, want error: %s", err, wantError)
+	}
+
+	tracker.closeStream(streamKey{id: 1})
+	if got := m.adoptions(start); len(got) != 0 {
+		t.Errorf("got adoptions of a closed stream: %+v", got)
+	}
+}
+
+func TestDeltaAdoptions(t *testing.T) {
+	m := &ConfigManager{
+		adoption: newAdoptionTracker(),
+	}
+	m.envoyConfigOptions.Node = "api_proxy"
+	m.cache = cache.NewSnapshotCache(true, m, m)
+
+	// The state of the world and the delta streams have the same ids.
+	callbacks := m.XdsCallbacks()
+	_ = callbacks.OnStreamOpen(context.Background(), 1, "")
+	_ = callbacks.OnDeltaStreamOpen(context.Background(), 1, "")
+	callbacks.OnStreamResponse(context.Background(), 1, nil, &discoverypb.DiscoveryResponse{
+		TypeUrl:     rsrc.ListenerType,
+		VersionInfo: "2021-01-01r0",
+		Nonce:       "1",
+	})
+	callbacks.OnStreamDeltaResponse(1, nil, &discoverypb.DeltaDiscoveryResponse{
+		TypeUrl:           rsrc.ListenerType,
+		SystemVersionInfo: "2021-01-01r1",
+		Nonce:             "1",
+	})
+	_ = callbacks.OnStreamDeltaRequest(1, &discoverypb.DeltaDiscoveryRequest{
+		Node:          &corepb.Node{Id: "api_proxy"},
+		TypeUrl:       rsrc.ListenerType,
+		ResponseNonce: "1",
+	})
+
+	if !m.adoption.acked(rsrc.ListenerType, "2021-01-01r1") {
+		t.Errorf("the version ACKed on the delta stream is not ACKed")
+	}
+	if m.adoption.acked(rsrc.ListenerType, "2021-01-01r0") {
+		t.Errorf("the version sent on the state of the world stream is ACKed")
+	}
+
+	callbacks.OnDeltaStreamClosed(1)
+	got := m.adoptions(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	if len(got) != 1 || got[0].SentVersion != "2021-01-01r0" {
+		t.Errorf("got adoptions after the delta stream is closed: %+v, want the state of the world stream only", got)
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/oauth2/clientcredentials"
+
+	gen "github.com/GoogleCloudPlatform/esp-v2/src/go/configgenerator"
+	listenerpb "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	hcmpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+)
+
+const (
+	// The OAuth tokens are refreshed this long before they expire.
+	backendTokenRefreshMargin = time.Minute
+	// The delay of retrying a failed refresh, and the min delay of refreshing.
+	backendTokenRetryDelay = 10 * time.Second
+	// The API key files are read again this often, so the rotated keys are
+	// picked up.
+	backendKeyFileReloadInterval = time.Minute
+)
+
+// fetchBackendCredential returns the header value of the credential, and when
+// it expires, zero if it never does. The key and client secret are read by
+// readFile, which also resolves the Secret Manager uris.
+var fetchBackendCredential = func(c *configinfo.BackendCredential, readFile func(string) ([]byte, error)) (string, time.Time, error) {
+	switch c.Type {
+	case configinfo.ApiKeyBackendCredential:
+		key, err := readFile(c.KeyFile)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("fail to read the API key: %v", err)
+		}
+		return strings.TrimSpace(string(key)), time.Time{}, nil
+	case configinfo.OAuth2BackendCredential:
+		secret, err := readFile(c.ClientSecretFile)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("fail to read the client secret: %v", err)
+		}
+		config := &clientcredentials.Config{
+			ClientID:     c.ClientId,
+			ClientSecret: strings.TrimSpace(string(secret)),
+			TokenURL:     c.TokenUrl,
+			Scopes:       c.Scopes,
+		}
+		token, err := config.Token(context.Background())
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("fail to fetch the OAuth token from %s: %v", c.TokenUrl, err)
+		}
+		return token.Type() + " " + token.AccessToken, token.Expiry, nil
+	default:
+		return "", time.Time{}, fmt.Errorf("unknown backend credential type %q", c.Type)
+	}
+}
+
+// initBackendCredentials fetches all the credentials of --backend_credentials
+// before any service config is applied, and keeps them refreshed, so the
+// snapshots are made without calling the token endpoints under the mutex.
+func (m *ConfigManager) initBackendCredentials(now time.Time) error {
+	credentials, err := configinfo.ParseBackendCredentials(m.envoyConfigOptions.BackendCredentials)
+	if err != nil {
+		return err
+	}
+	if len(credentials) == 0 {
+		return nil
+	}
+
+	m.backendCredentialValues = make(map[string]string)
+	m.backendCredentialTimers = make(map[string]*time.Timer)
+	for id, c := range credentials {
+		value, expiry, err := fetchBackendCredential(c, m.readSecretOrFile)
+		if err != nil {
+			return fmt.Errorf("fail to fetch the backend credential of type %s, %v", c.Type, err)
+		}
+		m.backendCredentialValues[id] = value
+		m.scheduleBackendCredentialRefresh(c, backendCredentialRefreshDelay(expiry, now))
+	}
+	return nil
+}
+
+// backendCredentialRefreshDelay returns when to refresh the credential
+// expiring at expiry. The API keys never expire, their files are read again
+// periodically instead.
+func backendCredentialRefreshDelay(expiry, now time.Time) time.Duration {
+	if expiry.IsZero() {
+		return backendKeyFileReloadInterval
+	}
+	delay := expiry.Add(-backendTokenRefreshMargin).Sub(now)
+	if delay < backendTokenRetryDelay {
+		return backendTokenRetryDelay
+	}
+	return delay
+}
+
+// scheduleBackendCredentialRefresh must be called with the mutex held once
+// the config manager is serving.
+func (m *ConfigManager) scheduleBackendCredentialRefresh(c *configinfo.BackendCredential, delay time.Duration) {
+	m.backendCredentialTimers[c.Id] = time.AfterFunc(delay, func() {
+		m.refreshBackendCredential(c, time.Now())
+	})
+}
+
+// refreshBackendCredential fetches the credential again, and pushes it to
+// Envoy if it changed. The previous value is kept if the refresh fails.
+func (m *ConfigManager) refreshBackendCredential(c *configinfo.BackendCredential, now time.Time) {
+	value, expiry, err := fetchBackendCredential(c, m.readSecretOrFile)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return
+	}
+	if err != nil {
+		glog.Errorf("fail to refresh the backend credential of type %s, retry in %v, %v", c.Type, backendTokenRetryDelay, err)
+		m.scheduleBackendCredentialRefresh(c, backendTokenRetryDelay)
+		return
+	}
+	m.scheduleBackendCredentialRefresh(c, backendCredentialRefreshDelay(expiry, now))
+	if m.backendCredentialValues[c.Id] == value {
+		return
+	}
+
+	m.backendCredentialValues[c.Id] = value
+	if m.serviceInfo == nil {
+		return
+	}
+	if _, ok := m.serviceInfo.BackendCredentials()[c.Id]; !ok {
+		// Not used by the served service config.
+		return
+	}
+
+	m.backendCredentialVersion++
+	snapshot, err := m.makeSnapshot(m.curConfigId(), m.serviceInfo)
+	if err == nil {
+		err = m.cache.SetSnapshot(context.Background(), m.envoyConfigOptions.Node, *snapshot)
+	}
+	if err != nil {
+		glog.Errorf("fail to push the refreshed backend credential, %v", err)
+		return
+	}
+	glog.Infof("refreshed the backend credential of type %s", c.Type)
+}
+
+// stopBackendCredentialRefreshes must be called with the mutex held.
+func (m *ConfigManager) stopBackendCredentialRefreshes() {
+	for _, timer := range m.backendCredentialTimers {
+		timer.Stop()
+	}
+}
+
+// redactBackendCredentials sets placeholders for the credentials of the
+// configs not served to Envoy, e.g. the dry run and the validation.
+func redactBackendCredentials(serviceInfo *configinfo.ServiceInfo) {
+	serviceInfo.BackendCredentialValues = make(map[string]string)
+	for id := range serviceInfo.BackendCredentials() {
+		serviceInfo.BackendCredentialValues[id] = gen.RedactedBackendCredential
+	}
+}
+
+// copyBackendCredentialValues must be called with the mutex held, as the
+// values are updated by the refreshes.
+func copyBackendCredentialValues(values map[string]string) map[string]string {
+	copied := make(map[string]string)
+	for id, value := range values {
+		copied[id] = value
+	}
+	return copied
+}
+
+// redactListeners returns copies of the listeners with the backend credentials
+// redacted, for the listeners that are dumped or shown, e.g. by /configz and
+// the dry run.
+func redactListeners(listeners []*listenerpb.Listener, credentialValues map[string]string) ([]*listenerpb.Listener, error) {
+	if len(credentialValues) == 0 {
+		return listeners, nil
+	}
+
+	var redacted []*listenerpb.Listener
+	for _, listener := range listeners {
+		listener = proto.Clone(listener).(*listenerpb.Listener)
+		for _, filterChain := range listener.GetFilterChains() {
+			for _, filter := range filterChain.GetFilters() {
+				if filter.GetName() != util.HTTPConnectionManager {
+					continue
+				}
+				hcm := &hcmpb.HttpConnectionManager{}
+				if err := ptypes.UnmarshalAny(filter.GetTypedConfig(), hcm); err != nil {
+					return nil, fmt.Errorf("fail to unmarshal http connection manager of listener %s: %v", listener.GetName(), err)
+				}
+				hcmAny, err := ptypes.MarshalAny(gen.RedactHttpConMgrBackendCredentials(hcm, credentialValues))
+				if err != nil {
+					return nil, err
+				}
+				filter.ConfigType = &listenerpb.Filter_TypedConfig{TypedConfig: hcmAny}
+			}
+		}
+		redacted = append(redacted, listener)
+	}
+	return redacted, nil
+}
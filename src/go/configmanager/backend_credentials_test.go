@@ -0,0 +1,314 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/secretmanager"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/proto"
+
+	listenerpb "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	secretpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestFetchBackendCredential(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyFile, []byte("backend-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	secretFile := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(secretFile, []byte("client-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("scope") != "read write" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if id, secret, ok := r.BasicAuth(); !ok || id != "proxy" || secret != "client-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token": "oauth-token", "token_type": "Bearer", "expires_in": 3600}`)
+	}))
+	defer tokenServer.Close()
+
+	testCases := []struct {
+		desc       string
+		credential *configinfo.BackendCredential
+		wantValue  string
+		wantExpiry bool
+		wantError  string
+	}{
+		{
+			desc: "API key read from the file",
+			credential: &configinfo.BackendCredential{
+				Type:    configinfo.ApiKeyBackendCredential,
+				KeyFile: keyFile,
+			},
+			wantValue: "backend-key",
+		},
+		{
+			desc: "API key file not found",
+			credential: &configinfo.BackendCredential{
+				Type:    configinfo.ApiKeyBackendCredential,
+				KeyFile: filepath.Join(dir, "not-found"),
+			},
+			wantError: "fail to read the API key",
+		},
+		{
+			desc: "OAuth token fetched with the client credentials",
+			credential: &configinfo.BackendCredential{
+				Type:             configinfo.OAuth2BackendCredential,
+				TokenUrl:         tokenServer.URL,
+				ClientId:         "proxy",
+				ClientSecretFile: secretFile,
+				Scopes:           []string{"read", "write"},
+			},
+			wantValue:  "Bearer oauth-token",
+			wantExpiry: true,
+		},
+		{
+			desc: "OAuth token rejected",
+			credential: &configinfo.BackendCredential{
+				Type:             configinfo.OAuth2BackendCredential,
+				TokenUrl:         tokenServer.URL,
+				ClientId:         "unknown",
+				ClientSecretFile: secretFile,
+				Scopes:           []string{"read", "write"},
+			},
+			wantError: "fail to fetch the OAuth token from " + tokenServer.URL,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			value, expiry, err := fetchBackendCredential(tc.credential, ioutil.ReadFile)
+			if tc.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+					t.Fatalf("got error: %v, want: %s", err, tc.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value != tc.wantValue {
+				t.Errorf("got value: %q, want: %q", value, tc.wantValue)
+			}
+			if expiry.IsZero() == tc.wantExpiry {
+				t.Errorf("got expiry: %v, want expiry: %v", expiry, tc.wantExpiry)
+			}
+		})
+	}
+}
+
+func TestFetchBackendCredentialFromSecret(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/projects/project-1/secrets/backend-key/versions/latest:access") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		resp, err := proto.Marshal(&secretpb.AccessSecretVersionResponse{
+			Payload: &secretpb.SecretPayload{
+				Data: []byte("backend-key\n"),
+			},
+		})
+		if err != nil {
+			t.Fatalf("fail to generate access secret response: %v", err)
+		}
+		_, _ = w.Write(resp)
+	}))
+	defer s.Close()
+
+	m := &ConfigManager{
+		secretFetcher: secretmanager.NewSecretFetcher(&http.Client{}, s.URL, func() (string, time.Duration, error) {
+			return "ya29.token", time.Hour, nil
+		}),
+	}
+	c := &configinfo.BackendCredential{
+		Type:    configinfo.ApiKeyBackendCredential,
+		KeyFile: "sm://project-1/backend-key",
+	}
+	value, _, err := fetchBackendCredential(c, m.readSecretOrFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "backend-key" {
+		t.Errorf("got value: %q, want: %q", value, "backend-key")
+	}
+
+	c.KeyFile = "sm://project-1/unknown-key"
+	if _, _, err := fetchBackendCredential(c, m.readSecretOrFile); err == nil || !strings.Contains(err.Error(), "fail to fetch secret sm://project-1/unknown-key") {
+		t.Errorf("got error: %v, want the secret fetch error", err)
+	}
+}
+
+func TestBackendCredentialRefreshDelay(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	testCases := []struct {
+		desc      string
+		expiry    time.Time
+		wantDelay time.Duration
+	}{
+		{
+			desc:      "refreshed before the expiry",
+			expiry:    now.Add(time.Hour),
+			wantDelay: time.Hour - backendTokenRefreshMargin,
+		},
+		{
+			desc:      "expiring token is not refreshed in a tight loop",
+			expiry:    now.Add(30 * time.Second),
+			wantDelay: backendTokenRetryDelay,
+		},
+		{
+			desc:      "API key file is read again periodically",
+			wantDelay: backendKeyFileReloadInterval,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := backendCredentialRefreshDelay(tc.expiry, now); got != tc.wantDelay {
+				t.Errorf("got delay: %v, want: %v", got, tc.wantDelay)
+			}
+		})
+	}
+}
+
+func TestBackendCredentialsRedacted(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyFile, []byte("backend-secret-key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := newRevertTestConfigManager()
+	m.envoyConfigOptions.BackendCredentials = "endpoints.examples.bookstore.Bookstore.ListShelves=type=api_key,key_file=" + keyFile
+	m.envoyConfigOptions.DumpGeneratedConfigDir = filepath.Join(dir, "dump")
+	if err := m.initBackendCredentials(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	serviceConfig := revertTestServiceConfig("2021-01-01r0")
+	serviceConfig.Apis[0].Methods = []*apipb.Method{
+		{
+			Name: "ListShelves",
+		},
+	}
+	serviceConfig.Http = &annotationspb.Http{
+		Rules: []*annotationspb.HttpRule{
+			{
+				Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+				Pattern: &annotationspb.HttpRule_Get{
+					Get: "/v1/shelves",
+				},
+			},
+		},
+	}
+	if err := m.applyServiceConfig(serviceConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	// Envoy is served the credential.
+	snapshot, err := m.cache.GetSnapshot(m.envoyConfigOptions.Node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var served []string
+	for _, r := range snapshot.GetResources(rsrc.ListenerType) {
+		listenerJson, err := util.ProtoToJson(r.(*listenerpb.Listener))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hcms, err := listenerHttpConnectionManagers(r.(*listenerpb.Listener))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, hcm := range hcms {
+			hcmJson, err := util.ProtoToJson(hcm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			served = append(served, listenerJson, hcmJson)
+		}
+	}
+	if !strings.Contains(strings.Join(served, "\n"), "backend-secret-key") {
+		t.Errorf("the served listeners do not have the backend credential")
+	}
+
+	// But it is not shown.
+	z, err := m.configzJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(z), "backend-secret-key") || !strings.Contains(string(z), "REDACTED") {
+		t.Errorf("got /configz: %s, want the backend credential redacted", z)
+	}
+
+	next := proto.Clone(serviceConfig).(*confpb.Service)
+	next.Id = "2021-01-02r0"
+	report, err := m.dryRun(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reportJson, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(reportJson), "backend-secret-key") {
+		t.Errorf("got dry run report: %s, want the backend credential redacted", reportJson)
+	}
+	if len(report.Routes) != 0 {
+		t.Errorf("got route diffs: %+v, want none for the unchanged routes", report.Routes)
+	}
+
+	err = filepath.Walk(m.envoyConfigOptions.DumpGeneratedConfigDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		dumped, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if strings.Contains(string(dumped), "backend-secret-key") {
+			t.Errorf("got dumped config %s with the backend credential, want it redacted", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/glog"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+)
+
+var (
+	canaryFraction = flag.Float64("canary_fraction", 0, `the fraction of the proxy instances serving a new service config of the managed rollout as canaries for the bake period. 0 disables the canary analysis.
+					Each instance is selected independently with this probability by hashing its hostname and the config id, so the share of canaries only
+					approaches the fraction on large deployments, and a small deployment may have no canary for a config.
+					The instances do not talk to each other, the other instances learn the result of the canaries through Service Management:
+					once the bake period is over, they adopt the config only if it is still the latest rollout, i.e. it was not rolled back after the canaries alerted.`)
+	canaryBakePeriod           = flag.Duration("canary_bake_period", 10*time.Minute, `the time the canaries serve a new service config before it is adopted by the other instances.`)
+	canaryMaxErrorRateIncrease = flag.Float64("canary_max_error_rate_increase", 0.01, `the canaries roll back the new service config if its 5xx error rate exceeds the one of the previous config by more than this.`)
+	canaryEnvoyAdminUrl        = flag.String("canary_envoy_admin_url", "", `the url of the Envoy admin interface to read the error rate stats from, e.g. http://127.0.0.1:8001. Required by the canary analysis.`)
+)
+
+const (
+	canaryStateBaking     = "baking"
+	canaryStateDeferred   = "deferred"
+	canaryStatePassed     = "passed"
+	canaryStateRolledBack = "rolled_back"
+	canaryStateSuperseded = "superseded"
+
+	envoyErrorsStat = "http." + util.StatPrefix + ".downstream_rq_5xx"
+	envoyTotalStat  = "http." + util.StatPrefix + ".downstream_rq_completed"
+)
+
+// errorStats are the cumulative Envoy counters of the downstream requests.
+type errorStats struct {
+	errors uint64
+	total  uint64
+}
+
+// errorRateSince returns the error rate of the requests completed since base.
+func (s errorStats) errorRateSince(base errorStats) float64 {
+	// The counters are reset if Envoy has restarted.
+	if s.total < base.total || s.errors < base.errors {
+		base = errorStats{}
+	}
+	if s.total == base.total {
+		return 0
+	}
+	return float64(s.errors-base.errors) / float64(s.total-base.total)
+}
+
+// canaryStatus is the latest canary analysis, as reported by the admin
+// interface.
+type canaryStatus struct {
+	ConfigId string `json:"config_id"`
+	// One of baking, deferred, passed, rolled_back or superseded.
+	State             string    `json:"state"`
+	Start             time.Time `json:"start"`
+	BaselineErrorRate float64   `json:"baseline_error_rate"`
+	ErrorRate         float64   `json:"error_rate"`
+}
+
+// canary is a new service config in its bake period.
+type canary struct {
+	status canaryStatus
+	// Whether this instance serves the new config during the bake period.
+	serving bool
+	// The new config served by the canary, persisted once it passes.
+	serviceConfig *confpb.Service
+	startStats    errorStats
+	timer         *time.Timer
+}
+
+// isCanaryInstance selects the instances serving a new config as canaries,
+// consistently for all the checks of the same config. Each instance is a
+// canary with the probability of fraction, there is no coordination among
+// the instances.
+func isCanaryInstance(instance, configId string, fraction float64) bool {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(instance + "/" + configId))
+	return float64(h.Sum32()) < fraction*float64(math.MaxUint32)
+}
+
+// rolloutServiceConfig adopts the latest service config of the managed
+// rollout, after its bake period if the canary analysis is enabled.
+//
+// The canaries roll a new config back if it degrades the error rate, and
+// log an alert so that the rollout can be rolled back in Service Management
+// before the other instances adopt it.
+func (m *ConfigManager) rolloutServiceConfig(latestConfigId string, now time.Time) error {
+	if *canaryFraction <= 0 {
+		return m.fetchAndApplyServiceConfig(latestConfigId)
+	}
+
+	m.canaryMutex.Lock()
+	defer m.canaryMutex.Unlock()
+
+	if latestConfigId == m.rejectedConfigId {
+		glog.Infof("canary: service config %s was rolled back, waiting for a new rollout", latestConfigId)
+		return nil
+	}
+	if m.canary != nil {
+		if m.canary.status.ConfigId == latestConfigId {
+			return nil
+		}
+		glog.Infof("canary: service config %s is superseded by %s", m.canary.status.ConfigId, latestConfigId)
+		m.canary.timer.Stop()
+		m.canary = nil
+	}
+	if latestConfigId == m.servedConfigId() {
+		return nil
+	}
+	return m.startCanary(latestConfigId, now)
+}
+
+// startCanary must be called with the canaryMutex held.
+func (m *ConfigManager) startCanary(configId string, now time.Time) error {
+	c := &canary{
+		status: canaryStatus{
+			ConfigId: configId,
+			State:    canaryStateDeferred,
+			Start:    now,
+		},
+		serving: isCanaryInstance(m.instance, configId, *canaryFraction),
+	}
+
+	if c.serving {
+		stats, err := m.errorStatsFetcher()
+		if err != nil {
+			return fmt.Errorf("fail to read the error stats to start the canary of service config %s, %v", configId, err)
+		}
+		serviceConfig, err := m.serviceConfigFetcher.FetchConfig(configId)
+		if err != nil {
+			return err
+		}
+		// The config is not the last-known-good one until it passes.
+		if err := m.applyServiceConfig(serviceConfig); err != nil {
+			return err
+		}
+		c.serviceConfig = serviceConfig
+		c.status.State = canaryStateBaking
+		c.status.BaselineErrorRate = stats.errorRateSince(m.adoptedStats)
+		c.startStats = stats
+		m.adoptedStats = stats
+		glog.Infof("canary: serving service config %s for the bake period %v", configId, *canaryBakePeriod)
+	} else {
+		glog.Infof("canary: deferring service config %s for the bake period %v", configId, *canaryBakePeriod)
+	}
+
+	m.canary = c
+	m.setCanaryStatus(c.status)
+	m.scheduleCanaryFinish(c, *canaryBakePeriod)
+	return nil
+}
+
+// scheduleCanaryFinish finishes the canary after the delay, and retries on
+// errors at the rollout check interval.
+func (m *ConfigManager) scheduleCanaryFinish(c *canary, delay time.Duration) {
+	c.timer = time.AfterFunc(delay, func() {
+		m.canaryMutex.Lock()
+		defer m.canaryMutex.Unlock()
+
+		if m.canary != c {
+			return
+		}
+		if err := m.finishCanary(); err != nil {
+			glog.Errorf("canary: %v", err)
+			m.scheduleCanaryFinish(c, *checkNewRolloutInterval)
+		}
+	})
+}
+
+// finishCanary must be called with the canaryMutex held.
+func (m *ConfigManager) finishCanary() error {
+	c := m.canary
+	if !c.serving {
+		// The canaries alert on a failure so the rollout is rolled back in
+		// Service Management, the config is only adopted if it was not.
+		latestConfigId, err := m.serviceConfigFetcher.LoadConfigIdFromRollouts()
+		if err != nil {
+			return fmt.Errorf("fail to check the rollout of service config %s before adopting it, %v", c.status.ConfigId, err)
+		}
+		if latestConfigId != c.status.ConfigId {
+			m.canary = nil
+			c.status.State = canaryStateSuperseded
+			m.setCanaryStatus(c.status)
+			glog.Infof("canary: service config %s is not the latest rollout anymore, not adopted", c.status.ConfigId)
+			return nil
+		}
+		if err := m.fetchAndApplyServiceConfig(c.status.ConfigId); err != nil {
+			return err
+		}
+		m.canary = nil
+		c.status.State = canaryStatePassed
+		m.setCanaryStatus(c.status)
+		return nil
+	}
+
+	stats, err := m.errorStatsFetcher()
+	if err != nil {
+		return fmt.Errorf("fail to read the error stats to finish the canary of service config %s, %v", c.status.ConfigId, err)
+	}
+	m.canary = nil
+	c.status.ErrorRate = stats.errorRateSince(c.startStats)
+
+	if c.status.ErrorRate <= c.status.BaselineErrorRate+*canaryMaxErrorRateIncrease {
+		glog.Infof("canary: service config %s passed with error rate %.4f, baseline %.4f", c.status.ConfigId, c.status.ErrorRate, c.status.BaselineErrorRate)
+		c.status.State = canaryStatePassed
+		m.setCanaryStatus(c.status)
+		m.saveServiceConfigOnAck(c.serviceConfig)
+		return nil
+	}
+
+	revertedId, err := m.Revert()
+	if err != nil {
+		return fmt.Errorf("fail to roll back the canary of service config %s, %v", c.status.ConfigId, err)
+	}
+	m.rejectedConfigId = c.status.ConfigId
+	m.adoptedStats = stats
+	c.status.State = canaryStateRolledBack
+	m.setCanaryStatus(c.status)
+	glog.Errorf("ALERT canary: service config %s raised the error rate from %.4f to %.4f, rolled back to service config %s",
+		c.status.ConfigId, c.status.BaselineErrorRate, c.status.ErrorRate, revertedId)
+	return nil
+}
+
+func (m *ConfigManager) setCanaryStatus(status canaryStatus) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.canaryStatus = &status
+}
+
+// latestCanaryStatus returns the latest canary analysis, or nil if there is
+// none.
+func (m *ConfigManager) latestCanaryStatus() *canaryStatus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.canaryStatus
+}
+
+// initCanary validates the canary flags and sets up reading the error stats
+// from Envoy.
+func (m *ConfigManager) initCanary(client *http.Client) error {
+	if *canaryFraction <= 0 {
+		return nil
+	}
+	if *canaryFraction > 1 {
+		return fmt.Errorf("flag --canary_fraction must be in [0, 1], got %v", *canaryFraction)
+	}
+	if *canaryEnvoyAdminUrl == "" {
+		return fmt.Errorf("flag --canary_fraction requires flag --canary_envoy_admin_url")
+	}
+
+	instance, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("fail to get the hostname to select the canaries, %v", err)
+	}
+	m.instance = instance
+	m.errorStatsFetcher = func() (errorStats, error) {
+		return fetchEnvoyErrorStats(client, *canaryEnvoyAdminUrl)
+	}
+	return nil
+}
+
+// fetchEnvoyErrorStats reads the downstream request counters from the Envoy
+// admin interface.
+func fetchEnvoyErrorStats(client *http.Client, adminUrl string) (errorStats, error) {
+	query := url.Values{}
+	query.Set("format", "json")
+	query.Set("filter", fmt.Sprintf(`^http\.%s\.downstream_rq_(5xx|completed)$`, util.StatPrefix))
+	resp, err := client.Get(adminUrl + "/stats?" + query.Encode())
+	if err != nil {
+		return errorStats{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errorStats{}, fmt.Errorf("envoy admin returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Stats []struct {
+			Name  string `json:"name"`
+			Value uint64 `json:"value"`
+		} `json:"stats"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return errorStats{}, fmt.Errorf("fail to decode envoy stats, %v", err)
+	}
+
+	var stats errorStats
+	for _, stat := range body.Stats {
+		switch stat.Name {
+		case envoyErrorsStat:
+			stats.errors = stat.Value
+		case envoyTotalStat:
+			stats.total = stat.Value
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,210 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	sc "github.com/GoogleCloudPlatform/esp-v2/src/go/serviceconfig"
+	smpb "google.golang.org/genproto/googleapis/api/servicemanagement/v1"
+)
+
+func TestErrorRateSince(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		base  errorStats
+		stats errorStats
+		want  float64
+	}{
+		{
+			desc:  "error rate since the base",
+			base:  errorStats{errors: 10, total: 100},
+			stats: errorStats{errors: 20, total: 200},
+			want:  0.1,
+		},
+		{
+			desc:  "no requests since the base",
+			base:  errorStats{errors: 10, total: 100},
+			stats: errorStats{errors: 10, total: 100},
+		},
+		{
+			desc:  "counters are reset by an Envoy restart",
+			base:  errorStats{errors: 10, total: 100},
+			stats: errorStats{errors: 5, total: 20},
+			want:  0.25,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := tc.stats.errorRateSince(tc.base); got != tc.want {
+				t.Errorf("got error rate: %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRolloutServiceConfigCanary(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		fraction string
+		// The Envoy stats read when the canary starts and finishes.
+		stats []errorStats
+		// The config of the latest rollout when the bake period is over, the
+		// canary config if empty.
+		latestRolloutConfig string
+		wantBakeConfig      string
+		wantState           string
+		wantConfigId        string
+	}{
+		{
+			desc:           "canary passes",
+			fraction:       "1",
+			stats:          []errorStats{{errors: 1, total: 100}, {errors: 2, total: 200}},
+			wantBakeConfig: "2021-01-02r0",
+			wantState:      canaryStatePassed,
+			wantConfigId:   "2021-01-02r0",
+		},
+		{
+			desc:           "canary raising the error rate is rolled back",
+			fraction:       "1",
+			stats:          []errorStats{{errors: 1, total: 100}, {errors: 51, total: 200}},
+			wantBakeConfig: "2021-01-02r0",
+			wantState:      canaryStateRolledBack,
+			wantConfigId:   "2021-01-01r0",
+		},
+		{
+			desc:           "other instances adopt the config after the bake period",
+			fraction:       "0.0000000001",
+			wantBakeConfig: "2021-01-01r0",
+			wantState:      canaryStatePassed,
+			wantConfigId:   "2021-01-02r0",
+		},
+		{
+			desc:                "other instances do not adopt the config rolled back in service management",
+			fraction:            "0.0000000001",
+			latestRolloutConfig: "2021-01-01r0",
+			wantBakeConfig:      "2021-01-01r0",
+			wantState:           canaryStateSuperseded,
+			wantConfigId:        "2021-01-01r0",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			setFlag(t, "canary_fraction", tc.fraction)
+			setFlag(t, "canary_bake_period", "1h")
+
+			latestRolloutConfig := tc.latestRolloutConfig
+			if latestRolloutConfig == "" {
+				latestRolloutConfig = "2021-01-02r0"
+			}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var msg proto.Message = revertTestServiceConfig(path.Base(r.URL.Path))
+				if path.Base(r.URL.Path) == "rollouts" {
+					msg = &smpb.ListServiceRolloutsResponse{
+						Rollouts: []*smpb.Rollout{
+							{
+								RolloutId: "rollout-id",
+								Strategy: &smpb.Rollout_TrafficPercentStrategy_{
+									TrafficPercentStrategy: &smpb.Rollout_TrafficPercentStrategy{
+										Percentages: map[string]float64{
+											latestRolloutConfig: 100,
+										},
+									},
+								},
+							},
+						},
+					}
+				}
+				body, err := proto.Marshal(msg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, _ = w.Write(body)
+			}))
+			defer server.Close()
+
+			m := newRevertTestConfigManager()
+			m.instance = "instance-1"
+			m.serviceConfigFetcher = sc.NewServiceConfigFetcher(server.Client(), server.URL, "bookstore.endpoints.project123.cloud.goog",
+				func() (string, time.Duration, error) { return "token", time.Hour, nil })
+			stats := tc.stats
+			m.errorStatsFetcher = func() (errorStats, error) {
+				s := stats[0]
+				stats = stats[1:]
+				return s, nil
+			}
+
+			if err := m.applyServiceConfig(revertTestServiceConfig("2021-01-01r0")); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.rolloutServiceConfig("2021-01-02r0", time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			if got := m.curConfigId(); got != tc.wantBakeConfig {
+				t.Errorf("got config id during the bake period: %s, want: %s", got, tc.wantBakeConfig)
+			}
+
+			m.canaryMutex.Lock()
+			err := m.finishCanary()
+			m.canaryMutex.Unlock()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.latestCanaryStatus().State; got != tc.wantState {
+				t.Errorf("got canary state: %s, want: %s", got, tc.wantState)
+			}
+			if got := m.curConfigId(); got != tc.wantConfigId {
+				t.Errorf("got config id: %s, want: %s", got, tc.wantConfigId)
+			}
+
+			// A rolled back config is not served again by the same rollout.
+			if err := m.rolloutServiceConfig("2021-01-02r0", time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			if got := m.curConfigId(); got != tc.wantConfigId {
+				t.Errorf("got config id after the rollout is checked again: %s, want: %s", got, tc.wantConfigId)
+			}
+		})
+	}
+}
+
+func TestFetchEnvoyErrorStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.URL.Query().Get("filter"), `^http\.ingress_http\.downstream_rq_(5xx|completed)$`; got != want {
+			t.Errorf("got stats filter: %s, want: %s", got, want)
+		}
+		_, _ = w.Write([]byte(`{"stats": [
+			{"name": "http.ingress_http.downstream_rq_5xx", "value": 3},
+			{"name": "http.ingress_http.downstream_rq_completed", "value": 120}
+		]}`))
+	}))
+	defer server.Close()
+
+	got, err := fetchEnvoyErrorStats(server.Client(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (errorStats{errors: 3, total: 120}); got != want {
+		t.Errorf("got stats: %+v, want: %+v", got, want)
+	}
+}
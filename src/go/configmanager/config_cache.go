@@ -0,0 +1,185 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/jsonlog"
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/jsonpb"
+
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+)
+
+var (
+	serviceConfigCachePath = flag.String("service_config_cache_path", "", `file path to persist the last-known-good service config fetched from Service Management, with its rollout.
+					A service config is persisted once Envoy ACKs it, after it passes the canary analysis if enabled, and the previous one is persisted again when it is reverted to.
+					If the service config can not be fetched at startup, e.g. during a Service Management outage, the persisted one is served instead of failing to start.
+					With the fixed rollout strategy, it is only served if it is the config of --service_config_id.`)
+)
+
+// cachedServiceConfig is the content of --service_config_cache_path.
+type cachedServiceConfig struct {
+	ServiceName   string          `json:"serviceName"`
+	RolloutId     string          `json:"rolloutId,omitempty"`
+	ServiceConfig json.RawMessage `json:"serviceConfig"`
+}
+
+// saveServiceConfigCache persists the service config to the file. The file is
+// replaced atomically, so a crash never leaves a partial config behind.
+func saveServiceConfigCache(path, serviceName, rolloutId string, serviceConfig *confpb.Service) error {
+	marshaler := &jsonpb.Marshaler{
+		AnyResolver: util.Resolver,
+	}
+	var config bytes.Buffer
+	if err := marshaler.Marshal(&config, serviceConfig); err != nil {
+		return fmt.Errorf("fail to marshal the service config: %v", err)
+	}
+	content, err := json.Marshal(&cachedServiceConfig{
+		ServiceName:   serviceName,
+		RolloutId:     rolloutId,
+		ServiceConfig: config.Bytes(),
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadServiceConfigCache reads the service config persisted for the service,
+// and its rollout.
+func loadServiceConfigCache(path, serviceName string) (*confpb.Service, string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	var cached cachedServiceConfig
+	if err := json.Unmarshal(content, &cached); err != nil {
+		return nil, "", fmt.Errorf("fail to unmarshal the cache: %v", err)
+	}
+	if cached.ServiceName != serviceName {
+		return nil, "", fmt.Errorf("the cache is of service %s", cached.ServiceName)
+	}
+	serviceConfig, err := util.UnmarshalServiceConfig(bytes.NewReader(cached.ServiceConfig))
+	if err != nil {
+		return nil, "", err
+	}
+	return serviceConfig, cached.RolloutId, nil
+}
+
+// saveServiceConfig persists the service config as the last-known-good one,
+// if --service_config_cache_path is set.
+func (m *ConfigManager) saveServiceConfig(serviceConfig *confpb.Service) {
+	if *serviceConfigCachePath == "" {
+		return
+	}
+	m.mutex.Lock()
+	rolloutId := m.curRolloutId
+	m.mutex.Unlock()
+
+	// Failing to persist should not block serving the config.
+	if err := saveServiceConfigCache(*serviceConfigCachePath, m.serviceName, rolloutId, serviceConfig); err != nil {
+		glog.Errorf("fail to persist the service config (%v) to %s: %v", serviceConfig.GetId(), *serviceConfigCachePath, err)
+	}
+}
+
+// saveServiceConfigOnAck persists the served service config once an Envoy
+// ACKs it, so a config rejected by Envoy never becomes the last-known-good
+// one. It is dropped if another config is served first.
+func (m *ConfigManager) saveServiceConfigOnAck(serviceConfig *confpb.Service) {
+	if *serviceConfigCachePath == "" {
+		return
+	}
+	m.mutex.Lock()
+	m.unconfirmedServiceConfig = serviceConfig
+	m.mutex.Unlock()
+
+	// The ACK may have arrived already.
+	m.saveAckedServiceConfig()
+}
+
+// saveAckedServiceConfig persists the config waiting for the ACK if an Envoy
+// has ACKed it, called on each ACK.
+func (m *ConfigManager) saveAckedServiceConfig() {
+	m.mutex.Lock()
+	serviceConfig := m.unconfirmedServiceConfig
+	if serviceConfig != nil && serviceConfig.GetId() != m.curConfigId() {
+		m.unconfirmedServiceConfig = nil
+		serviceConfig = nil
+	}
+	m.mutex.Unlock()
+	if serviceConfig == nil || m.adoption == nil || !m.adoption.acked(rsrc.ListenerType, serviceConfig.GetId()) {
+		return
+	}
+
+	m.mutex.Lock()
+	confirmed := m.unconfirmedServiceConfig == serviceConfig
+	if confirmed {
+		m.unconfirmedServiceConfig = nil
+	}
+	m.mutex.Unlock()
+	if confirmed {
+		m.saveServiceConfig(serviceConfig)
+	}
+}
+
+// applyCachedServiceConfig serves the last-known-good service config from
+// --service_config_cache_path. configId is the config to serve, any config is
+// served if it is empty.
+func (m *ConfigManager) applyCachedServiceConfig(configId string) error {
+	if *serviceConfigCachePath == "" {
+		return fmt.Errorf("flag --service_config_cache_path is not set")
+	}
+	serviceConfig, rolloutId, err := loadServiceConfigCache(*serviceConfigCachePath, m.serviceName)
+	if err != nil {
+		return fmt.Errorf("fail to load the cached service config from %s: %v", *serviceConfigCachePath, err)
+	}
+	if configId != "" && serviceConfig.GetId() != configId {
+		return fmt.Errorf("the cached service config is %s instead of %s", serviceConfig.GetId(), configId)
+	}
+	if err := m.applyServiceConfig(serviceConfig); err != nil {
+		return err
+	}
+
+	if rolloutId != "" {
+		jsonlog.SetField(logFieldRolloutId, rolloutId)
+	}
+	m.mutex.Lock()
+	m.curRolloutId = rolloutId
+	m.mutex.Unlock()
+	return nil
+}
@@ -0,0 +1,186 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configmanager/testdata"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/proto"
+
+	discoverypb "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestServiceConfigCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service_config.json")
+	serviceConfig := &confpb.Service{}
+	if err := unmarshalJsonTestToPbMessage(testdata.FakeServiceConfigForGrpcWithTranscoding, serviceConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveServiceConfigCache(path, "bookstore.endpoints.project123.cloud.goog", "2021-01-01r0", serviceConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	got, rolloutId, err := loadServiceConfigCache(path, "bookstore.endpoints.project123.cloud.goog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(got, serviceConfig) {
+		t.Errorf("got service config: %v, want: %v", got, serviceConfig)
+	}
+	if rolloutId != "2021-01-01r0" {
+		t.Errorf("got rollout id: %s, want: 2021-01-01r0", rolloutId)
+	}
+
+	wantError := "the cache is of service bookstore.endpoints.project123.cloud.goog"
+	if _, _, err := loadServiceConfigCache(path, "echo.endpoints.project123.cloud.goog"); err == nil || err.Error() != wantError {
+		t.Errorf("got error: %v, want: %s", err, wantError)
+	}
+}
+
+func TestStartupWithCachedServiceConfig(t *testing.T) {
+	var fakeConfig, fakeScReport, fakeRollouts safeData
+	setFlag(t, "service_config_cache_path", filepath.Join(t.TempDir(), "service_config.json"))
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendAddress = "grpc://127.0.0.1:80"
+	opts.DisableTracing = true
+
+	// The fetched service config is persisted once Envoy ACKs it.
+	if err := genProtoBinary(testdata.FakeServiceConfigForGrpcWithTranscoding, new(confpb.Service), &fakeConfig); err != nil {
+		t.Fatalf("generate fake service config failed: %v", err)
+	}
+	setFlags(testdata.TestFetchListenersProjectName, testdata.TestFetchListenersConfigID, util.FixedRolloutStrategy, "100ms", "")
+	runTest(t, &fakeScReport, &fakeRollouts, &fakeConfig, opts, func(configManager *ConfigManager, err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(*serviceConfigCachePath); !os.IsNotExist(err) {
+			t.Fatalf("got the service config persisted before the ACK, %v", err)
+		}
+		ackListeners(configManager, testdata.TestFetchListenersConfigID)
+		if _, err := os.Stat(*serviceConfigCachePath); err != nil {
+			t.Fatalf("got the service config not persisted after the ACK, %v", err)
+		}
+	})
+
+	brokenServiceConfig := &confpb.Service{
+		Name: testdata.TestFetchListenersProjectName,
+		Id:   testdata.TestFetchListenersConfigID,
+		Apis: []*apipb.Api{
+			{
+				Name: "endpoints.examples.bookstore.Bookstore",
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/shelves/{shelf",
+					},
+				},
+			},
+		},
+	}
+	brokenServiceConfigBytes, err := proto.Marshal(brokenServiceConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testData := []struct {
+		desc          string
+		configId      string
+		serviceConfig []byte
+		wantError     string
+	}{
+		{
+			desc:     "the cached service config is served",
+			configId: testdata.TestFetchListenersConfigID,
+			// Service Management returns a broken response.
+			serviceConfig: []byte{0xff, 0xff},
+		},
+		{
+			desc:          "the cached service config is not of the fixed config id",
+			configId:      "2021-01-01r1",
+			serviceConfig: []byte{0xff, 0xff},
+			wantError:     "fail to fetch and apply the startup service config",
+		},
+		{
+			desc:          "the cached service config does not replace a fetched config failing to apply",
+			configId:      testdata.TestFetchListenersConfigID,
+			serviceConfig: brokenServiceConfigBytes,
+			wantError:     "fail to apply the startup service config",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeConfig.write(tc.serviceConfig)
+			setFlags(testdata.TestFetchListenersProjectName, tc.configId, util.FixedRolloutStrategy, "100ms", "")
+			runTest(t, &fakeScReport, &fakeRollouts, &fakeConfig, opts, func(configManager *ConfigManager, err error) {
+				if tc.wantError != "" {
+					if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+						t.Fatalf("got error: %v, want: %s", err, tc.wantError)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				_, _, gotListeners, err := getListeners(configManager, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := util.JsonEqual(testdata.WantedListsenerForGrpcWithTranscoding, gotListeners); err != nil {
+					t.Errorf("snapshot cache fetch got unexpected Listeners, %v", err)
+				}
+			})
+		})
+	}
+}
+
+// ackListeners makes the config manager see an Envoy ACKing the listeners of
+// the version.
+func ackListeners(m *ConfigManager, version string) {
+	callbacks := m.XdsCallbacks()
+	_ = callbacks.OnStreamOpen(context.Background(), 1, rsrc.ListenerType)
+	callbacks.OnStreamResponse(context.Background(), 1, nil, &discoverypb.DiscoveryResponse{
+		TypeUrl:     rsrc.ListenerType,
+		VersionInfo: version,
+		Nonce:       "1",
+	})
+	_ = callbacks.OnStreamRequest(1, &discoverypb.DiscoveryRequest{
+		TypeUrl:       rsrc.ListenerType,
+		VersionInfo:   version,
+		ResponseNonce: "1",
+	})
+}
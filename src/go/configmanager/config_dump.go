@@ -0,0 +1,112 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	clusterpb "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	listenerpb "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	hcmpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+)
+
+var dumpFileNameReplacer = strings.NewReplacer("/", "_", string(os.PathSeparator), "_")
+
+// dumpGeneratedConfig writes the generated listeners, clusters and http filters
+// as pretty-printed JSON files under `dir/configId`, one file per resource.
+func dumpGeneratedConfig(dir, configId string, clusters []*clusterpb.Cluster, listeners []*listenerpb.Listener) error {
+	dumpDir := filepath.Join(dir, dumpFileNameReplacer.Replace(configId))
+	if err := os.MkdirAll(dumpDir, 0755); err != nil {
+		return fmt.Errorf("fail to create config dump directory %s: %v", dumpDir, err)
+	}
+
+	for _, cluster := range clusters {
+		if err := dumpResource(dumpDir, "cluster", cluster.GetName(), cluster); err != nil {
+			return err
+		}
+	}
+
+	for _, listener := range listeners {
+		if err := dumpResource(dumpDir, "listener", listener.GetName(), listener); err != nil {
+			return err
+		}
+
+		httpFilters, err := listenerHttpFilters(listener)
+		if err != nil {
+			return err
+		}
+		for _, httpFilter := range httpFilters {
+			if err := dumpResource(dumpDir, "filter", listener.GetName()+"_"+httpFilter.GetName(), httpFilter); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// listenerHttpFilters returns the http filters of the http connection managers
+// of the listener.
+func listenerHttpFilters(listener *listenerpb.Listener) ([]*hcmpb.HttpFilter, error) {
+	hcms, err := listenerHttpConnectionManagers(listener)
+	if err != nil {
+		return nil, err
+	}
+	var httpFilters []*hcmpb.HttpFilter
+	for _, hcm := range hcms {
+		httpFilters = append(httpFilters, hcm.GetHttpFilters()...)
+	}
+	return httpFilters, nil
+}
+
+func listenerHttpConnectionManagers(listener *listenerpb.Listener) ([]*hcmpb.HttpConnectionManager, error) {
+	var hcms []*hcmpb.HttpConnectionManager
+	for _, filterChain := range listener.GetFilterChains() {
+		for _, filter := range filterChain.GetFilters() {
+			if filter.GetName() != util.HTTPConnectionManager {
+				continue
+			}
+
+			hcm := &hcmpb.HttpConnectionManager{}
+			if err := ptypes.UnmarshalAny(filter.GetTypedConfig(), hcm); err != nil {
+				return nil, fmt.Errorf("fail to unmarshal http connection manager of listener %s: %v", listener.GetName(), err)
+			}
+			hcms = append(hcms, hcm)
+		}
+	}
+	return hcms, nil
+}
+
+func dumpResource(dir, kind, name string, msg proto.Message) error {
+	marshaler := &jsonpb.Marshaler{Indent: "  "}
+	json, err := marshaler.MarshalToString(msg)
+	if err != nil {
+		return fmt.Errorf("fail to marshal %s %s: %v", kind, name, err)
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%s_%s.json", kind, dumpFileNameReplacer.Replace(name)))
+	if err := ioutil.WriteFile(path, []byte(json+"\n"), 0644); err != nil {
+		return fmt.Errorf("fail to write %s %s to %s: %v", kind, name, path, err)
+	}
+	return nil
+}
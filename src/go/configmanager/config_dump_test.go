@@ -0,0 +1,109 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/google/go-cmp/cmp"
+
+	clusterpb "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	listenerpb "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	hcmpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+)
+
+func TestDumpGeneratedConfig(t *testing.T) {
+	hcm, err := ptypes.MarshalAny(&hcmpb.HttpConnectionManager{
+		StatPrefix: "ingress_http",
+		HttpFilters: []*hcmpb.HttpFilter{
+			{
+				Name: util.CORS,
+			},
+			{
+				Name: util.Router,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clusters := []*clusterpb.Cluster{
+		{
+			Name: "backend-cluster-mybackend.com:443",
+		},
+	}
+	listeners := []*listenerpb.Listener{
+		{
+			Name: util.IngressListenerName,
+			FilterChains: []*listenerpb.FilterChain{
+				{
+					Filters: []*listenerpb.Filter{
+						{
+							Name: util.HTTPConnectionManager,
+							ConfigType: &listenerpb.Filter_TypedConfig{
+								TypedConfig: hcm,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "config_dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := dumpGeneratedConfig(dir, "2021-01-01r0", clusters, listeners); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "2021-01-01r0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotFiles []string
+	for _, file := range files {
+		gotFiles = append(gotFiles, file.Name())
+	}
+	sort.Strings(gotFiles)
+
+	wantFiles := []string{
+		"cluster_backend-cluster-mybackend.com:443.json",
+		"filter_ingress_listener_envoy.filters.http.cors.json",
+		"filter_ingress_listener_envoy.filters.http.router.json",
+		"listener_ingress_listener.json",
+	}
+	if diff := cmp.Diff(wantFiles, gotFiles); diff != "" {
+		t.Errorf("dumped files diff (-want +got):\n%s", diff)
+	}
+
+	gotCluster, err := ioutil.ReadFile(filepath.Join(dir, "2021-01-01r0", "cluster_backend-cluster-mybackend.com:443.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := util.JsonEqual(`{"name": "backend-cluster-mybackend.com:443"}`, string(gotCluster)); err != nil {
+		t.Errorf("dumped cluster is not expected: %v", err)
+	}
+}
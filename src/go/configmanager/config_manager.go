@@ -23,20 +23,27 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/metadata"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
-	"github.com/GoogleCloudPlatform/esp-v2/src/go/tokengenerator"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/secretmanager"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/jsonlog"
+	"github.com/cenkalti/backoff"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
 	"github.com/golang/glog"
 
 	gen "github.com/GoogleCloudPlatform/esp-v2/src/go/configgenerator"
+	scpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/v10/http/service_control"
 	sc "github.com/GoogleCloudPlatform/esp-v2/src/go/serviceconfig"
 	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	tlspb "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
 	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
 )
@@ -53,6 +60,14 @@ var (
 					GCP metadata server will not be called to fetch access token, and
 					following flags will be ignored; --service_config_id, --service,
 					--rollout_strategy`)
+	OpenAPIPath = flag.String("openapi_path", "", `file path to the OpenAPI 2.0 document of the endpoint service in JSON, instead of deploying it to Service Management.
+					It is converted into the service config the same way Service Management does, without the Service Control environment,
+					so the calls are not checked or reported, and the operations requiring API keys are rejected.
+					The same flags as --service_json_path are ignored.`)
+	rolloutTrafficPolicy = flag.String("rollout_traffic_policy", "highest", `how the managed rollout selects among the service configs of the latest rollout, must be either "highest" or "percentage".
+					"highest" serves the config with the highest traffic percentage on all the instances.
+					"percentage" hashes the hostname of each instance into [0, 100) and serves the configs in proportion to their percentages,
+					the newest config first, so the instances serving a new config keep serving it as its percentage rises.`)
 )
 
 // Config Manager handles service configuration fetching and updating.
@@ -66,8 +81,76 @@ type ConfigManager struct {
 	metadataFetcher         *metadata.MetadataFetcher
 	serviceConfigFetcher    *sc.ServiceConfigFetcher
 	rolloutIdChangeDetector *sc.RolloutIdChangeDetector
+	// rolloutMutex serializes applying the latest rollout, as both the rollout
+	// checks and the rollout notifications do it.
+	rolloutMutex sync.Mutex
+	// The retry of applying the latest rollout after a failure, guarded by
+	// rolloutMutex.
+	rolloutRetryBackOff *backoff.ExponentialBackOff
+	rolloutRetryTimer   *time.Timer
 
 	curServiceConfig *confpb.Service
+	// The rollout id of the managed rollout strategy, set when the rollout is
+	// detected.
+	curRolloutId string
+	// The fetched service config persisted to --service_config_cache_path
+	// once Envoy ACKs it.
+	unconfirmedServiceConfig *confpb.Service
+
+	// The previously served config, kept warm so that Revert can swap back to
+	// it without fetching from Service Management.
+	standby *servedConfig
+
+	// The downstream certificate delivered via SDS, only set when
+	// --ssl_server_cert_sds is enabled.
+	serverCertSecret  *tlspb.Secret
+	serverCertVersion int
+
+	// The maintenance mode set via the admin interface, nil until set, and
+	// bumped each time it is changed. The service configs are built with it
+	// outside of mutex, so it is written with both maintenanceMutex and mutex
+	// held, and read with either held.
+	maintenanceMutex   sync.Mutex
+	maintenance        *maintenanceState
+	maintenanceVersion int
+
+	// Bumped each time a daily window of the feature gates opens or closes.
+	featureGateVersion int
+	featureGateTimer   *time.Timer
+
+	// The header values of the backend credentials by their ids, and bumped
+	// each time one of them is refreshed.
+	backendCredentialValues  map[string]string
+	backendCredentialVersion int
+	backendCredentialTimers  map[string]*time.Timer
+
+	// The canary analysis of the managed rollout, guarded by canaryMutex
+	// except canaryStatus.
+	canaryMutex       sync.Mutex
+	instance          string
+	errorStatsFetcher func() (errorStats, error)
+	adoptedStats      errorStats
+	canary            *canary
+	canaryStatus      *canaryStatus
+	rejectedConfigId  string
+
+	// Fetches the secrets of the flags with sm:// uris, only set when any.
+	secretFetcher *secretmanager.SecretFetcher
+	// The Secret Manager secrets referenced by --ssl_server_cert_path and
+	// --service_account_key, only set when they are sm:// uris.
+	serverCertSource        *secretmanager.Secret
+	serviceAccountKeySecret *secretmanager.Secret
+	// Closed by Close to stop checking the certificate files, guarded by
+	// mutex.
+	serverCertWatchDone chan struct{}
+
+	// The versions of the snapshots sent to and ACKed by the connected Envoys.
+	adoption *adoptionTracker
+
+	// mutex guards the snapshot updates from config rollouts and certificate rotations.
+	mutex sync.Mutex
+	// Set by Close, guarded by mutex.
+	closed bool
 }
 
 // NewConfigManager creates new instance of Config Manager.
@@ -76,27 +159,61 @@ func NewConfigManager(mf *metadata.MetadataFetcher, opts options.ConfigGenerator
 	m := &ConfigManager{
 		metadataFetcher:    mf,
 		envoyConfigOptions: opts,
+		adoption:           newAdoptionTracker(),
 	}
 	m.cache = cache.NewSnapshotCache(true, m, m)
 
+	if opts.BackendHttpProtocol == util.AutoBackendHttpProtocol {
+		m.envoyConfigOptions.BackendHttpProtocol = probeBackendProtocol(opts)
+	}
+
+	if err := m.initSecrets(mf); err != nil {
+		return nil, err
+	}
+	if err := m.initBackendCredentials(time.Now()); err != nil {
+		return nil, err
+	}
+
+	if opts.SslServerCertSds {
+		if opts.SslServerCertPath == "" {
+			return nil, fmt.Errorf("flag --ssl_server_cert_sds requires flag --ssl_server_cert_path")
+		}
+		if _, err := m.reloadServerCert(); err != nil {
+			return nil, err
+		}
+		// Certificates from Secret Manager are reloaded when the secret is refreshed.
+		if m.serverCertSource == nil {
+			m.watchServerCert(opts.SslServerCertCheckInterval)
+		}
+	}
+
 	// If service config is provided as a file, just use it and disable managed rollout
-	if *ServicePath != "" {
+	if *ServicePath != "" || *OpenAPIPath != "" {
+		staticFlag, staticPath, readAndApply := "service_json_path", *ServicePath, m.readAndApplyServiceConfig
+		if *OpenAPIPath != "" {
+			if *ServicePath != "" {
+				return nil, fmt.Errorf("flags --service_json_path and --openapi_path cannot be both set")
+			}
+			staticFlag, staticPath, readAndApply = "openapi_path", *OpenAPIPath, m.readAndApplyOpenAPI
+		}
+
 		// Following flags will not be used
 		if *ServiceName != "" {
-			glog.Infof("flag --service is ignored when --service_json_path is specified.")
+			glog.Infof("flag --service is ignored when --%s is specified.", staticFlag)
 		}
 		if *ServiceConfigId != "" {
-			glog.Infof("flag --service_config_id is ignored when --service_json_path is specified.")
+			glog.Infof("flag --service_config_id is ignored when --%s is specified.", staticFlag)
 		}
 		if *RolloutStrategy != "fixed" {
-			glog.Infof("flag --rollout_strategy will be fixed when --service_json_path is specified.")
+			glog.Infof("flag --rollout_strategy will be fixed when --%s is specified.", staticFlag)
 		}
 
-		if err := m.readAndApplyServiceConfig(*ServicePath); err != nil {
+		if err := readAndApply(staticPath); err != nil {
 			return nil, err
 		}
 
-		glog.Infof("create new Config Manager from static service config json file at %v", *ServicePath)
+		glog.Infof("create new Config Manager from static file --%s at %v", staticFlag, staticPath)
+		m.startWatchdog()
 		return m, nil
 	}
 
@@ -136,7 +253,7 @@ func NewConfigManager(mf *metadata.MetadataFetcher, opts options.ConfigGenerator
 
 	accessToken := func() (string, time.Duration, error) {
 		if opts.ServiceAccountKey != "" {
-			return tokengenerator.GenerateAccessTokenFromFile(opts.ServiceAccountKey)
+			return m.serviceAccountKeyToken()
 		}
 		return mf.FetchAccessToken()
 	}
@@ -148,6 +265,15 @@ func NewConfigManager(mf *metadata.MetadataFetcher, opts options.ConfigGenerator
 
 	m.serviceConfigFetcher = sc.NewServiceConfigFetcher(client, opts.ServiceManagementURL,
 		m.serviceName, accessToken)
+	if opts.ServiceManagementFailoverURLs != "" {
+		m.serviceConfigFetcher.SetFailoverUrls(strings.Split(opts.ServiceManagementFailoverURLs, ","))
+	}
+
+	if rolloutStrategy == util.ManagedRolloutStrategy {
+		if err := m.initTrafficSplit(); err != nil {
+			return nil, err
+		}
+	}
 
 	configId := ""
 	if rolloutStrategy == util.FixedRolloutStrategy {
@@ -166,40 +292,125 @@ func NewConfigManager(mf *metadata.MetadataFetcher, opts options.ConfigGenerator
 				return nil, fmt.Errorf("failed to read metadata with key endpoints-service-version from metadata server: %v", err)
 			}
 		}
-	} else if rolloutStrategy == util.ManagedRolloutStrategy {
-		configId, err = m.serviceConfigFetcher.LoadConfigIdFromRollouts()
+	}
+
+	// Only the fetches are retried, a service config failing to apply is not.
+	var applyErr error
+	err = retryStartupFetch(func() error {
+		latestConfigId := configId
+		if rolloutStrategy == util.ManagedRolloutStrategy {
+			var err error
+			if latestConfigId, err = m.serviceConfigFetcher.LoadConfigIdFromRollouts(); err != nil {
+				return err
+			}
+		}
+		serviceConfig, err := m.serviceConfigFetcher.FetchConfig(latestConfigId)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if applyErr = m.applyFetchedServiceConfig(serviceConfig); applyErr != nil {
+			return backoff.Permanent(applyErr)
 		}
+		return nil
+	})
+	if applyErr != nil {
+		// The cached service config only stands in for the unreachable
+		// Service Management, not for a broken service config.
+		return nil, fmt.Errorf("fail to apply the startup service config, %v", applyErr)
 	}
-
-	if err = m.fetchAndApplyServiceConfig(configId); err != nil {
-		return nil, fmt.Errorf("fail to fetch and apply the startup service config, %v", err)
+	if err != nil {
+		// Serve the last-known-good service config if Service Management is
+		// not reachable, the managed rollout catches up once it is. Any
+		// cached config of the managed rollout is served.
+		if cacheErr := m.applyCachedServiceConfig(configId); cacheErr != nil {
+			glog.Infof("the cached service config is not served, %v", cacheErr)
+			return nil, fmt.Errorf("fail to fetch and apply the startup service config, %v", err)
+		}
+		glog.Warningf("fail to fetch the startup service config, serving the cached service config (%v) instead, %v", m.servedConfigId(), err)
 	}
 
 	if rolloutStrategy == util.ManagedRolloutStrategy {
+		if err := m.initCanary(client); err != nil {
+			return nil, err
+		}
 		m.rolloutIdChangeDetector = sc.NewRolloutIdChangeDetector(client, opts.ServiceControlURL, m.serviceName, accessToken)
+		if opts.ServiceControlFailoverURLs != "" {
+			m.rolloutIdChangeDetector.SetFailoverUrls(strings.Split(opts.ServiceControlFailoverURLs, ","))
+		}
 		m.rolloutIdChangeDetector.SetDetectRolloutIdChangeTimer(*checkNewRolloutInterval, func() {
-			latestConfigId, err := m.serviceConfigFetcher.LoadConfigIdFromRollouts()
-			if err != nil {
-				glog.Errorf("error occurred when getting configId by fetching rollout, %v", err)
-				return
-			}
-
-			if err = m.fetchAndApplyServiceConfig(latestConfigId); err != nil {
-				glog.Errorf("error occurred when fetching and applying new service config, %v", err)
-			}
+			rolloutId := m.rolloutIdChangeDetector.RolloutId()
+			jsonlog.SetField(logFieldRolloutId, rolloutId)
+			m.mutex.Lock()
+			m.curRolloutId = rolloutId
+			m.mutex.Unlock()
+			m.applyLatestRollout()
 		})
+		if err := m.startRolloutNotifier(client, accessToken); err != nil {
+			return nil, err
+		}
 	}
 
 	glog.Infof("create new Config Manager for service (%v) with configuration id (%v), %v rollout strategy",
-		m.serviceName, m.curConfigId(), rolloutStrategy)
+		m.serviceName, m.servedConfigId(), rolloutStrategy)
+	m.startWatchdog()
 	return m, nil
 }
 
+// applyLatestRollout fetches the rollouts and applies the service config of
+// the latest one.
+func (m *ConfigManager) applyLatestRollout() {
+	m.rolloutMutex.Lock()
+	defer m.rolloutMutex.Unlock()
+
+	if m.rolloutRetryTimer != nil {
+		m.rolloutRetryTimer.Stop()
+		m.rolloutRetryTimer = nil
+	}
+
+	latestConfigId, rolloutId, err := m.serviceConfigFetcher.LoadLatestRollout()
+	if err != nil {
+		glog.Errorf("error occurred when getting configId by fetching rollout, retry in %v, %v", m.scheduleRolloutRetry(), err)
+		return
+	}
+
+	if err = m.rolloutServiceConfig(latestConfigId, time.Now()); err != nil {
+		glog.Errorf("error occurred when fetching and applying new service config, retry in %v, %v", m.scheduleRolloutRetry(), err)
+		return
+	}
+	m.rolloutRetryBackOff = nil
+
+	// The rollout notifications and retries apply the rollouts without the
+	// rollout id change detector knowing it.
+	if rolloutId != "" {
+		jsonlog.SetField(logFieldRolloutId, rolloutId)
+		m.mutex.Lock()
+		m.curRolloutId = rolloutId
+		m.mutex.Unlock()
+	}
+}
+
+// initTrafficSplit validates flag --rollout_traffic_policy and splits the
+// traffic among the configs of the latest rollout if asked to.
+func (m *ConfigManager) initTrafficSplit() error {
+	switch *rolloutTrafficPolicy {
+	case util.HighestTrafficPolicy:
+		return nil
+	case util.PercentageTrafficPolicy:
+	default:
+		return fmt.Errorf(`flag --rollout_traffic_policy must be either "highest" or "percentage", got %q`, *rolloutTrafficPolicy)
+	}
+
+	instance, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("fail to get the hostname to split the rollout traffic, %v", err)
+	}
+	m.serviceConfigFetcher.SetTrafficSplitInstance(instance)
+	return nil
+}
+
 func (m *ConfigManager) fetchAndApplyServiceConfig(latestConfigId string) error {
-	if latestConfigId == m.curConfigId() {
-		glog.Infof("no new configuration to load for service %v, current configuration Id %v", m.serviceName, m.curConfigId())
+	if curConfigId := m.servedConfigId(); latestConfigId == curConfigId {
+		glog.Infof("no new configuration to load for service %v, current configuration Id %v", m.serviceName, curConfigId)
 		return nil
 	}
 
@@ -207,8 +418,17 @@ func (m *ConfigManager) fetchAndApplyServiceConfig(latestConfigId string) error
 	if err != nil {
 		return err
 	}
+	return m.applyFetchedServiceConfig(serviceConfig)
+}
 
-	return m.applyServiceConfig(serviceConfig)
+// applyFetchedServiceConfig applies the service config fetched from Service
+// Management, and persists it once Envoy ACKs it.
+func (m *ConfigManager) applyFetchedServiceConfig(serviceConfig *confpb.Service) error {
+	if err := m.applyServiceConfig(serviceConfig); err != nil {
+		return err
+	}
+	m.saveServiceConfigOnAck(serviceConfig)
+	return nil
 }
 
 func (m *ConfigManager) readAndApplyServiceConfig(servicePath string) error {
@@ -226,39 +446,98 @@ func (m *ConfigManager) readAndApplyServiceConfig(servicePath string) error {
 	return m.applyServiceConfig(serviceConfig)
 }
 
-func (m *ConfigManager) applyServiceConfig(serviceConfig *confpb.Service) error {
-	if serviceConfig == nil {
-		return fmt.Errorf("applid service config is empty")
+func (m *ConfigManager) readAndApplyOpenAPI(openAPIPath string) error {
+	openAPI, err := ioutil.ReadFile(openAPIPath)
+	if err != nil {
+		return fmt.Errorf("fail to read OpenAPI document file: %s, error: %s", openAPIPath, err)
 	}
 
-	var err error
-	m.curServiceConfig = serviceConfig
-	m.serviceInfo, err = configinfo.NewServiceInfoFromServiceConfig(serviceConfig, serviceConfig.Id, m.envoyConfigOptions)
+	serviceConfig, err := configinfo.ServiceConfigFromOpenAPI(openAPI)
 	if err != nil {
-		return fmt.Errorf("fail to initialize ServiceInfo, %s", err)
+		return fmt.Errorf("fail to convert OpenAPI document: %s, error: %v", openAPIPath, err)
+	}
+	// The API keys are checked by Service Control, which the converted
+	// service config has no environment of.
+	for _, rule := range serviceConfig.GetUsage().GetRules() {
+		if !rule.GetAllowUnregisteredCalls() {
+			return fmt.Errorf("fail to convert OpenAPI document: %s, operation %s requires an API key, which is not checked without Service Control", openAPIPath, rule.GetSelector())
+		}
+	}
+
+	m.serviceName = serviceConfig.GetName()
+	return m.applyServiceConfig(serviceConfig)
+}
+
+func (m *ConfigManager) applyServiceConfig(serviceConfig *confpb.Service) error {
+	if serviceConfig == nil {
+		return fmt.Errorf("applid service config is empty")
 	}
 
+	var gcpAttributes *scpb.GcpAttributes
 	if m.metadataFetcher != nil {
 		attrs, err := m.metadataFetcher.FetchGCPAttributes()
 		if err != nil {
 			m.Infof("metadata server was not reached, skipping GCP Attributes: %v", err)
 		} else {
-			m.serviceInfo.GcpAttributes = attrs
+			gcpAttributes = attrs
 		}
 	}
 
-	snapshot, err := m.makeSnapshot()
+	for {
+		// The config is built aside, and only becomes the current one once it
+		// is served to Envoy. It is built before taking the mutex, as it may
+		// fetch the jwks_uri of the providers.
+		opts, maintenanceVersion := m.configOptions()
+		serviceInfo, err := configinfo.NewServiceInfoFromServiceConfig(serviceConfig, serviceConfig.Id, opts)
+		if err != nil {
+			return fmt.Errorf("fail to initialize ServiceInfo, %s", err)
+		}
+		serviceInfo.GcpAttributes = gcpAttributes
+
+		applied, err := m.commitServiceConfig(serviceConfig, serviceInfo, maintenanceVersion)
+		if err != nil || applied {
+			return err
+		}
+		// The maintenance mode is changed meanwhile, build the config again
+		// with it.
+	}
+}
+
+// commitServiceConfig serves the ServiceInfo built for the service config. It
+// returns false if the maintenance mode it is built with has changed.
+func (m *ConfigManager) commitServiceConfig(serviceConfig *confpb.Service, serviceInfo *configinfo.ServiceInfo, maintenanceVersion int) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.maintenanceVersion != maintenanceVersion {
+		return false, nil
+	}
+
+	prev := m.servedConfig()
+	snapshot, err := m.makeSnapshot(serviceConfig.Id, serviceInfo)
 	if err != nil {
-		return fmt.Errorf("fail to make a snapshot, %s", err)
+		return false, fmt.Errorf("fail to make a snapshot, %s", err)
+	}
+	if err := m.cache.SetSnapshot(context.Background(), m.envoyConfigOptions.Node, *snapshot); err != nil {
+		return false, err
+	}
+	if prev != nil {
+		m.standby = prev
 	}
-	return m.cache.SetSnapshot(context.Background(), m.envoyConfigOptions.Node, *snapshot)
+	m.curServiceConfig = serviceConfig
+	m.serviceInfo = serviceInfo
+	setServiceConfigLogFields(serviceConfig.GetName(), serviceConfig.GetId())
+	return true, nil
 }
 
-func (m *ConfigManager) makeSnapshot() (*cache.Snapshot, error) {
-	m.Infof("making configuration for api: %v", m.serviceInfo.Name)
+// makeSnapshot makes the snapshot of the service config of configId, it must
+// be called with the mutex held.
+func (m *ConfigManager) makeSnapshot(configId string, serviceInfo *configinfo.ServiceInfo) (*cache.Snapshot, error) {
+	m.Infof("making configuration for api: %v", serviceInfo.Name)
+	serviceInfo.BackendCredentialValues = m.backendCredentialValues
 
 	var clusterResources, listenerResources []types.Resource
-	clusters, err := gen.MakeClusters(m.serviceInfo)
+	clusters, err := gen.MakeClusters(serviceInfo)
 	if err != nil {
 		return nil, err
 	}
@@ -266,8 +545,8 @@ func (m *ConfigManager) makeSnapshot() (*cache.Snapshot, error) {
 		clusterResources = append(clusterResources, clusters[i])
 	}
 
-	m.Infof("adding Listeners configuration for api: %v", m.serviceInfo.Name)
-	listeners, err := gen.MakeListeners(m.serviceInfo)
+	m.Infof("adding Listeners configuration for api: %v", serviceInfo.Name)
+	listeners, err := gen.MakeListeners(serviceInfo)
 	if err != nil {
 		return nil, err
 	}
@@ -275,17 +554,82 @@ func (m *ConfigManager) makeSnapshot() (*cache.Snapshot, error) {
 		listenerResources = append(listenerResources, lis)
 	}
 
-	snapshot, err := cache.NewSnapshot(m.curConfigId(), map[rsrc.Type][]types.Resource{
+	if m.envoyConfigOptions.DumpGeneratedConfigDir != "" {
+		// Failing to dump should not block serving the config.
+		redactedListeners, err := redactListeners(listeners, m.backendCredentialValues)
+		if err == nil {
+			err = dumpGeneratedConfig(m.envoyConfigOptions.DumpGeneratedConfigDir, configId, clusters, redactedListeners)
+		}
+		if err != nil {
+			m.Errorf("fail to dump the generated config: %v", err)
+		} else {
+			m.Infof("generated config is dumped into %s", m.envoyConfigOptions.DumpGeneratedConfigDir)
+		}
+	}
+
+	resources := map[rsrc.Type][]types.Resource{
 		rsrc.ListenerType: listenerResources,
 		rsrc.ClusterType:  clusterResources,
-	})
+	}
+	if m.serverCertSecret != nil {
+		resources[rsrc.SecretType] = []types.Resource{m.serverCertSecret}
+	}
+
+	snapshot, err := cache.NewSnapshot(configId, resources)
 	if err != nil {
 		return nil, err
 	}
+	if m.serverCertSecret != nil {
+		// Secrets are versioned independently, so a rotated certificate is
+		// pushed to Envoy even if the service config is unchanged.
+		snapshot.Resources[types.Secret].Version = fmt.Sprintf("%s-cert%d", configId, m.serverCertVersion)
+	}
+	listenerVersion := configId
+	if m.maintenanceVersion > 0 {
+		// The maintenance mode changes the routes of the same service config.
+		listenerVersion += fmt.Sprintf("-maintenance%d", m.maintenanceVersion)
+	}
+	if m.featureGateVersion > 0 {
+		// So do the daily windows of the feature gates.
+		listenerVersion += fmt.Sprintf("-gates%d", m.featureGateVersion)
+	}
+	if m.backendCredentialVersion > 0 {
+		// And the refreshed backend credentials.
+		listenerVersion += fmt.Sprintf("-credentials%d", m.backendCredentialVersion)
+	}
+	snapshot.Resources[types.Listener].Version = listenerVersion
+	m.scheduleFeatureGateUpdate(serviceInfo, time.Now())
 	m.Infof("Envoy Dynamic Configuration is cached for service: %v", m.serviceName)
 	return &snapshot, nil
 }
 
+// Close stops refreshing the configs served to Envoy in the background.
+func (m *ConfigManager) Close() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.closed = true
+	m.stopBackendCredentialRefreshes()
+	if m.serverCertWatchDone != nil {
+		close(m.serverCertWatchDone)
+		m.serverCertWatchDone = nil
+	}
+	for _, secret := range []*secretmanager.Secret{m.serverCertSource, m.serviceAccountKeySecret} {
+		if secret != nil {
+			secret.StopRefreshTimer()
+		}
+	}
+}
+
+// servedConfigId returns the id of the service config served to Envoy.
+func (m *ConfigManager) servedConfigId() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.curConfigId()
+}
+
+// curConfigId must be called with the mutex held.
 func (m *ConfigManager) curConfigId() string {
 	if m.curServiceConfig == nil {
 		return ""
@@ -318,6 +662,28 @@ func (m *ConfigManager) Errorf(format string, args ...interface{}) { glog.Errorf
 // Cache returns snapshot cache.
 func (m *ConfigManager) Cache() cache.Cache { return m.cache }
 
+// probeBackendProtocol detects the http protocol of the local backend, it
+// falls back to the default protocol if the backend cannot be reached.
+func probeBackendProtocol(opts options.ConfigGeneratorOptions) string {
+	scheme, hostname, port, _, err := util.ParseURI(opts.BackendAddress)
+	if err != nil {
+		glog.Warningf("fail to parse backend address to probe the backend protocol: %v", err)
+		return ""
+	}
+	protocol, tls, err := util.ParseBackendProtocol(scheme, "")
+	if err != nil || protocol == util.GRPC {
+		return ""
+	}
+
+	httpProtocol, err := util.ProbeBackendHttpProtocol(hostname, port, tls, opts.ClusterConnectTimeout)
+	if err != nil {
+		glog.Warningf("fail to probe the backend protocol, use the default protocol: %v", err)
+		return ""
+	}
+	glog.Infof("probed backend %s protocol: %s", opts.BackendAddress, httpProtocol)
+	return httpProtocol
+}
+
 func httpsClient(opts options.ConfigGeneratorOptions) (*http.Client, error) {
 	caCert, err := ioutil.ReadFile(opts.SslSidestreamClientRootCertsPath)
 	if err != nil {
@@ -327,6 +693,7 @@ func httpsClient(opts options.ConfigGeneratorOptions) (*http.Client, error) {
 	caCertPool.AppendCertsFromPEM(caCert)
 	return &http.Client{
 		Transport: &http.Transport{
+			Proxy: util.ProxyFunc(opts.GoogleApiProxy),
 			TLSClientConfig: &tls.Config{
 				RootCAs: caCertPool,
 			},
@@ -17,8 +17,10 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
@@ -398,6 +400,103 @@ func TestFixedModeDynamicRouting(t *testing.T) {
 	}
 }
 
+func TestOpenAPIPath(t *testing.T) {
+	openAPI := `{
+  "swagger": "2.0",
+  "info": {"title": "Bookstore", "version": "1.0.0"},
+  "host": "bookstore.example.com",
+  "paths": {
+    "/shelves": {
+      "get": {
+        "operationId": "listShelves",
+        "x-google-backend": {"address": "https://shelves.example.com/list"}
+      }
+    }
+  }
+}`
+
+	testData := []struct {
+		desc            string
+		serviceJsonPath string
+		openAPI         string
+		wantCluster     string
+		wantError       string
+	}{
+		{
+			desc:        "Success, serve the service config converted from the OpenAPI document",
+			openAPI:     openAPI,
+			wantCluster: "backend-cluster-shelves.example.com:443",
+		},
+		{
+			desc:      "Fail, invalid OpenAPI document",
+			openAPI:   `{"swagger": "2.0", "paths": {}}`,
+			wantError: "host of the OpenAPI document is empty",
+		},
+		{
+			desc:      "Fail, API key without Service Control",
+			openAPI:   `{"swagger": "2.0", "host": "bookstore.example.com", "securityDefinitions": {"api_key": {"type": "apiKey", "name": "key", "in": "query"}}, "security": [{"api_key": []}], "paths": {"/shelves": {"get": {"operationId": "listShelves"}}}}`,
+			wantError: "operation 1.bookstore_example_com.ListShelves requires an API key, which is not checked without Service Control",
+		},
+		{
+			desc:            "Fail, both service config and OpenAPI document",
+			serviceJsonPath: platform.GetFilePath(platform.FixedDrServiceConfig),
+			openAPI:         openAPI,
+			wantError:       "flags --service_json_path and --openapi_path cannot be both set",
+		},
+	}
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			openAPIPath := filepath.Join(t.TempDir(), "openapi.json")
+			if err := ioutil.WriteFile(openAPIPath, []byte(tc.openAPI), 0644); err != nil {
+				t.Fatal(err)
+			}
+			setFlag(t, "service_json_path", tc.serviceJsonPath)
+			setFlag(t, "openapi_path", openAPIPath)
+
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.DisableTracing = true
+			manager, err := NewConfigManager(nil, opts)
+			if tc.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+					t.Fatalf("NewConfigManager got error %v, want %q", err, tc.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if manager.serviceName != "bookstore.example.com" {
+				t.Errorf("got service name %q, want %q", manager.serviceName, "bookstore.example.com")
+			}
+			resp, err := manager.cache.Fetch(context.Background(), &discoverypb.DiscoveryRequest{
+				Node: &corepb.Node{
+					Id: opts.Node,
+				},
+				TypeUrl: resource.ClusterType,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			discoveryResp, err := resp.GetDiscoveryResponse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var clusters []string
+			for _, cluster := range discoveryResp.Resources {
+				clusters = append(clusters, getClusterName(cluster))
+			}
+			found := false
+			for _, cluster := range clusters {
+				found = found || cluster == tc.wantCluster
+			}
+			if !found {
+				t.Errorf("got clusters %v, want cluster %s", clusters, tc.wantCluster)
+			}
+		})
+	}
+}
+
 func TestServiceConfigAutoUpdate(t *testing.T) {
 	var fakeConfig, fakeScReport, fakeRollouts safeData
 
@@ -587,7 +686,7 @@ func TestServiceConfigAutoUpdate(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		if version != newConfigID || configManager.curConfigId() != newConfigID {
+		if version != newConfigID || configManager.servedConfigId() != newConfigID {
 			t.Errorf("Test Desc: %s, snapshot cache fetch got version: %v, want: %v", tc.desc, version, newConfigID)
 		}
 
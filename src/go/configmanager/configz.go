@@ -0,0 +1,123 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+
+	clusterpb "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	listenerpb "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+)
+
+// configz is the snapshot currently served to Envoy. The secrets are left out
+// as they hold the private keys, and the backend credentials are redacted.
+type configz struct {
+	ServiceName     string `json:"service_name"`
+	ServiceConfigId string `json:"service_config_id"`
+	// Only set for the managed rollout strategy, once the rollout is detected.
+	RolloutId string `json:"rollout_id,omitempty"`
+	// The snapshot versions by the resource type url.
+	Versions  map[string]string `json:"versions"`
+	Listeners []json.RawMessage `json:"listeners"`
+	Clusters  []json.RawMessage `json:"clusters"`
+	// The http filters by the listener name.
+	HttpFilters map[string][]json.RawMessage `json:"http_filters"`
+}
+
+func (m *ConfigManager) configzJson() ([]byte, error) {
+	m.mutex.Lock()
+	z := &configz{
+		ServiceName:     m.serviceName,
+		ServiceConfigId: m.curConfigId(),
+		RolloutId:       m.curRolloutId,
+		Versions:        make(map[string]string),
+		Listeners:       []json.RawMessage{},
+		Clusters:        []json.RawMessage{},
+		HttpFilters:     make(map[string][]json.RawMessage),
+	}
+	credentialValues := copyBackendCredentialValues(m.backendCredentialValues)
+	m.mutex.Unlock()
+
+	snapshot, err := m.cache.GetSnapshot(m.envoyConfigOptions.Node)
+	if err != nil {
+		return nil, fmt.Errorf("no snapshot is served yet")
+	}
+	for _, typeUrl := range []string{rsrc.ListenerType, rsrc.ClusterType} {
+		z.Versions[typeUrl] = snapshot.GetVersion(typeUrl)
+	}
+
+	marshaler := &jsonpb.Marshaler{}
+	marshal := func(msg proto.Message) (json.RawMessage, error) {
+		msgJson, err := marshaler.MarshalToString(msg)
+		if err != nil {
+			return nil, fmt.Errorf("fail to marshal %T: %v", msg, err)
+		}
+		return json.RawMessage(msgJson), nil
+	}
+
+	listeners := snapshot.GetResources(rsrc.ListenerType)
+	for _, name := range sortedResourceNames(listeners) {
+		redacted, err := redactListeners([]*listenerpb.Listener{listeners[name].(*listenerpb.Listener)}, credentialValues)
+		if err != nil {
+			return nil, err
+		}
+		listener := redacted[0]
+		listenerJson, err := marshal(listener)
+		if err != nil {
+			return nil, err
+		}
+		z.Listeners = append(z.Listeners, listenerJson)
+
+		httpFilters, err := listenerHttpFilters(listener)
+		if err != nil {
+			return nil, err
+		}
+		z.HttpFilters[name] = []json.RawMessage{}
+		for _, httpFilter := range httpFilters {
+			httpFilterJson, err := marshal(httpFilter)
+			if err != nil {
+				return nil, err
+			}
+			z.HttpFilters[name] = append(z.HttpFilters[name], httpFilterJson)
+		}
+	}
+
+	clusters := snapshot.GetResources(rsrc.ClusterType)
+	for _, name := range sortedResourceNames(clusters) {
+		clusterJson, err := marshal(clusters[name].(*clusterpb.Cluster))
+		if err != nil {
+			return nil, err
+		}
+		z.Clusters = append(z.Clusters, clusterJson)
+	}
+
+	return json.MarshalIndent(z, "", "  ")
+}
+
+func sortedResourceNames(resources map[string]types.Resource) []string {
+	var names []string
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,220 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	gen "github.com/GoogleCloudPlatform/esp-v2/src/go/configgenerator"
+	scpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/v10/http/service_control"
+	clusterpb "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	listenerpb "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+)
+
+// DryRunReport is how the config served to Envoy would change if the next
+// service config was applied.
+type DryRunReport struct {
+	CurrentConfigId string `json:"current_config_id"`
+	NextConfigId    string `json:"next_config_id"`
+	// The Envoys which have not ACKed the served config yet, the diff is
+	// against the config they still run.
+	NotAckedBy  []string        `json:"not_acked_by,omitempty"`
+	Clusters    []*ResourceDiff `json:"clusters"`
+	Listeners   []*ResourceDiff `json:"listeners"`
+	HttpFilters []*ResourceDiff `json:"http_filters"`
+	Routes      []*ResourceDiff `json:"routes"`
+}
+
+// ResourceDiff is the change of a generated resource.
+type ResourceDiff struct {
+	Name string `json:"name"`
+	// One of "added", "removed" and "changed".
+	Change string `json:"change"`
+	Diff   string `json:"diff,omitempty"`
+}
+
+// DryRun generates the config of the service config and diffs it against the
+// served config without publishing it. The latest rollout is used if the
+// config id is empty.
+func (m *ConfigManager) DryRun(configId string) (*DryRunReport, error) {
+	if m.serviceConfigFetcher == nil {
+		return nil, fmt.Errorf("dry run requires the service config to be fetched from service management")
+	}
+	if configId == "" {
+		var err error
+		if configId, err = m.serviceConfigFetcher.LoadConfigIdFromRollouts(); err != nil {
+			return nil, err
+		}
+	}
+	serviceConfig, err := m.serviceConfigFetcher.FetchConfig(configId)
+	if err != nil {
+		return nil, err
+	}
+	return m.dryRun(serviceConfig)
+}
+
+func (m *ConfigManager) dryRun(serviceConfig *confpb.Service) (*DryRunReport, error) {
+	opts, _ := m.configOptions()
+	m.mutex.Lock()
+	currentConfigId := m.curConfigId()
+	var gcpAttributes *scpb.GcpAttributes
+	if m.serviceInfo != nil {
+		gcpAttributes = m.serviceInfo.GcpAttributes
+	}
+	credentialValues := copyBackendCredentialValues(m.backendCredentialValues)
+	m.mutex.Unlock()
+
+	snapshot, err := m.cache.GetSnapshot(opts.Node)
+	if err != nil {
+		return nil, fmt.Errorf("no snapshot is served yet")
+	}
+
+	serviceInfo, err := configinfo.NewServiceInfoFromServiceConfig(serviceConfig, serviceConfig.Id, opts)
+	if err != nil {
+		return nil, fmt.Errorf("fail to initialize ServiceInfo, %s", err)
+	}
+	serviceInfo.GcpAttributes = gcpAttributes
+	// The credentials are redacted on both sides of the diff, so they are
+	// not shown and the unchanged routes are not in the diff.
+	redactBackendCredentials(serviceInfo)
+	nextClusters, err := gen.MakeClusters(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	nextListeners, err := gen.MakeListeners(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	var curClusters []*clusterpb.Cluster
+	for _, r := range snapshot.GetResources(rsrc.ClusterType) {
+		curClusters = append(curClusters, r.(*clusterpb.Cluster))
+	}
+	var curListeners []*listenerpb.Listener
+	for _, r := range snapshot.GetResources(rsrc.ListenerType) {
+		curListeners = append(curListeners, r.(*listenerpb.Listener))
+	}
+	curListeners, err = redactListeners(curListeners, credentialValues)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DryRunReport{
+		CurrentConfigId: currentConfigId,
+		NextConfigId:    serviceConfig.Id,
+	}
+	for _, adoption := range m.adoptions(time.Now()) {
+		if adoption.TypeUrl == rsrc.ListenerType && adoption.AckedVersion != adoption.PublishedVersion {
+			report.NotAckedBy = append(report.NotAckedBy, adoption.Node)
+		}
+	}
+
+	report.Clusters = diffResources(clusterMessages(curClusters), clusterMessages(nextClusters))
+	report.Listeners = diffResources(listenerMessages(curListeners), listenerMessages(nextListeners))
+
+	curFilters, curRoutes, err := listenerFiltersAndRoutes(curListeners)
+	if err != nil {
+		return nil, err
+	}
+	nextFilters, nextRoutes, err := listenerFiltersAndRoutes(nextListeners)
+	if err != nil {
+		return nil, err
+	}
+	report.HttpFilters = diffResources(curFilters, nextFilters)
+	report.Routes = diffResources(curRoutes, nextRoutes)
+	return report, nil
+}
+
+func clusterMessages(clusters []*clusterpb.Cluster) map[string]proto.Message {
+	msgs := make(map[string]proto.Message)
+	for _, c := range clusters {
+		msgs[c.GetName()] = c
+	}
+	return msgs
+}
+
+func listenerMessages(listeners []*listenerpb.Listener) map[string]proto.Message {
+	msgs := make(map[string]proto.Message)
+	for _, l := range listeners {
+		msgs[l.GetName()] = l
+	}
+	return msgs
+}
+
+// listenerFiltersAndRoutes returns the http filters by "LISTENER/FILTER" and
+// the routes by "LISTENER/VIRTUAL_HOST/MATCH" of the listeners, so the diff
+// tells which filter or route a change is in.
+func listenerFiltersAndRoutes(listeners []*listenerpb.Listener) (map[string]proto.Message, map[string]proto.Message, error) {
+	filters := make(map[string]proto.Message)
+	routes := make(map[string]proto.Message)
+	marshaler := &jsonpb.Marshaler{}
+	for _, listener := range listeners {
+		hcms, err := listenerHttpConnectionManagers(listener)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, hcm := range hcms {
+			for _, httpFilter := range hcm.GetHttpFilters() {
+				filters[listener.GetName()+"/"+httpFilter.GetName()] = httpFilter
+			}
+			for _, vh := range hcm.GetRouteConfig().GetVirtualHosts() {
+				for _, route := range vh.GetRoutes() {
+					match, err := marshaler.MarshalToString(route.GetMatch())
+					if err != nil {
+						return nil, nil, err
+					}
+					routes[listener.GetName()+"/"+vh.GetName()+"/"+match] = route
+				}
+			}
+		}
+	}
+	return filters, routes, nil
+}
+
+// diffResources diffs the resources by name, sorted by name.
+func diffResources(cur, next map[string]proto.Message) []*ResourceDiff {
+	diffs := []*ResourceDiff{}
+	for name, curMsg := range cur {
+		nextMsg, ok := next[name]
+		if !ok {
+			diffs = append(diffs, &ResourceDiff{Name: name, Change: "removed"})
+			continue
+		}
+		if !proto.Equal(curMsg, nextMsg) {
+			diffs = append(diffs, &ResourceDiff{
+				Name:   name,
+				Change: "changed",
+				Diff:   cmp.Diff(curMsg, nextMsg, protocmp.Transform()),
+			})
+		}
+	}
+	for name := range next {
+		if _, ok := cur[name]; !ok {
+			diffs = append(diffs, &ResourceDiff{Name: name, Change: "added"})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Name < diffs[j].Name })
+	return diffs
+}
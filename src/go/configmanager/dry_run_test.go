@@ -0,0 +1,96 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/proto"
+
+	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestDryRun(t *testing.T) {
+	m := newRevertTestConfigManager()
+	if _, err := m.dryRun(revertTestServiceConfig("2021-01-01r0")); err == nil || err.Error() != "no snapshot is served yet" {
+		t.Errorf("got error: %v, want: no snapshot is served yet", err)
+	}
+
+	current := revertTestServiceConfig("2021-01-01r0")
+	current.Apis[0].Methods = []*apipb.Method{
+		{
+			Name: "ListShelves",
+		},
+	}
+	current.Http = &annotationspb.Http{
+		Rules: []*annotationspb.HttpRule{
+			{
+				Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+				Pattern: &annotationspb.HttpRule_Get{
+					Get: "/v1/shelves",
+				},
+			},
+		},
+	}
+	if err := m.applyServiceConfig(current); err != nil {
+		t.Fatal(err)
+	}
+	servedVersionBefore := servedVersion(t, m)
+
+	next := proto.Clone(current).(*confpb.Service)
+	next.Id = "2021-01-02r0"
+	next.Apis[0].Methods = append(next.Apis[0].Methods, &apipb.Method{
+		Name: "CreateShelf",
+	})
+	next.Http.Rules = append(next.Http.Rules, &annotationspb.HttpRule{
+		Selector: "endpoints.examples.bookstore.Bookstore.CreateShelf",
+		Pattern: &annotationspb.HttpRule_Post{
+			Post: "/v1/shelves",
+		},
+	})
+	report, err := m.dryRun(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.CurrentConfigId != "2021-01-01r0" || report.NextConfigId != "2021-01-02r0" {
+		t.Errorf("got current config id %s and next config id %s, want: 2021-01-01r0 and 2021-01-02r0", report.CurrentConfigId, report.NextConfigId)
+	}
+	if len(report.Clusters) != 0 {
+		t.Errorf("got cluster diffs: %+v, want none", report.Clusters)
+	}
+	if len(report.Listeners) != 1 || report.Listeners[0].Name != util.IngressListenerName || report.Listeners[0].Change != "changed" {
+		t.Errorf("got listener diffs: %+v, want the ingress listener changed", report.Listeners)
+	}
+
+	var addedRoutes []string
+	for _, route := range report.Routes {
+		if route.Change != "added" {
+			t.Errorf("got route diff: %+v, want only added routes", route)
+		}
+		addedRoutes = append(addedRoutes, route.Name)
+	}
+	if len(addedRoutes) == 0 || !strings.Contains(strings.Join(addedRoutes, " "), `"exact":"POST"`) {
+		t.Errorf("got added routes: %v, want the POST /v1/shelves route", addedRoutes)
+	}
+
+	if got := servedVersion(t, m); got != servedVersionBefore {
+		t.Errorf("got served version: %s after dry run, want: %s", got, servedVersionBefore)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"context"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/golang/glog"
+)
+
+// scheduleFeatureGateUpdate regenerates the routes when the next daily window
+// of the feature gates of the service config opens or closes. It must
+// be called with the mutex held.
+func (m *ConfigManager) scheduleFeatureGateUpdate(serviceInfo *configinfo.ServiceInfo, now time.Time) {
+	if m.featureGateTimer != nil {
+		m.featureGateTimer.Stop()
+		m.featureGateTimer = nil
+	}
+
+	var next time.Time
+	for _, method := range serviceInfo.Methods {
+		if method.FeatureGate == nil {
+			continue
+		}
+		if t, ok := method.FeatureGate.NextChange(now); ok && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	if next.IsZero() {
+		return
+	}
+	m.featureGateTimer = time.AfterFunc(next.Sub(now), m.updateFeatureGates)
+}
+
+func (m *ConfigManager) updateFeatureGates() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.featureGateVersion++
+	snapshot, err := m.makeSnapshot(m.curConfigId(), m.serviceInfo)
+	if err == nil {
+		err = m.cache.SetSnapshot(context.Background(), m.envoyConfigOptions.Node, *snapshot)
+	}
+	if err != nil {
+		glog.Errorf("fail to update the feature gates, %v", err)
+		m.scheduleFeatureGateUpdate(m.serviceInfo, time.Now())
+		return
+	}
+	glog.Infof("updated the feature gates of service config %s", m.curConfigId())
+}
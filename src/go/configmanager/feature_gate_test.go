@@ -0,0 +1,85 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+)
+
+func TestUpdateFeatureGates(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		featureGate string
+		wantTimer   bool
+	}{
+		{
+			desc:        "percentage gate never changes",
+			featureGate: `{"percent": 10}`,
+		},
+		{
+			desc:        "daily window gate is updated at the window boundaries",
+			featureGate: `{"windows": ["09:00-17:00"]}`,
+			wantTimer:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			serviceConfig, err := configinfo.ServiceConfigFromOpenAPI([]byte(`{
+  "swagger": "2.0",
+  "info": {"title": "Bookstore", "version": "1.0.0"},
+  "host": "bookstore.endpoints.project123.cloud.goog",
+  "paths": {"/v1/shelves": {"get": {"operationId": "ListShelves", "x-google-feature-gate": ` + tc.featureGate + `}}}
+}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			serviceConfig.Id = "2021-01-01r0"
+
+			m := newRevertTestConfigManager()
+			if err := m.applyServiceConfig(serviceConfig); err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				if m.featureGateTimer != nil {
+					m.featureGateTimer.Stop()
+				}
+			}()
+
+			if got := m.featureGateTimer != nil; got != tc.wantTimer {
+				t.Fatalf("got feature gate timer scheduled: %v, want: %v", got, tc.wantTimer)
+			}
+			if !tc.wantTimer {
+				return
+			}
+
+			// The listeners are pushed again for the same service config.
+			m.updateFeatureGates()
+			snapshot, err := m.cache.GetSnapshot(m.envoyConfigOptions.Node)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := snapshot.GetVersion(resource.ListenerType), "2021-01-01r0-gates1"; got != want {
+				t.Errorf("got listener version: %s, want: %s", got, want)
+			}
+			if m.featureGateTimer == nil {
+				t.Errorf("the next window boundary is not scheduled")
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"flag"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/golang/glog"
+)
+
+var (
+	startupFetchTimeout = flag.Duration("startup_fetch_timeout", 0, `how long to keep retrying fetching the startup service config and rollouts from Service Management with exponential backoff, before failing to start.
+					0 fails on the first failed fetch.`)
+	fetchRetryInitialInterval = flag.Duration("fetch_retry_initial_interval", time.Second, `the initial interval of retrying the failed fetches of the service config and rollouts, doubled on each failure.`)
+	fetchRetryMaxInterval     = flag.Duration("fetch_retry_max_interval", time.Minute, `the max interval of retrying the failed fetches of the service config and rollouts.`)
+)
+
+// newFetchBackOff returns the exponential backoff of retrying the fetches,
+// which never stops.
+func newFetchBackOff() *backoff.ExponentialBackOff {
+	ebo := backoff.NewExponentialBackOff()
+	ebo.InitialInterval = *fetchRetryInitialInterval
+	ebo.MaxInterval = *fetchRetryMaxInterval
+	ebo.MaxElapsedTime = 0
+	ebo.Reset()
+	return ebo
+}
+
+// retryStartupFetch calls fetch until it succeeds, retrying with exponential
+// backoff for up to --startup_fetch_timeout. The errors wrapped by
+// backoff.Permanent are not retried.
+func retryStartupFetch(fetch func() error) error {
+	if *startupFetchTimeout <= 0 {
+		if err := fetch(); err != nil {
+			if permanent, ok := err.(*backoff.PermanentError); ok {
+				return permanent.Err
+			}
+			return err
+		}
+		return nil
+	}
+
+	ebo := newFetchBackOff()
+	ebo.MaxElapsedTime = *startupFetchTimeout
+	return backoff.RetryNotify(fetch, ebo, func(err error, next time.Duration) {
+		glog.Warningf("fail to fetch the startup service config, retry in %v, %v", next, err)
+	})
+}
+
+// scheduleRolloutRetry retries applying the latest rollout after it failed,
+// so a failed fetch is not left until the next rollout. It must be called
+// with the rolloutMutex held.
+func (m *ConfigManager) scheduleRolloutRetry() time.Duration {
+	if m.rolloutRetryBackOff == nil {
+		m.rolloutRetryBackOff = newFetchBackOff()
+	}
+	next := m.rolloutRetryBackOff.NextBackOff()
+	m.rolloutRetryTimer = time.AfterFunc(next, m.applyLatestRollout)
+	return next
+}
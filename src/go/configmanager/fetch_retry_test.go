@@ -0,0 +1,134 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/cenkalti/backoff"
+
+	sc "github.com/GoogleCloudPlatform/esp-v2/src/go/serviceconfig"
+)
+
+func TestRetryStartupFetch(t *testing.T) {
+	setFlag(t, "fetch_retry_initial_interval", "10ms")
+	setFlag(t, "fetch_retry_max_interval", "20ms")
+
+	testCases := []struct {
+		desc      string
+		timeout   string
+		failures  int
+		permanent bool
+		wantCalls int
+		wantError bool
+	}{
+		{
+			desc:      "no retry without the timeout",
+			timeout:   "0s",
+			failures:  1,
+			wantCalls: 1,
+			wantError: true,
+		},
+		{
+			desc:      "retried until success",
+			timeout:   "5s",
+			failures:  2,
+			wantCalls: 3,
+		},
+		{
+			desc:      "permanent errors are not retried",
+			timeout:   "5s",
+			failures:  2,
+			permanent: true,
+			wantCalls: 1,
+			wantError: true,
+		},
+		{
+			desc:      "retried until the timeout",
+			timeout:   "50ms",
+			failures:  1000,
+			wantError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			setFlag(t, "startup_fetch_timeout", tc.timeout)
+			calls := 0
+			err := retryStartupFetch(func() error {
+				calls++
+				if calls > tc.failures {
+					return nil
+				}
+				if tc.permanent {
+					return backoff.Permanent(fmt.Errorf("invalid service config"))
+				}
+				return fmt.Errorf("unavailable")
+			})
+			if gotError := err != nil; gotError != tc.wantError {
+				t.Fatalf("got error: %v, want error: %v", err, tc.wantError)
+			}
+			if _, ok := err.(*backoff.PermanentError); ok {
+				t.Errorf("got the permanent error wrapper: %v", err)
+			}
+			if tc.wantCalls > 0 && calls != tc.wantCalls {
+				t.Errorf("got %d calls, want: %d", calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestApplyLatestRolloutRetry(t *testing.T) {
+	setFlag(t, "fetch_retry_initial_interval", "10ms")
+	setFlag(t, "fetch_retry_max_interval", "20ms")
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	originalFetchRolloutsURL := util.FetchRolloutsURL
+	defer func() { util.FetchRolloutsURL = originalFetchRolloutsURL }()
+	util.FetchRolloutsURL = func(serviceManagementUrl, serviceName string) string {
+		return server.URL
+	}
+
+	accessToken := func() (string, time.Duration, error) { return "access-token", time.Minute, nil }
+	m := &ConfigManager{
+		serviceConfigFetcher: sc.NewServiceConfigFetcher(&http.Client{}, server.URL, "test-service", accessToken),
+	}
+	m.applyLatestRollout()
+
+	// The failed fetch is retried without waiting for the next rollout.
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&calls) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d rollout fetches, want at least 3", atomic.LoadInt32(&calls))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	m.rolloutMutex.Lock()
+	m.rolloutRetryTimer.Stop()
+	m.rolloutMutex.Unlock()
+}
@@ -42,21 +42,100 @@ var (
 	CorsMaxAge           = flag.Duration("cors_max_age", 480*time.Hour, "set Access-Control-Max-Age response header for CORS preflight request.")
 	CorsPreset           = flag.String("cors_preset", "", `enable CORS support, must be either "basic" or "cors_with_regex"`)
 
+	GrpcWebExposeTrailers = flag.String("grpc_web_expose_trailers", "", `Comma separated custom trailing metadata keys of the gRPC backend to expose to the gRPC-Web clients.
+         They are appended to Access-Control-Expose-Headers along with grpc-status and grpc-message, so browsers allow the clients to read them.`)
+
+	DnsLookupFamily = flag.String("dns_lookup_family", "", `Define the dns lookup family for the clusters other than the backends, e.g. the Google API, JWKS and metadata server clusters.
+         The options are "auto", "v4only" and "v6only". By default the Google API and JWKS clusters use "v4only" and the others use "auto".`)
+
+	BackendCredentials = flag.String("backend_credentials", "", `Attach a credential to the requests of the specified operations to non-Google backends, instead of a Google ID token. Multiple credentials are separated by ';'.
+         A credential is comma separated fields, either a static API key, e.g. selector=type=api_key,header=x-api-key,key_file=/etc/keys/saas,
+         or an OAuth client credentials token fetched and refreshed by the config manager, e.g. selector=type=oauth2,token_url=https://example.com/token,client_id=proxy,client_secret_file=/etc/keys/secret,scopes=read write.
+         The header defaults to x-api-key and authorization respectively. The credentials are part of the config served to Envoy.
+         The key_file and client_secret_file can also be Secret Manager secrets sm://project/secret[/version], which are fetched again on each refresh.`)
+
 	// Backend routing configurations.
 	BackendDnsLookupFamily = flag.String("backend_dns_lookup_family", "auto", `Define the dns lookup family for all backends. The options are "auto", "v4only" and "v6only". The default is "auto".`)
+	BackendLocalityLb      = flag.String("backend_locality_lb", "", `Define the locality aware load balancing of the backends with --backend_locality_endpoints. The options are "zone_aware" and "locality_weighted".
+         "zone_aware" prefers the backend endpoints in the zone of --node_zone. "locality_weighted" distributes requests to the zones by their numbers of endpoints. Disabled by default.`)
+	BackendLocalityEndpoints = flag.String("backend_locality_endpoints", "", `Serve a backend by the endpoints in their zones instead of its resolved hostname, in the format of backend_host:port=zone/endpoint_host:port.
+         Multiple endpoints of a backend are separated by ',', multiple backends are separated by ';'. The zones are in the region of --node_region.
+         For example --backend_locality_endpoints=backend.internal:443=us-central1-a/10.0.0.2:443,us-central1-b/10.0.1.2:443.`)
+	OperationMaxConcurrency = flag.String("operation_max_concurrency", "", `Limit the number of concurrent requests to the backend for the specified operations. Multiple limits are separated by ';'.
+         For example --operation_max_concurrency=selector1=10;selector2=100. Requests exceeding the limit are rejected with 503.`)
+	MaxRequestBytes = flag.Int("max_request_bytes", 0, `Reject the requests with the body larger than this number of bytes with 413. 0, the default, does not limit the requests.
+         The requests are buffered to be checked, so the streaming gRPC methods are not limited.`)
+	OperationMaxRequestBytes = flag.String("operation_max_request_bytes", "", `Override --max_request_bytes for the specified operations, 0 to not limit them. Multiple limits are separated by ';'.
+         For example --operation_max_request_bytes=selector1=10485760;selector2=0.`)
+	BackendMaxConnections     = flag.Int("backend_max_connections", 0, `The circuit breaker max number of connections to each backend cluster. 0 uses the Envoy default of 1024.`)
+	BackendMaxPendingRequests = flag.Int("backend_max_pending_requests", 0, `The circuit breaker max number of requests waiting for a connection to each backend cluster. 0 uses the Envoy default of 1024.`)
+	BackendMaxRequests        = flag.Int("backend_max_requests", 0, `The circuit breaker max number of concurrent requests to each backend cluster. 0 uses the Envoy default of 1024. Overridden by --operation_max_concurrency.`)
+	BackendMaxRetries         = flag.Int("backend_max_retries", 0, `The circuit breaker max number of concurrent retries to each backend cluster. 0 uses the Envoy default of 3.`)
+	OperationHedgingThreshold = flag.String("operation_hedging_threshold", "", `Send a hedged request to the backend if it does not respond within the threshold for the specified operations.
+         Multiple thresholds are separated by ';'. For example --operation_hedging_threshold=selector1=200ms;selector2=1s.
+         Only the GET http rules of the operations are hedged, and each hedged request counts as a retry of --backend_retry_num.`)
+	MaintenanceSelectors = flag.String("maintenance_selectors", "", `Put the specified operations into maintenance mode, multiple selectors are separated by ','. Use '*' for all the operations of the service.
+         The requests of the operations are rejected with 503 and the "Retry-After" header of --maintenance_retry_after, without calling the backend or service control.
+         It can be changed without redeploying via the config manager admin interface.`)
+	MaintenanceRetryAfter = flag.Duration("maintenance_retry_after", 5*time.Minute, `The "Retry-After" header of the responses of the operations in maintenance mode, as a duration such as "10m". It is rounded up to whole seconds in the header, and 0 disables the header.`)
+	Domains               = flag.String("domains", "", `The domains served by the proxy, multiple domains are separated by ','. For example --domains=api.example.com,*.example.net.
+         The requests to the other hostnames are rejected with 404. By default all the domains are served.
+         The hostnames with their own virtual hosts, of --host_backends or the x-google-host-security extension, must not be in the domains.`)
+	HostBackends = flag.String("host_backends", "", `Route the requests to the specified hostnames to their own backends instead of --backend_address, in the format of host=backend_address.
+         Multiple hosts are separated by ';'. For example --host_backends=partner.example.com=http://127.0.0.1:8082.
+         The backends must use the same protocol as --backend_address, and only serve the operations of the local backend.`)
+	BackendMaxRequestHeadersKb = flag.String("backend_max_request_headers_kb", "", `Limit the size in KiB of the request headers forwarded to the specified backends, including the headers added by the proxy.
+         The backends are specified by their host:port addresses, multiple limits are separated by ';'. For example --backend_max_request_headers_kb=127.0.0.1:8082=16;foo.run.app:443=32.
+         Requests exceeding the limit are rejected with 431, instead of being reset by the backend, which surfaces as an opaque 503.`)
+	BackendEnableTrailers = flag.String("backend_enable_trailers", "", `Forward the trailers to and from the specified HTTP/1 backends, which are dropped by default.
+         The backends are specified by their host:port addresses separated by ','. HTTP/2 and gRPC backends always forward the trailers.`)
+	PathRewriteFilter = flag.String("path_rewrite_filter", "auto", `Control the generation of the path rewrite filter, which took over the path translation of the former path_matcher filter.
+         The options are "auto", "on" and "off". The default is "auto",
+         which only generates the filter when any backend rule requires path translation. It can not be "off" when any backend rule requires path translation.`)
+	LroPollingDeadline = flag.Duration("lro_polling_deadline", 0, `If set, the deadline for the google.longrunning.Operations.GetOperation method when any method returns a long-running operation.
+	It overrides the deadline in the backend rule.`)
+	LroPollingInheritApiKey = flag.Bool("lro_polling_inherit_api_key", false, `If true, google.longrunning.Operations.GetOperation inherits the API key locations and allow_unregistered_calls
+	from the methods returning long-running operations when they agree.`)
+
+	PassthroughForEmptyConfig = flag.Bool("passthrough_for_empty_config", false, `If true, a service config without any apis is accepted,
+	and all the requests are passed through to the local backend and reported to service control.`)
 
 	// Envoy specific configurations.
 	ClusterConnectTimeout = flag.Duration("cluster_connect_timeout", 20*time.Second, "cluster connect timeout in seconds")
 
 	// Network related configurations.
-	BackendAddress               = flag.String("backend_address", "http://127.0.0.1:8082", `The application server URI to which ESPv2 proxies requests.`)
-	ListenerAddress              = flag.String("listener_address", "0.0.0.0", "listener socket ip address")
+	BackendAddress = flag.String("backend_address", "http://127.0.0.1:8082", `The application server URI to which ESPv2 proxies requests.
+	The scheme decides the backend protocol: http and https for HTTP/1.1, grpc and grpcs for gRPC.
+	https and grpcs backends are connected over TLS, grpcs uses the "h2" ALPN.`)
+	BackendHttpProtocol = flag.String("backend_http_protocol", "", `The HTTP protocol of the http or https backend in --backend_address, one of "http/1.1", "h2" or "auto". Defaults to "http/1.1".
+	"auto" probes the backend when the config manager starts: by ALPN for https backends and by the HTTP/2 connection preface for http backends.
+	If the backend cannot be reached, "http/1.1" is used. It is ignored for grpc and grpcs backends.`)
+	BackendTlsSni = flag.String("backend_tls_sni", "", `The SNI for the TLS connection to the https or grpcs backend in --backend_address.
+	By default, the hostname of --backend_address is used. Set it when the backend is addressed by IP but serves a certificate for a hostname.`)
+	ServiceManagementFailoverURLs = flag.String("service_management_failover_urls", "", `Comma separated urls of the service management servers tried in order when --service_management_url fails with a transport error or a 5xx status, e.g. the regional endpoints.
+	A failed url is skipped for a minute unless all of them fail.`)
+	ServiceControlFailoverURLs = flag.String("service_control_failover_urls", "", `Comma separated urls of the service control servers failed over to in order when --service_control_url fails with a transport error or a 5xx status.
+	Each is called through its own cluster, with its own SNI and authority.`)
+	ListenerAddress = flag.String("listener_address", "0.0.0.0", `The ip address to accept downstream connections on, ipv4 or ipv6. Use "::" for all the ipv6 and ipv4 addresses,
+	or a loopback address like "127.0.0.1" or "::1" to only accept the connections from the same host.`)
 	ServiceManagementURL         = flag.String("service_management_url", "https://servicemanagement.googleapis.com", "url of service management server")
 	ServiceControlURL            = flag.String("service_control_url", "https://servicecontrol.googleapis.com", "url of service control server")
+	TelemetryBackend             = flag.String("telemetry_backend", "servicecontrol", `The provider of the check, quota and report calls: "servicecontrol" for Google Service Control, "servicecontrol_compatible" for a self-hosted server compatible with the Service Control API at --service_control_url, called without access token, or "noop" to make no calls at all.`)
+	SecretManagerURL             = flag.String("secret_manager_url", "https://secretmanager.googleapis.com", "url of secret manager server")
+	SecretRefreshInterval        = flag.Duration("secret_refresh_interval", 5*time.Minute, `The interval to re-fetch the Secret Manager secrets referenced by sm:// flag values.`)
 	EnableBackendAddressOverride = flag.Bool("enable_backend_address_override", false, "Allow the --backend flag to override the backend.rule.address for all operations.")
 
-	ListenerPort = flag.Int("listener_port", 8080, "listener port")
-	Healthz      = flag.String("healthz", "", "path for health check of ESPv2 proxy itself")
+	ListenerPort    = flag.Int("listener_port", 8080, "listener port")
+	ListenerUdsPath = flag.String("listener_uds_path", "", `The path of the unix domain socket to accept downstream connections on, instead of --listener_address and --listener_port.
+	Prefix it with '@' for an abstract socket. For the sidecar deployments where the app and the proxy share a host.`)
+	SslListenerPort = flag.Int("ssl_listener_port", 0, `The port to accept TLS downstream connections with the certificate of --ssl_server_cert_path, while --listener_port accepts the plaintext ones.
+	By default only one listener is generated, serving TLS on --listener_port if --ssl_server_cert_path is set.`)
+	HttpsRedirect   = flag.Bool("https_redirect", false, `Redirect the plaintext requests on --listener_port to the https scheme on --ssl_listener_port instead of serving them. The health checks on --healthz are still served.`)
+	Healthz         = flag.String("healthz", "", "path for health check of ESPv2 proxy itself")
+	ApiMetadataPath = flag.String("api_metadata_path", "", `The path serving the API discovery metadata for the developer portals and the API catalogs, e.g. /.well-known/api-metadata. Disabled by default.`)
+
+	EnableGrpcReflection = flag.Bool("enable_grpc_reflection", false, `Answer the gRPC server reflection of the proxied API from the proto descriptor of the service config, instead of passing it through to the backend.`)
+	GrpcReflectionPort   = flag.Uint("grpc_reflection_port", 8792, `The loopback port of the gRPC reflection server of the config manager, used with --enable_grpc_reflection.`)
 
 	// Health check grpc backend related flags.
 	HealthCheckGrpcBackend        = flag.Bool("health_check_grpc_backend", false, `If true, ESPv2 periodically checks the gRPC Health service for the backend specified by the flag "--backend_address".`)
@@ -67,9 +146,17 @@ var (
 	HealthCheckGrpcBackendNoTrafficInterval = flag.Duration("health_check_grpc_backend_no_traffic_interval", 60*time.Second, `Specify the checking interval to call the backend gRPC Health service
                       when at start up or the backend did not have any traffic. Default is 60 seconds. It only applies when the flag "--health_check_grpc_backend" is used.`)
 
-	SslServerCertPath                = flag.String("ssl_server_cert_path", "", "Path to the certificate and key that ESPv2 uses to act as a HTTPS server")
-	SslServerCipherSuites            = flag.String("ssl_server_cipher_suites", "", "Cipher suites to use for downstream connections as a comma-separated list.")
-	SslServerRootCertsPath           = flag.String("ssl_server_root_cert_path", "", "The file path of root certificates that ESPv2 uses to verify downstream client certificate. If not specified, ESPv2 doesn't verify client certificates by default")
+	SslServerCertPath = flag.String("ssl_server_cert_path", "", `Path to the certificate and key that ESPv2 uses to act as a HTTPS server.
+                      It can also be a Secret Manager secret sm://project/secret[/version] holding the PEM encoded certificate chain followed by the private key,
+                      which requires the flag "--ssl_server_cert_sds".`)
+	SslServerCertSds = flag.Bool("ssl_server_cert_sds", false, `If enabled, the certificate and key under --ssl_server_cert_path are read by the config manager and delivered to Envoy
+                      via SDS, so they can be rotated at runtime without restarting Envoy.`)
+	SslServerCertCheckInterval = flag.Duration("ssl_server_cert_check_interval", 60*time.Second, `The interval to check the certificate and key under --ssl_server_cert_path for changes.
+                      It only applies when the flag "--ssl_server_cert_sds" is used.`)
+	SslServerCipherSuites      = flag.String("ssl_server_cipher_suites", "", "Cipher suites to use for downstream connections as a comma-separated list.")
+	SslServerRootCertsPath     = flag.String("ssl_server_root_cert_path", "", "The file path of root certificates that ESPv2 uses to verify downstream client certificate. If not specified, ESPv2 doesn't verify client certificates by default")
+	SslServerRequireClientCert = flag.Bool("ssl_server_require_client_cert", true, `If true, downstream clients must present a certificate signed by --ssl_server_root_cert_path.
+                      If false, client certificates are only validated when presented. It only applies when the flag "--ssl_server_root_cert_path" is used.`)
 	SslSidestreamClientRootCertsPath = flag.String("ssl_sidestream_client_root_certs_path", util.DefaultRootCAPaths, "Path to the root certificates to make TLS connection to all external services other than the backend.")
 	SslBackendClientCertPath         = flag.String("ssl_backend_client_cert_path", "", "Path to the certificate and key that ESPv2 uses to enable TLS mutual authentication for HTTPS backend")
 	SslBackendClientRootCertsPath    = flag.String("ssl_backend_client_root_certs_path", util.DefaultRootCAPaths, "Path to the root certificates to make TLS connection to the HTTPS backend.")
@@ -88,11 +175,16 @@ var (
 	AppendResponseHeaders = flag.String("append_response_headers", "", `Append HTTP headers to the response before sent to the upstream backend. Multiple headers are separated by ';'.
          For example --append_response_headers=key1=value1;key2=value2. If a header is already in the response, the new value will be append.`)
 	EnableOperationNameHeader = flag.Bool("enable_operation_name_header", false, "If enabled, the operation name for the matched route will be sent to the upstream as a request header.")
+	EnableRouteMetadata       = flag.Bool("enable_route_metadata", false, `If enabled, the selector, uri template and http method of the originating API method are attached
+         to each generated route as metadata, so the matched API method can be seen in Envoy config dumps.`)
 
 	// Flags for non_gcp deployment.
 	ServiceAccountKey = flag.String("service_account_key", "", `Use the service account key JSON file to access the service control and the
 	service management.  You can also set {creds_key} environment variable to the location of the service account credentials JSON file. If the option is
-  omitted, the proxy contacts the metadata service to fetch an access token`)
+  omitted, the proxy contacts the metadata service to fetch an access token. It can also be a Secret Manager secret sm://project/secret[/version]
+  holding the key JSON, which is fetched with the access token from the metadata service, so it is not supported with --non_gcp.
+  With --non_gcp, the Secret Manager secrets of the other flags are fetched with the access token from the key file. The ID tokens of the backend authentication are generated
+  from the key as well, unless --backend_auth_iam_service_account is set.`)
 	TokenAgentPort = flag.Uint("token_agent_port", 8791, "Port that configmanager use to setup server to provide envoy with access token using service account credential, for accessing servicecontrol.")
 
 	// Flags for external calls.
@@ -100,17 +192,33 @@ var (
   When disabled, config generator will not make external calls to determine the JWKS URI, 
 	but the 'jwks_uri' field must not be empty in any authentication provider. 
 	This should be disabled when the URLs configured by the API Producer cannot be trusted.`)
+	OidcDiscoveryTimeout          = flag.Duration("oidc_discovery_timeout", 5*time.Second, `The timeout of each OpenID Connect Discovery call. The issuers are discovered concurrently.`)
+	OidcDiscoveryNumRetries       = flag.Int("oidc_discovery_num_retries", 2, `The number of retries of a failed OpenID Connect Discovery call, with exponential back off.`)
+	OidcDiscoveryFallbackJwksPath = flag.String("oidc_discovery_fallback_jwks_path", "", `If set, e.g. "/.well-known/jwks.json", the providers whose issuers cannot be discovered
+	fetch their JWKS from the path under the issuer, instead of failing the config. The tokens of those issuers are rejected until the JWKS is fetched.`)
 	DependencyErrorBehavior = flag.String("dependency_error_behavior", commonpb.DependencyErrorBehavior_BLOCK_INIT_ON_ANY_ERROR.String(),
 		`The behavior all Envoy filter will adhere to when waiting for external dependencies during filter config.
 						Value must match the enum espv2.api.envoy.v10.http.common.DependencyErrorBehavior.`)
 
+	DumpGeneratedConfigDir = flag.String("dump_generated_config_dir", "", `If set, the generated listeners, clusters and http filters are written into this directory as JSON files,
+	under a sub directory named by the service config id, at startup and on each rollout.`)
+
 	// Envoy configurations.
 	AccessLog       = flag.String("access_log", "", "Path to a local file to which the access log entries will be written")
 	AccessLogFormat = flag.String("access_log_format", "", `String format to specify the format of access log.
 	If unset, the following format will be used.
 	https://www.envoyproxy.io/docs/envoy/latest/configuration/observability/access_log#default-format-string
 	For the detailed format grammar, please refer to the following document.
-	https://www.envoyproxy.io/docs/envoy/latest/configuration/observability/access_log#format-strings`)
+	https://www.envoyproxy.io/docs/envoy/latest/configuration/observability/access_log#format-strings
+	Besides the Envoy command operators, the operation is logged by %ROUTE_NAME%, whether an API key is presented by
+	%FILTER_STATE(com.google.espv2.filters.http.service_control.api_key_present:PLAIN)% and the JWT issuer by
+	%DYNAMIC_METADATA(envoy.filters.http.jwt_authn:jwt_payloads:iss)%.
+	If access_log_json is enabled, it should be a JSON object mapping the field names to the format strings.`)
+	AccessLogJson = flag.Bool("access_log_json", false, `If true, the access log entries are written as JSON objects.
+	If access_log_format is unset, the Envoy default fields are logged together with the operation, whether an API key is presented and the JWT issuer.`)
+	AccessLogGrpcUrl = flag.String("access_log_grpc_url", "", `The url of a gRPC Access Log Service (ALS) collector, in the format of grpc://host:port, or grpcs://host:port with TLS.
+	If set, the access log entries are streamed to the collector, together with the operation and whether an API key is presented as the filter states.`)
+	AccessLogGrpcLogName = flag.String("access_log_grpc_log_name", "espv2", "The log name of the access log entries streamed to the gRPC Access Log Service collector.")
 
 	EnvoyUseRemoteAddress  = flag.Bool("envoy_use_remote_address", false, "Envoy HttpConnectionManager configuration, please refer to envoy documentation for detailed information.")
 	EnvoyXffNumTrustedHops = flag.Int("envoy_xff_num_trusted_hops", 2, "Envoy HttpConnectionManager configuration, please refer to envoy documentation for detailed information.")
@@ -121,6 +229,8 @@ var (
 	foo,bar, endpoint log will have request_headers: foo=foo_value;bar=bar_value if values are available;`)
 	LogResponseHeaders = flag.String("log_response_headers", "", `Log corresponding response headers through service control, separated by comma. Example, when --log_response_headers=
 	foo,bar,endpoint log will have response_headers: foo=foo_value;bar=bar_value if values are available.`)
+	LogLabels = flag.String("log_labels", "", `Add custom labels to the endpoint logs reported through service control, separated by comma. Example, when --log_labels=
+	environment=staging,region=us-central1, endpoint log entries will have labels environment: staging and region: us-central1.`)
 	MinStreamReportIntervalMs = flag.Uint64("min_stream_report_interval_ms", 0, `Minimum amount of time (milliseconds) between sending intermediate reports on a stream and the default is 10000 if not set.`)
 
 	SuppressEnvoyHeaders = flag.Bool("suppress_envoy_headers", true, `Do not add any additional x-envoy- headers to requests or responses. This only affects the router filter
@@ -146,6 +256,15 @@ var (
 	JwksFetchRetryBackOffMaxIntervalMs  = flag.Int("jwks_fetch_retry_back_off_max_interval_ms", 32000, `Specify JWKS fetch retry exponential back off maximum interval in milliseconds. The default is 32 seconds.`)
 	JwtPatForwardPayloadHeader          = flag.Bool("jwt_pad_forward_payload_header", false, `For the JWT in request, the JWT payload is forwarded to backend in the "X-Endpoint-API-UserInfo"" header by default. 
 Normally JWT based64 encode doesn’t add padding. If this flag is true, the header will be padded.`)
+	JwtPayloadHeader = flag.String("jwt_payload_header", "", `The header to forward the base64url encoded payload of the verified JWT to the backend in.
+By default, it is "API-UserInfo" with the prefix of --generated_header_prefix, i.e. "X-Endpoint-API-UserInfo".`)
+	JwtAllowMissingOrFailedSelectors = flag.String("jwt_allow_missing_or_failed_selectors", "", `Allow the requests without a JWT or with a JWT failing the verification for the specified operations, multiple selectors are separated by ','.
+The payload of a verified JWT is still forwarded to the backend. The operations allowing the requests without a JWT only, i.e. with allow_without_credential, are not required to be listed.`)
+	JwtClaimRequirements = flag.String("jwt_claim_requirements", "", `Require the claims of the verified JWT for the specified operations, in the format of selector=CLAIM:VALUE.
+Multiple claims of an operation are separated by ',' and are all required, multiple operations are separated by ';'. For example
+--jwt_claim_requirements=selector1=scope:shelves.write,hd:example.com requires the "shelves.write" scope and the example.com hosted domain.
+A string claim has the value when it equals the value or has it as one of the space separated words, and a list claim when the value is one of the items.
+The requests failing the requirements are rejected with 403.`)
 
 	ScCheckTimeoutMs  = flag.Int("service_control_check_timeout_ms", 0, `Set the timeout in millisecond for service control Check request. Must be > 0 and the default is 1000 if not set.`)
 	ScQuotaTimeoutMs  = flag.Int("service_control_quota_timeout_ms", 0, `Set the timeout in millisecond for service control Quota request. Must be > 0 and the default is 1000 if not set.`)
@@ -155,21 +274,61 @@ Normally JWT based64 encode doesn’t add padding. If this flag is true, the hea
 	ScQuotaRetries  = flag.Int("service_control_quota_retries", -1, `Set the retry times for service control Quota request. Must be >= 0 and the default is 1 if not set.`)
 	ScReportRetries = flag.Int("service_control_report_retries", -1, `Set the retry times for service control Report request. Must be >= 0 and the default is 5 if not set.`)
 
+	ScReportQueueMaxSize    = flag.Int("service_control_report_queue_max_size", 0, `Set the max number of service control Report requests pending in memory. 0 means no limit.`)
+	ScReportQueueDropPolicy = flag.String("service_control_report_queue_drop_policy", "DROP_NEWEST", `The Report requests to drop when the report queue is full and they can not be spilled to disk.
+Either DROP_NEWEST to drop the new requests or DROP_OLDEST to cancel the oldest pending requests.`)
+	ScReportDiskSpillDir = flag.String("service_control_report_disk_spill_dir", "", `If set, the Report requests are spilled to this directory when the report queue is full, and sent once it has room again.
+The requests spilled before a restart are sent after it. It requires service_control_report_queue_max_size.`)
+	ScReportDiskSpillMaxBytes = flag.Uint64("service_control_report_disk_spill_max_bytes", 64*1024*1024, `Set the max total bytes of the spilled Report requests. Once reached, the Report requests are dropped by the drop policy.`)
+
+	ScReportAggregationEntries = flag.Int("service_control_report_aggregation_entries", -1, `Set the max number of the aggregated service control Report operations cached in memory. Must be >= 0 and the default is 10000 if not set.
+0 disables the aggregation, each Report request is sent directly.`)
+	ScReportAggregationFlushIntervalMs = flag.Int("service_control_report_aggregation_flush_interval_ms", 0, `Set the interval in millisecond to flush the aggregated service control Report operations. Must be > 0 and the default is 1000 if not set.
+A longer interval sends fewer Report requests at the cost of the report freshness.`)
+	ScCheckAggregationEntries = flag.Int("service_control_check_aggregation_entries", -1, `Set the max number of the service control Check responses cached in memory. Must be >= 0 and the default is 10000 if not set.
+0 disables the cache, each Check request is sent directly.`)
+	ScCheckAggregationFlushIntervalMs = flag.Int("service_control_check_aggregation_flush_interval_ms", 0, `Set the interval in millisecond to refresh the cached service control Check responses. Must be > 0 and the default is 60000 if not set.`)
+	ScCheckAggregationExpirationMs    = flag.Int("service_control_check_aggregation_expiration_ms", 0, `Set the time in millisecond the cached service control Check responses are used for. Must be > 0 and the default is 300000 if not set.
+A shorter time rejects the revoked API keys sooner at the cost of more Check requests. It must be longer than the flush interval.`)
+
+	ResponseCompression = flag.String("response_compression", "", `Comma separated algorithms, gzip or brotli, to compress the responses with. The algorithm is negotiated with
+	the Accept-Encoding request header. Disabled by default.`)
+	ResponseCompressionMinContentLength = flag.Int("response_compression_min_content_length", -1, `Set the minimum response Content-Length in bytes to compress. Must be >= 0 and the default is 30 if not set.`)
+	ResponseCompressionContentTypes     = flag.String("response_compression_content_types", "", `Comma separated content types of the responses to compress. If not set, the common text types,
+	e.g. application/json, text/html and text/plain, are compressed.`)
+
+	QuotaRetryAfter = flag.Duration("quota_retry_after", 0, `If set, requests rejected with 429 by service control because the quota is exhausted get the "Retry-After" header with this duration,
+	rounded up to seconds, e.g. --quota_retry_after=30s. Disabled by default.`)
+	ReportSuccessSamplingRates = flag.String("report_success_sampling_rates", "", `Only report a sample of the successful calls to service control for the specified operations, failed calls are always reported.
+	Multiple rates are separated by ';'. For example --report_success_sampling_rates=selector1=0.01;selector2=0.5.`)
+
 	ComputePlatformOverride = flag.String("compute_platform_override", "", "the overridden platform where the proxy is running at")
+	ComputeZoneOverride     = flag.String("compute_zone_override", "", "the overridden zone where the proxy is running at, reported to service control. Cannot be set with --compute_region_override.")
+	ComputeRegionOverride   = flag.String("compute_region_override", "", "the overridden region where the proxy is running at, reported to service control. Cannot be set with --compute_zone_override.")
+	ProjectIdOverride       = flag.String("project_id_override", "", "the overridden project id where the proxy is running at, reported to service control.")
+
+	// Filter generation toggles.
+	SkipBackendAuthFilter    = flag.Bool("skip_backend_auth_filter", false, "skip backend auth filter. It cannot be skipped if any backend rule requires JWT authentication.")
+	SkipGrpcWebFilter        = flag.Bool("skip_grpc_web_filter", false, "skip grpc web filter for gRPC backends.")
+	SkipTranscoderFilter     = flag.Bool("skip_transcoder_filter", false, "skip grpc json transcoder filter for gRPC backends.")
+	SkipJwtAuthnFilter       = flag.Bool("skip_jwt_authn_filter", false, "skip jwt authn filter. It cannot be skipped if --log_jwt_payloads or --jwt_claim_requirements is set.")
+	SkipServiceControlFilter = flag.Bool("skip_service_control_filter", false, "skip service control filter, the API keys are not checked and the calls are not reported.")
 
 	// Flags for testing purpose. They are not exposed to the user via start_proxy.py
-	SkipJwtAuthnFilter       = flag.Bool("skip_jwt_authn_filter", false, "skip jwt authn filter, for test purpose")
-	SkipServiceControlFilter = flag.Bool("skip_service_control_filter", false, "skip service control filter, for test purpose")
-	StreamIdleTimeout        = flag.Duration("stream_idle_timeout_test_only", util.DefaultIdleTimeout, "The amount of time HTTP/2 streams can exist without any activity. "+
+	StreamIdleTimeout = flag.Duration("stream_idle_timeout_test_only", util.DefaultIdleTimeout, "The amount of time HTTP/2 streams can exist without any activity. "+
 		"Set `deadline` in the service config to override this global value on a per-route basis.")
 
 	TranscodingAlwaysPrintPrimitiveFields         = flag.Bool("transcoding_always_print_primitive_fields", false, "Whether to always print primitive fields for grpc-json transcoding")
 	TranscodingAlwaysPrintEnumsAsInts             = flag.Bool("transcoding_always_print_enums_as_ints", false, "Whether to always print enums as ints for grpc-json transcoding")
-	TranscodingPreserveProtoFieldNames            = flag.Bool("transcoding_preserve_proto_field_names", false, "Whether to preserve proto field names for grpc-json transcoding")
+	TranscodingPreserveProtoFieldNames            = flag.Bool("transcoding_preserve_proto_field_names", false, "Whether to preserve proto field names for grpc-json transcoding. By default the JSON field names are lowerCamelCase. Request bodies are accepted with either names regardless of this flag.")
 	TranscodingIgnoreQueryParameters              = flag.String("transcoding_ignore_query_parameters", "", "A list of query parameters(separated by comma) to be ignored for transcoding method mapping in grpc-json transcoding.")
 	TranscodingIgnoreUnknownQueryParameters       = flag.Bool("transcoding_ignore_unknown_query_parameters", false, "Whether to ignore query parameters that cannot be mapped to a corresponding protobuf field in grpc-json transcoding.")
 	TranscodingQueryParametersDisableUnescapePlus = flag.Bool("transcoding_query_parameters_disable_unescape_plus", false, `By default, unescape "+" to space when extracting variables in
            the query parameters in grpc-json transcoding. This is to support HTML 2.0<https://tools.ietf.org/html/rfc1866#section-8.2.1>. Set this flag to true to disable this feature.`)
+	TranscodingStatusOverrides = flag.String("transcoding_status_overrides", "", `Override the HTTP statuses the gRPC statuses of the specified operations are transcoded to, in the format of selector=CODE:STATUS[:RETRY_AFTER].
+           Multiple codes of an operation are separated by ',', multiple operations are separated by ';'. For example
+           --transcoding_status_overrides=selector1=RESOURCE_EXHAUSTED:429:30s,FAILED_PRECONDITION:409 also sets the "Retry-After" header to 30 seconds for RESOURCE_EXHAUSTED.
+           Only the JSON responses transcoded from gRPC are changed, the gRPC clients get the original statuses.`)
 
 	BackendRetryOns = flag.String("backend_retry_ons", "reset,connect-failure,refused-stream",
 		`The conditions under which ESPv2 does retry on the backends. One or more
@@ -201,26 +360,69 @@ func EnvoyConfigOptionsFromFlags() options.ConfigGeneratorOptions {
 	opts := options.ConfigGeneratorOptions{
 		CommonOptions:                                 commonflags.DefaultCommonOptionsFromFlags(),
 		BackendAddress:                                *BackendAddress,
+		BackendHttpProtocol:                           *BackendHttpProtocol,
+		BackendTlsSni:                                 *BackendTlsSni,
 		EnableBackendAddressOverride:                  *EnableBackendAddressOverride,
 		AccessLog:                                     *AccessLog,
 		AccessLogFormat:                               *AccessLogFormat,
+		AccessLogJson:                                 *AccessLogJson,
+		AccessLogGrpcUrl:                              *AccessLogGrpcUrl,
+		AccessLogGrpcLogName:                          *AccessLogGrpcLogName,
+		DumpGeneratedConfigDir:                        *DumpGeneratedConfigDir,
 		ComputePlatformOverride:                       *ComputePlatformOverride,
+		ComputeZoneOverride:                           *ComputeZoneOverride,
+		ComputeRegionOverride:                         *ComputeRegionOverride,
+		ProjectIdOverride:                             *ProjectIdOverride,
 		CorsAllowCredentials:                          *CorsAllowCredentials,
 		CorsAllowHeaders:                              *CorsAllowHeaders,
 		CorsAllowMethods:                              *CorsAllowMethods,
 		CorsAllowOrigin:                               *CorsAllowOrigin,
 		CorsAllowOriginRegex:                          *CorsAllowOriginRegex,
 		CorsExposeHeaders:                             *CorsExposeHeaders,
+		GrpcWebExposeTrailers:                         *GrpcWebExposeTrailers,
 		CorsMaxAge:                                    *CorsMaxAge,
 		CorsPreset:                                    *CorsPreset,
 		BackendDnsLookupFamily:                        *BackendDnsLookupFamily,
+		DnsLookupFamily:                               *DnsLookupFamily,
+		BackendCredentials:                            *BackendCredentials,
+		BackendLocalityLb:                             *BackendLocalityLb,
+		BackendLocalityEndpoints:                      *BackendLocalityEndpoints,
+		OperationMaxConcurrency:                       *OperationMaxConcurrency,
+		MaxRequestBytes:                               *MaxRequestBytes,
+		OperationMaxRequestBytes:                      *OperationMaxRequestBytes,
+		BackendMaxConnections:                         *BackendMaxConnections,
+		BackendMaxPendingRequests:                     *BackendMaxPendingRequests,
+		BackendMaxRequests:                            *BackendMaxRequests,
+		BackendMaxRetries:                             *BackendMaxRetries,
+		OperationHedgingThreshold:                     *OperationHedgingThreshold,
+		MaintenanceSelectors:                          *MaintenanceSelectors,
+		MaintenanceRetryAfter:                         *MaintenanceRetryAfter,
+		Domains:                                       *Domains,
+		HostBackends:                                  *HostBackends,
+		BackendMaxRequestHeadersKb:                    *BackendMaxRequestHeadersKb,
+		BackendEnableTrailers:                         *BackendEnableTrailers,
+		PathRewriteFilter:                             *PathRewriteFilter,
+		LroPollingDeadline:                            *LroPollingDeadline,
+		LroPollingInheritApiKey:                       *LroPollingInheritApiKey,
+		PassthroughForEmptyConfig:                     *PassthroughForEmptyConfig,
 		ClusterConnectTimeout:                         *ClusterConnectTimeout,
 		StreamIdleTimeout:                             *StreamIdleTimeout,
 		ListenerAddress:                               *ListenerAddress,
 		ServiceManagementURL:                          *ServiceManagementURL,
 		ServiceControlURL:                             *ServiceControlURL,
+		ServiceManagementFailoverURLs:                 *ServiceManagementFailoverURLs,
+		ServiceControlFailoverURLs:                    *ServiceControlFailoverURLs,
+		TelemetryBackend:                              *TelemetryBackend,
+		SecretManagerURL:                              *SecretManagerURL,
+		SecretRefreshInterval:                         *SecretRefreshInterval,
 		ListenerPort:                                  *ListenerPort,
+		ListenerUdsPath:                               *ListenerUdsPath,
+		SslListenerPort:                               *SslListenerPort,
+		HttpsRedirect:                                 *HttpsRedirect,
 		Healthz:                                       *Healthz,
+		ApiMetadataPath:                               *ApiMetadataPath,
+		EnableGrpcReflection:                          *EnableGrpcReflection,
+		GrpcReflectionPort:                            *GrpcReflectionPort,
 		HealthCheckGrpcBackend:                        *HealthCheckGrpcBackend,
 		HealthCheckGrpcBackendService:                 *HealthCheckGrpcBackendService,
 		HealthCheckGrpcBackendInterval:                *HealthCheckGrpcBackendInterval,
@@ -230,8 +432,11 @@ func EnvoyConfigOptionsFromFlags() options.ConfigGeneratorOptions {
 		SslBackendClientRootCertsPath:                 *SslBackendClientRootCertsPath,
 		SslBackendClientCipherSuites:                  *SslBackendClientCipherSuites,
 		SslServerCertPath:                             *SslServerCertPath,
+		SslServerCertSds:                              *SslServerCertSds,
+		SslServerCertCheckInterval:                    *SslServerCertCheckInterval,
 		SslServerCipherSuites:                         *SslServerCipherSuites,
 		SslServerRootCertPath:                         *SslServerRootCertsPath,
+		SslServerRequireClientCert:                    *SslServerRequireClientCert,
 		SslMinimumProtocol:                            *SslMinimumProtocol,
 		SslMaximumProtocol:                            *SslMaximumProtocol,
 		EnableHSTS:                                    *EnableHSTS,
@@ -241,16 +446,24 @@ func EnvoyConfigOptionsFromFlags() options.ConfigGeneratorOptions {
 		AddResponseHeaders:                            *AddResponseHeaders,
 		AppendResponseHeaders:                         *AppendResponseHeaders,
 		EnableOperationNameHeader:                     *EnableOperationNameHeader,
+		EnableRouteMetadata:                           *EnableRouteMetadata,
 		ServiceAccountKey:                             *ServiceAccountKey,
 		TokenAgentPort:                                *TokenAgentPort,
 		DisableOidcDiscovery:                          *DisableOidcDiscovery,
+		OidcDiscoveryTimeout:                          *OidcDiscoveryTimeout,
+		OidcDiscoveryNumRetries:                       *OidcDiscoveryNumRetries,
+		OidcDiscoveryFallbackJwksPath:                 *OidcDiscoveryFallbackJwksPath,
 		DependencyErrorBehavior:                       *DependencyErrorBehavior,
+		SkipBackendAuthFilter:                         *SkipBackendAuthFilter,
+		SkipGrpcWebFilter:                             *SkipGrpcWebFilter,
+		SkipTranscoderFilter:                          *SkipTranscoderFilter,
 		SkipJwtAuthnFilter:                            *SkipJwtAuthnFilter,
 		SkipServiceControlFilter:                      *SkipServiceControlFilter,
 		EnvoyUseRemoteAddress:                         *EnvoyUseRemoteAddress,
 		EnvoyXffNumTrustedHops:                        *EnvoyXffNumTrustedHops,
 		LogJwtPayloads:                                *LogJwtPayloads,
 		LogRequestHeaders:                             *LogRequestHeaders,
+		LogLabels:                                     *LogLabels,
 		LogResponseHeaders:                            *LogResponseHeaders,
 		MinStreamReportIntervalMs:                     *MinStreamReportIntervalMs,
 		SuppressEnvoyHeaders:                          *SuppressEnvoyHeaders,
@@ -267,6 +480,9 @@ func EnvoyConfigOptionsFromFlags() options.ConfigGeneratorOptions {
 		JwksFetchRetryBackOffBaseInterval:             time.Duration(*JwksFetchRetryBackOffBaseIntervalMs) * time.Millisecond,
 		JwksFetchRetryBackOffMaxInterval:              time.Duration(*JwksFetchRetryBackOffMaxIntervalMs) * time.Millisecond,
 		JwtPadForwardPayloadHeader:                    *JwtPatForwardPayloadHeader,
+		JwtPayloadHeader:                              *JwtPayloadHeader,
+		JwtAllowMissingOrFailedSelectors:              *JwtAllowMissingOrFailedSelectors,
+		JwtClaimRequirements:                          *JwtClaimRequirements,
 		BackendRetryOns:                               *BackendRetryOns,
 		BackendRetryNum:                               *BackendRetryNum,
 		BackendPerTryTimeout:                          *BackendPerTryTimeout,
@@ -277,12 +493,27 @@ func EnvoyConfigOptionsFromFlags() options.ConfigGeneratorOptions {
 		ScCheckRetries:                                *ScCheckRetries,
 		ScQuotaRetries:                                *ScQuotaRetries,
 		ScReportRetries:                               *ScReportRetries,
+		ScReportQueueMaxSize:                          *ScReportQueueMaxSize,
+		ScReportQueueDropPolicy:                       *ScReportQueueDropPolicy,
+		ScReportDiskSpillDir:                          *ScReportDiskSpillDir,
+		ScReportDiskSpillMaxBytes:                     *ScReportDiskSpillMaxBytes,
+		ScReportAggregationEntries:                    *ScReportAggregationEntries,
+		ScReportAggregationFlushIntervalMs:            *ScReportAggregationFlushIntervalMs,
+		ScCheckAggregationEntries:                     *ScCheckAggregationEntries,
+		ScCheckAggregationFlushIntervalMs:             *ScCheckAggregationFlushIntervalMs,
+		ScCheckAggregationExpirationMs:                *ScCheckAggregationExpirationMs,
+		ResponseCompression:                           *ResponseCompression,
+		ResponseCompressionMinContentLength:           *ResponseCompressionMinContentLength,
+		ResponseCompressionContentTypes:               *ResponseCompressionContentTypes,
+		QuotaRetryAfter:                               *QuotaRetryAfter,
+		ReportSuccessSamplingRates:                    *ReportSuccessSamplingRates,
 		TranscodingAlwaysPrintPrimitiveFields:         *TranscodingAlwaysPrintPrimitiveFields,
 		TranscodingAlwaysPrintEnumsAsInts:             *TranscodingAlwaysPrintEnumsAsInts,
 		TranscodingPreserveProtoFieldNames:            *TranscodingPreserveProtoFieldNames,
 		TranscodingIgnoreQueryParameters:              *TranscodingIgnoreQueryParameters,
 		TranscodingIgnoreUnknownQueryParameters:       *TranscodingIgnoreUnknownQueryParameters,
 		TranscodingQueryParametersDisableUnescapePlus: *TranscodingQueryParametersDisableUnescapePlus,
+		TranscodingStatusOverrides:                    *TranscodingStatusOverrides,
 		APIAllowList:                                  []string{},
 	}
 
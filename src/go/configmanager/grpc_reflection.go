@@ -0,0 +1,268 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	smpb "google.golang.org/genproto/googleapis/api/servicemanagement/v1"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	descpb "google.golang.org/protobuf/types/descriptorpb"
+)
+
+// grpcReflectionServer answers the gRPC server reflection of the proxied API
+// from the proto descriptor of the served service config, so the clients can
+// discover the API even if the backend disables the reflection.
+type grpcReflectionServer struct {
+	rpb.UnimplementedServerReflectionServer
+	m *ConfigManager
+}
+
+// RegisterGrpcReflection registers the gRPC reflection server of the proxied
+// API.
+func (m *ConfigManager) RegisterGrpcReflection(s *grpc.Server) {
+	rpb.RegisterServerReflectionServer(s, &grpcReflectionServer{m: m})
+}
+
+// reflectionDescriptors are the descriptors of a service config.
+type reflectionDescriptors struct {
+	files    *protoregistry.Files
+	services []string
+}
+
+// reflectionDescriptors resolves the descriptors of the served service config.
+// The service config may be replaced by a rollout, so each reflection stream
+// keeps the descriptors it started with.
+func (m *ConfigManager) reflectionDescriptors() (*reflectionDescriptors, error) {
+	m.mutex.Lock()
+	serviceInfo := m.serviceInfo
+	m.mutex.Unlock()
+
+	if serviceInfo == nil {
+		return nil, fmt.Errorf("no service config is served yet")
+	}
+
+	for _, sourceFile := range serviceInfo.ServiceConfig().GetSourceInfo().GetSourceFiles() {
+		configFile := &smpb.ConfigFile{}
+		if err := ptypes.UnmarshalAny(sourceFile, configFile); err != nil {
+			continue
+		}
+		if configFile.GetFileType() != smpb.ConfigFile_FILE_DESCRIPTOR_SET_PROTO {
+			continue
+		}
+
+		fds := &descpb.FileDescriptorSet{}
+		if err := proto.Unmarshal(configFile.GetFileContents(), fds); err != nil {
+			return nil, fmt.Errorf("fail to unmarshal proto descriptor of service config %s, %v", serviceInfo.ConfigID, err)
+		}
+		files, err := protodesc.NewFiles(fds)
+		if err != nil {
+			return nil, fmt.Errorf("fail to resolve proto descriptor of service config %s, %v", serviceInfo.ConfigID, err)
+		}
+
+		d := &reflectionDescriptors{
+			files: files,
+		}
+		for _, apiName := range serviceInfo.ApiNames {
+			if desc, err := files.FindDescriptorByName(protoreflect.FullName(apiName)); err == nil {
+				if _, ok := desc.(protoreflect.ServiceDescriptor); ok {
+					d.services = append(d.services, apiName)
+				}
+			}
+		}
+		sort.Strings(d.services)
+		return d, nil
+	}
+	return nil, fmt.Errorf("service config %s has no proto descriptor", serviceInfo.ConfigID)
+}
+
+func (s *grpcReflectionServer) ServerReflectionInfo(stream rpb.ServerReflection_ServerReflectionInfoServer) error {
+	d, err := s.m.reflectionDescriptors()
+	if err != nil {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	// The files already sent on the stream are not sent again.
+	sentFiles := make(map[string]bool)
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		out := &rpb.ServerReflectionResponse{
+			ValidHost:       in.Host,
+			OriginalRequest: in,
+		}
+		var files [][]byte
+		switch req := in.MessageRequest.(type) {
+		case *rpb.ServerReflectionRequest_FileByFilename:
+			var fd protoreflect.FileDescriptor
+			if fd, err = d.files.FindFileByPath(req.FileByFilename); err == nil {
+				files, err = fileWithDependencies(fd, sentFiles)
+			}
+		case *rpb.ServerReflectionRequest_FileContainingSymbol:
+			var desc protoreflect.Descriptor
+			if desc, err = d.files.FindDescriptorByName(protoreflect.FullName(req.FileContainingSymbol)); err == nil {
+				files, err = fileWithDependencies(desc.ParentFile(), sentFiles)
+			}
+		case *rpb.ServerReflectionRequest_FileContainingExtension:
+			var xd protoreflect.ExtensionDescriptor
+			if xd, err = d.findExtension(req.FileContainingExtension.ContainingType, req.FileContainingExtension.ExtensionNumber); err == nil {
+				files, err = fileWithDependencies(xd.ParentFile(), sentFiles)
+			}
+		case *rpb.ServerReflectionRequest_AllExtensionNumbersOfType:
+			var numbers []int32
+			if numbers, err = d.extensionNumbers(req.AllExtensionNumbersOfType); err == nil {
+				out.MessageResponse = &rpb.ServerReflectionResponse_AllExtensionNumbersResponse{
+					AllExtensionNumbersResponse: &rpb.ExtensionNumberResponse{
+						BaseTypeName:    req.AllExtensionNumbersOfType,
+						ExtensionNumber: numbers,
+					},
+				}
+			}
+		case *rpb.ServerReflectionRequest_ListServices:
+			var services []*rpb.ServiceResponse
+			for _, service := range d.services {
+				services = append(services, &rpb.ServiceResponse{Name: service})
+			}
+			out.MessageResponse = &rpb.ServerReflectionResponse_ListServicesResponse{
+				ListServicesResponse: &rpb.ListServiceResponse{
+					Service: services,
+				},
+			}
+		default:
+			return status.Errorf(codes.InvalidArgument, "invalid MessageRequest: %v", in.MessageRequest)
+		}
+
+		if err != nil {
+			out.MessageResponse = &rpb.ServerReflectionResponse_ErrorResponse{
+				ErrorResponse: &rpb.ErrorResponse{
+					ErrorCode:    int32(codes.NotFound),
+					ErrorMessage: err.Error(),
+				},
+			}
+		} else if out.MessageResponse == nil {
+			out.MessageResponse = &rpb.ServerReflectionResponse_FileDescriptorResponse{
+				FileDescriptorResponse: &rpb.FileDescriptorResponse{
+					FileDescriptorProto: files,
+				},
+			}
+		}
+		if err := stream.Send(out); err != nil {
+			return err
+		}
+	}
+}
+
+// findExtension finds the extension of the message type by its number.
+func (d *reflectionDescriptors) findExtension(typeName string, number int32) (protoreflect.ExtensionDescriptor, error) {
+	var found protoreflect.ExtensionDescriptor
+	d.rangeExtensions(typeName, func(xd protoreflect.ExtensionDescriptor) {
+		if int32(xd.Number()) == number {
+			found = xd
+		}
+	})
+	if found == nil {
+		return nil, fmt.Errorf("extension %d of type %s not found", number, typeName)
+	}
+	return found, nil
+}
+
+// extensionNumbers returns the numbers of all the extensions of the message
+// type.
+func (d *reflectionDescriptors) extensionNumbers(typeName string) ([]int32, error) {
+	desc, err := d.files.FindDescriptorByName(protoreflect.FullName(typeName))
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := desc.(protoreflect.MessageDescriptor); !ok {
+		return nil, fmt.Errorf("%s is not a message type", typeName)
+	}
+
+	var numbers []int32
+	d.rangeExtensions(typeName, func(xd protoreflect.ExtensionDescriptor) {
+		numbers = append(numbers, int32(xd.Number()))
+	})
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return numbers, nil
+}
+
+// rangeExtensions calls f for the extensions of the message type declared in
+// any file, including the ones nested in the messages.
+func (d *reflectionDescriptors) rangeExtensions(typeName string, f func(xd protoreflect.ExtensionDescriptor)) {
+	visit := func(extensions protoreflect.ExtensionDescriptors) {
+		for i := 0; i < extensions.Len(); i++ {
+			if xd := extensions.Get(i); string(xd.ContainingMessage().FullName()) == typeName {
+				f(xd)
+			}
+		}
+	}
+	var visitMessages func(messages protoreflect.MessageDescriptors)
+	visitMessages = func(messages protoreflect.MessageDescriptors) {
+		for i := 0; i < messages.Len(); i++ {
+			visit(messages.Get(i).Extensions())
+			visitMessages(messages.Get(i).Messages())
+		}
+	}
+
+	d.files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		visit(fd.Extensions())
+		visitMessages(fd.Messages())
+		return true
+	})
+}
+
+// fileWithDependencies returns the serialized file descriptor followed by its
+// transitive dependencies, skipping the ones already sent.
+func fileWithDependencies(fd protoreflect.FileDescriptor, sentFiles map[string]bool) ([][]byte, error) {
+	var files [][]byte
+	queue := []protoreflect.FileDescriptor{fd}
+	for len(queue) > 0 {
+		fd := queue[0]
+		queue = queue[1:]
+		// The requested file is always sent, the client may have lost it.
+		if sentFiles[fd.Path()] && len(files) > 0 {
+			continue
+		}
+		sentFiles[fd.Path()] = true
+
+		b, err := proto.Marshal(protodesc.ToFileDescriptorProto(fd))
+		if err != nil {
+			return nil, fmt.Errorf("fail to marshal file descriptor %s, %v", fd.Path(), err)
+		}
+		files = append(files, b)
+
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			queue = append(queue, imports.Get(i).FileDescriptor)
+		}
+	}
+	return files, nil
+}
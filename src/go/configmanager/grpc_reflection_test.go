@@ -0,0 +1,229 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/test/bufconn"
+
+	anypb "github.com/golang/protobuf/ptypes/any"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	smpb "google.golang.org/genproto/googleapis/api/servicemanagement/v1"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	descpb "google.golang.org/protobuf/types/descriptorpb"
+)
+
+func reflectionTestDescriptorSet() *descpb.FileDescriptorSet {
+	return &descpb.FileDescriptorSet{
+		File: []*descpb.FileDescriptorProto{
+			{
+				Name:    proto.String("shelf.proto"),
+				Package: proto.String("endpoints.examples.bookstore"),
+				Syntax:  proto.String("proto2"),
+				MessageType: []*descpb.DescriptorProto{
+					{
+						Name: proto.String("Shelf"),
+						ExtensionRange: []*descpb.DescriptorProto_ExtensionRange{
+							{Start: proto.Int32(100), End: proto.Int32(200)},
+						},
+					},
+				},
+			},
+			{
+				Name:       proto.String("bookstore.proto"),
+				Package:    proto.String("endpoints.examples.bookstore"),
+				Syntax:     proto.String("proto2"),
+				Dependency: []string{"shelf.proto"},
+				Extension: []*descpb.FieldDescriptorProto{
+					{
+						Name:     proto.String("owner"),
+						Number:   proto.Int32(100),
+						Label:    descpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						Type:     descpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+						Extendee: proto.String(".endpoints.examples.bookstore.Shelf"),
+					},
+				},
+				Service: []*descpb.ServiceDescriptorProto{
+					{
+						Name: proto.String("Bookstore"),
+						Method: []*descpb.MethodDescriptorProto{
+							{
+								Name:       proto.String("GetShelf"),
+								InputType:  proto.String(".endpoints.examples.bookstore.Shelf"),
+								OutputType: proto.String(".endpoints.examples.bookstore.Shelf"),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestGrpcReflection(t *testing.T) {
+	fds, err := proto.Marshal(reflectionTestDescriptorSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourceFile, err := ptypes.MarshalAny(&smpb.ConfigFile{
+		FileType:     smpb.ConfigFile_FILE_DESCRIPTOR_SET_PROTO,
+		FileContents: fds,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceConfig := revertTestServiceConfig("2021-01-01r0")
+	serviceConfig.SourceInfo = &confpb.SourceInfo{
+		SourceFiles: []*anypb.Any{sourceFile},
+	}
+
+	m := newRevertTestConfigManager()
+	if m.serviceInfo, err = configinfo.NewServiceInfoFromServiceConfig(serviceConfig, serviceConfig.Id, m.envoyConfigOptions); err != nil {
+		t.Fatal(err)
+	}
+
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	m.RegisterGrpcReflection(s)
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The requests share the stream, in order.
+	testCases := []struct {
+		desc              string
+		request           *rpb.ServerReflectionRequest
+		wantServices      []string
+		wantFiles         []string
+		wantExtensionNums []int32
+		wantErrorCode     codes.Code
+	}{
+		{
+			desc: "list services",
+			request: &rpb.ServerReflectionRequest{
+				MessageRequest: &rpb.ServerReflectionRequest_ListServices{},
+			},
+			wantServices: []string{"endpoints.examples.bookstore.Bookstore"},
+		},
+		{
+			desc: "file containing a method with its dependencies",
+			request: &rpb.ServerReflectionRequest{
+				MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{
+					FileContainingSymbol: "endpoints.examples.bookstore.Bookstore.GetShelf",
+				},
+			},
+			wantFiles: []string{"bookstore.proto", "shelf.proto"},
+		},
+		{
+			desc: "dependencies already sent are skipped",
+			request: &rpb.ServerReflectionRequest{
+				MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{
+					FileByFilename: "bookstore.proto",
+				},
+			},
+			wantFiles: []string{"bookstore.proto"},
+		},
+		{
+			desc: "file containing an extension",
+			request: &rpb.ServerReflectionRequest{
+				MessageRequest: &rpb.ServerReflectionRequest_FileContainingExtension{
+					FileContainingExtension: &rpb.ExtensionRequest{
+						ContainingType:  "endpoints.examples.bookstore.Shelf",
+						ExtensionNumber: 100,
+					},
+				},
+			},
+			wantFiles: []string{"bookstore.proto"},
+		},
+		{
+			desc: "all extension numbers of a type",
+			request: &rpb.ServerReflectionRequest{
+				MessageRequest: &rpb.ServerReflectionRequest_AllExtensionNumbersOfType{
+					AllExtensionNumbersOfType: "endpoints.examples.bookstore.Shelf",
+				},
+			},
+			wantExtensionNums: []int32{100},
+		},
+		{
+			desc: "unknown symbol",
+			request: &rpb.ServerReflectionRequest{
+				MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{
+					FileContainingSymbol: "endpoints.examples.bookstore.Library",
+				},
+			},
+			wantErrorCode: codes.NotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if err := stream.Send(tc.request); err != nil {
+				t.Fatal(err)
+			}
+			resp, err := stream.Recv()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var gotServices []string
+			for _, service := range resp.GetListServicesResponse().GetService() {
+				gotServices = append(gotServices, service.GetName())
+			}
+			if !reflect.DeepEqual(gotServices, tc.wantServices) {
+				t.Errorf("got services: %v, want: %v", gotServices, tc.wantServices)
+			}
+
+			var gotFiles []string
+			for _, b := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+				fd := &descpb.FileDescriptorProto{}
+				if err := proto.Unmarshal(b, fd); err != nil {
+					t.Fatal(err)
+				}
+				gotFiles = append(gotFiles, fd.GetName())
+			}
+			if !reflect.DeepEqual(gotFiles, tc.wantFiles) {
+				t.Errorf("got files: %v, want: %v", gotFiles, tc.wantFiles)
+			}
+
+			if got := resp.GetAllExtensionNumbersResponse().GetExtensionNumber(); !reflect.DeepEqual(got, tc.wantExtensionNums) {
+				t.Errorf("got extension numbers: %v, want: %v", got, tc.wantExtensionNums)
+			}
+
+			if got := codes.Code(resp.GetErrorResponse().GetErrorCode()); got != tc.wantErrorCode {
+				t.Errorf("got error code: %v, want: %v", got, tc.wantErrorCode)
+			}
+		})
+	}
+}
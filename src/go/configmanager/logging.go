@@ -0,0 +1,76 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/jsonlog"
+	"github.com/golang/glog"
+)
+
+// The fields of the JSON log entries.
+const (
+	logFieldServiceName = "service_name"
+	logFieldConfigId    = "config_id"
+	logFieldRolloutId   = "rollout_id"
+
+	// How long to wait for the JSON log entries to be written before exiting.
+	logFlushTimeout = time.Second
+)
+
+var (
+	logFormat = flag.String("log_format", "text", `the format of the config manager logs written to stderr, either "text" or "json".
+					In "json", each entry is a JSON object with the severity, the time, the source location and the message, together with
+					the service name, the service config id and the rollout id.`)
+)
+
+// SetupLogging applies --log_format, it must be called right after the flags
+// are parsed.
+func SetupLogging() error {
+	switch *logFormat {
+	case "text":
+		return nil
+	case "json":
+		return jsonlog.RedirectStderr()
+	default:
+		return fmt.Errorf(`invalid log_format %q, must be either "text" or "json"`, *logFormat)
+	}
+}
+
+// setServiceConfigLogFields adds the served service config to the JSON log
+// entries.
+func setServiceConfigLogFields(serviceName, configId string) {
+	jsonlog.SetField(logFieldServiceName, serviceName)
+	jsonlog.SetField(logFieldConfigId, configId)
+}
+
+// FlushLogs writes the pending log entries, it must be called before the
+// config manager exits.
+func FlushLogs() {
+	glog.Flush()
+	jsonlog.Flush(logFlushTimeout)
+}
+
+// Exitf is glog.Exitf, except the JSON log entries are written before the
+// config manager exits.
+func Exitf(format string, args ...interface{}) {
+	glog.ErrorDepth(1, fmt.Sprintf(format, args...))
+	FlushLogs()
+	os.Exit(1)
+}
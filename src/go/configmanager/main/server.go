@@ -27,7 +27,7 @@ import (
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configmanager"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configmanager/flags"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/metadata"
-	"github.com/GoogleCloudPlatform/esp-v2/src/go/tokengenerator"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 	"github.com/golang/glog"
 	"google.golang.org/grpc"
 
@@ -37,6 +37,9 @@ import (
 
 func main() {
 	flag.Parse()
+	if err := configmanager.SetupLogging(); err != nil {
+		configmanager.Exitf("fail to set up logging: %v", err)
+	}
 	opts := flags.EnvoyConfigOptionsFromFlags()
 
 	// Create context that allows cancellation.
@@ -49,15 +52,28 @@ func main() {
 		mf = metadata.NewMetadataFetcher(opts.CommonOptions)
 	}
 
+	if configmanager.ValidationRequested() {
+		ok, err := configmanager.ValidateServices(mf, opts, os.Stdout)
+		if err != nil {
+			configmanager.Exitf("fail to validate services: %v", err)
+		}
+		if !ok {
+			configmanager.FlushLogs()
+			os.Exit(1)
+		}
+		configmanager.FlushLogs()
+		return
+	}
+
 	m, err := configmanager.NewConfigManager(mf, opts)
 	if err != nil {
-		glog.Exitf("fail to initialize config manager: %v", err)
+		configmanager.Exitf("fail to initialize config manager: %v", err)
 	}
-	server := xds.NewServer(ctx, m.Cache(), nil)
+	server := xds.NewServer(ctx, m.Cache(), m.XdsCallbacks())
 	grpcServer := grpc.NewServer()
 	lis, err := net.Listen("unix", opts.AdsNamedPipe)
 	if err != nil {
-		glog.Exitf("Server failed to listen: %v", err)
+		configmanager.Exitf("Server failed to listen: %v", err)
 	}
 
 	// Register Envoy discovery services.
@@ -73,14 +89,16 @@ func main() {
 		sig := <-signalChan
 		glog.Warningf("Server got signal %v, stopping", sig)
 		cancel()
+		m.Close()
 		grpcServer.Stop()
 	}()
 
 	if opts.ServiceAccountKey != "" {
-		// Setup token agent server
-		r := tokengenerator.MakeTokenAgentHandler(opts.ServiceAccountKey)
+		// Setup token agent server. It mints tokens of the service account for
+		// any audience, so only Envoy on the same host can reach it.
+		r := m.TokenAgentHandler()
 		go func() {
-			err := http.ListenAndServe(fmt.Sprintf(":%v", opts.TokenAgentPort), r)
+			err := http.ListenAndServe(fmt.Sprintf("%s:%v", util.LoopbackIPv4Addr, opts.TokenAgentPort), r)
 
 			if err != nil {
 				glog.Errorf("token agent fail to serve: %v", err)
@@ -90,7 +108,33 @@ func main() {
 
 	}
 
+	if opts.EnableGrpcReflection {
+		reflectionLis, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%v", opts.GrpcReflectionPort))
+		if err != nil {
+			configmanager.Exitf("gRPC reflection server failed to listen: %v", err)
+		}
+		reflectionServer := grpc.NewServer()
+		m.RegisterGrpcReflection(reflectionServer)
+		go func() {
+			if err := reflectionServer.Serve(reflectionLis); err != nil {
+				glog.Errorf("gRPC reflection server fail to serve: %v", err)
+			}
+		}()
+	}
+
+	if *configmanager.AdminPort != 0 {
+		r := m.AdminHandler()
+		go func() {
+			err := http.ListenAndServe(fmt.Sprintf("127.0.0.1:%v", *configmanager.AdminPort), r)
+
+			if err != nil {
+				glog.Errorf("config manager admin interface fail to serve: %v", err)
+			}
+		}()
+	}
+
 	if err := grpcServer.Serve(lis); err != nil {
-		glog.Exitf("Server fail to serve: %v", err)
+		configmanager.Exitf("Server fail to serve: %v", err)
 	}
+	configmanager.FlushLogs()
 }
@@ -0,0 +1,125 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/golang/glog"
+
+	scpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/v10/http/service_control"
+)
+
+// maintenanceState is the maintenance mode set via the admin interface.
+type maintenanceState struct {
+	selectors  string
+	retryAfter time.Duration
+}
+
+// SetMaintenance replaces the operations in maintenance mode, in the format of
+// --maintenance_selectors, and regenerates the config of the served service
+// config. An empty selectors takes all the operations out of maintenance mode.
+//
+// The maintenance mode is kept for the following rollouts.
+func (m *ConfigManager) SetMaintenance(selectors string, retryAfter time.Duration) error {
+	for {
+		m.mutex.Lock()
+		serviceConfig := m.curServiceConfig
+		var gcpAttributes *scpb.GcpAttributes
+		if m.serviceInfo != nil {
+			gcpAttributes = m.serviceInfo.GcpAttributes
+		}
+		m.mutex.Unlock()
+		if serviceConfig == nil {
+			return fmt.Errorf("no service config is served yet")
+		}
+
+		// Built before taking the mutex, as it may fetch the jwks_uri of the
+		// providers.
+		opts, _ := m.configOptions()
+		opts.MaintenanceSelectors = selectors
+		opts.MaintenanceRetryAfter = retryAfter
+		serviceInfo, err := configinfo.NewServiceInfoFromServiceConfig(serviceConfig, serviceConfig.Id, opts)
+		if err != nil {
+			return err
+		}
+		serviceInfo.GcpAttributes = gcpAttributes
+
+		applied, err := m.commitMaintenance(serviceConfig.Id, serviceInfo, &maintenanceState{
+			selectors:  selectors,
+			retryAfter: retryAfter,
+		})
+		if err != nil || applied {
+			return err
+		}
+		// Another service config is served meanwhile, set the maintenance mode
+		// on it instead.
+	}
+}
+
+// commitMaintenance serves the ServiceInfo built with the maintenance mode, and
+// saves the maintenance mode along with it. It returns false if the service
+// config of configId is no longer served.
+func (m *ConfigManager) commitMaintenance(configId string, serviceInfo *configinfo.ServiceInfo, state *maintenanceState) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.curConfigId() != configId {
+		return false, nil
+	}
+
+	m.maintenanceMutex.Lock()
+	defer m.maintenanceMutex.Unlock()
+
+	m.maintenanceVersion++
+	snapshot, err := m.makeSnapshot(configId, serviceInfo)
+	if err == nil {
+		err = m.cache.SetSnapshot(context.Background(), m.envoyConfigOptions.Node, *snapshot)
+	}
+	if err != nil {
+		m.maintenanceVersion--
+		return false, fmt.Errorf("fail to apply the maintenance mode, %v", err)
+	}
+
+	m.serviceInfo = serviceInfo
+	m.maintenance = state
+	glog.Infof("set the operations in maintenance mode to %q", state.selectors)
+	return true, nil
+}
+
+// configOptions returns the options to build the service configs with, which
+// carry the current maintenance mode, and the version of the maintenance mode.
+func (m *ConfigManager) configOptions() (options.ConfigGeneratorOptions, int) {
+	m.maintenanceMutex.Lock()
+	defer m.maintenanceMutex.Unlock()
+
+	opts := m.envoyConfigOptions
+	if m.maintenance != nil {
+		opts.MaintenanceSelectors = m.maintenance.selectors
+		opts.MaintenanceRetryAfter = m.maintenance.retryAfter
+	}
+	return opts, m.maintenanceVersion
+}
+
+// Maintenance returns the operations in maintenance mode, in the format of
+// --maintenance_selectors, and the Retry-After of their responses.
+func (m *ConfigManager) Maintenance() (string, time.Duration) {
+	opts, _ := m.configOptions()
+	return opts.MaintenanceSelectors, opts.MaintenanceRetryAfter
+}
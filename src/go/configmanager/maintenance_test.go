@@ -0,0 +1,201 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+
+	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+const maintenanceTestSelector = "endpoints.examples.bookstore.Bookstore.ListShelves"
+
+func maintenanceTestServiceConfig() *confpb.Service {
+	return &confpb.Service{
+		Name: "bookstore.endpoints.project123.cloud.goog",
+		Id:   "2021-01-01r0",
+		Apis: []*apipb.Api{
+			{
+				Name: "endpoints.examples.bookstore.Bookstore",
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: maintenanceTestSelector,
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/shelves",
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestSetMaintenance(t *testing.T) {
+	m := newRevertTestConfigManager()
+
+	wantError := "no service config is served yet"
+	if err := m.SetMaintenance("*", time.Minute); err == nil || err.Error() != wantError {
+		t.Errorf("got error: %v, want: %s", err, wantError)
+	}
+
+	if err := m.applyServiceConfig(maintenanceTestServiceConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	wantError = "selector (endpoints.examples.bookstore.Bookstore.Unknown) was not defined in the API"
+	if err := m.SetMaintenance("endpoints.examples.bookstore.Bookstore.Unknown", time.Minute); err == nil || !strings.Contains(err.Error(), wantError) {
+		t.Errorf("got error: %v, want: %s", err, wantError)
+	}
+	if selectors, _ := m.Maintenance(); selectors != "" {
+		t.Errorf("got maintenance selectors: %q after a failed change, want none", selectors)
+	}
+
+	for i, tc := range []struct {
+		selectors         string
+		wantInMaintenance bool
+	}{
+		{
+			selectors:         maintenanceTestSelector,
+			wantInMaintenance: true,
+		},
+		{
+			selectors: "",
+		},
+	} {
+		if err := m.SetMaintenance(tc.selectors, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if got := m.serviceInfo.Methods[maintenanceTestSelector].InMaintenance; got != tc.wantInMaintenance {
+			t.Errorf("got InMaintenance: %v, want: %v", got, tc.wantInMaintenance)
+		}
+
+		// The listeners are pushed again for the same service config.
+		snapshot, err := m.cache.GetSnapshot(m.envoyConfigOptions.Node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantVersion := fmt.Sprintf("2021-01-01r0-maintenance%d", i+1)
+		if got := snapshot.GetVersion(resource.ListenerType); got != wantVersion {
+			t.Errorf("got listener version: %s, want: %s", got, wantVersion)
+		}
+		if got := servedVersion(t, m); got != "2021-01-01r0" {
+			t.Errorf("got served snapshot version: %s, want: 2021-01-01r0", got)
+		}
+	}
+}
+
+func TestSetMaintenanceConcurrentWithRollouts(t *testing.T) {
+	m := newRevertTestConfigManager()
+	s := httptest.NewServer(m.AdminHandler())
+	defer s.Close()
+
+	if err := m.applyServiceConfig(maintenanceTestServiceConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The rollouts keep running until the maintenance mode is last changed.
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 1; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			serviceConfig := maintenanceTestServiceConfig()
+			serviceConfig.Id = fmt.Sprintf("2021-01-01r%d", i)
+			if err := m.applyServiceConfig(serviceConfig); err != nil {
+				t.Errorf("fail to apply service config %s: %v", serviceConfig.Id, err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			method, body := "PUT", `{"selectors": "*", "retry_after": "10m"}`
+			if i%2 == 1 {
+				method, body = "DELETE", ""
+			}
+			req, err := http.NewRequest(method, s.URL+"/maintenance", strings.NewReader(body))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("got status code: %v for %s /maintenance, want: %v", resp.StatusCode, method, http.StatusOK)
+			}
+		}
+	}()
+	wg.Wait()
+
+	// The last change cleared the maintenance mode, no rollout may bring it back.
+	if selectors, _ := m.Maintenance(); selectors != "" {
+		t.Errorf("got maintenance selectors: %q, want none", selectors)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.serviceInfo.Methods[maintenanceTestSelector].InMaintenance {
+		t.Errorf("got the served operation in maintenance mode, want it cleared")
+	}
+}
+
+func TestRevertAcrossMaintenanceChange(t *testing.T) {
+	m := newRevertTestConfigManager()
+	for _, configId := range []string{"2021-01-01r0", "2021-01-01r1"} {
+		serviceConfig := maintenanceTestServiceConfig()
+		serviceConfig.Id = configId
+		if err := m.applyServiceConfig(serviceConfig); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.SetMaintenance("*", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	wantError := "the maintenance mode has changed since service config 2021-01-01r0 was served, it cannot be reverted to"
+	if _, err := m.Revert(); err == nil || err.Error() != wantError {
+		t.Errorf("got error: %v, want: %s", err, wantError)
+	}
+	if got := m.servedConfigId(); got != "2021-01-01r1" {
+		t.Errorf("got served service config: %s, want: 2021-01-01r1", got)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestProbeBackendProtocol(t *testing.T) {
+	h2cServer := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), &http2.Server{}))
+	defer h2cServer.Close()
+
+	testData := []struct {
+		desc           string
+		backendAddress string
+		wantProtocol   string
+	}{
+		{
+			desc:           "h2c backend is detected",
+			backendAddress: h2cServer.URL,
+			wantProtocol:   "h2",
+		},
+		{
+			desc:           "grpc backend is not probed",
+			backendAddress: strings.Replace(h2cServer.URL, "http://", "grpc://", 1),
+		},
+		{
+			desc:           "unreachable backend falls back to the default",
+			backendAddress: "http://127.0.0.1:1",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.BackendAddress = tc.backendAddress
+
+			if got := probeBackendProtocol(opts); got != tc.wantProtocol {
+				t.Errorf("got protocol: %q, want: %q", got, tc.wantProtocol)
+			}
+		})
+	}
+}
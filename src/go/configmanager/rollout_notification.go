@@ -0,0 +1,50 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+
+	sc "github.com/GoogleCloudPlatform/esp-v2/src/go/serviceconfig"
+)
+
+var (
+	rolloutPubsubSubscription = flag.String("rollout_pubsub_subscription", "", `the Pub/Sub subscription notified of the new rollouts of the managed rollout strategy, in the format of projects/PROJECT/subscriptions/SUBSCRIPTION.
+					Any message makes the config manager check the latest rollout right away instead of at the next --check_rollout_interval, which is kept as a fallback.
+					Pub/Sub delivers each message to only one puller of a subscription, so every instance must pull its own subscription of the topic, a shared subscription only notifies one of them.
+					For example, subscribe to a topic of a log sink of the CreateServiceRollout audit logs of the service.`)
+	pubsubUrl = flag.String("pubsub_url", "https://pubsub.googleapis.com", `url of the Pub/Sub server to pull the rollout notifications from.`)
+)
+
+var rolloutSubscriptionRegex = regexp.MustCompile(`^projects/[^/]+/subscriptions/[^/]+$`)
+
+// startRolloutNotifier applies the latest rollout whenever a rollout
+// notification is received, if --rollout_pubsub_subscription is set.
+func (m *ConfigManager) startRolloutNotifier(client *http.Client, accessToken util.GetAccessTokenFunc) error {
+	if *rolloutPubsubSubscription == "" {
+		return nil
+	}
+	if !rolloutSubscriptionRegex.MatchString(*rolloutPubsubSubscription) {
+		return fmt.Errorf("flag --rollout_pubsub_subscription must be in the format of projects/PROJECT/subscriptions/SUBSCRIPTION, got %q", *rolloutPubsubSubscription)
+	}
+	notifier := sc.NewRolloutNotifier(client, *pubsubUrl, *rolloutPubsubSubscription, accessToken)
+	notifier.Start(m.applyLatestRollout)
+	return nil
+}
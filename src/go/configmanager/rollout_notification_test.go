@@ -0,0 +1,62 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartRolloutNotifier(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		subscription string
+		wantError    string
+	}{
+		{
+			desc: "no subscription",
+		},
+		{
+			desc:         "topic instead of subscription",
+			subscription: "projects/test-project/topics/rollouts",
+			wantError:    `flag --rollout_pubsub_subscription must be in the format of projects/PROJECT/subscriptions/SUBSCRIPTION, got "projects/test-project/topics/rollouts"`,
+		},
+		{
+			desc:         "subscription without project",
+			subscription: "rollouts",
+			wantError:    "flag --rollout_pubsub_subscription must be in the format of projects/PROJECT/subscriptions/SUBSCRIPTION",
+		},
+	}
+
+	accessToken := func() (string, time.Duration, error) { return "access-token", time.Minute, nil }
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			setFlag(t, "rollout_pubsub_subscription", tc.subscription)
+			m := &ConfigManager{}
+			err := m.startRolloutNotifier(&http.Client{}, accessToken)
+			if tc.wantError == "" {
+				if err != nil {
+					t.Errorf("got error: %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("got error: %v, want error: %s", err, tc.wantError)
+			}
+		})
+	}
+}
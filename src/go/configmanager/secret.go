@@ -0,0 +1,139 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/metadata"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/secretmanager"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/tokengenerator"
+	"github.com/golang/glog"
+)
+
+// initSecrets fetches the Secret Manager secrets referenced by
+// --service_account_key and --ssl_server_cert_path, and keeps refreshing them.
+// The secrets referenced by --backend_credentials are fetched each time the
+// credentials are refreshed.
+//
+// Secret Manager is accessed with the access token from the metadata server,
+// or from the --service_account_key file with --non_gcp.
+//
+// The secrets are only kept in memory, they are never written to disk.
+func (m *ConfigManager) initSecrets(mf *metadata.MetadataFetcher) error {
+	opts := m.envoyConfigOptions
+	keyIsSecret := secretmanager.IsSecretURI(opts.ServiceAccountKey)
+	certIsSecret := secretmanager.IsSecretURI(opts.SslServerCertPath)
+	credentialsAreSecrets, err := backendCredentialsUseSecrets(opts.BackendCredentials)
+	if err != nil {
+		return err
+	}
+	if !keyIsSecret && !certIsSecret && !credentialsAreSecrets {
+		return nil
+	}
+
+	accessToken := m.serviceAccountKeyToken
+	if mf != nil {
+		accessToken = mf.FetchAccessToken
+	} else if keyIsSecret {
+		return fmt.Errorf("flag --service_account_key with a Secret Manager uri is not supported with flag --non_gcp, the key file is needed to access Secret Manager")
+	} else if opts.ServiceAccountKey == "" {
+		return fmt.Errorf("flags with Secret Manager uris require flag --service_account_key with flag --non_gcp, to access Secret Manager")
+	}
+	if certIsSecret && !opts.SslServerCertSds {
+		return fmt.Errorf("flag --ssl_server_cert_path with a Secret Manager uri requires flag --ssl_server_cert_sds")
+	}
+
+	client, err := httpsClient(opts)
+	if err != nil {
+		return fmt.Errorf("fail to init httpsClient: %v", err)
+	}
+	m.secretFetcher = secretmanager.NewSecretFetcher(client, opts.SecretManagerURL, accessToken)
+
+	if keyIsSecret {
+		if m.serviceAccountKeySecret, err = m.secretFetcher.NewSecret(opts.ServiceAccountKey); err != nil {
+			return err
+		}
+		// The access tokens are generated from the latest key on demand.
+		m.serviceAccountKeySecret.SetRefreshTimer(opts.SecretRefreshInterval, nil)
+	}
+
+	if certIsSecret {
+		if m.serverCertSource, err = m.secretFetcher.NewSecret(opts.SslServerCertPath); err != nil {
+			return err
+		}
+		m.serverCertSource.SetRefreshTimer(opts.SecretRefreshInterval, func() {
+			if _, err := m.reloadServerCert(); err != nil {
+				glog.Errorf("error occurred when reloading the server certificate, %v", err)
+			}
+		})
+	}
+	return nil
+}
+
+// backendCredentialsUseSecrets returns whether any credential of
+// --backend_credentials reads its key or client secret from Secret Manager.
+func backendCredentialsUseSecrets(backendCredentials string) (bool, error) {
+	credentials, err := configinfo.ParseBackendCredentials(backendCredentials)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range credentials {
+		if secretmanager.IsSecretURI(c.KeyFile) || secretmanager.IsSecretURI(c.ClientSecretFile) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// readSecretOrFile reads the payload of the Secret Manager secret if path is
+// a sm:// uri, or the content of the file otherwise.
+func (m *ConfigManager) readSecretOrFile(path string) ([]byte, error) {
+	if !secretmanager.IsSecretURI(path) {
+		return ioutil.ReadFile(path)
+	}
+	if m.secretFetcher == nil {
+		return nil, fmt.Errorf("Secret Manager is not initialized to fetch secret %s", path)
+	}
+	return m.secretFetcher.FetchSecret(path)
+}
+
+// serviceAccountKeyToken generates the access token from the service account
+// key in --service_account_key.
+func (m *ConfigManager) serviceAccountKeyToken() (string, time.Duration, error) {
+	if m.serviceAccountKeySecret != nil {
+		return tokengenerator.GenerateAccessTokenFromData(m.serviceAccountKeySecret.Data())
+	}
+	return tokengenerator.GenerateAccessTokenFromFile(m.envoyConfigOptions.ServiceAccountKey)
+}
+
+// serviceAccountKeyIdToken generates the ID token of the audience from the
+// service account key in --service_account_key.
+func (m *ConfigManager) serviceAccountKeyIdToken(audience string) (string, time.Duration, error) {
+	if m.serviceAccountKeySecret != nil {
+		return tokengenerator.GenerateIdTokenFromData(m.serviceAccountKeySecret.Data(), audience)
+	}
+	return tokengenerator.GenerateIdTokenFromFile(m.envoyConfigOptions.ServiceAccountKey, audience)
+}
+
+// TokenAgentHandler creates the token agent handler providing Envoy with the
+// access tokens and ID tokens generated from --service_account_key.
+func (m *ConfigManager) TokenAgentHandler() http.Handler {
+	return tokengenerator.MakeTokenAgentHandlerFromFunc(m.serviceAccountKeyToken, m.serviceAccountKeyIdToken)
+}
@@ -0,0 +1,169 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+
+	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	tlspb "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+)
+
+// readServerCertFiles reads the downstream certificate and key under
+// sslServerCertPath.
+func readServerCertFiles(sslServerCertPath string) ([]byte, []byte, error) {
+	certFile, keyFile := util.DownstreamSslCertFiles(sslServerCertPath)
+	cert, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fail to read server certificate %s: %v", certFile, err)
+	}
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fail to read server private key %s: %v", keyFile, err)
+	}
+	return cert, key, nil
+}
+
+// splitServerCertPem splits the PEM encoded certificate chain and private key
+// stored together in a Secret Manager secret.
+func splitServerCertPem(data []byte) ([]byte, []byte, error) {
+	var cert, key []byte
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		switch {
+		case block.Type == "CERTIFICATE":
+			cert = append(cert, pem.EncodeToMemory(block)...)
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			key = pem.EncodeToMemory(block)
+		}
+	}
+
+	if cert == nil {
+		return nil, nil, fmt.Errorf("server certificate secret has no PEM encoded certificate")
+	}
+	if key == nil {
+		return nil, nil, fmt.Errorf("server certificate secret has no PEM encoded private key")
+	}
+	return cert, key, nil
+}
+
+// makeServerCertSecret makes the SDS secret of the downstream certificate and key.
+func makeServerCertSecret(cert, key []byte) *tlspb.Secret {
+	return &tlspb.Secret{
+		Name: util.ServerCertSecretName,
+		Type: &tlspb.Secret_TlsCertificate{
+			TlsCertificate: &tlspb.TlsCertificate{
+				CertificateChain: &corepb.DataSource{
+					Specifier: &corepb.DataSource_InlineBytes{
+						InlineBytes: cert,
+					},
+				},
+				PrivateKey: &corepb.DataSource{
+					Specifier: &corepb.DataSource_InlineBytes{
+						InlineBytes: key,
+					},
+				},
+			},
+		},
+	}
+}
+
+// loadServerCert loads the downstream certificate and key, either from the
+// files or from the Secret Manager secret referenced by --ssl_server_cert_path.
+func (m *ConfigManager) loadServerCert() (*tlspb.Secret, error) {
+	var cert, key []byte
+	var err error
+	if m.serverCertSource != nil {
+		cert, key, err = splitServerCertPem(m.serverCertSource.Data())
+	} else {
+		cert, key, err = readServerCertFiles(m.envoyConfigOptions.SslServerCertPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return makeServerCertSecret(cert, key), nil
+}
+
+// reloadServerCert re-reads the downstream certificate and pushes a new
+// snapshot if it has changed. It returns whether the certificate was updated.
+// The certificate is read before taking the mutex, so the rollouts are not
+// blocked on it.
+func (m *ConfigManager) reloadServerCert() (bool, error) {
+	secret, err := m.loadServerCert()
+	if err != nil {
+		return false, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed || proto.Equal(secret, m.serverCertSecret) {
+		return false, nil
+	}
+	m.serverCertSecret = secret
+	m.serverCertVersion++
+
+	// The first certificate is served with the first service config.
+	if m.serviceInfo == nil {
+		return true, nil
+	}
+
+	snapshot, err := m.makeSnapshot(m.curConfigId(), m.serviceInfo)
+	if err != nil {
+		return false, fmt.Errorf("fail to make a snapshot, %s", err)
+	}
+	return true, m.cache.SetSnapshot(context.Background(), m.envoyConfigOptions.Node, *snapshot)
+}
+
+// watchServerCert periodically checks the downstream certificate files and
+// delivers the rotated certificate to Envoy.
+func (m *ConfigManager) watchServerCert(interval time.Duration) {
+	done := make(chan struct{})
+	m.serverCertWatchDone = done
+	go func() {
+		glog.Infof("start checking the server certificate under %s every %v", m.envoyConfigOptions.SslServerCertPath, interval)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			updated, err := m.reloadServerCert()
+			if err != nil {
+				glog.Errorf("error occurred when reloading the server certificate, %v", err)
+				continue
+			}
+			if updated {
+				glog.Infof("server certificate under %s is rotated", m.envoyConfigOptions.SslServerCertPath)
+			}
+		}
+	}()
+}
@@ -0,0 +1,277 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/metadata"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/secretmanager"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/golang/protobuf/proto"
+
+	tlspb "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	secretpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestReloadServerCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server_cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeCert := func(cert, key string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, "server.crt"), []byte(cert), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "server.key"), []byte(key), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.SslServerCertPath = dir
+	opts.SslServerCertSds = true
+	opts.DisableTracing = true
+
+	m := &ConfigManager{
+		envoyConfigOptions: opts,
+	}
+	m.cache = cache.NewSnapshotCache(true, m, m)
+
+	if _, err := m.reloadServerCert(); err == nil {
+		t.Fatalf("want error for missing certificate files, got nil")
+	}
+
+	writeCert("cert-1", "key-1")
+	if updated, err := m.reloadServerCert(); err != nil || !updated {
+		t.Fatalf("want the first certificate to be loaded, got updated: %v, err: %v", updated, err)
+	}
+
+	serviceConfig := &confpb.Service{
+		Name: "bookstore.endpoints.project123.cloud.goog",
+		Id:   "2021-01-01r0",
+		Apis: []*apipb.Api{
+			{
+				Name: "endpoints.examples.bookstore.Bookstore",
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+	}
+	if err := m.applyServiceConfig(serviceConfig); err != nil {
+		t.Fatal(err)
+	}
+	firstVersion := getSecretVersion(t, m)
+	if got := getCertificateChain(t, m); got != "cert-1" {
+		t.Errorf("got certificate chain: %s, want: cert-1", got)
+	}
+
+	if updated, err := m.reloadServerCert(); err != nil || updated {
+		t.Fatalf("want unchanged certificate to be skipped, got updated: %v, err: %v", updated, err)
+	}
+
+	writeCert("cert-2", "key-2")
+	if updated, err := m.reloadServerCert(); err != nil || !updated {
+		t.Fatalf("want the rotated certificate to be loaded, got updated: %v, err: %v", updated, err)
+	}
+	if got := getCertificateChain(t, m); got != "cert-2" {
+		t.Errorf("got certificate chain: %s, want: cert-2", got)
+	}
+	if got := getSecretVersion(t, m); got == firstVersion {
+		t.Errorf("want the secret version to change after rotation, got: %s", got)
+	}
+}
+
+func getSecretVersion(t *testing.T, m *ConfigManager) string {
+	snapshot, err := m.cache.GetSnapshot(m.envoyConfigOptions.Node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snapshot.Resources[types.Secret].Version
+}
+
+func getCertificateChain(t *testing.T, m *ConfigManager) string {
+	snapshot, err := m.cache.GetSnapshot(m.envoyConfigOptions.Node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, ok := snapshot.Resources[types.Secret].Items[util.ServerCertSecretName].Resource.(*tlspb.Secret)
+	if !ok {
+		t.Fatalf("secret %s is not found in the snapshot", util.ServerCertSecretName)
+	}
+	return string(secret.GetTlsCertificate().GetCertificateChain().GetInlineBytes())
+}
+
+func TestCloseStopsWatchingServerCert(t *testing.T) {
+	m := &ConfigManager{
+		envoyConfigOptions: options.DefaultConfigGeneratorOptions(),
+	}
+	m.watchServerCert(time.Hour)
+	done := m.serverCertWatchDone
+
+	m.Close()
+	select {
+	case <-done:
+	default:
+		t.Errorf("want the server certificate watch to be stopped on close")
+	}
+}
+
+func TestReloadServerCertFromSecret(t *testing.T) {
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("cert-1")})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte("key-1")})
+	payload := append(append([]byte{}, certPem...), keyPem...)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := proto.Marshal(&secretpb.AccessSecretVersionResponse{
+			Payload: &secretpb.SecretPayload{
+				Data: payload,
+			},
+		})
+		if err != nil {
+			t.Fatalf("fail to generate access secret response: %v", err)
+		}
+		_, _ = w.Write(resp)
+	}))
+	defer s.Close()
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.SslServerCertPath = "sm://project-1/server-cert"
+	opts.SslServerCertSds = true
+
+	m := &ConfigManager{
+		envoyConfigOptions: opts,
+	}
+	m.cache = cache.NewSnapshotCache(true, m, m)
+
+	fetcher := secretmanager.NewSecretFetcher(&http.Client{}, s.URL, func() (string, time.Duration, error) {
+		return "ya29.token", time.Hour, nil
+	})
+	var err error
+	if m.serverCertSource, err = fetcher.NewSecret(opts.SslServerCertPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if updated, err := m.reloadServerCert(); err != nil || !updated {
+		t.Fatalf("want the certificate from the secret to be loaded, got updated: %v, err: %v", updated, err)
+	}
+	tlsCert := m.serverCertSecret.GetTlsCertificate()
+	if got := tlsCert.GetCertificateChain().GetInlineBytes(); string(got) != string(certPem) {
+		t.Errorf("got certificate chain: %s, want: %s", got, certPem)
+	}
+	if got := tlsCert.GetPrivateKey().GetInlineBytes(); string(got) != string(keyPem) {
+		t.Errorf("got private key: %s, want: %s", got, keyPem)
+	}
+
+	// A secret without the private key is rejected, the loaded certificate is kept.
+	payload = certPem
+	if _, err := m.serverCertSource.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	wantError := "server certificate secret has no PEM encoded private key"
+	if _, err := m.reloadServerCert(); err == nil || err.Error() != wantError {
+		t.Errorf("got error: %v, want: %s", err, wantError)
+	}
+	if got := m.serverCertSecret.GetTlsCertificate().GetPrivateKey().GetInlineBytes(); string(got) != string(keyPem) {
+		t.Errorf("got private key: %s, want: %s", got, keyPem)
+	}
+}
+
+func TestInitSecrets(t *testing.T) {
+	testCases := []struct {
+		desc               string
+		serviceAccountKey  string
+		sslServerCertPath  string
+		sslServerCertSds   bool
+		backendCredentials string
+		nonGcp             bool
+		wantError          string
+	}{
+		{
+			desc:              "No secrets",
+			serviceAccountKey: "/etc/esp/key.json",
+			sslServerCertPath: "/etc/esp/ssl",
+			nonGcp:            true,
+		},
+		{
+			desc:              "Service account key secret is not supported on non-gcp deployments",
+			serviceAccountKey: "sm://project-1/sa-key",
+			nonGcp:            true,
+			wantError:         "flag --service_account_key with a Secret Manager uri is not supported with flag --non_gcp, the key file is needed to access Secret Manager",
+		},
+		{
+			desc:              "Secrets on non-gcp deployments require the service account key",
+			sslServerCertPath: "sm://project-1/server-cert",
+			sslServerCertSds:  true,
+			nonGcp:            true,
+			wantError:         "flags with Secret Manager uris require flag --service_account_key with flag --non_gcp, to access Secret Manager",
+		},
+		{
+			desc:               "Backend credential secrets on non-gcp deployments require the service account key",
+			backendCredentials: "endpoints.examples.bookstore.Bookstore.ListShelves=type=api_key,key_file=sm://project-1/backend-key",
+			nonGcp:             true,
+			wantError:          "flags with Secret Manager uris require flag --service_account_key with flag --non_gcp, to access Secret Manager",
+		},
+		{
+			desc:              "Server certificate secret requires sds",
+			sslServerCertPath: "sm://project-1/server-cert",
+			wantError:         "flag --ssl_server_cert_path with a Secret Manager uri requires flag --ssl_server_cert_sds",
+		},
+	}
+
+	for _, tc := range testCases {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.ServiceAccountKey = tc.serviceAccountKey
+		opts.SslServerCertPath = tc.sslServerCertPath
+		opts.SslServerCertSds = tc.sslServerCertSds
+		opts.BackendCredentials = tc.backendCredentials
+
+		var mf *metadata.MetadataFetcher
+		if !tc.nonGcp {
+			mf = metadata.NewMockMetadataFetcher("http://127.0.0.1:0", time.Now())
+		}
+
+		m := &ConfigManager{
+			envoyConfigOptions: opts,
+		}
+		err := m.initSecrets(mf)
+		if tc.wantError == "" {
+			if err != nil {
+				t.Errorf("Test (%s): got error: %v, want no error", tc.desc, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tc.wantError {
+			t.Errorf("Test (%s): got error: %v, want error: %s", tc.desc, err, tc.wantError)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/golang/glog"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+)
+
+// servedConfig is a service config together with the snapshot generated from it.
+type servedConfig struct {
+	serviceConfig *confpb.Service
+	serviceInfo   *configinfo.ServiceInfo
+	snapshot      cache.Snapshot
+}
+
+// servedConfig returns the config currently served to Envoy, or nil if no
+// config has been served yet. It must be called with the mutex held.
+func (m *ConfigManager) servedConfig() *servedConfig {
+	if m.curServiceConfig == nil || m.serviceInfo == nil {
+		return nil
+	}
+	snapshot, err := m.cache.GetSnapshot(m.envoyConfigOptions.Node)
+	if err != nil {
+		return nil
+	}
+	return &servedConfig{
+		serviceConfig: m.curServiceConfig,
+		serviceInfo:   m.serviceInfo,
+		snapshot:      snapshot,
+	}
+}
+
+// Revert swaps back to the previously served config, without fetching it from
+// Service Management. The config it reverted from becomes the new standby, so
+// calling Revert again undoes the revert. It returns the reverted config id.
+//
+// A managed rollout still applies the next new rollout as usual.
+func (m *ConfigManager) Revert() (string, error) {
+	reverted, err := m.revert()
+	if err != nil {
+		return "", err
+	}
+	// The reverted config replaces the last-known-good config once Envoy
+	// ACKs it again.
+	m.saveServiceConfigOnAck(reverted)
+	return reverted.GetId(), nil
+}
+
+func (m *ConfigManager) revert() (*confpb.Service, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.standby == nil {
+		return nil, fmt.Errorf("no previous service config to revert to")
+	}
+	// The served ServiceInfo is built with the current maintenance mode.
+	cur, standby := m.serviceInfo.Options, m.standby.serviceInfo.Options
+	if standby.MaintenanceSelectors != cur.MaintenanceSelectors || standby.MaintenanceRetryAfter != cur.MaintenanceRetryAfter {
+		return nil, fmt.Errorf("the maintenance mode has changed since service config %s was served, it cannot be reverted to", m.standby.serviceConfig.Id)
+	}
+	prev := m.servedConfig()
+
+	snapshot := m.standby.snapshot
+	if m.serverCertSecret != nil {
+		// The certificate may have been rotated since the standby was served.
+		snapshot.Resources[types.Secret] = cache.NewResources(
+			fmt.Sprintf("%s-cert%d", m.standby.serviceConfig.Id, m.serverCertVersion),
+			[]types.Resource{m.serverCertSecret})
+	}
+	if err := m.cache.SetSnapshot(context.Background(), m.envoyConfigOptions.Node, snapshot); err != nil {
+		return nil, fmt.Errorf("fail to revert to service config %s, %v", m.standby.serviceConfig.Id, err)
+	}
+
+	m.curServiceConfig = m.standby.serviceConfig
+	m.serviceInfo = m.standby.serviceInfo
+	m.standby = prev
+	m.unconfirmedServiceConfig = nil
+	setServiceConfigLogFields(m.curServiceConfig.GetName(), m.curConfigId())
+	glog.Infof("reverted to the previous service config %s", m.curConfigId())
+	return m.curServiceConfig, nil
+}
@@ -0,0 +1,192 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/golang/protobuf/proto"
+
+	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func newRevertTestConfigManager() *ConfigManager {
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.DisableTracing = true
+	m := &ConfigManager{
+		envoyConfigOptions: opts,
+	}
+	m.cache = cache.NewSnapshotCache(true, m, m)
+	return m
+}
+
+func revertTestServiceConfig(configId string) *confpb.Service {
+	return &confpb.Service{
+		Name: "bookstore.endpoints.project123.cloud.goog",
+		Id:   configId,
+		Apis: []*apipb.Api{
+			{
+				Name: "endpoints.examples.bookstore.Bookstore",
+			},
+		},
+	}
+}
+
+func servedVersion(t *testing.T, m *ConfigManager) string {
+	snapshot, err := m.cache.GetSnapshot(m.envoyConfigOptions.Node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snapshot.GetVersion(resource.ClusterType)
+}
+
+func TestRevert(t *testing.T) {
+	m := newRevertTestConfigManager()
+
+	wantError := "no previous service config to revert to"
+	if _, err := m.Revert(); err == nil || err.Error() != wantError {
+		t.Errorf("got error: %v, want: %s", err, wantError)
+	}
+
+	if err := m.applyServiceConfig(revertTestServiceConfig("2021-01-01r0")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Revert(); err == nil || err.Error() != wantError {
+		t.Errorf("got error: %v, want: %s", err, wantError)
+	}
+
+	if err := m.applyServiceConfig(revertTestServiceConfig("2021-01-02r0")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reverting twice swaps back and forth between the last two configs.
+	for _, want := range []string{"2021-01-01r0", "2021-01-02r0"} {
+		got, err := m.Revert()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("got reverted config id: %s, want: %s", got, want)
+		}
+		if got := m.curConfigId(); got != want {
+			t.Errorf("got current config id: %s, want: %s", got, want)
+		}
+		if got := m.serviceInfo.ConfigID; got != want {
+			t.Errorf("got ServiceInfo config id: %s, want: %s", got, want)
+		}
+		if got := servedVersion(t, m); got != want {
+			t.Errorf("got served snapshot version: %s, want: %s", got, want)
+		}
+	}
+}
+
+func TestRevertPersistsServiceConfig(t *testing.T) {
+	setFlag(t, "service_config_cache_path", filepath.Join(t.TempDir(), "service_config.json"))
+	m := newRevertTestConfigManager()
+	m.serviceName = "bookstore.endpoints.project123.cloud.goog"
+	m.adoption = newAdoptionTracker()
+
+	cachedConfigId := func() string {
+		serviceConfig, _, err := loadServiceConfigCache(*serviceConfigCachePath, m.serviceName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return serviceConfig.GetId()
+	}
+
+	for _, configId := range []string{"2021-01-01r0", "2021-01-02r0"} {
+		if err := m.applyFetchedServiceConfig(revertTestServiceConfig(configId)); err != nil {
+			t.Fatal(err)
+		}
+		ackListeners(m, configId)
+		if got := cachedConfigId(); got != configId {
+			t.Errorf("got cached config id: %s, want: %s", got, configId)
+		}
+	}
+
+	// The reverted config is persisted once it is ACKed again.
+	if _, err := m.Revert(); err != nil {
+		t.Fatal(err)
+	}
+	if got := cachedConfigId(); got != "2021-01-02r0" {
+		t.Errorf("got cached config id: %s before the ACK, want: 2021-01-02r0", got)
+	}
+	ackListeners(m, "2021-01-01r0")
+	if got := cachedConfigId(); got != "2021-01-01r0" {
+		t.Errorf("got cached config id: %s after the revert, want: 2021-01-01r0", got)
+	}
+
+	// A config not ACKed is not persisted.
+	if err := m.applyFetchedServiceConfig(revertTestServiceConfig("2021-01-03r0")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Revert(); err != nil {
+		t.Fatal(err)
+	}
+	ackListeners(m, "2021-01-03r0")
+	if got := cachedConfigId(); got != "2021-01-01r0" {
+		t.Errorf("got cached config id: %s, want: 2021-01-01r0", got)
+	}
+}
+
+func TestFailedServiceConfigIsNotApplied(t *testing.T) {
+	m := newRevertTestConfigManager()
+	served := revertTestServiceConfig("2021-01-01r0")
+	served.Apis[0].Methods = []*apipb.Method{
+		{
+			Name: "ListShelves",
+		},
+	}
+	served.Http = &annotationspb.Http{
+		Rules: []*annotationspb.HttpRule{
+			{
+				Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+				Pattern: &annotationspb.HttpRule_Get{
+					Get: "/v1/shelves",
+				},
+			},
+		},
+	}
+	if err := m.applyServiceConfig(served); err != nil {
+		t.Fatal(err)
+	}
+
+	// The credential is never fetched, so the snapshot fails to be made.
+	m.envoyConfigOptions.BackendCredentials = "endpoints.examples.bookstore.Bookstore.ListShelves=type=api_key,key_file=/etc/key"
+	failed := proto.Clone(served).(*confpb.Service)
+	failed.Id = "2021-01-02r0"
+	if err := m.applyServiceConfig(failed); err == nil {
+		t.Fatal("got no error, want the snapshot failed to be made")
+	}
+
+	if got := m.servedConfigId(); got != "2021-01-01r0" {
+		t.Errorf("got current config id: %s, want: 2021-01-01r0", got)
+	}
+	if got := m.serviceInfo.ConfigID; got != "2021-01-01r0" {
+		t.Errorf("got ServiceInfo config id: %s, want: 2021-01-01r0", got)
+	}
+	if got := servedVersion(t, m); got != "2021-01-01r0" {
+		t.Errorf("got served snapshot version: %s, want: 2021-01-01r0", got)
+	}
+	if m.standby != nil {
+		t.Errorf("got standby config %s, want none", m.standby.serviceConfig.Id)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/metadata"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+
+	gen "github.com/GoogleCloudPlatform/esp-v2/src/go/configgenerator"
+	sc "github.com/GoogleCloudPlatform/esp-v2/src/go/serviceconfig"
+)
+
+var (
+	validateServices = flag.String("validate_services", "", `comma separated services to validate instead of serving, each as "SERVICE" for the config of its latest rollout or "SERVICE=CONFIG_ID".
+	The configs of all of them are fetched and generated in parallel with the other flags, a JSON report of the errors and warnings per service is written to stdout, and the config manager exits with 1 if any service fails.`)
+	validateServicesFile = flag.String("validate_services_file", "", `the file of the services to validate, one per line in the format of --validate_services. Empty lines and lines starting with # are ignored.`)
+	validateParallelism  = flag.Int("validate_parallelism", 8, `the number of services validated in parallel.`)
+)
+
+// ServiceValidation is the validation result of a service in the report.
+type ServiceValidation struct {
+	Service  string   `json:"service"`
+	ConfigId string   `json:"config_id,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ValidationReport is the machine-readable report of the bulk validation.
+type ValidationReport struct {
+	Services       []*ServiceValidation `json:"services"`
+	FailedServices int                  `json:"failed_services"`
+}
+
+type validationTarget struct {
+	service  string
+	configId string
+}
+
+// ValidationRequested returns true if the config manager is asked to validate
+// services instead of serving one.
+func ValidationRequested() bool {
+	return *validateServices != "" || *validateServicesFile != ""
+}
+
+// ValidateServices validates the services in --validate_services and
+// --validate_services_file, writes the report to out, and returns false if any
+// service fails.
+func ValidateServices(mf *metadata.MetadataFetcher, opts options.ConfigGeneratorOptions, out io.Writer) (bool, error) {
+	targets, err := parseValidationTargets(strings.Split(*validateServices, ","))
+	if err != nil {
+		return false, err
+	}
+	if *validateServicesFile != "" {
+		content, err := ioutil.ReadFile(*validateServicesFile)
+		if err != nil {
+			return false, fmt.Errorf("fail to read services file: %s, error: %v", *validateServicesFile, err)
+		}
+		fileTargets, err := parseValidationTargets(strings.Split(string(content), "\n"))
+		if err != nil {
+			return false, err
+		}
+		targets = append(targets, fileTargets...)
+	}
+	if len(targets) == 0 {
+		return false, fmt.Errorf("no service to validate")
+	}
+
+	if mf == nil && opts.ServiceAccountKey == "" {
+		return false, fmt.Errorf("if flag --non_gcp is specified, flag --service_account_key must be specified")
+	}
+	m := &ConfigManager{
+		metadataFetcher:    mf,
+		envoyConfigOptions: opts,
+	}
+	if err := m.initSecrets(mf); err != nil {
+		return false, err
+	}
+	accessToken := func() (string, time.Duration, error) {
+		if opts.ServiceAccountKey != "" {
+			return m.serviceAccountKeyToken()
+		}
+		return mf.FetchAccessToken()
+	}
+	client, err := httpsClient(opts)
+	if err != nil {
+		return false, fmt.Errorf("fail to init httpsClient: %v", err)
+	}
+
+	report := validateServiceConfigs(targets, *validateParallelism, opts, func(service string) *sc.ServiceConfigFetcher {
+		fetcher := sc.NewServiceConfigFetcher(client, opts.ServiceManagementURL, service, accessToken)
+		if opts.ServiceManagementFailoverURLs != "" {
+			fetcher.SetFailoverUrls(strings.Split(opts.ServiceManagementFailoverURLs, ","))
+		}
+		return fetcher
+	})
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return false, fmt.Errorf("fail to write the validation report: %v", err)
+	}
+	return report.FailedServices == 0, nil
+}
+
+// parseValidationTargets parses the services in the format of SERVICE or
+// SERVICE=CONFIG_ID.
+func parseValidationTargets(lines []string) ([]validationTarget, error) {
+	var targets []validationTarget
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		target := validationTarget{
+			service: line,
+		}
+		if i := strings.Index(line, "="); i >= 0 {
+			target.service, target.configId = strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+			if target.configId == "" {
+				return nil, fmt.Errorf("invalid service to validate %q, the config id is empty", line)
+			}
+		}
+		if target.service == "" {
+			return nil, fmt.Errorf("invalid service to validate %q, the service name is empty", line)
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// validateServiceConfigs validates the services in parallel, the report keeps
+// the order of the targets.
+func validateServiceConfigs(targets []validationTarget, parallelism int, opts options.ConfigGeneratorOptions,
+	newFetcher func(service string) *sc.ServiceConfigFetcher) *ValidationReport {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	report := &ValidationReport{
+		Services: make([]*ServiceValidation, len(targets)),
+	}
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, target validationTarget) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			report.Services[i] = validateServiceConfig(newFetcher(target.service), target, opts)
+		}(i, target)
+	}
+	wg.Wait()
+
+	for _, v := range report.Services {
+		if len(v.Errors) > 0 {
+			report.FailedServices++
+		}
+	}
+	return report
+}
+
+// validateServiceConfig fetches the service config and generates the Envoy
+// configs from it, as the config manager serving the service would.
+func validateServiceConfig(fetcher *sc.ServiceConfigFetcher, target validationTarget, opts options.ConfigGeneratorOptions) *ServiceValidation {
+	v := &ServiceValidation{
+		Service:  target.service,
+		ConfigId: target.configId,
+	}
+
+	if v.ConfigId == "" {
+		configId, err := fetcher.LoadConfigIdFromRollouts()
+		if err != nil {
+			v.Errors = append(v.Errors, fmt.Sprintf("fail to load the config id from the rollouts: %v", err))
+			return v
+		}
+		v.ConfigId = configId
+	}
+
+	serviceConfig, err := fetcher.FetchConfig(v.ConfigId)
+	if err != nil {
+		v.Errors = append(v.Errors, fmt.Sprintf("fail to fetch the service config: %v", err))
+		return v
+	}
+	if serviceConfig.GetName() != target.service {
+		v.Warnings = append(v.Warnings, fmt.Sprintf("the service config is of service %s", serviceConfig.GetName()))
+	}
+
+	serviceInfo, err := configinfo.NewServiceInfoFromServiceConfig(serviceConfig, v.ConfigId, opts)
+	if err != nil {
+		v.Errors = append(v.Errors, fmt.Sprintf("fail to initialize ServiceInfo: %v", err))
+		return v
+	}
+	redactBackendCredentials(serviceInfo)
+	if _, err := gen.MakeClusters(serviceInfo); err != nil {
+		v.Errors = append(v.Errors, fmt.Sprintf("fail to make the clusters: %v", err))
+	}
+	if _, err := gen.MakeListeners(serviceInfo); err != nil {
+		v.Errors = append(v.Errors, fmt.Sprintf("fail to make the listeners: %v", err))
+		return v
+	}
+
+	// The operations without any route cannot be called through the proxy,
+	// e.g. the ones without http rules on a non-gRPC backend.
+	routes, _, err := gen.MakeRouteTable(serviceInfo)
+	if err != nil {
+		v.Errors = append(v.Errors, fmt.Sprintf("fail to make the routes: %v", err))
+		return v
+	}
+	routed := make(map[string]bool)
+	for _, r := range routes {
+		routed[r.GetName()] = true
+	}
+	var unrouted []string
+	for operation := range serviceInfo.Methods {
+		if !routed[operation] {
+			unrouted = append(unrouted, operation)
+		}
+	}
+	sort.Strings(unrouted)
+	for _, operation := range unrouted {
+		v.Warnings = append(v.Warnings, fmt.Sprintf("operation %s has no route", operation))
+	}
+	return v
+}
@@ -0,0 +1,226 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/proto"
+
+	sc "github.com/GoogleCloudPlatform/esp-v2/src/go/serviceconfig"
+	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	smpb "google.golang.org/genproto/googleapis/api/servicemanagement/v1"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func validationTestServiceConfig(name, configId string) *confpb.Service {
+	return &confpb.Service{
+		Name: name,
+		Id:   configId,
+		Apis: []*apipb.Api{
+			{
+				Name: "endpoints.examples.bookstore.Bookstore",
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "DeleteShelf",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/shelves",
+					},
+				},
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.DeleteShelf",
+					Pattern: &annotationspb.HttpRule_Delete{
+						Delete: "/v1/shelves/{shelf}",
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestParseValidationTargets(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		lines       []string
+		wantTargets []validationTarget
+		wantError   string
+	}{
+		{
+			desc:  "Services with and without config ids",
+			lines: []string{"a.endpoints.p.cloud.goog", " b.endpoints.p.cloud.goog = 2021-01-01r0 ", "", "# comment"},
+			wantTargets: []validationTarget{
+				{service: "a.endpoints.p.cloud.goog"},
+				{service: "b.endpoints.p.cloud.goog", configId: "2021-01-01r0"},
+			},
+		},
+		{
+			desc:      "Empty config id",
+			lines:     []string{"a.endpoints.p.cloud.goog="},
+			wantError: `invalid service to validate "a.endpoints.p.cloud.goog=", the config id is empty`,
+		},
+		{
+			desc:      "Empty service name",
+			lines:     []string{"=2021-01-01r0"},
+			wantError: `invalid service to validate "=2021-01-01r0", the service name is empty`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := parseValidationTargets(tc.lines)
+			if err != nil {
+				if err.Error() != tc.wantError {
+					t.Fatalf("got error: %v, want error: %s", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("got no error, want error: %s", tc.wantError)
+			}
+			if !reflect.DeepEqual(got, tc.wantTargets) {
+				t.Errorf("got targets: %v, want: %v", got, tc.wantTargets)
+			}
+		})
+	}
+}
+
+func TestValidateServiceConfigs(t *testing.T) {
+	validConfig := validationTestServiceConfig("valid.endpoints.p.cloud.goog", "2021-01-01r0")
+
+	unroutedConfig := validationTestServiceConfig("unrouted.endpoints.p.cloud.goog", "2021-01-01r0")
+	unroutedConfig.Http.Rules = unroutedConfig.Http.Rules[:1]
+
+	invalidConfig := validationTestServiceConfig("invalid.endpoints.p.cloud.goog", "2021-01-01r0")
+	invalidConfig.Backend = &confpb.Backend{
+		Rules: []*confpb.BackendRule{
+			{
+				Selector: "endpoints.examples.bookstore.Bookstore.GetShelf",
+			},
+		},
+	}
+
+	configs := map[string]*confpb.Service{}
+	for _, config := range []*confpb.Service{validConfig, unroutedConfig, invalidConfig} {
+		configs[fmt.Sprintf("/v1/services/%s/configs/%s", config.Name, config.Id)] = config
+	}
+	rollouts := &smpb.ListServiceRolloutsResponse{
+		Rollouts: []*smpb.Rollout{
+			{
+				Strategy: &smpb.Rollout_TrafficPercentStrategy_{
+					TrafficPercentStrategy: &smpb.Rollout_TrafficPercentStrategy{
+						Percentages: map[string]float64{
+							"2021-01-01r0": 100,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg proto.Message
+		if strings.HasSuffix(r.URL.Path, "/rollouts") {
+			msg = rollouts
+		} else if config, ok := configs[r.URL.Path]; ok {
+			msg = config
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		resp, err := proto.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write(resp)
+	}))
+	defer server.Close()
+
+	// Other tests may have redirected the fetch urls.
+	oldFetchRolloutsURL, oldFetchConfigURL := util.FetchRolloutsURL, util.FetchConfigURL
+	defer func() { util.FetchRolloutsURL, util.FetchConfigURL = oldFetchRolloutsURL, oldFetchConfigURL }()
+	util.FetchRolloutsURL = func(serviceManagementUrl, serviceName string) string {
+		return fmt.Sprintf("%s/v1/services/%s/rollouts", serviceManagementUrl, serviceName)
+	}
+	util.FetchConfigURL = func(serviceManagementUrl, serviceName, configId string) string {
+		return fmt.Sprintf("%s/v1/services/%s/configs/%s", serviceManagementUrl, serviceName, configId)
+	}
+
+	accessToken := func() (string, time.Duration, error) { return "access-token", time.Minute, nil }
+	targets := []validationTarget{
+		{service: "valid.endpoints.p.cloud.goog"},
+		{service: "unrouted.endpoints.p.cloud.goog", configId: "2021-01-01r0"},
+		{service: "invalid.endpoints.p.cloud.goog"},
+		{service: "missing.endpoints.p.cloud.goog", configId: "2021-01-01r0"},
+	}
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.DisableTracing = true
+	report := validateServiceConfigs(targets, 2, opts, func(service string) *sc.ServiceConfigFetcher {
+		return sc.NewServiceConfigFetcher(server.Client(), server.URL, service, accessToken)
+	})
+
+	want := &ValidationReport{
+		Services: []*ServiceValidation{
+			{
+				Service:  "valid.endpoints.p.cloud.goog",
+				ConfigId: "2021-01-01r0",
+			},
+			{
+				Service:  "unrouted.endpoints.p.cloud.goog",
+				ConfigId: "2021-01-01r0",
+				Warnings: []string{"operation endpoints.examples.bookstore.Bookstore.DeleteShelf has no route"},
+			},
+			{
+				Service:  "invalid.endpoints.p.cloud.goog",
+				ConfigId: "2021-01-01r0",
+				Errors:   []string{"fail to initialize ServiceInfo: error processing local backend rule for operation (endpoints.examples.bookstore.Bookstore.GetShelf), selector (endpoints.examples.bookstore.Bookstore.GetShelf) was not defined in the API"},
+			},
+			{
+				Service:  "missing.endpoints.p.cloud.goog",
+				ConfigId: "2021-01-01r0",
+				Errors: []string{fmt.Sprintf("fail to fetch the service config: http call to GET %s/v1/services/missing.endpoints.p.cloud.goog/configs/2021-01-01r0 returns not 200 OK: 404 Not Found",
+					server.URL)},
+			},
+		},
+		FailedServices: 2,
+	}
+	for i := range want.Services {
+		if !reflect.DeepEqual(report.Services[i], want.Services[i]) {
+			t.Errorf("got validation %d: %+v, want: %+v", i, report.Services[i], want.Services[i])
+		}
+	}
+	if report.FailedServices != want.FailedServices {
+		t.Errorf("got %d failed services, want: %d", report.FailedServices, want.FailedServices)
+	}
+}
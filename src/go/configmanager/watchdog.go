@@ -0,0 +1,129 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// The rollout loop is considered wedged if it has missed this many checks.
+const rolloutLoopMissedChecks = 3
+
+var (
+	watchdogInterval           = flag.Duration("watchdog_interval", 30*time.Second, `the interval to check the goroutine count, the rollout loop liveness, the service config staleness and the Envoy adoption lag of the config manager. 0 disables the watchdog.`)
+	watchdogMaxGoroutines      = flag.Int("watchdog_max_goroutines", 0, `the config manager is unhealthy if it runs more goroutines than this. 0 means no limit.`)
+	watchdogMaxConfigStaleness = flag.Duration("watchdog_max_config_staleness", 0, `the config manager is unhealthy if the latest rollout has not been checked successfully for this long. 0 means no limit.
+					It only applies to the managed rollout strategy.`)
+	watchdogMaxAdoptionLag = flag.Duration("watchdog_max_adoption_lag", 0, `the config manager is unhealthy if a connected Envoy has not ACKed the config sent to it for this long, e.g. a stuck or rejecting data plane. 0 means no limit.`)
+	watchdogEnvoyAdminUrl  = flag.String("watchdog_envoy_admin_url", "", `the url of the Envoy admin interface. If set, the Envoy health checks on --healthz fail while the watchdog finds
+					the config manager unhealthy, so that the instance can be restarted or taken out of the load balancing. By default the problems are only logged.`)
+)
+
+// CheckHealth returns an error describing the problems of the config manager,
+// or nil if it is healthy.
+func (m *ConfigManager) CheckHealth() error {
+	return m.checkHealth(time.Now())
+}
+
+func (m *ConfigManager) checkHealth(now time.Time) error {
+	var problems []string
+
+	if *watchdogMaxGoroutines > 0 {
+		if num := runtime.NumGoroutine(); num > *watchdogMaxGoroutines {
+			problems = append(problems, fmt.Sprintf("%d goroutines are running, more than the limit %d", num, *watchdogMaxGoroutines))
+		}
+	}
+
+	if m.rolloutIdChangeDetector != nil {
+		maxIdle := rolloutLoopMissedChecks * *checkNewRolloutInterval
+		if idle := now.Sub(m.rolloutIdChangeDetector.LastCheckTime()); idle > maxIdle {
+			problems = append(problems, fmt.Sprintf("rollout loop has not run for %v", idle))
+		}
+		if *watchdogMaxConfigStaleness > 0 {
+			if stale := now.Sub(m.rolloutIdChangeDetector.LastSuccessTime()); stale > *watchdogMaxConfigStaleness {
+				problems = append(problems, fmt.Sprintf("latest rollout has not been checked successfully for %v", stale))
+			}
+		}
+	}
+
+	if *watchdogMaxAdoptionLag > 0 {
+		for _, a := range m.adoptions(now) {
+			if a.lag > *watchdogMaxAdoptionLag {
+				problems = append(problems, fmt.Sprintf("Envoy %s has not ACKed %s version %s for %v", a.Node, a.TypeUrl, a.SentVersion, a.lag))
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("config manager is unhealthy: %s", strings.Join(problems, "; "))
+}
+
+// startWatchdog periodically checks the health of the config manager, so
+// that a wedged rollout loop does not silently freeze the config forever.
+func (m *ConfigManager) startWatchdog() {
+	if *watchdogInterval <= 0 {
+		return
+	}
+
+	client := &http.Client{Timeout: *watchdogInterval}
+	go func() {
+		glog.Infof("start the config manager watchdog every %v", *watchdogInterval)
+		ticker := time.NewTicker(*watchdogInterval)
+
+		healthCheckFailed := false
+		for range ticker.C {
+			err := m.CheckHealth()
+			if err != nil {
+				glog.Errorf("watchdog: %v", err)
+			}
+			if *watchdogEnvoyAdminUrl == "" || healthCheckFailed == (err != nil) {
+				continue
+			}
+			if setErr := setEnvoyHealthCheck(client, *watchdogEnvoyAdminUrl, err == nil); setErr != nil {
+				glog.Errorf("watchdog fails to update the Envoy health check, %v", setErr)
+				continue
+			}
+			healthCheckFailed = err != nil
+		}
+	}()
+}
+
+// setEnvoyHealthCheck passes or fails the Envoy health checks through the
+// Envoy admin interface. While failed, the health check filter answers the
+// health checks with 503.
+func setEnvoyHealthCheck(client *http.Client, adminUrl string, healthy bool) error {
+	path := "/healthcheck/fail"
+	if healthy {
+		path = "/healthcheck/ok"
+	}
+	resp, err := client.Post(adminUrl+path, "text/plain", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("envoy admin %s returned status %d", path, resp.StatusCode)
+	}
+	return nil
+}
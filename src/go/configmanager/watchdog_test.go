@@ -0,0 +1,133 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	sc "github.com/GoogleCloudPlatform/esp-v2/src/go/serviceconfig"
+)
+
+func TestCheckHealth(t *testing.T) {
+	testCases := []struct {
+		desc               string
+		managedRollout     bool
+		maxGoroutines      string
+		maxConfigStaleness string
+		elapsed            time.Duration
+		wantError          string
+	}{
+		{
+			desc:           "Healthy rollout loop",
+			managedRollout: true,
+			elapsed:        2 * time.Minute,
+		},
+		{
+			desc:           "Wedged rollout loop",
+			managedRollout: true,
+			elapsed:        4 * time.Minute,
+			wantError:      "config manager is unhealthy: rollout loop has not run for 4m0",
+		},
+		{
+			desc:               "Stale service config",
+			managedRollout:     true,
+			maxConfigStaleness: "90s",
+			elapsed:            2 * time.Minute,
+			wantError:          "config manager is unhealthy: latest rollout has not been checked successfully for 2m0",
+		},
+		{
+			desc:    "Fixed rollout has no rollout loop",
+			elapsed: time.Hour,
+		},
+		{
+			desc:          "Too many goroutines",
+			maxGoroutines: "1",
+			wantError:     "goroutines are running, more than the limit 1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			setFlag(t, "check_rollout_interval", "1m")
+			setFlag(t, "watchdog_max_goroutines", "0")
+			setFlag(t, "watchdog_max_config_staleness", "0")
+			if tc.maxGoroutines != "" {
+				setFlag(t, "watchdog_max_goroutines", tc.maxGoroutines)
+			}
+			if tc.maxConfigStaleness != "" {
+				setFlag(t, "watchdog_max_config_staleness", tc.maxConfigStaleness)
+			}
+
+			m := &ConfigManager{}
+			if tc.managedRollout {
+				m.rolloutIdChangeDetector = sc.NewRolloutIdChangeDetector(&http.Client{}, "http://127.0.0.1:0", "service-name", nil)
+			}
+
+			err := m.checkHealth(time.Now().Add(tc.elapsed))
+			if tc.wantError == "" {
+				if err != nil {
+					t.Errorf("got error: %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("got error: %v, want error: %s", err, tc.wantError)
+			}
+		})
+	}
+}
+
+func TestSetEnvoyHealthCheck(t *testing.T) {
+	var gotPaths []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || !strings.HasPrefix(r.URL.Path, "/healthcheck/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		gotPaths = append(gotPaths, r.URL.Path)
+	}))
+	defer s.Close()
+
+	if err := setEnvoyHealthCheck(&http.Client{}, s.URL, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := setEnvoyHealthCheck(&http.Client{}, s.URL, true); err != nil {
+		t.Fatal(err)
+	}
+	wantPaths := []string{"/healthcheck/fail", "/healthcheck/ok"}
+	if strings.Join(gotPaths, ",") != strings.Join(wantPaths, ",") {
+		t.Errorf("got envoy admin calls: %v, want: %v", gotPaths, wantPaths)
+	}
+
+	wantError := "envoy admin /healthcheck/ok returned status 404"
+	if err := setEnvoyHealthCheck(&http.Client{}, s.URL+"/unknown", true); err == nil || err.Error() != wantError {
+		t.Errorf("got error: %v, want error: %s", err, wantError)
+	}
+}
+
+func setFlag(t *testing.T, name, value string) {
+	oldValue := flag.Lookup(name).Value.String()
+	if err := flag.Set(name, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = flag.Set(name, oldValue)
+	})
+}
@@ -15,10 +15,13 @@
 package metadata
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -34,11 +37,6 @@ const (
 	tokenExpiry = 3599
 )
 
-type tokenInfo struct {
-	accessToken  string
-	tokenTimeout time.Time
-}
-
 type metadataTokenResponse struct {
 	AccessToken string `json:"access_token"`
 	ExpiresIn   int64  `json:"expires_in"`
@@ -50,18 +48,23 @@ type MetadataFetcher struct {
 	timeNow func() time.Time
 
 	mux sync.Mutex
-	// metadata updates and stores Metadata from GCE.
-	tokenInfo tokenInfo
-	// audience -> tokenInfo.
-	audToToken sync.Map
+	// audience -> the identity token, and the access token keyed by
+	// accessTokenKey.
+	tokens map[string]*tokenInfo
 }
 
+// Allows for unit tests to inject the environment.
+var getenv = os.Getenv
+
 // Allows for unit tests to inject a mock constructor
 var (
 	NewMetadataFetcher = func(opts options.CommonOptions) *MetadataFetcher {
 		return &MetadataFetcher{
 			client: http.Client{
 				Timeout: opts.HttpRequestTimeout,
+				// The metadata server is local to the VM, never call it
+				// through the proxies.
+				Transport: &http.Transport{},
 			},
 			baseUrl: opts.MetadataURL,
 			timeNow: time.Now,
@@ -88,15 +91,10 @@ func (mf *MetadataFetcher) getMetadata(path string) ([]byte, error) {
 }
 
 func (mf *MetadataFetcher) FetchAccessToken() (string, time.Duration, error) {
-	now := mf.timeNow()
-	// Follow the similar logic as GCE metadata server, where returned token will be valid for at
-	// least 60s.
-	mf.mux.Lock()
-	defer mf.mux.Unlock()
-	if mf.tokenInfo.accessToken != "" && !now.After(mf.tokenInfo.tokenTimeout.Add(-time.Second*60)) {
-		return mf.tokenInfo.accessToken, mf.tokenInfo.tokenTimeout.Sub(now), nil
-	}
+	return mf.getToken(accessTokenKey, mf.fetchAccessToken)
+}
 
+func (mf *MetadataFetcher) fetchAccessToken(now time.Time) (string, time.Duration, error) {
 	tokenBody, err := mf.getMetadata(mf.createUrl(util.AccessTokenPath))
 	if err != nil {
 		return "", 0, err
@@ -106,11 +104,7 @@ func (mf *MetadataFetcher) FetchAccessToken() (string, time.Duration, error) {
 	if err = json.Unmarshal(tokenBody, &resp); err != nil {
 		return "", 0, err
 	}
-
-	expires := time.Duration(resp.ExpiresIn) * time.Second
-	mf.tokenInfo.accessToken = resp.AccessToken
-	mf.tokenInfo.tokenTimeout = now.Add(expires)
-	return mf.tokenInfo.accessToken, expires, nil
+	return resp.AccessToken, time.Duration(resp.ExpiresIn) * time.Second, nil
 }
 
 // TODO(kyuc): perhaps we need some retry logic and timeout?
@@ -136,29 +130,26 @@ func (mf *MetadataFetcher) FetchRolloutStrategy() (string, error) {
 }
 
 func (mf *MetadataFetcher) FetchIdentityJWTToken(audience string) (string, time.Duration, error) {
-	now := mf.timeNow()
-	// Follow the similar logic as GCE metadata server, where returned token will be valid for at
-	// least 60s.
-	if ti, ok := mf.audToToken.Load(audience); ok {
-		info := ti.(tokenInfo)
-		if !now.After(info.tokenTimeout.Add(-time.Second * 60)) {
-			return info.accessToken, info.tokenTimeout.Sub(now), nil
+	// The GKE metadata server of Workload Identity rejects the requests without
+	// the audience, instead of defaulting it.
+	if audience == "" {
+		return "", 0, fmt.Errorf("audience of the identity token is empty")
+	}
+	return mf.getToken(audience, func(now time.Time) (string, time.Duration, error) {
+		identityTokenURI := util.IdentityTokenPath + "?audience=" + url.QueryEscape(audience) + "&format=standard"
+		token, err := mf.fetchMetadata(identityTokenURI)
+		if err != nil {
+			return "", 0, err
 		}
-	}
 
-	identityTokenURI := util.IdentityTokenPath + "?audience=" + audience + "&format=standard"
-	token, err := mf.fetchMetadata(identityTokenURI)
-	if err != nil {
-		return "", 0, err
-	}
-
-	expires := time.Duration(tokenExpiry) * time.Second
-	mf.audToToken.Store(audience, tokenInfo{
-		accessToken:  token,
-		tokenTimeout: now.Add(expires),
-	},
-	)
-	return token, expires, nil
+		expires := time.Duration(tokenExpiry) * time.Second
+		if exp, err := jwtExpiry(token); err == nil {
+			// The tokens of the GKE metadata server may be cached by it, and expire
+			// earlier than a fresh one.
+			expires = exp.Sub(now)
+		}
+		return token, expires, nil
+	})
 }
 
 func (mf *MetadataFetcher) FetchGCPAttributes() (*scpb.GcpAttributes, error) {
@@ -207,6 +198,15 @@ func (mf *MetadataFetcher) fetchLocation() (string, error) {
 }
 
 func (mf *MetadataFetcher) fetchPlatform() string {
+	// Only the serverless platforms are regional, the functions are told
+	// apart by their environment.
+	if _, err := mf.fetchMetadata(util.RegionPath); err == nil {
+		if getenv("FUNCTION_TARGET") != "" {
+			return util.CloudFunctions
+		}
+		return util.CloudRun
+	}
+
 	if _, err := mf.fetchMetadata(util.GAEServerSoftwarePath); err == nil {
 		return util.GAEFlex
 	}
@@ -215,5 +215,33 @@ func (mf *MetadataFetcher) fetchPlatform() string {
 		return util.GKE
 	}
 
+	// The GKE metadata server of Workload Identity.
+	if _, err := mf.fetchMetadata(util.ClusterNamePath); err == nil {
+		return util.GKE
+	}
+
 	return util.GCE
 }
+
+// jwtExpiry returns the expiry in the exp claim of the JWT, without verifying
+// it.
+func jwtExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("invalid JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, err
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, err
+	}
+	if claims.Exp == 0 {
+		return time.Time{}, fmt.Errorf("JWT without exp claim")
+	}
+	return time.Unix(claims.Exp, 0), nil
+}
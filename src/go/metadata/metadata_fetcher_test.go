@@ -15,6 +15,10 @@
 package metadata
 
 import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -55,9 +59,6 @@ func TestFetchAccountTokenExpired(t *testing.T) {
 
 	mf := NewMockMetadataFetcher(ts.GetURL(), fakeNow)
 
-	// Make sure the accessToken is empty before the test.
-	mf.tokenInfo.accessToken = ""
-
 	testData := []testToken{
 		{
 			desc:               "Empty metadata",
@@ -88,8 +89,7 @@ func TestFetchAccountTokenExpired(t *testing.T) {
 	}
 	for i, tc := range testData {
 		if tc.curToken != "" {
-			mf.tokenInfo.accessToken = tc.curToken
-			mf.tokenInfo.tokenTimeout = tc.curTokenTimeout
+			setCachedToken(mf, accessTokenKey, tc.curToken, tc.curTokenTimeout)
 		}
 		token, expires, err := mf.FetchAccessToken()
 		if err != nil {
@@ -146,12 +146,7 @@ func TestFetchIdentityJWTTokenBasic(t *testing.T) {
 	for i, tc := range testData {
 		// Mocking the last-fetched token.
 		if tc.curToken != "" {
-			mf.audToToken.Store(fakeAudience,
-				tokenInfo{
-					accessToken:  tc.curToken,
-					tokenTimeout: tc.curTokenTimeout,
-				},
-			)
+			setCachedToken(mf, fakeAudience, tc.curToken, tc.curTokenTimeout)
 		}
 
 		token, expires, err := mf.FetchIdentityJWTToken(fakeAudience)
@@ -167,6 +162,41 @@ func TestFetchIdentityJWTTokenBasic(t *testing.T) {
 	}
 }
 
+func TestFetchIdentityJWTTokenWorkloadIdentity(t *testing.T) {
+	fakeNow := time.Unix(1600000000, 0)
+	encode := base64.RawURLEncoding.EncodeToString
+	fakeJwt := encode([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." +
+		encode([]byte(fmt.Sprintf(`{"aud":"https://backend.run.app/?a=b&c=d","exp":%d}`, fakeNow.Add(30*time.Minute).Unix()))) + ".signature"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != util.IdentityTokenPath || r.URL.Query().Get("audience") != "https://backend.run.app/?a=b&c=d" || r.URL.Query().Get("format") != "standard" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(fakeJwt))
+	}))
+	defer ts.Close()
+
+	mf := NewMockMetadataFetcher(ts.URL, fakeNow)
+
+	// The audience is escaped, and the expiry is read from the token.
+	token, expires, err := mf.FetchIdentityJWTToken("https://backend.run.app/?a=b&c=d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != fakeJwt {
+		t.Errorf("token got: %v, want: %s", token, fakeJwt)
+	}
+	if expires != 30*time.Minute {
+		t.Errorf("expiration got: %s, want: %s", expires, 30*time.Minute)
+	}
+
+	wantError := "audience of the identity token is empty"
+	if _, _, err := mf.FetchIdentityJWTToken(""); err == nil || err.Error() != wantError {
+		t.Errorf("error got: %v, want: %s", err, wantError)
+	}
+}
+
 func TestFetchServiceName(t *testing.T) {
 	ts := util.InitMockServer(fakeServiceName)
 	defer ts.Close()
@@ -201,6 +231,7 @@ func TestFetchGCPAttributes(t *testing.T) {
 	testData := []struct {
 		desc                  string
 		mockedResp            map[string]string
+		env                   map[string]string
 		expectedGCPAttributes *scpb.GcpAttributes
 	}{
 		{
@@ -259,6 +290,15 @@ func TestFetchGCPAttributes(t *testing.T) {
 				Platform: util.GKE,
 			},
 		},
+		{
+			desc: "Platform - GKE with Workload Identity",
+			mockedResp: map[string]string{
+				util.ClusterNamePath: "cluster",
+			},
+			expectedGCPAttributes: &scpb.GcpAttributes{
+				Platform: util.GKE,
+			},
+		},
 		{
 			desc:       "Platform - GCE",
 			mockedResp: map[string]string{},
@@ -292,13 +332,32 @@ func TestFetchGCPAttributes(t *testing.T) {
 			},
 			expectedGCPAttributes: &scpb.GcpAttributes{
 				Zone:     fakeRegion,
-				Platform: util.GCE,
+				Platform: util.CloudRun,
+			},
+		},
+		{
+			desc: "Platform - Cloud Functions",
+			mockedResp: map[string]string{
+				util.RegionPath: fakeRegionPath,
+			},
+			env: map[string]string{
+				"FUNCTION_TARGET": "HelloWorld",
+			},
+			expectedGCPAttributes: &scpb.GcpAttributes{
+				Zone:     fakeRegion,
+				Platform: util.CloudFunctions,
 			},
 		},
 	}
 
+	originalGetenv := getenv
+	defer func() { getenv = originalGetenv }()
+
 	errorTmpl := "Test: %s\n  Expected: %v\n  Actual: %v"
 	for _, tc := range testData {
+		env := tc.env
+		getenv = func(key string) string { return env[key] }
+
 		ts := util.InitMockServerFromPathResp(tc.mockedResp)
 		defer ts.Close()
 
@@ -0,0 +1,187 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metadata
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// Follow the similar logic as GCE metadata server, where returned token will
+	// be valid for at least 60s.
+	tokenMinValidity = 60 * time.Second
+	// The cached tokens are refreshed in the background this long before they
+	// expire, so the callers do not wait for the metadata server.
+	tokenRefreshMargin = 5 * time.Minute
+
+	// The delays of retrying a failed background refresh.
+	tokenRetryInitialDelay = time.Second
+	tokenRetryMaxDelay     = time.Minute
+
+	// The key of the access token in the cache, the identity tokens are keyed
+	// by their audiences, which are never empty.
+	accessTokenKey = ""
+)
+
+// Allows for unit tests to inject the randomness of the jitters.
+var randInt63n = rand.Int63n
+
+// tokenFetchFunc fetches the token at now, and returns how long it is valid.
+type tokenFetchFunc func(now time.Time) (string, time.Duration, error)
+
+// tokenInfo is a cached token.
+type tokenInfo struct {
+	accessToken  string
+	tokenTimeout time.Time
+
+	// When the token was last returned to a caller, and last refreshed in the
+	// background. The tokens not used since their last refresh are dropped
+	// instead of being refreshed forever.
+	lastUsed    time.Time
+	refreshedAt time.Time
+
+	// The fetch in flight, shared by the concurrent callers, nil if none.
+	inflight     *tokenFetch
+	refreshTimer *time.Timer
+}
+
+type tokenFetch struct {
+	done    chan struct{}
+	token   string
+	expires time.Duration
+	err     error
+}
+
+func (ti *tokenInfo) valid(now time.Time) bool {
+	return ti.accessToken != "" && !now.After(ti.tokenTimeout.Add(-tokenMinValidity))
+}
+
+// getToken returns the cached token of the key if it is valid, otherwise
+// fetches it. Only one fetch of each key is in flight, the concurrent callers
+// wait for it instead of calling the metadata server again.
+func (mf *MetadataFetcher) getToken(key string, fetch tokenFetchFunc) (string, time.Duration, error) {
+	now := mf.timeNow()
+
+	mf.mux.Lock()
+	if mf.tokens == nil {
+		mf.tokens = make(map[string]*tokenInfo)
+	}
+	info, ok := mf.tokens[key]
+	if !ok {
+		info = &tokenInfo{}
+		mf.tokens[key] = info
+	}
+	info.lastUsed = now
+	if info.valid(now) {
+		mf.mux.Unlock()
+		return info.accessToken, info.tokenTimeout.Sub(now), nil
+	}
+
+	call := info.inflight
+	if call == nil {
+		call = &tokenFetch{done: make(chan struct{})}
+		info.inflight = call
+		mf.mux.Unlock()
+		mf.fetchToken(key, fetch, call, 0)
+	} else {
+		mf.mux.Unlock()
+		<-call.done
+	}
+	return call.token, call.expires, call.err
+}
+
+// fetchToken makes the fetch of the call, caches the token and schedules
+// refreshing it.
+func (mf *MetadataFetcher) fetchToken(key string, fetch tokenFetchFunc, call *tokenFetch, attempt int) {
+	now := mf.timeNow()
+	call.token, call.expires, call.err = fetch(now)
+
+	mf.mux.Lock()
+	defer mf.mux.Unlock()
+	close(call.done)
+
+	info := mf.tokens[key]
+	info.inflight = nil
+	if info.refreshTimer != nil {
+		info.refreshTimer.Stop()
+		info.refreshTimer = nil
+	}
+	if call.err != nil {
+		// Keep retrying the background refresh while the cached token is still
+		// valid, the callers fetch it themselves after that.
+		delay := tokenRetryDelay(attempt)
+		if info.valid(now.Add(delay)) {
+			glog.Warningf("fail to refresh the token, retry in %v, %v", delay, call.err)
+			info.refreshTimer = time.AfterFunc(delay, func() {
+				mf.refreshToken(key, fetch, attempt+1)
+			})
+		}
+		return
+	}
+
+	info.accessToken = call.token
+	info.tokenTimeout = now.Add(call.expires)
+	if delay, ok := tokenRefreshDelay(call.expires); ok {
+		info.refreshTimer = time.AfterFunc(delay, func() {
+			mf.refreshToken(key, fetch, 0)
+		})
+	}
+}
+
+// refreshToken fetches the cached token again before it expires.
+func (mf *MetadataFetcher) refreshToken(key string, fetch tokenFetchFunc, attempt int) {
+	mf.mux.Lock()
+	info, ok := mf.tokens[key]
+	if !ok || info.inflight != nil {
+		// A caller is fetching it already.
+		mf.mux.Unlock()
+		return
+	}
+	if !info.refreshedAt.IsZero() && !info.lastUsed.After(info.refreshedAt) {
+		delete(mf.tokens, key)
+		mf.mux.Unlock()
+		return
+	}
+	info.refreshedAt = mf.timeNow()
+	call := &tokenFetch{done: make(chan struct{})}
+	info.inflight = call
+	mf.mux.Unlock()
+
+	mf.fetchToken(key, fetch, call, attempt)
+}
+
+// tokenRefreshDelay returns when to refresh the token valid for expires, with
+// a jitter so the proxies which fetched their tokens at the same time do not
+// refresh them at once. The short-lived tokens are not refreshed.
+func tokenRefreshDelay(expires time.Duration) (time.Duration, bool) {
+	delay := expires - tokenRefreshMargin
+	if delay <= 0 {
+		return 0, false
+	}
+	return delay - time.Duration(randInt63n(int64(delay/10)+1)), true
+}
+
+// tokenRetryDelay returns the exponential delay of the retry attempt, jittered
+// to between the half and the full of it.
+func tokenRetryDelay(attempt int) time.Duration {
+	delay := tokenRetryMaxDelay
+	if attempt < 6 {
+		delay = tokenRetryInitialDelay << uint(attempt)
+	}
+	return delay/2 + time.Duration(randInt63n(int64(delay/2)+1))
+}
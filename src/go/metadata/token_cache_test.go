@@ -0,0 +1,221 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func setCachedToken(mf *MetadataFetcher, key, token string, timeout time.Time) {
+	mf.mux.Lock()
+	defer mf.mux.Unlock()
+	if mf.tokens == nil {
+		mf.tokens = make(map[string]*tokenInfo)
+	}
+	mf.tokens[key] = &tokenInfo{
+		accessToken:  token,
+		tokenTimeout: timeout,
+	}
+}
+
+func stopRefreshTimers(mf *MetadataFetcher) {
+	mf.mux.Lock()
+	defer mf.mux.Unlock()
+	for _, info := range mf.tokens {
+		if info.refreshTimer != nil {
+			info.refreshTimer.Stop()
+		}
+	}
+}
+
+func TestGetTokenSharesInflightFetch(t *testing.T) {
+	fakeNow := time.Now()
+	mf := NewMockMetadataFetcher("", fakeNow)
+	defer stopRefreshTimers(mf)
+
+	var fetches int32
+	release := make(chan struct{})
+	fetch := func(now time.Time) (string, time.Duration, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		return "ya29.new", time.Hour, nil
+	}
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 10)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], _, _ = mf.getToken("audience", fetch)
+		}(i)
+	}
+	// Let the callers pile up on the in-flight fetch.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&fetches); got != 1 {
+		t.Errorf("got %v fetches, want 1", got)
+	}
+	for i, token := range tokens {
+		if token != "ya29.new" {
+			t.Errorf("caller %v got token %q, want %q", i, token, "ya29.new")
+		}
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	fakeNow := time.Now()
+	testData := []struct {
+		desc        string
+		used        bool
+		refreshErr  error
+		wantToken   string
+		wantCached  bool
+		wantRetried bool
+	}{
+		{
+			desc:       "used token is refreshed",
+			used:       true,
+			wantToken:  "ya29.refreshed",
+			wantCached: true,
+		},
+		{
+			desc: "token not used since the last refresh is dropped",
+		},
+		{
+			desc:        "failed refresh keeps the cached token and retries",
+			used:        true,
+			refreshErr:  fmt.Errorf("metadata server unavailable"),
+			wantToken:   "ya29.cached",
+			wantCached:  true,
+			wantRetried: true,
+		},
+	}
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			mf := NewMockMetadataFetcher("", fakeNow)
+			defer stopRefreshTimers(mf)
+
+			setCachedToken(mf, "audience", "ya29.cached", fakeNow.Add(4*time.Minute))
+			mf.tokens["audience"].refreshedAt = fakeNow.Add(-time.Minute)
+			if tc.used {
+				mf.tokens["audience"].lastUsed = fakeNow
+			}
+
+			mf.refreshToken("audience", func(now time.Time) (string, time.Duration, error) {
+				if tc.refreshErr != nil {
+					return "", 0, tc.refreshErr
+				}
+				return "ya29.refreshed", time.Hour, nil
+			}, 0)
+
+			info, ok := mf.tokens["audience"]
+			if ok != tc.wantCached {
+				t.Fatalf("token cached got %v, want %v", ok, tc.wantCached)
+			}
+			if !ok {
+				return
+			}
+			if info.accessToken != tc.wantToken {
+				t.Errorf("cached token got %q, want %q", info.accessToken, tc.wantToken)
+			}
+			if tc.wantRetried && info.refreshTimer == nil {
+				t.Errorf("failed refresh is not retried")
+			}
+		})
+	}
+}
+
+func TestTokenRefreshDelay(t *testing.T) {
+	origRandInt63n := randInt63n
+	defer func() { randInt63n = origRandInt63n }()
+
+	testData := []struct {
+		desc      string
+		expires   time.Duration
+		jitter    int64
+		wantDelay time.Duration
+		wantOk    bool
+	}{
+		{
+			desc:      "refresh before the margin",
+			expires:   3599 * time.Second,
+			wantDelay: 3299 * time.Second,
+			wantOk:    true,
+		},
+		{
+			desc:      "refresh earlier with the jitter",
+			expires:   3599 * time.Second,
+			jitter:    int64(100 * time.Second),
+			wantDelay: 3199 * time.Second,
+			wantOk:    true,
+		},
+		{
+			desc:    "short-lived token is not refreshed",
+			expires: 4 * time.Minute,
+		},
+	}
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			randInt63n = func(n int64) int64 {
+				if tc.jitter >= n {
+					t.Fatalf("jitter %v is out of [0, %v)", tc.jitter, n)
+				}
+				return tc.jitter
+			}
+			delay, ok := tokenRefreshDelay(tc.expires)
+			if ok != tc.wantOk || delay != tc.wantDelay {
+				t.Errorf("tokenRefreshDelay got (%v, %v), want (%v, %v)", delay, ok, tc.wantDelay, tc.wantOk)
+			}
+		})
+	}
+}
+
+func TestTokenRetryDelay(t *testing.T) {
+	origRandInt63n := randInt63n
+	defer func() { randInt63n = origRandInt63n }()
+	randInt63n = func(n int64) int64 {
+		return n - 1
+	}
+
+	testData := []struct {
+		attempt   int
+		wantDelay time.Duration
+	}{
+		{
+			attempt:   0,
+			wantDelay: time.Second,
+		},
+		{
+			attempt:   3,
+			wantDelay: 8 * time.Second,
+		},
+		{
+			attempt:   10,
+			wantDelay: time.Minute,
+		},
+	}
+	for _, tc := range testData {
+		if got := tokenRetryDelay(tc.attempt); got != tc.wantDelay {
+			t.Errorf("tokenRetryDelay(%v) got %v, want %v", tc.attempt, got, tc.wantDelay)
+		}
+	}
+}
@@ -24,6 +24,8 @@ type AdsBootstrapperOptions struct {
 
 	// Flags for ADS
 	AdsConnectTimeout time.Duration
+	// Use the incremental (delta) xDS protocol instead of the state-of-the-world one.
+	AdsDeltaXds bool
 }
 
 // DefaultAdsBootstrapperOptions returns AdsBootstrapperOptions with default values.
@@ -24,14 +24,19 @@ type CommonOptions struct {
 	// Flags for envoy
 	AdminAddress          string
 	AdminPort             int
+	AdminAccessLogPath    string
 	AdsNamedPipe          string
 	Node                  string
 	GeneratedHeaderPrefix string
+	// The locality of this proxy, used by Envoy for zone aware load balancing.
+	NodeRegion string
+	NodeZone   string
 
 	// Flags for tracing
 	DisableTracing             bool
 	TracingProjectId           string
 	TracingStackdriverAddress  string
+	TracingZipkinCollectorUrl  string
 	TracingSamplingRate        float64
 	TracingIncomingContext     string
 	TracingOutgoingContext     string
@@ -40,11 +45,22 @@ type CommonOptions struct {
 	TracingMaxNumMessageEvents int64
 	TracingMaxNumLinks         int64
 
+	// Whether to break down the request stats by the operation.
+	EnableOperationStats bool
+
+	// Flags for the statsd or dogstatsd stats sink, disabled if the address is empty.
+	StatsSinkType    string
+	StatsSinkAddress string
+	StatsSinkPrefix  string
+
 	// Flags for metadata
 	NonGCP             bool
 	HttpRequestTimeout time.Duration
 	MetadataURL        string
 	IamURL             string
+	// The HTTP proxy used for outbound calls to Google APIs and JWKS endpoints.
+	// If empty, HTTP_PROXY and HTTPS_PROXY are honored by the config manager.
+	GoogleApiProxy string
 	// Configures the identity used when making requests to Service Control.
 	ServiceControlCredentials *IAMCredentialsOptions
 	// Configures the identity used when making requests to backends.
@@ -84,6 +100,8 @@ func DefaultCommonOptions() CommonOptions {
 		AdminPort:    8001,
 		AdsNamedPipe: "@espv2-ads-cluster",
 
+		AdminAccessLogPath: "/dev/null",
+
 		// b/148454048: This should be at least 20s due to IMDS latency issues with k8s workload identities.
 		HttpRequestTimeout: 30 * time.Second,
 
@@ -95,6 +113,7 @@ func DefaultCommonOptions() CommonOptions {
 		TracingMaxNumLinks:         128,
 		TracingIncomingContext:     "traceparent,x-cloud-trace-context",
 		TracingOutgoingContext:     "traceparent,x-cloud-trace-context",
+		StatsSinkType:              "statsd",
 		MetadataURL:                "http://169.254.169.254",
 		IamURL:                     "https://iamcredentials.googleapis.com",
 		GeneratedHeaderPrefix:      "X-Endpoint-",
@@ -38,8 +38,43 @@ type ConfigGeneratorOptions struct {
 	CorsMaxAge           time.Duration
 	CorsPreset           string
 
+	// The trailers exposed to the gRPC-Web clients via CORS.
+	GrpcWebExposeTrailers string
+
+	// The dns lookup family of the clusters other than the backends, empty
+	// keeps the default of each cluster.
+	DnsLookupFamily string
+
+	// The credentials attached to the requests to the non-Google backends, by
+	// the selectors.
+	BackendCredentials string
+
 	// Backend routing configurations.
-	BackendDnsLookupFamily string
+	BackendDnsLookupFamily     string
+	BackendLocalityLb          string
+	BackendLocalityEndpoints   string
+	OperationMaxConcurrency    string
+	MaxRequestBytes            int
+	OperationMaxRequestBytes   string
+	OperationHedgingThreshold  string
+	MaintenanceSelectors       string
+	MaintenanceRetryAfter      time.Duration
+	Domains                    string
+	HostBackends               string
+	BackendMaxRequestHeadersKb string
+	BackendEnableTrailers      string
+	PathRewriteFilter          string
+	LroPollingDeadline         time.Duration
+	LroPollingInheritApiKey    bool
+
+	// Circuit breaker thresholds of the backend clusters, 0 uses the Envoy defaults.
+	BackendMaxConnections     int
+	BackendMaxPendingRequests int
+	BackendMaxRequests        int
+	BackendMaxRetries         int
+
+	// Pass all requests to the local backend if the service config has no apis or http rules.
+	PassthroughForEmptyConfig bool
 
 	// Envoy specific configurations.
 	ClusterConnectTimeout time.Duration
@@ -47,6 +82,8 @@ type ConfigGeneratorOptions struct {
 
 	// Full URI to the backend: scheme, address/hostname, port
 	BackendAddress               string
+	BackendHttpProtocol          string
+	BackendTlsSni                string
 	EnableBackendAddressOverride bool
 
 	// Health check related
@@ -56,14 +93,32 @@ type ConfigGeneratorOptions struct {
 	HealthCheckGrpcBackendInterval          time.Duration
 	HealthCheckGrpcBackendNoTrafficInterval time.Duration
 
+	// The path serving the API discovery metadata, disabled if empty.
+	ApiMetadataPath string
+
+	// Answer the gRPC server reflection from the service config descriptors.
+	EnableGrpcReflection bool
+	GrpcReflectionPort   uint
+
 	// Network related configurations.
 	ListenerAddress                  string
 	ServiceManagementURL             string
 	ServiceControlURL                string
+	ServiceManagementFailoverURLs    string
+	ServiceControlFailoverURLs       string
+	TelemetryBackend                 string
+	SecretManagerURL                 string
+	SecretRefreshInterval            time.Duration
 	ListenerPort                     int
+	ListenerUdsPath                  string
+	SslListenerPort                  int
+	HttpsRedirect                    bool
 	SslServerCertPath                string
+	SslServerCertSds                 bool
+	SslServerCertCheckInterval       time.Duration
 	SslServerCipherSuites            string
 	SslServerRootCertPath            string
+	SslServerRequireClientCert       bool
 	SslMinimumProtocol               string
 	SslMaximumProtocol               string
 	EnableHSTS                       bool
@@ -79,22 +134,36 @@ type ConfigGeneratorOptions struct {
 	AddResponseHeaders        string
 	AppendResponseHeaders     string
 	EnableOperationNameHeader bool
+	EnableRouteMetadata       bool
 
 	// Flags for non_gcp deployment.
 	ServiceAccountKey string
 	TokenAgentPort    uint
 
 	// Flags for external calls.
-	DisableOidcDiscovery    bool
-	DependencyErrorBehavior string
+	DisableOidcDiscovery          bool
+	OidcDiscoveryTimeout          time.Duration
+	OidcDiscoveryNumRetries       int
+	OidcDiscoveryFallbackJwksPath string
+	DependencyErrorBehavior       string
 
-	// Flags for testing purpose.
+	// Directory to write the generated envoy configs into for offline review.
+	DumpGeneratedConfigDir string
+
+	// Filter generation toggles.
+	SkipBackendAuthFilter    bool
+	SkipGrpcWebFilter        bool
+	SkipTranscoderFilter     bool
 	SkipJwtAuthnFilter       bool
 	SkipServiceControlFilter bool
 
 	// Envoy configurations.
 	AccessLog       string
 	AccessLogFormat string
+	AccessLogJson   bool
+
+	AccessLogGrpcUrl     string
+	AccessLogGrpcLogName string
 
 	EnvoyUseRemoteAddress  bool
 	EnvoyXffNumTrustedHops int
@@ -102,6 +171,7 @@ type ConfigGeneratorOptions struct {
 	LogJwtPayloads            string
 	LogRequestHeaders         string
 	LogResponseHeaders        string
+	LogLabels                 string
 	MinStreamReportIntervalMs uint64
 
 	SuppressEnvoyHeaders          bool
@@ -120,6 +190,9 @@ type ConfigGeneratorOptions struct {
 	JwksFetchRetryBackOffBaseInterval time.Duration
 	JwksFetchRetryBackOffMaxInterval  time.Duration
 	JwtPadForwardPayloadHeader        bool
+	JwtPayloadHeader                  string
+	JwtAllowMissingOrFailedSelectors  string
+	JwtClaimRequirements              string
 
 	ScCheckTimeoutMs  int
 	ScQuotaTimeoutMs  int
@@ -133,7 +206,28 @@ type ConfigGeneratorOptions struct {
 	ScQuotaRetries            int
 	ScReportRetries           int
 
+	ScReportQueueMaxSize      int
+	ScReportQueueDropPolicy   string
+	ScReportDiskSpillDir      string
+	ScReportDiskSpillMaxBytes uint64
+
+	ScReportAggregationEntries         int
+	ScReportAggregationFlushIntervalMs int
+	ScCheckAggregationEntries          int
+	ScCheckAggregationFlushIntervalMs  int
+	ScCheckAggregationExpirationMs     int
+
+	ResponseCompression                 string
+	ResponseCompressionMinContentLength int
+	ResponseCompressionContentTypes     string
+
+	QuotaRetryAfter            time.Duration
+	ReportSuccessSamplingRates string
+
 	ComputePlatformOverride string
+	ComputeZoneOverride     string
+	ComputeRegionOverride   string
+	ProjectIdOverride       string
 
 	TranscodingAlwaysPrintPrimitiveFields         bool
 	TranscodingAlwaysPrintEnumsAsInts             bool
@@ -141,6 +235,7 @@ type ConfigGeneratorOptions struct {
 	TranscodingIgnoreQueryParameters              string
 	TranscodingIgnoreUnknownQueryParameters       bool
 	TranscodingQueryParametersDisableUnescapePlus bool
+	TranscodingStatusOverrides                    string
 	APIAllowList                                  []string
 }
 
@@ -152,6 +247,7 @@ func DefaultConfigGeneratorOptions() ConfigGeneratorOptions {
 	return ConfigGeneratorOptions{
 		CommonOptions:                           DefaultCommonOptions(),
 		BackendDnsLookupFamily:                  "auto",
+		PathRewriteFilter:                       "auto",
 		BackendAddress:                          fmt.Sprintf("http://%s:8082", util.LoopbackIPv4Addr),
 		EnableBackendAddressOverride:            false,
 		ClusterConnectTimeout:                   20 * time.Second,
@@ -165,7 +261,10 @@ func DefaultConfigGeneratorOptions() ConfigGeneratorOptions {
 		ListenerAddress:                         "0.0.0.0",
 		ListenerPort:                            8080,
 		TokenAgentPort:                          8791,
+		GrpcReflectionPort:                      8792,
 		DisableOidcDiscovery:                    false,
+		OidcDiscoveryTimeout:                    5 * time.Second,
+		OidcDiscoveryNumRetries:                 2,
 		DependencyErrorBehavior:                 commonpb.DependencyErrorBehavior_BLOCK_INIT_ON_ANY_ERROR.String(),
 		SslSidestreamClientRootCertsPath:        util.DefaultRootCAPaths,
 		SslBackendClientRootCertsPath:           util.DefaultRootCAPaths,
@@ -178,14 +277,26 @@ func DefaultConfigGeneratorOptions() ConfigGeneratorOptions {
 		ConnectionBufferLimitBytes:              -1,
 		ServiceManagementURL:                    "https://servicemanagement.googleapis.com",
 		ServiceControlURL:                       "https://servicecontrol.googleapis.com",
+		TelemetryBackend:                        "servicecontrol",
+		SecretManagerURL:                        "https://secretmanager.googleapis.com",
+		SecretRefreshInterval:                   5 * time.Minute,
 		BackendRetryNum:                         1,
 		BackendRetryOns:                         "reset,connect-failure,refused-stream",
 		ScCheckRetries:                          -1,
 		ScQuotaRetries:                          -1,
 		ScReportRetries:                         -1,
+		ScReportAggregationEntries:              -1,
+		ScCheckAggregationEntries:               -1,
+		ResponseCompressionMinContentLength:     -1,
+		ScReportQueueDropPolicy:                 "DROP_NEWEST",
+		ScReportDiskSpillMaxBytes:               64 * 1024 * 1024,
 		CorsMaxAge:                              480 * time.Hour,
+		MaintenanceRetryAfter:                   5 * time.Minute,
+		AccessLogGrpcLogName:                    "espv2",
 		HealthCheckGrpcBackendInterval:          1 * time.Second,
 		HealthCheckGrpcBackendNoTrafficInterval: 60 * time.Second,
+		SslServerCertCheckInterval:              60 * time.Second,
+		SslServerRequireClientCert:              true,
 		APIAllowList:                            []string{},
 	}
 }
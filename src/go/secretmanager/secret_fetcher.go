@@ -0,0 +1,186 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secretmanager
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/glog"
+
+	secretpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+)
+
+const (
+	// SecretURIPrefix marks a flag value as a reference to a Secret Manager
+	// secret, in the format of sm://project/secret[/version].
+	SecretURIPrefix = "sm://"
+
+	latestSecretVersion = "latest"
+)
+
+// IsSecretURI returns whether the value references a Secret Manager secret.
+func IsSecretURI(value string) bool {
+	return strings.HasPrefix(value, SecretURIPrefix)
+}
+
+// ParseSecretURI converts sm://project/secret[/version] into the resource name
+// of the secret version. The latest version is used if it is not specified.
+func ParseSecretURI(uri string) (string, error) {
+	if !IsSecretURI(uri) {
+		return "", fmt.Errorf("invalid Secret Manager uri %s, should be in sm://project/secret[/version] format", uri)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(uri, SecretURIPrefix), "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return "", fmt.Errorf("invalid Secret Manager uri %s, should be in sm://project/secret[/version] format", uri)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return "", fmt.Errorf("invalid Secret Manager uri %s, should be in sm://project/secret[/version] format", uri)
+		}
+	}
+
+	version := latestSecretVersion
+	if len(parts) == 3 {
+		version = parts[2]
+	}
+	return fmt.Sprintf("projects/%s/secrets/%s/versions/%s", parts[0], parts[1], version), nil
+}
+
+type SecretFetcher struct {
+	secretManagerUrl string
+	client           *http.Client
+	accessToken      util.GetAccessTokenFunc
+}
+
+func NewSecretFetcher(client *http.Client, secretManagerUrl string, accessToken util.GetAccessTokenFunc) *SecretFetcher {
+	return &SecretFetcher{
+		client:           client,
+		secretManagerUrl: secretManagerUrl,
+		accessToken:      accessToken,
+	}
+}
+
+// FetchSecret fetches the payload of the secret referenced by uri.
+func (f *SecretFetcher) FetchSecret(uri string) ([]byte, error) {
+	secretVersion, err := ParseSecretURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := new(secretpb.AccessSecretVersionResponse)
+	accessSecretUrl := util.AccessSecretVersionURL(f.secretManagerUrl, secretVersion)
+	if err := util.CallGoogleapis(f.client, accessSecretUrl, util.GET, f.accessToken, nil, resp); err != nil {
+		return nil, fmt.Errorf("fail to fetch secret %s: %v", uri, err)
+	}
+	return resp.GetPayload().GetData(), nil
+}
+
+// Secret keeps the latest payload of a secret referenced by a sm:// uri.
+type Secret struct {
+	uri     string
+	fetcher *SecretFetcher
+
+	mutex sync.RWMutex
+	data  []byte
+	// Closed to stop the refresh timer, guarded by mutex.
+	done chan struct{}
+}
+
+// NewSecret creates a Secret and fetches its current payload.
+func (f *SecretFetcher) NewSecret(uri string) (*Secret, error) {
+	s := &Secret{
+		uri:     uri,
+		fetcher: f,
+	}
+	if _, err := s.Refresh(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Data returns the latest fetched payload.
+func (s *Secret) Data() []byte {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.data
+}
+
+// Refresh re-fetches the payload, it returns whether the payload has changed.
+func (s *Secret) Refresh() (bool, error) {
+	data, err := s.fetcher.FetchSecret(s.uri)
+	if err != nil {
+		return false, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.data != nil && bytes.Equal(data, s.data) {
+		return false, nil
+	}
+	s.data = data
+	return true, nil
+}
+
+// SetRefreshTimer periodically refreshes the secret, callback is invoked
+// whenever the payload has changed.
+func (s *Secret) SetRefreshTimer(interval time.Duration, callback func()) {
+	done := make(chan struct{})
+	s.mutex.Lock()
+	s.done = done
+	s.mutex.Unlock()
+
+	go func() {
+		glog.Infof("start refreshing secret %s every %v", s.uri, interval)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			updated, err := s.Refresh()
+			if err != nil {
+				glog.Errorf("error occurred when refreshing secret, %v", err)
+				continue
+			}
+			if updated {
+				glog.Infof("secret %s is rotated", s.uri)
+				if callback != nil {
+					callback()
+				}
+			}
+		}
+	}()
+}
+
+// StopRefreshTimer stops the refresh timer set by SetRefreshTimer.
+func (s *Secret) StopRefreshTimer() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.done != nil {
+		close(s.done)
+		s.done = nil
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secretmanager
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	secretpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+)
+
+func TestParseSecretURI(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		uri       string
+		want      string
+		wantError string
+	}{
+		{
+			desc: "Secret without version uses the latest version",
+			uri:  "sm://project-1/tls-key",
+			want: "projects/project-1/secrets/tls-key/versions/latest",
+		},
+		{
+			desc: "Secret with version",
+			uri:  "sm://project-1/tls-key/3",
+			want: "projects/project-1/secrets/tls-key/versions/3",
+		},
+		{
+			desc:      "Not a Secret Manager uri",
+			uri:       "/etc/esp/key.json",
+			wantError: "invalid Secret Manager uri /etc/esp/key.json, should be in sm://project/secret[/version] format",
+		},
+		{
+			desc:      "Missing secret",
+			uri:       "sm://project-1",
+			wantError: "invalid Secret Manager uri sm://project-1, should be in sm://project/secret[/version] format",
+		},
+		{
+			desc:      "Empty segment",
+			uri:       "sm://project-1//3",
+			wantError: "invalid Secret Manager uri sm://project-1//3, should be in sm://project/secret[/version] format",
+		},
+		{
+			desc:      "Too many segments",
+			uri:       "sm://project-1/tls-key/3/4",
+			wantError: "invalid Secret Manager uri sm://project-1/tls-key/3/4, should be in sm://project/secret[/version] format",
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := ParseSecretURI(tc.uri)
+		if err != nil {
+			if err.Error() != tc.wantError {
+				t.Errorf("Test (%s): got error: %v, want error: %s", tc.desc, err, tc.wantError)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test (%s): got no error, want error: %s", tc.desc, tc.wantError)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("Test (%s): got: %s, want: %s", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestSecretRefresh(t *testing.T) {
+	payload := "secret-1"
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/projects/project-1/secrets/tls-key/versions/latest:access" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer ya29.token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		resp, err := proto.Marshal(&secretpb.AccessSecretVersionResponse{
+			Name: "projects/project-1/secrets/tls-key/versions/1",
+			Payload: &secretpb.SecretPayload{
+				Data: []byte(payload),
+			},
+		})
+		if err != nil {
+			t.Fatalf("fail to generate access secret response: %v", err)
+		}
+		_, _ = w.Write(resp)
+	}))
+	defer s.Close()
+
+	accessToken := func() (string, time.Duration, error) {
+		return "ya29.token", time.Hour, nil
+	}
+	f := NewSecretFetcher(&http.Client{}, s.URL, accessToken)
+
+	if _, err := f.NewSecret("sm://project-1/unknown"); err == nil {
+		t.Errorf("want error for a missing secret, got nil")
+	}
+
+	secret, err := f.NewSecret("sm://project-1/tls-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(secret.Data()); got != "secret-1" {
+		t.Errorf("got secret: %s, want: secret-1", got)
+	}
+
+	if updated, err := secret.Refresh(); err != nil || updated {
+		t.Errorf("want unchanged secret to be skipped, got updated: %v, err: %v", updated, err)
+	}
+
+	payload = "secret-2"
+	if updated, err := secret.Refresh(); err != nil || !updated {
+		t.Errorf("want rotated secret to be updated, got updated: %v, err: %v", updated, err)
+	}
+	if got := string(secret.Data()); got != "secret-2" {
+		t.Errorf("got secret: %s, want: secret-2", got)
+	}
+}
+
+func TestSecretStopRefreshTimer(t *testing.T) {
+	var fetches int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		resp, err := proto.Marshal(&secretpb.AccessSecretVersionResponse{
+			Payload: &secretpb.SecretPayload{
+				Data: []byte("secret-1"),
+			},
+		})
+		if err != nil {
+			t.Fatalf("fail to generate access secret response: %v", err)
+		}
+		_, _ = w.Write(resp)
+	}))
+	defer s.Close()
+
+	accessToken := func() (string, time.Duration, error) {
+		return "ya29.token", time.Hour, nil
+	}
+	secret, err := NewSecretFetcher(&http.Client{}, s.URL, accessToken).NewSecret("sm://project-1/tls-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret.SetRefreshTimer(5*time.Millisecond, nil)
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt32(&fetches); got < 2 {
+		t.Fatalf("want the secret to be refreshed, got %d fetches", got)
+	}
+
+	secret.StopRefreshTimer()
+	// Let a refresh in flight finish.
+	time.Sleep(20 * time.Millisecond)
+	stopped := atomic.LoadInt32(&fetches)
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt32(&fetches); got != stopped {
+		t.Errorf("want no refresh after the timer is stopped, got %d fetches, want %d", got, stopped)
+	}
+}
+
+func TestFetchSecretAccessTokenError(t *testing.T) {
+	accessToken := func() (string, time.Duration, error) {
+		return "", 0, fmt.Errorf("metadata server is unreachable")
+	}
+	f := NewSecretFetcher(&http.Client{}, "http://127.0.0.1:0", accessToken)
+
+	_, err := f.FetchSecret("sm://project-1/tls-key")
+	want := "fail to fetch secret sm://project-1/tls-key: fail to get access token: metadata server is unreachable"
+	if err == nil || err.Error() != want {
+		t.Errorf("got error: %v, want: %s", err, want)
+	}
+}
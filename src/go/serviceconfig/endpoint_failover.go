@@ -0,0 +1,112 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceconfig
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/glog"
+)
+
+// EndpointUnhealthyDuration is how long a failed endpoint is skipped before
+// it is tried again in its failover order.
+var EndpointUnhealthyDuration = time.Minute
+
+// endpointFailover calls the endpoints of a Google API in failover order,
+// skipping the ones failed recently unless all of them did.
+type endpointFailover struct {
+	urls []string
+
+	mutex          sync.Mutex
+	unhealthyUntil map[string]time.Time
+}
+
+func newEndpointFailover(primaryUrl string) *endpointFailover {
+	return &endpointFailover{
+		urls:           []string{primaryUrl},
+		unhealthyUntil: make(map[string]time.Time),
+	}
+}
+
+// setFailoverUrls sets the endpoints tried in order after the primary one.
+func (f *endpointFailover) setFailoverUrls(urls []string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.urls = append(f.urls[:1:1], urls...)
+}
+
+// orderedUrls returns the healthy endpoints in failover order followed by the
+// unhealthy ones, so a call is still attempted if all of them failed.
+func (f *endpointFailover) orderedUrls(now time.Time) []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var healthy, unhealthy []string
+	for _, url := range f.urls {
+		if now.Before(f.unhealthyUntil[url]) {
+			unhealthy = append(unhealthy, url)
+		} else {
+			healthy = append(healthy, url)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+func (f *endpointFailover) markHealthy(url string, healthy bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if healthy {
+		delete(f.unhealthyUntil, url)
+	} else {
+		f.unhealthyUntil[url] = time.Now().Add(EndpointUnhealthyDuration)
+	}
+}
+
+// call calls the endpoints in order until one succeeds or fails with an error
+// not caused by the endpoint, e.g. 404 Not Found. The error of the last
+// endpoint called is returned.
+func (f *endpointFailover) call(do func(url string) error) error {
+	var err error
+	urls := f.orderedUrls(time.Now())
+	for i, url := range urls {
+		if err = do(url); err == nil {
+			f.markHealthy(url, true)
+			return nil
+		}
+		if !isEndpointError(err) {
+			return err
+		}
+		f.markHealthy(url, false)
+		if i+1 < len(urls) {
+			glog.Warningf("call to %s failed, failing over to %s: %v", url, urls[i+1], err)
+		}
+	}
+	return err
+}
+
+// isEndpointError returns whether the call failed because of the endpoint,
+// i.e. a transport error or a 5xx status.
+func isEndpointError(err error) bool {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return true
+	}
+	var statusErr *util.HttpStatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode >= http.StatusInternalServerError
+}
@@ -17,6 +17,7 @@ package serviceconfig
 import (
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
@@ -26,28 +27,44 @@ import (
 
 type RolloutIdChangeDetector struct {
 	serviceName           string
-	serviceControlUrl     string
+	serviceControl        *endpointFailover
 	client                *http.Client
 	curRolloutId          string
 	accessToken           util.GetAccessTokenFunc
 	detectRolloutIdTicker *time.Ticker
+
+	// mutex guards the liveness timestamps of the detecting loop.
+	mutex       sync.Mutex
+	lastCheck   time.Time
+	lastSuccess time.Time
 }
 
 func NewRolloutIdChangeDetector(client *http.Client, serviceControlUrl, serviceName string,
 	accessToken util.GetAccessTokenFunc) *RolloutIdChangeDetector {
+	now := time.Now()
 	return &RolloutIdChangeDetector{
-		client:            client,
-		serviceName:       serviceName,
-		serviceControlUrl: serviceControlUrl,
-		accessToken:       accessToken,
+		client:         client,
+		serviceName:    serviceName,
+		serviceControl: newEndpointFailover(serviceControlUrl),
+		accessToken:    accessToken,
+		lastCheck:      now,
+		lastSuccess:    now,
 	}
 
 }
 
+// SetFailoverUrls sets the Service Control urls tried in order when the
+// primary one fails.
+func (c *RolloutIdChangeDetector) SetFailoverUrls(urls []string) {
+	c.serviceControl.setFailoverUrls(urls)
+}
+
 func (c *RolloutIdChangeDetector) fetchLatestRolloutId() (string, error) {
 	reportResponse := new(scpb.ReportResponse)
-	fetchRolloutIdUrl := util.FetchRolloutIdURL(c.serviceControlUrl, c.serviceName)
-	if err := util.CallGoogleapis(c.client, fetchRolloutIdUrl, util.POST, c.accessToken, nil, reportResponse); err != nil {
+	if err := c.serviceControl.call(func(serviceControlUrl string) error {
+		fetchRolloutIdUrl := util.FetchRolloutIdURL(serviceControlUrl, c.serviceName)
+		return util.CallGoogleapis(c.client, fetchRolloutIdUrl, util.POST, c.accessToken, nil, reportResponse)
+	}); err != nil {
 		return "", fmt.Errorf("fail to fetch new rollout id, %v", err)
 	}
 
@@ -60,12 +77,20 @@ func (c *RolloutIdChangeDetector) SetDetectRolloutIdChangeTimer(interval time.Du
 		c.detectRolloutIdTicker = time.NewTicker(interval)
 
 		for range c.detectRolloutIdTicker.C {
+			c.mutex.Lock()
+			c.lastCheck = time.Now()
+			c.mutex.Unlock()
+
 			latestRolloutId, err := c.fetchLatestRolloutId()
 			if err != nil {
 				glog.Errorf("error occurred when checking new rollout id, %v", err)
 				continue
 			}
 
+			c.mutex.Lock()
+			c.lastSuccess = time.Now()
+			c.mutex.Unlock()
+
 			if latestRolloutId == c.curRolloutId {
 				continue
 			}
@@ -75,3 +100,24 @@ func (c *RolloutIdChangeDetector) SetDetectRolloutIdChangeTimer(interval time.Du
 		}
 	}()
 }
+
+// RolloutId returns the latest rollout id, it must be called from the callback
+// of the detecting loop.
+func (c *RolloutIdChangeDetector) RolloutId() string {
+	return c.curRolloutId
+}
+
+// LastCheckTime returns when the detecting loop last started a check, it stops
+// advancing if the loop is wedged.
+func (c *RolloutIdChangeDetector) LastCheckTime() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lastCheck
+}
+
+// LastSuccessTime returns when the latest rollout id was last fetched successfully.
+func (c *RolloutIdChangeDetector) LastSuccessTime() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lastSuccess
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceconfig
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/glog"
+
+	emptypb "github.com/golang/protobuf/ptypes/empty"
+	pubsubpb "google.golang.org/genproto/googleapis/pubsub/v1"
+)
+
+// The max number of messages pulled at once, a single one is enough to check
+// the rollouts.
+const maxPulledMessages = 100
+
+// RolloutNotifier pulls the rollout notifications of a Pub/Sub subscription,
+// so the new rollouts are applied without waiting for the next rollout check.
+//
+// The content of the messages is not used, any message triggers a check of
+// the latest rollout. Pub/Sub delivers each message to only one puller of the
+// subscription, so every instance needs its own subscription.
+type RolloutNotifier struct {
+	client        *http.Client
+	pubsubUrl     string
+	subscription  string
+	accessToken   util.GetAccessTokenFunc
+	retryInterval time.Duration
+	pollInterval  time.Duration
+}
+
+// NewRolloutNotifier creates a RolloutNotifier of the subscription, in the
+// format of projects/PROJECT/subscriptions/SUBSCRIPTION.
+func NewRolloutNotifier(client *http.Client, pubsubUrl, subscription string,
+	accessToken util.GetAccessTokenFunc) *RolloutNotifier {
+	return &RolloutNotifier{
+		client:        client,
+		pubsubUrl:     pubsubUrl,
+		subscription:  subscription,
+		accessToken:   accessToken,
+		retryInterval: 10 * time.Second,
+		pollInterval:  5 * time.Second,
+	}
+}
+
+// pull fetches the pending messages of the subscription, acknowledges them
+// and returns how many are received.
+//
+// The pull returns immediately instead of waiting for the messages, a long
+// pull outlives the timeout of the http client and fails.
+func (n *RolloutNotifier) pull() (int, error) {
+	resp := new(pubsubpb.PullResponse)
+	pullUrl := fmt.Sprintf("%s/v1/%s:pull", n.pubsubUrl, n.subscription)
+	if err := util.CallGoogleapisWithBody(n.client, pullUrl, util.POST, n.accessToken,
+		&pubsubpb.PullRequest{MaxMessages: maxPulledMessages, ReturnImmediately: true}, resp); err != nil {
+		return 0, fmt.Errorf("fail to pull rollout notifications, %v", err)
+	}
+
+	messages := resp.GetReceivedMessages()
+	if len(messages) == 0 {
+		return 0, nil
+	}
+	var ackIds []string
+	for _, message := range messages {
+		ackIds = append(ackIds, message.GetAckId())
+	}
+	ackUrl := fmt.Sprintf("%s/v1/%s:acknowledge", n.pubsubUrl, n.subscription)
+	if err := util.CallGoogleapisWithBody(n.client, ackUrl, util.POST, n.accessToken,
+		&pubsubpb.AcknowledgeRequest{AckIds: ackIds}, new(emptypb.Empty)); err != nil {
+		// The messages are redelivered, which only causes an extra check.
+		glog.Warningf("fail to acknowledge rollout notifications, %v", err)
+	}
+	return len(messages), nil
+}
+
+// Start pulls the notifications in the background and calls notify whenever
+// some are received.
+func (n *RolloutNotifier) Start(notify func()) {
+	go func() {
+		glog.Infof("start pulling rollout notifications from %v", n.subscription)
+		for {
+			received, err := n.pull()
+			if err != nil {
+				glog.Errorf("error occurred when pulling rollout notifications, %v", err)
+				time.Sleep(n.retryInterval)
+				continue
+			}
+			if received == 0 {
+				time.Sleep(n.pollInterval)
+				continue
+			}
+			glog.Infof("received %d rollout notifications", received)
+			notify()
+		}
+	}()
+}
@@ -0,0 +1,161 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceconfig
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	pubsubpb "google.golang.org/genproto/googleapis/pubsub/v1"
+)
+
+const testSubscription = "projects/test-project/subscriptions/rollouts"
+
+// fakePubsub serves the pull and acknowledge calls of testSubscription.
+type fakePubsub struct {
+	mutex    sync.Mutex
+	messages []*pubsubpb.ReceivedMessage
+	acked    []string
+	failPull bool
+}
+
+func (f *fakePubsub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	switch r.URL.Path {
+	case "/v1/" + testSubscription + ":pull":
+		if f.failPull {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		req := &pubsubpb.PullRequest{}
+		if err := proto.Unmarshal(body, req); err != nil || req.MaxMessages != maxPulledMessages || !req.ReturnImmediately {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		respBytes, _ := proto.Marshal(&pubsubpb.PullResponse{ReceivedMessages: f.messages})
+		f.messages = nil
+		_, _ = w.Write(respBytes)
+	case "/v1/" + testSubscription + ":acknowledge":
+		req := &pubsubpb.AcknowledgeRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.acked = append(f.acked, req.AckIds...)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestRolloutNotifierPull(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		messages     []*pubsubpb.ReceivedMessage
+		failPull     bool
+		wantReceived int
+		wantAcked    []string
+		wantError    string
+	}{
+		{
+			desc: "messages are received and acknowledged",
+			messages: []*pubsubpb.ReceivedMessage{
+				{AckId: "ack-1"},
+				{AckId: "ack-2"},
+			},
+			wantReceived: 2,
+			wantAcked:    []string{"ack-1", "ack-2"},
+		},
+		{
+			desc:         "no message",
+			wantReceived: 0,
+		},
+		{
+			desc:      "pull fails",
+			failPull:  true,
+			wantError: "fail to pull rollout notifications",
+		},
+	}
+
+	accessToken := func() (string, time.Duration, error) { return "access-token", time.Minute, nil }
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			pubsub := &fakePubsub{
+				messages: tc.messages,
+				failPull: tc.failPull,
+			}
+			server := httptest.NewServer(pubsub)
+			defer server.Close()
+
+			n := NewRolloutNotifier(&http.Client{}, server.URL, testSubscription, accessToken)
+			received, err := n.pull()
+			if tc.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+					t.Errorf("got error: %v, want: %s", err, tc.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if received != tc.wantReceived {
+				t.Errorf("got %d received messages, want: %d", received, tc.wantReceived)
+			}
+			if !reflect.DeepEqual(pubsub.acked, tc.wantAcked) {
+				t.Errorf("got acked: %v, want: %v", pubsub.acked, tc.wantAcked)
+			}
+		})
+	}
+}
+
+func TestRolloutNotifierStart(t *testing.T) {
+	pubsub := &fakePubsub{
+		messages: []*pubsubpb.ReceivedMessage{
+			{AckId: "ack-1"},
+		},
+	}
+	server := httptest.NewServer(pubsub)
+	defer server.Close()
+
+	accessToken := func() (string, time.Duration, error) { return "access-token", time.Minute, nil }
+	n := NewRolloutNotifier(&http.Client{}, server.URL, testSubscription, accessToken)
+	notified := make(chan struct{}, 1)
+	n.Start(func() {
+		select {
+		case notified <- struct{}{}:
+		default:
+		}
+	})
+
+	select {
+	case <-notified:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not notified of the rollout")
+	}
+}
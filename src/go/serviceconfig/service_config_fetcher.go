@@ -16,7 +16,11 @@ package serviceconfig
 
 import (
 	"fmt"
+	"hash/fnv"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
@@ -26,11 +30,13 @@ import (
 )
 
 type ServiceConfigFetcher struct {
-	serviceManagementUrl string
-	serviceName          string
-	client               *http.Client
-	accessToken          util.GetAccessTokenFunc
-	retryConfigs         map[int]util.RetryConfig
+	serviceManagement *endpointFailover
+	serviceName       string
+	client            *http.Client
+	accessToken       util.GetAccessTokenFunc
+	retryConfigs      map[int]util.RetryConfig
+	// Only set to split the traffic among the configs of the latest rollout.
+	trafficSplitInstance string
 }
 
 var SmRetryConfigs = map[int]util.RetryConfig{
@@ -44,19 +50,34 @@ func NewServiceConfigFetcher(client *http.Client, serviceManagementUrl,
 	serviceName string, accessToken util.GetAccessTokenFunc) *ServiceConfigFetcher {
 
 	return &ServiceConfigFetcher{
-		client:               client,
-		serviceName:          serviceName,
-		serviceManagementUrl: serviceManagementUrl,
-		accessToken:          accessToken,
-		retryConfigs:         SmRetryConfigs,
+		client:            client,
+		serviceName:       serviceName,
+		serviceManagement: newEndpointFailover(serviceManagementUrl),
+		accessToken:       accessToken,
+		retryConfigs:      SmRetryConfigs,
 	}
 }
 
+// SetFailoverUrls sets the Service Management urls tried in order when the
+// primary one fails, e.g. the regional endpoints.
+func (s *ServiceConfigFetcher) SetFailoverUrls(urls []string) {
+	s.serviceManagement.setFailoverUrls(urls)
+}
+
+// SetTrafficSplitInstance makes LoadConfigIdFromRollouts select the config
+// of the instance by the traffic percentages of the latest rollout, instead
+// of the one with the highest percentage.
+func (s *ServiceConfigFetcher) SetTrafficSplitInstance(instance string) {
+	s.trafficSplitInstance = instance
+}
+
 // Fetch the service config by given configId.
 func (s *ServiceConfigFetcher) FetchConfig(configId string) (*confpb.Service, error) {
 	serviceConfig := new(confpb.Service)
-	fetchConfigUrl := util.FetchConfigURL(s.serviceManagementUrl, s.serviceName, configId)
-	if err := util.CallGoogleapis(s.client, fetchConfigUrl, util.GET, s.accessToken, s.retryConfigs, serviceConfig); err != nil {
+	if err := s.serviceManagement.call(func(serviceManagementUrl string) error {
+		fetchConfigUrl := util.FetchConfigURL(serviceManagementUrl, s.serviceName, configId)
+		return util.CallGoogleapis(s.client, fetchConfigUrl, util.GET, s.accessToken, s.retryConfigs, serviceConfig)
+	}); err != nil {
 		return nil, err
 	}
 
@@ -64,15 +85,35 @@ func (s *ServiceConfigFetcher) FetchConfig(configId string) (*confpb.Service, er
 }
 
 // Fetch all the rollouts and use the latest success rollout. Among its all
-// service configs, pick up the one with highest traffic percentage.
+// service configs, pick up the one with highest traffic percentage, or the one
+// of the instance if the traffic is split.
 func (s *ServiceConfigFetcher) LoadConfigIdFromRollouts() (string, error) {
+	configId, _, err := s.LoadLatestRollout()
+	return configId, err
+}
+
+// LoadLatestRollout is LoadConfigIdFromRollouts also returning the id of the
+// latest rollout.
+func (s *ServiceConfigFetcher) LoadLatestRollout() (string, string, error) {
 	rollouts := new(smpb.ListServiceRolloutsResponse)
-	fetchRolloutUrl := util.FetchRolloutsURL(s.serviceManagementUrl, s.serviceName)
-	if err := util.CallGoogleapis(s.client, fetchRolloutUrl, util.GET, s.accessToken, s.retryConfigs, rollouts); err != nil {
-		return "", err
+	if err := s.serviceManagement.call(func(serviceManagementUrl string) error {
+		fetchRolloutUrl := util.FetchRolloutsURL(serviceManagementUrl, s.serviceName)
+		return util.CallGoogleapis(s.client, fetchRolloutUrl, util.GET, s.accessToken, s.retryConfigs, rollouts)
+	}); err != nil {
+		return "", "", err
 	}
 
-	return highestTrafficConfigIdInLatestRollout(rollouts)
+	var configId string
+	var err error
+	if s.trafficSplitInstance != "" {
+		configId, err = trafficSplitConfigIdInLatestRollout(rollouts, s.trafficSplitInstance)
+	} else {
+		configId, err = highestTrafficConfigIdInLatestRollout(rollouts)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return configId, rollouts.GetRollouts()[0].GetRolloutId(), nil
 }
 
 func highestTrafficConfigIdInLatestRollout(rollouts *smpb.ListServiceRolloutsResponse) (string, error) {
@@ -96,3 +137,72 @@ func highestTrafficConfigIdInLatestRollout(rollouts *smpb.ListServiceRolloutsRes
 	}
 	return highTrafficConfigId, nil
 }
+
+// trafficSplitConfigIdInLatestRollout selects the config of the instance so
+// that the instances serve the configs of the latest rollout in proportion to
+// their traffic percentages.
+//
+// The instance is hashed into a bucket in [0, 100), and the configs take the
+// buckets by their percentages, the newest config first. As a rollout raises
+// the percentage of the new config, the instances already serving it keep
+// serving it. The buckets not covered by the percentages serve the config
+// with the highest percentage.
+func trafficSplitConfigIdInLatestRollout(rollouts *smpb.ListServiceRolloutsResponse, instance string) (string, error) {
+	highTrafficConfigId, err := highestTrafficConfigIdInLatestRollout(rollouts)
+	if err != nil {
+		return "", err
+	}
+
+	percentages := rollouts.GetRollouts()[0].GetTrafficPercentStrategy().Percentages
+	var configIds []string
+	for configId := range percentages {
+		configIds = append(configIds, configId)
+	}
+	sort.Slice(configIds, func(i, j int) bool {
+		return newerConfigId(configIds[i], configIds[j])
+	})
+
+	bucket := trafficBucket(instance)
+	cumulative := 0.
+	for _, configId := range configIds {
+		cumulative += percentages[configId]
+		if bucket < cumulative {
+			return configId, nil
+		}
+	}
+	return highTrafficConfigId, nil
+}
+
+// newerConfigId compares the config ids generated by Service Management, e.g.
+// 2021-06-01r10 is newer than 2021-06-01r9.
+func newerConfigId(a, b string) bool {
+	aDate, aRev, aOk := splitConfigId(a)
+	bDate, bRev, bOk := splitConfigId(b)
+	if !aOk || !bOk {
+		return a > b
+	}
+	if aDate != bDate {
+		return aDate > bDate
+	}
+	return aRev > bRev
+}
+
+// splitConfigId splits the config id into its date and its revision.
+func splitConfigId(configId string) (string, int, bool) {
+	i := strings.LastIndex(configId, "r")
+	if i < 0 {
+		return "", 0, false
+	}
+	rev, err := strconv.Atoi(configId[i+1:])
+	if err != nil {
+		return "", 0, false
+	}
+	return configId[:i], rev, true
+}
+
+// trafficBucket hashes the instance into [0, 100) in steps of 0.01%.
+func trafficBucket(instance string) float64 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(instance))
+	return float64(h.Sum32()%10000) / 100
+}
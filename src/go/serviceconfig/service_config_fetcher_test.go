@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -228,3 +229,197 @@ func TestServiceConfigFetcherLoadConfigIdFromRollouts(t *testing.T) {
 		_test(tc.desc, tc.callGoogleapisOverridden, tc.serviceRollouts, tc.wantConfigId, tc.wantError)
 	}
 }
+
+func TestServiceConfigFetcherLoadLatestRollout(t *testing.T) {
+	listServiceRolloutsResponse, serviceConfig := genRolloutAndConfig("test-rollout-id", "test-config-id")
+	serviceManagementServer := initServiceManagementForTestServiceConfigFetcher(t, listServiceRolloutsResponse, serviceConfig, "service-name")
+	accessToken := func() (string, time.Duration, error) { return "access-token", time.Duration(60), nil }
+
+	scf := NewServiceConfigFetcher(&http.Client{}, serviceManagementServer.URL, "service-name", accessToken)
+	configId, rolloutId, err := scf.LoadLatestRollout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configId != "test-config-id" || rolloutId != "test-rollout-id" {
+		t.Errorf("got config id: %s, rollout id: %s, want: test-config-id, test-rollout-id", configId, rolloutId)
+	}
+}
+
+func TestServiceConfigFetcherFailover(t *testing.T) {
+	serviceName := "service-name"
+	_, serviceConfig := genRolloutAndConfig("test-rollout-id", "test-config-id")
+
+	var primaryCalls int
+	primaryServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryCalls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primaryServer.Close()
+	failoverServer := initServiceManagementForTestServiceConfigFetcher(t, nil, serviceConfig, serviceName)
+	defer failoverServer.Close()
+
+	accessToken := func() (string, time.Duration, error) { return "access-token", time.Duration(60), nil }
+	scf := NewServiceConfigFetcher(&http.Client{}, primaryServer.URL, serviceName, accessToken)
+	scf.SetFailoverUrls([]string{failoverServer.URL})
+
+	for i, wantPrimaryCalls := range []int{1, 1} {
+		getConfig, err := scf.FetchConfig(serviceConfig.Id)
+		if err != nil {
+			t.Fatalf("fetch %d, fail to fetch config: %v", i, err)
+		}
+		if !proto.Equal(getConfig, serviceConfig) {
+			t.Errorf("fetch %d, want service config: %v, get service config: %v", i, serviceConfig, getConfig)
+		}
+		// The failed primary server is skipped while it is unhealthy.
+		if primaryCalls != wantPrimaryCalls {
+			t.Errorf("fetch %d, want %d calls to the primary server, get %d", i, wantPrimaryCalls, primaryCalls)
+		}
+	}
+
+	// The primary server is tried first again once it is no longer unhealthy.
+	scf.serviceManagement.unhealthyUntil[primaryServer.URL] = time.Now()
+	if _, err := scf.FetchConfig(serviceConfig.Id); err != nil {
+		t.Fatalf("fail to fetch config: %v", err)
+	}
+	if primaryCalls != 2 {
+		t.Errorf("want 2 calls to the primary server, get %d", primaryCalls)
+	}
+}
+
+func TestTrafficSplitConfigIdInLatestRollout(t *testing.T) {
+	// The traffic buckets of the instances: esp-2 41.76, esp-3 17.95 and
+	// esp-4 98.9.
+	testCases := []struct {
+		desc         string
+		percentages  map[string]float64
+		instance     string
+		wantConfigId string
+	}{
+		{
+			desc: "the new config takes the lowest buckets",
+			percentages: map[string]float64{
+				"2021-06-01r9":  80,
+				"2021-06-01r10": 20,
+			},
+			instance:     "esp-3",
+			wantConfigId: "2021-06-01r10",
+		},
+		{
+			desc: "the old config takes the rest of the buckets",
+			percentages: map[string]float64{
+				"2021-06-01r9":  80,
+				"2021-06-01r10": 20,
+			},
+			instance:     "esp-2",
+			wantConfigId: "2021-06-01r9",
+		},
+		{
+			desc: "raising the percentage of the new config keeps its instances",
+			percentages: map[string]float64{
+				"2021-06-01r9":  50,
+				"2021-06-01r10": 50,
+			},
+			instance:     "esp-3",
+			wantConfigId: "2021-06-01r10",
+		},
+		{
+			desc: "raising the percentage of the new config adds instances",
+			percentages: map[string]float64{
+				"2021-06-01r9":  50,
+				"2021-06-01r10": 50,
+			},
+			instance:     "esp-2",
+			wantConfigId: "2021-06-01r10",
+		},
+		{
+			desc: "the config ids are ordered by date first",
+			percentages: map[string]float64{
+				"2021-06-01r10": 80,
+				"2021-06-02r0":  20,
+			},
+			instance:     "esp-3",
+			wantConfigId: "2021-06-02r0",
+		},
+		{
+			desc: "the buckets not covered by the percentages serve the highest one",
+			percentages: map[string]float64{
+				"2021-06-01r9":  85,
+				"2021-06-01r10": 10,
+			},
+			instance:     "esp-4",
+			wantConfigId: "2021-06-01r9",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			rollouts := &smpb.ListServiceRolloutsResponse{
+				Rollouts: []*smpb.Rollout{
+					{
+						Strategy: &smpb.Rollout_TrafficPercentStrategy_{
+							TrafficPercentStrategy: &smpb.Rollout_TrafficPercentStrategy{
+								Percentages: tc.percentages,
+							},
+						},
+					},
+				},
+			}
+			got, err := trafficSplitConfigIdInLatestRollout(rollouts, tc.instance)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.wantConfigId {
+				t.Errorf("got config id: %s, want: %s", got, tc.wantConfigId)
+			}
+		})
+	}
+}
+
+func TestNewerConfigId(t *testing.T) {
+	testCases := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "2021-06-01r10", b: "2021-06-01r9", want: true},
+		{a: "2021-06-01r9", b: "2021-06-01r10", want: false},
+		{a: "2021-06-02r0", b: "2021-06-01r10", want: true},
+		{a: "test-config-id-b", b: "test-config-id-a", want: true},
+	}
+
+	for _, tc := range testCases {
+		if got := newerConfigId(tc.a, tc.b); got != tc.want {
+			t.Errorf("newerConfigId(%s, %s) = %v, want: %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestServiceConfigFetcherNoFailoverOnClientError(t *testing.T) {
+	serviceName := "service-name"
+	_, serviceConfig := genRolloutAndConfig("test-rollout-id", "test-config-id")
+
+	primaryServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer primaryServer.Close()
+	var failoverCalls int
+	failoverServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failoverCalls++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer failoverServer.Close()
+
+	accessToken := func() (string, time.Duration, error) { return "access-token", time.Duration(60), nil }
+	scf := NewServiceConfigFetcher(&http.Client{}, primaryServer.URL, serviceName, accessToken)
+	scf.SetFailoverUrls([]string{failoverServer.URL})
+
+	if _, err := scf.FetchConfig(serviceConfig.Id); err == nil || !strings.Contains(err.Error(), "404 Not Found") {
+		t.Errorf("want error with 404 Not Found, get: %v", err)
+	}
+	if failoverCalls != 0 {
+		t.Errorf("want no calls to the failover server, get %d", failoverCalls)
+	}
+	// The primary server is not marked unhealthy by a client error.
+	if _, ok := scf.serviceManagement.unhealthyUntil[primaryServer.URL]; ok {
+		t.Errorf("want the primary server healthy")
+	}
+}
@@ -37,8 +37,15 @@ var (
 	}
 	tokenCache = &oauth2.Token{}
 	tokenMux   = sync.Mutex{}
+
+	// The ID tokens by their audiences, guarded by tokenMux as well.
+	idTokenCache = map[string]*oauth2.Token{}
 )
 
+// GetIdTokenFunc returns the ID token of the audience and how long it is
+// valid.
+type GetIdTokenFunc func(audience string) (string, time.Duration, error)
+
 var GenerateAccessTokenFromFile = func(saFilePath string) (string, time.Duration, error) {
 	if token, duration := activeAccessToken(); token != "" {
 		return token, duration, nil
@@ -52,8 +59,9 @@ var GenerateAccessTokenFromFile = func(saFilePath string) (string, time.Duration
 	return generateAccessToken(data)
 }
 
-// A test-friendly version of `GenerateAccessTokenFromFile`
-func generateAccessTokenFromData(saData []byte) (string, time.Duration, error) {
+// GenerateAccessTokenFromData is `GenerateAccessTokenFromFile` with the service
+// account key already loaded, e.g. from Secret Manager.
+func GenerateAccessTokenFromData(saData []byte) (string, time.Duration, error) {
 	if token, duration := activeAccessToken(); token != "" {
 		return token, duration, nil
 	}
@@ -94,8 +102,68 @@ func generateAccessToken(keyData []byte) (string, time.Duration, error) {
 	return token.AccessToken, token.Expiry.Sub(time.Now()), nil
 }
 
+var GenerateIdTokenFromFile = func(saFilePath, audience string) (string, time.Duration, error) {
+	if token, duration := activeIdToken(audience); token != "" {
+		return token, duration, nil
+	}
+
+	data, err := ioutil.ReadFile(saFilePath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return generateIdToken(data, audience)
+}
+
+// GenerateIdTokenFromData is `GenerateIdTokenFromFile` with the service account
+// key already loaded, e.g. from Secret Manager.
+func GenerateIdTokenFromData(saData []byte, audience string) (string, time.Duration, error) {
+	if token, duration := activeIdToken(audience); token != "" {
+		return token, duration, nil
+	}
+
+	return generateIdToken(saData, audience)
+}
+
+func activeIdToken(audience string) (string, time.Duration) {
+	now := time.Now()
+	tokenMux.Lock()
+	defer tokenMux.Unlock()
+
+	token := idTokenCache[audience]
+	if token == nil || now.After(token.Expiry.Add(-time.Second*60)) {
+		return "", 0
+	}
+
+	return token.AccessToken, token.Expiry.Sub(now)
+}
+
+// generateIdToken exchanges a JWT signed by the service account key for a
+// Google-signed ID token of the audience.
+func generateIdToken(keyData []byte, audience string) (string, time.Duration, error) {
+	conf, err := google.JWTConfigFromJSON(keyData)
+	if err != nil {
+		return "", 0, err
+	}
+	conf.PrivateClaims = map[string]interface{}{
+		"target_audience": audience,
+	}
+	conf.UseIDToken = true
+
+	token, err := conf.TokenSource(oauth2.NoContext).Token()
+	if err != nil {
+		return "", 0, err
+	}
+
+	tokenMux.Lock()
+	defer tokenMux.Unlock()
+
+	idTokenCache[audience] = token
+	return token.AccessToken, token.Expiry.Sub(time.Now()), nil
+}
+
 // Create the token agent handler to provide envoy with access
-// token generated by the service account credential.
+// token and ID tokens generated by the service account credential.
 //
 // It follows the following scheme:
 // Request: GET /local/access_token.
@@ -104,11 +172,42 @@ func generateAccessToken(keyData []byte) (string, time.Duration, error) {
 //   "access_token": "string",
 //   "expires_in": uint
 // }
+//
+// Request: GET /local/identity?audience=AUDIENCE, the same as the identity
+// path of the metadata server.
+// Response: the ID token.
 func MakeTokenAgentHandler(serviceAccountKey string) http.Handler {
+	return MakeTokenAgentHandlerFromFunc(func() (string, time.Duration, error) {
+		return GenerateAccessTokenFromFile(serviceAccountKey)
+	}, func(audience string) (string, time.Duration, error) {
+		return GenerateIdTokenFromFile(serviceAccountKey, audience)
+	})
+}
+
+// MakeTokenAgentHandlerFromFunc creates the token agent handler serving the
+// access tokens from accessToken, and the ID tokens from idToken.
+func MakeTokenAgentHandlerFromFunc(accessToken util.GetAccessTokenFunc, idToken GetIdTokenFunc) http.Handler {
 	r := mux.NewRouter()
 
+	r.PathPrefix(util.TokenAgentIdentityTokenPath).Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		audience := r.URL.Query().Get("audience")
+		if audience == "" {
+			http.Error(w, "missing audience", 400)
+			return
+		}
+
+		token, _, err := idToken(audience)
+		if err != nil {
+			glog.Errorf("local ID token agent had error: %v", err)
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		_, _ = w.Write([]byte(token))
+	})
+
 	r.PathPrefix(util.TokenAgentAccessTokenPath).Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token, expire, err := GenerateAccessTokenFromFile(serviceAccountKey)
+		token, expire, err := accessToken()
 
 		if err != nil {
 			glog.Errorf("local access token agent had error: %v", err)
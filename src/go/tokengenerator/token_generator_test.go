@@ -15,6 +15,7 @@
 package tokengenerator
 
 import (
+	"encoding/base64"
 	"fmt"
 	"net/http/httptest"
 	"strings"
@@ -36,7 +37,7 @@ func TestGenerateAccessToken(t *testing.T) {
 	fakeKey := strings.Replace(testdata.FakeServiceAccountKeyData, "FAKE-TOKEN-URI", mockTokenServer.GetURL(), 1)
 	fakeKeyData := []byte(fakeKey)
 
-	token, duration, err := generateAccessTokenFromData(fakeKeyData)
+	token, duration, err := GenerateAccessTokenFromData(fakeKeyData)
 	if token != "ya29.new" || duration.Seconds() < 3598 || err != nil {
 		t.Errorf("Test : Fail to make access token, got token: %s, duration: %v, err: %v", token, duration, err)
 	}
@@ -45,12 +46,43 @@ func TestGenerateAccessToken(t *testing.T) {
 	mockTokenServer.SetResp(latestFakeToken)
 
 	// The token is cached so the old token gets returned.
-	token, duration, err = generateAccessTokenFromData([]byte("Invalid data, not a service account"))
+	token, duration, err = GenerateAccessTokenFromData([]byte("Invalid data, not a service account"))
 	if token != "ya29.new" || err != nil {
 		t.Errorf("Test : Fail to make access token, got token: %s, duration: %v, err: %v", token, duration, err)
 	}
 }
 
+func TestGenerateIdToken(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	fakeIdToken := func(aud string) string {
+		encode := base64.RawURLEncoding.EncodeToString
+		return encode([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." +
+			encode([]byte(fmt.Sprintf(`{"aud":"%s","exp":%d}`, aud, exp))) + ".signature"
+	}
+	mockTokenServer := util.InitMockServer(fmt.Sprintf(`{"id_token": "%s"}`, fakeIdToken("foo.com")))
+	defer mockTokenServer.Close()
+
+	fakeKey := strings.Replace(testdata.FakeServiceAccountKeyData, "FAKE-TOKEN-URI", mockTokenServer.GetURL(), 1)
+	fakeKeyData := []byte(fakeKey)
+
+	token, duration, err := GenerateIdTokenFromData(fakeKeyData, "foo.com")
+	if token != fakeIdToken("foo.com") || duration.Seconds() < 3598 || err != nil {
+		t.Errorf("Test : Fail to make ID token, got token: %s, duration: %v, err: %v", token, duration, err)
+	}
+
+	mockTokenServer.SetResp(fmt.Sprintf(`{"id_token": "%s"}`, fakeIdToken("bar.com")))
+
+	// The token is cached per audience.
+	token, duration, err = GenerateIdTokenFromData([]byte("Invalid data, not a service account"), "foo.com")
+	if token != fakeIdToken("foo.com") || err != nil {
+		t.Errorf("Test : Fail to make ID token, got token: %s, duration: %v, err: %v", token, duration, err)
+	}
+	token, duration, err = GenerateIdTokenFromData(fakeKeyData, "bar.com")
+	if token != fakeIdToken("bar.com") || err != nil {
+		t.Errorf("Test : Fail to make ID token, got token: %s, duration: %v, err: %v", token, duration, err)
+	}
+}
+
 func TestMakeTokenAgentHandler(t *testing.T) {
 
 	s := httptest.NewServer(MakeTokenAgentHandler(platform.GetFilePath(platform.FakeServiceAccountFile)))
@@ -108,3 +140,56 @@ func TestMakeTokenAgentHandler(t *testing.T) {
 
 	}
 }
+
+func TestMakeTokenAgentHandlerIdToken(t *testing.T) {
+	s := httptest.NewServer(MakeTokenAgentHandler(platform.GetFilePath(platform.FakeServiceAccountFile)))
+	defer s.Close()
+
+	originalGenerateIdTokenFromFile := GenerateIdTokenFromFile
+	defer func() { GenerateIdTokenFromFile = originalGenerateIdTokenFromFile }()
+	GenerateIdTokenFromFile = func(saFilePath, audience string) (string, time.Duration, error) {
+		if audience == "bad.com" {
+			return "", 0, fmt.Errorf("gen-id-token-error")
+		}
+		return "id-token-of-" + audience, time.Duration(time.Second * 100), nil
+	}
+
+	testCases := []struct {
+		desc      string
+		path      string
+		wantResp  string
+		wantError string
+	}{
+		{
+			desc:     "success, get ID token in the format of the metadata server",
+			path:     "/local/identity?format=standard&audience=foo.com",
+			wantResp: "id-token-of-foo.com",
+		},
+		{
+			desc:      "fail, missing audience",
+			path:      "/local/identity",
+			wantError: "400 Bad Request",
+		},
+		{
+			desc:      "fail, error in generating ID token",
+			path:      "/local/identity?audience=bad.com",
+			wantError: "500 Internal Server Error, gen-id-token-error",
+		},
+	}
+
+	for _, tc := range testCases {
+		_, resp, err := utils.DoWithHeaders(s.URL+tc.path, "GET", "", nil)
+		if tc.wantError != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("test(%s): get error: %v, want error: %s", tc.desc, err, tc.wantError)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test(%s): get error: %v", tc.desc, err)
+		}
+		if tc.wantResp != string(resp) {
+			t.Errorf("test(%s): get resp: %s, want resp %s", tc.desc, string(resp), tc.wantResp)
+		}
+	}
+}
@@ -21,7 +21,9 @@ import (
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/metadata"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 
 	opencensuspb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
@@ -30,6 +32,9 @@ import (
 	typepb "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 )
 
+// The zipkin v2 api used if the collector url has no path.
+const defaultZipkinCollectorEndpoint = "/api/v2/spans"
+
 func createTraceContexts(ctx_str string) ([]tracepb.OpenCensusConfig_TraceContext, error) {
 	var out []tracepb.OpenCensusConfig_TraceContext
 
@@ -45,8 +50,10 @@ func createTraceContexts(ctx_str string) ([]tracepb.OpenCensusConfig_TraceContex
 			out = append(out, tracepb.OpenCensusConfig_GRPC_TRACE_BIN)
 		case "x-cloud-trace-context":
 			out = append(out, tracepb.OpenCensusConfig_CLOUD_TRACE_CONTEXT)
+		case "b3":
+			out = append(out, tracepb.OpenCensusConfig_B3)
 		default:
-			return out, fmt.Errorf("Invalid trace context: %v. It must be one of (traceparent|grpc-trace-bin|x-cloud-trace-context)", ctx)
+			return out, fmt.Errorf("Invalid trace context: %v. It must be one of (traceparent|grpc-trace-bin|x-cloud-trace-context|b3)", ctx)
 		}
 	}
 
@@ -109,15 +116,55 @@ func createOpenCensusConfig(opts options.CommonOptions) (*tracepb.OpenCensusConf
 	return cfg, nil
 }
 
-// CreateTracing outputs envoy HCM tracing config.
-func CreateTracing(opts options.CommonOptions) (*hcmpb.HttpConnectionManager_Tracing, error) {
+func createZipkinConfig(opts options.CommonOptions) (*tracepb.ZipkinConfig, error) {
+	_, hostname, _, path, err := util.ParseURI(opts.TracingZipkinCollectorUrl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tracing_zipkin_collector_url: %v", err)
+	}
+	if path == "" {
+		path = defaultZipkinCollectorEndpoint
+	}
 
-	openCensusConfig, err := createOpenCensusConfig(opts)
+	return &tracepb.ZipkinConfig{
+		CollectorCluster:         util.ZipkinCollectorClusterName,
+		CollectorEndpoint:        path,
+		CollectorEndpointVersion: tracepb.ZipkinConfig_HTTP_JSON,
+		CollectorHostname:        hostname,
+		TraceId_128Bit:           true,
+	}, nil
+}
+
+// createTracingProvider exports the spans to Zipkin if the collector is set,
+// otherwise to Stackdriver via OpenCensus.
+func createTracingProvider(opts options.CommonOptions) (*tracepb.Tracing_Http, error) {
+	var name string
+	var config proto.Message
+	var err error
+	if opts.TracingZipkinCollectorUrl != "" {
+		name = "envoy.tracers.zipkin"
+		config, err = createZipkinConfig(opts)
+	} else {
+		name = "envoy.tracers.opencensus"
+		config, err = createOpenCensusConfig(opts)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	typedConfig, err := ptypes.MarshalAny(openCensusConfig)
+	typedConfig, err := ptypes.MarshalAny(config)
+	if err != nil {
+		return nil, err
+	}
+	return &tracepb.Tracing_Http{
+		Name:       name,
+		ConfigType: &tracepb.Tracing_Http_TypedConfig{TypedConfig: typedConfig},
+	}, nil
+}
+
+// CreateTracing outputs envoy HCM tracing config.
+func CreateTracing(opts options.CommonOptions) (*hcmpb.HttpConnectionManager_Tracing, error) {
+
+	provider, err := createTracingProvider(opts)
 	if err != nil {
 		return nil, err
 	}
@@ -140,9 +187,6 @@ func CreateTracing(opts options.CommonOptions) (*hcmpb.HttpConnectionManager_Tra
 		OverallSampling: &typepb.Percent{
 			Value: percentSampleRate,
 		},
-		Provider: &tracepb.Tracing_Http{
-			Name:       "envoy.tracers.opencensus",
-			ConfigType: &tracepb.Tracing_Http_TypedConfig{TypedConfig: typedConfig},
-		},
+		Provider: provider,
 	}, nil
 }
@@ -25,6 +25,7 @@ import (
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 	typepb "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
 
 	opencensuspb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
 	tracepb "github.com/envoyproxy/go-control-plane/envoy/config/trace/v3"
@@ -112,6 +113,33 @@ func TestNonGcpOpenCensusConfig(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc:                       "Success with b3 tracing contexts",
+			tracingProjectId:           fakeOptsProjectId,
+			tracingIncomingContext:     "b3,x-cloud-trace-context",
+			tracingOutgoingContext:     "b3",
+			tracingMaxNumAttributes:    defaultOpts.TracingMaxNumAttributes,
+			tracingMaxNumAnnotations:   defaultOpts.TracingMaxNumAnnotations,
+			tracingMaxNumMessageEvents: defaultOpts.TracingMaxNumMessageEvents,
+			tracingMaxNumLinks:         defaultOpts.TracingMaxNumLinks,
+			wantResult: &tracepb.OpenCensusConfig{
+				TraceConfig: &opencensuspb.TraceConfig{
+					MaxNumberOfAttributes:    defaultOpts.TracingMaxNumAttributes,
+					MaxNumberOfAnnotations:   defaultOpts.TracingMaxNumAnnotations,
+					MaxNumberOfMessageEvents: defaultOpts.TracingMaxNumMessageEvents,
+					MaxNumberOfLinks:         defaultOpts.TracingMaxNumLinks,
+				},
+				StackdriverExporterEnabled: true,
+				StackdriverProjectId:       fakeOptsProjectId,
+				IncomingTraceContext: []tracepb.OpenCensusConfig_TraceContext{
+					tracepb.OpenCensusConfig_B3,
+					tracepb.OpenCensusConfig_CLOUD_TRACE_CONTEXT,
+				},
+				OutgoingTraceContext: []tracepb.OpenCensusConfig_TraceContext{
+					tracepb.OpenCensusConfig_B3,
+				},
+			},
+		},
 		{
 			desc:                       "Success with custom stackdriver address",
 			tracingProjectId:           fakeOptsProjectId,
@@ -387,6 +415,74 @@ func TestHcmTracingSampleRate(t *testing.T) {
 	}
 }
 
+func TestZipkinTracing(t *testing.T) {
+	testData := []struct {
+		desc                      string
+		tracingZipkinCollectorUrl string
+		wantError                 string
+		wantResult                *tracepb.ZipkinConfig
+	}{
+		{
+			desc:                      "Zipkin collector with the default endpoint",
+			tracingZipkinCollectorUrl: "http://zipkin:9411",
+			wantResult: &tracepb.ZipkinConfig{
+				CollectorCluster:         util.ZipkinCollectorClusterName,
+				CollectorEndpoint:        "/api/v2/spans",
+				CollectorEndpointVersion: tracepb.ZipkinConfig_HTTP_JSON,
+				CollectorHostname:        "zipkin",
+				TraceId_128Bit:           true,
+			},
+		},
+		{
+			desc:                      "Zipkin collector with a custom endpoint",
+			tracingZipkinCollectorUrl: "https://otel-collector.example.com/zipkin/spans",
+			wantResult: &tracepb.ZipkinConfig{
+				CollectorCluster:         util.ZipkinCollectorClusterName,
+				CollectorEndpoint:        "/zipkin/spans",
+				CollectorEndpointVersion: tracepb.ZipkinConfig_HTTP_JSON,
+				CollectorHostname:        "otel-collector.example.com",
+				TraceId_128Bit:           true,
+			},
+		},
+		{
+			desc:                      "Invalid zipkin collector url",
+			tracingZipkinCollectorUrl: "http://zipkin:port",
+			wantError:                 "invalid tracing_zipkin_collector_url",
+		},
+	}
+
+	for _, tc := range testData {
+		// The project id is not needed, so the metadata server is unreachable.
+		runTest(t, false, func() {
+			opts := options.DefaultCommonOptions()
+			opts.NonGCP = true
+			opts.TracingZipkinCollectorUrl = tc.tracingZipkinCollectorUrl
+
+			got, err := CreateTracing(opts)
+			if tc.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+					t.Errorf("Test (%s): failed, expected err: %v, got: %v", tc.desc, tc.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Test (%s): failed with error: %v", tc.desc, err)
+			}
+
+			if got.Provider.Name != "envoy.tracers.zipkin" {
+				t.Errorf("Test (%s): failed, got provider: %s, want: envoy.tracers.zipkin", tc.desc, got.Provider.Name)
+			}
+			gotConfig := &tracepb.ZipkinConfig{}
+			if err := ptypes.UnmarshalAny(got.Provider.GetTypedConfig(), gotConfig); err != nil {
+				t.Fatalf("Test (%s): failed to unmarshal zipkin config: %v", tc.desc, err)
+			}
+			if !proto.Equal(gotConfig, tc.wantResult) {
+				t.Errorf("Test (%s): failed, got : %v, want: %v", tc.desc, gotConfig, tc.wantResult)
+			}
+		})
+	}
+}
+
 // Tests the various cases for automatically determining the project-id in any environment
 func TestDetermineProjectId(t *testing.T) {
 	testData := []struct {
@@ -0,0 +1,193 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jsonlog converts the glog output into structured JSON entries, which
+// can be ingested by Cloud Logging or ELK without parsing rules.
+package jsonlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// The glog header: Lmmdd hh:mm:ss.uuuuuu threadid file:line] msg
+	glogHeaderRegex = regexp.MustCompile(`^([IWEF])(\d{4} \d{2}:\d{2}:\d{2}\.\d{6})\s+\d+ ([^:\]]+):(\d+)\] ?(.*)$`)
+
+	// The glog severities in the Cloud Logging severities.
+	glogSeverities = map[string]string{
+		"I": "INFO",
+		"W": "WARNING",
+		"E": "ERROR",
+		"F": "CRITICAL",
+	}
+
+	// The lines longer than this are truncated.
+	maxLineSize = 1024 * 1024
+
+	mutex  sync.Mutex
+	fields = make(map[string]string)
+
+	// The stderr pipe and the signal of the converter reaching a flush marker,
+	// only set once stderr is redirected.
+	pipe    *os.File
+	flushed = make(chan struct{}, 1)
+)
+
+// The line written by Flush to find out when the lines before it are
+// converted.
+const flushMarker = "\x00jsonlog flush\x00"
+
+// SetField sets a field added to all the following entries, e.g. the id of
+// the served service config. An empty value removes the field.
+func SetField(key, value string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if value == "" {
+		delete(fields, key)
+		return
+	}
+	fields[key] = value
+}
+
+// RedirectStderr converts everything written to stderr into JSON entries, one
+// per line. glog writes to stderr with --logtostderr, so it must be called
+// before anything is logged.
+//
+// The conversion is asynchronous, Flush must be called before the process
+// exits so the last entries are not lost.
+func RedirectStderr() error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("fail to redirect stderr: %v", err)
+	}
+
+	stderr := os.Stderr
+	os.Stderr = w
+	pipe = w
+	go convert(r, stderr, time.Now)
+	return nil
+}
+
+// Flush waits up to timeout until everything written to stderr so far is
+// converted. It does nothing if stderr is not redirected.
+func Flush(timeout time.Duration) {
+	if pipe == nil {
+		return
+	}
+	// Drain a stale signal of a flush that timed out.
+	select {
+	case <-flushed:
+	default:
+	}
+	if _, err := pipe.WriteString(flushMarker + "\n"); err != nil {
+		return
+	}
+	select {
+	case <-flushed:
+	case <-time.After(timeout):
+	}
+}
+
+// convert writes each line of r as a JSON entry into w. The lines without the
+// glog header, e.g. the continued lines of a multi-line message, inherit the
+// severity of the previous entry.
+func convert(r io.Reader, w io.Writer, now func() time.Time) {
+	reader := bufio.NewReaderSize(r, 64*1024)
+
+	severity := glogSeverities["I"]
+	for {
+		line, err := readLine(reader)
+		if line == flushMarker {
+			select {
+			case flushed <- struct{}{}:
+			default:
+			}
+			continue
+		}
+		if err == nil || line != "" {
+			var entry map[string]interface{}
+			entry, severity = makeEntry(line, severity, now())
+			if b, err := json.Marshal(entry); err == nil {
+				_, _ = w.Write(append(b, '\n'))
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readLine reads a line without the line break. The lines longer than
+// maxLineSize are truncated, and the rest of them is skipped, so a long line
+// does not stop the conversion.
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	truncated := false
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return string(line), err
+		}
+		if room := maxLineSize - len(line); len(chunk) > room {
+			chunk = chunk[:room]
+			truncated = true
+		}
+		line = append(line, chunk...)
+		if !isPrefix {
+			break
+		}
+	}
+	if truncated {
+		return string(line) + " ...(truncated)", nil
+	}
+	return string(line), nil
+}
+
+func makeEntry(line, prevSeverity string, now time.Time) (map[string]interface{}, string) {
+	entry := map[string]interface{}{
+		"severity": prevSeverity,
+		"time":     now.Format(time.RFC3339Nano),
+		"message":  line,
+	}
+
+	if match := glogHeaderRegex.FindStringSubmatch(line); match != nil {
+		entry["severity"] = glogSeverities[match[1]]
+		// The glog header has no year.
+		if t, err := time.ParseInLocation("0102 15:04:05.000000", match[2], now.Location()); err == nil {
+			entry["time"] = t.AddDate(now.Year(), 0, 0).Format(time.RFC3339Nano)
+		}
+		lineNumber, _ := strconv.Atoi(match[4])
+		entry["logging.googleapis.com/sourceLocation"] = map[string]interface{}{
+			"file": match[3],
+			"line": lineNumber,
+		}
+		entry["message"] = match[5]
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	for key, value := range fields {
+		entry[key] = value
+	}
+	return entry, entry["severity"].(string)
+}
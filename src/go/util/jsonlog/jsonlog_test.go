@@ -0,0 +1,137 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonlog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+)
+
+func TestConvert(t *testing.T) {
+	testData := []struct {
+		desc        string
+		fields      map[string]string
+		maxLineSize int
+		input       string
+		wantLines   []string
+	}{
+		{
+			desc:  "glog entry",
+			input: "I1015 10:01:02.123456    1234 config_manager.go:300] making configuration for api: bookstore\n",
+			wantLines: []string{
+				`{
+					"logging.googleapis.com/sourceLocation": {"file": "config_manager.go", "line": 300},
+					"message": "making configuration for api: bookstore",
+					"severity": "INFO",
+					"time": "2021-10-15T10:01:02.123456Z"
+				}`,
+			},
+		},
+		{
+			desc: "Multi-line entry with the fields",
+			fields: map[string]string{
+				"service_name": "bookstore.endpoints.project123.cloud.goog",
+				"config_id":    "2021-10-01r0",
+			},
+			input: "E1015 10:01:02.123456    1234 server.go:42] fail to serve:\nconnection refused\n",
+			wantLines: []string{
+				`{
+					"config_id": "2021-10-01r0",
+					"logging.googleapis.com/sourceLocation": {"file": "server.go", "line": 42},
+					"message": "fail to serve:",
+					"service_name": "bookstore.endpoints.project123.cloud.goog",
+					"severity": "ERROR",
+					"time": "2021-10-15T10:01:02.123456Z"
+				}`,
+				`{
+					"config_id": "2021-10-01r0",
+					"message": "connection refused",
+					"service_name": "bookstore.endpoints.project123.cloud.goog",
+					"severity": "ERROR",
+					"time": "2021-10-15T10:30:00Z"
+				}`,
+			},
+		},
+		{
+			desc:        "Long line is truncated and the conversion goes on",
+			maxLineSize: 64,
+			input:       "W1015 10:01:02.123456    1234 config_manager.go:300] " + strings.Repeat("x", 200) + "\nI1015 10:01:03.000000    1234 config_manager.go:301] next\n",
+			wantLines: []string{
+				`{
+					"logging.googleapis.com/sourceLocation": {"file": "config_manager.go", "line": 300},
+					"message": "` + strings.Repeat("x", 11) + ` ...(truncated)",
+					"severity": "WARNING",
+					"time": "2021-10-15T10:01:02.123456Z"
+				}`,
+				`{
+					"logging.googleapis.com/sourceLocation": {"file": "config_manager.go", "line": 301},
+					"message": "next",
+					"severity": "INFO",
+					"time": "2021-10-15T10:01:03Z"
+				}`,
+			},
+		},
+		{
+			desc:  "Last line without the line break",
+			input: "I1015 10:01:02.123456    1234 server.go:42] exiting",
+			wantLines: []string{
+				`{
+					"logging.googleapis.com/sourceLocation": {"file": "server.go", "line": 42},
+					"message": "exiting",
+					"severity": "INFO",
+					"time": "2021-10-15T10:01:02.123456Z"
+				}`,
+			},
+		},
+	}
+
+	now := func() time.Time {
+		return time.Date(2021, 10, 15, 10, 30, 0, 0, time.UTC)
+	}
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			if tc.maxLineSize > 0 {
+				defaultMaxLineSize := maxLineSize
+				maxLineSize = tc.maxLineSize
+				defer func() { maxLineSize = defaultMaxLineSize }()
+			}
+			for key, value := range tc.fields {
+				SetField(key, value)
+			}
+			defer func() {
+				for key := range tc.fields {
+					SetField(key, "")
+				}
+			}()
+
+			var out bytes.Buffer
+			convert(strings.NewReader(tc.input), &out, now)
+
+			gotLines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			if len(gotLines) != len(tc.wantLines) {
+				t.Fatalf("got %d entries: %s, want %d entries", len(gotLines), out.String(), len(tc.wantLines))
+			}
+			for i, gotLine := range gotLines {
+				if err := util.JsonEqual(tc.wantLines[i], gotLine); err != nil {
+					t.Errorf("convert failed for entry %d, \n %v", i, err)
+				}
+			}
+		})
+	}
+}
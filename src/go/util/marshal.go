@@ -22,6 +22,7 @@ import (
 	"github.com/golang/protobuf/proto"
 
 	bapb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/v10/http/backend_auth"
+	hslpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/v10/http/header_size_limit"
 	prpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/v10/http/path_rewrite"
 	scpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/v10/http/service_control"
 
@@ -30,19 +31,28 @@ import (
 	tracepb "github.com/envoyproxy/go-control-plane/envoy/config/trace/v3"
 	accessfilepb "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/file/v3"
 	accessgrpcpb "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/grpc/v3"
+	brotlipb "github.com/envoyproxy/go-control-plane/envoy/extensions/compression/brotli/compressor/v3"
+	gzippb "github.com/envoyproxy/go-control-plane/envoy/extensions/compression/gzip/compressor/v3"
+	bufferpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/buffer/v3"
+	compressorpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/compressor/v3"
+	corspb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/cors/v3"
 	transcoderpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/grpc_json_transcoder/v3"
 	gspb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/grpc_stats/v3"
 	jwtpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/jwt_authn/v3"
+	rbacpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/rbac/v3"
 	routerpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/router/v3"
 	hcmpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 	tlspb "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	httppb "github.com/envoyproxy/go-control-plane/envoy/extensions/upstreams/http/v3"
 
+	emptypb "github.com/golang/protobuf/ptypes/empty"
 	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
 	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
 	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
 	servicecontrolpb "google.golang.org/genproto/googleapis/api/servicecontrol/v1"
 	smpb "google.golang.org/genproto/googleapis/api/servicemanagement/v1"
+	secretpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+	pubsubpb "google.golang.org/genproto/googleapis/pubsub/v1"
 )
 
 // Helper to convert Json string to protobuf.Any.
@@ -78,6 +88,18 @@ var Resolver = FuncResolver(func(url string) (proto.Message, error) {
 		return new(wrapperspb.UInt32Value), nil
 	case "type.googleapis.com/google.api.Service":
 		return new(confpb.Service), nil
+	case "type.googleapis.com/envoy.extensions.filters.http.buffer.v3.Buffer":
+		return new(bufferpb.Buffer), nil
+	case "type.googleapis.com/envoy.extensions.filters.http.buffer.v3.BufferPerRoute":
+		return new(bufferpb.BufferPerRoute), nil
+	case "type.googleapis.com/envoy.extensions.filters.http.compressor.v3.Compressor":
+		return new(compressorpb.Compressor), nil
+	case "type.googleapis.com/envoy.extensions.compression.gzip.compressor.v3.Gzip":
+		return new(gzippb.Gzip), nil
+	case "type.googleapis.com/envoy.extensions.compression.brotli.compressor.v3.Brotli":
+		return new(brotlipb.Brotli), nil
+	case "type.googleapis.com/envoy.extensions.filters.http.cors.v3.Cors":
+		return new(corspb.Cors), nil
 	case "type.googleapis.com/envoy.extensions.filters.http.grpc_stats.v3.FilterConfig":
 		return new(gspb.FilterConfig), nil
 	case "type.googleapis.com/envoy.extensions.filters.http.grpc_json_transcoder.v3.GrpcJsonTranscoder":
@@ -86,10 +108,16 @@ var Resolver = FuncResolver(func(url string) (proto.Message, error) {
 		return new(jwtpb.JwtAuthentication), nil
 	case "type.googleapis.com/envoy.extensions.filters.http.jwt_authn.v3.PerRouteConfig":
 		return new(jwtpb.PerRouteConfig), nil
+	case "type.googleapis.com/envoy.extensions.filters.http.rbac.v3.RBAC":
+		return new(rbacpb.RBAC), nil
+	case "type.googleapis.com/envoy.extensions.filters.http.rbac.v3.RBACPerRoute":
+		return new(rbacpb.RBACPerRoute), nil
 	case "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager":
 		return new(hcmpb.HttpConnectionManager), nil
 	case "type.googleapis.com/espv2.api.envoy.v10.http.path_rewrite.PerRouteFilterConfig":
 		return new(prpb.PerRouteFilterConfig), nil
+	case "type.googleapis.com/espv2.api.envoy.v10.http.header_size_limit.PerRouteFilterConfig":
+		return new(hslpb.PerRouteFilterConfig), nil
 	case "type.googleapis.com/espv2.api.envoy.v10.http.service_control.PerRouteFilterConfig":
 		return new(scpb.PerRouteFilterConfig), nil
 	case "type.googleapis.com/espv2.api.envoy.v10.http.service_control.FilterConfig":
@@ -120,6 +148,8 @@ var Resolver = FuncResolver(func(url string) (proto.Message, error) {
 		return new(statspb.StatsSink), nil
 	case "type.googleapis.com/envoy.config.metrics.v3.StatsdSink":
 		return new(statspb.StatsdSink), nil
+	case "type.googleapis.com/envoy.config.metrics.v3.DogStatsdSink":
+		return new(statspb.DogStatsdSink), nil
 	case "type.googleapis.com/envoy.config.trace.v3.OpenCensusConfig":
 		return new(tracepb.OpenCensusConfig), nil
 	default:
@@ -143,6 +173,18 @@ var UnmarshalBytesToPbMessage = func(input []byte, output proto.Message) error {
 			return fmt.Errorf("fail to unmarshal %T: %v", t, err)
 		}
 		return nil
+	case *secretpb.AccessSecretVersionResponse:
+		if err := proto.Unmarshal(input, output.(*secretpb.AccessSecretVersionResponse)); err != nil {
+			return fmt.Errorf("fail to unmarshal %T: %v", t, err)
+		}
+	case *pubsubpb.PullResponse:
+		if err := proto.Unmarshal(input, output.(*pubsubpb.PullResponse)); err != nil {
+			return fmt.Errorf("fail to unmarshal %T: %v", t, err)
+		}
+	case *emptypb.Empty:
+		if err := proto.Unmarshal(input, output.(*emptypb.Empty)); err != nil {
+			return fmt.Errorf("fail to unmarshal %T: %v", t, err)
+		}
 	default:
 		return fmt.Errorf("not support unmarshalling %T", t)
 	}
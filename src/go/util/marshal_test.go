@@ -29,6 +29,7 @@ import (
 	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
 	scpb "google.golang.org/genproto/googleapis/api/servicecontrol/v1"
 	smpb "google.golang.org/genproto/googleapis/api/servicemanagement/v1"
+	pubsubpb "google.golang.org/genproto/googleapis/pubsub/v1"
 )
 
 func TestResolver(t *testing.T) {
@@ -41,6 +42,7 @@ func TestResolver(t *testing.T) {
 		{msg: &accessgrpcpb.CommonGrpcAccessLogConfig{}},
 		{msg: &statspb.StatsSink{}},
 		{msg: &statspb.StatsdSink{}},
+		{msg: &statspb.DogStatsdSink{}},
 		{msg: &statspb.StatsConfig{}},
 	}
 
@@ -89,6 +91,17 @@ func TestUnmarshalBytesToPbMessage(t *testing.T) {
 			},
 			getRespHolder: &scpb.ReportResponse{},
 		},
+		{
+			desc: "unmarshal PullResponse",
+			wantResp: &pubsubpb.PullResponse{
+				ReceivedMessages: []*pubsubpb.ReceivedMessage{
+					{
+						AckId: "ack-id",
+					},
+				},
+			},
+			getRespHolder: &pubsubpb.PullResponse{},
+		},
 		{
 			desc:          "unmarshal ReportRequest",
 			getRespHolder: &scpb.ReportRequest{},
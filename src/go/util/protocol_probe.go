@@ -0,0 +1,89 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	// The connection preface sent by HTTP/2 clients, followed by a SETTINGS frame.
+	http2ClientPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+	// The frame header length and the SETTINGS frame type of HTTP/2.
+	http2FrameHeaderLen    = 9
+	http2SettingsFrameType = 0x4
+	// The ALPN protocol ids.
+	alpnHttp1 = "http/1.1"
+	alpnHttp2 = "h2"
+)
+
+// ProbeBackendHttpProtocol detects whether the backend at hostname:port speaks
+// HTTP/2, returning "h2" or "http/1.1".
+//
+// TLS backends are probed by ALPN. Cleartext backends are sent the HTTP/2
+// connection preface, and are considered h2c if they reply with a SETTINGS frame.
+func ProbeBackendHttpProtocol(hostname string, port uint32, useTLS bool, timeout time.Duration) (string, error) {
+	address := net.JoinHostPort(hostname, strconv.Itoa(int(port)))
+	dialer := &net.Dialer{Timeout: timeout}
+
+	if useTLS {
+		conn, err := tls.DialWithDialer(dialer, "tcp", address, &tls.Config{
+			ServerName: hostname,
+			NextProtos: []string{alpnHttp2, alpnHttp1},
+			// Only the negotiated protocol is used, the certificate is verified
+			// by Envoy when proxying the requests.
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			return "", fmt.Errorf("fail to connect to backend %s: %v", address, err)
+		}
+		defer conn.Close()
+
+		if conn.ConnectionState().NegotiatedProtocol == alpnHttp2 {
+			return alpnHttp2, nil
+		}
+		return alpnHttp1, nil
+	}
+
+	conn, err := dialer.Dial("tcp", address)
+	if err != nil {
+		return "", fmt.Errorf("fail to connect to backend %s: %v", address, err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return "", err
+	}
+	// The preface followed by an empty SETTINGS frame.
+	preface := append([]byte(http2ClientPreface), 0, 0, 0, http2SettingsFrameType, 0, 0, 0, 0, 0)
+	if _, err := conn.Write(preface); err != nil {
+		return "", fmt.Errorf("fail to write to backend %s: %v", address, err)
+	}
+
+	frameHeader := make([]byte, http2FrameHeaderLen)
+	if _, err := io.ReadFull(conn, frameHeader); err != nil {
+		// HTTP/1.1 servers may close the connection on the unknown preface.
+		return alpnHttp1, nil
+	}
+	if frameHeader[3] == http2SettingsFrameType {
+		return alpnHttp2, nil
+	}
+	return alpnHttp1, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestProbeBackendHttpProtocol(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	http1Server := httptest.NewServer(handler)
+	defer http1Server.Close()
+
+	h2cServer := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer h2cServer.Close()
+
+	http1TLSServer := httptest.NewTLSServer(handler)
+	defer http1TLSServer.Close()
+
+	h2TLSServer := httptest.NewUnstartedServer(handler)
+	h2TLSServer.EnableHTTP2 = true
+	h2TLSServer.StartTLS()
+	defer h2TLSServer.Close()
+
+	testData := []struct {
+		desc         string
+		server       *httptest.Server
+		useTLS       bool
+		wantProtocol string
+	}{
+		{
+			desc:         "cleartext HTTP/1.1 backend",
+			server:       http1Server,
+			wantProtocol: "http/1.1",
+		},
+		{
+			desc:         "cleartext HTTP/2 backend",
+			server:       h2cServer,
+			wantProtocol: "h2",
+		},
+		{
+			desc:         "TLS HTTP/1.1 backend",
+			server:       http1TLSServer,
+			useTLS:       true,
+			wantProtocol: "http/1.1",
+		},
+		{
+			desc:         "TLS HTTP/2 backend",
+			server:       h2TLSServer,
+			useTLS:       true,
+			wantProtocol: "h2",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			host, port, err := net.SplitHostPort(tc.server.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			portNum, _ := strconv.Atoi(port)
+
+			gotProtocol, err := ProbeBackendHttpProtocol(host, uint32(portNum), tc.useTLS, 5*time.Second)
+			if err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+			if gotProtocol != tc.wantProtocol {
+				t.Errorf("got protocol: %v, want: %v", gotProtocol, tc.wantProtocol)
+			}
+		})
+	}
+}
+
+func TestProbeBackendHttpProtocolUnreachable(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := lis.Addr().(*net.TCPAddr).Port
+	lis.Close()
+
+	if _, err := ProbeBackendHttpProtocol("127.0.0.1", uint32(port), false, time.Second); err == nil {
+		t.Errorf("want error for unreachable backend, got nil")
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// The metadata server is only reachable from the VM itself, it is never
+// called through a proxy.
+var metadataServerHosts = []string{"metadata.google.internal", "169.254.169.254"}
+
+// ProxyFunc returns the function used to select the outbound proxy for calls
+// made to Google APIs and JWKS endpoints.
+//
+// The HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables are always
+// honored. If proxyURL is not empty, it overrides both HTTP_PROXY and
+// HTTPS_PROXY, while hosts listed in NO_PROXY and the metadata server still
+// bypass the proxy.
+func ProxyFunc(proxyURL string) func(*http.Request) (*url.URL, error) {
+	proxyFunc := proxyConfig(proxyURL).ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+}
+
+// ProxyForHost returns the proxy of the calls to the host:port over the
+// scheme, selected as ProxyFunc does. It is nil if the calls bypass the proxy.
+func ProxyForHost(proxyURL, scheme, host string) (*url.URL, error) {
+	return proxyConfig(proxyURL).ProxyFunc()(&url.URL{Scheme: scheme, Host: host})
+}
+
+func proxyConfig(proxyURL string) *httpproxy.Config {
+	cfg := httpproxy.FromEnvironment()
+	if proxyURL != "" {
+		cfg.HTTPProxy = proxyURL
+		cfg.HTTPSProxy = proxyURL
+	}
+	noProxy := metadataServerHosts
+	if cfg.NoProxy != "" {
+		noProxy = append([]string{cfg.NoProxy}, noProxy...)
+	}
+	cfg.NoProxy = strings.Join(noProxy, ",")
+	return cfg
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestProxyFunc(t *testing.T) {
+	testData := []struct {
+		desc       string
+		proxyURL   string
+		httpsProxy string
+		noProxy    string
+		requestURL string
+		wantProxy  string
+	}{
+		{
+			desc:       "no proxy configured",
+			requestURL: "https://servicemanagement.googleapis.com/v1/services",
+		},
+		{
+			desc:       "HTTPS_PROXY is honored",
+			httpsProxy: "http://env-proxy:3128",
+			requestURL: "https://servicemanagement.googleapis.com/v1/services",
+			wantProxy:  "http://env-proxy:3128",
+		},
+		{
+			desc:       "flag overrides HTTPS_PROXY",
+			proxyURL:   "http://flag-proxy:8080",
+			httpsProxy: "http://env-proxy:3128",
+			requestURL: "https://servicemanagement.googleapis.com/v1/services",
+			wantProxy:  "http://flag-proxy:8080",
+		},
+		{
+			desc:       "flag is applied to http requests",
+			proxyURL:   "http://flag-proxy:8080",
+			requestURL: "http://www.example.com/.well-known/openid-configuration",
+			wantProxy:  "http://flag-proxy:8080",
+		},
+		{
+			desc:       "metadata server bypasses the flag",
+			proxyURL:   "http://flag-proxy:8080",
+			requestURL: "http://metadata.google.internal/computeMetadata/v1/project/project-id",
+		},
+		{
+			desc:       "metadata server ip bypasses HTTP_PROXY",
+			httpsProxy: "http://env-proxy:3128",
+			noProxy:    ".googleapis.com",
+			requestURL: "https://169.254.169.254/computeMetadata/v1/project/project-id",
+		},
+		{
+			desc:       "NO_PROXY bypasses the flag",
+			proxyURL:   "http://flag-proxy:8080",
+			noProxy:    "169.254.169.254,.googleapis.com",
+			requestURL: "https://servicecontrol.googleapis.com/v1/services",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			for key, value := range map[string]string{
+				"HTTPS_PROXY": tc.httpsProxy,
+				"HTTP_PROXY":  "",
+				"NO_PROXY":    tc.noProxy,
+			} {
+				oldValue, ok := os.LookupEnv(key)
+				os.Setenv(key, value)
+				if ok {
+					defer os.Setenv(key, oldValue)
+				} else {
+					defer os.Unsetenv(key)
+				}
+			}
+
+			req, _ := http.NewRequest("GET", tc.requestURL, nil)
+			gotProxy, err := ProxyFunc(tc.proxyURL)(req)
+			if err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+
+			if tc.wantProxy == "" {
+				if gotProxy != nil {
+					t.Errorf("want no proxy, got: %v", gotProxy)
+				}
+				return
+			}
+			if gotProxy == nil || gotProxy.String() != tc.wantProxy {
+				t.Errorf("got proxy: %v, want: %v", gotProxy, tc.wantProxy)
+			}
+		})
+	}
+}
@@ -15,6 +15,7 @@
 package util
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -29,8 +30,21 @@ type RetryConfig struct {
 	RetryInterval time.Duration
 }
 
-func callWithAccessToken(client *http.Client, path, method, token string) ([]byte, int, error) {
-	req, _ := http.NewRequest(method, path, nil)
+// HttpStatusError is the error of a http call returning a status other than
+// 200 OK.
+type HttpStatusError struct {
+	Method     string
+	Path       string
+	Status     string
+	StatusCode int
+}
+
+func (e *HttpStatusError) Error() string {
+	return fmt.Sprintf("http call to %s %s returns not 200 OK: %v", e.Method, e.Path, e.Status)
+}
+
+func callWithAccessToken(client *http.Client, path, method, token string, reqBody []byte) ([]byte, int, error) {
+	req, _ := http.NewRequest(method, path, bytes.NewReader(reqBody))
 	req.Header.Add("Authorization", "Bearer "+token)
 	req.Header.Set("Content-Type", "application/x-protobuf")
 
@@ -40,7 +54,12 @@ func callWithAccessToken(client *http.Client, path, method, token string) ([]byt
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, resp.StatusCode, fmt.Errorf("http call to %s %s returns not 200 OK: %v", method, path, resp.Status)
+		return nil, resp.StatusCode, &HttpStatusError{
+			Method:     method,
+			Path:       path,
+			Status:     resp.Status,
+			StatusCode: resp.StatusCode,
+		}
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
@@ -64,7 +83,7 @@ var CallGoogleapis = func(client *http.Client, path, method string, getTokenFunc
 	callStatusCnts := map[int]int{}
 
 	for {
-		respBytes, statusCode, err = callWithAccessToken(client, path, method, token)
+		respBytes, statusCode, err = callWithAccessToken(client, path, method, token, nil)
 		if retryConfigs == nil {
 			break
 		} else if retryConfig, ok := retryConfigs[statusCode]; !ok {
@@ -90,3 +109,23 @@ var CallGoogleapis = func(client *http.Client, path, method string, getTokenFunc
 
 	return nil
 }
+
+// CallGoogleapisWithBody calls googleapis with the input as the request body,
+// e.g. to pull the Pub/Sub messages. It is not retried.
+var CallGoogleapisWithBody = func(client *http.Client, path, method string, getTokenFunc GetAccessTokenFunc, input, output proto.Message) error {
+	token, _, err := getTokenFunc()
+	if err != nil {
+		return fmt.Errorf("fail to get access token: %v", err)
+	}
+
+	reqBytes, err := proto.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("fail to marshal %T: %v", input, err)
+	}
+
+	respBytes, _, err := callWithAccessToken(client, path, method, token, reqBytes)
+	if err != nil {
+		return err
+	}
+	return UnmarshalBytesToPbMessage(respBytes, output)
+}
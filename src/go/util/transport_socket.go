@@ -75,27 +75,70 @@ func CreateUpstreamTransportSocket(hostname, rootCertsPath, sslClientPath string
 	}, nil
 }
 
-// CreateDownstreamTransportSocket creates a TransportSocket for Downstream
-func CreateDownstreamTransportSocket(sslServerPath, sslServerRootPath, sslMinimumProtocol, sslMaximumProtocol string, cipherSuites string) (*corepb.TransportSocket, error) {
+// CreateDownstreamTransportSocket creates a TransportSocket for Downstream.
+// Client certificates are validated against sslServerRootPath if it is set,
+// and are mandatory if requireClientCert is also set.
+func CreateDownstreamTransportSocket(sslServerPath, sslServerRootPath, sslMinimumProtocol, sslMaximumProtocol string, cipherSuites string, requireClientCert bool) (*corepb.TransportSocket, error) {
 	if sslServerPath == "" {
 		return nil, fmt.Errorf("SSL path cannot be empty.")
 	}
 
-	sslFileName := defaultServerSslFilename
-	// Backward compatible for ESPv1
-	if strings.Contains(sslServerPath, "/etc/nginx/ssl") {
-		sslFileName = "nginx"
+	commonTls, err := createCommonTlsContext(sslServerRootPath, sslServerPath, downstreamSslFilename(sslServerPath), sslMinimumProtocol, sslMaximumProtocol, cipherSuites)
+	if err != nil {
+		return nil, err
 	}
+	return createDownstreamTransportSocket(commonTls, sslServerRootPath != "" && requireClientCert)
+}
 
-	commonTls, err := createCommonTlsContext(sslServerRootPath, sslServerPath, sslFileName, sslMinimumProtocol, sslMaximumProtocol, cipherSuites)
+// CreateDownstreamSdsTransportSocket creates a TransportSocket for Downstream
+// whose certificate is fetched from the ADS server by the SDS secret name.
+func CreateDownstreamSdsTransportSocket(secretName, sslServerRootPath, sslMinimumProtocol, sslMaximumProtocol string, cipherSuites string, requireClientCert bool) (*corepb.TransportSocket, error) {
+	if secretName == "" {
+		return nil, fmt.Errorf("SDS secret name cannot be empty.")
+	}
+
+	commonTls, err := createCommonTlsContext(sslServerRootPath, "", "", sslMinimumProtocol, sslMaximumProtocol, cipherSuites)
 	if err != nil {
 		return nil, err
 	}
+	commonTls.TlsCertificateSdsSecretConfigs = []*tlspb.SdsSecretConfig{
+		{
+			Name: secretName,
+			SdsConfig: &corepb.ConfigSource{
+				ConfigSourceSpecifier: &corepb.ConfigSource_Ads{
+					Ads: &corepb.AggregatedConfigSource{},
+				},
+				ResourceApiVersion: corepb.ApiVersion_V3,
+			},
+		},
+	}
+	return createDownstreamTransportSocket(commonTls, sslServerRootPath != "" && requireClientCert)
+}
+
+// DownstreamSslCertFiles returns the paths of the certificate chain and the
+// private key that ESPv2 uses to act as a HTTPS server.
+func DownstreamSslCertFiles(sslServerPath string) (string, string) {
+	if !strings.HasSuffix(sslServerPath, "/") {
+		sslServerPath = fmt.Sprintf("%s/", sslServerPath)
+	}
+	sslFileName := downstreamSslFilename(sslServerPath)
+	return fmt.Sprintf("%s%s.crt", sslServerPath, sslFileName), fmt.Sprintf("%s%s.key", sslServerPath, sslFileName)
+}
+
+func downstreamSslFilename(sslServerPath string) string {
+	// Backward compatible for ESPv1
+	if strings.Contains(sslServerPath, "/etc/nginx/ssl") {
+		return "nginx"
+	}
+	return defaultServerSslFilename
+}
+
+func createDownstreamTransportSocket(commonTls *tlspb.CommonTlsContext, requireClientCertificate bool) (*corepb.TransportSocket, error) {
 	commonTls.AlpnProtocols = []string{"h2", "http/1.1"}
 	downstreamTlsContext := &tlspb.DownstreamTlsContext{
 		CommonTlsContext: commonTls,
 	}
-	if sslServerRootPath != "" {
+	if requireClientCertificate {
 		downstreamTlsContext.RequireClientCertificate = &wrapperspb.BoolValue{
 			Value: true,
 		}
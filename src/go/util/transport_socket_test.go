@@ -160,6 +160,7 @@ func TestCreateDownstreamTransportSocket(t *testing.T) {
 		sslMinimumProtocol  string
 		sslMaximumProtocol  string
 		cipherSuites        string
+		optionalClientCert  bool
 		wantTransportSocket string
 	}{
 		{
@@ -226,6 +227,39 @@ func TestCreateDownstreamTransportSocket(t *testing.T) {
 				}
 			}`,
 		},
+		{
+			desc:               "Downstream Transport Socket for mTLS, client certificate is optional",
+			sslPath:            "/etc/ssl/endpoints/",
+			sslRootCertPath:    "/etc/ssl/endpoints/root.crt",
+			optionalClientCert: true,
+			wantTransportSocket: `{
+				"name": "envoy.transport_sockets.tls",
+				"typedConfig": {
+					"@type": "type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.DownstreamTlsContext",
+					"commonTlsContext": {
+						"alpnProtocols": [
+							"h2",
+							"http/1.1"
+						],
+						"tlsCertificates": [
+							{
+								"certificateChain": {
+									"filename": "/etc/ssl/endpoints/server.crt"
+								},
+								"privateKey": {
+									"filename": "/etc/ssl/endpoints/server.key"
+								}
+							}
+						],
+						"validationContext": {
+							"trustedCa": {
+								"filename": "/etc/ssl/endpoints/root.crt"
+							}
+						}
+					}
+				}
+			}`,
+		},
 		{
 			desc:               "Downstream Transport Socket for TLS, with version requirements",
 			sslPath:            "/etc/ssl/endpoints/",
@@ -290,7 +324,7 @@ func TestCreateDownstreamTransportSocket(t *testing.T) {
 	}
 
 	for i, tc := range testData {
-		gotTransportSocket, err := CreateDownstreamTransportSocket(tc.sslPath, tc.sslRootCertPath, tc.sslMinimumProtocol, tc.sslMaximumProtocol, tc.cipherSuites)
+		gotTransportSocket, err := CreateDownstreamTransportSocket(tc.sslPath, tc.sslRootCertPath, tc.sslMinimumProtocol, tc.sslMaximumProtocol, tc.cipherSuites, !tc.optionalClientCert)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -304,3 +338,93 @@ func TestCreateDownstreamTransportSocket(t *testing.T) {
 		}
 	}
 }
+
+func TestCreateDownstreamSdsTransportSocket(t *testing.T) {
+	testData := []struct {
+		desc                string
+		secretName          string
+		sslRootCertPath     string
+		wantTransportSocket string
+		wantError           string
+	}{
+		{
+			desc:            "Downstream Transport Socket with the certificate from SDS",
+			secretName:      "server_cert",
+			sslRootCertPath: "/etc/ssl/endpoints/ca.pem",
+			wantTransportSocket: `{
+				"name":"envoy.transport_sockets.tls",
+				"typedConfig":{
+					"@type":"type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.DownstreamTlsContext",
+					"commonTlsContext":{
+						"alpnProtocols":["h2","http/1.1"],
+						"tlsCertificateSdsSecretConfigs":[
+							{
+								"name":"server_cert",
+								"sdsConfig":{
+									"ads":{},
+									"resourceApiVersion":"V3"
+								}
+							}
+						],
+						"validationContext":{
+							"trustedCa":{
+								"filename":"/etc/ssl/endpoints/ca.pem"
+							}
+						}
+					},
+					"requireClientCertificate":true
+				}
+			}`,
+		},
+		{
+			desc:      "Empty secret name",
+			wantError: "SDS secret name cannot be empty.",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			gotTransportSocket, err := CreateDownstreamSdsTransportSocket(tc.secretName, tc.sslRootCertPath, "", "", "", true)
+			if err != nil {
+				if err.Error() != tc.wantError {
+					t.Fatalf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			marshaler := &jsonpb.Marshaler{}
+			gotConfig, err := marshaler.MarshalToString(gotTransportSocket)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := JsonEqual(tc.wantTransportSocket, gotConfig); err != nil {
+				t.Errorf("CreateDownstreamSdsTransportSocket failed,\n %v", err)
+			}
+		})
+	}
+}
+
+func TestDownstreamSslCertFiles(t *testing.T) {
+	testData := []struct {
+		sslPath      string
+		wantCertFile string
+		wantKeyFile  string
+	}{
+		{
+			sslPath:      "/etc/ssl/endpoints",
+			wantCertFile: "/etc/ssl/endpoints/server.crt",
+			wantKeyFile:  "/etc/ssl/endpoints/server.key",
+		},
+		{
+			sslPath:      "/etc/nginx/ssl/",
+			wantCertFile: "/etc/nginx/ssl/nginx.crt",
+			wantKeyFile:  "/etc/nginx/ssl/nginx.key",
+		},
+	}
+
+	for _, tc := range testData {
+		gotCertFile, gotKeyFile := DownstreamSslCertFiles(tc.sslPath)
+		if gotCertFile != tc.wantCertFile || gotKeyFile != tc.wantKeyFile {
+			t.Errorf("ssl path %s: got (%s, %s), want (%s, %s)", tc.sslPath, gotCertFile, gotKeyFile, tc.wantCertFile, tc.wantKeyFile)
+		}
+	}
+}
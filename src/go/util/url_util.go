@@ -23,6 +23,10 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
 )
 
 const (
@@ -39,6 +43,8 @@ const (
 // ParseURI parses uri into scheme, hostname, port, path with err(if exist).
 // If uri has no scheme, it will be regarded as https.
 // If uri has no port, it will use 80 for non-TLS and 443 for TLS.
+// The hostname is lowercased, and converted to punycode if it is an
+// internationalized domain name.
 // Ensures the path has no trailing slash.
 // Strips out query parameters from the path.
 func ParseURI(uri string) (string, string, uint32, string, error) {
@@ -55,24 +61,55 @@ func ParseURI(uri string) (string, string, uint32, string, error) {
 
 	_, port, err := net.SplitHostPort(u.Host)
 	if err != nil {
-		if e, ok := err.(*net.AddrError); ok && strings.Contains(e.Error(), "missing port") {
-			// Determine the default port.
-			port = HTTPSDefaultPort
-			if !strings.HasSuffix(u.Scheme, "s") {
-				port = HTTPDefaultPort
-			}
-		} else {
+		if e, ok := err.(*net.AddrError); !ok || !strings.Contains(e.Error(), "missing port") {
 			return "", "", 0, "", err
 		}
 	}
+	if port == "" {
+		// Determine the default port, also for an empty port as in "host:".
+		port = HTTPSDefaultPort
+		if !strings.HasSuffix(u.Scheme, "s") {
+			port = HTTPDefaultPort
+		}
+	}
 
 	portVal, err := strconv.Atoi(port)
 	if err != nil {
 		return "", "", 0, "", fmt.Errorf("parse \"%v\": %v", uri, err)
 	}
+	if portVal <= 0 || portVal > 65535 {
+		return "", "", 0, "", fmt.Errorf("parse \"%v\": port %v is out of range", uri, portVal)
+	}
+
+	hostname, err := normalizeHostname(u.Hostname())
+	if err != nil {
+		return "", "", 0, "", fmt.Errorf("parse \"%v\": %v", uri, err)
+	}
 
 	pathNoTrailingSlash := strings.TrimSuffix(u.Path, "/")
-	return u.Scheme, u.Hostname(), uint32(portVal), pathNoTrailingSlash, nil
+	return u.Scheme, hostname, uint32(portVal), pathNoTrailingSlash, nil
+}
+
+// normalizeHostname lowercases the hostname, as Envoy matches the hosts
+// case-sensitively, and converts the internationalized domain names to
+// punycode, as DNS and SNI only take ASCII.
+func normalizeHostname(hostname string) (string, error) {
+	if hostname == "" {
+		return "", fmt.Errorf("missing host name")
+	}
+	if net.ParseIP(hostname) != nil {
+		return strings.ToLower(hostname), nil
+	}
+	for _, r := range hostname {
+		if r >= utf8.RuneSelf {
+			asciiHostname, err := idna.Lookup.ToASCII(hostname)
+			if err != nil {
+				return "", fmt.Errorf("invalid internationalized host name %q: %v", hostname, err)
+			}
+			return asciiHostname, nil
+		}
+	}
+	return strings.ToLower(hostname), nil
 }
 
 // ParseBackendProtocol parses a scheme string and http protocol string into BackendProtocol and UseTLS bool.
@@ -106,9 +143,14 @@ func ParseBackendProtocol(scheme string, httpProtocol string) (BackendProtocol,
 }
 
 // Note: the path of openID discovery may be https
-var getRemoteContent = func(path string) ([]byte, error) {
+var getRemoteContent = func(path, proxyURL string, timeout time.Duration) ([]byte, error) {
 	req, _ := http.NewRequest("GET", path, nil)
-	client := &http.Client{}
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: ProxyFunc(proxyURL),
+		},
+		Timeout: timeout,
+	}
 	resp, err := client.Do(req)
 
 	if err != nil {
@@ -122,14 +164,16 @@ var getRemoteContent = func(path string) ([]byte, error) {
 	return ioutil.ReadAll(resp.Body)
 }
 
-func ResolveJwksUriUsingOpenID(uri string) (string, error) {
+// ResolveJwksUriUsingOpenID fetches the jwks_uri from the OpenID Connect
+// Discovery configuration of the issuer, 0 timeout means no timeout.
+func ResolveJwksUriUsingOpenID(uri, proxyURL string, timeout time.Duration) (string, error) {
 	if !strings.HasPrefix(uri, "http") {
 		uri = fmt.Sprintf("https://%s", uri)
 	}
 	uri = strings.TrimSuffix(uri, "/")
 	uri = fmt.Sprintf("%s%s", uri, OpenIDDiscoveryCfgURLSuffix)
 
-	body, err := getRemoteContent(uri)
+	body, err := getRemoteContent(uri, proxyURL, timeout)
 	if err != nil {
 		return "", fmt.Errorf("Failed to fetch jwks_uri from %s: %v", uri, err)
 	}
@@ -177,4 +221,8 @@ var (
 		return fmt.Sprintf("%s/v1/services/%s/configs/%s?view=FULL",
 			serviceManagementUrl, serviceName, configId)
 	}
+
+	AccessSecretVersionURL = func(secretManagerUrl, secretVersion string) string {
+		return fmt.Sprintf("%s/v1/%s:access", secretManagerUrl, secretVersion)
+	}
 )
@@ -195,6 +195,63 @@ func TestParseURI(t *testing.T) {
 			wantedHostname: "127.0.0.1",
 			wantedPort:     8080,
 		},
+		{
+			desc:           "successful for uppercase host",
+			url:            "HTTPS://ABC.Example.ORG/Path",
+			wantedScheme:   "https",
+			wantedHostname: "abc.example.org",
+			wantedPort:     443,
+			wantPath:       "/Path",
+		},
+		{
+			desc:           "successful for internationalized domain name",
+			url:            "https://Bücher.example.org/api",
+			wantedScheme:   "https",
+			wantedHostname: "xn--bcher-kva.example.org",
+			wantedPort:     443,
+			wantPath:       "/api",
+		},
+		{
+			desc:           "successful for punycode domain name",
+			url:            "grpcs://xn--bcher-kva.example.org:8443",
+			wantedScheme:   "grpcs",
+			wantedHostname: "xn--bcher-kva.example.org",
+			wantedPort:     8443,
+		},
+		{
+			desc:           "successful for empty port, use the default port",
+			url:            "grpc://abc.example.org:",
+			wantedScheme:   "grpc",
+			wantedHostname: "abc.example.org",
+			wantedPort:     80,
+		},
+		{
+			desc:           "successful for ipv6 with default port",
+			url:            "http://[2001:DB8::1]",
+			wantedScheme:   "http",
+			wantedHostname: "2001:db8::1",
+			wantedPort:     80,
+		},
+		{
+			desc:    "fail for port out of range",
+			url:     "https://abc.example.org:65536",
+			wantErr: `parse "https://abc.example.org:65536": port 65536 is out of range`,
+		},
+		{
+			desc:    "fail for port 0",
+			url:     "https://abc.example.org:0",
+			wantErr: `parse "https://abc.example.org:0": port 0 is out of range`,
+		},
+		{
+			desc:    "fail for missing host",
+			url:     "https:///api",
+			wantErr: `parse "https:///api": missing host name`,
+		},
+		{
+			desc:    "fail for invalid internationalized domain name",
+			url:     "https://-bücher.example.org",
+			wantErr: `invalid internationalized host name`,
+		},
 		{
 			desc: "fail for bad port number",
 			url:  "grpcs://127.0.0.1:80bad",
@@ -440,7 +497,7 @@ func TestResolveJwksUriUsingOpenID(t *testing.T) {
 		},
 	}
 	for i, tc := range testData {
-		uri, err := ResolveJwksUriUsingOpenID(tc.issuer)
+		uri, err := ResolveJwksUriUsingOpenID(tc.issuer, "", 0)
 		if uri != tc.wantUri {
 			t.Errorf("Test Desc(%d): %s, resolve jwksUri by openID got: %v, want: %v", i, tc.desc, uri, tc.wantUri)
 		}
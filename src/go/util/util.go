@@ -27,6 +27,14 @@ const (
 	// JwtPayloadMetadataName is the field name passed into metadata
 	JwtPayloadMetadataName = "jwt_payloads"
 
+	// FilterStateApiMethod is the filter state set by the service control
+	// filter, the operation of the request.
+	FilterStateApiMethod = "com.google.espv2.filters.http.service_control.api_method"
+
+	// FilterStateApiKeyPresent is the filter state set by the service control
+	// filter, "true" if the request has an API key.
+	FilterStateApiKeyPresent = "com.google.espv2.filters.http.service_control.api_key_present"
+
 	// Supported Http Methods.
 
 	GET     = "GET"
@@ -37,11 +45,19 @@ const (
 	OPTIONS = "OPTIONS"
 	CUSTOM  = "CUSTOM"
 
+	// The backend protocol which is detected by probing the backend.
+	AutoBackendHttpProtocol = "auto"
+
 	// Rollout strategy
 
 	FixedRolloutStrategy   = "fixed"
 	ManagedRolloutStrategy = "managed"
 
+	// Traffic policy of the managed rollout
+
+	HighestTrafficPolicy    = "highest"
+	PercentageTrafficPolicy = "percentage"
+
 	// Metadata suffix
 
 	ConfigIDPath          = "/computeMetadata/v1/instance/attributes/endpoints-service-version"
@@ -50,6 +66,10 @@ const (
 	RolloutStrategyPath   = "/computeMetadata/v1/instance/attributes/endpoints-rollout-strategy"
 	ServiceNamePath       = "/computeMetadata/v1/instance/attributes/endpoints-service-name"
 
+	// The GKE metadata server of Workload Identity conceals kube-env, but
+	// serves the cluster name.
+	ClusterNamePath = "/computeMetadata/v1/instance/attributes/cluster-name"
+
 	AccessTokenPath   = "/computeMetadata/v1/instance/service-accounts/default/token"
 	IdentityTokenPath = "/computeMetadata/v1/instance/service-accounts/default/identity"
 	ProjectIDPath     = "/computeMetadata/v1/project/project-id"
@@ -62,14 +82,18 @@ const (
 
 	// The path of getting access token from token agent server
 	TokenAgentAccessTokenPath = "/local/access_token"
+	// The path of getting ID token from token agent server
+	TokenAgentIdentityTokenPath = "/local/identity"
 
 	// b/147591854: This string must NOT have a trailing slash
 	OpenIDDiscoveryCfgURLSuffix = "/.well-known/openid-configuration"
 
 	// Platforms
-	GAEFlex = "GAE_FLEX(ESPv2)"
-	GKE     = "GKE(ESPv2)"
-	GCE     = "GCE(ESPv2)"
+	GAEFlex        = "GAE_FLEX(ESPv2)"
+	GKE            = "GKE(ESPv2)"
+	GCE            = "GCE(ESPv2)"
+	CloudRun       = "Cloud Run(ESPv2)"
+	CloudFunctions = "Cloud Functions(ESPv2)"
 
 	// System Parameter Name
 	ApiKeyParameterName = "api_key"
@@ -108,6 +132,10 @@ const (
 	// Standard type url prefix.
 	TypeUrlPrefix = "type.googleapis.com/"
 
+	// The long-running operation type and the operation to poll it.
+	LongRunningOperationTypeName = "google.longrunning.Operation"
+	LongRunningGetOperation      = "google.longrunning.Operations.GetOperation"
+
 	// Loopback Address
 	LoopbackIPv4Addr = "127.0.0.1"
 
@@ -127,8 +155,18 @@ const (
 	// The stat prefix.
 	StatPrefix = "ingress_http"
 
+	// The tag of the per-operation stats, extracted from the stats of the
+	// virtual clusters generated for each operation.
+	OperationStatsTag = "operation"
+	// The first group is removed from the stat name, the second group is the
+	// tag value. It must match the names generated by OperationStatName.
+	OperationStatsTagRegex = `^vhost\.[\w-]+\.vcluster\.(([\w-]+)\.)`
+
 	// The suffix that forms the operation name header.
 	OperationHeaderSuffix = "Api-Operation-Name"
+
+	// The filter metadata namespace of the route metadata describing the matched API method.
+	RouteMetadataNamespace = "com.google.espv2.route"
 )
 
 type BackendProtocol int32
@@ -144,6 +182,19 @@ const (
 	GRPC
 )
 
+func (p BackendProtocol) String() string {
+	switch p {
+	case HTTP1:
+		return "http1"
+	case HTTP2:
+		return "http2"
+	case GRPC:
+		return "grpc"
+	default:
+		return "unknown"
+	}
+}
+
 func MaybeTruncateSpanName(spanName string) string {
 	if len(spanName) <= SpanNameMaxByteNum {
 		return spanName
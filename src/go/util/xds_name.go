@@ -14,13 +14,19 @@
 
 package util
 
-import "fmt"
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
 
 const (
 	// Upstream envoy http filter names.
 
 	// Buffer HTTP filter
 	Buffer = "envoy.filters.http.buffer"
+	// Compressor HTTP filter
+	Compressor = "envoy.filters.http.compressor"
 	// CORS HTTP filter
 	CORS = "envoy.filters.http.cors"
 	// GRPCJSONTranscoder HTTP filter
@@ -35,12 +41,24 @@ const (
 	Echo = "envoy.filters.network.echo"
 	// HTTPConnectionManager network filter
 	HTTPConnectionManager = "envoy.filters.network.http_connection_manager"
+	// TcpProxy network filter
+	TcpProxy = "envoy.filters.network.tcp_proxy"
 	// JwtAuthn filter.
 	JwtAuthn = "envoy.filters.http.jwt_authn"
+	// RBAC HTTP filter
+	RBAC = "envoy.filters.http.rbac"
+	// Lua HTTP filter
+	Lua = "envoy.filters.http.lua"
 	// TLSTransportSocket is Envoy TLS Transport Socket name.
 	TLSTransportSocket = "envoy.transport_sockets.tls"
 	// AccessFileLogger filter name
 	AccessFileLogger = "envoy.access_loggers.file"
+	// AccessHttpGrpcLogger filter name
+	AccessHttpGrpcLogger = "envoy.access_loggers.http_grpc"
+	// Gzip compressor library
+	GzipCompressor = "envoy.compression.gzip.compressor"
+	// Brotli compressor library
+	BrotliCompressor = "envoy.compression.brotli.compressor"
 	// Upstream protocol options
 	UpstreamProtocolOptions = "envoy.extensions.upstreams.http.v3.HttpProtocolOptions"
 
@@ -50,33 +68,106 @@ const (
 	ServiceControl = "com.google.espv2.filters.http.service_control"
 	// PathRewrite filter.
 	PathRewrite = "com.google.espv2.filters.http.path_rewrite"
+	// HeaderSizeLimit filter.
+	HeaderSizeLimit = "com.google.espv2.filters.http.header_size_limit"
 	// BackendAuth filter.
 	BackendAuth = "com.google.espv2.filters.http.backend_auth"
 	// gRPC Metadata Scrubber filter.
 	GrpcMetadataScrubber = "com.google.espv2.filters.http.grpc_metadata_scrubber"
 
+	// The SDS secret name of the downstream TLS certificate.
+	ServerCertSecretName = "server_cert"
+
 	// The metadata server cluster name.
 	MetadataServerClusterName = "metadata-cluster"
 
 	// The token agent server cluster name.
 	TokenAgentClusterName = "token-agent-cluster"
 
+	// The cluster of the gRPC reflection server of the config manager.
+	GrpcReflectionClusterName = "grpc-reflection-cluster"
+
 	// The iam server cluster name.
 	IamServerClusterName = "iam-cluster"
 
 	// The service control server cluster name.
 	ServiceControlClusterName = "service-control-cluster"
 
-	IngressListenerName  = "ingress_listener"
-	LoopbackListenerName = "loopback_listener"
+	// The zipkin collector cluster name.
+	ZipkinCollectorClusterName = "zipkin-collector-cluster"
+
+	// The gRPC access log service cluster name.
+	AccessLogServiceClusterName = "access-log-service-cluster"
+
+	// The cluster of the HTTP proxy of --google_api_proxy.
+	GoogleApiProxyClusterName = "google-api-proxy-cluster"
+
+	// The local cluster of this proxy in its zone, for the zone aware load
+	// balancing of the backends.
+	LocalProxyClusterName = "local-proxy-cluster"
+
+	IngressListenerName    = "ingress_listener"
+	IngressSslListenerName = "ingress_ssl_listener"
+	LoopbackListenerName   = "loopback_listener"
 )
 
 // Jwt provider cluster's name will be in form of "jwt-provider-cluster-${JWT_PROVIDER_ADDRESS}".
+// HostJwtRequirementName is the name of the JWT requirement of an operation
+// overridden for a hostname.
+func HostJwtRequirementName(operation, host string) string {
+	return fmt.Sprintf("%s@%s", operation, host)
+}
+
 func JwtProviderClusterName(address string) string {
 	return fmt.Sprintf("jwt-provider-cluster-%s", address)
 }
 
+// ServiceControlFailoverClusterName is the cluster name of the service
+// control server failed over to at the index of --service_control_failover_urls.
+func ServiceControlFailoverClusterName(index int) string {
+	return fmt.Sprintf("%s-failover-%d", ServiceControlClusterName, index)
+}
+
+// ProxyTunnelListenerName is the listener name of the tunnel of the cluster
+// endpoint through the --google_api_proxy.
+func ProxyTunnelListenerName(clusterName, authority string) string {
+	return fmt.Sprintf("proxy_tunnel_listener_%s_%s", clusterName, authority)
+}
+
+// ProxyTunnelPipe is the unix domain socket of the tunnel of the cluster
+// endpoint through the --google_api_proxy. It is in the abstract namespace,
+// named by a hash to fit the length limit of the socket paths.
+func ProxyTunnelPipe(clusterName, authority string) string {
+	hash := sha256.Sum256([]byte(clusterName + "|" + authority))
+	return fmt.Sprintf("@espv2-proxy-tunnel-%x", hash[:8])
+}
+
 // Backend cluster'name will be in form of "backend-cluster-${BACKEND_ADDRESS}"
 func BackendClusterName(address string) string {
 	return fmt.Sprintf("backend-cluster-%s", address)
 }
+
+func OperationBackendClusterName(backendClusterName, operation string) string {
+	return fmt.Sprintf("%s_%s", backendClusterName, operation)
+}
+
+// OperationStatName converts the operation into a stat name segment, the
+// characters other than [a-zA-Z0-9_-] are replaced by "_". e.g. the stat name
+// of "1.echo_api_endpoints_cloudesf_testing_cloud_goog.Echo" is
+// "1_echo_api_endpoints_cloudesf_testing_cloud_goog_Echo".
+func OperationStatName(operation string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, operation)
+}
+
+// FeatureGateRuntimeKey is the Envoy runtime key overriding the percentage of
+// the requests let through the feature gate of the operation, at any time of
+// the day. Without it, the percentage of the gate is let through in its daily
+// windows, and none outside.
+func FeatureGateRuntimeKey(operation string) string {
+	return fmt.Sprintf("espv2.feature_gates.%s", operation)
+}
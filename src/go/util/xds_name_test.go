@@ -45,3 +45,25 @@ func TestBackendClusterName(t *testing.T) {
 		t.Errorf("fail to create backend cluster name, expected: %s, got: %s", testCase.wantedName, gotName)
 	}
 }
+
+func TestOperationStatName(t *testing.T) {
+	testCases := []struct {
+		operation  string
+		wantedName string
+	}{
+		{
+			operation:  "1.echo_api_endpoints_cloudesf_testing_cloud_goog.Echo",
+			wantedName: "1_echo_api_endpoints_cloudesf_testing_cloud_goog_Echo",
+		},
+		{
+			operation:  "ESPv2_Autogenerated_CORS_get-books",
+			wantedName: "ESPv2_Autogenerated_CORS_get-books",
+		},
+	}
+
+	for _, tc := range testCases {
+		if gotName := OperationStatName(tc.operation); gotName != tc.wantedName {
+			t.Errorf("fail to create operation stat name, expected: %s, got: %s", tc.wantedName, gotName)
+		}
+	}
+}
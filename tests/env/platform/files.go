@@ -69,6 +69,7 @@ const (
 
 	// Other configurations for testing
 	FixedDrServiceConfig
+	FixturesFolder
 	FakeServiceAccountFile
 )
 
@@ -120,6 +121,9 @@ var fileMap = map[RuntimeFile]string{
 	GrpcEchoServiceConfig: "../../../../examples/grpc_dynamic_routing/service_config_generated.json",
 	GrpcEchoEnvoyConfig:   "../../../../examples/grpc_dynamic_routing/envoy_config.json",
 
+	// Used by fixture unit tests.
+	FixturesFolder: "../../../../../examples/testdata/fixtures/",
+
 	// Used by other unit tests.
 	TestRootCaCerts:        "../../../tests/env/testdata/roots.pem",
 	FixedDrServiceConfig:   "../../../tests/env/testdata/service_config_for_fixed_dynamic_routing.json",
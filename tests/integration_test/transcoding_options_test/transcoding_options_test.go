@@ -77,6 +77,23 @@ func TestTranscodingPrintOptions(t *testing.T) {
 			transcodingPreserveProtoFieldNames: true,
 			wantResp:                           `{"id":"4","price_in_usd":100}`,
 		},
+		{
+			desc:           "Success. The original field names are accepted in the request body by default",
+			clientProtocol: "http",
+			httpMethod:     "POST",
+			method:         "/v1/shelves/100/books?key=api-key",
+			bodyBytes:      []byte(`{"id": 4, "price_in_usd": 100}`),
+			wantResp:       `{"id":"4","priceInUsd":100}`,
+		},
+		{
+			desc:                               "Success. The original field names are accepted in the request body when transcoding_preserve_proto_field_names is true",
+			clientProtocol:                     "http",
+			httpMethod:                         "POST",
+			method:                             "/v1/shelves/100/books?key=api-key",
+			bodyBytes:                          []byte(`{"id": 4, "price_in_usd": 100}`),
+			transcodingPreserveProtoFieldNames: true,
+			wantResp:                           `{"id":"4","price_in_usd":100}`,
+		},
 	}
 	for _, tc := range tests {
 		func() {
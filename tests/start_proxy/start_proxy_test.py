@@ -37,6 +37,16 @@ class TestStartProxy(unittest.TestCase):
             ([], ['bin/bootstrap',
                   '--logtostderr', '--admin_port', '0',
                   '/tmp/bootstrap.json']),
+            (["--admin_port=8001", "--admin_address=127.0.0.1",
+              "--admin_access_log_path=/tmp/admin.log"],
+             ['bin/bootstrap', '--logtostderr', '--admin_port', '8001',
+              '--admin_address', '127.0.0.1',
+              '--admin_access_log_path', '/tmp/admin.log',
+              '/tmp/bootstrap.json']),
+            # The admin flags are ignored if admin is disabled.
+            (["--admin_address=127.0.0.1"],
+             ['bin/bootstrap', '--logtostderr', '--admin_port', '0',
+              '/tmp/bootstrap.json']),
         ]
 
         for flags, wantedArgs in testcases:
@@ -57,6 +67,18 @@ class TestStartProxy(unittest.TestCase):
               '--service_config_id', '2019-11-09r0',
               '--disable_tracing',
               ]),
+            # custom log labels.
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--log_labels=environment=staging,region=us-central1',
+              '--disable_tracing'],
+             ['bin/configmanager', '--logtostderr', '--rollout_strategy', 'fixed',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--v', '0',
+              '--log_labels', 'environment=staging,region=us-central1',
+              '--service', 'test_bookstore.gloud.run',
+              '--disable_tracing',
+              ]),
             # backend with DNS address, no version.
             (['--service=echo.gloud.run', '--backend=http://echo:8080',
               '--log_request_headers=x-google-x',
@@ -73,10 +95,21 @@ class TestStartProxy(unittest.TestCase):
               '--backend_dns_lookup_family', 'v4only',
               '--dns_resolver_addresses', '127.0.0.1:53'
               ]),
+            # http backend with the probed http protocol.
+            (['--service=echo.gloud.run', '--backend=http://echo:8080',
+              '--backend_http_protocol=auto', '--disable_tracing'],
+             ['bin/configmanager', '--logtostderr', '--rollout_strategy', 'fixed',
+              '--backend_address', 'http://echo:8080',
+              '--v', '0',
+              '--service', 'echo.gloud.run',
+              '--disable_tracing',
+              '--backend_http_protocol', 'auto'
+              ]),
             (['--service=echo.gloud.run', '--backend=http://echo:8080',
               '--log_request_headers=x-google-x',
               '--service_control_check_timeout_ms=100', '-z=hc',
               '--backend_dns_lookup_family=v4only', '--disable_tracing',
+              '--dns_lookup_family=v6only',
               '--dns=127.0.0.1:53'],
              ['bin/configmanager', '--logtostderr', '--rollout_strategy', 'fixed',
               '--backend_address', 'http://echo:8080',
@@ -86,8 +119,140 @@ class TestStartProxy(unittest.TestCase):
               '--service_control_check_timeout_ms', '100',
               '--disable_tracing',
               '--backend_dns_lookup_family', 'v4only',
+              '--dns_lookup_family', 'v6only',
               '--dns_resolver_addresses', '127.0.0.1:53'
               ]),
+            (['--service=echo.gloud.run', '--backend=http://echo:8080',
+              '--google_api_proxy=http://proxy:3128',
+              '--disable_tracing'],
+             ['bin/configmanager', '--logtostderr', '--rollout_strategy', 'fixed',
+              '--backend_address', 'http://echo:8080',
+              '--v', '0',
+              '--service', 'echo.gloud.run',
+              '--disable_tracing',
+              '--google_api_proxy', 'http://proxy:3128'
+              ]),
+            (['--service=echo.gloud.run', '--backend=http://echo:8080',
+              '--backend_credentials=echo.gloud.run.Echo=type=api_key,key_file=/etc/keys/saas',
+              '--disable_tracing'],
+             ['bin/configmanager', '--logtostderr', '--rollout_strategy', 'fixed',
+              '--backend_address', 'http://echo:8080',
+              '--v', '0',
+              '--service', 'echo.gloud.run',
+              '--disable_tracing',
+              '--backend_credentials', 'echo.gloud.run.Echo=type=api_key,key_file=/etc/keys/saas'
+              ]),
+            (['--service=echo.gloud.run', '--backend=http://echo:8080',
+              '--compute_platform_override=on-prem',
+              '--compute_region_override=datacenter-1',
+              '--project_id_override=hybrid-project',
+              '--disable_tracing'],
+             ['bin/configmanager', '--logtostderr', '--rollout_strategy', 'fixed',
+              '--backend_address', 'http://echo:8080',
+              '--v', '0',
+              '--service', 'echo.gloud.run',
+              '--disable_tracing',
+              '--compute_platform_override', 'on-prem',
+              '--compute_region_override', 'datacenter-1',
+              '--project_id_override', 'hybrid-project'
+              ]),
+            (['--service=echo.gloud.run', '--backend=http://echo:8080',
+              '--backend_auth_iam_service_account=backend-auth@p.iam.gserviceaccount.com',
+              '--backend_auth_iam_delegates=delegate-a,delegate-b',
+              '--disable_tracing'],
+             ['bin/configmanager', '--logtostderr', '--rollout_strategy', 'fixed',
+              '--backend_address', 'http://echo:8080',
+              '--v', '0',
+              '--service', 'echo.gloud.run',
+              '--disable_tracing',
+              '--backend_auth_iam_service_account', 'backend-auth@p.iam.gserviceaccount.com',
+              '--backend_auth_iam_delegates', 'delegate-a,delegate-b'
+              ]),
+            # API discovery metadata and gRPC reflection
+            (['--service=echo.gloud.run', '--backend=http://echo:8080',
+              '--api_metadata_path=/.well-known/api-metadata',
+              '--enable_grpc_reflection',
+              '--disable_tracing'],
+             ['bin/configmanager', '--logtostderr', '--rollout_strategy', 'fixed',
+              '--backend_address', 'http://echo:8080',
+              '--api_metadata_path', '/.well-known/api-metadata',
+              '--enable_grpc_reflection',
+              '--v', '0',
+              '--service', 'echo.gloud.run',
+              '--disable_tracing',
+              ]),
+            # gRPC-Web disabled
+            (['--service=echo.gloud.run', '--backend=grpc://127.0.0.1:8000',
+              '--enable_grpc_web=false',
+              '--disable_tracing'],
+             ['bin/configmanager', '--logtostderr', '--rollout_strategy', 'fixed',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--skip_grpc_web_filter',
+              '--v', '0',
+              '--service', 'echo.gloud.run',
+              '--disable_tracing',
+              ]),
+            # Filter toggles
+            (['--service=echo.gloud.run', '--backend=grpc://127.0.0.1:8000',
+              '--skip_transcoder_filter',
+              '--skip_backend_auth_filter',
+              '--skip_jwt_authn_filter',
+              '--skip_service_control_filter',
+              '--path_rewrite_filter=off',
+              '--disable_tracing'],
+             ['bin/configmanager', '--logtostderr', '--rollout_strategy', 'fixed',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--skip_transcoder_filter',
+              '--skip_backend_auth_filter',
+              '--skip_jwt_authn_filter',
+              '--skip_service_control_filter',
+              '--path_rewrite_filter', 'off',
+              '--v', '0',
+              '--service', 'echo.gloud.run',
+              '--disable_tracing',
+              ]),
+            # Response compression
+            (['--service=echo.gloud.run', '--backend=grpc://127.0.0.1:8000',
+              '--response_compression=brotli,gzip',
+              '--response_compression_min_content_length=1024',
+              '--response_compression_content_types=application/json',
+              '--disable_tracing'],
+             ['bin/configmanager', '--logtostderr', '--rollout_strategy', 'fixed',
+              '--backend_address', 'grpc://127.0.0.1:8000',
+              '--response_compression', 'brotli,gzip',
+              '--response_compression_min_content_length', '1024',
+              '--response_compression_content_types', 'application/json',
+              '--v', '0',
+              '--service', 'echo.gloud.run',
+              '--disable_tracing',
+              ]),
+            # Backend circuit breakers
+            (['--service=echo.gloud.run', '--backend=http://echo:8080',
+              '--backend_max_connections=100',
+              '--backend_max_pending_requests=200',
+              '--backend_max_requests=300',
+              '--backend_max_retries=5', '--disable_tracing'],
+             ['bin/configmanager', '--logtostderr', '--rollout_strategy', 'fixed',
+              '--backend_address', 'http://echo:8080', '--v', '0',
+              '--service', 'echo.gloud.run',
+              '--disable_tracing',
+              '--backend_max_connections', '100',
+              '--backend_max_pending_requests', '200',
+              '--backend_max_requests', '300',
+              '--backend_max_retries', '5',
+              ]),
+            # Request body size limits
+            (['--service=echo.gloud.run', '--backend=http://echo:8080',
+              '--max_request_bytes=1048576',
+              '--operation_max_request_bytes=a.b.C=0;a.b.D=10485760',
+              '--disable_tracing'],
+             ['bin/configmanager', '--logtostderr', '--rollout_strategy', 'fixed',
+              '--backend_address', 'http://echo:8080', '--v', '0',
+              '--service', 'echo.gloud.run',
+              '--disable_tracing',
+              '--max_request_bytes', '1048576',
+              '--operation_max_request_bytes', 'a.b.C=0;a.b.D=10485760',
+              ]),
             # Default backend
             (['-R=managed','--enable_strict_transport_security',
               '--http_port=8079', '--service_control_quota_retries=3',
@@ -123,6 +288,9 @@ class TestStartProxy(unittest.TestCase):
               '--jwks_fetch_retry_back_off_base_interval=100',
               '--jwks_fetch_retry_back_off_max_interval=32000',
               '--jwt_pad_forward_payload_header',
+              '--jwt_payload_header=X-Jwt-Payload',
+              '--jwt_allow_missing_or_failed_selectors=pkg.Foo',
+              '--jwt_claim_requirements=pkg.Foo=scope:write',
               '--http_port=8079', '--service_control_quota_retries=3',
               '--service_control_report_timeout_ms=300',
               '--check_metadata',
@@ -134,6 +302,9 @@ class TestStartProxy(unittest.TestCase):
               '--jwks_fetch_retry_back_off_base_interval_ms', '100',
               '--jwks_fetch_retry_back_off_max_interval_ms', '32000',
               '--jwt_pad_forward_payload_header',
+              '--jwt_payload_header', 'X-Jwt-Payload',
+              '--jwt_allow_missing_or_failed_selectors', 'pkg.Foo',
+              '--jwt_claim_requirements', 'pkg.Foo=scope:write',
               '--listener_port', '8079',
               '--service_control_quota_retries', '3',
               '--service_control_report_timeout_ms', '300',
@@ -192,6 +363,26 @@ class TestStartProxy(unittest.TestCase):
               '--ssl_server_cert_path', '/etc/nginx/ssl',
               '--listener_port', '9000', '--disable_tracing',
               ]),
+            # listener_address specified
+            (['-R=managed', '--listener_port=8080', '--listener_address=::', '--disable_tracing'],
+             ['bin/configmanager', '--logtostderr', '--rollout_strategy', 'managed',
+              '--backend_address', 'http://127.0.0.1:8082', '--v', '0',
+              '--listener_port', '8080', '--listener_address', '::', '--disable_tracing',
+              ]),
+            # ssl_listener_port specified
+            (['-R=managed', '--ssl_server_cert_path=/etc/endpoint/ssl',
+              '--ssl_listener_port=8443', '--https_redirect', '--disable_tracing'],
+             ['bin/configmanager', '--logtostderr', '--rollout_strategy', 'managed',
+              '--backend_address', 'http://127.0.0.1:8082', '--v', '0',
+              '--ssl_server_cert_path', '/etc/endpoint/ssl',
+              '--ssl_listener_port', '8443', '--https_redirect', '--disable_tracing',
+              ]),
+            # listener_uds_path specified
+            (['-R=managed', '--listener_uds_path=/var/run/espv2.sock', '--disable_tracing'],
+             ['bin/configmanager', '--logtostderr', '--rollout_strategy', 'managed',
+              '--backend_address', 'http://127.0.0.1:8082', '--v', '0',
+              '--listener_uds_path', '/var/run/espv2.sock', '--disable_tracing',
+              ]),
             # ssl_backend_client_cert_path specified
             (['-R=managed','--listener_port=8080',  '--disable_tracing',
               '--ssl_backend_client_cert_path=/etc/endpoint/ssl'],
@@ -350,6 +541,33 @@ class TestStartProxy(unittest.TestCase):
               '--cors_allow_credentials',
               '--service_account_key', '/tmp/service_accout_key', '--non_gcp',
               ]),
+            # Cors: gRPC-Web trailers are exposed with CORS
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000', '--cors_preset=basic',
+              '--grpc_web_expose_trailers=x-request-cost',
+              '--disable_tracing'],
+             ['bin/configmanager', '--logtostderr', '--rollout_strategy', 'fixed',
+              '--backend_address', 'grpc://127.0.0.1:8000', '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--disable_tracing',
+              '--cors_preset', 'basic',
+              '--cors_allow_origin', '*',
+              '--cors_allow_origin_regex', '',
+              '--cors_allow_methods', 'GET, POST, PUT, PATCH, DELETE, OPTIONS',
+              '--cors_allow_headers', 'DNT,User-Agent,X-User-Agent,X-Requested-With,If-Modified-Since,Cache-Control,Content-Type,Range,Authorization',
+              '--cors_expose_headers', 'Content-Length,Content-Range',
+              '--cors_max_age', '480h',
+              '--grpc_web_expose_trailers', 'x-request-cost',
+              ]),
+            # OpenAPI document without Service Management
+            (['--backend=http://127.0.0.1:8000',
+              '--openapi_path=/etc/endpoints/openapi.json',
+              '--disable_tracing'],
+             ['bin/configmanager', '--logtostderr', '--rollout_strategy', 'fixed',
+              '--backend_address', 'http://127.0.0.1:8000', '--v', '0',
+              '--openapi_path', '/etc/endpoints/openapi.json',
+              '--disable_tracing'
+              ]),
             # backend routing (with deprecated flag)
             (['--backend=https://127.0.0.1:8000', '--enable_backend_routing',
               '--service_json_path=/tmp/service.json',
@@ -402,6 +620,18 @@ class TestStartProxy(unittest.TestCase):
               '--disable_tracing',
               '--transcoding_ignore_query_parameters', 'foo,bar'
               ]),
+            # json-grpc transcoder status overrides
+            (['--service=test_bookstore.gloud.run',
+              '--backend=grpc://127.0.0.1:8000',
+              '--transcoding_status_overrides=pkg.Foo=ALREADY_EXISTS:409',
+              '--disable_tracing'
+              ],
+             ['bin/configmanager', '--logtostderr', '--rollout_strategy', 'fixed',
+              '--backend_address', 'grpc://127.0.0.1:8000', '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--disable_tracing',
+              '--transcoding_status_overrides', 'pkg.Foo=ALREADY_EXISTS:409'
+              ]),
             # json-grpc transcoder ignore unknown parameters
             (['--service=test_bookstore.gloud.run',
               '--backend=grpc://127.0.0.1:8000',
@@ -478,6 +708,161 @@ class TestStartProxy(unittest.TestCase):
               '--access_log_format', '%START_TIME%',
               '--disable_tracing',
               ]),
+            (['--service=test_bookstore.gloud.run',
+              '--backend=127.0.0.1:8000',
+              '--access_log=/foo/bar', '--access_log_json',
+              '--disable_tracing',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--rollout_strategy', 'fixed',
+              '--backend_address', 'http://127.0.0.1:8000',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--access_log', '/foo/bar',
+              '--access_log_json',
+              '--disable_tracing',
+              ]),
+            (['--service=test_bookstore.gloud.run',
+              '--backend=127.0.0.1:8000',
+              '--access_log_grpc_url=grpc://als:9001',
+              '--access_log_grpc_log_name=bookstore',
+              '--disable_tracing',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--rollout_strategy', 'fixed',
+              '--backend_address', 'http://127.0.0.1:8000',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--access_log_grpc_url', 'grpc://als:9001',
+              '--access_log_grpc_log_name', 'bookstore',
+              '--disable_tracing',
+              ]),
+            (['--service=test_bookstore.gloud.run',
+              '--backend=127.0.0.1:8000',
+              '--service_control_report_queue_max_size=100',
+              '--service_control_report_queue_drop_policy=DROP_OLDEST',
+              '--service_control_report_disk_spill_dir=/var/spool/espv2',
+              '--service_control_report_disk_spill_max_bytes=1048576',
+              '--service_control_report_aggregation_entries=0',
+              '--service_control_report_aggregation_flush_interval_ms=5000',
+              '--service_control_check_aggregation_entries=20000',
+              '--service_control_check_aggregation_flush_interval_ms=10000',
+              '--service_control_check_aggregation_expiration_ms=30000',
+              '--disable_tracing',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--rollout_strategy', 'fixed',
+              '--backend_address', 'http://127.0.0.1:8000',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--service_control_report_queue_max_size', '100',
+              '--service_control_report_queue_drop_policy', 'DROP_OLDEST',
+              '--service_control_report_disk_spill_dir', '/var/spool/espv2',
+              '--service_control_report_disk_spill_max_bytes', '1048576',
+              '--service_control_report_aggregation_entries', '0',
+              '--service_control_report_aggregation_flush_interval_ms', '5000',
+              '--service_control_check_aggregation_entries', '20000',
+              '--service_control_check_aggregation_flush_interval_ms', '10000',
+              '--service_control_check_aggregation_expiration_ms', '30000',
+              '--disable_tracing',
+              ]),
+            (['--service=test_bookstore.gloud.run',
+              '--backend=127.0.0.1:8000',
+              '--telemetry_backend=servicecontrol_compatible',
+              '--service_control_url=http://servicecontrol.internal:8080',
+              '--disable_tracing',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--rollout_strategy', 'fixed',
+              '--backend_address', 'http://127.0.0.1:8000',
+              '--v', '0',
+              '--service_control_url', 'http://servicecontrol.internal:8080',
+              '--service', 'test_bookstore.gloud.run',
+              '--telemetry_backend', 'servicecontrol_compatible',
+              '--disable_tracing',
+              ]),
+            (['--service=test_bookstore.gloud.run',
+              '--backend=127.0.0.1:8000',
+              '--service_management_failover_urls=https://us-servicemanagement.googleapis.com',
+              '--service_control_failover_urls=https://us-servicecontrol.googleapis.com,https://eu-servicecontrol.googleapis.com',
+              '--disable_tracing',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--rollout_strategy', 'fixed',
+              '--backend_address', 'http://127.0.0.1:8000',
+              '--v', '0',
+              '--service_management_failover_urls', 'https://us-servicemanagement.googleapis.com',
+              '--service_control_failover_urls', 'https://us-servicecontrol.googleapis.com,https://eu-servicecontrol.googleapis.com',
+              '--service', 'test_bookstore.gloud.run',
+              '--disable_tracing',
+              ]),
+            (['--service=test_bookstore.gloud.run',
+              '--backend=127.0.0.1:8000',
+              '--rollout_strategy=managed',
+              '--rollout_traffic_policy=percentage',
+              '--rollout_pubsub_subscription=projects/p/subscriptions/rollouts',
+              '--disable_tracing',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--rollout_strategy', 'managed',
+              '--rollout_traffic_policy', 'percentage',
+              '--rollout_pubsub_subscription', 'projects/p/subscriptions/rollouts',
+              '--backend_address', 'http://127.0.0.1:8000',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--disable_tracing',
+              ]),
+            (['--service=test_bookstore.gloud.run',
+              '--backend=127.0.0.1:8000',
+              '--rollout_strategy=managed',
+              '--service_config_cache_path=/var/cache/espv2/service_config.json',
+              '--startup_fetch_timeout=2m',
+              '--disable_tracing',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--rollout_strategy', 'managed',
+              '--service_config_cache_path', '/var/cache/espv2/service_config.json',
+              '--startup_fetch_timeout', '2m',
+              '--backend_address', 'http://127.0.0.1:8000',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--disable_tracing',
+              ]),
+            (['--service=test_bookstore.gloud.run',
+              '--backend=127.0.0.1:8000',
+              '--rollout_strategy=managed',
+              '--canary_fraction=0.1',
+              '--canary_bake_period=30m',
+              '--canary_max_error_rate_increase=0.05',
+              '--status_port=8001',
+              '--disable_tracing',
+              ],
+             ['bin/configmanager', '--logtostderr',
+              '--rollout_strategy', 'managed',
+              '--canary_fraction', '0.1',
+              '--canary_envoy_admin_url', 'http://127.0.0.1:8001',
+              '--canary_bake_period', '30m',
+              '--canary_max_error_rate_increase', '0.05',
+              '--backend_address', 'http://127.0.0.1:8000',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--disable_tracing',
+              ]),
+            (['--service=test_bookstore.gloud.run',
+              '--backend=127.0.0.1:8000',
+              '--healthz=/healthz',
+              '--watchdog_fail_healthz',
+              '--status_port=8001',
+              '--disable_tracing',
+              ],
+             ['bin/configmanager', '--logtostderr', '--rollout_strategy', 'fixed',
+              '--watchdog_envoy_admin_url', 'http://127.0.0.1:8001',
+              '--backend_address', 'http://127.0.0.1:8000',
+              '--healthz', '/healthz',
+              '--v', '0',
+              '--service', 'test_bookstore.gloud.run',
+              '--disable_tracing',
+              ]),
             # Tracing disabled on non-gcp
             (['--service=test_bookstore.gloud.run',
               '--backend=http://127.0.0.1',
@@ -790,11 +1175,18 @@ class TestStartProxy(unittest.TestCase):
             ['--rollout_strategy=managed',
              '--service_json_path=/tmp/service.json'],
             ['--backend_dns_lookup_family=v4'],
+            ['--dns_lookup_family=v4'],
             ['--non_gcp'],
             # Duplicate port flags.
             ['--http_port=8000', '--http2_port=8000'],
             ['--http_port=8000', '--listener_port=8000'],
             ['--listener_port=8000', '--ssl_port=9000'],
+            ['--listener_port=8000', '--listener_uds_path=/var/run/espv2.sock'],
+            ['--listener_address=127.0.0.1', '--listener_uds_path=/var/run/espv2.sock'],
+            ['--ssl_listener_port=8443'],
+            ['--ssl_server_cert_path=/etc/endpoint/ssl', '--ssl_listener_port=443'],
+            ['--ssl_port=9000', '--ssl_listener_port=8443'],
+            ['--https_redirect'],
             # Privileged ports.
             ['--listener_port=80'],
             ['--http_port=80'],
@@ -812,6 +1204,25 @@ class TestStartProxy(unittest.TestCase):
             ['--transcoding_ignore_query_parameters=foo,bar',
              '--transcoding_ignore_unknown_query_parameters'],
             ['--access_log_format'],
+            ['--access_log_json'],
+            ['--canary_fraction=0.1', '--status_port=8001'],
+            ['--canary_fraction=0.1', '--rollout_strategy=managed'],
+            ['--watchdog_fail_healthz', '--status_port=8001'],
+            ['--watchdog_fail_healthz', '--healthz=/healthz'],
+            ['--rollout_traffic_policy=percentage'],
+            ['--rollout_pubsub_subscription=projects/p/subscriptions/rollouts'],
+            ['--service_json_path=/etc/endpoints/service.json',
+             '--service_config_cache_path=/var/cache/espv2/service_config.json'],
+            ['--openapi_path=/etc/endpoints/openapi.json',
+             '--service_json_path=/etc/endpoints/service.json'],
+            ['--openapi_path=/etc/endpoints/openapi.json',
+             '--service=test_bookstore.gloud.run'],
+            ['--openapi_path=/etc/endpoints/openapi.json',
+             '--rollout_strategy=managed'],
+            ['--backend_auth_iam_delegates=delegate-a'],
+            ['--compute_zone_override=datacenter-1a',
+             '--compute_region_override=datacenter-1'],
+            ['--compute_platform_override=on-prem', '--on_serverless'],
             ['--dns=127.0.0.1', '--dns_resolver_address=127.0.0.1'],
             ['--ssl_client_cert_path=/tmp', '--ssl_backend_client_cert_path=/tmp'],
             # The flag --backend default is using http, but the flag --health_check_grpc_backend requires grpc